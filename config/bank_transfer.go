@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BankTransferAccount is the bank account that payers paying by bank transfer are given to pay into. The IBAN and BIC
+// are for payers transferring from outside the UK.
+type BankTransferAccount struct {
+	AccountName   string `json:"account_name"`
+	SortCode      string `json:"sort_code"`
+	AccountNumber string `json:"account_number"`
+	IBAN          string `json:"iban"`
+	BIC           string `json:"bic"`
+}
+
+// BankTransferAccount returns the bank account parsed from BANK_TRANSFER_ACCOUNT, or nil if payment by bank transfer
+// isn't enabled.
+func (c *Config) BankTransferAccount() *BankTransferAccount {
+	return c.bankTransferAccount
+}
+
+// parseBankTransferAccount parses the bank account configured in BANK_TRANSFER_ACCOUNT.
+func (c *Config) parseBankTransferAccount() error {
+	c.bankTransferAccount = nil
+	if c.BankTransferAccountJSON == "" {
+		return nil
+	}
+
+	var account BankTransferAccount
+	if err := json.Unmarshal([]byte(c.BankTransferAccountJSON), &account); err != nil {
+		return fmt.Errorf("error parsing BANK_TRANSFER_ACCOUNT: [%v]", err)
+	}
+
+	c.bankTransferAccount = &account
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Client is a calling service which creates payment sessions, identified by
+// its API key or OAuth client ID.
+type Client struct {
+	ID                 string   `json:"id"`
+	RedirectSigningKey string   `json:"redirect_signing_key"`
+	RedirectAllowList  []string `json:"redirect_allow_list"`
+}
+
+// Clients returns the calling services parsed from CLIENTS.
+func (c *Config) Clients() []Client {
+	return c.clients
+}
+
+// parseClients parses the calling services configured in CLIENTS.
+func (c *Config) parseClients() error {
+	c.clients = nil
+	if c.ClientsJSON == "" {
+		return nil
+	}
+
+	var clients []Client
+	if err := json.Unmarshal([]byte(c.ClientsJSON), &clients); err != nil {
+		return fmt.Errorf("error parsing CLIENTS: [%v]", err)
+	}
+
+	c.clients = clients
+	return nil
+}
+
+// Client returns the calling service with the given ID, or nil if it isn't
+// configured.
+func (c *Config) Client(id string) *Client {
+	for i, client := range c.clients {
+		if client.ID == id {
+			return &c.clients[i]
+		}
+	}
+	return nil
+}
+
+// RedirectAllowListForClient returns the origins and path prefixes that the
+// calling service with the given ID may use as a redirect_uri. Clients without
+// their own allow list use REDIRECT_ALLOW_LIST.
+func (c *Config) RedirectAllowListForClient(id string) []string {
+	client := c.Client(id)
+	if client != nil && len(client.RedirectAllowList) > 0 {
+		return client.RedirectAllowList
+	}
+	return c.RedirectAllowList
+}
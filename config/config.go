@@ -4,7 +4,9 @@
 package config
 
 import (
+	"errors"
 	"sync"
+	"text/template"
 
 	"github.com/companieshouse/gofigure"
 )
@@ -12,24 +14,50 @@ import (
 var cfg *Config
 var mtx sync.Mutex
 
-// Config defines the configuration options for this service.
+// Config defines the configuration options for this service, and the settings
+// parsed from the JSON options by Parse.
 type Config struct {
+	Settings
+
+	govPayAccounts []GovPayAccount
+	clients        []Client
+
+	govPayDescriptionTemplates map[string]*template.Template
+	bankTransferAccount        *BankTransferAccount
+	expiryTimesByClass         map[string]int
+}
+
+// Settings defines the environment variables and command-line flags supported
+// by this service.
+type Settings struct {
 	BindAddr                          string   `env:"BIND_ADDR"                       flag:"bind-addr"                         flagDesc:"Bind address"`
 	Collection                        string   `env:"MONGODB_COLLECTION"              flag:"mongodb-collection"                flagDesc:"MongoDB collection for data"`
+	PaymentRequestsCollection         string   `env:"MONGODB_PAYMENT_REQUESTS_COLLECTION" flag:"mongodb-payment-requests-collection" flagDesc:"MongoDB collection for payment requests raised by admins"`
+	AccountsCollection                string   `env:"MONGODB_ACCOUNTS_COLLECTION"     flag:"mongodb-accounts-collection"       flagDesc:"MongoDB collection for presenter credit accounts"`
+	AccountLedgerCollection           string   `env:"MONGODB_ACCOUNT_LEDGER_COLLECTION" flag:"mongodb-account-ledger-collection" flagDesc:"MongoDB collection for the ledger of debits and credits to presenter credit accounts"`
+	BankCreditsCollection             string   `env:"MONGODB_BANK_CREDITS_COLLECTION" flag:"mongodb-bank-credits-collection"   flagDesc:"MongoDB collection for the credits imported from bank statements"`
+	ResourceClaimsCollection          string   `env:"MONGODB_RESOURCE_CLAIMS_COLLECTION" flag:"mongodb-resource-claims-collection" flagDesc:"MongoDB collection for the claims payment sessions hold on the cost resources they pay"`
 	Database                          string   `env:"MONGODB_DATABASE"                flag:"mongodb-database"                  flagDesc:"MongoDB database for data"`
 	MongoDBURL                        string   `env:"MONGODB_URL"                     flag:"mongodb-url"                       flagDesc:"MongoDB server URL"`
-	DomainAllowList                   string   `env:"DOMAIN_ALLOW_LIST"               flag:"domain-allow-list"                 flagDesc:"List of Valid Domains"`
+	DomainAllowList                   []string `env:"DOMAIN_ALLOW_LIST"               flag:"domain-allow-list"                 flagDesc:"List of Valid Domains"`
 	PaymentsWebURL                    string   `env:"PAYMENTS_WEB_URL"                flag:"payments-web-url"                  flagDesc:"Base URL for the Payment Service Web"`
+	PaymentsWebErrorURL               string   `env:"PAYMENTS_WEB_ERROR_URL"          flag:"payments-web-error-url"            flagDesc:"Page users are sent to when a payment provider callback fails - defaults to /payments/error on the Payment Service Web"`
 	PaymentsAPIURL                    string   `env:"PAYMENTS_API_URL"                flag:"payments-api-url"                  flagDesc:"Base URL for the Payment Service API"`
 	GovPayURL                         string   `env:"GOV_PAY_URL"                     flag:"gov-pay-url"                       flagDesc:"URL used to make calls to GovPay"`
 	GovPayBearerTokenTreasury         string   `env:"GOV_PAY_BEARER_TOKEN_TREASURY"   flag:"gov-pay-bearer-token-treasury"     flagDesc:"Bearer Token used to authenticate API calls with GovPay for treasury payments"`
 	GovPayBearerTokenChAccount        string   `env:"GOV_PAY_BEARER_TOKEN_CH_ACCOUNT" flag:"gov-pay-bearer-token-ch-account"   flagDesc:"Bearer Token used to authenticate API calls with GovPay for Companies House payments"`
 	GovPayBearerTokenSanctionsAccount string   `env:"GOV_PAY_BEARER_TOKEN_SANCTIONS_ACCOUNT" flag:"gov-pay-bearer-token-sanctions-account"   flagDesc:"Bearer Token used to authenticate API calls with GovPay for sanctions penalty payments"`
 	GovPayBearerTokenLegacy           string   `env:"GOV_PAY_BEARER_TOKEN_LEGACY"     flag:"gov-pay-bearer-token-legacy"       flagDesc:"Bearer Token used to authenticate API calls with GovPay for payments on legacy Companies House services"`
+	GovPayAccountsJSON                string   `env:"GOV_PAY_ACCOUNTS"                flag:"gov-pay-accounts"                  flagDesc:"JSON list of GOV.UK Pay accounts, each with a bearer token, description, classes of payment and sandbox flag"`
+	GovPayDescriptionTemplatesJSON    string   `env:"GOV_PAY_DESCRIPTION_TEMPLATES"   flag:"gov-pay-description-templates"     flagDesc:"JSON object of templates for the GOV.UK Pay payment description, keyed by class of payment"`
 	GovPaySandbox                     bool     `env:"GOV_PAY_SANDBOX"                 flag:"gov-pay-sandbox"                   flagDesc:"Gov Pay Sandbox - returns different refund status values"`
 	GovPayExpiryTime                  int      `env:"GOV_PAY_EXPIRY_TIME"             flag:"gov-pay-expiry_time"               flagDesc:"Gov Pay Expiry Time in minutes"`
 	GovPayMaxCheckingDays             int      `env:"GOV_PAY_MAX_CHECKING_DAYS"       flag:"gov-pay-max-checking-days"         flagDesc:"Gov Pay Max Allowed Days for rechecking payment"`
-	ExpiryTimeInMinutes               string   `env:"EXPIRY_TIME_IN_MINUTES"          flag:"expiry-time-in-minutes"            flagDesc:"The expiry time for the payment session in minutes"`
+	ExpiryTimeInMinutes               int      `env:"EXPIRY_TIME_IN_MINUTES"          flag:"expiry-time-in-minutes"            flagDesc:"The expiry time for the payment session in minutes"`
+	ExpiryTimeByClassJSON             string   `env:"EXPIRY_TIME_BY_CLASS"            flag:"expiry-time-by-class"              flagDesc:"JSON object of the expiry time for payment sessions in minutes, keyed by class of payment"`
+	MinExpiryTimeInMinutes            int      `env:"MIN_EXPIRY_TIME_IN_MINUTES"      flag:"min-expiry-time-in-minutes"        flagDesc:"The shortest expiry time in minutes a calling service can ask for"`
+	MaxExpiryTimeInMinutes            int      `env:"MAX_EXPIRY_TIME_IN_MINUTES"      flag:"max-expiry-time-in-minutes"        flagDesc:"The longest expiry time in minutes a calling service can ask for"`
+	MaxSessionLifetimeInMinutes       int      `env:"MAX_SESSION_LIFETIME_IN_MINUTES" flag:"max-session-lifetime-in-minutes"   flagDesc:"The number of minutes after it was created that a payment session can't be extended past"`
 	BrokerAddr                        []string `env:"KAFKA_BROKER_ADDR"               flag:"broker-addr"                       flagDesc:"Kafka broker address"`
 	SchemaRegistryURL                 string   `env:"SCHEMA_REGISTRY_URL"             flag:"schema-registry-url"               flagDesc:"Schema registry url"`
 	ChsAPIKey                         string   `env:"CHS_API_KEY"                     flag:"chs-api-key"                       flagDesc:"API access key"`
@@ -39,20 +67,48 @@ type Config struct {
 	PaypalSecret                      string   `env:"PAYPAL_SECRET"                   flag:"paypal-secret"                     flagDesc:"PayPal Secret"`
 	RefundBatchSize                   int      `env:"REFUND_BATCH_SIZE"               flag:"refund-batch-size"                 flagDesc:"Refund batch size"`
 	PaymentProcessedTopic             string   `env:"PAYMENT_PROCESSED_TOPIC"         flag:"payment-processed-topic"           flagDesc:"Payment processed topic"`
+	OtelExporterEndpoint              string   `env:"OTEL_EXPORTER_OTLP_ENDPOINT"     flag:"otel-exporter-otlp-endpoint"       flagDesc:"OTLP/HTTP endpoint traces are exported to - tracing is disabled if unset"`
+	OtelServiceName                   string   `env:"OTEL_SERVICE_NAME"               flag:"otel-service-name"                 flagDesc:"Service name reported on exported traces"`
+	ReadTimeoutInSeconds              int      `env:"READ_TIMEOUT_IN_SECONDS"         flag:"read-timeout-in-seconds"           flagDesc:"Maximum time allowed to read a request, including the body"`
+	WriteTimeoutInSeconds             int      `env:"WRITE_TIMEOUT_IN_SECONDS"        flag:"write-timeout-in-seconds"          flagDesc:"Maximum time allowed to handle a request and write the response"`
+	IdleTimeoutInSeconds              int      `env:"IDLE_TIMEOUT_IN_SECONDS"         flag:"idle-timeout-in-seconds"           flagDesc:"Maximum time a keep-alive connection is left idle"`
+	DrainDelayInSeconds               int      `env:"DRAIN_DELAY_IN_SECONDS"          flag:"drain-delay-in-seconds"            flagDesc:"Time the healthcheck fails for on shutdown before the server stops accepting requests"`
+	ShutdownGracePeriodInSeconds      int      `env:"SHUTDOWN_GRACE_PERIOD_IN_SECONDS" flag:"shutdown-grace-period-in-seconds" flagDesc:"Maximum time allowed to drain in-flight work on shutdown"`
+	RedirectAllowList                 []string `env:"REDIRECT_ALLOW_LIST"             flag:"redirect-allow-list"               flagDesc:"Origins and path prefixes allowed as a redirect_uri for clients without their own allow list"`
+	ClientsJSON                       string   `env:"CLIENTS"                         flag:"clients"                           flagDesc:"JSON list of calling services, each with an ID and the key used to sign redirects back to it"`
+	BankTransferAccountJSON           string   `env:"BANK_TRANSFER_ACCOUNT"           flag:"bank-transfer-account"             flagDesc:"JSON object of the bank account payers are given to pay by bank transfer - bank transfers are disabled if unset"`
+	BankTransferExpiryTimeInMinutes   int      `env:"BANK_TRANSFER_EXPIRY_TIME_IN_MINUTES" flag:"bank-transfer-expiry-time-in-minutes" flagDesc:"The number of minutes a payment session awaiting a bank transfer expires after the transfer is chosen"`
+	PayerLinkSigningKey               string   `env:"PAYER_LINK_SIGNING_KEY"          flag:"payer-link-signing-key"            flagDesc:"Key used to sign links letting someone other than its creator pay a payment session - pay-on-behalf links are disabled if unset"`
+	CheckConfig                       bool     `env:"CHECK_CONFIG"                    flag:"check-config"                      flagDesc:"Validate the configuration, report any problems and exit"`
 }
 
 // DefaultConfig returns a pointer to a Config instance that has been populated
 // with default values.
 func DefaultConfig() *Config {
-	return &Config{
-		Database:              "payments",
-		Collection:            "payments",
-		ExpiryTimeInMinutes:   "90",
-		GovPayExpiryTime:      90,
-		GovPayMaxCheckingDays: 30,
-		RefundBatchSize:       20,
-		PaymentProcessedTopic: "cidev-payment-processed",
-	}
+	return &Config{Settings: Settings{
+		Database:                        "payments",
+		Collection:                      "payments",
+		PaymentRequestsCollection:       "payment_requests",
+		AccountsCollection:              "accounts",
+		AccountLedgerCollection:         "account_ledger",
+		BankCreditsCollection:           "bank_credits",
+		ResourceClaimsCollection:        "resource_claims",
+		ExpiryTimeInMinutes:             90,
+		MinExpiryTimeInMinutes:          15,
+		MaxExpiryTimeInMinutes:          1440,
+		MaxSessionLifetimeInMinutes:     2880,
+		BankTransferExpiryTimeInMinutes: 20160,
+		GovPayExpiryTime:                90,
+		GovPayMaxCheckingDays:           30,
+		RefundBatchSize:                 20,
+		PaymentProcessedTopic:           "cidev-payment-processed",
+		OtelServiceName:                 "payments.api.ch.gov.uk",
+		ReadTimeoutInSeconds:            15,
+		WriteTimeoutInSeconds:           60,
+		IdleTimeoutInSeconds:            120,
+		DrainDelayInSeconds:             5,
+		ShutdownGracePeriodInSeconds:    30,
+	}}
 }
 
 // Get returns a pointer to a Config instance that has been populated with
@@ -68,10 +124,29 @@ func Get() (*Config, error) {
 
 	cfg = DefaultConfig()
 
-	err := gofigure.Gofigure(cfg)
+	err := gofigure.Gofigure(&cfg.Settings)
 	if err != nil {
 		return nil, err
 	}
 
 	return cfg, nil
 }
+
+// defaultPaymentsWebErrorPath is the page on the Payment Service Web that users are sent to when a payment provider
+// callback fails, unless PAYMENTS_WEB_ERROR_URL is set
+const defaultPaymentsWebErrorPath = "/payments/error"
+
+// PaymentsWebErrorPage returns the URL of the page users are sent to when a payment provider callback fails
+func (c *Config) PaymentsWebErrorPage() string {
+	if c.PaymentsWebErrorURL != "" {
+		return c.PaymentsWebErrorURL
+	}
+	return c.PaymentsWebURL + defaultPaymentsWebErrorPath
+}
+
+// Parse parses the JSON options into the settings they configure, so that they
+// are parsed once rather than on every request. Validate parses them too, so a
+// configuration that has been validated needn't be parsed again.
+func (c *Config) Parse() error {
+	return errors.Join(c.parseGovPayAccounts(), c.parseClients(), c.parseGovPayDescriptionTemplates(), c.parseBankTransferAccount(), c.parseExpiryTimesByClass())
+}
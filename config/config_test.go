@@ -23,3 +23,16 @@ func TestUnitGet(t *testing.T) {
 	})
 
 }
+
+func TestUnitPaymentsWebErrorPage(t *testing.T) {
+
+	Convey("Defaults to the error page on the Payment Service Web", t, func() {
+		c := &Config{Settings: Settings{PaymentsWebURL: "https://payments.web"}}
+		So(c.PaymentsWebErrorPage(), ShouldEqual, "https://payments.web/payments/error")
+	})
+
+	Convey("Uses PAYMENTS_WEB_ERROR_URL when set", t, func() {
+		c := &Config{Settings: Settings{PaymentsWebURL: "https://payments.web", PaymentsWebErrorURL: "https://www.companieshouse.gov.uk/error"}}
+		So(c.PaymentsWebErrorPage(), ShouldEqual, "https://www.companieshouse.gov.uk/error")
+	})
+}
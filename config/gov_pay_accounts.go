@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// defaultGovPayDescription is shown on the GOV.UK Pay payment screens for
+// accounts that don't configure their own description.
+const defaultGovPayDescription = "Companies House Payment"
+
+// GovPayAccount is a GOV.UK Pay service account, and the classes of payment
+// that are taken through it.
+type GovPayAccount struct {
+	Name             string   `json:"name"`
+	BearerToken      string   `json:"bearer_token"`
+	Description      string   `json:"description"`
+	ClassesOfPayment []string `json:"classes_of_payment"`
+	Sandbox          bool     `json:"sandbox"`
+}
+
+// GovPayAccounts returns the GOV.UK Pay accounts payments can be taken
+// through. The accounts are those parsed from GOV_PAY_ACCOUNTS when it is set,
+// and otherwise built from the individual GOV_PAY_BEARER_TOKEN_* settings.
+func (c *Config) GovPayAccounts() []GovPayAccount {
+	if c.GovPayAccountsJSON == "" {
+		return c.legacyGovPayAccounts()
+	}
+	return c.govPayAccounts
+}
+
+// parseGovPayAccounts parses the accounts configured in GOV_PAY_ACCOUNTS.
+func (c *Config) parseGovPayAccounts() error {
+	c.govPayAccounts = nil
+	if c.GovPayAccountsJSON == "" {
+		return nil
+	}
+
+	var accounts []GovPayAccount
+	if err := json.Unmarshal([]byte(c.GovPayAccountsJSON), &accounts); err != nil {
+		return fmt.Errorf("error parsing GOV_PAY_ACCOUNTS: [%v]", err)
+	}
+	for i := range accounts {
+		if accounts[i].Description == "" {
+			accounts[i].Description = defaultGovPayDescription
+		}
+	}
+
+	c.govPayAccounts = accounts
+	return nil
+}
+
+// GovPayAccountForClass returns the GOV.UK Pay account that payments of the
+// given class are taken through.
+func (c *Config) GovPayAccountForClass(classOfPayment string) (*GovPayAccount, error) {
+	accounts := c.GovPayAccounts()
+	for i, account := range accounts {
+		for _, class := range account.ClassesOfPayment {
+			if class == classOfPayment {
+				return &accounts[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("payment class [%s] not recognised", classOfPayment)
+}
+
+// legacyGovPayAccounts maps the classes of payment to the accounts configured
+// by the individual bearer token settings, which predate GOV_PAY_ACCOUNTS.
+func (c *Config) legacyGovPayAccounts() []GovPayAccount {
+	return []GovPayAccount{
+		{
+			Name:             "ch-account",
+			BearerToken:      c.GovPayBearerTokenChAccount,
+			Description:      defaultGovPayDescription,
+			ClassesOfPayment: []string{"data-maintenance", "orderable-item"},
+			Sandbox:          c.GovPaySandbox,
+		},
+		{
+			Name:             "legacy",
+			BearerToken:      c.GovPayBearerTokenLegacy,
+			Description:      defaultGovPayDescription,
+			ClassesOfPayment: []string{"legacy"},
+			Sandbox:          c.GovPaySandbox,
+		},
+		{
+			Name:             "treasury",
+			BearerToken:      c.GovPayBearerTokenTreasury,
+			Description:      defaultGovPayDescription,
+			ClassesOfPayment: []string{"penalty-lfp"},
+			Sandbox:          c.GovPaySandbox,
+		},
+		{
+			Name:             "sanctions",
+			BearerToken:      c.GovPayBearerTokenSanctionsAccount,
+			Description:      defaultGovPayDescription,
+			ClassesOfPayment: []string{"penalty-sanctions"},
+			Sandbox:          c.GovPaySandbox,
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGovPayAccounts(t *testing.T) {
+
+	Convey("Accounts built from the individual bearer tokens when GOV_PAY_ACCOUNTS is unset", t, func() {
+		c := DefaultConfig()
+		c.GovPayBearerTokenChAccount = "ch"
+		c.GovPaySandbox = true
+
+		account, err := c.GovPayAccountForClass("orderable-item")
+		So(err, ShouldBeNil)
+		So(account.BearerToken, ShouldEqual, "ch")
+		So(account.Description, ShouldEqual, "Companies House Payment")
+		So(account.Sandbox, ShouldBeTrue)
+	})
+
+	Convey("Accounts parsed from GOV_PAY_ACCOUNTS", t, func() {
+		c := DefaultConfig()
+		c.GovPayAccountsJSON = `[
+			{"name":"treasury","bearer_token":"t","description":"Late filing penalty","classes_of_payment":["penalty-lfp"]},
+			{"name":"new","bearer_token":"n","classes_of_payment":["penalty-new"],"sandbox":true}
+		]`
+		So(c.Parse(), ShouldBeNil)
+
+		So(c.GovPayAccounts(), ShouldHaveLength, 2)
+
+		account, err := c.GovPayAccountForClass("penalty-lfp")
+		So(err, ShouldBeNil)
+		So(account.Name, ShouldEqual, "treasury")
+		So(account.Description, ShouldEqual, "Late filing penalty")
+		So(account.Sandbox, ShouldBeFalse)
+
+		account, err = c.GovPayAccountForClass("penalty-new")
+		So(err, ShouldBeNil)
+		So(account.BearerToken, ShouldEqual, "n")
+		So(account.Description, ShouldEqual, "Companies House Payment")
+		So(account.Sandbox, ShouldBeTrue)
+	})
+
+	Convey("Legacy bearer tokens are ignored once GOV_PAY_ACCOUNTS is set", t, func() {
+		c := DefaultConfig()
+		c.GovPayBearerTokenChAccount = "ch"
+		c.GovPayAccountsJSON = `[{"name":"treasury","bearer_token":"t","classes_of_payment":["penalty-lfp"]}]`
+		So(c.Parse(), ShouldBeNil)
+
+		account, err := c.GovPayAccountForClass("data-maintenance")
+		So(account, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "payment class [data-maintenance] not recognised")
+	})
+
+	Convey("Invalid GOV_PAY_ACCOUNTS", t, func() {
+		c := DefaultConfig()
+		c.GovPayAccountsJSON = `{"name":"treasury"}`
+
+		err := c.Parse()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "error parsing GOV_PAY_ACCOUNTS")
+		So(c.GovPayAccounts(), ShouldBeEmpty)
+	})
+
+	Convey("Validation of GOV_PAY_ACCOUNTS", t, func() {
+		c := validConfig()
+		c.GovPayAccountsJSON = `[
+			{"name":"treasury","bearer_token":"t","classes_of_payment":["penalty-lfp"]},
+			{"name":"duplicate","classes_of_payment":["penalty-lfp"]},
+			{"name":"empty","bearer_token":"e"}
+		]`
+
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "no GOV.UK Pay bearer token configured for class of payment [penalty-lfp]")
+		So(err.Error(), ShouldContainSubstring, "class of payment [penalty-lfp] is mapped to GOV.UK Pay accounts [treasury] and [duplicate]")
+		So(err.Error(), ShouldContainSubstring, "no classes of payment configured for GOV.UK Pay account [empty]")
+	})
+}
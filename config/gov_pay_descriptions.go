@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// GovPayDescriptionTemplates returns the templates the description shown on the GOV.UK Pay payment screens is built
+// from, keyed by class of payment. The templates are executed with the payment session, so can refer to fields such
+// as {{.Reference}}, {{.CompanyNumber}} and the {{.Costs}} being paid for.
+func (c *Config) GovPayDescriptionTemplates() map[string]*template.Template {
+	return c.govPayDescriptionTemplates
+}
+
+// parseGovPayDescriptionTemplates parses the templates configured in GOV_PAY_DESCRIPTION_TEMPLATES.
+func (c *Config) parseGovPayDescriptionTemplates() error {
+	c.govPayDescriptionTemplates = nil
+	if c.GovPayDescriptionTemplatesJSON == "" {
+		return nil
+	}
+
+	var sources map[string]string
+	if err := json.Unmarshal([]byte(c.GovPayDescriptionTemplatesJSON), &sources); err != nil {
+		return fmt.Errorf("error parsing GOV_PAY_DESCRIPTION_TEMPLATES: [%v]", err)
+	}
+
+	templates := make(map[string]*template.Template, len(sources))
+	for class, source := range sources {
+		tmpl, err := template.New(class).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return fmt.Errorf("error parsing GOV.UK Pay description template for class of payment [%s]: [%v]", class, err)
+		}
+		templates[class] = tmpl
+	}
+
+	c.govPayDescriptionTemplates = templates
+	return nil
+}
+
+// GovPayDescriptionTemplate returns the template for the GOV.UK Pay description of payments of the given class, or nil
+// if the class has no template and the account's description is used. Templates for payment journeys taken in a
+// language other than English are keyed by the class of payment and the language, such as penalty-lfp.cy, and the
+// class's English template is used if there isn't one for the language.
+func (c *Config) GovPayDescriptionTemplate(classOfPayment, language string) *template.Template {
+	if tmpl, ok := c.govPayDescriptionTemplates[classOfPayment+"."+language]; ok {
+		return tmpl
+	}
+	return c.govPayDescriptionTemplates[classOfPayment]
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGovPayDescriptionTemplates(t *testing.T) {
+
+	Convey("No templates when GOV_PAY_DESCRIPTION_TEMPLATES is unset", t, func() {
+		c := DefaultConfig()
+		So(c.Parse(), ShouldBeNil)
+		So(c.GovPayDescriptionTemplate("penalty-lfp", ""), ShouldBeNil)
+	})
+
+	Convey("Templates parsed from GOV_PAY_DESCRIPTION_TEMPLATES", t, func() {
+		c := DefaultConfig()
+		c.GovPayDescriptionTemplatesJSON = `{"penalty-lfp":"Late filing penalty {{.Reference}}"}`
+		So(c.Parse(), ShouldBeNil)
+
+		tmpl := c.GovPayDescriptionTemplate("penalty-lfp", "")
+		So(tmpl, ShouldNotBeNil)
+
+		var description strings.Builder
+		So(tmpl.Execute(&description, map[string]string{"Reference": "A0000001"}), ShouldBeNil)
+		So(description.String(), ShouldEqual, "Late filing penalty A0000001")
+
+		So(c.GovPayDescriptionTemplate("orderable-item", ""), ShouldBeNil)
+	})
+
+	Convey("Templates selected by the language of the payment journey", t, func() {
+		c := DefaultConfig()
+		c.GovPayDescriptionTemplatesJSON = `{"penalty-lfp":"Late filing penalty","penalty-lfp.cy":"Cosb am ffeilio'n hwyr","orderable-item":"Order"}`
+		So(c.Parse(), ShouldBeNil)
+
+		for _, tc := range []struct{ class, language, expected string }{
+			{"penalty-lfp", "", "Late filing penalty"},
+			{"penalty-lfp", "en", "Late filing penalty"},
+			{"penalty-lfp", "cy", "Cosb am ffeilio'n hwyr"},
+			{"orderable-item", "cy", "Order"},
+		} {
+			tmpl := c.GovPayDescriptionTemplate(tc.class, tc.language)
+
+			var description strings.Builder
+			So(tmpl.Execute(&description, nil), ShouldBeNil)
+			So(description.String(), ShouldEqual, tc.expected)
+		}
+	})
+
+	Convey("Invalid GOV_PAY_DESCRIPTION_TEMPLATES", t, func() {
+		c := DefaultConfig()
+		c.GovPayDescriptionTemplatesJSON = `["penalty-lfp"]`
+
+		err := c.Parse()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "error parsing GOV_PAY_DESCRIPTION_TEMPLATES")
+		So(c.GovPayDescriptionTemplates(), ShouldBeEmpty)
+	})
+
+	Convey("Validation of GOV_PAY_DESCRIPTION_TEMPLATES", t, func() {
+		c := validConfig()
+		c.GovPayDescriptionTemplatesJSON = `{"penalty-lfp":"Late filing penalty {{.Reference"}`
+
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "error parsing GOV.UK Pay description template for class of payment [penalty-lfp]")
+	})
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ExpiryTimesByClass returns the number of minutes payment sessions expire after by default, keyed by class of
+// payment. Classes without an expiry time of their own expire after EXPIRY_TIME_IN_MINUTES.
+func (c *Config) ExpiryTimesByClass() map[string]int {
+	return c.expiryTimesByClass
+}
+
+// parseExpiryTimesByClass parses the expiry times configured in EXPIRY_TIME_BY_CLASS.
+func (c *Config) parseExpiryTimesByClass() error {
+	c.expiryTimesByClass = nil
+	if c.ExpiryTimeByClassJSON == "" {
+		return nil
+	}
+
+	var expiryTimes map[string]int
+	if err := json.Unmarshal([]byte(c.ExpiryTimeByClassJSON), &expiryTimes); err != nil {
+		return fmt.Errorf("error parsing EXPIRY_TIME_BY_CLASS: [%v]", err)
+	}
+
+	c.expiryTimesByClass = expiryTimes
+	return nil
+}
+
+// ExpiryTimeForClass returns the number of minutes payment sessions of the given class of payment expire after, unless
+// the calling service asks for another expiry time
+func (c *Config) ExpiryTimeForClass(classOfPayment string) int {
+	if minutes, ok := c.expiryTimesByClass[classOfPayment]; ok {
+		return minutes
+	}
+	return c.ExpiryTimeInMinutes
+}
+
+// WithinExpiryBounds reports whether an expiry time in minutes is between the shortest and longest a calling service
+// can ask for
+func (c *Config) WithinExpiryBounds(minutes int) bool {
+	return minutes >= c.MinExpiryTimeInMinutes && minutes <= c.MaxExpiryTimeInMinutes
+}
+
+// LatestExpiry returns the latest a payment session created at the given time can be extended to expire
+func (c *Config) LatestExpiry(createdAt time.Time) time.Time {
+	return createdAt.Add(time.Minute * time.Duration(c.MaxSessionLifetimeInMinutes))
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitExpiryTimeForClass(t *testing.T) {
+
+	Convey("Default expiry time when EXPIRY_TIME_BY_CLASS is unset", t, func() {
+		c := DefaultConfig()
+		c.ExpiryTimeInMinutes = 90
+
+		So(c.Parse(), ShouldBeNil)
+		So(c.ExpiryTimeForClass("penalty-lfp"), ShouldEqual, 90)
+	})
+
+	Convey("Expiry time parsed from EXPIRY_TIME_BY_CLASS", t, func() {
+		c := DefaultConfig()
+		c.ExpiryTimeInMinutes = 90
+		c.ExpiryTimeByClassJSON = `{"orderable-item":600}`
+
+		So(c.Parse(), ShouldBeNil)
+		So(c.ExpiryTimeForClass("orderable-item"), ShouldEqual, 600)
+		So(c.ExpiryTimeForClass("penalty-lfp"), ShouldEqual, 90)
+	})
+
+	Convey("Invalid EXPIRY_TIME_BY_CLASS", t, func() {
+		c := DefaultConfig()
+		c.ExpiryTimeByClassJSON = `{"orderable-item":"600"}`
+
+		err := c.Parse()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "error parsing EXPIRY_TIME_BY_CLASS")
+		So(c.ExpiryTimesByClass(), ShouldBeEmpty)
+	})
+}
+
+func TestUnitWithinExpiryBounds(t *testing.T) {
+
+	Convey("Expiry times checked against the bounds", t, func() {
+		c := DefaultConfig()
+		c.MinExpiryTimeInMinutes = 15
+		c.MaxExpiryTimeInMinutes = 1440
+
+		So(c.WithinExpiryBounds(14), ShouldBeFalse)
+		So(c.WithinExpiryBounds(15), ShouldBeTrue)
+		So(c.WithinExpiryBounds(1440), ShouldBeTrue)
+		So(c.WithinExpiryBounds(1441), ShouldBeFalse)
+	})
+}
+
+func TestUnitLatestExpiry(t *testing.T) {
+
+	Convey("Sessions can't be extended past their maximum lifetime", t, func() {
+		c := DefaultConfig()
+		c.MaxSessionLifetimeInMinutes = 2880
+
+		createdAt := time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC)
+		So(c.LatestExpiry(createdAt), ShouldEqual, time.Date(2026, 10, 3, 9, 30, 0, 0, time.UTC))
+	})
+}
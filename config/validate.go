@@ -0,0 +1,345 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Validate checks that the configuration is complete and well formed. Every
+// problem found is reported in the returned error rather than just the first,
+// so that a misconfigured deployment can be fixed in one pass.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.BindAddr == "" {
+		errs = append(errs, errors.New("BIND_ADDR must be set"))
+	}
+
+	if err := validateMongoDBURL(c.MongoDBURL); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Database == "" {
+		errs = append(errs, errors.New("MONGODB_DATABASE must be set"))
+	}
+	if c.Collection == "" {
+		errs = append(errs, errors.New("MONGODB_COLLECTION must be set"))
+	}
+	if c.PaymentRequestsCollection == "" {
+		errs = append(errs, errors.New("MONGODB_PAYMENT_REQUESTS_COLLECTION must be set"))
+	}
+	if c.AccountsCollection == "" {
+		errs = append(errs, errors.New("MONGODB_ACCOUNTS_COLLECTION must be set"))
+	}
+	if c.AccountLedgerCollection == "" {
+		errs = append(errs, errors.New("MONGODB_ACCOUNT_LEDGER_COLLECTION must be set"))
+	}
+	if c.BankCreditsCollection == "" {
+		errs = append(errs, errors.New("MONGODB_BANK_CREDITS_COLLECTION must be set"))
+	}
+	if c.ResourceClaimsCollection == "" {
+		errs = append(errs, errors.New("MONGODB_RESOURCE_CLAIMS_COLLECTION must be set"))
+	}
+
+	for name, value := range map[string]string{
+		"PAYMENTS_WEB_URL":    c.PaymentsWebURL,
+		"PAYMENTS_API_URL":    c.PaymentsAPIURL,
+		"GOV_PAY_URL":         c.GovPayURL,
+		"SCHEMA_REGISTRY_URL": c.SchemaRegistryURL,
+	} {
+		if err := validateHTTPURL(name, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.DomainAllowList) == 0 {
+		errs = append(errs, errors.New("DOMAIN_ALLOW_LIST must contain at least one domain"))
+	}
+	for _, domain := range c.DomainAllowList {
+		if err := validateDomain(domain); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, c.validateGovPayAccounts()...)
+	if err := c.parseGovPayDescriptionTemplates(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.RedirectAllowList) == 0 {
+		errs = append(errs, errors.New("REDIRECT_ALLOW_LIST must contain at least one origin"))
+	}
+	for _, entry := range c.RedirectAllowList {
+		if err := validateRedirectAllowListEntry("REDIRECT_ALLOW_LIST", entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, c.validateClients()...)
+	errs = append(errs, c.validateBankTransferAccount()...)
+	if c.PayerLinkSigningKey != "" && len(c.PayerLinkSigningKey) < minimumSigningKeyLength {
+		errs = append(errs, fmt.Errorf("PAYER_LINK_SIGNING_KEY must be at least %d characters", minimumSigningKeyLength))
+	}
+
+	for name, value := range map[string]int{
+		"EXPIRY_TIME_IN_MINUTES":               c.ExpiryTimeInMinutes,
+		"MIN_EXPIRY_TIME_IN_MINUTES":           c.MinExpiryTimeInMinutes,
+		"GOV_PAY_EXPIRY_TIME":                  c.GovPayExpiryTime,
+		"BANK_TRANSFER_EXPIRY_TIME_IN_MINUTES": c.BankTransferExpiryTimeInMinutes,
+		"GOV_PAY_MAX_CHECKING_DAYS":            c.GovPayMaxCheckingDays,
+		"REFUND_BATCH_SIZE":                    c.RefundBatchSize,
+		"READ_TIMEOUT_IN_SECONDS":              c.ReadTimeoutInSeconds,
+		"WRITE_TIMEOUT_IN_SECONDS":             c.WriteTimeoutInSeconds,
+		"IDLE_TIMEOUT_IN_SECONDS":              c.IdleTimeoutInSeconds,
+		"SHUTDOWN_GRACE_PERIOD_IN_SECONDS":     c.ShutdownGracePeriodInSeconds,
+	} {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than zero, got [%d]", name, value))
+		}
+	}
+	errs = append(errs, c.validateExpiryTimes()...)
+	if c.DrainDelayInSeconds < 0 {
+		errs = append(errs, fmt.Errorf("DRAIN_DELAY_IN_SECONDS must not be negative, got [%d]", c.DrainDelayInSeconds))
+	}
+
+	if len(c.BrokerAddr) == 0 {
+		errs = append(errs, errors.New("KAFKA_BROKER_ADDR must contain at least one broker"))
+	}
+	for _, broker := range c.BrokerAddr {
+		if err := validateBrokerAddr(broker); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.PaymentProcessedTopic == "" {
+		errs = append(errs, errors.New("PAYMENT_PROCESSED_TOPIC must be set"))
+	}
+
+	if c.ChsAPIKey == "" {
+		errs = append(errs, errors.New("CHS_API_KEY must be set"))
+	}
+
+	if _, err := regexp.Compile(c.SecureAppCostsRegex); err != nil {
+		errs = append(errs, fmt.Errorf("SECURE_APP_COSTS_REGEX is not a valid regular expression: [%v]", err))
+	}
+
+	if c.PaypalEnv != "live" && c.PaypalEnv != "test" {
+		errs = append(errs, fmt.Errorf("PAYPAL_ENV must be live or test, got [%s]", c.PaypalEnv))
+	}
+	if c.PaypalClientID == "" {
+		errs = append(errs, errors.New("PAYPAL_CLIENT_ID must be set"))
+	}
+	if c.PaypalSecret == "" {
+		errs = append(errs, errors.New("PAYPAL_SECRET must be set"))
+	}
+
+	if c.PaymentsWebErrorURL != "" {
+		if err := validateHTTPURL("PAYMENTS_WEB_ERROR_URL", c.PaymentsWebErrorURL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.OtelExporterEndpoint != "" {
+		if err := validateHTTPURL("OTEL_EXPORTER_OTLP_ENDPOINT", c.OtelExporterEndpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Map iteration order is random, so sort to keep the report stable between runs
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	return errors.Join(errs...)
+}
+
+// validateGovPayAccounts reports accounts without a bearer token or classes
+// of payment, and classes of payment that are mapped to more than one account.
+func (c *Config) validateGovPayAccounts() []error {
+	if err := c.parseGovPayAccounts(); err != nil {
+		return []error{err}
+	}
+	accounts := c.GovPayAccounts()
+	if len(accounts) == 0 {
+		return []error{errors.New("GOV_PAY_ACCOUNTS must contain at least one account")}
+	}
+
+	var errs []error
+	accountForClass := make(map[string]string)
+	for _, account := range accounts {
+		if account.Name == "" {
+			errs = append(errs, errors.New("every GOV.UK Pay account must have a name"))
+		}
+		if len(account.ClassesOfPayment) == 0 {
+			errs = append(errs, fmt.Errorf("no classes of payment configured for GOV.UK Pay account [%s]", account.Name))
+		}
+		for _, class := range account.ClassesOfPayment {
+			if account.BearerToken == "" {
+				errs = append(errs, fmt.Errorf("no GOV.UK Pay bearer token configured for class of payment [%s]", class))
+			}
+			if other, ok := accountForClass[class]; ok {
+				errs = append(errs, fmt.Errorf("class of payment [%s] is mapped to GOV.UK Pay accounts [%s] and [%s]", class, other, account.Name))
+				continue
+			}
+			accountForClass[class] = account.Name
+		}
+	}
+	return errs
+}
+
+// minimumSigningKeyLength is the shortest redirect signing key accepted, the
+// size of the SHA-256 output it is used with.
+const minimumSigningKeyLength = 32
+
+// validateClients reports clients without an ID, with a missing or short
+// redirect signing key or an invalid redirect allow list, and IDs that are
+// configured more than once.
+func (c *Config) validateClients() []error {
+	if err := c.parseClients(); err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, client := range c.Clients() {
+		if client.ID == "" {
+			errs = append(errs, errors.New("every client in CLIENTS must have an id"))
+			continue
+		}
+		if seen[client.ID] {
+			errs = append(errs, fmt.Errorf("client [%s] is configured more than once", client.ID))
+		}
+		seen[client.ID] = true
+		if len(client.RedirectSigningKey) < minimumSigningKeyLength {
+			errs = append(errs, fmt.Errorf("redirect signing key for client [%s] must be at least %d characters", client.ID, minimumSigningKeyLength))
+		}
+		for _, entry := range client.RedirectAllowList {
+			if err := validateRedirectAllowListEntry(fmt.Sprintf("redirect allow list for client [%s]", client.ID), entry); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// sortCodePattern and accountNumberPattern match UK sort codes, with or
+// without dashes, and account numbers.
+var (
+	sortCodePattern      = regexp.MustCompile(`^[0-9]{2}-?[0-9]{2}-?[0-9]{2}$`)
+	accountNumberPattern = regexp.MustCompile(`^[0-9]{8}$`)
+)
+
+// validateBankTransferAccount reports a bank transfer account without an
+// account name, or with a malformed sort code or account number.
+func (c *Config) validateBankTransferAccount() []error {
+	if err := c.parseBankTransferAccount(); err != nil {
+		return []error{err}
+	}
+	account := c.BankTransferAccount()
+	if account == nil {
+		return nil
+	}
+
+	var errs []error
+	if account.AccountName == "" {
+		errs = append(errs, errors.New("BANK_TRANSFER_ACCOUNT must have an account_name"))
+	}
+	if !sortCodePattern.MatchString(account.SortCode) {
+		errs = append(errs, fmt.Errorf("BANK_TRANSFER_ACCOUNT sort_code must be six digits, got [%s]", account.SortCode))
+	}
+	if !accountNumberPattern.MatchString(account.AccountNumber) {
+		errs = append(errs, fmt.Errorf("BANK_TRANSFER_ACCOUNT account_number must be eight digits, got [%s]", account.AccountNumber))
+	}
+	return errs
+}
+
+// validateExpiryTimes reports expiry times that fall outside the bounds
+// calling services can ask for, so that every session's expiry is within them.
+func (c *Config) validateExpiryTimes() []error {
+	if c.MaxExpiryTimeInMinutes < c.MinExpiryTimeInMinutes {
+		return []error{fmt.Errorf("MAX_EXPIRY_TIME_IN_MINUTES must be at least MIN_EXPIRY_TIME_IN_MINUTES, got [%d]", c.MaxExpiryTimeInMinutes)}
+	}
+	if c.MaxSessionLifetimeInMinutes < c.MaxExpiryTimeInMinutes {
+		return []error{fmt.Errorf("MAX_SESSION_LIFETIME_IN_MINUTES must be at least MAX_EXPIRY_TIME_IN_MINUTES, got [%d]", c.MaxSessionLifetimeInMinutes)}
+	}
+
+	if err := c.parseExpiryTimesByClass(); err != nil {
+		return []error{err}
+	}
+	expiryTimes := c.ExpiryTimesByClass()
+
+	var errs []error
+	if c.ExpiryTimeInMinutes > 0 && !c.WithinExpiryBounds(c.ExpiryTimeInMinutes) {
+		errs = append(errs, fmt.Errorf("EXPIRY_TIME_IN_MINUTES must be between %d and %d, got [%d]", c.MinExpiryTimeInMinutes, c.MaxExpiryTimeInMinutes, c.ExpiryTimeInMinutes))
+	}
+	classes := make([]string, 0, len(expiryTimes))
+	for class := range expiryTimes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		if !c.WithinExpiryBounds(expiryTimes[class]) {
+			errs = append(errs, fmt.Errorf("EXPIRY_TIME_BY_CLASS for class of payment [%s] must be between %d and %d, got [%d]", class, c.MinExpiryTimeInMinutes, c.MaxExpiryTimeInMinutes, expiryTimes[class]))
+		}
+	}
+	return errs
+}
+
+// validateRedirectAllowListEntry checks an allow list entry is an http or
+// https origin, optionally followed by a path prefix.
+func validateRedirectAllowListEntry(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%s entry must be of the form scheme://host/path-prefix, got [%s]", name, value)
+	}
+	return nil
+}
+
+func validateMongoDBURL(value string) error {
+	if value == "" {
+		return errors.New("MONGODB_URL must be set")
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("MONGODB_URL is not a valid URL: [%v]", err)
+	}
+	if u.Scheme != "mongodb" && u.Scheme != "mongodb+srv" {
+		return fmt.Errorf("MONGODB_URL must use the mongodb or mongodb+srv scheme, got [%s]", u.Scheme)
+	}
+	return nil
+}
+
+func validateHTTPURL(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s must be set", name)
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid URL: [%v]", name, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an absolute http or https URL, got [%s]", name, value)
+	}
+	return nil
+}
+
+// validateDomain checks an allow list entry is in the scheme://host form that
+// resource URLs are compared against.
+func validateDomain(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Scheme+"://"+u.Host != value {
+		return fmt.Errorf("DOMAIN_ALLOW_LIST entry must be of the form scheme://host, got [%s]", value)
+	}
+	return nil
+}
+
+func validateBrokerAddr(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return fmt.Errorf("KAFKA_BROKER_ADDR entry must be of the form host:port, got [%s]", value)
+	}
+	if n, err := strconv.Atoi(port); host == "" || err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("KAFKA_BROKER_ADDR entry must be of the form host:port, got [%s]", value)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func validConfig() *Config {
+	c := DefaultConfig()
+	c.BindAddr = ":4089"
+	c.MongoDBURL = "mongodb://localhost:27017"
+	c.DomainAllowList = []string{"http://api.companieshouse.gov.uk", "https://api.companieshouse.gov.uk"}
+	c.PaymentsWebURL = "http://payments.web"
+	c.PaymentsAPIURL = "http://payments.api"
+	c.GovPayURL = "https://publicapi.payments.service.gov.uk/v1/payments"
+	c.GovPayBearerTokenTreasury = "treasury"
+	c.GovPayBearerTokenChAccount = "ch"
+	c.GovPayBearerTokenSanctionsAccount = "sanctions"
+	c.GovPayBearerTokenLegacy = "legacy"
+	c.BrokerAddr = []string{"kafka:9092"}
+	c.SchemaRegistryURL = "http://schema-registry:8081"
+	c.ChsAPIKey = "key"
+	c.SecureAppCostsRegex = "\\/secure-app-costs"
+	c.PaypalEnv = "test"
+	c.PaypalClientID = "id"
+	c.PaypalSecret = "secret"
+	c.RedirectAllowList = []string{"https://www.companieshouse.gov.uk"}
+	return c
+}
+
+func TestUnitValidate(t *testing.T) {
+
+	Convey("Valid config", t, func() {
+		So(validConfig().Validate(), ShouldBeNil)
+	})
+
+	Convey("Default config reports every missing setting at once", t, func() {
+		err := DefaultConfig().Validate()
+		So(err, ShouldNotBeNil)
+		for _, expected := range []string{
+			"BIND_ADDR must be set",
+			"MONGODB_URL must be set",
+			"PAYMENTS_WEB_URL must be set",
+			"DOMAIN_ALLOW_LIST must contain at least one domain",
+			"no GOV.UK Pay bearer token configured for class of payment [penalty-lfp]",
+			"KAFKA_BROKER_ADDR must contain at least one broker",
+			"CHS_API_KEY must be set",
+			"PAYPAL_ENV must be live or test",
+			"REDIRECT_ALLOW_LIST must contain at least one origin",
+		} {
+			So(err.Error(), ShouldContainSubstring, expected)
+		}
+	})
+
+	Convey("Missing bearer token for a single class", t, func() {
+		c := validConfig()
+		c.GovPayBearerTokenSanctionsAccount = ""
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "no GOV.UK Pay bearer token configured for class of payment [penalty-sanctions]")
+	})
+
+	Convey("Invalid URLs", t, func() {
+		c := validConfig()
+		c.MongoDBURL = "http://localhost:27017"
+		c.GovPayURL = "/v1/payments"
+		c.OtelExporterEndpoint = "localhost:4318"
+		c.PaymentsWebErrorURL = "/payments/error"
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "MONGODB_URL must use the mongodb or mongodb+srv scheme")
+		So(err.Error(), ShouldContainSubstring, "GOV_PAY_URL must be an absolute http or https URL")
+		So(err.Error(), ShouldContainSubstring, "OTEL_EXPORTER_OTLP_ENDPOINT must be an absolute http or https URL")
+		So(err.Error(), ShouldContainSubstring, "PAYMENTS_WEB_ERROR_URL must be an absolute http or https URL")
+	})
+
+	Convey("Invalid domain allow list entry", t, func() {
+		c := validConfig()
+		c.DomainAllowList = []string{"http://api.companieshouse.gov.uk/"}
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "DOMAIN_ALLOW_LIST entry must be of the form scheme://host")
+	})
+
+	Convey("Invalid durations", t, func() {
+		c := validConfig()
+		c.ExpiryTimeInMinutes = 0
+		c.WriteTimeoutInSeconds = -1
+		c.DrainDelayInSeconds = -1
+		c.BankTransferExpiryTimeInMinutes = 0
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(strings.Split(err.Error(), "\n"), ShouldHaveLength, 4)
+		So(err.Error(), ShouldContainSubstring, "EXPIRY_TIME_IN_MINUTES must be greater than zero, got [0]")
+		So(err.Error(), ShouldContainSubstring, "WRITE_TIMEOUT_IN_SECONDS must be greater than zero, got [-1]")
+		So(err.Error(), ShouldContainSubstring, "BANK_TRANSFER_EXPIRY_TIME_IN_MINUTES must be greater than zero, got [0]")
+		So(err.Error(), ShouldContainSubstring, "DRAIN_DELAY_IN_SECONDS must not be negative, got [-1]")
+	})
+
+	Convey("Invalid kafka settings", t, func() {
+		c := validConfig()
+		c.BrokerAddr = []string{"kafka", "kafka:port"}
+		c.PaymentProcessedTopic = ""
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(strings.Split(err.Error(), "\n"), ShouldHaveLength, 3)
+		So(err.Error(), ShouldContainSubstring, "KAFKA_BROKER_ADDR entry must be of the form host:port, got [kafka]")
+		So(err.Error(), ShouldContainSubstring, "KAFKA_BROKER_ADDR entry must be of the form host:port, got [kafka:port]")
+		So(err.Error(), ShouldContainSubstring, "PAYMENT_PROCESSED_TOPIC must be set")
+	})
+
+	Convey("Invalid secure app costs regex", t, func() {
+		c := validConfig()
+		c.SecureAppCostsRegex = "("
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "SECURE_APP_COSTS_REGEX is not a valid regular expression")
+	})
+
+	Convey("Invalid clients", t, func() {
+		c := validConfig()
+		c.ClientsJSON = `[
+			{"id":"frontend","redirect_signing_key":"0123456789abcdef0123456789abcdef"},
+			{"id":"frontend","redirect_signing_key":"0123456789abcdef0123456789abcdef"},
+			{"id":"short","redirect_signing_key":"key"},
+			{"redirect_signing_key":"0123456789abcdef0123456789abcdef"}
+		]`
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(strings.Split(err.Error(), "\n"), ShouldHaveLength, 3)
+		So(err.Error(), ShouldContainSubstring, "client [frontend] is configured more than once")
+		So(err.Error(), ShouldContainSubstring, "redirect signing key for client [short] must be at least 32 characters")
+		So(err.Error(), ShouldContainSubstring, "every client in CLIENTS must have an id")
+	})
+
+	Convey("Invalid redirect allow lists", t, func() {
+		c := validConfig()
+		c.RedirectAllowList = []string{"https://www.companieshouse.gov.uk/pay", "www.companieshouse.gov.uk"}
+		c.ClientsJSON = `[{"id":"frontend","redirect_signing_key":"0123456789abcdef0123456789abcdef","redirect_allow_list":["https://frontend/callback?x=y"]}]`
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(strings.Split(err.Error(), "\n"), ShouldHaveLength, 2)
+		So(err.Error(), ShouldContainSubstring, "REDIRECT_ALLOW_LIST entry must be of the form scheme://host/path-prefix, got [www.companieshouse.gov.uk]")
+		So(err.Error(), ShouldContainSubstring, "redirect allow list for client [frontend] entry must be of the form scheme://host/path-prefix, got [https://frontend/callback?x=y]")
+	})
+
+	Convey("Valid bank transfer account", t, func() {
+		c := validConfig()
+		c.BankTransferAccountJSON = `{"account_name":"Companies House","sort_code":"60-70-80","account_number":"10014411"}`
+		So(c.Validate(), ShouldBeNil)
+	})
+
+	Convey("Invalid bank transfer account", t, func() {
+		c := validConfig()
+		c.BankTransferAccountJSON = `{"sort_code":"6070","account_number":"1001441X"}`
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(strings.Split(err.Error(), "\n"), ShouldHaveLength, 3)
+		So(err.Error(), ShouldContainSubstring, "BANK_TRANSFER_ACCOUNT must have an account_name")
+		So(err.Error(), ShouldContainSubstring, "BANK_TRANSFER_ACCOUNT sort_code must be six digits, got [6070]")
+		So(err.Error(), ShouldContainSubstring, "BANK_TRANSFER_ACCOUNT account_number must be eight digits, got [1001441X]")
+	})
+
+	Convey("Valid expiry times by class", t, func() {
+		c := validConfig()
+		c.ExpiryTimeByClassJSON = `{"orderable-item":600,"penalty-lfp":30}`
+		So(c.Validate(), ShouldBeNil)
+	})
+
+	Convey("Expiry times outside the bounds", t, func() {
+		c := validConfig()
+		c.ExpiryTimeInMinutes = 10
+		c.ExpiryTimeByClassJSON = `{"penalty-sanctions":2000,"orderable-item":600,"penalty-lfp":5}`
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(strings.Split(err.Error(), "\n"), ShouldHaveLength, 3)
+		So(err.Error(), ShouldContainSubstring, "EXPIRY_TIME_IN_MINUTES must be between 15 and 1440, got [10]")
+		So(err.Error(), ShouldContainSubstring, "EXPIRY_TIME_BY_CLASS for class of payment [penalty-lfp] must be between 15 and 1440, got [5]")
+		So(err.Error(), ShouldContainSubstring, "EXPIRY_TIME_BY_CLASS for class of payment [penalty-sanctions] must be between 15 and 1440, got [2000]")
+	})
+
+	Convey("Invalid expiry bounds", t, func() {
+		c := validConfig()
+		c.MinExpiryTimeInMinutes = 60
+		c.MaxExpiryTimeInMinutes = 30
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "MAX_EXPIRY_TIME_IN_MINUTES must be at least MIN_EXPIRY_TIME_IN_MINUTES, got [30]")
+	})
+
+	Convey("Session lifetime shorter than the maximum expiry", t, func() {
+		c := validConfig()
+		c.MaxSessionLifetimeInMinutes = 60
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "MAX_SESSION_LIFETIME_IN_MINUTES must be at least MAX_EXPIRY_TIME_IN_MINUTES, got [60]")
+	})
+
+	Convey("Invalid EXPIRY_TIME_BY_CLASS", t, func() {
+		c := validConfig()
+		c.ExpiryTimeByClassJSON = `[600]`
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "error parsing EXPIRY_TIME_BY_CLASS")
+	})
+
+	Convey("Payer link signing key too short", t, func() {
+		c := validConfig()
+		c.PayerLinkSigningKey = "short"
+		err := c.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "PAYER_LINK_SIGNING_KEY must be at least 32 characters")
+	})
+}
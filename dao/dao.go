@@ -1,26 +1,62 @@
 package dao
 
 import (
+	"context"
+	"time"
+
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 )
 
 // DAO is an interface for accessing dao from a backend store
 type DAO interface {
-	CreatePaymentResource(paymentResource *models.PaymentResourceDB) error
-	GetPaymentResource(string) (*models.PaymentResourceDB, error)
-	PatchPaymentResource(id string, paymentUpdate *models.PaymentResourceDB) error
-	GetPaymentResourceByProviderID(providerID string) (*models.PaymentResourceDB, error)
-	GetPaymentResourceByExternalPaymentTransactionID(providerID string) (*models.PaymentResourceDB, error)
-	GetIncompleteGovPayPayments(*config.Config) ([]models.PaymentResourceDB, error)
-	CreateBulkRefundByProviderID(bulkRefunds map[string]models.BulkRefundDB) error
-	CreateBulkRefundByExternalPaymentTransactionID(bulkRefunds map[string]models.BulkRefundDB) error
-	GetPaymentsWithRefundStatus() ([]models.PaymentResourceDB, error)
-	GetPaymentsWithRefundPendingStatus() ([]models.PaymentResourceDB, error)
-	GetPaymentRefunds(string) ([]models.RefundResourceDB, error)
-	PatchRefundSuccessStatus(id string, isPaid bool, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error)
-	PatchRefundStatus(id string, isRefunded bool, isFailed bool, refundStatus string, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error)
-	IncrementRefundAttempts(paymentID string, paymentUpdate *models.PaymentResourceDB) error
+	CreatePaymentResource(ctx context.Context, paymentResource *models.PaymentResourceDB) error
+	GetPaymentResource(ctx context.Context, id string) (*models.PaymentResourceDB, error)
+	PatchPaymentResource(ctx context.Context, id string, paymentUpdate *models.PaymentResourceDB) error
+	CompletePaymentResource(ctx context.Context, id, tokenHash string, paymentUpdate *models.PaymentResourceDB) (bool, error)
+	ConsumeCallbackToken(ctx context.Context, id, tokenHash string) (bool, error)
+	ReopenPaymentResource(ctx context.Context, id string, statuses []string, paymentUpdate *models.PaymentResourceDB) (bool, error)
+	OverridePaymentResource(ctx context.Context, id string, statuses []string, paymentUpdate *models.PaymentResourceDB) (bool, error)
+	RemovePrefilledCardholderDetails(ctx context.Context, id string) error
+	SetPayerLink(ctx context.Context, id string, link *models.PayerLinkDB) error
+	RevokePayerLink(ctx context.Context, id, linkID string, revokedAt time.Time) (bool, error)
+	ExtendPaymentResource(ctx context.Context, id string, statuses []string, expiresAt time.Time) (bool, error)
+	SetExternalPaymentAttemptOutcome(ctx context.Context, id, externalPaymentStatusURI, outcome string) (bool, error)
+	GetPaymentResourceByProviderID(ctx context.Context, providerID string) (*models.PaymentResourceDB, error)
+	GetPaymentResourceByExternalPaymentTransactionID(ctx context.Context, providerID string) (*models.PaymentResourceDB, error)
+	GetPaymentResourcesByResource(ctx context.Context, resource string, statuses []string) ([]models.PaymentResourceDB, error)
+	GetIncompleteGovPayPayments(ctx context.Context, cfg *config.Config) ([]models.PaymentResourceDB, error)
+	GetPaymentResourcesWithMessagesPending(ctx context.Context, pendingBefore time.Time) ([]models.PaymentResourceDB, error)
+	RemoveMessagesPending(ctx context.Context, id string, resources []string) error
+	CreateBulkRefundByProviderID(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB) error
+	CreateBulkRefundByExternalPaymentTransactionID(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB) error
+	GetPaymentsWithRefundStatus(ctx context.Context) ([]models.PaymentResourceDB, error)
+	GetPaymentsWithRefundPendingStatus(ctx context.Context) ([]models.PaymentResourceDB, error)
+	GetPaymentRefunds(ctx context.Context, id string) ([]models.RefundResourceDB, error)
+	PatchRefundSuccessStatus(ctx context.Context, id string, isPaid bool, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error)
+	PatchRefundStatus(ctx context.Context, id string, isRefunded bool, isFailed bool, refundStatus string, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error)
+	IncrementRefundAttempts(ctx context.Context, paymentID string, paymentUpdate *models.PaymentResourceDB) error
+	CreatePaymentRequest(ctx context.Context, paymentRequest *models.PaymentRequestDB) error
+	GetPaymentRequest(ctx context.Context, id string) (*models.PaymentRequestDB, error)
+	CreateAccount(ctx context.Context, account *models.AccountDB) error
+	GetAccount(ctx context.Context, id string) (*models.AccountDB, error)
+	GetAccountByUserIDs(ctx context.Context, userIDs []string) (*models.AccountDB, error)
+	UpdateAccountStatus(ctx context.Context, id, status string) (bool, error)
+	DebitAccount(ctx context.Context, entry *models.AccountLedgerEntryDB, status string) (bool, error)
+	CreditAccount(ctx context.Context, entry *models.AccountLedgerEntryDB) (bool, error)
+	GetAccountLedgerEntry(ctx context.Context, id string) (*models.AccountLedgerEntryDB, error)
+	GetAccountLedgerEntries(ctx context.Context, accountID string, from, to time.Time) ([]models.AccountLedgerEntryDB, error)
+	GetAccountLedgerEntriesForPayment(ctx context.Context, paymentID string) ([]models.AccountLedgerEntryDB, error)
+	AddAccountLedgerEntryRefund(ctx context.Context, debit *models.AccountLedgerEntryDB, amount int) (bool, error)
+	SettleAccountLedgerEntry(ctx context.Context, id string) error
+	GetPendingAccountLedgerEntries(ctx context.Context, createdBefore time.Time) ([]models.AccountLedgerEntryDB, error)
+	GetPaymentResourceByRemittanceReference(ctx context.Context, reference string) (*models.PaymentResourceDB, error)
+	ReconcileBankTransfer(ctx context.Context, id, etag string, paymentUpdate *models.PaymentResourceDB) (bool, error)
+	CreateBankCredit(ctx context.Context, credit *models.BankCreditDB) (bool, error)
+	UpdateBankCredit(ctx context.Context, credit *models.BankCreditDB) error
+	GetBankCredits(ctx context.Context, outcomes []string, from, to time.Time) ([]models.BankCreditDB, error)
+	ClaimResource(ctx context.Context, resource, paymentID string, expiresAt time.Time) (bool, error)
+	ReleaseResource(ctx context.Context, resource, paymentID string) error
 }
 
 // NewDAO will create a new instance of the DAO interface.
@@ -30,8 +66,13 @@ func NewDAO(cfg *config.Config) DAO {
 	database := getMongoDatabase(cfg.MongoDBURL, cfg.Database)
 
 	return &MongoService{
-		db:              database,
-		CollectionName:  cfg.Collection,
-		RefundBatchSize: cfg.RefundBatchSize,
+		db:                            database,
+		CollectionName:                cfg.Collection,
+		PaymentRequestsCollectionName: cfg.PaymentRequestsCollection,
+		AccountsCollectionName:        cfg.AccountsCollection,
+		AccountLedgerCollectionName:   cfg.AccountLedgerCollection,
+		BankCreditsCollectionName:     cfg.BankCreditsCollection,
+		ResourceClaimsCollectionName:  cfg.ResourceClaimsCollection,
+		RefundBatchSize:               cfg.RefundBatchSize,
 	}
 }
@@ -4,7 +4,9 @@
 package dao
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	config "github.com/companieshouse/payments.api.ch.gov.uk/config"
 	models "github.com/companieshouse/payments.api.ch.gov.uk/models"
@@ -34,207 +36,694 @@ func (m *MockDAO) EXPECT() *MockDAOMockRecorder {
 	return m.recorder
 }
 
+// AddAccountLedgerEntryRefund mocks base method.
+func (m *MockDAO) AddAccountLedgerEntryRefund(ctx context.Context, debit *models.AccountLedgerEntryDB, amount int) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAccountLedgerEntryRefund", ctx, debit, amount)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddAccountLedgerEntryRefund indicates an expected call of AddAccountLedgerEntryRefund.
+func (mr *MockDAOMockRecorder) AddAccountLedgerEntryRefund(ctx, debit, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAccountLedgerEntryRefund", reflect.TypeOf((*MockDAO)(nil).AddAccountLedgerEntryRefund), ctx, debit, amount)
+}
+
+// ClaimResource mocks base method.
+func (m *MockDAO) ClaimResource(ctx context.Context, resource, paymentID string, expiresAt time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimResource", ctx, resource, paymentID, expiresAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimResource indicates an expected call of ClaimResource.
+func (mr *MockDAOMockRecorder) ClaimResource(ctx, resource, paymentID, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimResource", reflect.TypeOf((*MockDAO)(nil).ClaimResource), ctx, resource, paymentID, expiresAt)
+}
+
+// CompletePaymentResource mocks base method.
+func (m *MockDAO) CompletePaymentResource(ctx context.Context, id, tokenHash string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompletePaymentResource", ctx, id, tokenHash, paymentUpdate)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompletePaymentResource indicates an expected call of CompletePaymentResource.
+func (mr *MockDAOMockRecorder) CompletePaymentResource(ctx, id, tokenHash, paymentUpdate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompletePaymentResource", reflect.TypeOf((*MockDAO)(nil).CompletePaymentResource), ctx, id, tokenHash, paymentUpdate)
+}
+
+// ConsumeCallbackToken mocks base method.
+func (m *MockDAO) ConsumeCallbackToken(ctx context.Context, id, tokenHash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeCallbackToken", ctx, id, tokenHash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeCallbackToken indicates an expected call of ConsumeCallbackToken.
+func (mr *MockDAOMockRecorder) ConsumeCallbackToken(ctx, id, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeCallbackToken", reflect.TypeOf((*MockDAO)(nil).ConsumeCallbackToken), ctx, id, tokenHash)
+}
+
+// CreateAccount mocks base method.
+func (m *MockDAO) CreateAccount(ctx context.Context, account *models.AccountDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAccount", ctx, account)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAccount indicates an expected call of CreateAccount.
+func (mr *MockDAOMockRecorder) CreateAccount(ctx, account interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccount", reflect.TypeOf((*MockDAO)(nil).CreateAccount), ctx, account)
+}
+
+// CreateBankCredit mocks base method.
+func (m *MockDAO) CreateBankCredit(ctx context.Context, credit *models.BankCreditDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBankCredit", ctx, credit)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateBankCredit indicates an expected call of CreateBankCredit.
+func (mr *MockDAOMockRecorder) CreateBankCredit(ctx, credit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBankCredit", reflect.TypeOf((*MockDAO)(nil).CreateBankCredit), ctx, credit)
+}
+
 // CreateBulkRefundByExternalPaymentTransactionID mocks base method.
-func (m *MockDAO) CreateBulkRefundByExternalPaymentTransactionID(bulkRefunds map[string]models.BulkRefundDB) error {
+func (m *MockDAO) CreateBulkRefundByExternalPaymentTransactionID(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBulkRefundByExternalPaymentTransactionID", bulkRefunds)
+	ret := m.ctrl.Call(m, "CreateBulkRefundByExternalPaymentTransactionID", ctx, bulkRefunds)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateBulkRefundByExternalPaymentTransactionID indicates an expected call of CreateBulkRefundByExternalPaymentTransactionID.
-func (mr *MockDAOMockRecorder) CreateBulkRefundByExternalPaymentTransactionID(bulkRefunds interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) CreateBulkRefundByExternalPaymentTransactionID(ctx, bulkRefunds interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBulkRefundByExternalPaymentTransactionID", reflect.TypeOf((*MockDAO)(nil).CreateBulkRefundByExternalPaymentTransactionID), bulkRefunds)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBulkRefundByExternalPaymentTransactionID", reflect.TypeOf((*MockDAO)(nil).CreateBulkRefundByExternalPaymentTransactionID), ctx, bulkRefunds)
 }
 
 // CreateBulkRefundByProviderID mocks base method.
-func (m *MockDAO) CreateBulkRefundByProviderID(bulkRefunds map[string]models.BulkRefundDB) error {
+func (m *MockDAO) CreateBulkRefundByProviderID(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateBulkRefundByProviderID", bulkRefunds)
+	ret := m.ctrl.Call(m, "CreateBulkRefundByProviderID", ctx, bulkRefunds)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateBulkRefundByProviderID indicates an expected call of CreateBulkRefundByProviderID.
-func (mr *MockDAOMockRecorder) CreateBulkRefundByProviderID(bulkRefunds interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) CreateBulkRefundByProviderID(ctx, bulkRefunds interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBulkRefundByProviderID", reflect.TypeOf((*MockDAO)(nil).CreateBulkRefundByProviderID), bulkRefunds)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBulkRefundByProviderID", reflect.TypeOf((*MockDAO)(nil).CreateBulkRefundByProviderID), ctx, bulkRefunds)
+}
+
+// CreatePaymentRequest mocks base method.
+func (m *MockDAO) CreatePaymentRequest(ctx context.Context, paymentRequest *models.PaymentRequestDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePaymentRequest", ctx, paymentRequest)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePaymentRequest indicates an expected call of CreatePaymentRequest.
+func (mr *MockDAOMockRecorder) CreatePaymentRequest(ctx, paymentRequest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePaymentRequest", reflect.TypeOf((*MockDAO)(nil).CreatePaymentRequest), ctx, paymentRequest)
 }
 
 // CreatePaymentResource mocks base method.
-func (m *MockDAO) CreatePaymentResource(paymentResource *models.PaymentResourceDB) error {
+func (m *MockDAO) CreatePaymentResource(ctx context.Context, paymentResource *models.PaymentResourceDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreatePaymentResource", paymentResource)
+	ret := m.ctrl.Call(m, "CreatePaymentResource", ctx, paymentResource)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreatePaymentResource indicates an expected call of CreatePaymentResource.
-func (mr *MockDAOMockRecorder) CreatePaymentResource(paymentResource interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) CreatePaymentResource(ctx, paymentResource interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePaymentResource", reflect.TypeOf((*MockDAO)(nil).CreatePaymentResource), ctx, paymentResource)
+}
+
+// CreditAccount mocks base method.
+func (m *MockDAO) CreditAccount(ctx context.Context, entry *models.AccountLedgerEntryDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreditAccount", ctx, entry)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreditAccount indicates an expected call of CreditAccount.
+func (mr *MockDAOMockRecorder) CreditAccount(ctx, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreditAccount", reflect.TypeOf((*MockDAO)(nil).CreditAccount), ctx, entry)
+}
+
+// DebitAccount mocks base method.
+func (m *MockDAO) DebitAccount(ctx context.Context, entry *models.AccountLedgerEntryDB, status string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DebitAccount", ctx, entry, status)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DebitAccount indicates an expected call of DebitAccount.
+func (mr *MockDAOMockRecorder) DebitAccount(ctx, entry, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DebitAccount", reflect.TypeOf((*MockDAO)(nil).DebitAccount), ctx, entry, status)
+}
+
+// ExtendPaymentResource mocks base method.
+func (m *MockDAO) ExtendPaymentResource(ctx context.Context, id string, statuses []string, expiresAt time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendPaymentResource", ctx, id, statuses, expiresAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtendPaymentResource indicates an expected call of ExtendPaymentResource.
+func (mr *MockDAOMockRecorder) ExtendPaymentResource(ctx, id, statuses, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendPaymentResource", reflect.TypeOf((*MockDAO)(nil).ExtendPaymentResource), ctx, id, statuses, expiresAt)
+}
+
+// GetAccount mocks base method.
+func (m *MockDAO) GetAccount(ctx context.Context, id string) (*models.AccountDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccount", ctx, id)
+	ret0, _ := ret[0].(*models.AccountDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccount indicates an expected call of GetAccount.
+func (mr *MockDAOMockRecorder) GetAccount(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePaymentResource", reflect.TypeOf((*MockDAO)(nil).CreatePaymentResource), paymentResource)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockDAO)(nil).GetAccount), ctx, id)
+}
+
+// GetAccountByUserIDs mocks base method.
+func (m *MockDAO) GetAccountByUserIDs(ctx context.Context, userIDs []string) (*models.AccountDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountByUserIDs", ctx, userIDs)
+	ret0, _ := ret[0].(*models.AccountDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccountByUserIDs indicates an expected call of GetAccountByUserIDs.
+func (mr *MockDAOMockRecorder) GetAccountByUserIDs(ctx, userIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountByUserIDs", reflect.TypeOf((*MockDAO)(nil).GetAccountByUserIDs), ctx, userIDs)
+}
+
+// GetAccountLedgerEntries mocks base method.
+func (m *MockDAO) GetAccountLedgerEntries(ctx context.Context, accountID string, from, to time.Time) ([]models.AccountLedgerEntryDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountLedgerEntries", ctx, accountID, from, to)
+	ret0, _ := ret[0].([]models.AccountLedgerEntryDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccountLedgerEntries indicates an expected call of GetAccountLedgerEntries.
+func (mr *MockDAOMockRecorder) GetAccountLedgerEntries(ctx, accountID, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountLedgerEntries", reflect.TypeOf((*MockDAO)(nil).GetAccountLedgerEntries), ctx, accountID, from, to)
+}
+
+// GetAccountLedgerEntriesForPayment mocks base method.
+func (m *MockDAO) GetAccountLedgerEntriesForPayment(ctx context.Context, paymentID string) ([]models.AccountLedgerEntryDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountLedgerEntriesForPayment", ctx, paymentID)
+	ret0, _ := ret[0].([]models.AccountLedgerEntryDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccountLedgerEntriesForPayment indicates an expected call of GetAccountLedgerEntriesForPayment.
+func (mr *MockDAOMockRecorder) GetAccountLedgerEntriesForPayment(ctx, paymentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountLedgerEntriesForPayment", reflect.TypeOf((*MockDAO)(nil).GetAccountLedgerEntriesForPayment), ctx, paymentID)
+}
+
+// GetAccountLedgerEntry mocks base method.
+func (m *MockDAO) GetAccountLedgerEntry(ctx context.Context, id string) (*models.AccountLedgerEntryDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccountLedgerEntry", ctx, id)
+	ret0, _ := ret[0].(*models.AccountLedgerEntryDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccountLedgerEntry indicates an expected call of GetAccountLedgerEntry.
+func (mr *MockDAOMockRecorder) GetAccountLedgerEntry(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccountLedgerEntry", reflect.TypeOf((*MockDAO)(nil).GetAccountLedgerEntry), ctx, id)
+}
+
+// GetBankCredits mocks base method.
+func (m *MockDAO) GetBankCredits(ctx context.Context, outcomes []string, from, to time.Time) ([]models.BankCreditDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBankCredits", ctx, outcomes, from, to)
+	ret0, _ := ret[0].([]models.BankCreditDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBankCredits indicates an expected call of GetBankCredits.
+func (mr *MockDAOMockRecorder) GetBankCredits(ctx, outcomes, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBankCredits", reflect.TypeOf((*MockDAO)(nil).GetBankCredits), ctx, outcomes, from, to)
 }
 
 // GetIncompleteGovPayPayments mocks base method.
-func (m *MockDAO) GetIncompleteGovPayPayments(arg0 *config.Config) ([]models.PaymentResourceDB, error) {
+func (m *MockDAO) GetIncompleteGovPayPayments(ctx context.Context, cfg *config.Config) ([]models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetIncompleteGovPayPayments", arg0)
+	ret := m.ctrl.Call(m, "GetIncompleteGovPayPayments", ctx, cfg)
 	ret0, _ := ret[0].([]models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetIncompleteGovPayPayments indicates an expected call of GetIncompleteGovPayPayments.
-func (mr *MockDAOMockRecorder) GetIncompleteGovPayPayments(arg0 interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) GetIncompleteGovPayPayments(ctx, cfg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIncompleteGovPayPayments", reflect.TypeOf((*MockDAO)(nil).GetIncompleteGovPayPayments), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIncompleteGovPayPayments", reflect.TypeOf((*MockDAO)(nil).GetIncompleteGovPayPayments), ctx, cfg)
 }
 
 // GetPaymentRefunds mocks base method.
-func (m *MockDAO) GetPaymentRefunds(arg0 string) ([]models.RefundResourceDB, error) {
+func (m *MockDAO) GetPaymentRefunds(ctx context.Context, id string) ([]models.RefundResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentRefunds", arg0)
+	ret := m.ctrl.Call(m, "GetPaymentRefunds", ctx, id)
 	ret0, _ := ret[0].([]models.RefundResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPaymentRefunds indicates an expected call of GetPaymentRefunds.
-func (mr *MockDAOMockRecorder) GetPaymentRefunds(arg0 interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) GetPaymentRefunds(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentRefunds", reflect.TypeOf((*MockDAO)(nil).GetPaymentRefunds), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentRefunds", reflect.TypeOf((*MockDAO)(nil).GetPaymentRefunds), ctx, id)
+}
+
+// GetPaymentRequest mocks base method.
+func (m *MockDAO) GetPaymentRequest(ctx context.Context, id string) (*models.PaymentRequestDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPaymentRequest", ctx, id)
+	ret0, _ := ret[0].(*models.PaymentRequestDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPaymentRequest indicates an expected call of GetPaymentRequest.
+func (mr *MockDAOMockRecorder) GetPaymentRequest(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentRequest", reflect.TypeOf((*MockDAO)(nil).GetPaymentRequest), ctx, id)
 }
 
 // GetPaymentResource mocks base method.
-func (m *MockDAO) GetPaymentResource(arg0 string) (*models.PaymentResourceDB, error) {
+func (m *MockDAO) GetPaymentResource(ctx context.Context, id string) (*models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentResource", arg0)
+	ret := m.ctrl.Call(m, "GetPaymentResource", ctx, id)
 	ret0, _ := ret[0].(*models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPaymentResource indicates an expected call of GetPaymentResource.
-func (mr *MockDAOMockRecorder) GetPaymentResource(arg0 interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) GetPaymentResource(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResource", reflect.TypeOf((*MockDAO)(nil).GetPaymentResource), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResource", reflect.TypeOf((*MockDAO)(nil).GetPaymentResource), ctx, id)
 }
 
 // GetPaymentResourceByExternalPaymentTransactionID mocks base method.
-func (m *MockDAO) GetPaymentResourceByExternalPaymentTransactionID(providerID string) (*models.PaymentResourceDB, error) {
+func (m *MockDAO) GetPaymentResourceByExternalPaymentTransactionID(ctx context.Context, providerID string) (*models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentResourceByExternalPaymentTransactionID", providerID)
+	ret := m.ctrl.Call(m, "GetPaymentResourceByExternalPaymentTransactionID", ctx, providerID)
 	ret0, _ := ret[0].(*models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPaymentResourceByExternalPaymentTransactionID indicates an expected call of GetPaymentResourceByExternalPaymentTransactionID.
-func (mr *MockDAOMockRecorder) GetPaymentResourceByExternalPaymentTransactionID(providerID interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) GetPaymentResourceByExternalPaymentTransactionID(ctx, providerID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourceByExternalPaymentTransactionID", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourceByExternalPaymentTransactionID), providerID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourceByExternalPaymentTransactionID", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourceByExternalPaymentTransactionID), ctx, providerID)
 }
 
 // GetPaymentResourceByProviderID mocks base method.
-func (m *MockDAO) GetPaymentResourceByProviderID(providerID string) (*models.PaymentResourceDB, error) {
+func (m *MockDAO) GetPaymentResourceByProviderID(ctx context.Context, providerID string) (*models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentResourceByProviderID", providerID)
+	ret := m.ctrl.Call(m, "GetPaymentResourceByProviderID", ctx, providerID)
 	ret0, _ := ret[0].(*models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPaymentResourceByProviderID indicates an expected call of GetPaymentResourceByProviderID.
-func (mr *MockDAOMockRecorder) GetPaymentResourceByProviderID(providerID interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) GetPaymentResourceByProviderID(ctx, providerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourceByProviderID", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourceByProviderID), ctx, providerID)
+}
+
+// GetPaymentResourceByRemittanceReference mocks base method.
+func (m *MockDAO) GetPaymentResourceByRemittanceReference(ctx context.Context, reference string) (*models.PaymentResourceDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPaymentResourceByRemittanceReference", ctx, reference)
+	ret0, _ := ret[0].(*models.PaymentResourceDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPaymentResourceByRemittanceReference indicates an expected call of GetPaymentResourceByRemittanceReference.
+func (mr *MockDAOMockRecorder) GetPaymentResourceByRemittanceReference(ctx, reference interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourceByRemittanceReference", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourceByRemittanceReference), ctx, reference)
+}
+
+// GetPaymentResourcesByResource mocks base method.
+func (m *MockDAO) GetPaymentResourcesByResource(ctx context.Context, resource string, statuses []string) ([]models.PaymentResourceDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPaymentResourcesByResource", ctx, resource, statuses)
+	ret0, _ := ret[0].([]models.PaymentResourceDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPaymentResourcesByResource indicates an expected call of GetPaymentResourcesByResource.
+func (mr *MockDAOMockRecorder) GetPaymentResourcesByResource(ctx, resource, statuses interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourceByProviderID", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourceByProviderID), providerID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourcesByResource", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourcesByResource), ctx, resource, statuses)
+}
+
+// GetPaymentResourcesWithMessagesPending mocks base method.
+func (m *MockDAO) GetPaymentResourcesWithMessagesPending(ctx context.Context, pendingBefore time.Time) ([]models.PaymentResourceDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPaymentResourcesWithMessagesPending", ctx, pendingBefore)
+	ret0, _ := ret[0].([]models.PaymentResourceDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPaymentResourcesWithMessagesPending indicates an expected call of GetPaymentResourcesWithMessagesPending.
+func (mr *MockDAOMockRecorder) GetPaymentResourcesWithMessagesPending(ctx, pendingBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentResourcesWithMessagesPending", reflect.TypeOf((*MockDAO)(nil).GetPaymentResourcesWithMessagesPending), ctx, pendingBefore)
 }
 
 // GetPaymentsWithRefundPendingStatus mocks base method.
-func (m *MockDAO) GetPaymentsWithRefundPendingStatus() ([]models.PaymentResourceDB, error) {
+func (m *MockDAO) GetPaymentsWithRefundPendingStatus(ctx context.Context) ([]models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentsWithRefundPendingStatus")
+	ret := m.ctrl.Call(m, "GetPaymentsWithRefundPendingStatus", ctx)
 	ret0, _ := ret[0].([]models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPaymentsWithRefundPendingStatus indicates an expected call of GetPaymentsWithRefundPendingStatus.
-func (mr *MockDAOMockRecorder) GetPaymentsWithRefundPendingStatus() *gomock.Call {
+func (mr *MockDAOMockRecorder) GetPaymentsWithRefundPendingStatus(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentsWithRefundPendingStatus", reflect.TypeOf((*MockDAO)(nil).GetPaymentsWithRefundPendingStatus))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentsWithRefundPendingStatus", reflect.TypeOf((*MockDAO)(nil).GetPaymentsWithRefundPendingStatus), ctx)
 }
 
 // GetPaymentsWithRefundStatus mocks base method.
-func (m *MockDAO) GetPaymentsWithRefundStatus() ([]models.PaymentResourceDB, error) {
+func (m *MockDAO) GetPaymentsWithRefundStatus(ctx context.Context) ([]models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentsWithRefundStatus")
+	ret := m.ctrl.Call(m, "GetPaymentsWithRefundStatus", ctx)
 	ret0, _ := ret[0].([]models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPaymentsWithRefundStatus indicates an expected call of GetPaymentsWithRefundStatus.
-func (mr *MockDAOMockRecorder) GetPaymentsWithRefundStatus() *gomock.Call {
+func (mr *MockDAOMockRecorder) GetPaymentsWithRefundStatus(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentsWithRefundStatus", reflect.TypeOf((*MockDAO)(nil).GetPaymentsWithRefundStatus))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentsWithRefundStatus", reflect.TypeOf((*MockDAO)(nil).GetPaymentsWithRefundStatus), ctx)
+}
+
+// GetPendingAccountLedgerEntries mocks base method.
+func (m *MockDAO) GetPendingAccountLedgerEntries(ctx context.Context, createdBefore time.Time) ([]models.AccountLedgerEntryDB, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingAccountLedgerEntries", ctx, createdBefore)
+	ret0, _ := ret[0].([]models.AccountLedgerEntryDB)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPendingAccountLedgerEntries indicates an expected call of GetPendingAccountLedgerEntries.
+func (mr *MockDAOMockRecorder) GetPendingAccountLedgerEntries(ctx, createdBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingAccountLedgerEntries", reflect.TypeOf((*MockDAO)(nil).GetPendingAccountLedgerEntries), ctx, createdBefore)
 }
 
 // IncrementRefundAttempts mocks base method.
-func (m *MockDAO) IncrementRefundAttempts(paymentID string, paymentUpdate *models.PaymentResourceDB) error {
+func (m *MockDAO) IncrementRefundAttempts(ctx context.Context, paymentID string, paymentUpdate *models.PaymentResourceDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IncrementRefundAttempts", paymentID, paymentUpdate)
+	ret := m.ctrl.Call(m, "IncrementRefundAttempts", ctx, paymentID, paymentUpdate)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // IncrementRefundAttempts indicates an expected call of IncrementRefundAttempts.
-func (mr *MockDAOMockRecorder) IncrementRefundAttempts(paymentID, paymentUpdate interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) IncrementRefundAttempts(ctx, paymentID, paymentUpdate interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementRefundAttempts", reflect.TypeOf((*MockDAO)(nil).IncrementRefundAttempts), paymentID, paymentUpdate)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementRefundAttempts", reflect.TypeOf((*MockDAO)(nil).IncrementRefundAttempts), ctx, paymentID, paymentUpdate)
+}
+
+// OverridePaymentResource mocks base method.
+func (m *MockDAO) OverridePaymentResource(ctx context.Context, id string, statuses []string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OverridePaymentResource", ctx, id, statuses, paymentUpdate)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OverridePaymentResource indicates an expected call of OverridePaymentResource.
+func (mr *MockDAOMockRecorder) OverridePaymentResource(ctx, id, statuses, paymentUpdate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OverridePaymentResource", reflect.TypeOf((*MockDAO)(nil).OverridePaymentResource), ctx, id, statuses, paymentUpdate)
 }
 
 // PatchPaymentResource mocks base method.
-func (m *MockDAO) PatchPaymentResource(id string, paymentUpdate *models.PaymentResourceDB) error {
+func (m *MockDAO) PatchPaymentResource(ctx context.Context, id string, paymentUpdate *models.PaymentResourceDB) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PatchPaymentResource", id, paymentUpdate)
+	ret := m.ctrl.Call(m, "PatchPaymentResource", ctx, id, paymentUpdate)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // PatchPaymentResource indicates an expected call of PatchPaymentResource.
-func (mr *MockDAOMockRecorder) PatchPaymentResource(id, paymentUpdate interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) PatchPaymentResource(ctx, id, paymentUpdate interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchPaymentResource", reflect.TypeOf((*MockDAO)(nil).PatchPaymentResource), id, paymentUpdate)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchPaymentResource", reflect.TypeOf((*MockDAO)(nil).PatchPaymentResource), ctx, id, paymentUpdate)
 }
 
 // PatchRefundStatus mocks base method.
-func (m *MockDAO) PatchRefundStatus(id string, isRefunded, isFailed bool, refundStatus string, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
+func (m *MockDAO) PatchRefundStatus(ctx context.Context, id string, isRefunded, isFailed bool, refundStatus string, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PatchRefundStatus", id, isRefunded, isFailed, refundStatus, paymentUpdate)
+	ret := m.ctrl.Call(m, "PatchRefundStatus", ctx, id, isRefunded, isFailed, refundStatus, paymentUpdate)
 	ret0, _ := ret[0].(models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // PatchRefundStatus indicates an expected call of PatchRefundStatus.
-func (mr *MockDAOMockRecorder) PatchRefundStatus(id, isRefunded, isFailed, refundStatus, paymentUpdate interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) PatchRefundStatus(ctx, id, isRefunded, isFailed, refundStatus, paymentUpdate interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchRefundStatus", reflect.TypeOf((*MockDAO)(nil).PatchRefundStatus), id, isRefunded, isFailed, refundStatus, paymentUpdate)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchRefundStatus", reflect.TypeOf((*MockDAO)(nil).PatchRefundStatus), ctx, id, isRefunded, isFailed, refundStatus, paymentUpdate)
 }
 
 // PatchRefundSuccessStatus mocks base method.
-func (m *MockDAO) PatchRefundSuccessStatus(id string, isPaid bool, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
+func (m *MockDAO) PatchRefundSuccessStatus(ctx context.Context, id string, isPaid bool, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "PatchRefundSuccessStatus", id, isPaid, paymentUpdate)
+	ret := m.ctrl.Call(m, "PatchRefundSuccessStatus", ctx, id, isPaid, paymentUpdate)
 	ret0, _ := ret[0].(models.PaymentResourceDB)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // PatchRefundSuccessStatus indicates an expected call of PatchRefundSuccessStatus.
-func (mr *MockDAOMockRecorder) PatchRefundSuccessStatus(id, isPaid, paymentUpdate interface{}) *gomock.Call {
+func (mr *MockDAOMockRecorder) PatchRefundSuccessStatus(ctx, id, isPaid, paymentUpdate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchRefundSuccessStatus", reflect.TypeOf((*MockDAO)(nil).PatchRefundSuccessStatus), ctx, id, isPaid, paymentUpdate)
+}
+
+// ReconcileBankTransfer mocks base method.
+func (m *MockDAO) ReconcileBankTransfer(ctx context.Context, id, etag string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileBankTransfer", ctx, id, etag, paymentUpdate)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileBankTransfer indicates an expected call of ReconcileBankTransfer.
+func (mr *MockDAOMockRecorder) ReconcileBankTransfer(ctx, id, etag, paymentUpdate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileBankTransfer", reflect.TypeOf((*MockDAO)(nil).ReconcileBankTransfer), ctx, id, etag, paymentUpdate)
+}
+
+// ReleaseResource mocks base method.
+func (m *MockDAO) ReleaseResource(ctx context.Context, resource, paymentID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseResource", ctx, resource, paymentID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseResource indicates an expected call of ReleaseResource.
+func (mr *MockDAOMockRecorder) ReleaseResource(ctx, resource, paymentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseResource", reflect.TypeOf((*MockDAO)(nil).ReleaseResource), ctx, resource, paymentID)
+}
+
+// RemoveMessagesPending mocks base method.
+func (m *MockDAO) RemoveMessagesPending(ctx context.Context, id string, resources []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMessagesPending", ctx, id, resources)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMessagesPending indicates an expected call of RemoveMessagesPending.
+func (mr *MockDAOMockRecorder) RemoveMessagesPending(ctx, id, resources interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMessagesPending", reflect.TypeOf((*MockDAO)(nil).RemoveMessagesPending), ctx, id, resources)
+}
+
+// RemovePrefilledCardholderDetails mocks base method.
+func (m *MockDAO) RemovePrefilledCardholderDetails(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemovePrefilledCardholderDetails", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemovePrefilledCardholderDetails indicates an expected call of RemovePrefilledCardholderDetails.
+func (mr *MockDAOMockRecorder) RemovePrefilledCardholderDetails(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemovePrefilledCardholderDetails", reflect.TypeOf((*MockDAO)(nil).RemovePrefilledCardholderDetails), ctx, id)
+}
+
+// ReopenPaymentResource mocks base method.
+func (m *MockDAO) ReopenPaymentResource(ctx context.Context, id string, statuses []string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReopenPaymentResource", ctx, id, statuses, paymentUpdate)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReopenPaymentResource indicates an expected call of ReopenPaymentResource.
+func (mr *MockDAOMockRecorder) ReopenPaymentResource(ctx, id, statuses, paymentUpdate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReopenPaymentResource", reflect.TypeOf((*MockDAO)(nil).ReopenPaymentResource), ctx, id, statuses, paymentUpdate)
+}
+
+// RevokePayerLink mocks base method.
+func (m *MockDAO) RevokePayerLink(ctx context.Context, id, linkID string, revokedAt time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokePayerLink", ctx, id, linkID, revokedAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokePayerLink indicates an expected call of RevokePayerLink.
+func (mr *MockDAOMockRecorder) RevokePayerLink(ctx, id, linkID, revokedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokePayerLink", reflect.TypeOf((*MockDAO)(nil).RevokePayerLink), ctx, id, linkID, revokedAt)
+}
+
+// SetExternalPaymentAttemptOutcome mocks base method.
+func (m *MockDAO) SetExternalPaymentAttemptOutcome(ctx context.Context, id, externalPaymentStatusURI, outcome string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetExternalPaymentAttemptOutcome", ctx, id, externalPaymentStatusURI, outcome)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetExternalPaymentAttemptOutcome indicates an expected call of SetExternalPaymentAttemptOutcome.
+func (mr *MockDAOMockRecorder) SetExternalPaymentAttemptOutcome(ctx, id, externalPaymentStatusURI, outcome interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExternalPaymentAttemptOutcome", reflect.TypeOf((*MockDAO)(nil).SetExternalPaymentAttemptOutcome), ctx, id, externalPaymentStatusURI, outcome)
+}
+
+// SetPayerLink mocks base method.
+func (m *MockDAO) SetPayerLink(ctx context.Context, id string, link *models.PayerLinkDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPayerLink", ctx, id, link)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPayerLink indicates an expected call of SetPayerLink.
+func (mr *MockDAOMockRecorder) SetPayerLink(ctx, id, link interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPayerLink", reflect.TypeOf((*MockDAO)(nil).SetPayerLink), ctx, id, link)
+}
+
+// SettleAccountLedgerEntry mocks base method.
+func (m *MockDAO) SettleAccountLedgerEntry(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SettleAccountLedgerEntry", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SettleAccountLedgerEntry indicates an expected call of SettleAccountLedgerEntry.
+func (mr *MockDAOMockRecorder) SettleAccountLedgerEntry(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SettleAccountLedgerEntry", reflect.TypeOf((*MockDAO)(nil).SettleAccountLedgerEntry), ctx, id)
+}
+
+// UpdateAccountStatus mocks base method.
+func (m *MockDAO) UpdateAccountStatus(ctx context.Context, id, status string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateAccountStatus", ctx, id, status)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateAccountStatus indicates an expected call of UpdateAccountStatus.
+func (mr *MockDAOMockRecorder) UpdateAccountStatus(ctx, id, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateAccountStatus", reflect.TypeOf((*MockDAO)(nil).UpdateAccountStatus), ctx, id, status)
+}
+
+// UpdateBankCredit mocks base method.
+func (m *MockDAO) UpdateBankCredit(ctx context.Context, credit *models.BankCreditDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBankCredit", ctx, credit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBankCredit indicates an expected call of UpdateBankCredit.
+func (mr *MockDAOMockRecorder) UpdateBankCredit(ctx, credit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchRefundSuccessStatus", reflect.TypeOf((*MockDAO)(nil).PatchRefundSuccessStatus), id, isPaid, paymentUpdate)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBankCredit", reflect.TypeOf((*MockDAO)(nil).UpdateBankCredit), ctx, credit)
 }
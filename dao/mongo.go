@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -17,6 +19,10 @@ import (
 
 const deadline = 5 * time.Second
 
+// maxCreateAttempts is the number of times creating a payment resource is attempted before a duplicate ID is returned
+// as an error
+const maxCreateAttempts = 5
+
 var client *mongo.Client
 
 const (
@@ -25,13 +31,45 @@ const (
 	bulkRefundStatus             = "bulk_refunds.status"
 	dataProviderID               = "data.provider_id"
 	externalPaymentTransactionID = "external_payment_transaction_id"
+	callbackTokenHash            = "callback_token_hash"
+	prefilledCardholderDetails   = "prefilled_cardholder_details"
+	dataLinksResource            = "data.links.resource"
+	dataLinksResources           = "data.links.resources"
+	externalPaymentAttempts      = "external_payment_attempts"
+	messagesPending              = "messages_pending"
+	messagesPendingAt            = "messages_pending_at"
+	paymentHistory               = "history"
+	accountStatus                = "status"
+	accountBalance               = "balance"
+	accountUserIDs               = "user_ids"
+	ledgerAccountID              = "account_id"
+	ledgerCreatedAt              = "created_at"
+	ledgerPaymentID              = "payment_id"
+	ledgerRefunded               = "refunded"
+	ledgerPending                = "pending"
+	dataEtag                     = "data.etag"
+	bankTransfer                 = "bank_transfer"
+	bankTransferReference        = "bank_transfer.reference"
+	bankCreditOutcome            = "outcome"
+	bankCreditBookedAt           = "booked_at"
+	dataPaidBy                   = "data.paid_by"
+	payerLink                    = "payer_link"
+	payerLinkID                  = "payer_link.id"
+	payerLinkRevokedAt           = "payer_link.revoked_at"
+	dataExpiresAt                = "data.expires_at"
+	dataCreatedAt                = "data.created_at"
 )
 
 // MongoService is an implementation of the Service interface using MongoDB as the backend driver.
 type MongoService struct {
-	db              MongoDatabaseInterface
-	CollectionName  string
-	RefundBatchSize int
+	db                            MongoDatabaseInterface
+	CollectionName                string
+	PaymentRequestsCollectionName string
+	AccountsCollectionName        string
+	AccountLedgerCollectionName   string
+	BankCreditsCollectionName     string
+	ResourceClaimsCollectionName  string
+	RefundBatchSize               int
 }
 
 // MongoDatabaseInterface is an interface that describes the mongodb driver
@@ -50,7 +88,7 @@ func getMongoClient(mongoDBURL string) *mongo.Client {
 
 	ctx := context.Background()
 
-	clientOptions := options.Client().ApplyURI(mongoDBURL)
+	clientOptions := options.Client().ApplyURI(mongoDBURL).SetMonitor(newTracingMonitor())
 	client, err := mongo.Connect(ctx, clientOptions)
 
 	// Assume the caller of this func cannot handle the case where there is no database connection
@@ -77,22 +115,37 @@ func getMongoClient(mongoDBURL string) *mongo.Client {
 }
 
 // CreatePaymentResource writes a new payment resource to the DB
-func (m *MongoService) CreatePaymentResource(paymentResource *models.PaymentResourceDB) error {
+func (m *MongoService) CreatePaymentResource(ctx context.Context, paymentResource *models.PaymentResourceDB) error {
 	collection := m.db.Collection(m.CollectionName)
 
-	_, err := collection.InsertOne(context.Background(), paymentResource)
+	for attempt := 1; ; attempt++ {
+		_, err := collection.InsertOne(ctx, paymentResource)
+		if err == nil || !mongo.IsDuplicateKeyError(err) || attempt == maxCreateAttempts {
+			return err
+		}
 
-	return err
+		// The ID is already taken, so give the resource a new one and try again
+		log.Info("payment resource id already exists, retrying with a new id", log.Data{"payment_id": paymentResource.ID, "attempt": attempt})
+		regeneratePaymentResourceID(paymentResource)
+	}
+}
+
+// regeneratePaymentResourceID gives the payment resource a new ID, updating the links which contain it
+func regeneratePaymentResourceID(paymentResource *models.PaymentResourceDB) {
+	oldID := paymentResource.ID
+	paymentResource.ID = helpers.GenerateID()
+	paymentResource.Data.Links.Self = strings.Replace(paymentResource.Data.Links.Self, oldID, paymentResource.ID, 1)
+	paymentResource.Data.Links.Journey = strings.Replace(paymentResource.Data.Links.Journey, oldID, paymentResource.ID, 1)
 }
 
 // GetPaymentResource gets a payment resource from the DB
 // If payment not found in DB, return nil
-func (m *MongoService) GetPaymentResource(id string) (*models.PaymentResourceDB, error) {
+func (m *MongoService) GetPaymentResource(ctx context.Context, id string) (*models.PaymentResourceDB, error) {
 
 	var resource models.PaymentResourceDB
 
 	collection := m.db.Collection(m.CollectionName)
-	dbResource := collection.FindOne(context.Background(), bson.M{"_id": id})
+	dbResource := collection.FindOne(ctx, bson.M{"_id": id})
 
 	err := dbResource.Err()
 	if err != nil {
@@ -112,10 +165,110 @@ func (m *MongoService) GetPaymentResource(id string) (*models.PaymentResourceDB,
 	return &resource, nil
 }
 
-// PatchPaymentResource patches a payment resource from the DB
-func (m *MongoService) PatchPaymentResource(id string, paymentUpdate *models.PaymentResourceDB) error {
+// PatchPaymentResource patches a payment resource from the DB. External payment attempts in the update are added to
+// those already stored, rather than replacing them.
+func (m *MongoService) PatchPaymentResource(ctx context.Context, id string, paymentUpdate *models.PaymentResourceDB) error {
+	collection := m.db.Collection(m.CollectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, paymentUpdateCall(paymentUpdate))
+
+	return err
+}
+
+// CompletePaymentResource patches a payment resource from the DB only if it is still in progress, and reports whether
+// it was. Checking and updating the status in a single update ensures that when a payment is completed by several
+// callers at once, exactly one of them makes the update. When a callback token hash is given the resource must also
+// still hold it, and the callback token is consumed by the same update, so a token is only spent by the callback that
+// completes the payment.
+func (m *MongoService) CompletePaymentResource(ctx context.Context, id, tokenHash string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{"_id": id, paymentStatus: "in-progress"}
+	if tokenHash != "" {
+		filter[callbackTokenHash] = tokenHash
+	}
+	update := bson.M{
+		"$set":   paymentPatch(paymentUpdate),
+		"$unset": bson.M{callbackTokenHash: ""},
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// ConsumeCallbackToken removes the callback token hash from a payment resource in the DB only if it is still in
+// progress and still holds that hash, and reports whether it did. Consuming the token with a single update ensures that
+// when a callback is replayed exactly one of the replays goes on to act on it, e.g. by capturing the payment.
+func (m *MongoService) ConsumeCallbackToken(ctx context.Context, id, tokenHash string) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{"_id": id, paymentStatus: "in-progress", callbackTokenHash: tokenHash}
+	update := bson.M{"$unset": bson.M{callbackTokenHash: ""}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// ReopenPaymentResource patches a payment resource from the DB, adding any new external payment attempt, only if its
+// status is one of those given, and reports whether it was. When the update moves the payment to a status without
+// completing it again, the completion time of the earlier attempt is removed, as the payment is no longer complete.
+func (m *MongoService) ReopenPaymentResource(ctx context.Context, id string, statuses []string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{"_id": id, paymentStatus: bson.M{"$in": statuses}}
+	update := paymentUpdateCall(paymentUpdate)
+	if paymentUpdate.Data.Status != "" && paymentUpdate.Data.CompletedAt.IsZero() {
+		update["$unset"] = bson.M{"data.completed_at": ""}
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// OverridePaymentResource patches a payment resource from the DB, recording the override in its history, only if its
+// status is one of those given, and reports whether it was
+func (m *MongoService) OverridePaymentResource(ctx context.Context, id string, statuses []string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
 	collection := m.db.Collection(m.CollectionName)
 
+	filter := bson.M{"_id": id, paymentStatus: bson.M{"$in": statuses}}
+	result, err := collection.UpdateOne(ctx, filter, paymentUpdateCall(paymentUpdate))
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// paymentUpdateCall returns the update of a payment resource in the DB, adding any external payment attempts and
+// history in the update to those already recorded
+func paymentUpdateCall(paymentUpdate *models.PaymentResourceDB) bson.M {
+	updateCall := bson.M{"$set": paymentPatch(paymentUpdate)}
+
+	push := bson.M{}
+	if len(paymentUpdate.ExternalPaymentAttempts) != 0 {
+		push[externalPaymentAttempts] = bson.M{"$each": paymentUpdate.ExternalPaymentAttempts}
+	}
+	if len(paymentUpdate.History) != 0 {
+		push[paymentHistory] = bson.M{"$each": paymentUpdate.History}
+	}
+	if len(push) != 0 {
+		updateCall["$push"] = push
+	}
+
+	return updateCall
+}
+
+// paymentPatch returns the fields of a payment resource update that are patched in the DB
+func paymentPatch(paymentUpdate *models.PaymentResourceDB) bson.M {
 	patchUpdate := make(bson.M)
 
 	// Patch only these fields
@@ -128,6 +281,9 @@ func (m *MongoService) PatchPaymentResource(id string, paymentUpdate *models.Pay
 	if !paymentUpdate.Data.CompletedAt.IsZero() {
 		patchUpdate["data.completed_at"] = paymentUpdate.Data.CompletedAt
 	}
+	if !paymentUpdate.Data.ExpiresAt.IsZero() {
+		patchUpdate[dataExpiresAt] = paymentUpdate.Data.ExpiresAt
+	}
 	if paymentUpdate.ExternalPaymentStatusURI != "" {
 		patchUpdate["external_payment_status_url"] = paymentUpdate.ExternalPaymentStatusURI
 	}
@@ -149,21 +305,98 @@ func (m *MongoService) PatchPaymentResource(id string, paymentUpdate *models.Pay
 	if paymentUpdate.Data.Links.Refunds != "" {
 		patchUpdate["data.links.refunds"] = paymentUpdate.Data.Links.Refunds
 	}
+	if paymentUpdate.CallbackTokenHash != "" {
+		patchUpdate[callbackTokenHash] = paymentUpdate.CallbackTokenHash
+	}
+	if paymentUpdate.BankTransfer != nil {
+		patchUpdate[bankTransfer] = paymentUpdate.BankTransfer
+	}
+	if paymentUpdate.Data.PaidBy != nil {
+		patchUpdate[dataPaidBy] = paymentUpdate.Data.PaidBy
+	}
+	if len(paymentUpdate.MessagesPending) != 0 {
+		patchUpdate[messagesPending] = paymentUpdate.MessagesPending
+		patchUpdate[messagesPendingAt] = paymentUpdate.MessagesPendingAt
+	}
+
+	return patchUpdate
+}
 
-	updateCall := bson.M{"$set": patchUpdate}
+// RemovePrefilledCardholderDetails removes the cardholder details stored against a payment resource, once they have
+// been passed on to the payment provider
+func (m *MongoService) RemovePrefilledCardholderDetails(ctx context.Context, id string) error {
+	collection := m.db.Collection(m.CollectionName)
 
-	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, updateCall)
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{prefilledCardholderDetails: ""}})
 
 	return err
 }
 
+// SetPayerLink issues a pay-on-behalf link for a payment resource, replacing any link issued before it
+func (m *MongoService) SetPayerLink(ctx context.Context, id string, link *models.PayerLinkDB) error {
+	collection := m.db.Collection(m.CollectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{payerLink: link}})
+
+	return err
+}
+
+// RevokePayerLink revokes the pay-on-behalf link of a payment resource if it is the one given, and reports whether it
+// did. A link that was already revoked, or has been replaced, isn't revoked again.
+func (m *MongoService) RevokePayerLink(ctx context.Context, id, linkID string, revokedAt time.Time) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{"_id": id, payerLinkID: linkID, payerLinkRevokedAt: bson.M{"$exists": false}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{payerLinkRevokedAt: revokedAt}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// ExtendPaymentResource sets the time a payment resource expires, only if its status is one of those given, and reports
+// whether it was
+func (m *MongoService) ExtendPaymentResource(ctx context.Context, id string, statuses []string, expiresAt time.Time) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{"_id": id, paymentStatus: bson.M{"$in": statuses}}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{dataExpiresAt: expiresAt}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// SetExternalPaymentAttemptOutcome records the outcome of a payment resource's external payment attempt with the given
+// status URI, and reports whether it did. An outcome is only recorded once, so that it is acted on by a single caller.
+func (m *MongoService) SetExternalPaymentAttemptOutcome(ctx context.Context, id, externalPaymentStatusURI, outcome string) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{
+		"_id": id,
+		externalPaymentAttempts: bson.M{"$elemMatch": bson.M{
+			"external_payment_status_url": externalPaymentStatusURI,
+			"outcome":                     bson.M{"$exists": false},
+		}},
+	}
+	update := bson.M{"$set": bson.M{externalPaymentAttempts + ".$.outcome": outcome}}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
 // GetPaymentResourceByProviderID retrieves a payment resource
 // associated with the supplied Provider ID
-func (m *MongoService) GetPaymentResourceByProviderID(providerID string) (*models.PaymentResourceDB, error) {
+func (m *MongoService) GetPaymentResourceByProviderID(ctx context.Context, providerID string) (*models.PaymentResourceDB, error) {
 	var resource models.PaymentResourceDB
 
 	collection := m.db.Collection(m.CollectionName)
-	document := collection.FindOne(context.Background(), bson.M{dataProviderID: providerID})
+	document := collection.FindOne(ctx, bson.M{dataProviderID: providerID})
 
 	err := document.Err()
 	if err != nil {
@@ -184,11 +417,11 @@ func (m *MongoService) GetPaymentResourceByProviderID(providerID string) (*model
 
 // GetPaymentResourceByExternalPaymentTransactionID retrieves a payment resource
 // associated with the externalPaymentTransactionID provided
-func (m *MongoService) GetPaymentResourceByExternalPaymentTransactionID(id string) (*models.PaymentResourceDB, error) {
+func (m *MongoService) GetPaymentResourceByExternalPaymentTransactionID(ctx context.Context, id string) (*models.PaymentResourceDB, error) {
 	var resource models.PaymentResourceDB
 
 	collection := m.db.Collection(m.CollectionName)
-	document := collection.FindOne(context.Background(), bson.M{externalPaymentTransactionID: id})
+	document := collection.FindOne(ctx, bson.M{externalPaymentTransactionID: id})
 
 	err := document.Err()
 	if err != nil {
@@ -207,9 +440,42 @@ func (m *MongoService) GetPaymentResourceByExternalPaymentTransactionID(id strin
 	return &resource, nil
 }
 
-// GetIncompleteGovPayPayments retrieves all in-progress payments which have existed longer than the expiry limit
+// GetPaymentResourcesByResource retrieves the payment resources created for the supplied cost resource which have
+// one of the supplied statuses, most recently created first. Basket sessions paying for the cost resource alongside
+// others are included.
+func (m *MongoService) GetPaymentResourcesByResource(ctx context.Context, resource string, statuses []string) ([]models.PaymentResourceDB, error) {
+	var payments []models.PaymentResourceDB
+
+	collection := m.db.Collection(m.CollectionName)
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{dataLinksResource: resource},
+			bson.M{dataLinksResources: resource},
+		},
+		paymentStatus: bson.M{"$in": statuses},
+	}
+
+	filterOptions := options.Find()
+	filterOptions.SetSort(bson.M{"data.created_at": -1})
+
+	paymentDBResources, err := collection.Find(ctx, filter, filterOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = paymentDBResources.All(ctx, &payments)
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// GetIncompleteGovPayPayments retrieves all in-progress payments which have expired, and which are being paid by card
+// or have had a GovPay attempt before the payment method was changed. Payments created before sessions stored the time
+// they expire are taken to have expired once they have existed longer than the GovPay expiry limit.
 // Ignores any payments which are older than GovPayMaxCheckingDays, these are assumed to no longer be valid.
-func (m *MongoService) GetIncompleteGovPayPayments(cfg *config.Config) ([]models.PaymentResourceDB, error) {
+func (m *MongoService) GetIncompleteGovPayPayments(ctx context.Context, cfg *config.Config) ([]models.PaymentResourceDB, error) {
 
 	var pendingPayments []models.PaymentResourceDB
 
@@ -217,51 +483,96 @@ func (m *MongoService) GetIncompleteGovPayPayments(cfg *config.Config) ([]models
 	now := time.Now()
 
 	filter := bson.M{
-		"data.payment_method": "credit-card",
-		"data.status":         "in-progress",
-		"data.created_at": bson.M{
-			"$lt": now.Add(time.Minute * -time.Duration(cfg.GovPayExpiryTime)),
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"data.payment_method": "credit-card"},
+				bson.M{externalPaymentAttempts + ".payment_method": "credit-card"},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{dataExpiresAt: bson.M{"$lt": now}},
+				bson.M{
+					dataExpiresAt: bson.M{"$exists": false},
+					dataCreatedAt: bson.M{"$lt": now.Add(time.Minute * -time.Duration(cfg.GovPayExpiryTime))},
+				},
+			}},
+		},
+		"data.status": "in-progress",
+		dataCreatedAt: bson.M{
 			"$gt": now.Add(time.Hour * 24 * -time.Duration(cfg.GovPayMaxCheckingDays)),
 		},
 	}
 
-	incompletePaymentsDB, err := collection.Find(context.Background(), filter)
+	incompletePaymentsDB, err := collection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	err = incompletePaymentsDB.All(context.Background(), &pendingPayments)
+	err = incompletePaymentsDB.All(ctx, &pendingPayments)
 	if err != nil {
 		return nil, err
 	}
 
-	incompletePaymentsDB.Close(context.Background())
+	incompletePaymentsDB.Close(ctx)
 
 	return pendingPayments, nil
 
 }
 
+// GetPaymentResourcesWithMessagesPending retrieves the payment resources whose payment processed messages haven't all
+// been sent, and have been pending since before the given time
+func (m *MongoService) GetPaymentResourcesWithMessagesPending(ctx context.Context, pendingBefore time.Time) ([]models.PaymentResourceDB, error) {
+	var paymentResources []models.PaymentResourceDB
+
+	collection := m.db.Collection(m.CollectionName)
+
+	filter := bson.M{
+		messagesPending + ".0": bson.M{"$exists": true},
+		messagesPendingAt:      bson.M{"$lt": pendingBefore},
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &paymentResources)
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResources, nil
+}
+
+// RemoveMessagesPending records the payment processed messages of a payment resource sent for the given cost resources
+func (m *MongoService) RemoveMessagesPending(ctx context.Context, id string, resources []string) error {
+	collection := m.db.Collection(m.CollectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$pullAll": bson.M{messagesPending: resources}})
+
+	return err
+}
+
 // CreateBulkRefundByProviderID creates or adds to the array of bulk refunds on a payment resource
 // The query only updates those payments in the DB with the specified Provider ID
 // which do not have an existing bulk refund with the status of refund-pending
 // or refund-requested
-func (m *MongoService) CreateBulkRefundByProviderID(bulkRefunds map[string]models.BulkRefundDB) error {
-	return m.CreateBulkRefund(bulkRefunds, dataProviderID)
+func (m *MongoService) CreateBulkRefundByProviderID(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB) error {
+	return m.CreateBulkRefund(ctx, bulkRefunds, dataProviderID)
 }
 
 // CreateBulkRefundByExternalPaymentTransactionID creates or adds to the array of bulk refunds on a payment resource
 // The query only updates those payments in the DB with the specified External Payment
 // Transaction ID which do not have an existing bulk refund with the status of refund-pending
 // or refund-requested
-func (m *MongoService) CreateBulkRefundByExternalPaymentTransactionID(bulkRefunds map[string]models.BulkRefundDB) error {
-	return m.CreateBulkRefund(bulkRefunds, externalPaymentTransactionID)
+func (m *MongoService) CreateBulkRefundByExternalPaymentTransactionID(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB) error {
+	return m.CreateBulkRefund(ctx, bulkRefunds, externalPaymentTransactionID)
 }
 
 // CreateBulkRefund creates or adds to the array of bulk refunds on a payment resource
 // The query only updates those payments in the DB with the specified external payment
 // status ID, filtered on the specified query string, that do not have an existing
 // bulk refund with the status of refund-pending or refund-requested
-func (m *MongoService) CreateBulkRefund(bulkRefunds map[string]models.BulkRefundDB, idQuery string) error {
+func (m *MongoService) CreateBulkRefund(ctx context.Context, bulkRefunds map[string]models.BulkRefundDB, idQuery string) error {
 	collection := m.db.Collection(m.CollectionName)
 
 	var operations []mongo.WriteModel
@@ -281,7 +592,7 @@ func (m *MongoService) CreateBulkRefund(bulkRefunds map[string]models.BulkRefund
 	}
 
 	log.Info(fmt.Sprintf("Running BulkWrite operation for refund file for refunds on field [%s]", idQuery))
-	update, err := collection.BulkWrite(context.Background(), operations)
+	update, err := collection.BulkWrite(ctx, operations)
 
 	if err != nil {
 		return fmt.Errorf("error bulk updating on mongo for bulk refund file [%s]: %w", bulkRefunds, err)
@@ -295,18 +606,18 @@ func (m *MongoService) CreateBulkRefund(bulkRefunds map[string]models.BulkRefund
 
 // GetPaymentsWithRefundStatus retrieves a list of all payments in the DB with a bulk refund status of
 // refund-pending
-func (m *MongoService) GetPaymentsWithRefundStatus() ([]models.PaymentResourceDB, error) {
+func (m *MongoService) GetPaymentsWithRefundStatus(ctx context.Context) ([]models.PaymentResourceDB, error) {
 	var payments []models.PaymentResourceDB
 
 	collection := m.db.Collection(m.CollectionName)
 	statusFilter := bson.M{bulkRefundStatus: "refund-pending"}
 
-	paymentDBResources, err := collection.Find(context.Background(), statusFilter)
+	paymentDBResources, err := collection.Find(ctx, statusFilter)
 	if err != nil {
 		return nil, err
 	}
 
-	err = paymentDBResources.All(context.Background(), &payments)
+	err = paymentDBResources.All(ctx, &payments)
 	if err != nil {
 		return nil, err
 	}
@@ -315,7 +626,7 @@ func (m *MongoService) GetPaymentsWithRefundStatus() ([]models.PaymentResourceDB
 }
 
 // GetPaymentsWithRefundPendingStatus retrieves a list of payments in the DB with a status of refund-requested
-func (m *MongoService) GetPaymentsWithRefundPendingStatus() ([]models.PaymentResourceDB, error) {
+func (m *MongoService) GetPaymentsWithRefundPendingStatus(ctx context.Context) ([]models.PaymentResourceDB, error) {
 	var payments []models.PaymentResourceDB
 
 	collection := m.db.Collection(m.CollectionName)
@@ -326,12 +637,12 @@ func (m *MongoService) GetPaymentsWithRefundPendingStatus() ([]models.PaymentRes
 	filterOptions.SetSkip(0)
 	filterOptions.SetLimit(int64(m.RefundBatchSize))
 
-	paymentDBResources, err := collection.Find(context.Background(), statusFilter, filterOptions)
+	paymentDBResources, err := collection.Find(ctx, statusFilter, filterOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	err = paymentDBResources.All(context.Background(), &payments)
+	err = paymentDBResources.All(ctx, &payments)
 	if err != nil {
 		return nil, err
 	}
@@ -340,19 +651,19 @@ func (m *MongoService) GetPaymentsWithRefundPendingStatus() ([]models.PaymentRes
 		return nil, err
 	}
 
-	paymentDBResources.Close(context.Background())
+	paymentDBResources.Close(ctx)
 
 	return payments, nil
 }
 
 // GetPaymentRefunds retrieves a list of refunds in the DB by paymentId
-func (m *MongoService) GetPaymentRefunds(id string) ([]models.RefundResourceDB, error) {
+func (m *MongoService) GetPaymentRefunds(ctx context.Context, id string) ([]models.RefundResourceDB, error) {
 
 	var paymentResource models.PaymentResourceDB
 	var paymentRefunds []models.RefundResourceDB
 
 	collection := m.db.Collection(m.CollectionName)
-	dbRefunds := collection.FindOne(context.Background(), bson.M{"_id": id})
+	dbRefunds := collection.FindOne(ctx, bson.M{"_id": id})
 
 	err := dbRefunds.Err()
 	if err != nil {
@@ -374,12 +685,12 @@ func (m *MongoService) GetPaymentRefunds(id string) ([]models.RefundResourceDB,
 }
 
 // PatchRefundSuccessStatus updates payment refunds status to refund-success
-func (m *MongoService) PatchRefundSuccessStatus(id string, isRefunded bool, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
-	return m.PatchRefundStatus(id, isRefunded, false, "refund-success", paymentUpdate)
+func (m *MongoService) PatchRefundSuccessStatus(ctx context.Context, id string, isRefunded bool, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
+	return m.PatchRefundStatus(ctx, id, isRefunded, false, "refund-success", paymentUpdate)
 }
 
 // PatchRefundStatus updates payment refunds status and inserts a new refunded_at
-func (m *MongoService) PatchRefundStatus(id string, isRefunded bool, isFailed bool, refundStatus string, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
+func (m *MongoService) PatchRefundStatus(ctx context.Context, id string, isRefunded bool, isFailed bool, refundStatus string, paymentUpdate *models.PaymentResourceDB) (models.PaymentResourceDB, error) {
 	collection := m.db.Collection(m.CollectionName)
 	refunds := paymentUpdate.Refunds[0]
 	attempts := refunds.Attempts + 1
@@ -421,7 +732,7 @@ func (m *MongoService) PatchRefundStatus(id string, isRefunded bool, isFailed bo
 	}
 
 	updatedPayment := models.PaymentResourceDB{}
-	result := collection.FindOneAndUpdate(context.Background(), bson.M{"_id": id}, patchUpdate, &opts)
+	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, patchUpdate, &opts)
 
 	if result.Err() != nil {
 		return updatedPayment, result.Err()
@@ -440,7 +751,7 @@ func (m *MongoService) PatchRefundStatus(id string, isRefunded bool, isFailed bo
 }
 
 // IncrementRefundAttempts increments the attempt counter for a refund
-func (m *MongoService) IncrementRefundAttempts(paymentID string, paymentUpdate *models.PaymentResourceDB) error {
+func (m *MongoService) IncrementRefundAttempts(ctx context.Context, paymentID string, paymentUpdate *models.PaymentResourceDB) error {
 	collection := m.db.Collection(m.CollectionName)
 	refunds := paymentUpdate.Refunds[0]
 	attempts := refunds.Attempts + 1
@@ -459,7 +770,390 @@ func (m *MongoService) IncrementRefundAttempts(paymentID string, paymentUpdate *
 		},
 	}
 
-	result := collection.FindOneAndUpdate(context.Background(), bson.M{"_id": paymentID}, patchUpdate, &opts)
+	result := collection.FindOneAndUpdate(ctx, bson.M{"_id": paymentID}, patchUpdate, &opts)
 
 	return result.Err()
 }
+
+// CreatePaymentRequest writes a new payment request to the DB
+func (m *MongoService) CreatePaymentRequest(ctx context.Context, paymentRequest *models.PaymentRequestDB) error {
+	collection := m.db.Collection(m.PaymentRequestsCollectionName)
+
+	_, err := collection.InsertOne(ctx, paymentRequest)
+
+	return err
+}
+
+// GetPaymentRequest gets a payment request from the DB
+// If the payment request is not found in the DB, return nil
+func (m *MongoService) GetPaymentRequest(ctx context.Context, id string) (*models.PaymentRequestDB, error) {
+	var paymentRequest models.PaymentRequestDB
+
+	collection := m.db.Collection(m.PaymentRequestsCollectionName)
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&paymentRequest)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Info("no payment request found for id " + id)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &paymentRequest, nil
+}
+
+// CreateAccount writes a new credit account to the DB
+func (m *MongoService) CreateAccount(ctx context.Context, account *models.AccountDB) error {
+	collection := m.db.Collection(m.AccountsCollectionName)
+
+	_, err := collection.InsertOne(ctx, account)
+
+	return err
+}
+
+// GetAccount gets a credit account from the DB
+// If the account is not found in the DB, return nil
+func (m *MongoService) GetAccount(ctx context.Context, id string) (*models.AccountDB, error) {
+	return m.findAccount(ctx, bson.M{"_id": id})
+}
+
+// GetAccountByUserIDs gets the credit account any of the users can pay from
+// If no account is found in the DB, return nil
+func (m *MongoService) GetAccountByUserIDs(ctx context.Context, userIDs []string) (*models.AccountDB, error) {
+	return m.findAccount(ctx, bson.M{accountUserIDs: bson.M{"$in": userIDs}})
+}
+
+func (m *MongoService) findAccount(ctx context.Context, filter bson.M) (*models.AccountDB, error) {
+	var account models.AccountDB
+
+	collection := m.db.Collection(m.AccountsCollectionName)
+	err := collection.FindOne(ctx, filter).Decode(&account)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Info("no account found", log.Data{"filter": filter})
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// UpdateAccountStatus sets the status of a credit account, and reports whether the account was found
+func (m *MongoService) UpdateAccountStatus(ctx context.Context, id, status string) (bool, error) {
+	collection := m.db.Collection(m.AccountsCollectionName)
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{accountStatus: status}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// DebitAccount takes the amount of a ledger entry from a credit account with the given status, and records the entry
+// on the account's ledger. The account is only debited if its balance covers the amount, and it reports whether it was.
+func (m *MongoService) DebitAccount(ctx context.Context, entry *models.AccountLedgerEntryDB, status string) (bool, error) {
+	filter := bson.M{
+		"_id":          entry.AccountID,
+		accountStatus:  status,
+		accountBalance: bson.M{"$gte": -entry.Amount},
+	}
+	return m.applyLedgerEntry(ctx, filter, entry)
+}
+
+// CreditAccount adds the amount of a ledger entry to a credit account, whatever its status, and records the entry on
+// the account's ledger. It reports whether the account was found.
+func (m *MongoService) CreditAccount(ctx context.Context, entry *models.AccountLedgerEntryDB) (bool, error) {
+	return m.applyLedgerEntry(ctx, bson.M{"_id": entry.AccountID}, entry)
+}
+
+// applyLedgerEntry changes the balance of the account matching the filter by the amount of the entry, then records the
+// entry on the ledger with the balance it left. The balance is checked and changed in a single update so that
+// concurrent debits can't overdraw the account, and is changed back if the entry can't be recorded so that the balance
+// always matches the ledger.
+func (m *MongoService) applyLedgerEntry(ctx context.Context, filter bson.M, entry *models.AccountLedgerEntryDB) (bool, error) {
+	accounts := m.db.Collection(m.AccountsCollectionName)
+
+	var account models.AccountDB
+	after := options.After
+	err := accounts.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{accountBalance: entry.Amount}}, &options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+	}).Decode(&account)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	entry.Balance = account.Balance
+	_, err = m.db.Collection(m.AccountLedgerCollectionName).InsertOne(ctx, entry)
+	if err != nil {
+		_, reverseErr := accounts.UpdateOne(ctx, bson.M{"_id": entry.AccountID}, bson.M{"$inc": bson.M{accountBalance: -entry.Amount}})
+		if reverseErr != nil {
+			return false, fmt.Errorf("error recording ledger entry: [%v], and error reversing it from the balance: [%v]", err, reverseErr)
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetAccountLedgerEntry gets an entry from the ledger of credit accounts
+// If the entry is not found in the DB, return nil
+func (m *MongoService) GetAccountLedgerEntry(ctx context.Context, id string) (*models.AccountLedgerEntryDB, error) {
+	var entry models.AccountLedgerEntryDB
+
+	collection := m.db.Collection(m.AccountLedgerCollectionName)
+	err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Info("no account ledger entry found for id " + id)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// GetAccountLedgerEntriesForPayment gets the entries made to credit accounts for a payment session, the earliest first
+func (m *MongoService) GetAccountLedgerEntriesForPayment(ctx context.Context, paymentID string) ([]models.AccountLedgerEntryDB, error) {
+	entries := []models.AccountLedgerEntryDB{}
+
+	collection := m.db.Collection(m.AccountLedgerCollectionName)
+	cursor, err := collection.Find(ctx, bson.M{ledgerPaymentID: paymentID}, options.Find().SetSort(bson.M{ledgerCreatedAt: 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// AddAccountLedgerEntryRefund adds an amount to the total refunded of a debit on the ledger of credit accounts, only
+// if the total stays within the amount debited, and reports whether it was added. Checking and adding to the total in
+// a single update ensures that refunds made at once, or a refund retried, can't refund more than was paid. A negative
+// amount takes back a refund which couldn't be made.
+func (m *MongoService) AddAccountLedgerEntryRefund(ctx context.Context, debit *models.AccountLedgerEntryDB, amount int) (bool, error) {
+	collection := m.db.Collection(m.AccountLedgerCollectionName)
+
+	filter := bson.M{
+		"_id":          debit.ID,
+		ledgerRefunded: bson.M{"$not": bson.M{"$gt": -debit.Amount - amount}},
+	}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{ledgerRefunded: amount}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// SettleAccountLedgerEntry records that a pending debit on the ledger of credit accounts has been settled, either by
+// completing the payment session it was made for or by being reversed
+func (m *MongoService) SettleAccountLedgerEntry(ctx context.Context, id string) error {
+	collection := m.db.Collection(m.AccountLedgerCollectionName)
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{ledgerPending: ""}})
+
+	return err
+}
+
+// GetPendingAccountLedgerEntries gets the debits on the ledger of credit accounts made before the given time which are
+// still pending, the earliest first
+func (m *MongoService) GetPendingAccountLedgerEntries(ctx context.Context, createdBefore time.Time) ([]models.AccountLedgerEntryDB, error) {
+	entries := []models.AccountLedgerEntryDB{}
+
+	collection := m.db.Collection(m.AccountLedgerCollectionName)
+	filter := bson.M{ledgerPending: true, ledgerCreatedAt: bson.M{"$lt": createdBefore}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{ledgerCreatedAt: 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetAccountLedgerEntries gets the entries made to a credit account from, and before, the given times, the earliest
+// first. A zero time leaves that end of the period open.
+func (m *MongoService) GetAccountLedgerEntries(ctx context.Context, accountID string, from, to time.Time) ([]models.AccountLedgerEntryDB, error) {
+	entries := []models.AccountLedgerEntryDB{}
+
+	filter := bson.M{ledgerAccountID: accountID}
+	createdAt := bson.M{}
+	if !from.IsZero() {
+		createdAt["$gte"] = from
+	}
+	if !to.IsZero() {
+		createdAt["$lt"] = to
+	}
+	if len(createdAt) > 0 {
+		filter[ledgerCreatedAt] = createdAt
+	}
+
+	collection := m.db.Collection(m.AccountLedgerCollectionName)
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{ledgerCreatedAt: 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetPaymentResourceByRemittanceReference gets the payment session a payer paying by bank transfer was given the
+// remittance reference for
+// If payment not found in DB, return nil
+func (m *MongoService) GetPaymentResourceByRemittanceReference(ctx context.Context, reference string) (*models.PaymentResourceDB, error) {
+	var resource models.PaymentResourceDB
+
+	collection := m.db.Collection(m.CollectionName)
+	err := collection.FindOne(ctx, bson.M{bankTransferReference: reference}).Decode(&resource)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Info(fmt.Sprintf("no payment resource found for remittance reference: [%s]", reference))
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+// ReconcileBankTransfer patches a payment session paid by bank transfer, recording the credit matched to it in its
+// history, only if its etag is still the one given, and reports whether it was. Checking the etag ensures that credits
+// matched to the same session at once can't overwrite each other's amount received.
+func (m *MongoService) ReconcileBankTransfer(ctx context.Context, id, etag string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+	collection := m.db.Collection(m.CollectionName)
+
+	update := paymentUpdateCall(paymentUpdate)
+	update["$set"].(bson.M)[dataEtag] = paymentUpdate.Data.Etag
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id, dataEtag: etag}, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// CreateBankCredit writes a credit imported from a bank statement to the DB, and reports whether it was written. A
+// credit isn't written if one with its ID has already been imported.
+func (m *MongoService) CreateBankCredit(ctx context.Context, credit *models.BankCreditDB) (bool, error) {
+	collection := m.db.Collection(m.BankCreditsCollectionName)
+
+	_, err := collection.InsertOne(ctx, credit)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpdateBankCredit records the outcome of matching a credit imported from a bank statement to a payment session
+func (m *MongoService) UpdateBankCredit(ctx context.Context, credit *models.BankCreditDB) error {
+	collection := m.db.Collection(m.BankCreditsCollectionName)
+
+	update := bson.M{"$set": bson.M{
+		bankCreditOutcome:      credit.Outcome,
+		"remittance_reference": credit.RemittanceReference,
+		"payment_id":           credit.PaymentID,
+	}}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": credit.ID}, update)
+
+	return err
+}
+
+// GetBankCredits gets the credits imported from bank statements with any of the given outcomes which were booked from,
+// and before, the given times, the earliest first. A zero time leaves that end of the period open.
+func (m *MongoService) GetBankCredits(ctx context.Context, outcomes []string, from, to time.Time) ([]models.BankCreditDB, error) {
+	credits := []models.BankCreditDB{}
+
+	filter := bson.M{bankCreditOutcome: bson.M{"$in": outcomes}}
+	bookedAt := bson.M{}
+	if !from.IsZero() {
+		bookedAt["$gte"] = from
+	}
+	if !to.IsZero() {
+		bookedAt["$lt"] = to
+	}
+	if len(bookedAt) > 0 {
+		filter[bankCreditBookedAt] = bookedAt
+	}
+
+	collection := m.db.Collection(m.BankCreditsCollectionName)
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.M{bankCreditBookedAt: 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	err = cursor.All(ctx, &credits)
+	if err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// ClaimResource claims a cost resource for a payment session until the given time, or indefinitely if it is zero, and
+// reports whether it was claimed. A resource can only be claimed if it is unclaimed, already claimed by the session, or
+// the claim of another session has expired. The resource is the ID of its claim, so when another session holds it the
+// upsert fails with a duplicate key rather than making a second claim.
+func (m *MongoService) ClaimResource(ctx context.Context, resource, paymentID string, expiresAt time.Time) (bool, error) {
+	collection := m.db.Collection(m.ResourceClaimsCollectionName)
+
+	filter := bson.M{
+		"_id": resource,
+		"$or": bson.A{
+			bson.M{"payment_id": paymentID},
+			bson.M{"expires_at": bson.M{"$lte": time.Now()}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"payment_id": paymentID}}
+	if expiresAt.IsZero() {
+		update["$unset"] = bson.M{"expires_at": ""}
+	} else {
+		update["$set"].(bson.M)["expires_at"] = expiresAt
+	}
+
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReleaseResource removes the claim a payment session holds on a cost resource, if it still holds it
+func (m *MongoService) ReleaseResource(ctx context.Context, resource, paymentID string) error {
+	collection := m.db.Collection(m.ResourceClaimsCollectionName)
+
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": resource, "payment_id": paymentID})
+
+	return err
+}
@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -106,7 +107,7 @@ func TestUnitCreatePaymentResourceDriver(t *testing.T) {
 
 		mongoService.db = mt.DB
 
-		err := mongoService.CreatePaymentResource(&paymentResource)
+		err := mongoService.CreatePaymentResource(context.Background(), &paymentResource)
 
 		assert.Nil(t, err)
 	})
@@ -116,10 +117,42 @@ func TestUnitCreatePaymentResourceDriver(t *testing.T) {
 
 		mongoService.db = mt.DB
 
-		err := mongoService.CreatePaymentResource(&paymentResource)
+		err := mongoService.CreatePaymentResource(context.Background(), &paymentResource)
 
 		assert.NotNil(t, err)
 	})
+
+	duplicateKeyError := mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}
+
+	mt.Run("CreatePaymentResource retries with a new id after a duplicate key", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(duplicateKeyError), mtest.CreateSuccessResponse())
+
+		mongoService.db = mt.DB
+
+		resource := paymentResource
+		resource.Data.Links = models.PaymentLinksDB{Self: "payments/ID", Journey: "http://web/payments/ID/pay"}
+
+		err := mongoService.CreatePaymentResource(context.Background(), &resource)
+
+		assert.Nil(t, err)
+		assert.NotEqual(t, "ID", resource.ID)
+		assert.Len(t, resource.ID, 15)
+		assert.Equal(t, "payments/"+resource.ID, resource.Data.Links.Self)
+		assert.Equal(t, "http://web/payments/"+resource.ID+"/pay", resource.Data.Links.Journey)
+	})
+
+	mt.Run("CreatePaymentResource gives up after repeated duplicate keys", func(mt *mtest.T) {
+		for i := 0; i < maxCreateAttempts; i++ {
+			mt.AddMockResponses(mtest.CreateWriteErrorsResponse(duplicateKeyError))
+		}
+
+		mongoService.db = mt.DB
+
+		resource := paymentResource
+		err := mongoService.CreatePaymentResource(context.Background(), &resource)
+
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+	})
 }
 
 func TestUnitGetPaymentResourceDriver(t *testing.T) {
@@ -139,7 +172,7 @@ func TestUnitGetPaymentResourceDriver(t *testing.T) {
 
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentResource("ID")
+		paymentResource, err := mongoService.GetPaymentResource(context.Background(), "ID")
 		assert.NotNil(t, paymentResource)
 		assert.Nil(t, err)
 		assert.Equal(t, paymentResource.ID, "ID")
@@ -152,7 +185,7 @@ func TestUnitGetPaymentResourceDriver(t *testing.T) {
 
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentResource("ID")
+		paymentResource, err := mongoService.GetPaymentResource(context.Background(), "ID")
 
 		assert.NotNil(t, err)
 		assert.Nil(t, paymentResource)
@@ -177,7 +210,7 @@ func TestUnitGetPaymentResourceDriver(t *testing.T) {
 		mt.AddMockResponses(response)
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentResource("ID")
+		paymentResource, err := mongoService.GetPaymentResource(context.Background(), "ID")
 		assert.Nil(t, paymentResource)
 		assert.NotNil(t, err)
 		assert.Equal(t, err.Error(), "error decoding key refunds: cannot decode document into []models.RefundResourceDB")
@@ -196,402 +229,512 @@ func TestUnitPatchPaymentResourceDriver(t *testing.T) {
 
 	mt.Run("PatchPaymentResource runs successfully", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		err := mongoService.PatchPaymentResource("ID", &paymentResource)
+		err := mongoService.PatchPaymentResource(context.Background(), "ID", &paymentResource)
 
 		assert.NotNil(t, err)
 		assert.Equal(t, err.Error(), "no responses remaining")
 	})
+
+	mt.Run("PatchPaymentResource adds external payment attempts", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		mongoService.db = mt.DB
+
+		err := mongoService.PatchPaymentResource(context.Background(), "ID", &models.PaymentResourceDB{
+			ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/abc",
+			ExternalPaymentAttempts: []models.ExternalPaymentAttemptDB{
+				{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/abc"},
+			},
+		})
+		assert.Nil(t, err)
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		pushed := update.Lookup("$push", externalPaymentAttempts, "$each").Array().Index(0).Value().Document()
+		assert.Equal(t, "credit-card", pushed.Lookup("payment_method").StringValue())
+		assert.Equal(t, "https://publicapi.payments.service.gov.uk/v1/payments/abc", update.Lookup("$set", "external_payment_status_url").StringValue())
+	})
 }
 
-func TestUnitGetPaymentResourceByProviderIDDriver(t *testing.T) {
+func TestUnitCompletePaymentResourceDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+	mongoService, _, opts, paymentResource, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	mt.Run("GetPaymentResourceByProviderID successfully", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", paymentResource.ID},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-		}))
-
+	mt.Run("CompletePaymentResource completes an in-progress payment", func(mt *mtest.T) {
 		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "", &paymentResource)
 
-		paymentResource, err := mongoService.GetPaymentResourceByProviderID("providerID")
-		assert.NotNil(t, paymentResource)
 		assert.Nil(t, err)
-		assert.Equal(t, paymentResource.ID, "ID")
-		assert.Equal(t, paymentResource.State, "State")
-		assert.Equal(t, paymentResource.RedirectURI, "RedirectURI")
+		assert.True(t, completed)
 	})
 
-	mt.Run("GetPaymentResource with error findone", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
-
+	mt.Run("CompletePaymentResource records the payment processed messages to send in the same update", func(mt *mtest.T) {
 		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		paymentResource, err := mongoService.GetPaymentResourceByProviderID("providerID")
+		update := paymentResource
+		update.MessagesPending = []string{"first", "second"}
+		update.MessagesPendingAt = time.Now()
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "", &update)
 
-		assert.NotNil(t, err)
-		assert.Nil(t, paymentResource)
+		assert.Nil(t, err)
+		assert.True(t, completed)
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		pending := statement.Lookup("u", "$set", messagesPending).Array()
+		assert.Equal(t, "first", pending.Index(0).Value().StringValue())
+		assert.Equal(t, "second", pending.Index(1).Value().StringValue())
+		assert.Equal(t, update.MessagesPendingAt.UnixMilli(), statement.Lookup("u", "$set", messagesPendingAt).Time().UnixMilli())
 	})
 
-	mt.Run("GetPaymentResource with decoding error", func(mt *mtest.T) {
-		response := mtest.CreateCursorResponse(
-			1,
-			"models.PaymentResourceDB",
-			mtest.FirstBatch, bson.D{
-				{"_id", paymentResource.ID},
-				{"redirect_uri", paymentResource.RedirectURI},
-				{"state", paymentResource.State},
-				{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-				{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-				{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-				{"data", paymentResource.Data},
-				{"refunds", models.RefundResourceDB{}},
-				{"bulk_refunds", models.BulkRefundDB{}},
-			})
-
-		mt.AddMockResponses(response)
+	mt.Run("CompletePaymentResource moves the expiry of an update which gives one", func(mt *mtest.T) {
 		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		paymentResource, err := mongoService.GetPaymentResourceByProviderID("providerID")
-		assert.Nil(t, paymentResource)
-		assert.NotNil(t, err)
-		assert.Equal(t, err.Error(), "error decoding key refunds: cannot decode document into []models.RefundResourceDB")
-	})
-}
+		update := paymentResource
+		update.Data.ExpiresAt = time.Now().Add(time.Hour * 24 * 14)
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "", &update)
 
-func TestUnitGetPaymentResourceByExternalPaymentTransactionIDDriver(t *testing.T) {
-	t.Parallel()
+		assert.Nil(t, err)
+		assert.True(t, completed)
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, update.Data.ExpiresAt.UnixMilli(), statement.Lookup("u", "$set", dataExpiresAt).Time().UnixMilli())
+	})
 
-	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+	mt.Run("CompletePaymentResource leaves a payment that is no longer in progress", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
 
-	mt := mtest.New(t, opts)
-	defer mt.Close()
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "", &paymentResource)
 
-	mt.Run("GetPaymentResourceByExternalPaymentTransactionID successfully", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", paymentResource.ID},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-		}))
+		assert.Nil(t, err)
+		assert.False(t, completed)
+	})
 
+	mt.Run("CompletePaymentResource consumes the callback token it's given as it completes the payment", func(mt *mtest.T) {
 		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "hash", &paymentResource)
 
-		paymentResource, err := mongoService.GetPaymentResourceByExternalPaymentTransactionID("id")
-		assert.NotNil(t, paymentResource)
 		assert.Nil(t, err)
-		assert.Equal(t, paymentResource.ID, "ID")
-		assert.Equal(t, paymentResource.State, "State")
-		assert.Equal(t, paymentResource.RedirectURI, "RedirectURI")
+		assert.True(t, completed)
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "hash", statement.Lookup("q", callbackTokenHash).StringValue())
+		_, err = statement.Lookup("u", "$unset").Document().LookupErr(callbackTokenHash)
+		assert.Nil(t, err)
 	})
 
-	mt.Run("GetPaymentResource with error findone", func(mt *mtest.T) {
-
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
-
+	mt.Run("CompletePaymentResource leaves a payment whose callback token has been used", func(mt *mtest.T) {
 		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
 
-		paymentResource, err := mongoService.GetPaymentResourceByExternalPaymentTransactionID("id")
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "hash", &paymentResource)
 
-		assert.NotNil(t, err)
-		assert.Nil(t, paymentResource)
+		assert.Nil(t, err)
+		assert.False(t, completed)
 	})
 
-	mt.Run("GetPaymentResource with decoding error", func(mt *mtest.T) {
-		response := mtest.CreateCursorResponse(
-			1,
-			"models.PaymentResourceDB",
-			mtest.FirstBatch, bson.D{
-				{"_id", paymentResource.ID},
-				{"redirect_uri", paymentResource.RedirectURI},
-				{"state", paymentResource.State},
-				{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-				{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-				{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-				{"data", paymentResource.Data},
-				{"refunds", models.RefundResourceDB{}},
-				{"bulk_refunds", models.BulkRefundDB{}},
-			})
-
-		mt.AddMockResponses(response)
+	mt.Run("CompletePaymentResource runs with error", func(mt *mtest.T) {
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentResourceByExternalPaymentTransactionID("id")
-		assert.Nil(t, paymentResource)
+		completed, err := mongoService.CompletePaymentResource(context.Background(), "ID", "", &paymentResource)
+
 		assert.NotNil(t, err)
-		assert.Equal(t, err.Error(), "error decoding key refunds: cannot decode document into []models.RefundResourceDB")
+		assert.False(t, completed)
 	})
 }
 
-func TestUnitCreateBulkRefundByExternalPaymentTransactionIDDriver(t *testing.T) {
+func TestUnitConsumeCallbackTokenDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, _, bulkRefunds, _ := setDriverUp()
+	mongoService, _, opts, _, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	mt.Run("CreateBulkRefundByExternalPaymentTransactionID runs with error on empty slice", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
-
+	mt.Run("ConsumeCallbackToken consumes the callback token of an in-progress payment", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		err := mongoService.CreateBulkRefund(map[string]models.BulkRefundDB{}, externalPaymentTransactionID)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		assert.Equal(t, err.Error(), "error bulk updating on mongo for bulk refund file [map[]]: must provide at least one element in input slice")
-	})
+		consumed, err := mongoService.ConsumeCallbackToken(context.Background(), "ID", "hash")
 
-	mt.Run("CreateBulkRefundByExternalPaymentTransactionID runs with slice successfully", func(mt *mtest.T) {
-		mt.AddMockResponses(bson.D{
-			{"ok", 1},
-			{"nModified", 0},
-		})
+		assert.Nil(t, err)
+		assert.True(t, consumed)
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "hash", statement.Lookup("q", callbackTokenHash).StringValue())
+		assert.Equal(t, "in-progress", statement.Lookup("q", paymentStatus).StringValue())
+		_, err = statement.Lookup("u", "$unset").Document().LookupErr(callbackTokenHash)
+		assert.Nil(t, err)
+	})
 
+	mt.Run("ConsumeCallbackToken leaves a payment whose callback token has been used", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		err := mongoService.CreateBulkRefund(bulkRefunds, externalPaymentTransactionID)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		consumed, err := mongoService.ConsumeCallbackToken(context.Background(), "ID", "hash")
 
 		assert.Nil(t, err)
+		assert.False(t, consumed)
 	})
 
+	mt.Run("ConsumeCallbackToken runs with error", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+
+		consumed, err := mongoService.ConsumeCallbackToken(context.Background(), "ID", "hash")
+
+		assert.NotNil(t, err)
+		assert.False(t, consumed)
+	})
 }
 
-func TestUnitGetIncompleteGovPayPaymentsDriver(t *testing.T) {
+func TestUnitReopenPaymentResourceDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, _, _, _ := setDriverUp()
+	mongoService, _, opts, paymentResource, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	cfg, _ := config.Get()
+	mt.Run("ReopenPaymentResource reopens a payment with one of the statuses", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-	mt.Run("GetIncompleteGovPayPayments runs successfully", func(mt *mtest.T) {
-		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", primitive.NewObjectID()},
-		})
+		reopen := models.PaymentResourceDB{Data: models.PaymentResourceDataDB{Status: "in-progress"}}
+		reopened, err := mongoService.ReopenPaymentResource(context.Background(), "ID", []string{"failed"}, &reopen)
 
-		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
-		mt.AddMockResponses(first, stopCursors)
+		assert.Nil(t, err)
+		assert.True(t, reopened)
 
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "failed", update.Lookup("q", "data.status", "$in").Array().Index(0).Value().StringValue())
+		_, err = update.Lookup("u", "$unset").Document().LookupErr("data.completed_at")
+		assert.Nil(t, err)
+	})
+
+	mt.Run("ReopenPaymentResource records the new attempt in the same update", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		payments, err := mongoService.GetIncompleteGovPayPayments(cfg)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		update := models.PaymentResourceDB{
+			Data:                    models.PaymentResourceDataDB{Status: "in-progress"},
+			ExternalPaymentAttempts: []models.ExternalPaymentAttemptDB{{ExternalPaymentStatusID: "external_id"}},
+		}
+		reopened, err := mongoService.ReopenPaymentResource(context.Background(), "ID", []string{"failed"}, &update)
 
 		assert.Nil(t, err)
-		assert.NotNil(t, payments)
+		assert.True(t, reopened)
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "in-progress", statement.Lookup("u", "$set", "data.status").StringValue())
+		attempt := statement.Lookup("u", "$push", externalPaymentAttempts, "$each").Array().Index(0).Value().Document()
+		assert.Equal(t, "external_id", attempt.Lookup("external_payment_status_id").StringValue())
 	})
 
-	mt.Run("GetIncompleteGovPayPayments runs with error on find", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+	mt.Run("ReopenPaymentResource keeps the completion time of an update which completes the payment", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		update := models.PaymentResourceDB{
+			Data: models.PaymentResourceDataDB{Status: "paid", CompletedAt: time.Now()},
+		}
+		reopened, err := mongoService.ReopenPaymentResource(context.Background(), "ID", []string{"failed"}, &update)
+
+		assert.Nil(t, err)
+		assert.True(t, reopened)
 
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, err = statement.Lookup("u").Document().LookupErr("$unset")
+		assert.NotNil(t, err)
+	})
+
+	mt.Run("ReopenPaymentResource keeps the completion time of an update which leaves the status as it is", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		_, err := mongoService.GetIncompleteGovPayPayments(cfg)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		assert.Equal(t, err.Error(), "(Name) Message")
+		update := models.PaymentResourceDB{
+			Data: models.PaymentResourceDataDB{PaymentMethod: "PayPal"},
+		}
+		reopened, err := mongoService.ReopenPaymentResource(context.Background(), "ID", []string{"failed"}, &update)
+
+		assert.Nil(t, err)
+		assert.True(t, reopened)
+
+		statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, err = statement.Lookup("u").Document().LookupErr("$unset")
+		assert.NotNil(t, err)
 	})
 
-	mt.Run("GetIncompleteGovPayPayments runs with error on unmarshal cursor", func(mt *mtest.T) {
-		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", primitive.NewObjectID()},
-		})
+	mt.Run("ReopenPaymentResource leaves a payment without one of the statuses", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
 
-		mt.AddMockResponses(first)
+		reopened, err := mongoService.ReopenPaymentResource(context.Background(), "ID", []string{"failed"}, &paymentResource)
+
+		assert.Nil(t, err)
+		assert.False(t, reopened)
+	})
 
+	mt.Run("ReopenPaymentResource runs with error", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		payments, err := mongoService.GetIncompleteGovPayPayments(cfg)
 
-		assert.Nil(t, payments)
+		reopened, err := mongoService.ReopenPaymentResource(context.Background(), "ID", []string{"failed"}, &paymentResource)
+
 		assert.NotNil(t, err)
-		assert.Equal(t, err.Error(), "no responses remaining")
+		assert.False(t, reopened)
 	})
 }
 
-func TestUnitGetPaymentsWithRefundStatusDriver(t *testing.T) {
+func TestUnitOverridePaymentResourceDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+	mongoService, _, opts, _, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	mt.Run("GetPaymentsWithRefundStatus runs successfully", func(mt *mtest.T) {
-		id1 := primitive.NewObjectID()
-		id2 := primitive.NewObjectID()
+	paymentUpdate := models.PaymentResourceDB{
+		Data:    models.PaymentResourceDataDB{Status: "paid"},
+		History: []models.PaymentHistoryDB{{Action: "paid-offline", Actor: "admin@companieshouse.gov.uk"}},
+	}
 
-		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", id1},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-		})
-		second := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.NextBatch, bson.D{
-			{"_id", id2},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-		})
+	mt.Run("OverridePaymentResource overrides a payment with one of the statuses", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
-		mt.AddMockResponses(first, second, stopCursors)
+		overridden, err := mongoService.OverridePaymentResource(context.Background(), "ID", []string{"in-progress"}, &paymentUpdate)
+
+		assert.Nil(t, err)
+		assert.True(t, overridden)
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "in-progress", update.Lookup("q", "data.status", "$in").Array().Index(0).Value().StringValue())
+		assert.Equal(t, "paid", update.Lookup("u", "$set", "data.status").StringValue())
+		history := update.Lookup("u", "$push", "history", "$each").Array().Index(0).Value().Document()
+		assert.Equal(t, "admin@companieshouse.gov.uk", history.Lookup("actor").StringValue())
+	})
 
+	mt.Run("OverridePaymentResource leaves a payment without one of the statuses", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		payments, err := mongoService.GetPaymentsWithRefundStatus()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		overridden, err := mongoService.OverridePaymentResource(context.Background(), "ID", []string{"in-progress"}, &paymentUpdate)
 
 		assert.Nil(t, err)
-		assert.NotNil(t, payments)
+		assert.False(t, overridden)
 	})
 
-	mt.Run("GetPractitionerResources runs with error on find", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
-
+	mt.Run("OverridePaymentResource runs with error", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		_, err := mongoService.GetPaymentsWithRefundStatus()
 
-		assert.Equal(t, err.Error(), "(Name) Message")
+		overridden, err := mongoService.OverridePaymentResource(context.Background(), "ID", []string{"in-progress"}, &paymentUpdate)
+
+		assert.NotNil(t, err)
+		assert.False(t, overridden)
 	})
+}
 
-	mt.Run("GetPractitionerResources runs with error on unmarshal cursor", func(mt *mtest.T) {
-		id1 := primitive.NewObjectID()
+func TestUnitRemovePrefilledCardholderDetailsDriver(t *testing.T) {
+	t.Parallel()
 
-		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", id1},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-		})
+	mongoService, _, opts, _, _, _ := setDriverUp()
 
-		mt.AddMockResponses(first)
+	mt := mtest.New(t, opts)
+	defer mt.Close()
 
+	mt.Run("RemovePrefilledCardholderDetails runs successfully", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		payments, err := mongoService.GetPaymentsWithRefundStatus()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		err := mongoService.RemovePrefilledCardholderDetails(context.Background(), "ID")
+
+		assert.Nil(t, err)
+	})
+
+	mt.Run("RemovePrefilledCardholderDetails runs with error", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+
+		err := mongoService.RemovePrefilledCardholderDetails(context.Background(), "ID")
 
-		assert.Nil(t, payments)
 		assert.NotNil(t, err)
-		assert.Equal(t, err.Error(), "no responses remaining")
 	})
 }
 
-func TestUnitGetPaymentsWithRefundPendingStatusDriver(t *testing.T) {
+func TestUnitPayerLinkDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+	mongoService, _, opts, _, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	mt.Run("GetPaymentsWithRefundPendingStatus runs successfully", func(mt *mtest.T) {
-		id1 := primitive.NewObjectID()
-		id2 := primitive.NewObjectID()
+	mt.Run("SetPayerLink runs successfully", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
 
-		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", id1},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-		})
-		second := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.NextBatch, bson.D{
-			{"_id", id2},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-		})
+		err := mongoService.SetPayerLink(context.Background(), "ID", &models.PayerLinkDB{ID: "link"})
 
-		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
-		mt.AddMockResponses(first, second, stopCursors)
+		assert.Nil(t, err)
+	})
+
+	mt.Run("SetPayerLink runs with error", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+
+		err := mongoService.SetPayerLink(context.Background(), "ID", &models.PayerLinkDB{ID: "link"})
+
+		assert.NotNil(t, err)
+	})
 
+	mt.Run("RevokePayerLink revokes the link", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		payments, err := mongoService.GetPaymentsWithRefundPendingStatus()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		revoked, err := mongoService.RevokePayerLink(context.Background(), "ID", "link", time.Now())
 
 		assert.Nil(t, err)
-		assert.NotNil(t, payments)
+		assert.True(t, revoked)
 	})
 
-	mt.Run("GetPaymentsWithRefundPendingStatus runs with error on find", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+	mt.Run("RevokePayerLink leaves a link that was replaced or already revoked", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		revoked, err := mongoService.RevokePayerLink(context.Background(), "ID", "link", time.Now())
+
+		assert.Nil(t, err)
+		assert.False(t, revoked)
+	})
 
+	mt.Run("RevokePayerLink runs with error", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		_, err := mongoService.GetPaymentsWithRefundStatus()
 
-		assert.Equal(t, err.Error(), "(Name) Message")
+		revoked, err := mongoService.RevokePayerLink(context.Background(), "ID", "link", time.Now())
+
+		assert.NotNil(t, err)
+		assert.False(t, revoked)
 	})
+}
 
-	mt.Run("GetPaymentsWithRefundPendingStatus runs with error on unmarshal cursor", func(mt *mtest.T) {
-		id1 := primitive.NewObjectID()
+func TestUnitExtendPaymentResourceDriver(t *testing.T) {
+	t.Parallel()
 
-		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
-			{"_id", id1},
-			{"redirect_uri", paymentResource.RedirectURI},
-			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-		})
+	mongoService, _, opts, _, _, _ := setDriverUp()
 
-		mt.AddMockResponses(first)
+	mt := mtest.New(t, opts)
+	defer mt.Close()
 
+	mt.Run("ExtendPaymentResource extends the session", func(mt *mtest.T) {
 		mongoService.db = mt.DB
-		payments, err := mongoService.GetPaymentsWithRefundPendingStatus()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		extended, err := mongoService.ExtendPaymentResource(context.Background(), "ID", []string{"in-progress"}, time.Now())
+
+		assert.Nil(t, err)
+		assert.True(t, extended)
+	})
+
+	mt.Run("ExtendPaymentResource leaves a session no longer in an extendable status", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		extended, err := mongoService.ExtendPaymentResource(context.Background(), "ID", []string{"in-progress"}, time.Now())
+
+		assert.Nil(t, err)
+		assert.False(t, extended)
+	})
+
+	mt.Run("ExtendPaymentResource runs with error", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+
+		extended, err := mongoService.ExtendPaymentResource(context.Background(), "ID", []string{"in-progress"}, time.Now())
 
-		assert.Nil(t, payments)
 		assert.NotNil(t, err)
-		assert.Equal(t, err.Error(), "no responses remaining")
+		assert.False(t, extended)
 	})
 }
 
-func TestUnitGetPaymentRefundsDriver(t *testing.T) {
+func TestUnitSetExternalPaymentAttemptOutcomeDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, paymentResource, _, refunds := setDriverUp()
+	mongoService, _, opts, _, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	mt.Run("GetPaymentRefunds successfully", func(mt *mtest.T) {
+	mt.Run("SetExternalPaymentAttemptOutcome records the outcome of an attempt", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		set, err := mongoService.SetExternalPaymentAttemptOutcome(context.Background(), "ID", "uri", "finished")
+
+		assert.Nil(t, err)
+		assert.True(t, set)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "uri", update.Lookup("q", "external_payment_attempts", "$elemMatch", "external_payment_status_url").StringValue())
+		assert.False(t, update.Lookup("q", "external_payment_attempts", "$elemMatch", "outcome", "$exists").Boolean())
+		assert.Equal(t, "finished", update.Lookup("u", "$set", "external_payment_attempts.$.outcome").StringValue())
+	})
+
+	mt.Run("SetExternalPaymentAttemptOutcome leaves an attempt whose outcome is already recorded", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		set, err := mongoService.SetExternalPaymentAttemptOutcome(context.Background(), "ID", "uri", "finished")
+
+		assert.Nil(t, err)
+		assert.False(t, set)
+	})
+
+	mt.Run("SetExternalPaymentAttemptOutcome runs with error", func(mt *mtest.T) {
+		mongoService.db = mt.DB
+
+		set, err := mongoService.SetExternalPaymentAttemptOutcome(context.Background(), "ID", "uri", "finished")
+
+		assert.NotNil(t, err)
+		assert.False(t, set)
+	})
+}
+
+func TestUnitGetPaymentResourceByProviderIDDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("GetPaymentResourceByProviderID successfully", func(mt *mtest.T) {
 		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
 			{"_id", paymentResource.ID},
 			{"redirect_uri", paymentResource.RedirectURI},
 			{"state", paymentResource.State},
-			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-			{"data", paymentResource.Data},
-			{"refunds", refunds},
-			{"bulk_refunds", []models.BulkRefundDB{}},
 		}))
 
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentRefunds("id")
+		paymentResource, err := mongoService.GetPaymentResourceByProviderID(context.Background(), "providerID")
 		assert.NotNil(t, paymentResource)
 		assert.Nil(t, err)
+		assert.Equal(t, paymentResource.ID, "ID")
+		assert.Equal(t, paymentResource.State, "State")
+		assert.Equal(t, paymentResource.RedirectURI, "RedirectURI")
 	})
 
-	mt.Run("GetPaymentRefunds with error findone", func(mt *mtest.T) {
+	mt.Run("GetPaymentResource with error findone", func(mt *mtest.T) {
 		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
 
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentRefunds("id")
+		paymentResource, err := mongoService.GetPaymentResourceByProviderID(context.Background(), "providerID")
 
 		assert.NotNil(t, err)
 		assert.Nil(t, paymentResource)
-		assert.Equal(t, err.Error(), "(Name) Message")
 	})
 
-	mt.Run("GetPaymentRefunds with decoding error", func(mt *mtest.T) {
+	mt.Run("GetPaymentResource with decoding error", func(mt *mtest.T) {
 		response := mtest.CreateCursorResponse(
 			1,
 			"models.PaymentResourceDB",
@@ -610,56 +753,51 @@ func TestUnitGetPaymentRefundsDriver(t *testing.T) {
 		mt.AddMockResponses(response)
 		mongoService.db = mt.DB
 
-		paymentResource, err := mongoService.GetPaymentRefunds("id")
+		paymentResource, err := mongoService.GetPaymentResourceByProviderID(context.Background(), "providerID")
 		assert.Nil(t, paymentResource)
 		assert.NotNil(t, err)
 		assert.Equal(t, err.Error(), "error decoding key refunds: cannot decode document into []models.RefundResourceDB")
 	})
 }
 
-func TestUnitPatchPaymentsWithRefundPendingStatusDriver(t *testing.T) {
+func TestUnitGetPaymentResourceByExternalPaymentTransactionIDDriver(t *testing.T) {
 	t.Parallel()
 
-	mongoService, commandError, opts, paymentResource, _, refunds := setDriverUp()
+	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
 
 	mt := mtest.New(t, opts)
 	defer mt.Close()
 
-	mt.Run("PatchPaymentsWithRefundPendingStatus runs successfully", func(mt *mtest.T) {
-		mt.AddMockResponses(bson.D{
-			{"ok", 1},
-			{"value", bson.D{
-				{"_id", paymentResource.ID},
-				{"redirect_uri", paymentResource.RedirectURI},
-				{"state", paymentResource.State},
-				{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
-				{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
-				{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
-				{"data", paymentResource.Data},
-				{"refunds", refunds},
-				{"bulk_refunds", []models.BulkRefundDB{}},
-			}},
-		})
+	mt.Run("GetPaymentResourceByExternalPaymentTransactionID successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", paymentResource.ID},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+		}))
 
 		mongoService.db = mt.DB
-		paymentRefunds, err := mongoService.PatchRefundSuccessStatus("id", true, &paymentResource)
 
+		paymentResource, err := mongoService.GetPaymentResourceByExternalPaymentTransactionID(context.Background(), "id")
+		assert.NotNil(t, paymentResource)
 		assert.Nil(t, err)
-		assert.NotNil(t, paymentRefunds)
+		assert.Equal(t, paymentResource.ID, "ID")
+		assert.Equal(t, paymentResource.State, "State")
+		assert.Equal(t, paymentResource.RedirectURI, "RedirectURI")
 	})
 
-	mt.Run("PatchPaymentsWithRefundPendingStatus runs with error on FindOneAndUpdate", func(mt *mtest.T) {
+	mt.Run("GetPaymentResource with error findone", func(mt *mtest.T) {
+
 		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
 
 		mongoService.db = mt.DB
-		paymentRefunds, err := mongoService.PatchRefundSuccessStatus("id", true, &paymentResource)
+
+		paymentResource, err := mongoService.GetPaymentResourceByExternalPaymentTransactionID(context.Background(), "id")
 
 		assert.NotNil(t, err)
-		assert.NotNil(t, paymentRefunds)
-		assert.Equal(t, err.Error(), "(Name) Message")
+		assert.Nil(t, paymentResource)
 	})
 
-	mt.Run("GetPaymentRefunds with decoding error", func(mt *mtest.T) {
+	mt.Run("GetPaymentResource with decoding error", func(mt *mtest.T) {
 		response := mtest.CreateCursorResponse(
 			1,
 			"models.PaymentResourceDB",
@@ -678,9 +816,1032 @@ func TestUnitPatchPaymentsWithRefundPendingStatusDriver(t *testing.T) {
 		mt.AddMockResponses(response)
 		mongoService.db = mt.DB
 
-		paymentRefunds, err := mongoService.PatchRefundSuccessStatus("id", true, &paymentResource)
-		assert.NotNil(t, paymentRefunds)
+		paymentResource, err := mongoService.GetPaymentResourceByExternalPaymentTransactionID(context.Background(), "id")
+		assert.Nil(t, paymentResource)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Error(), "error decoding key refunds: cannot decode document into []models.RefundResourceDB")
+	})
+}
+
+func TestUnitCreateBulkRefundByExternalPaymentTransactionIDDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, bulkRefunds, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("CreateBulkRefundByExternalPaymentTransactionID runs with error on empty slice", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+		err := mongoService.CreateBulkRefund(context.Background(), map[string]models.BulkRefundDB{}, externalPaymentTransactionID)
+
+		assert.Equal(t, err.Error(), "error bulk updating on mongo for bulk refund file [map[]]: must provide at least one element in input slice")
+	})
+
+	mt.Run("CreateBulkRefundByExternalPaymentTransactionID runs with slice successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{"ok", 1},
+			{"nModified", 0},
+		})
+
+		mongoService.db = mt.DB
+		err := mongoService.CreateBulkRefund(context.Background(), bulkRefunds, externalPaymentTransactionID)
+
+		assert.Nil(t, err)
+	})
+
+}
+
+func TestUnitGetPaymentResourcesByResourceDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	statuses := []string{"paid", "in-progress"}
+
+	mt.Run("GetPaymentResourcesByResource runs successfully", func(mt *mtest.T) {
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", "ID"},
+			{"data", bson.D{{"status", "paid"}}},
+		})
+
+		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
+		mt.AddMockResponses(first, stopCursors)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetPaymentResourcesByResource(context.Background(), "http://resource", statuses)
+
+		assert.Nil(t, err)
+		assert.Len(t, payments, 1)
+		assert.Equal(t, "ID", payments[0].ID)
+		assert.Equal(t, "paid", payments[0].Data.Status)
+	})
+
+	mt.Run("GetPaymentResourcesByResource runs with error on find", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetPaymentResourcesByResource(context.Background(), "http://resource", statuses)
+
+		assert.Nil(t, payments)
+		assert.Equal(t, err.Error(), "(Name) Message")
+	})
+}
+
+func TestUnitGetIncompleteGovPayPaymentsDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	cfg, _ := config.Get()
+
+	mt.Run("GetIncompleteGovPayPayments runs successfully", func(mt *mtest.T) {
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", primitive.NewObjectID()},
+		})
+
+		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
+		mt.AddMockResponses(first, stopCursors)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetIncompleteGovPayPayments(context.Background(), cfg)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, payments)
+	})
+
+	mt.Run("GetIncompleteGovPayPayments runs with error on find", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+		_, err := mongoService.GetIncompleteGovPayPayments(context.Background(), cfg)
+
+		assert.Equal(t, err.Error(), "(Name) Message")
+	})
+
+	mt.Run("GetIncompleteGovPayPayments runs with error on unmarshal cursor", func(mt *mtest.T) {
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", primitive.NewObjectID()},
+		})
+
+		mt.AddMockResponses(first)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetIncompleteGovPayPayments(context.Background(), cfg)
+
+		assert.Nil(t, payments)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Error(), "no responses remaining")
+	})
+}
+
+func TestUnitMessagesPendingDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("GetPaymentResourcesWithMessagesPending gets the payments with messages pending since before the time given", func(mt *mtest.T) {
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", "ID"},
+			{messagesPending, bson.A{""}},
+		})
+		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
+		mt.AddMockResponses(first, stopCursors)
+		mongoService.db = mt.DB
+
+		pendingBefore := time.Now()
+		payments, err := mongoService.GetPaymentResourcesWithMessagesPending(context.Background(), pendingBefore)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(payments))
+		assert.Equal(t, []string{""}, payments[0].MessagesPending)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.True(t, filter.Lookup(messagesPending+".0", "$exists").Boolean())
+		assert.Equal(t, pendingBefore.UnixMilli(), filter.Lookup(messagesPendingAt, "$lt").Time().UnixMilli())
+	})
+
+	mt.Run("GetPaymentResourcesWithMessagesPending with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		payments, err := mongoService.GetPaymentResourcesWithMessagesPending(context.Background(), time.Now())
+
+		assert.NotNil(t, err)
+		assert.Nil(t, payments)
+	})
+
+	mt.Run("RemoveMessagesPending removes the resources whose messages were sent", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		err := mongoService.RemoveMessagesPending(context.Background(), "ID", []string{"first"})
+
+		assert.Nil(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "first", update.Lookup("u", "$pullAll", messagesPending).Array().Index(0).Value().StringValue())
+	})
+
+	mt.Run("RemoveMessagesPending with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		err := mongoService.RemoveMessagesPending(context.Background(), "ID", []string{"first"})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestUnitGetPaymentsWithRefundStatusDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("GetPaymentsWithRefundStatus runs successfully", func(mt *mtest.T) {
+		id1 := primitive.NewObjectID()
+		id2 := primitive.NewObjectID()
+
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", id1},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+		})
+		second := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.NextBatch, bson.D{
+			{"_id", id2},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+		})
+
+		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
+		mt.AddMockResponses(first, second, stopCursors)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetPaymentsWithRefundStatus(context.Background())
+
+		assert.Nil(t, err)
+		assert.NotNil(t, payments)
+	})
+
+	mt.Run("GetPractitionerResources runs with error on find", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+		_, err := mongoService.GetPaymentsWithRefundStatus(context.Background())
+
+		assert.Equal(t, err.Error(), "(Name) Message")
+	})
+
+	mt.Run("GetPractitionerResources runs with error on unmarshal cursor", func(mt *mtest.T) {
+		id1 := primitive.NewObjectID()
+
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", id1},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+		})
+
+		mt.AddMockResponses(first)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetPaymentsWithRefundStatus(context.Background())
+
+		assert.Nil(t, payments)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Error(), "no responses remaining")
+	})
+}
+
+func TestUnitGetPaymentsWithRefundPendingStatusDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, paymentResource, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("GetPaymentsWithRefundPendingStatus runs successfully", func(mt *mtest.T) {
+		id1 := primitive.NewObjectID()
+		id2 := primitive.NewObjectID()
+
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", id1},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+		})
+		second := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.NextBatch, bson.D{
+			{"_id", id2},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+		})
+
+		stopCursors := mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.NextBatch)
+		mt.AddMockResponses(first, second, stopCursors)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetPaymentsWithRefundPendingStatus(context.Background())
+
+		assert.Nil(t, err)
+		assert.NotNil(t, payments)
+	})
+
+	mt.Run("GetPaymentsWithRefundPendingStatus runs with error on find", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+		_, err := mongoService.GetPaymentsWithRefundStatus(context.Background())
+
+		assert.Equal(t, err.Error(), "(Name) Message")
+	})
+
+	mt.Run("GetPaymentsWithRefundPendingStatus runs with error on unmarshal cursor", func(mt *mtest.T) {
+		id1 := primitive.NewObjectID()
+
+		first := mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", id1},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+		})
+
+		mt.AddMockResponses(first)
+
+		mongoService.db = mt.DB
+		payments, err := mongoService.GetPaymentsWithRefundPendingStatus(context.Background())
+
+		assert.Nil(t, payments)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Error(), "no responses remaining")
+	})
+}
+
+func TestUnitGetPaymentRefundsDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, paymentResource, _, refunds := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("GetPaymentRefunds successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", paymentResource.ID},
+			{"redirect_uri", paymentResource.RedirectURI},
+			{"state", paymentResource.State},
+			{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+			{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+			{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+			{"data", paymentResource.Data},
+			{"refunds", refunds},
+			{"bulk_refunds", []models.BulkRefundDB{}},
+		}))
+
+		mongoService.db = mt.DB
+
+		paymentResource, err := mongoService.GetPaymentRefunds(context.Background(), "id")
+		assert.NotNil(t, paymentResource)
+		assert.Nil(t, err)
+	})
+
+	mt.Run("GetPaymentRefunds with error findone", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+
+		paymentResource, err := mongoService.GetPaymentRefunds(context.Background(), "id")
+
+		assert.NotNil(t, err)
+		assert.Nil(t, paymentResource)
+		assert.Equal(t, err.Error(), "(Name) Message")
+	})
+
+	mt.Run("GetPaymentRefunds with decoding error", func(mt *mtest.T) {
+		response := mtest.CreateCursorResponse(
+			1,
+			"models.PaymentResourceDB",
+			mtest.FirstBatch, bson.D{
+				{"_id", paymentResource.ID},
+				{"redirect_uri", paymentResource.RedirectURI},
+				{"state", paymentResource.State},
+				{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+				{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+				{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+				{"data", paymentResource.Data},
+				{"refunds", models.RefundResourceDB{}},
+				{"bulk_refunds", models.BulkRefundDB{}},
+			})
+
+		mt.AddMockResponses(response)
+		mongoService.db = mt.DB
+
+		paymentResource, err := mongoService.GetPaymentRefunds(context.Background(), "id")
+		assert.Nil(t, paymentResource)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Error(), "error decoding key refunds: cannot decode document into []models.RefundResourceDB")
+	})
+}
+
+func TestUnitPatchPaymentsWithRefundPendingStatusDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, paymentResource, _, refunds := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("PatchPaymentsWithRefundPendingStatus runs successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{"ok", 1},
+			{"value", bson.D{
+				{"_id", paymentResource.ID},
+				{"redirect_uri", paymentResource.RedirectURI},
+				{"state", paymentResource.State},
+				{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+				{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+				{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+				{"data", paymentResource.Data},
+				{"refunds", refunds},
+				{"bulk_refunds", []models.BulkRefundDB{}},
+			}},
+		})
+
+		mongoService.db = mt.DB
+		paymentRefunds, err := mongoService.PatchRefundSuccessStatus(context.Background(), "id", true, &paymentResource)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, paymentRefunds)
+	})
+
+	mt.Run("PatchPaymentsWithRefundPendingStatus runs with error on FindOneAndUpdate", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+
+		mongoService.db = mt.DB
+		paymentRefunds, err := mongoService.PatchRefundSuccessStatus(context.Background(), "id", true, &paymentResource)
+
+		assert.NotNil(t, err)
+		assert.NotNil(t, paymentRefunds)
+		assert.Equal(t, err.Error(), "(Name) Message")
+	})
+
+	mt.Run("GetPaymentRefunds with decoding error", func(mt *mtest.T) {
+		response := mtest.CreateCursorResponse(
+			1,
+			"models.PaymentResourceDB",
+			mtest.FirstBatch, bson.D{
+				{"_id", paymentResource.ID},
+				{"redirect_uri", paymentResource.RedirectURI},
+				{"state", paymentResource.State},
+				{"external_payment_status_url", paymentResource.ExternalPaymentStatusURI},
+				{"external_payment_status_id", paymentResource.ExternalPaymentStatusID},
+				{"external_payment_transaction_id", paymentResource.ExternalPaymentTransactionID},
+				{"data", paymentResource.Data},
+				{"refunds", models.RefundResourceDB{}},
+				{"bulk_refunds", models.BulkRefundDB{}},
+			})
+
+		mt.AddMockResponses(response)
+		mongoService.db = mt.DB
+
+		paymentRefunds, err := mongoService.PatchRefundSuccessStatus(context.Background(), "id", true, &paymentResource)
+		assert.NotNil(t, paymentRefunds)
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Error(), "mongo: no documents in result")
+	})
+}
+
+func TestUnitPaymentRequestDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("CreatePaymentRequest runs successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		mongoService.db = mt.DB
+
+		err := mongoService.CreatePaymentRequest(context.Background(), &models.PaymentRequestDB{ID: "ID"})
+
+		assert.Nil(t, err)
+	})
+
+	mt.Run("CreatePaymentRequest runs with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		err := mongoService.CreatePaymentRequest(context.Background(), &models.PaymentRequestDB{ID: "ID"})
+
+		assert.NotNil(t, err)
+	})
+
+	mt.Run("GetPaymentRequest successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentRequestDB", mtest.FirstBatch, bson.D{
+			{"_id", "ID"},
+			{"amount", "25.00"},
+		}))
+		mongoService.db = mt.DB
+
+		paymentRequest, err := mongoService.GetPaymentRequest(context.Background(), "ID")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "ID", paymentRequest.ID)
+		assert.Equal(t, "25.00", paymentRequest.Amount)
+	})
+
+	mt.Run("GetPaymentRequest not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.PaymentRequestDB", mtest.FirstBatch))
+		mongoService.db = mt.DB
+
+		paymentRequest, err := mongoService.GetPaymentRequest(context.Background(), "ID")
+
+		assert.Nil(t, err)
+		assert.Nil(t, paymentRequest)
+	})
+
+	mt.Run("GetPaymentRequest with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		paymentRequest, err := mongoService.GetPaymentRequest(context.Background(), "ID")
+
+		assert.NotNil(t, err)
+		assert.Nil(t, paymentRequest)
+	})
+}
+
+func TestUnitAccountDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("CreateAccount runs successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		mongoService.db = mt.DB
+
+		err := mongoService.CreateAccount(context.Background(), &models.AccountDB{ID: "ID"})
+
+		assert.Nil(t, err)
+	})
+
+	mt.Run("GetAccountByUserIDs successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.AccountDB", mtest.FirstBatch, bson.D{
+			{"_id", "ID"},
+			{"balance", 5000},
+		}))
+		mongoService.db = mt.DB
+
+		account, err := mongoService.GetAccountByUserIDs(context.Background(), []string{"user"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, "ID", account.ID)
+		assert.Equal(t, 5000, account.Balance)
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		assert.Equal(t, "user", filter.Document().Lookup("user_ids", "$in").Array().Index(0).Value().StringValue())
+	})
+
+	mt.Run("GetAccount not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.AccountDB", mtest.FirstBatch))
+		mongoService.db = mt.DB
+
+		account, err := mongoService.GetAccount(context.Background(), "ID")
+
+		assert.Nil(t, err)
+		assert.Nil(t, account)
+	})
+
+	mt.Run("GetAccount with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		account, err := mongoService.GetAccount(context.Background(), "ID")
+
+		assert.NotNil(t, err)
+		assert.Nil(t, account)
+	})
+
+	mt.Run("UpdateAccountStatus updates an account", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		updated, err := mongoService.UpdateAccountStatus(context.Background(), "ID", "suspended")
+
+		assert.Nil(t, err)
+		assert.True(t, updated)
+	})
+
+	mt.Run("UpdateAccountStatus doesn't find an account", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		mongoService.db = mt.DB
+
+		updated, err := mongoService.UpdateAccountStatus(context.Background(), "ID", "suspended")
+
+		assert.Nil(t, err)
+		assert.False(t, updated)
+	})
+
+	mt.Run("DebitAccount debits an active account with enough balance and records the entry", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"value", bson.D{{"_id", "ID"}, {"balance", 4000}}}},
+			mtest.CreateSuccessResponse(),
+		)
+		mongoService.db = mt.DB
+
+		entry := models.AccountLedgerEntryDB{ID: "entry", AccountID: "ID", Amount: -1000}
+		debited, err := mongoService.DebitAccount(context.Background(), &entry, "active")
+
+		assert.Nil(t, err)
+		assert.True(t, debited)
+		assert.Equal(t, 4000, entry.Balance)
+
+		update := mt.GetStartedEvent().Command
+		assert.Equal(t, "active", update.Lookup("query", "status").StringValue())
+		assert.Equal(t, int64(1000), update.Lookup("query", "balance", "$gte").AsInt64())
+		assert.Equal(t, int64(-1000), update.Lookup("update", "$inc", "balance").AsInt64())
+		insert := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(4000), insert.Lookup("balance").AsInt64())
+	})
+
+	mt.Run("DebitAccount doesn't debit an account without enough balance", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"value", nil}})
+		mongoService.db = mt.DB
+
+		debited, err := mongoService.DebitAccount(context.Background(), &models.AccountLedgerEntryDB{AccountID: "ID", Amount: -1000}, "active")
+
+		assert.Nil(t, err)
+		assert.False(t, debited)
+	})
+
+	mt.Run("DebitAccount reverses the debit if the entry can't be recorded", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"value", bson.D{{"_id", "ID"}, {"balance", 4000}}}},
+			mtest.CreateCommandErrorResponse(commandError),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		mongoService.db = mt.DB
+
+		debited, err := mongoService.DebitAccount(context.Background(), &models.AccountLedgerEntryDB{AccountID: "ID", Amount: -1000}, "active")
+
+		assert.NotNil(t, err)
+		assert.False(t, debited)
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		reversal := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, int64(1000), reversal.Lookup("u", "$inc", "balance").AsInt64())
+	})
+
+	mt.Run("CreditAccount credits an account whatever its status", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"value", bson.D{{"_id", "ID"}, {"balance", 6000}}}},
+			mtest.CreateSuccessResponse(),
+		)
+		mongoService.db = mt.DB
+
+		entry := models.AccountLedgerEntryDB{AccountID: "ID", Amount: 1000}
+		credited, err := mongoService.CreditAccount(context.Background(), &entry)
+
+		assert.Nil(t, err)
+		assert.True(t, credited)
+		assert.Equal(t, 6000, entry.Balance)
+		_, err = mt.GetStartedEvent().Command.Lookup("query").Document().LookupErr("status")
+		assert.NotNil(t, err)
+	})
+
+	mt.Run("GetAccountLedgerEntry successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.AccountLedgerEntryDB", mtest.FirstBatch, bson.D{
+			{"_id", "entry"},
+			{"account_id", "ID"},
+		}))
+		mongoService.db = mt.DB
+
+		entry, err := mongoService.GetAccountLedgerEntry(context.Background(), "entry")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "ID", entry.AccountID)
+	})
+
+	mt.Run("GetAccountLedgerEntriesForPayment gets the entries made for the payment", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.AccountLedgerEntryDB", mtest.FirstBatch,
+			bson.D{{"_id", "debit"}, {"type", "payment"}, {"payment_id", "1234"}},
+			bson.D{{"_id", "reversal"}, {"type", "reversal"}, {"payment_id", "1234"}},
+		))
+		mongoService.db = mt.DB
+
+		entries, err := mongoService.GetAccountLedgerEntriesForPayment(context.Background(), "1234")
+
+		assert.Nil(t, err)
+		assert.Len(t, entries, 2)
+		command := mt.GetStartedEvent().Command
+		assert.Equal(t, "1234", command.Lookup("filter", "payment_id").StringValue())
+		assert.Equal(t, int32(1), command.Lookup("sort", "created_at").Int32())
+	})
+
+	mt.Run("GetAccountLedgerEntriesForPayment error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		entries, err := mongoService.GetAccountLedgerEntriesForPayment(context.Background(), "1234")
+
+		assert.NotNil(t, err)
+		assert.Nil(t, entries)
+	})
+
+	mt.Run("AddAccountLedgerEntryRefund adds the refund while the total stays within the amount debited", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		added, err := mongoService.AddAccountLedgerEntryRefund(context.Background(), &models.AccountLedgerEntryDB{ID: "debit", Amount: -1000}, 400)
+
+		assert.Nil(t, err)
+		assert.True(t, added)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "debit", update.Lookup("q", "_id").StringValue())
+		assert.Equal(t, int64(600), update.Lookup("q", "refunded", "$not", "$gt").AsInt64())
+		assert.Equal(t, int64(400), update.Lookup("u", "$inc", "refunded").AsInt64())
+	})
+
+	mt.Run("AddAccountLedgerEntryRefund doesn't add a refund taking the total over the amount debited", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		mongoService.db = mt.DB
+
+		added, err := mongoService.AddAccountLedgerEntryRefund(context.Background(), &models.AccountLedgerEntryDB{ID: "debit", Amount: -1000}, 400)
+
+		assert.Nil(t, err)
+		assert.False(t, added)
+	})
+
+	mt.Run("AddAccountLedgerEntryRefund error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		added, err := mongoService.AddAccountLedgerEntryRefund(context.Background(), &models.AccountLedgerEntryDB{ID: "debit", Amount: -1000}, 400)
+
+		assert.NotNil(t, err)
+		assert.False(t, added)
+	})
+
+	mt.Run("SettleAccountLedgerEntry settles a pending debit", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		err := mongoService.SettleAccountLedgerEntry(context.Background(), "debit")
+
+		assert.Nil(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "debit", update.Lookup("q", "_id").StringValue())
+		_, err = update.Lookup("u", "$unset").Document().LookupErr("pending")
+		assert.Nil(t, err)
+	})
+
+	mt.Run("SettleAccountLedgerEntry error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		err := mongoService.SettleAccountLedgerEntry(context.Background(), "debit")
+
+		assert.NotNil(t, err)
+	})
+
+	mt.Run("GetPendingAccountLedgerEntries gets the debits still pending", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.AccountLedgerEntryDB", mtest.FirstBatch,
+			bson.D{{"_id", "debit"}, {"type", "payment"}, {"payment_id", "1234"}, {"pending", true}},
+		))
+		mongoService.db = mt.DB
+
+		before := time.Now()
+		entries, err := mongoService.GetPendingAccountLedgerEntries(context.Background(), before)
+
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+		assert.True(t, entries[0].Pending)
+		command := mt.GetStartedEvent().Command
+		assert.True(t, command.Lookup("filter", "pending").Boolean())
+		assert.Equal(t, before.UnixMilli(), command.Lookup("filter", "created_at", "$lt").Time().UnixMilli())
+	})
+
+	mt.Run("GetPendingAccountLedgerEntries error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		entries, err := mongoService.GetPendingAccountLedgerEntries(context.Background(), time.Now())
+
+		assert.NotNil(t, err)
+		assert.Nil(t, entries)
+	})
+
+	mt.Run("GetAccountLedgerEntries gets the entries for the period", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.AccountLedgerEntryDB", mtest.FirstBatch, bson.D{
+			{"_id", "entry"},
+			{"account_id", "ID"},
+		}))
+		mongoService.db = mt.DB
+
+		from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		entries, err := mongoService.GetAccountLedgerEntries(context.Background(), "ID", from, time.Time{})
+
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(t, from.UnixMilli(), filter.Lookup("created_at", "$gte").Time().UnixMilli())
+		_, err = filter.Lookup("created_at").Document().LookupErr("$lt")
+		assert.NotNil(t, err)
+	})
+
+	mt.Run("GetAccountLedgerEntries with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		entries, err := mongoService.GetAccountLedgerEntries(context.Background(), "ID", time.Time{}, time.Time{})
+
+		assert.NotNil(t, err)
+		assert.Nil(t, entries)
+	})
+}
+
+func TestUnitBankTransferDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("GetPaymentResourceByRemittanceReference successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models.PaymentResourceDB", mtest.FirstBatch, bson.D{
+			{"_id", "ID"},
+			{"bank_transfer", bson.D{{"reference", "CHABCDEFGHJK"}}},
+		}))
+		mongoService.db = mt.DB
+
+		paymentResource, err := mongoService.GetPaymentResourceByRemittanceReference(context.Background(), "CHABCDEFGHJK")
+
+		assert.Nil(t, err)
+		assert.Equal(t, "ID", paymentResource.ID)
+		assert.Equal(t, "CHABCDEFGHJK", paymentResource.BankTransfer.Reference)
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		assert.Equal(t, "CHABCDEFGHJK", filter.Document().Lookup("bank_transfer.reference").StringValue())
+	})
+
+	mt.Run("GetPaymentResourceByRemittanceReference not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.PaymentResourceDB", mtest.FirstBatch))
+		mongoService.db = mt.DB
+
+		paymentResource, err := mongoService.GetPaymentResourceByRemittanceReference(context.Background(), "CHABCDEFGHJK")
+
+		assert.Nil(t, err)
+		assert.Nil(t, paymentResource)
+	})
+
+	mt.Run("ReconcileBankTransfer updates a session whose etag hasn't changed", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		paymentUpdate := models.PaymentResourceDB{
+			Data:         models.PaymentResourceDataDB{Status: "paid", Etag: "new"},
+			BankTransfer: &models.BankTransferDB{Reference: "CHABCDEFGHJK", AmountReceived: "10.00"},
+			History:      []models.PaymentHistoryDB{{Action: "bank-transfer"}},
+		}
+		reconciled, err := mongoService.ReconcileBankTransfer(context.Background(), "ID", "old", &paymentUpdate)
+
+		assert.Nil(t, err)
+		assert.True(t, reconciled)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "old", update.Lookup("q", "data.etag").StringValue())
+		assert.Equal(t, "new", update.Lookup("u", "$set", "data.etag").StringValue())
+		assert.Equal(t, "10.00", update.Lookup("u", "$set", "bank_transfer", "amount_received").StringValue())
+		assert.Equal(t, "bank-transfer", update.Lookup("u", "$push", "history", "$each").Array().Index(0).Value().Document().Lookup("action").StringValue())
+	})
+
+	mt.Run("ReconcileBankTransfer doesn't update a session whose etag has changed", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+		mongoService.db = mt.DB
+
+		reconciled, err := mongoService.ReconcileBankTransfer(context.Background(), "ID", "old", &models.PaymentResourceDB{})
+
+		assert.Nil(t, err)
+		assert.False(t, reconciled)
+	})
+
+	mt.Run("CreateBankCredit writes a new credit", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		mongoService.db = mt.DB
+
+		created, err := mongoService.CreateBankCredit(context.Background(), &models.BankCreditDB{ID: "credit"})
+
+		assert.Nil(t, err)
+		assert.True(t, created)
+	})
+
+	mt.Run("CreateBankCredit doesn't write a credit already imported", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}))
+		mongoService.db = mt.DB
+
+		created, err := mongoService.CreateBankCredit(context.Background(), &models.BankCreditDB{ID: "credit"})
+
+		assert.Nil(t, err)
+		assert.False(t, created)
+	})
+
+	mt.Run("CreateBankCredit with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		created, err := mongoService.CreateBankCredit(context.Background(), &models.BankCreditDB{ID: "credit"})
+
+		assert.NotNil(t, err)
+		assert.False(t, created)
+	})
+
+	mt.Run("UpdateBankCredit records the outcome", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		err := mongoService.UpdateBankCredit(context.Background(), &models.BankCreditDB{ID: "credit", Outcome: "paid", PaymentID: "ID"})
+
+		assert.Nil(t, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "paid", update.Lookup("u", "$set", "outcome").StringValue())
+	})
+
+	mt.Run("GetBankCredits successfully", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "models.BankCreditDB", mtest.FirstBatch, bson.D{
+			{"_id", "credit"},
+			{"outcome", "unmatched"},
+		}))
+		mongoService.db = mt.DB
+
+		from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		credits, err := mongoService.GetBankCredits(context.Background(), []string{"unmatched"}, from, time.Time{})
+
+		assert.Nil(t, err)
+		assert.Len(t, credits, 1)
+		assert.Equal(t, "unmatched", credits[0].Outcome)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(t, "unmatched", filter.Lookup("outcome", "$in").Array().Index(0).Value().StringValue())
+		assert.Equal(t, from.UnixMilli(), filter.Lookup("booked_at", "$gte").Time().UnixMilli())
+		_, err = filter.Lookup("booked_at").Document().LookupErr("$lt")
+		assert.NotNil(t, err)
+	})
+
+	mt.Run("GetBankCredits with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		credits, err := mongoService.GetBankCredits(context.Background(), []string{"unmatched"}, time.Time{}, time.Time{})
+
+		assert.NotNil(t, err)
+		assert.Nil(t, credits)
+	})
+}
+
+func TestUnitResourceClaimDriver(t *testing.T) {
+	t.Parallel()
+
+	mongoService, commandError, opts, _, _, _ := setDriverUp()
+
+	mt := mtest.New(t, opts)
+	defer mt.Close()
+
+	mt.Run("ClaimResource claims a resource until it expires", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		expiresAt := time.Now().Add(time.Hour)
+		claimed, err := mongoService.ClaimResource(context.Background(), "resource", "ID", expiresAt)
+
+		assert.Nil(t, err)
+		assert.True(t, claimed)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(t, update.Lookup("upsert").Boolean())
+		assert.Equal(t, "resource", update.Lookup("q", "_id").StringValue())
+		assert.Equal(t, "ID", update.Lookup("u", "$set", "payment_id").StringValue())
+		assert.Equal(t, expiresAt.UnixMilli(), update.Lookup("u", "$set", "expires_at").Time().UnixMilli())
+	})
+
+	mt.Run("ClaimResource claims a resource indefinitely", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mongoService.db = mt.DB
+
+		claimed, err := mongoService.ClaimResource(context.Background(), "resource", "ID", time.Time{})
+
+		assert.Nil(t, err)
+		assert.True(t, claimed)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, err = update.Lookup("u", "$unset").Document().LookupErr("expires_at")
+		assert.Nil(t, err)
+	})
+
+	mt.Run("ClaimResource doesn't claim a resource claimed by another session", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}))
+		mongoService.db = mt.DB
+
+		claimed, err := mongoService.ClaimResource(context.Background(), "resource", "ID", time.Time{})
+
+		assert.Nil(t, err)
+		assert.False(t, claimed)
+	})
+
+	mt.Run("ClaimResource with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		claimed, err := mongoService.ClaimResource(context.Background(), "resource", "ID", time.Time{})
+
+		assert.NotNil(t, err)
+		assert.False(t, claimed)
+	})
+
+	mt.Run("ReleaseResource releases the session's claim", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		mongoService.db = mt.DB
+
+		err := mongoService.ReleaseResource(context.Background(), "resource", "ID")
+
+		assert.Nil(t, err)
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(t, "resource", filter.Lookup("_id").StringValue())
+		assert.Equal(t, "ID", filter.Lookup("payment_id").StringValue())
+	})
+
+	mt.Run("ReleaseResource with error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(commandError))
+		mongoService.db = mt.DB
+
+		err := mongoService.ReleaseResource(context.Background(), "resource", "ID")
+
 		assert.NotNil(t, err)
-		assert.Equal(t, err.Error(), "mongo: no documents in result")
 	})
 }
@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -18,7 +19,7 @@ func TestUnitCreatePaymentResource(t *testing.T) {
 		dao := NewDAO(cfg)
 
 		resource := models.PaymentResourceDB{}
-		err := dao.CreatePaymentResource(&resource)
+		err := dao.CreatePaymentResource(context.Background(), &resource)
 		So(err.Error(), ShouldEqual, "the Insert operation must have a Deployment set before Execute can be called")
 	})
 }
@@ -29,7 +30,7 @@ func TestUnitGetPaymentResource(t *testing.T) {
 		client = &mongo.Client{}
 		dao := NewDAO(cfg)
 
-		resource, err := dao.GetPaymentResource("id123")
+		resource, err := dao.GetPaymentResource(context.Background(), "id123")
 		So(resource, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "the Find operation must have a Deployment set before Execute can be called")
 	})
@@ -55,7 +56,7 @@ func TestUnitPatchPaymentResource(t *testing.T) {
 			Refunds:                      []models.RefundResourceDB{},
 			BulkRefund:                   []models.BulkRefundDB{{}},
 		}
-		err := dao.PatchPaymentResource("id123", &resource)
+		err := dao.PatchPaymentResource(context.Background(), "id123", &resource)
 		So(err.Error(), ShouldEqual, "the Update operation must have a Deployment set before Execute can be called")
 	})
 }
@@ -66,7 +67,7 @@ func TestUnitGetPaymentResourceByExternalPaymentStatusID(t *testing.T) {
 		client = &mongo.Client{}
 		dao := NewDAO(cfg)
 
-		resource, err := dao.GetPaymentResourceByProviderID("id123")
+		resource, err := dao.GetPaymentResourceByProviderID(context.Background(), "id123")
 		So(resource, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "the Find operation must have a Deployment set before Execute can be called")
 	})
@@ -78,7 +79,7 @@ func TestUnitGetPaymentsWithRefundStatus(t *testing.T) {
 		client = &mongo.Client{}
 		dao := NewDAO(cfg)
 
-		_, err := dao.GetPaymentsWithRefundStatus()
+		_, err := dao.GetPaymentsWithRefundStatus(context.Background())
 		So(err.Error(), ShouldEqual, "the Find operation must have a Deployment set before Execute can be called")
 	})
 }
@@ -89,7 +90,7 @@ func TestUnitGetPaymentsWithRefundPendingStatus(t *testing.T) {
 		client = &mongo.Client{}
 		dao := NewDAO(cfg)
 
-		_, err := dao.GetPaymentsWithRefundPendingStatus()
+		_, err := dao.GetPaymentsWithRefundPendingStatus(context.Background())
 		So(err.Error(), ShouldEqual, "the Find operation must have a Deployment set before Execute can be called")
 	})
 }
@@ -121,7 +122,7 @@ func TestUnitPatchPaymentsWithRefundPendingStatus(t *testing.T) {
 			ExternalPaymentTransactionID: "id456",
 			Refunds:                      refundDatas,
 		}
-		_, err := dao.PatchRefundSuccessStatus("id123", true, &resource)
+		_, err := dao.PatchRefundSuccessStatus(context.Background(), "id123", true, &resource)
 		So(err.Error(), ShouldEqual, "the FindAndModify operation must have a Deployment set before Execute can be called")
 	})
 }
@@ -132,7 +133,7 @@ func TestUnitGetPaymentRefunds(t *testing.T) {
 		client = &mongo.Client{}
 		dao := NewDAO(cfg)
 
-		resource, err := dao.GetPaymentRefunds("id123")
+		resource, err := dao.GetPaymentRefunds(context.Background(), "id123")
 		So(resource, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "the Find operation must have a Deployment set before Execute can be called")
 	})
@@ -165,7 +166,7 @@ func TestUnitIncrementRefundAttempts(t *testing.T) {
 			ExternalPaymentTransactionID: "id456",
 			Refunds:                      refundDatas,
 		}
-		err := dao.IncrementRefundAttempts("id123", &resource)
+		err := dao.IncrementRefundAttempts(context.Background(), "id123", &resource)
 		So(err.Error(), ShouldEqual, "the FindAndModify operation must have a Deployment set before Execute can be called")
 	})
 }
@@ -0,0 +1,50 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingMonitor starts a span for every command sent to MongoDB, as a child of the context the operation was
+// called with, and ends it when the command succeeds or fails
+type tracingMonitor struct {
+	spans sync.Map
+}
+
+func newTracingMonitor() *event.CommandMonitor {
+	m := &tracingMonitor{}
+	return &event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+}
+
+func (m *tracingMonitor) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	_, span := tracing.StartSpan(ctx, "mongo."+evt.CommandName,
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.namespace", evt.DatabaseName),
+		attribute.String("db.operation.name", evt.CommandName),
+	)
+	m.spans.Store(evt.RequestID, span)
+}
+
+func (m *tracingMonitor) succeeded(_ context.Context, evt *event.CommandSucceededEvent) {
+	m.end(evt.RequestID, nil)
+}
+
+func (m *tracingMonitor) failed(_ context.Context, evt *event.CommandFailedEvent) {
+	m.end(evt.RequestID, errors.New(evt.Failure))
+}
+
+func (m *tracingMonitor) end(requestID int64, err error) {
+	if span, ok := m.spans.LoadAndDelete(requestID); ok {
+		tracing.EndSpan(span.(trace.Span), err)
+	}
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/gorilla/mux"
+)
+
+// statementDateFormat is the format of the from and to dates given when retrieving an account statement
+const statementDateFormat = "2006-01-02"
+
+// HandleCreateAccount opens a credit account for presenters to pay from
+func HandleCreateAccount(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var incomingAccount models.IncomingAccount
+	err := json.NewDecoder(req.Body).Decode(&incomingAccount)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The email of the admin opening the account, put there by AdminRoleIntercept
+	userID, ok := req.Context().Value(helpers.ContextKeyUserID).(string)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("error user details not found in context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	account, responseType, err := paymentService.CreateAccount(req, incomingAccount, userID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error creating account: [%v]", err), log.Data{"service_response_type": responseType.String()})
+		writeAccountError(w, responseType, err)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+	w.Header().Set("Location", account.Links.Self)
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(account)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleGetAccount retrieves a credit account, including its current balance
+func HandleGetAccount(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["account_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("account id not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	account, responseType, err := paymentService.GetAccount(req, id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting account: [%v]", err), log.Data{"account_id": id, "service_response_type": responseType.String()})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if responseType == service.NotFound {
+		log.ErrorR(req, fmt.Errorf("account not found. id: %s", id))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeAccountResponse(w, req, account)
+}
+
+// HandleUpdateAccountStatus changes the status of a credit account, e.g. suspending it so that it can't be paid from
+func HandleUpdateAccountStatus(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["account_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("account id not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var incomingAccountStatus models.IncomingAccountStatus
+	err := json.NewDecoder(req.Body).Decode(&incomingAccountStatus)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := req.Context().Value(helpers.ContextKeyUserID).(string)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("error user details not found in context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	account, responseType, err := paymentService.UpdateAccountStatus(req, id, incomingAccountStatus, userID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error updating account status: [%v]", err), log.Data{"account_id": id, "service_response_type": responseType.String()})
+		writeAccountError(w, responseType, err)
+		return
+	}
+	if responseType == service.NotFound {
+		log.ErrorR(req, fmt.Errorf("account not found. id: %s", id))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeAccountResponse(w, req, account)
+}
+
+// HandleTopUpAccount credits funds received from a presenter to their credit account
+func HandleTopUpAccount(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["account_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("account id not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var incomingTopUp models.IncomingAccountTopUp
+	err := json.NewDecoder(req.Body).Decode(&incomingTopUp)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := req.Context().Value(helpers.ContextKeyUserID).(string)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("error user details not found in context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	entry, responseType, err := paymentService.TopUpAccount(req, id, incomingTopUp, userID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error topping up account: [%v]", err), log.Data{"account_id": id, "service_response_type": responseType.String()})
+		writeAccountError(w, responseType, err)
+		return
+	}
+	if responseType == service.NotFound {
+		log.ErrorR(req, fmt.Errorf("account not found. id: %s", id))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(entry)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleGetAccountStatement retrieves the balance of a credit account and the entries made to it, optionally limited
+// to those made on or after the from date and on or before the to date
+func HandleGetAccountStatement(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["account_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("account id not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if value := req.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(statementDateFormat, value)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("invalid from date: [%v]", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if value := req.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(statementDateFormat, value)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("invalid to date: [%v]", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// The to date is inclusive, so the statement runs up to the start of the following day
+		to = to.AddDate(0, 0, 1)
+	}
+
+	statement, responseType, err := paymentService.GetAccountStatement(req, id, from, to)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting account statement: [%v]", err), log.Data{"account_id": id, "service_response_type": responseType.String()})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if responseType == service.NotFound {
+		log.ErrorR(req, fmt.Errorf("account not found. id: %s", id))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(statement)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleProcessPendingAccountDebits settles the debits from credit accounts left pending by payment journeys which
+// stopped before completing their session, reversing any the session wasn't completed with
+func HandleProcessPendingAccountDebits(w http.ResponseWriter, req *http.Request) {
+	log.InfoR(req, "received request to process pending account debits")
+
+	settledDebits, err := externalPaymentService.AccountService.ReconcilePendingDebits(req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(settledDebits)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.InfoR(req, "finished processing pending account debits", log.Data{"settled": len(settledDebits)})
+}
+
+func writeAccountResponse(w http.ResponseWriter, req *http.Request, account *models.AccountRest) {
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err := json.NewEncoder(w).Encode(account)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+func writeAccountError(w http.ResponseWriter, responseType service.ResponseType, err error) {
+	switch responseType {
+	case service.InvalidData:
+		w.Header().Set(contentType, applicationJsonResponseType)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+	case service.Conflict:
+		w.Header().Set(contentType, applicationJsonResponseType)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newAccountRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"account_id": "acc"})
+	return req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyUserID, "admin@companieshouse.gov.uk"))
+}
+
+func TestUnitHandleCreateAccount(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	body := `{"name":"Agent Ltd","user_ids":["user1"]}`
+
+	Convey("Request body invalid", t, func() {
+		w := httptest.NewRecorder()
+		HandleCreateAccount(w, newAccountRequest("POST", "/test", "{"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("User not in context", t, func() {
+		w := httptest.NewRecorder()
+		HandleCreateAccount(w, httptest.NewRequest("POST", "/test", strings.NewReader(body)))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Invalid account", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleCreateAccount(w, newAccountRequest("POST", "/test", `{"name":"Agent Ltd"}`))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+
+		var response models.ErrorResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldStartWith, "invalid account")
+	})
+
+	Convey("User can already pay from an account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user1"}).Return(&models.AccountDB{ID: "existing"}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleCreateAccount(w, newAccountRequest("POST", "/test", body))
+		So(w.Code, ShouldEqual, http.StatusConflict)
+	})
+
+	Convey("Error writing account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user1"}).Return(nil, nil)
+		mock.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleCreateAccount(w, newAccountRequest("POST", "/test", body))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Account created", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user1"}).Return(nil, nil)
+		mock.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Return(nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleCreateAccount(w, newAccountRequest("POST", "/test", body))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		var response models.AccountRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Name, ShouldEqual, "Agent Ltd")
+		So(response.CreatedBy, ShouldEqual, "admin@companieshouse.gov.uk")
+		So(w.Header().Get("Location"), ShouldEqual, response.Links.Self)
+	})
+}
+
+func TestUnitHandleGetAccount(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Account ID not supplied", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetAccount(w, httptest.NewRequest("GET", "/test", nil))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(nil, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetAccount(w, newAccountRequest("GET", "/test", ""))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Account found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(&models.AccountDB{ID: "acc", Balance: 1234}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetAccount(w, newAccountRequest("GET", "/test", ""))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response models.AccountRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Balance, ShouldEqual, "12.34")
+	})
+}
+
+func TestUnitHandleUpdateAccountStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Invalid status", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleUpdateAccountStatus(w, newAccountRequest("PATCH", "/test", `{"status":"closed"}`))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().UpdateAccountStatus(gomock.Any(), "acc", service.AccountStatusSuspended).Return(false, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleUpdateAccountStatus(w, newAccountRequest("PATCH", "/test", `{"status":"suspended"}`))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Account suspended", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().UpdateAccountStatus(gomock.Any(), "acc", service.AccountStatusSuspended).Return(true, nil)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(&models.AccountDB{ID: "acc", Status: service.AccountStatusSuspended}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleUpdateAccountStatus(w, newAccountRequest("PATCH", "/test", `{"status":"suspended"}`))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response models.AccountRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Status, ShouldEqual, service.AccountStatusSuspended)
+	})
+}
+
+func TestUnitHandleTopUpAccount(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	body := `{"amount":"50.00","reference":"BACS-1"}`
+
+	Convey("Invalid top up", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleTopUpAccount(w, newAccountRequest("POST", "/test", `{"amount":"0.00","reference":"BACS-1"}`))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(false, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleTopUpAccount(w, newAccountRequest("POST", "/test", body))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Account topped up", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(true, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleTopUpAccount(w, newAccountRequest("POST", "/test", body))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		var response models.AccountLedgerEntryRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Amount, ShouldEqual, "50.00")
+		So(response.Type, ShouldEqual, service.AccountEntryTopUp)
+	})
+}
+
+func TestUnitHandleGetAccountStatement(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Invalid from date", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetAccountStatement(w, newAccountRequest("GET", "/test?from=01-10-2026", ""))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Invalid to date", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetAccountStatement(w, newAccountRequest("GET", "/test?to=yesterday", ""))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(nil, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetAccountStatement(w, newAccountRequest("GET", "/test", ""))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Statement includes the whole of the to date", t, func() {
+		from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(&models.AccountDB{ID: "acc", Balance: 500}, nil)
+		mock.EXPECT().GetAccountLedgerEntries(gomock.Any(), "acc", from, to).Return([]models.AccountLedgerEntryDB{
+			{ID: "1", Type: service.AccountEntryTopUp, Amount: 500, Balance: 500},
+		}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetAccountStatement(w, newAccountRequest("GET", "/test?from=2026-10-01&to=2026-10-31", ""))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response models.AccountStatementRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Balance, ShouldEqual, "5.00")
+		So(response.Entries, ShouldHaveLength, 1)
+	})
+}
+
+func TestUnitHandleProcessPendingAccountDebits(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error getting pending debits", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return(nil, errors.New("error"))
+		externalPaymentService = &service.ExternalPaymentProvidersService{
+			AccountService: service.AccountService{PaymentService: service.PaymentService{DAO: mockDao, Config: *cfg}},
+		}
+
+		w := httptest.NewRecorder()
+		HandleProcessPendingAccountDebits(w, httptest.NewRequest("POST", "/test", nil))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Settled debits returned", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return([]models.AccountLedgerEntryDB{
+			{ID: "entry", Type: service.AccountEntryPayment, Amount: -1000, PaymentID: "1234", Pending: true},
+		}, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{ProviderID: "entry"}}, nil)
+		mockDao.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "entry").Return(nil)
+		externalPaymentService = &service.ExternalPaymentProvidersService{
+			AccountService: service.AccountService{PaymentService: service.PaymentService{DAO: mockDao, Config: *cfg}},
+		}
+
+		w := httptest.NewRecorder()
+		HandleProcessPendingAccountDebits(w, httptest.NewRequest("POST", "/test", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var rest []models.AccountLedgerEntryRest
+		json.NewDecoder(w.Body).Decode(&rest)
+		So(rest, ShouldHaveLength, 1)
+		So(rest[0].ID, ShouldEqual, "entry")
+		So(rest[0].Amount, ShouldEqual, "-10.00")
+	})
+}
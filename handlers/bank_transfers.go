@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+)
+
+// bankStatementFormats are the formats of bank statements, by the content type they are uploaded with
+var bankStatementFormats = map[string]string{
+	"text/csv":        service.BankStatementFormatCSV,
+	"application/xml": service.BankStatementFormatCamt053,
+	"text/xml":        service.BankStatementFormatCamt053,
+}
+
+// HandleImportBankStatement imports the credits on an uploaded bank statement, matching those quoting a remittance
+// reference to the payment sessions awaiting them. The format is taken from the format query parameter if given, or
+// else from the content type.
+func HandleImportBankStatement(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get(contentType))
+		format = bankStatementFormats[mediaType]
+	}
+	if format == "" {
+		log.ErrorR(req, fmt.Errorf("bank statement format not recognised from content type [%s]", req.Header.Get(contentType)))
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// The email of the admin importing the statement, put there by AdminRoleIntercept
+	userID, ok := req.Context().Value(helpers.ContextKeyUserID).(string)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("error user details not found in context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	statementImport, responseType, err := paymentService.ImportBankStatement(req, format, req.Body, userID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error importing bank statement: [%v]", err), log.Data{"service_response_type": responseType.String()})
+		if responseType == service.InvalidData {
+			w.Header().Set(contentType, applicationJsonResponseType)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions the statement paid, or part paid, are processed as a callback would be
+	for _, credit := range statementImport.Credits {
+		switch credit.Outcome {
+		case service.BankCreditOutcomePaid, service.BankCreditOutcomeUnderpaid, service.BankCreditOutcomeOverpaid:
+			err = handlePaymentMessage(req.Context(), credit.PaymentID)
+			if err != nil {
+				log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err), log.Data{"payment_id": credit.PaymentID, "credit_id": credit.ID})
+			}
+		}
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(statementImport)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleGetBankCreditExceptions retrieves the credits imported from bank statements that didn't pay a payment session
+// exactly, optionally limited to those booked on or after the from date and on or before the to date
+func HandleGetBankCreditExceptions(w http.ResponseWriter, req *http.Request) {
+	var from, to time.Time
+	var err error
+	if value := req.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(statementDateFormat, value)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("invalid from date: [%v]", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if value := req.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(statementDateFormat, value)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("invalid to date: [%v]", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// The to date is inclusive, so the report runs up to the start of the following day
+		to = to.AddDate(0, 0, 1)
+	}
+
+	exceptions, responseType, err := paymentService.GetBankCreditExceptions(req, from, to)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting bank credit exceptions: [%v]", err), log.Data{"service_response_type": responseType.String()})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(exceptions)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
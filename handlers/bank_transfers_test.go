@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newBankStatementRequest(target, mediaType, body string) *http.Request {
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req.Header.Set(contentType, mediaType)
+	return req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyUserID, "admin@companieshouse.gov.uk"))
+}
+
+func TestUnitHandleImportBankStatement(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	statement := "date,amount,reference,transaction_id\n2026-10-12,500.00,CHABCDEFGHJK,TX1\n"
+
+	Convey("Format not recognised", t, func() {
+		w := httptest.NewRecorder()
+		HandleImportBankStatement(w, newBankStatementRequest("/test", "application/pdf", statement))
+		So(w.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+	})
+
+	Convey("User not in context", t, func() {
+		req := httptest.NewRequest("POST", "/test", strings.NewReader(statement))
+		req.Header.Set(contentType, "text/csv")
+
+		w := httptest.NewRecorder()
+		HandleImportBankStatement(w, req)
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Invalid statement", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleImportBankStatement(w, newBankStatementRequest("/test", "text/csv; charset=utf-8", "date,amount\n"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+
+		var response models.ErrorResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldStartWith, "invalid bank statement")
+	})
+
+	Convey("Error importing statement", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(false, errors.New("error"))
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleImportBankStatement(w, newBankStatementRequest("/test", "text/csv", statement))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Statement imported, producing a message for the session it paid", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil).Times(2)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(&models.PaymentResourceDB{
+			ID:           "1234",
+			BankTransfer: &models.BankTransferDB{Reference: "CHABCDEFGHJK"},
+			Data:         models.PaymentResourceDataDB{Amount: "500.00", Status: service.AwaitingTransfer.String(), Etag: "etag", ExpiresAt: time.Now().Add(time.Hour)},
+		}, nil)
+		mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).Return(true, nil)
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		originalHandlePaymentMessage := handlePaymentMessage
+		defer func() { handlePaymentMessage = originalHandlePaymentMessage }()
+		var messagePaymentIDs []string
+		handlePaymentMessage = func(_ context.Context, paymentID string) error {
+			messagePaymentIDs = append(messagePaymentIDs, paymentID)
+			return nil
+		}
+
+		// The format query parameter is used over the content type
+		w := httptest.NewRecorder()
+		HandleImportBankStatement(w, newBankStatementRequest("/test?format=csv", "application/octet-stream", statement+"2026-10-12,20.00,UNKNOWN,TX2\n"))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		So(messagePaymentIDs, ShouldResemble, []string{"1234"})
+
+		var response models.BankStatementImportRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Format, ShouldEqual, service.BankStatementFormatCSV)
+		So(response.Paid, ShouldEqual, 1)
+		So(response.Exceptions, ShouldEqual, 1)
+		So(response.Kind, ShouldEqual, service.BankStatementImportKind)
+	})
+
+	Convey("Error producing a message leaves it to be sent again", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(&models.PaymentResourceDB{
+			ID:           "1234",
+			BankTransfer: &models.BankTransferDB{Reference: "CHABCDEFGHJK"},
+			Data:         models.PaymentResourceDataDB{Amount: "500.00", Status: service.AwaitingTransfer.String(), Etag: "etag", ExpiresAt: time.Now().Add(time.Hour)},
+		}, nil)
+		mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+			So(paymentUpdate.MessagesPending, ShouldResemble, []string{""})
+			return true, nil
+		})
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		originalHandlePaymentMessage := handlePaymentMessage
+		defer func() { handlePaymentMessage = originalHandlePaymentMessage }()
+		handlePaymentMessage = mockProduceKafkaMessageError
+
+		w := httptest.NewRecorder()
+		HandleImportBankStatement(w, newBankStatementRequest("/test", "text/csv", statement))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+	})
+}
+
+func TestUnitHandleGetBankCreditExceptions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Invalid from date", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetBankCreditExceptions(w, httptest.NewRequest("GET", "/test?from=12-10-2026", nil))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Error getting exceptions", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetBankCredits(gomock.Any(), gomock.Any(), time.Time{}, time.Time{}).Return(nil, errors.New("error"))
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetBankCreditExceptions(w, httptest.NewRequest("GET", "/test", nil))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Exceptions include the whole of the to date", t, func() {
+		from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetBankCredits(gomock.Any(), gomock.Any(), from, to).Return([]models.BankCreditDB{
+			{ID: "TX2", Amount: "20.00", Outcome: service.BankCreditOutcomeUnmatched},
+		}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetBankCreditExceptions(w, httptest.NewRequest("GET", "/test?from=2026-10-01&to=2026-10-31", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response models.BankCreditExceptionsRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Items, ShouldHaveLength, 1)
+		So(response.Items[0].Outcome, ShouldEqual, service.BankCreditOutcomeUnmatched)
+	})
+}
@@ -145,7 +145,7 @@ func closeFile(file multipart.File) {
 func HandleGetRefundStatuses(w http.ResponseWriter, req *http.Request) {
 
 	log.InfoR(req, "start GET request for payments with pending refund statuses")
-	pendingRefundPaymentSessions, err := refundService.GetPaymentsWithPendingRefundStatus()
+	pendingRefundPaymentSessions, err := refundService.GetPaymentsWithPendingRefundStatus(req.Context())
 	if err != nil {
 		log.ErrorR(req, err)
 		w.WriteHeader(http.StatusInternalServerError)
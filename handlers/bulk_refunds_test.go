@@ -111,7 +111,7 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			DAO:            mockDao,
 			Config:         *cfg,
 		}
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 
 		HandleGovPayBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusBadRequest)
@@ -139,7 +139,7 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			DAO:            mockDao,
 			Config:         *cfg,
 		}
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(nil, fmt.Errorf("error")).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error")).AnyTimes()
 
 		HandleGovPayBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
@@ -168,7 +168,7 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			DAO:            mockDao,
 			Config:         *cfg,
 		}
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 
 		HandleGovPayBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
@@ -197,8 +197,8 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			DAO:            mockDao,
 			Config:         *cfg,
 		}
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any()).Return(fmt.Errorf("error")).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error")).AnyTimes()
 
 		HandleGovPayBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
@@ -231,8 +231,8 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			Config:         *cfg,
 		}
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any()).Return(fmt.Errorf("err")).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any(), gomock.Any()).Return(fmt.Errorf("err")).AnyTimes()
 
 		HandleGovPayBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
@@ -264,8 +264,8 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			DAO:            mockDao,
 			Config:         *cfg,
 		}
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any()).Return(nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		HandleGovPayBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusCreated)
@@ -299,8 +299,8 @@ func TestUnitHandleBulkRefund(t *testing.T) {
 			Config:         *cfg,
 		}
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockDao.EXPECT().CreateBulkRefundByExternalPaymentTransactionID(gomock.Any()).Return(nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		HandlePayPalBulkRefund(w, req)
 		So(w.Code, ShouldEqual, http.StatusCreated)
@@ -325,7 +325,7 @@ func TestUnitHandleProcessBulkPendingRefunds(t *testing.T) {
 			Config:         *cfg,
 		}
 
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(nil, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(nil, fmt.Errorf("error"))
 
 		req := httptest.NewRequest("POST", "/admin/payments/bulk-refunds/process-pending", nil)
 		w := httptest.NewRecorder()
@@ -363,7 +363,7 @@ func TestUnitHandleProcessBulkPendingRefunds(t *testing.T) {
 		paymentSession1.BulkRefund = append(paymentSession1.BulkRefund, bulkRefund)
 		pList := []models.PaymentResourceDB{paymentSession, paymentSession1}
 
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 
 		req := httptest.NewRequest("POST", "/admin/payments/bulk-refunds/process-pending", nil)
 		w := httptest.NewRecorder()
@@ -404,10 +404,10 @@ func TestUnitHandleProcessBulkPendingRefunds(t *testing.T) {
 		}
 		paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 		pList := []models.PaymentResourceDB{paymentSession}
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 		mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, service.Success, nil)
-		mockGovPayService.EXPECT().CreateRefund(paymentResource, refundRequest).Return(response, service.Success, nil)
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockGovPayService.EXPECT().CreateRefund(gomock.Any(), paymentResource, refundRequest).Return(response, service.Success, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		req := httptest.NewRequest("POST", "/admin/payments/bulk-refunds/process-pending", nil)
 		w := httptest.NewRecorder()
@@ -449,10 +449,10 @@ func TestUnitHandleProcessBulkPendingRefunds(t *testing.T) {
 		paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 		paymentSession1.BulkRefund = append(paymentSession1.BulkRefund, bulkRefund)
 		pList := []models.PaymentResourceDB{paymentSession, paymentSession1}
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 		mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, service.Success, nil).Times(2)
-		mockGovPayService.EXPECT().CreateRefund(paymentResource, refundRequest).Return(response, service.Success, nil).Times(2)
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		mockGovPayService.EXPECT().CreateRefund(gomock.Any(), paymentResource, refundRequest).Return(response, service.Success, nil).Times(2)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
 
 		req := httptest.NewRequest("POST", "/admin/payments/bulk-refunds/process-pending", nil)
 		w := httptest.NewRecorder()
@@ -482,7 +482,7 @@ func TestUnitHandleGetRefundStatuses(t *testing.T) {
 			Config:         *cfg,
 		}
 
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(nil, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(nil, fmt.Errorf("error"))
 
 		req := httptest.NewRequest("GET", "/admin/payments/bulk-refunds", nil)
 		w := httptest.NewRecorder()
@@ -507,7 +507,7 @@ func TestUnitHandleGetRefundStatuses(t *testing.T) {
 			Config:         *cfg,
 		}
 
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pendingRefunds, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pendingRefunds, nil)
 
 		req := httptest.NewRequest("GET", "/admin/payments/bulk-refunds", nil)
 		w := httptest.NewRecorder()
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
 	"github.com/gorilla/mux"
@@ -24,7 +24,7 @@ func HandleGovPayCallback(gp service.PaymentProviderService) http.Handler {
 		id := vars["payment_id"]
 		if id == "" {
 			log.ErrorR(req, fmt.Errorf("payment id not supplied"))
-			w.WriteHeader(http.StatusBadRequest)
+			redirectCallbackError(w, req, "", nil, errorCodeInvalidRequest)
 			return
 		}
 
@@ -34,35 +34,34 @@ func HandleGovPayCallback(gp service.PaymentProviderService) http.Handler {
 		paymentSession, _, err := paymentService.GetPaymentSession(req, id)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error getting payment session: [%v]", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, id, nil, errorCodeInternalError)
 			return
 		}
 		if paymentSession == nil {
 			log.ErrorR(req, fmt.Errorf("payment session not found. id: %s", id))
-			w.WriteHeader(http.StatusNotFound)
+			redirectCallbackError(w, req, id, nil, errorCodeSessionNotFound)
+			return
+		}
+
+		if !checkCallbackToken(w, req, paymentSession) {
 			return
 		}
 
 		if paymentSession.Status == service.Paid.String() {
 			log.ErrorR(req, fmt.Errorf("payment session is already paid. id: %s", id))
-			w.WriteHeader(http.StatusBadRequest)
+			redirectCallbackError(w, req, id, paymentSession, errorCodeAlreadyPaid)
 			return
 		}
 
 		// Check if the payment session is expired
-		isExpired, err := service.IsExpired(*paymentSession, &paymentService.Config)
-		if err != nil {
-			log.ErrorR(req, fmt.Errorf("error checking payment session expiry status: [%v]", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		isExpired := service.IsExpired(*paymentSession, &paymentService.Config)
 
 		// Get the state of a GovPay payment
-		statusResponse, providerID, responseType, err := gp.CheckPaymentProviderStatus(paymentSession)
+		statusResponse, providerID, responseType, err := gp.CheckPaymentProviderStatus(req.Context(), paymentSession)
 
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error getting payment status from govpay: [%v]", err), log.Data{"service_response_type": responseType.String()})
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, id, paymentSession, errorCodeProviderError)
 			return
 		}
 
@@ -72,18 +71,18 @@ func HandleGovPayCallback(gp service.PaymentProviderService) http.Handler {
 			_, err := paymentService.PatchPaymentSession(req, id, *paymentSession)
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error setting payment status of expired payment session: [%v]", err))
-				w.WriteHeader(http.StatusInternalServerError)
+				redirectCallbackError(w, req, id, paymentSession, errorCodeInternalError)
 				return
 			}
 			log.ErrorR(req, fmt.Errorf("payment session has expired"))
-			w.WriteHeader(http.StatusForbidden)
+			redirectCallbackError(w, req, id, paymentSession, errorCodeExpired)
 			return
 		}
 
 		// Ensure payment method matches endpoint
 		if paymentSession.PaymentMethod != "credit-card" {
 			log.ErrorR(req, fmt.Errorf("payment method, [%s], for resource [%s] not recognised", paymentSession.PaymentMethod, id))
-			w.WriteHeader(http.StatusPreconditionFailed)
+			redirectCallbackError(w, req, id, paymentSession, errorCodePaymentMethod)
 			return
 		}
 
@@ -93,40 +92,141 @@ func HandleGovPayCallback(gp service.PaymentProviderService) http.Handler {
 		paymentSession.Status = statusResponse.Status
 		// only update 'completed_at' if payment marked as successful in GovPay response
 		if responseType == service.Success {
-			// To match the format time is saved to mongo, e.g. "2018-11-22T08:39:16.782Z", truncate the time
-			paymentSession.CompletedAt = time.Now().Truncate(time.Millisecond)
+			paymentSession.CompletedAt = helpers.MongoNow()
 		}
 
-		patchResponseType, err := paymentService.PatchPaymentSession(req, id, *paymentSession)
+		completed, patchResponseType, err := paymentService.CompletePaymentSession(req, id, req.URL.Query().Get(helpers.CallbackTokenParam), *paymentSession)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error setting payment status: [%v]", err), log.Data{"service_response_type": patchResponseType.String()})
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, id, paymentSession, errorCodeInternalError)
+			return
+		}
+		if !completed {
+			redirectWithLatestStatus(w, req, id)
 			return
 		}
 
 		// Prepare parameters needed for redirecting
 		params := models.RedirectParams{
-			State:  paymentSession.MetaData.State,
-			Ref:    paymentSession.Reference,
-			Status: paymentSession.Status,
+			PaymentID: paymentSession.MetaData.ID,
+			State:     paymentSession.MetaData.State,
+			Ref:       paymentSession.Reference,
+			Status:    paymentSession.Status,
 		}
 
 		// Onl generate Kafka message if payment marked as successful in GovPay response
 		if responseType == service.Success {
 			log.InfoR(req, "Successfully Closed payment session", log.Data{"payment_id": id, "status": paymentSession.Status})
 
-			err = handlePaymentMessage(paymentSession.MetaData.ID)
+			err = handlePaymentMessage(req.Context(), paymentSession.MetaData.ID)
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err))
-				w.WriteHeader(http.StatusInternalServerError)
+				redirectCallbackError(w, req, id, paymentSession, errorCodeNotificationError)
 				return
 			}
 		}
 
-		redirectUser(w, req, paymentSession.MetaData.RedirectURI, params)
+		redirectUser(w, req, paymentSession.MetaData.RedirectURI, paymentSession.MetaData.ClientID, params)
 	})
 }
 
+// HandleNoPaymentRequiredCallback is the journey of payment sessions with nothing to pay, which were completed without
+// going to a payment provider, and redirects the user straight back to the calling service
+func HandleNoPaymentRequiredCallback(w http.ResponseWriter, req *http.Request) {
+	redirectCompletedPayment(w, req, service.PaymentMethodNoPaymentRequired)
+}
+
+// HandleAccountCallback returns the user to the calling service once their payment session has been paid from an
+// account. The session is completed as the journey is created, so there's nothing to check with a payment provider.
+func HandleAccountCallback(w http.ResponseWriter, req *http.Request) {
+	redirectCompletedPayment(w, req, service.PaymentMethodAccount)
+}
+
+// HandleBankTransferCallback returns the user to the calling service once they have been given the bank details to pay
+// their payment session by bank transfer. The session is left awaiting the transfer, which is matched from a bank
+// statement once it arrives.
+func HandleBankTransferCallback(w http.ResponseWriter, req *http.Request) {
+	redirectCompletedPayment(w, req, service.PaymentMethodBankTransfer)
+}
+
+// redirectCompletedPayment returns the user to the calling service with the status of a payment session completed
+// without going to an external payment provider, as long as it was completed with the given payment method
+func redirectCompletedPayment(w http.ResponseWriter, req *http.Request, paymentMethod string) {
+	vars := mux.Vars(req)
+	id := vars["payment_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("payment id not supplied"))
+		redirectCallbackError(w, req, "", nil, errorCodeInvalidRequest)
+		return
+	}
+
+	paymentSession, _, err := paymentService.GetPaymentSession(req, id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting payment session: [%v]", err))
+		redirectCallbackError(w, req, id, nil, errorCodeInternalError)
+		return
+	}
+	if paymentSession == nil {
+		log.ErrorR(req, fmt.Errorf("payment session not found. id: %s", id))
+		redirectCallbackError(w, req, id, nil, errorCodeSessionNotFound)
+		return
+	}
+
+	if paymentSession.PaymentMethod != paymentMethod {
+		log.ErrorR(req, fmt.Errorf("payment method, [%s], for resource [%s] not recognised", paymentSession.PaymentMethod, id))
+		redirectCallbackError(w, req, id, paymentSession, errorCodePaymentMethod)
+		return
+	}
+
+	redirectWithStatus(w, req, paymentSession)
+}
+
+// checkCallbackToken checks that the callback carries the token issued when the external payment journey was
+// created. The token is consumed as the callback completes the session, so that the callback can't be replayed, and
+// should the callback fail before then the token is left to be used again. A callback
+// without a valid token is most often a user refreshing the page or going back, so rather than showing an error the
+// user is returned to the client with the current status of the payment session. It returns false if the callback
+// must not be processed.
+func checkCallbackToken(w http.ResponseWriter, req *http.Request, paymentSession *models.PaymentResourceRest) bool {
+	if service.CallbackTokenMatches(*paymentSession, req.URL.Query().Get(helpers.CallbackTokenParam)) {
+		return true
+	}
+
+	log.InfoR(req, "callback token missing, invalid or already used", log.Data{"payment_id": paymentSession.MetaData.ID, "status": paymentSession.Status})
+	redirectWithStatus(w, req, paymentSession)
+	return false
+}
+
+// redirectWithLatestStatus returns the user to the client with the status a payment session has been left in by
+// another request, used when that request completed the session first
+func redirectWithLatestStatus(w http.ResponseWriter, req *http.Request, id string) {
+	paymentSession, _, err := paymentService.GetPaymentSession(req, id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting payment session: [%v]", err))
+		redirectCallbackError(w, req, id, nil, errorCodeInternalError)
+		return
+	}
+	if paymentSession == nil {
+		log.ErrorR(req, fmt.Errorf("payment session not found. id: %s", id))
+		redirectCallbackError(w, req, id, nil, errorCodeSessionNotFound)
+		return
+	}
+
+	log.InfoR(req, "payment session already completed by another request", log.Data{"payment_id": id, "status": paymentSession.Status})
+	redirectWithStatus(w, req, paymentSession)
+}
+
+// redirectWithStatus returns the user to the client with the current status of the payment session
+func redirectWithStatus(w http.ResponseWriter, req *http.Request, paymentSession *models.PaymentResourceRest) {
+	params := models.RedirectParams{
+		PaymentID: paymentSession.MetaData.ID,
+		State:     paymentSession.MetaData.State,
+		Ref:       paymentSession.Reference,
+		Status:    paymentSession.Status,
+	}
+	redirectUser(w, req, paymentSession.MetaData.RedirectURI, paymentSession.MetaData.ClientID, params)
+}
+
 // HandlePayPalCallback handles the callback from PayPal and redirects the user
 func HandlePayPalCallback(externalPaymentSvc service.PaymentProviderService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -136,7 +236,7 @@ func HandlePayPalCallback(externalPaymentSvc service.PaymentProviderService) htt
 		paymentID := vars["payment_id"]
 		if paymentID == "" {
 			log.ErrorR(req, fmt.Errorf("payment id not supplied"))
-			w.WriteHeader(http.StatusBadRequest)
+			redirectCallbackError(w, req, "", nil, errorCodeInvalidRequest)
 			return
 		}
 
@@ -146,28 +246,27 @@ func HandlePayPalCallback(externalPaymentSvc service.PaymentProviderService) htt
 		paymentSession, _, err := paymentService.GetPaymentSession(req, paymentID)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error getting payment session: [%v]", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, paymentID, nil, errorCodeInternalError)
 			return
 		}
 		if paymentSession == nil {
 			log.ErrorR(req, fmt.Errorf("payment session not found. id: %s", paymentID))
-			w.WriteHeader(http.StatusNotFound)
+			redirectCallbackError(w, req, paymentID, nil, errorCodeSessionNotFound)
+			return
+		}
+
+		if !checkCallbackToken(w, req, paymentSession) {
 			return
 		}
 
 		if paymentSession.Status == service.Paid.String() {
 			log.ErrorR(req, fmt.Errorf("payment session is already paid. id: %s", paymentID))
-			w.WriteHeader(http.StatusBadRequest)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeAlreadyPaid)
 			return
 		}
 
 		// Check if the payment session is expired
-		isExpired, err := service.IsExpired(*paymentSession, &paymentService.Config)
-		if err != nil {
-			log.ErrorR(req, fmt.Errorf("error checking payment session expiry status: [%v]", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		isExpired := service.IsExpired(*paymentSession, &paymentService.Config)
 
 		if isExpired {
 			// Set the status of the payment
@@ -175,40 +274,54 @@ func HandlePayPalCallback(externalPaymentSvc service.PaymentProviderService) htt
 			_, err := paymentService.PatchPaymentSession(req, paymentID, *paymentSession)
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error setting payment status of expired payment session: [%v]", err))
-				w.WriteHeader(http.StatusInternalServerError)
+				redirectCallbackError(w, req, paymentID, paymentSession, errorCodeInternalError)
 				return
 			}
 			log.ErrorR(req, fmt.Errorf("payment session has expired"))
-			w.WriteHeader(http.StatusForbidden)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeExpired)
 			return
 		}
 
 		// Ensure payment method matches endpoint
 		if !strings.EqualFold(paymentSession.PaymentMethod, "paypal") {
 			log.ErrorR(req, fmt.Errorf("payment method, [%s], for resource [%s] not recognised", paymentSession.PaymentMethod, paymentID))
-			w.WriteHeader(http.StatusPreconditionFailed)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodePaymentMethod)
 			return
 		}
 
-		statusResponse, _, responseType, err := externalPaymentSvc.CheckPaymentProviderStatus(paymentSession)
+		statusResponse, _, responseType, err := externalPaymentSvc.CheckPaymentProviderStatus(req.Context(), paymentSession)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error getting payment status from PayPal: [%w]", err), log.Data{"service_response_type": responseType.String()})
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeProviderError)
 			return
 		}
 
 		if statusResponse.Status != paypal.OrderStatusApproved && statusResponse.Status != paypal.OrderStatusCreated {
 			log.ErrorR(req, fmt.Errorf("error - paypal payment status not approved, status is: [%s]", statusResponse.Status))
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeNotApproved)
+			return
+		}
+
+		// The callback token is consumed before the payment is captured, so that when the callback is replayed only one
+		// request captures the payment and the others return the user with the status it leaves the session in
+		callbackToken := req.URL.Query().Get(helpers.CallbackTokenParam)
+		consumed, responseType, err := paymentService.ConsumeCallbackToken(req, paymentID, callbackToken)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error consuming callback token: [%v]", err), log.Data{"service_response_type": responseType.String()})
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeInternalError)
+			return
+		}
+		if !consumed {
+			redirectWithLatestStatus(w, req, paymentID)
 			return
 		}
 
 		// If order has been approved, then proceed to capture payment
 		if statusResponse.Status == paypal.OrderStatusApproved {
-			response, err := externalPaymentSvc.CapturePayment(paymentSession.MetaData.ExternalPaymentStatusID)
+			response, err := externalPaymentSvc.CapturePayment(req.Context(), paymentSession.MetaData.ExternalPaymentStatusID)
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error capturing payment: %v", err))
-				w.WriteHeader(http.StatusInternalServerError)
+				redirectCallbackError(w, req, paymentID, paymentSession, errorCodeProviderError)
 				return
 			}
 			captureStatus := response.PurchaseUnits[0].Payments.Captures[0].Status
@@ -231,31 +344,36 @@ func HandlePayPalCallback(externalPaymentSvc service.PaymentProviderService) htt
 			paymentSession.Status = service.Failed.String()
 		}
 
-		// To match the format time is saved to mongo, e.g. "2018-11-22T08:39:16.782Z", truncate the time
-		paymentSession.CompletedAt = time.Now().Truncate(time.Millisecond)
+		paymentSession.CompletedAt = helpers.MongoNow()
 
-		responseType, err = paymentService.PatchPaymentSession(req, paymentID, *paymentSession)
+		// The callback token has already been consumed, so the session is completed without it
+		completed, responseType, err := paymentService.CompletePaymentSession(req, paymentID, "", *paymentSession)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error setting payment status: [%v]", err), log.Data{"service_response_type": responseType.String()})
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeInternalError)
+			return
+		}
+		if !completed {
+			redirectWithLatestStatus(w, req, paymentID)
 			return
 		}
 
 		// Prepare parameters needed for redirecting
 		params := models.RedirectParams{
-			State:  paymentSession.MetaData.State,
-			Ref:    paymentSession.Reference,
-			Status: paymentSession.Status,
+			PaymentID: paymentSession.MetaData.ID,
+			State:     paymentSession.MetaData.State,
+			Ref:       paymentSession.Reference,
+			Status:    paymentSession.Status,
 		}
 
 		log.InfoR(req, "Successfully Closed payment session", log.Data{"payment_id": paymentID, "status": paymentSession.Status})
 
-		err = handlePaymentMessage(paymentSession.MetaData.ID)
+		err = handlePaymentMessage(req.Context(), paymentSession.MetaData.ID)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err))
-			w.WriteHeader(http.StatusInternalServerError)
+			redirectCallbackError(w, req, paymentID, paymentSession, errorCodeNotificationError)
 			return
 		}
-		redirectUser(w, req, paymentSession.MetaData.RedirectURI, params)
+		redirectUser(w, req, paymentSession.MetaData.RedirectURI, paymentSession.MetaData.ClientID, params)
 	})
 }
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/redirect"
+)
+
+// callbackError is the reason a callback from a payment provider couldn't be completed. It is passed to the page the
+// user is redirected to as the error_code query parameter.
+type callbackError string
+
+const (
+	errorCodeInvalidRequest    callbackError = "invalid-request"
+	errorCodeSessionNotFound   callbackError = "session-not-found"
+	errorCodeAlreadyPaid       callbackError = "already-paid"
+	errorCodeExpired           callbackError = "expired"
+	errorCodePaymentMethod     callbackError = "payment-method-mismatch"
+	errorCodeNotApproved       callbackError = "payment-not-approved"
+	errorCodeProviderError     callbackError = "provider-error"
+	errorCodeNotificationError callbackError = "notification-error"
+	errorCodeInternalError     callbackError = "internal-error"
+)
+
+// callbackErrorsForClient are the failures that are returned to the calling service's redirect_uri, along with the
+// status of the payment session, as the calling service can act on them, e.g. by creating a new session to replace
+// an expired one. Every other failure is shown on the payments-web error page, as there is nothing the calling
+// service can do about it.
+var callbackErrorsForClient = map[callbackError]bool{
+	errorCodeAlreadyPaid: true,
+	errorCodeExpired:     true,
+	errorCodeNotApproved: true,
+}
+
+// redirectCallbackError redirects the user away from a payment provider callback that has failed, so that they are
+// never left on an empty response from the API. The payment session is nil if it couldn't be retrieved.
+func redirectCallbackError(w http.ResponseWriter, req *http.Request, paymentID string, paymentSession *models.PaymentResourceRest, code callbackError) {
+	if callbackErrorsForClient[code] && paymentSession != nil && paymentSession.MetaData.RedirectURI != "" {
+		params := models.RedirectParams{
+			PaymentID: paymentSession.MetaData.ID,
+			State:     paymentSession.MetaData.State,
+			Ref:       paymentSession.Reference,
+			Status:    paymentSession.Status,
+			ErrorCode: string(code),
+		}
+		redirectUser(w, req, paymentSession.MetaData.RedirectURI, paymentSession.MetaData.ClientID, params)
+		return
+	}
+
+	query := url.Values{}
+	query.Set(redirect.ParamErrorCode, string(code))
+	if paymentID != "" {
+		query.Set(redirect.ParamPaymentID, paymentID)
+	}
+
+	errorURL := paymentService.Config.PaymentsWebErrorPage() + "?" + query.Encode()
+	log.InfoR(req, "Redirecting to error page:", log.Data{"generated_url": errorURL})
+
+	http.Redirect(w, req, errorURL, http.StatusSeeOther)
+}
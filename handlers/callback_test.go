@@ -1,19 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/plutov/paypal/v4"
 
+	"github.com/Shopify/sarama"
 	"github.com/companieshouse/chs.go/avro"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/redirect"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -42,6 +47,13 @@ func createMockPaymentService(mockDAO *dao.MockDAO, cfg *config.Config) *service
 	}
 }
 
+// allowResourceClaims lets the claims payment sessions hold on their cost resources be taken and given up, for tests
+// which aren't about the claims
+func allowResourceClaims(mockDAO *dao.MockDAO) {
+	mockDAO.EXPECT().ClaimResource(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+	mockDAO.EXPECT().ReleaseResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+}
+
 type CustomError struct {
 	message string
 }
@@ -51,15 +63,24 @@ func (e CustomError) Error() string {
 }
 
 // Mock function for erroring when preparing and sending kafka message
-func mockProduceKafkaMessageError(path string) error {
+func mockProduceKafkaMessageError(_ context.Context, path string) error {
 	return CustomError{"hello"}
 }
 
 // Mock function for successful preparing and sending of kafka message
-func mockProduceKafkaMessage(path string) error {
+func mockProduceKafkaMessage(_ context.Context, path string) error {
 	return nil
 }
 
+// messageHeaders returns the headers of a kafka message by key
+func messageHeaders(message *sarama.ProducerMessage) map[string]string {
+	headers := map[string]string{}
+	for _, header := range message.Headers {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	return headers
+}
+
 func TestUnitHandleGovPayCallback(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -67,61 +88,72 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 	mockPaymentProvidersService := service.NewMockPaymentProviderService(mockCtrl)
 
 	cfg, _ := config.Get()
-	cfg.DomainAllowList = "http://dummy-url"
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+	cfg.PaymentsWebURL = "http://payments.web"
 
 	Convey("Payment ID not supplied", t, func() {
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldEqual, "http://payments.web/payments/error?error_code=invalid-request")
 	})
 
 	Convey("Error getting payment session", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(nil, fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
 	})
 
 	Convey("Payment session not found", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(nil, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(nil, nil)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusNotFound)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=session-not-found")
 	})
 
-	Convey("Payment session is already paid", t, func() {
+	Convey("Callback token missing", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			ID:          "1234",
+			RedirectURI: "https://www.companieshouse.gov.uk/complete",
+			State:       "state",
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
 					Resource: "http://dummy-url",
 				},
-				Status: service.Paid.String(),
+				Status: service.InProgress.String(),
 			},
 		}
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -135,45 +167,84 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldStartWith, "https://www.companieshouse.gov.uk/complete?")
+		So(w.Header().Get("Location"), ShouldContainSubstring, "status=in-progress")
 	})
 
-	Convey("Invalid expiry time", t, func() {
-		cfg.ExpiryTimeInMinutes = "invalid"
+	Convey("Callback token already used", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		paymentService = createMockPaymentService(mock, cfg)
+		paymentSession := models.PaymentResourceDB{
+			ID:          "1234",
+			RedirectURI: "https://www.companieshouse.gov.uk/complete",
+			State:       "state",
+			Data: models.PaymentResourceDataDB{
+				Amount: "10.00",
+				Links: models.PaymentLinksDB{
+					Resource: "http://dummy-url",
+				},
+				Status: service.Paid.String(),
+			},
+		}
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
+		w := httptest.NewRecorder()
 
+		handler := HandleGovPayCallback(mockPaymentProvidersService)
+		handler.ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "status=paid")
+	})
+
+	Convey("Payment session is already paid", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
 					Resource: "http://dummy-url",
 				},
-				CreatedAt: time.Now().Add(time.Hour * -2),
+				Status: service.Paid.String(),
 			},
 		}
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=already-paid")
 	})
 
-	cfg.ExpiryTimeInMinutes = "60"
+	cfg.ExpiryTimeInMinutes = 60
 	Convey("Error getting payment status", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
@@ -185,28 +256,31 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: service.Expired.String(),
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Error, errors.New("error")).Times(1)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil)
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Error, errors.New("error")).Times(1)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=provider-error")
 	})
 
 	Convey("Payment session expired", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
@@ -218,29 +292,32 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: service.Expired.String(),
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Error, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource("1234", gomock.Any()).Return(nil)
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Error, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusForbidden)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=expired")
 	})
 
 	Convey("Payment session expired and patch failed", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
@@ -252,29 +329,32 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: service.Expired.String(),
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Error, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource("1234", gomock.Any()).Return(fmt.Errorf("error"))
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Error, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(fmt.Errorf("error"))
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
 	})
 
 	Convey("Payment method not recognised", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "invalid",
@@ -287,28 +367,31 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: service.Paid.String(),
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Created, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Created, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusPreconditionFailed)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=payment-method-mismatch")
 	})
 
 	Convey("Error getting payment status from credit-card", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "credit-card",
@@ -321,29 +404,32 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: paypal.OrderStatusVoided,
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token"), gomock.Any()).Return(true, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=notification-error")
 	})
 
 	Convey("Error setting payment status", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "credit-card",
@@ -356,9 +442,9 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: paypal.OrderStatusVoided,
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token"), gomock.Any()).Return(false, errors.New("error"))
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -369,20 +455,23 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		govPayJSONResponse, _ := httpmock.NewJsonResponder(http.StatusOK, govPayResponse)
 		httpmock.RegisterResponder(http.MethodGet, cfg.GovPayURL, govPayJSONResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
 	})
 
 	Convey("Error sending kafka message", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "credit-card",
@@ -395,9 +484,9 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: paypal.OrderStatusVoided,
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token"), gomock.Any()).Return(true, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -410,20 +499,23 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 
 		handlePaymentMessage = mockProduceKafkaMessageError
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
 		handler := HandleGovPayCallback(mockPaymentProvidersService)
 		handler.ServeHTTP(w, req)
 
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=notification-error")
 	})
 
 	Convey("Successful callback with redirect", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "credit-card",
@@ -438,9 +530,9 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: paypal.OrderStatusVoided,
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token"), gomock.Any()).Return(true, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -461,7 +553,7 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 
 		handlePaymentMessage = mockProduceKafkaMessage
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
@@ -472,10 +564,65 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		So(paymentSession.Data.CompletedAt, ShouldNotBeZeroValue)
 	})
 
+	Convey("Payment completed by another request first", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		paymentService = createMockPaymentService(mock, cfg)
+		inProgressSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
+			ID:                "123",
+			RedirectURI:       "https://www.companieshouse.gov.uk/complete",
+			Data: models.PaymentResourceDataDB{
+				Amount:        "10.00",
+				PaymentMethod: "credit-card",
+				Links: models.PaymentLinksDB{
+					Resource: "http://dummy-url",
+				},
+				CreatedAt: time.Now(),
+				Status:    service.InProgress.String(),
+			},
+		}
+		paidSession := inProgressSession
+		paidSession.Data.Status = service.Paid.String()
+		statusResponse := models.StatusResponse{
+			Status: service.Paid.String(),
+		}
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Success, nil)
+		gomock.InOrder(
+			mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(&inProgressSession, nil),
+			mock.EXPECT().CompletePaymentResource(gomock.Any(), "123", helpers.HashCallbackToken("token"), gomock.Any()).Return(false, nil),
+			mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(&paidSession, nil),
+		)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jSONResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jSONResponse)
+
+		messages := 0
+		handlePaymentMessage = func(_ context.Context, _ string) error {
+			messages++
+			return nil
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
+		w := httptest.NewRecorder()
+
+		handler := HandleGovPayCallback(mockPaymentProvidersService)
+		handler.ServeHTTP(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "status=paid")
+		So(messages, ShouldEqual, 0)
+	})
+
 	Convey("Created callback with redirect", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "credit-card",
@@ -489,9 +636,9 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		statusResponse := models.StatusResponse{
 			Status: "in-progress",
 		}
-		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Created, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Created, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token"), gomock.Any()).Return(true, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -510,7 +657,7 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 
 		httpmock.RegisterResponder(http.MethodGet, cfg.GovPayURL, govPayJSONResponse)
 
-		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req := httptest.NewRequest(http.MethodGet, "/test?callback_token=token", nil)
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
 		w := httptest.NewRecorder()
 
@@ -549,14 +696,57 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 		// the schema and message (paymentID), prepare the message (which includes marshalling), then unmarshal to
 		// ensure the data being sent to the payments-processed topic has not been modified in any way
 
-		message, pkmError := prepareKafkaMessage(paymentID, refundID, *producerSchema)
+		headers := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+		message, pkmError := prepareKafkaMessage(paymentID, refundID, "", *producerSchema, headers)
+		So(pkmError, ShouldEqual, nil)
+
 		unmarshalledPaymentProcessed := paymentProcessed{}
-		psError := producerSchema.Unmarshal(message.Value, &unmarshalledPaymentProcessed)
+		messageBytes, encodeError := message.Value.Encode()
+		psError := producerSchema.Unmarshal(messageBytes, &unmarshalledPaymentProcessed)
 
-		So(pkmError, ShouldEqual, nil)
+		So(encodeError, ShouldEqual, nil)
 		So(psError, ShouldEqual, nil)
 		So(unmarshalledPaymentProcessed.PaymentSessionID, ShouldEqual, "12345")
 		So(unmarshalledPaymentProcessed.RefundId, ShouldEqual, "54321")
+		So(messageHeaders(message), ShouldResemble, headers)
+	})
+
+	Convey("Message prepared for a basket resource names it in a header", t, func() {
+		// This is the schema that is used by the producer, which has no field for the resource
+		schema := `{
+				"type": "record",
+				"name": "payment_processed",
+				"namespace": "payments",
+				"fields": [
+				{
+					"name": "payment_resource_id",
+					"type": "string"
+				},
+				{
+					"name": "refund_id",
+					"type": "string"
+				}
+				]
+			}`
+
+		producerSchema := &avro.Schema{
+			Definition: schema,
+		}
+
+		headers := map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+		message, err := prepareKafkaMessage("12345", "", "http://dummy-url/certified-copies", *producerSchema, headers)
+		So(err, ShouldBeNil)
+
+		unmarshalledPaymentProcessed := paymentProcessed{}
+		messageBytes, _ := message.Value.Encode()
+		So(producerSchema.Unmarshal(messageBytes, &unmarshalledPaymentProcessed), ShouldBeNil)
+		So(unmarshalledPaymentProcessed.PaymentSessionID, ShouldEqual, "12345")
+		So(messageHeaders(message), ShouldResemble, map[string]string{
+			"traceparent":  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			resourceHeader: "http://dummy-url/certified-copies",
+		})
+		// The trace headers are shared by each message sent for the session, so are left as they were
+		So(headers, ShouldHaveLength, 1)
 	})
 
 	Convey("Unsuccessful message preparation with prepareKafkaMessage", t, func() {
@@ -584,13 +774,13 @@ func TestUnitHandleGovPayCallback(t *testing.T) {
 			Definition: schema,
 		}
 
-		_, err := prepareKafkaMessage(paymentID, refundID, *producerSchema)
+		_, err := prepareKafkaMessage(paymentID, refundID, "", *producerSchema, nil)
 		So(err, ShouldNotBeEmpty)
 	})
 }
 
 func serveHandlePayPalCallback(externalPaymentSvc service.PaymentProviderService, paymentIDSet bool) *httptest.ResponseRecorder {
-	path := "/callback/payments/paypal/orders/1234"
+	path := "/callback/payments/paypal/orders/1234?callback_token=token"
 	req := httptest.NewRequest(http.MethodGet, path, nil)
 	if paymentIDSet {
 		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
@@ -617,45 +807,53 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 
 	Convey("Payment ID not supplied", t, func() {
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, false) //
-		So(res.Code, ShouldEqual, http.StatusBadRequest)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=invalid-request")
 	})
 
 	Convey("Error getting payment session", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
 		paymentService = createMockPaymentService(mock, cfg)
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(nil, fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
 	})
 
 	Convey("Payment session not found", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
 		paymentService = createMockPaymentService(mock, cfg)
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(nil, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(nil, nil)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusNotFound)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=session-not-found")
 	})
 
-	Convey("Payment session is already paid", t, func() {
+	Convey("Callback token already used", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
 		paymentService = createMockPaymentService(mock, cfg)
 		paymentSession := models.PaymentResourceDB{
+			ID:          "1234",
+			RedirectURI: "https://www.companieshouse.gov.uk/complete",
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
 					Resource: "http://dummy-url",
 				},
-				Status: service.Paid.String(),
+				Status: service.Failed.String(),
 			},
 		}
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -663,26 +861,26 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusBadRequest)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "status=failed")
 	})
 
-	Convey("Invalid expiry time", t, func() {
+	Convey("Payment session is already paid", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "invalid"
 		paymentService = createMockPaymentService(mock, cfg)
-
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
 					Resource: "http://dummy-url",
 				},
-				CreatedAt: time.Now().Add(time.Hour * -2),
+				Status: service.Paid.String(),
 			},
 		}
-
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -690,17 +888,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
-
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=already-paid")
 	})
 
 	Convey("Error setting payment status of expired payment session", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
@@ -710,8 +910,8 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -719,16 +919,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
 	})
 
 	Convey("Payment session is expired", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
 				Links: models.PaymentLinksDB{
@@ -738,8 +941,8 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -747,16 +950,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusForbidden)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=expired")
 	})
 
 	Convey("Payment method not recognised", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "invalid",
@@ -767,7 +973,7 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -775,16 +981,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusPreconditionFailed)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=payment-method-mismatch")
 	})
 
 	Convey("Error checking paypal order status", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -799,8 +1008,8 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			Status: paypal.OrderStatusVoided,
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "123", service.Success, fmt.Errorf("error"))
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "123", service.Success, fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -808,16 +1017,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=provider-error")
 	})
 
 	Convey("Error - paypal payment status not approved", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -832,8 +1044,8 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			Status: paypal.OrderStatusVoided,
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -841,16 +1053,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=payment-not-approved")
 	})
 
 	Convey("Error capturing payment", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -865,9 +1080,10 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			Status: paypal.OrderStatusApproved,
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any()).Return(nil, fmt.Errorf("error"))
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -875,16 +1091,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=provider-error")
 	})
 
 	Convey("Error setting successful payment status", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -913,10 +1132,11 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any()).Return(&captureResponse, nil)
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any(), gomock.Any()).Return(&captureResponse, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(false, fmt.Errorf("error"))
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -924,16 +1144,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
 	})
 
 	Convey("Error sending kafka message", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -962,10 +1185,11 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any()).Return(&captureResponse, nil)
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any(), gomock.Any()).Return(&captureResponse, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		handlePaymentMessage = mockProduceKafkaMessageError
 
@@ -975,16 +1199,19 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
 
 		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
-		So(res.Code, ShouldEqual, http.StatusInternalServerError)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=notification-error")
 	})
 
 	Convey("Successful redirect if payment is cancelled", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -1000,9 +1227,10 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			Status: paypal.OrderStatusCreated,
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -1017,11 +1245,13 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 
 	Convey("Successful PayPal callback with redirect - paypal payment declined", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -1051,10 +1281,11 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any()).Return(&captureResponse, nil)
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any(), gomock.Any()).Return(&captureResponse, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		handlePaymentMessage = mockProduceKafkaMessage
 
@@ -1070,11 +1301,13 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 
 	Convey("Successful PayPal callback with redirect - paypal payment failed", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -1104,10 +1337,11 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any()).Return(&captureResponse, nil)
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any(), gomock.Any()).Return(&captureResponse, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		handlePaymentMessage = mockProduceKafkaMessage
 
@@ -1123,11 +1357,13 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 
 	Convey("Successful PayPal callback with redirect", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "60"
+		cfg.ExpiryTimeInMinutes = 60
 		paymentService = createMockPaymentService(mock, cfg)
 
 		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
 			Data: models.PaymentResourceDataDB{
 				Amount:        "10.00",
 				PaymentMethod: "paypal",
@@ -1157,10 +1393,11 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 			},
 		}
 
-		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any()).Return(&statusResponse, "", service.Success, nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
-		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any()).Return(&captureResponse, nil)
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(true, nil)
+		mockExternalPaymentProvidersService.EXPECT().CapturePayment(gomock.Any(), gomock.Any()).Return(&captureResponse, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		handlePaymentMessage = mockProduceKafkaMessage
 
@@ -1173,4 +1410,406 @@ func TestUnitHandlePayPalCallback(t *testing.T) {
 		So(res.Code, ShouldEqual, http.StatusSeeOther)
 		So(paymentSession.Data.CompletedAt, ShouldNotBeZeroValue)
 	})
+
+	Convey("Callback replayed after the payment has been captured", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		cfg, _ := config.Get()
+		cfg.ExpiryTimeInMinutes = 60
+		paymentService = createMockPaymentService(mock, cfg)
+
+		inProgressSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
+			ID:                "1234",
+			RedirectURI:       "https://www.companieshouse.gov.uk/complete",
+			Data: models.PaymentResourceDataDB{
+				Amount:        "10.00",
+				PaymentMethod: "paypal",
+				Links: models.PaymentLinksDB{
+					Resource: "http://dummy-url",
+				},
+				CreatedAt: time.Now(),
+				Status:    service.InProgress.String(),
+			},
+		}
+		paidSession := inProgressSession
+		paidSession.CallbackTokenHash = ""
+		paidSession.Data.Status = service.Paid.String()
+
+		statusResponse := models.StatusResponse{
+			Status: paypal.OrderStatusApproved,
+		}
+
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		gomock.InOrder(
+			mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&inProgressSession, nil),
+			mock.EXPECT().ConsumeCallbackToken(gomock.Any(), "1234", helpers.HashCallbackToken("token")).Return(false, nil),
+			mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&paidSession, nil),
+		)
+
+		messages := 0
+		handlePaymentMessage = func(_ context.Context, _ string) error {
+			messages++
+			return nil
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "status=paid")
+		So(res.Header().Get("Location"), ShouldNotContainSubstring, "error_code")
+		So(messages, ShouldEqual, 0)
+	})
+
+	Convey("Error consuming callback token", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		cfg, _ := config.Get()
+		cfg.ExpiryTimeInMinutes = 60
+		paymentService = createMockPaymentService(mock, cfg)
+
+		paymentSession := models.PaymentResourceDB{
+			CallbackTokenHash: helpers.HashCallbackToken("token"),
+			Data: models.PaymentResourceDataDB{
+				Amount:        "10.00",
+				PaymentMethod: "paypal",
+				Links: models.PaymentLinksDB{
+					Resource: "http://dummy-url",
+				},
+				CreatedAt: time.Now(),
+			},
+		}
+
+		statusResponse := models.StatusResponse{
+			Status: paypal.OrderStatusApproved,
+		}
+
+		mockExternalPaymentProvidersService.EXPECT().CheckPaymentProviderStatus(gomock.Any(), gomock.Any()).Return(&statusResponse, "", service.Success, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), gomock.Any(), helpers.HashCallbackToken("token")).Return(false, fmt.Errorf("error"))
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		res := serveHandlePayPalCallback(mockExternalPaymentProvidersService, true)
+		So(res.Code, ShouldEqual, http.StatusSeeOther)
+		So(res.Header().Get("Location"), ShouldContainSubstring, "error_code=internal-error")
+	})
+}
+
+func TestUnitHandleNoPaymentRequiredCallback(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cfg, _ := config.Get()
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+	cfg.PaymentsWebURL = "http://payments.web"
+
+	freeCosts := defaultCosts
+	freeCost := defaultCost
+	freeCost.Amount = "0"
+	freeCosts.Costs = []models.CostResourceRest{freeCost}
+
+	paymentSession := func(paymentMethod string) *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{
+			ID:          "123",
+			RedirectURI: "https://www.companieshouse.gov.uk/complete",
+			State:       "state",
+			Data: models.PaymentResourceDataDB{
+				Amount:        "0.00",
+				PaymentMethod: paymentMethod,
+				Reference:     "ref",
+				Status:        service.Paid.String(),
+				Links:         models.PaymentLinksDB{Resource: "http://dummy-url"},
+			},
+		}
+	}
+
+	serve := func(paymentID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		if paymentID != "" {
+			req = mux.SetURLVars(req, map[string]string{"payment_id": paymentID})
+		}
+		w := httptest.NewRecorder()
+		HandleNoPaymentRequiredCallback(w, req)
+		return w
+	}
+
+	Convey("Payment ID not supplied", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := serve("")
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldEqual, "http://payments.web/payments/error?error_code=invalid-request")
+	})
+
+	Convey("Payment session not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(nil, nil)
+
+		w := serve("123")
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=session-not-found")
+	})
+
+	Convey("Payment session that required a payment", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(paymentSession("credit-card"), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, freeCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		w := serve("123")
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=payment-method-mismatch")
+	})
+
+	Convey("User returned to the calling service", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(paymentSession(service.PaymentMethodNoPaymentRequired), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, freeCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		w := serve("123")
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		location, err := url.Parse(w.Header().Get("Location"))
+		So(err, ShouldBeNil)
+		So(location.Host, ShouldEqual, "www.companieshouse.gov.uk")
+		So(location.Query().Get("status"), ShouldEqual, service.Paid.String())
+		So(location.Query().Get("state"), ShouldEqual, "state")
+		So(location.Query().Get("ref"), ShouldEqual, "ref")
+	})
+}
+
+func TestUnitHandleAccountCallback(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cfg, _ := config.Get()
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+	cfg.PaymentsWebURL = "http://payments.web"
+
+	paymentSession := func(paymentMethod string) *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{
+			ID:          "123",
+			RedirectURI: "https://www.companieshouse.gov.uk/complete",
+			State:       "state",
+			Data: models.PaymentResourceDataDB{
+				Amount:        "10.00",
+				PaymentMethod: paymentMethod,
+				Reference:     "ref",
+				Status:        service.Paid.String(),
+				Links:         models.PaymentLinksDB{Resource: "http://dummy-url"},
+			},
+		}
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
+		w := httptest.NewRecorder()
+		HandleAccountCallback(w, req)
+		return w
+	}
+
+	Convey("Payment session not paid from an account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(paymentSession(service.PaymentMethodNoPaymentRequired), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		w := serve()
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldContainSubstring, "error_code=payment-method-mismatch")
+	})
+
+	Convey("User returned to the calling service", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(paymentSession(service.PaymentMethodAccount), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		w := serve()
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		location, err := url.Parse(w.Header().Get("Location"))
+		So(err, ShouldBeNil)
+		So(location.Host, ShouldEqual, "www.companieshouse.gov.uk")
+		So(location.Query().Get("status"), ShouldEqual, service.Paid.String())
+	})
+}
+
+func TestUnitHandleBankTransferCallback(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	cfg, _ := config.Get()
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+
+	Convey("User returned to the calling service while the transfer is awaited", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "123").Return(&models.PaymentResourceDB{
+			ID:          "123",
+			RedirectURI: "https://www.companieshouse.gov.uk/complete",
+			State:       "state",
+			Data: models.PaymentResourceDataDB{
+				Amount:        "10.00",
+				PaymentMethod: service.PaymentMethodBankTransfer,
+				Status:        service.AwaitingTransfer.String(),
+				Links:         models.PaymentLinksDB{Resource: "http://dummy-url"},
+			},
+		}, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder(http.MethodGet, "http://dummy-url", jsonResponse)
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "123"})
+		w := httptest.NewRecorder()
+		HandleBankTransferCallback(w, req)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		location, err := url.Parse(w.Header().Get("Location"))
+		So(err, ShouldBeNil)
+		So(location.Query().Get("status"), ShouldEqual, service.AwaitingTransfer.String())
+	})
+}
+
+func TestUnitRedirectUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey := "0123456789abcdef0123456789abcdef"
+	cfg, _ := config.Get()
+	clientCfg := *cfg
+	clientCfg.ClientsJSON = `[{"id":"client","redirect_signing_key":"` + signingKey + `"}]`
+	clientCfg.Parse()
+	paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), &clientCfg)
+
+	params := models.RedirectParams{
+		PaymentID: "1234",
+		State:     "state",
+		Ref:       "ref",
+		Status:    "paid",
+	}
+
+	Convey("Redirect signed with the client's key", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+
+		redirectUser(w, req, "https://frontend/callback", "client", params)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		location, err := url.Parse(w.Header().Get("Location"))
+		So(err, ShouldBeNil)
+		verified, err := redirect.Verify([]byte(signingKey), location.Query(), time.Minute)
+		So(err, ShouldBeNil)
+		So(verified.PaymentID, ShouldEqual, "1234")
+		So(verified.Status, ShouldEqual, "paid")
+	})
+
+	Convey("Redirect unsigned for a client without a key", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+
+		redirectUser(w, req, "https://frontend/callback", "unknown", params)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		location, err := url.Parse(w.Header().Get("Location"))
+		So(err, ShouldBeNil)
+		So(location.Query().Get("status"), ShouldEqual, "paid")
+		So(location.Query().Get("sig"), ShouldBeEmpty)
+	})
+}
+
+func TestUnitRedirectCallbackError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	signingKey := "0123456789abcdef0123456789abcdef"
+	cfg, _ := config.Get()
+	clientCfg := *cfg
+	clientCfg.PaymentsWebURL = "https://payments.web"
+	clientCfg.ClientsJSON = `[{"id":"client","redirect_signing_key":"` + signingKey + `"}]`
+	clientCfg.Parse()
+	paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), &clientCfg)
+
+	paymentSession := &models.PaymentResourceRest{
+		Status: service.Expired.String(),
+		MetaData: models.PaymentResourceMetaDataRest{
+			ID:          "1234",
+			RedirectURI: "https://frontend/callback",
+			State:       "state",
+			ClientID:    "client",
+		},
+	}
+
+	Convey("Failures the calling service can act on are returned to its redirect_uri", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+
+		redirectCallbackError(w, req, "1234", paymentSession, errorCodeExpired)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldStartWith, "https://frontend/callback?")
+		location, err := url.Parse(w.Header().Get("Location"))
+		So(err, ShouldBeNil)
+		verified, err := redirect.Verify([]byte(signingKey), location.Query(), time.Minute)
+		So(err, ShouldBeNil)
+		So(verified.Status, ShouldEqual, "expired")
+		So(verified.ErrorCode, ShouldEqual, "expired")
+	})
+
+	Convey("Other failures are shown on the payments-web error page", t, func() {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+
+		redirectCallbackError(w, req, "1234", paymentSession, errorCodeProviderError)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldEqual, "https://payments.web/payments/error?error_code=provider-error&payment_id=1234")
+	})
+
+	Convey("Failures before the payment session is found are shown on the configured error page", t, func() {
+		errorPageCfg := clientCfg
+		errorPageCfg.PaymentsWebErrorURL = "https://www.companieshouse.gov.uk/payment-error"
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), &errorPageCfg)
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+
+		redirectCallbackError(w, req, "1234", nil, errorCodeExpired)
+
+		So(w.Code, ShouldEqual, http.StatusSeeOther)
+		So(w.Header().Get("Location"), ShouldEqual, "https://www.companieshouse.gov.uk/payment-error?error_code=expired&payment_id=1234")
+	})
 }
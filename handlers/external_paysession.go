@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/companieshouse/chs.go/log"
@@ -22,6 +24,25 @@ func HandleCreateExternalPaymentJourney(externalPaymentProvidersService *service
 			return
 		}
 
+		// The body is optional, and cardholder details given in it replace any given when the session was created
+		var incomingExternalPaymentJourneyRequest models.IncomingExternalPaymentJourneyRequest
+		if req.Body != nil {
+			err := json.NewDecoder(req.Body).Decode(&incomingExternalPaymentJourneyRequest)
+			if err != nil && !errors.Is(err, io.EOF) {
+				log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if incomingExternalPaymentJourneyRequest.PrefilledCardholderDetails != nil {
+			paymentSession.MetaData.PrefilledCardholderDetails = incomingExternalPaymentJourneyRequest.PrefilledCardholderDetails
+		}
+
+		// A payer who came through a pay-on-behalf link pays the session, e.g. from their own credit account
+		if payer, ok := req.Context().Value(helpers.ContextKeyPayer).(*models.CreatedByRest); ok {
+			paymentSession.PaidBy = payer
+		}
+
 		externalPaymentJourney, responseType, err := paymentService.CreateExternalPaymentJourney(req, paymentSession, *externalPaymentProvidersService)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error creating external payment journey: [%v]", err), log.Data{"service_response_type": responseType.String()})
@@ -32,12 +53,24 @@ func HandleCreateExternalPaymentJourney(externalPaymentProvidersService *service
 			case service.InvalidData:
 				w.WriteHeader(http.StatusBadRequest)
 				return
+			case service.Conflict:
+				w.WriteHeader(http.StatusConflict)
+				return
 			default:
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 		}
 
+		// A payment from an account is complete once the journey is created, so is processed as a callback would be. A
+		// message which can't be produced is left pending on the session to be retried.
+		if paymentSession.PaymentMethod == service.PaymentMethodAccount {
+			err = handlePaymentMessage(req.Context(), paymentSession.MetaData.ID)
+			if err != nil {
+				log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID})
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 
 		err = json.NewEncoder(w).Encode(externalPaymentJourney)
@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/golang/mock/gomock"
@@ -14,6 +18,7 @@ import (
 	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/plutov/paypal/v4"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -38,7 +43,9 @@ func TestUnitHandleCreateExternalPaymentJourney(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	cfg, _ := config.Get()
-	mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+	mockDAO := dao.NewMockDAO(mockCtrl)
+	allowResourceClaims(mockDAO)
+	mockPaymentService := createMockPaymentService(mockDAO, cfg)
 	mockPayPalSDK := service.NewMockPayPalSDK(mockCtrl)
 
 	// Generate a mock external provider service using mocks for both PayPal and GovPay
@@ -58,6 +65,7 @@ func TestUnitHandleCreateExternalPaymentJourney(t *testing.T) {
 	})
 
 	Convey("Error creating external payment journey", t, func() {
+		paymentService = mockPaymentService
 		req := httptest.NewRequest("GET", "/test", nil)
 		paymentResource := models.PaymentResourceRest{
 			Status: service.InProgress.String(),
@@ -74,4 +82,150 @@ func TestUnitHandleCreateExternalPaymentJourney(t *testing.T) {
 		So(res.Code, ShouldEqual, http.StatusBadRequest)
 	})
 
+	Convey("Invalid request body", t, func() {
+		req := httptest.NewRequest("POST", "/test", strings.NewReader("{"))
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &models.PaymentResourceRest{Status: service.InProgress.String()})
+		res := serveHandleCreateExternalPaymentJourney(mockExternalProviderService, req.WithContext(ctx))
+		So(res.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Prefilled cardholder details in the request body replace those on the session", t, func() {
+		paymentService = mockPaymentService
+		body := `{"prefilled_cardholder_details":{"cardholder_name":"J Bloggs","billing_address":{"country":"Wales"}}}`
+		req := httptest.NewRequest("POST", "/test", strings.NewReader(body))
+		paymentResource := models.PaymentResourceRest{
+			Status: service.InProgress.String(),
+			MetaData: models.PaymentResourceMetaDataRest{
+				PrefilledCardholderDetails: &models.PrefilledCardholderDetails{CardholderName: "A Smith"},
+			},
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+		res := serveHandleCreateExternalPaymentJourney(mockExternalProviderService, req.WithContext(ctx))
+		So(res.Code, ShouldEqual, http.StatusBadRequest)
+		So(paymentResource.MetaData.PrefilledCardholderDetails.CardholderName, ShouldEqual, "J Bloggs")
+	})
+
+	Convey("Session whose last attempt failed is no longer awaiting a retry", t, func() {
+		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&paypal.Order{
+			ID:     "order_id",
+			Status: paypal.OrderStatusCreated,
+			Links:  []paypal.Link{{Href: "approve_url", Rel: "approve"}},
+		}, nil)
+		mockDAO.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, nil)
+		paymentService = mockPaymentService
+		req := httptest.NewRequest("POST", "/test", nil)
+		paymentResource := models.PaymentResourceRest{
+			PaymentMethod: "PayPal",
+			Amount:        "3",
+			CreatedAt:     time.Now(),
+			Status:        service.Failed.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"orderable-item"}}},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+		res := serveHandleCreateExternalPaymentJourney(mockExternalProviderService, req.WithContext(ctx))
+		So(res.Code, ShouldEqual, http.StatusConflict)
+	})
+
+	Convey("Payment from an account produces the payment processed message", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(&models.AccountDB{ID: "acc", Status: service.AccountStatusActive, Balance: 1000}, nil)
+		mockDao.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), service.AccountStatusActive).Return(true, nil)
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+		mockDao.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).Return(nil)
+		paymentService = createMockPaymentService(mockDao, cfg)
+
+		accountProviderService := mockExternalProviderService
+		accountProviderService.AccountService = service.AccountService{PaymentService: *paymentService}
+
+		var messagePaymentID string
+		handlePaymentMessage = func(_ context.Context, paymentID string) error {
+			messagePaymentID = paymentID
+			return nil
+		}
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		paymentResource := models.PaymentResourceRest{
+			Amount:        "10.00",
+			PaymentMethod: service.PaymentMethodAccount,
+			Status:        service.InProgress.String(),
+			CreatedBy:     models.CreatedByRest{ID: "user"},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+		res := serveHandleCreateExternalPaymentJourney(accountProviderService, req.WithContext(ctx))
+		So(res.Code, ShouldEqual, http.StatusOK)
+		So(messagePaymentID, ShouldEqual, "1234")
+	})
+
+	Convey("Payment from an account whose message can't be produced leaves it pending", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(&models.AccountDB{ID: "acc", Status: service.AccountStatusActive, Balance: 1000}, nil)
+		mockDao.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), service.AccountStatusActive).Return(true, nil)
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, update *models.PaymentResourceDB) (bool, error) {
+			So(update.MessagesPending, ShouldNotBeEmpty)
+			return true, nil
+		})
+		mockDao.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).Return(nil)
+		paymentService = createMockPaymentService(mockDao, cfg)
+
+		accountProviderService := mockExternalProviderService
+		accountProviderService.AccountService = service.AccountService{PaymentService: *paymentService}
+
+		handlePaymentMessage = func(_ context.Context, _ string) error {
+			return errors.New("error")
+		}
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		paymentResource := models.PaymentResourceRest{
+			Amount:        "10.00",
+			PaymentMethod: service.PaymentMethodAccount,
+			Status:        service.InProgress.String(),
+			CreatedBy:     models.CreatedByRest{ID: "user"},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+		res := serveHandleCreateExternalPaymentJourney(accountProviderService, req.WithContext(ctx))
+		So(res.Code, ShouldEqual, http.StatusOK)
+		So(paymentResource.Status, ShouldEqual, service.Paid.String())
+	})
+
+	Convey("Payment by bank transfer returns the bank details without producing a message", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+		bankTransferCfg := *cfg
+		bankTransferCfg.BankTransferAccountJSON = `{"account_name":"Companies House","sort_code":"12-34-56","account_number":"12345678"}`
+		So(bankTransferCfg.Parse(), ShouldBeNil)
+		paymentService = createMockPaymentService(mockDao, &bankTransferCfg)
+
+		bankTransferProviderService := mockExternalProviderService
+		bankTransferProviderService.BankTransferService = service.BankTransferService{PaymentService: *paymentService}
+
+		messageProduced := false
+		handlePaymentMessage = func(_ context.Context, _ string) error {
+			messageProduced = true
+			return nil
+		}
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		paymentResource := models.PaymentResourceRest{
+			Amount:        "500.00",
+			PaymentMethod: service.PaymentMethodBankTransfer,
+			Status:        service.InProgress.String(),
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+		res := serveHandleCreateExternalPaymentJourney(bankTransferProviderService, req.WithContext(ctx))
+		So(res.Code, ShouldEqual, http.StatusOK)
+		So(messageProduced, ShouldBeFalse)
+
+		var journey models.ExternalPaymentJourney
+		So(json.NewDecoder(res.Body).Decode(&journey), ShouldBeNil)
+		So(journey.NextURL, ShouldEndWith, "/callback/payments/bank-transfer/1234")
+		So(journey.BankTransfer.Reference, ShouldStartWith, "CH")
+		So(journey.BankTransfer.SortCode, ShouldEqual, "12-34-56")
+	})
 }
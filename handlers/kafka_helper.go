@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/companieshouse/chs.go/avro"
 	"github.com/companieshouse/chs.go/avro/schema"
-	"github.com/companieshouse/chs.go/kafka/producer"
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
+	"github.com/companieshouse/payments.api.ch.gov.uk/redirect"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 )
@@ -16,6 +23,15 @@ import (
 // ProducerSchemaName is the schema which will be used to send the payment processed kafka message with
 const ProducerSchemaName = "payment-processed"
 
+// resourceHeader is the header naming the cost resource a payment processed message is for, when it is one of the
+// resources of a basket session or the resource a refund was made against
+const resourceHeader = "resource"
+
+var (
+	kafkaProducer    sarama.SyncProducer
+	kafkaProducerMtx sync.Mutex
+)
+
 // paymentProcessed represents the avro schema which can be found in the chs-kafka-schemas repo
 type paymentProcessed struct {
 	Attempt          int32  `avro:"attempt"`
@@ -23,27 +39,48 @@ type paymentProcessed struct {
 	RefundId         string `avro:"refund_id,omitempty"`
 }
 
-func producePaymentMessage(paymentID string) error {
-	return produceKafkaMessage(paymentID, "")
+func producePaymentMessage(ctx context.Context, paymentID string) error {
+	err := produceKafkaMessage(ctx, paymentID, "")
+	metrics.KafkaPublished("payment", err)
+	return err
 }
 
-func produceRefundMessage(paymentID string, refundID string) error {
-	return produceKafkaMessage(paymentID, refundID)
+func produceRefundMessage(ctx context.Context, paymentID string, refundID string) error {
+	err := produceKafkaMessage(ctx, paymentID, refundID)
+	metrics.KafkaPublished("refund", err)
+	return err
 }
 
-// redirectUser redirects user to the provided redirect_uri with query params
-func redirectUser(w http.ResponseWriter, r *http.Request, redirectURI string, params models.RedirectParams) {
+// redirectUser redirects user to the provided redirect_uri with query params. The params are signed with the calling
+// service's redirect signing key, if it has one, so that it can trust them without calling back to the payments API.
+func redirectUser(w http.ResponseWriter, r *http.Request, redirectURI, clientID string, params models.RedirectParams) {
 	// Redirect the user to the redirect_uri, passing the state, ref and status as query params
 	req, err := http.NewRequest("GET", redirectURI, nil)
 	if err != nil {
-		log.ErrorR(req, fmt.Errorf("error redirecting user: [%s]", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		log.ErrorR(r, fmt.Errorf("error redirecting user: [%s]", err))
+		redirectCallbackError(w, r, params.PaymentID, nil, errorCodeInternalError)
 		return
 	}
+
+	var signingKey []byte
+	if client := paymentService.Config.Client(clientID); client != nil {
+		signingKey = []byte(client.RedirectSigningKey)
+	}
+
 	query := req.URL.Query()
-	query.Add("state", params.State)
-	query.Add("ref", params.Ref)
-	query.Add("status", params.Status)
+	signedParams := redirect.Encode(signingKey, redirect.Params{
+		PaymentID: params.PaymentID,
+		State:     params.State,
+		Ref:       params.Ref,
+		Status:    params.Status,
+		ErrorCode: params.ErrorCode,
+		Timestamp: time.Now(),
+	})
+	for key, values := range signedParams {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
 
 	generatedURL := fmt.Sprintf("%s?%s", redirectURI, query.Encode())
 	log.InfoR(r, "Redirecting to:", log.Data{"generated_url": generatedURL})
@@ -51,22 +88,23 @@ func redirectUser(w http.ResponseWriter, r *http.Request, redirectURI string, pa
 	http.Redirect(w, r, generatedURL, http.StatusSeeOther)
 }
 
-// produceKafkaMessage handles creating a producer, marshalling the payment id into the correct avro schema and sending
-// the message to the topic defined in ProducerTopic
-func produceKafkaMessage(paymentID string, refundID string) error {
+// produceKafkaMessage handles getting the shared producer, marshalling the payment id into the correct avro schema and sending
+// the message to the topic defined in ProducerTopic. The trace context is sent in the message headers.
+func produceKafkaMessage(ctx context.Context, paymentID string, refundID string) (err error) {
 	cfg, err := config.Get()
 	if err != nil {
 		err = fmt.Errorf("error getting config for kafka message production: [%v]", err)
 		return err
 	}
 
-	// Get a producer
-	kafkaProducer, err := producer.New(&producer.Config{Acks: &producer.WaitForAll, BrokerAddrs: cfg.BrokerAddr})
+	_, span, traceHeaders := tracing.StartProducerSpan(ctx, "kafka.publish "+ProducerSchemaName, cfg.PaymentProcessedTopic)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	syncProducer, err := getKafkaProducer(cfg.BrokerAddr)
 	if err != nil {
 		err = fmt.Errorf("error creating kafka producer: [%v]", err)
 		return err
 	}
-	defer closeKafkaProducer(kafkaProducer, paymentID)
 	paymentProcessedSchema, err := schema.Get(cfg.SchemaRegistryURL, ProducerSchemaName)
 	if err != nil {
 		err = fmt.Errorf("error getting schema from schema registry: [%v]", err)
@@ -76,24 +114,42 @@ func produceKafkaMessage(paymentID string, refundID string) error {
 		Definition: paymentProcessedSchema,
 	}
 
-	// Prepare a message with the avro schema
-	message, err := prepareKafkaMessage(paymentID, refundID, *producerSchema)
+	// A basket session's resources are each sent a message of their own
+	resources, err := paymentService.MessageResources(ctx, paymentID, refundID)
 	if err != nil {
-		err = fmt.Errorf("error preparing kafka message with schema: [%v]", err)
+		err = fmt.Errorf("error getting resources to send kafka messages for: [%v]", err)
 		return err
 	}
 
-	// Send the message
-	partition, offset, err := kafkaProducer.Send(message)
-	if err != nil {
-		err = fmt.Errorf("failed to send message in partition: %d at offset %d", partition, offset)
-		return err
+	for _, resource := range resources {
+		// Prepare a message with the avro schema
+		message, err := prepareKafkaMessage(paymentID, refundID, resource, *producerSchema, traceHeaders)
+		if err != nil {
+			err = fmt.Errorf("error preparing kafka message with schema: [%v]", err)
+			return err
+		}
+
+		// Send the message
+		partition, offset, err := syncProducer.SendMessage(message)
+		if err != nil {
+			err = fmt.Errorf("failed to send message in partition: %d at offset %d", partition, offset)
+			return err
+		}
+
+		// Each message is recorded as sent once it has been, so that when a later one fails only the messages still
+		// pending are sent again by the process-pending-messages job
+		if refundID == "" {
+			err = paymentService.PaymentMessagesSent(ctx, paymentID, []string{resource})
+			if err != nil {
+				log.Error(err, log.Data{"payment_id": paymentID, "resource": resource})
+			}
+		}
 	}
 	return nil
 }
 
 // prepareKafkaMessage is pulled out of produceKafkaMessage() to allow unit testing of non-kafka portion of code
-func prepareKafkaMessage(paymentID string, refundID string, paymentProcessedSchema avro.Schema) (*producer.Message, error) {
+func prepareKafkaMessage(paymentID string, refundID string, resource string, paymentProcessedSchema avro.Schema, headers map[string]string) (*sarama.ProducerMessage, error) {
 	cfg, err := config.Get()
 	if err != nil {
 		err = fmt.Errorf("error getting config for kafka message production: [%v]", err)
@@ -107,17 +163,60 @@ func prepareKafkaMessage(paymentID string, refundID string, paymentProcessedSche
 		return nil, err
 	}
 
-	producerMessage := &producer.Message{
-		Value: messageBytes,
+	producerMessage := &sarama.ProducerMessage{
+		Value: sarama.ByteEncoder(messageBytes),
 		Topic: cfg.PaymentProcessedTopic,
 	}
+	// Headers are added in key order so that the messages sent for a session are alike
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		producerMessage.Headers = append(producerMessage.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(headers[key])})
+	}
+	// The registry's payment-processed schema has no field for the resource, so it is named in a header
+	if resource != "" {
+		producerMessage.Headers = append(producerMessage.Headers, sarama.RecordHeader{Key: []byte(resourceHeader), Value: []byte(resource)})
+	}
 	return producerMessage, nil
 }
 
-// closeKafkaProducer closes the kafkaProducer after the message has been sent
-func closeKafkaProducer(kafkaProducer *producer.Producer, paymentID string) {
-	err := kafkaProducer.Close()
+// getKafkaProducer returns the producer shared by all requests, creating it on first use
+func getKafkaProducer(brokerAddrs []string) (sarama.SyncProducer, error) {
+	kafkaProducerMtx.Lock()
+	defer kafkaProducerMtx.Unlock()
+
+	if kafkaProducer != nil {
+		return kafkaProducer, nil
+	}
+
+	// The chs.go producer can't send message headers, so the messages are sent with sarama, which needs at least
+	// Kafka 0.11 for them
+	producerConfig := sarama.NewConfig()
+	producerConfig.Version = sarama.V1_0_0_0
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	producerConfig.Producer.Return.Successes = true
+
+	p, err := sarama.NewSyncProducer(brokerAddrs, producerConfig)
 	if err != nil {
-		log.Error(fmt.Errorf("error closing kafka producer for payment ID [%s]", paymentID))
+		return nil, err
+	}
+	kafkaProducer = p
+	return kafkaProducer, nil
+}
+
+// CloseKafkaProducer closes the shared kafka producer. It must only be called once no more messages will be sent,
+// i.e. after the HTTP server has drained.
+func CloseKafkaProducer() error {
+	kafkaProducerMtx.Lock()
+	defer kafkaProducerMtx.Unlock()
+
+	if kafkaProducer == nil {
+		return nil
 	}
+	err := kafkaProducer.Close()
+	kafkaProducer = nil
+	return err
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+)
+
+// HandleCreatePayerLink issues a link letting someone other than its creator pay a payment session
+func HandleCreatePayerLink(w http.ResponseWriter, req *http.Request) {
+	// get payment resource from context, put there by PaymentAuthenticationInterceptor
+	paymentSession, ok := req.Context().Value(helpers.ContextKeyPaymentSession).(*models.PaymentResourceRest)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("invalid PaymentResourceRest in request context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// A payer can only pay the session, the link is managed by its creator
+	if _, isPayer := req.Context().Value(helpers.ContextKeyPayer).(*models.CreatedByRest); isPayer {
+		log.ErrorR(req, fmt.Errorf("payer link can't be issued through a payer link"), log.Data{"payment_id": paymentSession.MetaData.ID})
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	payerLink, responseType, err := paymentService.CreatePayerLink(req, paymentSession)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error creating payer link: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID, "service_response_type": responseType.String()})
+		switch responseType {
+		case service.InvalidData:
+			w.Header().Set(contentType, applicationJsonResponseType)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(payerLink)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+
+	log.InfoR(req, "Successful POST request for payer link", log.Data{"payment_id": paymentSession.MetaData.ID})
+}
+
+// HandleRevokePayerLink revokes the link issued to let someone other than its creator pay a payment session
+func HandleRevokePayerLink(w http.ResponseWriter, req *http.Request) {
+	// get payment resource from context, put there by PaymentAuthenticationInterceptor
+	paymentSession, ok := req.Context().Value(helpers.ContextKeyPaymentSession).(*models.PaymentResourceRest)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("invalid PaymentResourceRest in request context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if _, isPayer := req.Context().Value(helpers.ContextKeyPayer).(*models.CreatedByRest); isPayer {
+		log.ErrorR(req, fmt.Errorf("payer link can't be revoked through a payer link"), log.Data{"payment_id": paymentSession.MetaData.ID})
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	responseType, err := paymentService.RevokePayerLink(req, paymentSession)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error revoking payer link: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID, "service_response_type": responseType.String()})
+		switch responseType {
+		case service.NotFound:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	log.InfoR(req, "Successful DELETE request for payer link", log.Data{"payment_id": paymentSession.MetaData.ID})
+}
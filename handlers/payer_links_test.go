@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newPayerLinkRequest(method string, paymentSession *models.PaymentResourceRest) *http.Request {
+	req := httptest.NewRequest(method, "/test", nil)
+	return req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, paymentSession))
+}
+
+func TestUnitHandleCreatePayerLink(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	payerLinkCfg := *cfg
+	payerLinkCfg.PayerLinkSigningKey = "payer-link-signing-key-of-32-chars"
+
+	paymentSession := func() *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Status:    service.InProgress.String(),
+			CreatedAt: time.Now(),
+			MetaData:  models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+	}
+
+	Convey("Payment session not in context", t, func() {
+		w := httptest.NewRecorder()
+		HandleCreatePayerLink(w, httptest.NewRequest("POST", "/test", nil))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payer can't issue another payer link", t, func() {
+		req := newPayerLinkRequest("POST", paymentSession())
+		req = req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyPayer, &models.CreatedByRest{ID: "payer"}))
+
+		w := httptest.NewRecorder()
+		HandleCreatePayerLink(w, req)
+		So(w.Code, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("Pay-on-behalf links not enabled", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleCreatePayerLink(w, newPayerLinkRequest("POST", paymentSession()))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Error saving payer link", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().SetPayerLink(gomock.Any(), "1234", gomock.Any()).Return(errors.New("error"))
+		paymentService = createMockPaymentService(mock, &payerLinkCfg)
+
+		w := httptest.NewRecorder()
+		HandleCreatePayerLink(w, newPayerLinkRequest("POST", paymentSession()))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payer link issued", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().SetPayerLink(gomock.Any(), "1234", gomock.Any()).Return(nil)
+		paymentService = createMockPaymentService(mock, &payerLinkCfg)
+
+		w := httptest.NewRecorder()
+		HandleCreatePayerLink(w, newPayerLinkRequest("POST", paymentSession()))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		var response models.PayerLinkRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Link, ShouldContainSubstring, "/payments/1234/pay?payer_token=")
+		So(response.Kind, ShouldEqual, service.PayerLinkKind)
+	})
+}
+
+func TestUnitHandleRevokePayerLink(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	paymentSession := func(payerLink *models.PayerLink) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{MetaData: models.PaymentResourceMetaDataRest{ID: "1234", PayerLink: payerLink}}
+	}
+
+	Convey("Payer can't revoke the payer link", t, func() {
+		req := newPayerLinkRequest("DELETE", paymentSession(&models.PayerLink{ID: "link"}))
+		req = req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyPayer, &models.CreatedByRest{ID: "payer"}))
+
+		w := httptest.NewRecorder()
+		HandleRevokePayerLink(w, req)
+		So(w.Code, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("No payer link to revoke", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleRevokePayerLink(w, newPayerLinkRequest("DELETE", paymentSession(nil)))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Error revoking payer link", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().RevokePayerLink(gomock.Any(), "1234", "link", gomock.Any()).Return(false, errors.New("error"))
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleRevokePayerLink(w, newPayerLinkRequest("DELETE", paymentSession(&models.PayerLink{ID: "link"})))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payer link revoked", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().RevokePayerLink(gomock.Any(), "1234", "link", gomock.Any()).Return(true, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleRevokePayerLink(w, newPayerLinkRequest("DELETE", paymentSession(&models.PayerLink{ID: "link"})))
+		So(w.Code, ShouldEqual, http.StatusNoContent)
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/gorilla/mux"
+)
+
+// HandleOverridePaymentSession applies an admin override to the outcome of a payment session, and produces the payment
+// processed message so that the override is acted on as a callback's outcome would be
+func HandleOverridePaymentSession(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["payment_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("payment id not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var incomingPaymentOverride models.IncomingPaymentOverride
+	err := json.NewDecoder(req.Body).Decode(&incomingPaymentOverride)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The email of the admin making the override, put there by AdminRoleIntercept
+	userID, ok := req.Context().Value(helpers.ContextKeyUserID).(string)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("error user details not found in context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	paymentSession, responseType, err := paymentService.OverridePaymentSession(req, id, incomingPaymentOverride, userID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error overriding payment session: [%v]", err), log.Data{"payment_id": id, "service_response_type": responseType.String()})
+		switch responseType {
+		case service.InvalidData:
+			w.Header().Set(contentType, applicationJsonResponseType)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+			return
+		case service.Conflict:
+			w.Header().Set(contentType, applicationJsonResponseType)
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if responseType == service.NotFound {
+		log.ErrorR(req, fmt.Errorf("payment session not found. id: %s", id))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// A message that fails to send is left pending on the session, and sent again by process-pending-messages
+	err = handlePaymentMessage(req.Context(), id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err), log.Data{"payment_id": id})
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(paymentSession)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleGetPaymentOverrides returns the overrides made to the outcome of a payment session
+func HandleGetPaymentOverrides(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["payment_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("payment id not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	overrides, responseType, err := paymentService.GetPaymentOverrides(req, id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting payment overrides: [%v]", err), log.Data{"payment_id": id, "service_response_type": responseType.String()})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if responseType == service.NotFound {
+		log.ErrorR(req, fmt.Errorf("payment session not found. id: %s", id))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(overrides)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitHandleOverridePaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	body := `{"override":"paid-offline","reason":"Paid by cheque at the front desk","evidence_reference":"CHQ-0001"}`
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest("POST", "/admin/payments/1234/overrides", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
+		return req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyUserID, "admin@companieshouse.gov.uk"))
+	}
+
+	inProgressSession := func() *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{
+			ID:   "1234",
+			Data: models.PaymentResourceDataDB{Amount: "10.00", Status: service.InProgress.String()},
+		}
+	}
+
+	Convey("Payment ID not supplied", t, func() {
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, httptest.NewRequest("POST", "/test", strings.NewReader(body)))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Request body invalid", t, func() {
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest("{"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("User not in context", t, func() {
+		req := httptest.NewRequest("POST", "/test", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, req)
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Invalid override", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest(`{"override":"paid-offline"}`))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+
+		var response models.ErrorResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldStartWith, "invalid payment override")
+	})
+
+	Convey("Payment session not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Payment session can't be overridden", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{
+			ID:   "1234",
+			Data: models.PaymentResourceDataDB{Status: service.Paid.String()},
+		}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusConflict)
+
+		var response models.ErrorResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldEqual, "payment session with status [paid] can't be overridden")
+	})
+
+	Convey("Error overriding payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(inProgressSession(), nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, errors.New("error"))
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Error producing payment processed message leaves it to be sent again", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(inProgressSession(), nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(true, nil)
+		allowResourceClaims(mock)
+		paymentService = createMockPaymentService(mock, cfg)
+		handlePaymentMessage = mockProduceKafkaMessageError
+
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("Override applied and payment processed message produced", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(inProgressSession(), nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(true, nil)
+		allowResourceClaims(mock)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		var messagePaymentID string
+		handlePaymentMessage = func(_ context.Context, paymentID string) error {
+			messagePaymentID = paymentID
+			return nil
+		}
+
+		w := httptest.NewRecorder()
+		HandleOverridePaymentSession(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(messagePaymentID, ShouldEqual, "1234")
+
+		var response models.PaymentResourceRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Status, ShouldEqual, service.Paid.String())
+		So(response.PaymentMethod, ShouldEqual, service.PaymentMethodOffline)
+	})
+}
+
+func TestUnitHandleGetPaymentOverrides(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", "/admin/payments/1234/overrides", nil)
+		return mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
+	}
+
+	Convey("Payment ID not supplied", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetPaymentOverrides(w, httptest.NewRequest("GET", "/admin/payments//overrides", nil))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Error getting payment overrides", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, errors.New("error"))
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentOverrides(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payment session not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentOverrides(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Payment overrides returned", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{
+			ID: "1234",
+			History: []models.PaymentHistoryDB{
+				{Action: service.OverrideWaived, PreviousStatus: service.Pending.String(), Status: service.Paid.String(), Actor: "admin@companieshouse.gov.uk"},
+			},
+		}, nil)
+		paymentService = createMockPaymentService(mock, cfg)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentOverrides(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response []models.PaymentHistoryRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response, ShouldHaveLength, 1)
+		So(response[0].Action, ShouldEqual, service.OverrideWaived)
+		So(response[0].Actor, ShouldEqual, "admin@companieshouse.gov.uk")
+	})
+}
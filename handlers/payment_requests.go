@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreatePaymentRequest raises a payment request for an ad-hoc charge and returns the link to share with the payer
+func HandleCreatePaymentRequest(w http.ResponseWriter, req *http.Request) {
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var incomingPaymentRequest models.IncomingPaymentRequest
+	err := json.NewDecoder(req.Body).Decode(&incomingPaymentRequest)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The email of the admin raising the request, put there by AdminRoleIntercept
+	userID, ok := req.Context().Value(helpers.ContextKeyUserID).(string)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("error user details not found in context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	paymentRequest, responseType, err := paymentService.CreatePaymentRequest(req, incomingPaymentRequest, userID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error creating payment request: [%v]", err), log.Data{"service_response_type": responseType.String()})
+		switch responseType {
+		case service.InvalidData:
+			w.Header().Set(contentType, applicationJsonResponseType)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+	w.Header().Set("Location", paymentRequest.Links.Journey)
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(paymentRequest)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleGetPaymentRequestCosts serves the costs of a payment request from its resource, in the same form as the cost
+// resources of other services
+func HandleGetPaymentRequestCosts(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["payment_request_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("payment request ID not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	costs, responseType, err := paymentService.GetPaymentRequestCosts(req, id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting payment request costs: [%v]", err), log.Data{"service_response_type": responseType.String()})
+		switch responseType {
+		case service.CostsNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(costs)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
+
+// HandleGetPaymentRequest retrieves a payment request
+func HandleGetPaymentRequest(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["payment_request_id"]
+	if id == "" {
+		log.ErrorR(req, fmt.Errorf("payment request ID not supplied"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	paymentRequest, responseType, err := paymentService.GetPaymentRequest(req, id)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error getting payment request: [%v]", err), log.Data{"service_response_type": responseType.String()})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if responseType == service.NotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(paymentRequest)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+}
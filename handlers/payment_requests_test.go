@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitHandleCreatePaymentRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	cfg.PaymentsWebURL = "http://payments.web"
+
+	body := `{"amount":"25","class_of_payment":"data-maintenance","description":"Dishonoured cheque fee","company_number":"00006400"}`
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest("POST", "/admin/payments/payment-requests", strings.NewReader(body))
+		return req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyUserID, "admin@companieshouse.gov.uk"))
+	}
+
+	Convey("Request body invalid", t, func() {
+		w := httptest.NewRecorder()
+		HandleCreatePaymentRequest(w, newRequest("{"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("User not in context", t, func() {
+		w := httptest.NewRecorder()
+		HandleCreatePaymentRequest(w, httptest.NewRequest("POST", "/admin/payments/payment-requests", strings.NewReader(body)))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Invalid payment request", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		w := httptest.NewRecorder()
+		HandleCreatePaymentRequest(w, newRequest(`{"amount":"25","class_of_payment":"unknown","description":"Fee"}`))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldContainSubstring, "payment class [unknown] not recognised")
+	})
+
+	Convey("Error creating payment request", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().CreatePaymentRequest(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+
+		w := httptest.NewRecorder()
+		HandleCreatePaymentRequest(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payment request created", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().CreatePaymentRequest(gomock.Any(), gomock.Any()).Return(nil)
+
+		w := httptest.NewRecorder()
+		HandleCreatePaymentRequest(w, newRequest(body))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+
+		var paymentRequest models.PaymentRequestRest
+		So(json.NewDecoder(w.Body).Decode(&paymentRequest), ShouldBeNil)
+		So(paymentRequest.Amount, ShouldEqual, "25.00")
+		So(paymentRequest.CreatedBy, ShouldEqual, "admin@companieshouse.gov.uk")
+		So(w.Header().Get("Location"), ShouldEqual, paymentRequest.Links.Journey)
+		So(paymentRequest.Links.Journey, ShouldStartWith, "http://payments.web/payment-requests/")
+	})
+}
+
+func TestUnitHandleGetPaymentRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", "/admin/payments/payment-requests/1234", nil)
+		return mux.SetURLVars(req, map[string]string{"payment_request_id": "1234"})
+	}
+
+	Convey("Payment request ID not supplied", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequest(w, httptest.NewRequest("GET", "/admin/payments/payment-requests/", nil))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Error getting payment request", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, errors.New("error"))
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequest(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payment request not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, nil)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequest(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Payment request found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(&models.PaymentRequestDB{ID: "1234", Amount: "25.00"}, nil)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequest(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldContainSubstring, `"amount":"25.00"`)
+	})
+}
+
+func TestUnitHandleGetPaymentRequestCosts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", "/payment-requests/1234/costs", nil)
+		return mux.SetURLVars(req, map[string]string{"payment_request_id": "1234"})
+	}
+
+	Convey("Payment request ID not supplied", t, func() {
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequestCosts(w, httptest.NewRequest("GET", "/payment-requests//costs", nil))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Error getting payment request", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, errors.New("error"))
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequestCosts(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payment request not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, nil)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequestCosts(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Payment request costs found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		paymentService = createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(&models.PaymentRequestDB{ID: "1234", Amount: "25.00", ClassOfPayment: "data-maintenance"}, nil)
+
+		w := httptest.NewRecorder()
+		HandleGetPaymentRequestCosts(w, newRequest())
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldContainSubstring, `"amount":"25.00"`)
+		So(w.Body.String(), ShouldContainSubstring, "/payment-requests/1234/costs")
+	})
+}
@@ -2,9 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
@@ -38,8 +38,27 @@ func HandleCreatePaymentSession(w http.ResponseWriter, req *http.Request) {
 		log.ErrorR(req, fmt.Errorf("error creating payment resource: [%v]", err), log.Data{"service_response_type": responseType.String()})
 		switch responseType {
 		case service.InvalidData:
+			var redirectErr *service.RedirectURINotAllowedError
+			if errors.As(err, &redirectErr) {
+				// Name the offending origin so the calling service can tell which allow list entry is missing
+				w.Header().Set(contentType, applicationJsonResponseType)
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(models.ErrorResponse{Error: redirectErr.Error()})
+				return
+			}
 			w.WriteHeader(http.StatusBadRequest)
 			return
+		case service.Conflict:
+			var duplicateErr *service.DuplicatePaymentError
+			if errors.As(err, &duplicateErr) {
+				// Link to the existing session so the calling service can resume it rather than pay twice
+				w.Header().Set(contentType, applicationJsonResponseType)
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(models.DuplicatePaymentResponse{Error: duplicateErr.Error(), Links: duplicateErr.Links})
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			return
 		case service.Error:
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -49,6 +68,16 @@ func HandleCreatePaymentSession(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// A session with nothing to pay is completed as it is created, so is processed like any other completed payment.
+	// Its message is sent again by the process-pending-messages job should it fail now. One which couldn't be completed
+	// yet is processed once its journey completes it.
+	if paymentResource.PaymentMethod == service.PaymentMethodNoPaymentRequired && paymentResource.Status == service.Paid.String() {
+		err = handlePaymentMessage(req.Context(), paymentResource.MetaData.ID)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err), log.Data{"payment_id": paymentResource.MetaData.ID})
+		}
+	}
+
 	// response body contains fully decorated REST model
 	w.Header().Set(contentType, applicationJsonResponseType)
 	w.Header().Set("Location", paymentResource.Links.Journey)
@@ -76,20 +105,15 @@ func HandleGetPaymentSession(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Check if the payment session is expired
-	isExpired, err := service.IsExpired(*paymentSession, &paymentService.Config)
-	if err != nil {
-		log.ErrorR(req, fmt.Errorf("error checking payment session expiry status: [%v]", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	isExpired := service.IsExpired(*paymentSession, &paymentService.Config)
 
-	if isExpired && paymentSession.Status != service.Paid.String() {
+	if isExpired && !service.IsPaidStatus(paymentSession.Status) {
 		paymentSession.Status = service.Expired.String()
 	}
 
 	w.Header().Set(contentType, applicationJsonResponseType)
 
-	err = json.NewEncoder(w).Encode(paymentSession)
+	err := json.NewEncoder(w).Encode(paymentSession)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
 		w.WriteHeader(http.StatusInternalServerError)
@@ -110,12 +134,7 @@ func HandlePatchPaymentSession(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Check if the payment session is expired
-	isExpired, err := service.IsExpired(*paymentSession, &paymentService.Config)
-	if err != nil {
-		log.ErrorR(req, fmt.Errorf("error checking payment session expiry status: [%v]", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	isExpired := service.IsExpired(*paymentSession, &paymentService.Config)
 
 	if isExpired {
 		log.ErrorR(req, fmt.Errorf("payment session has expired"))
@@ -131,7 +150,7 @@ func HandlePatchPaymentSession(w http.ResponseWriter, req *http.Request) {
 
 	requestDecoder := json.NewDecoder(req.Body)
 	var PaymentResourceUpdateData models.PaymentResourceRest
-	err = requestDecoder.Decode(&PaymentResourceUpdateData)
+	err := requestDecoder.Decode(&PaymentResourceUpdateData)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
 		w.WriteHeader(http.StatusBadRequest)
@@ -150,17 +169,111 @@ func HandlePatchPaymentSession(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// The user choosing the payment method is recorded as paying the session when they came through a pay-on-behalf
+	// link, put in the context by PaymentAuthenticationInterceptor. The creator choosing it takes the session back.
+	PaymentResourceUpdateData.PaidBy = nil
+	if payer, ok := req.Context().Value(helpers.ContextKeyPayer).(*models.CreatedByRest); ok {
+		PaymentResourceUpdateData.PaidBy = payer
+	} else if paymentSession.PaidBy != nil {
+		PaymentResourceUpdateData.PaidBy = &paymentSession.CreatedBy
+	}
+
+	// A session with nothing to pay is completed by the patch, whatever payment method is chosen. Its message is sent
+	// again by the process-pending-messages job should it fail now.
+	if service.NoPaymentRequired(paymentSession) {
+		completingSession := *paymentSession
+		completingSession.PaidBy = PaymentResourceUpdateData.PaidBy
+		completed, responseType, err := paymentService.CompleteNoPaymentRequiredSession(req, &completingSession)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error completing payment resource: [%v]", err), log.Data{"service_response_type": responseType.String()})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if completed {
+			err = handlePaymentMessage(req.Context(), paymentSession.MetaData.ID)
+			if err != nil {
+				log.ErrorR(req, fmt.Errorf("error producing payment kafka message: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID})
+			}
+		}
+		log.InfoR(req, "Successful PATCH request for payment resource", log.Data{"payment_id": paymentSession.MetaData.ID, "status": http.StatusOK})
+		return
+	}
+
 	responseType, err := paymentService.PatchPaymentSession(req, paymentSession.MetaData.ID, PaymentResourceUpdateData)
 
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error patching payment resource: [%v]", err), log.Data{"service_response_type": responseType.String()})
-		w.WriteHeader(http.StatusInternalServerError)
+		switch responseType {
+		case service.Conflict:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
 
 	log.InfoR(req, "Successful PATCH request for payment resource", log.Data{"payment_id": paymentSession.MetaData.ID, "status": http.StatusOK})
 }
 
+// HandleExtendPaymentSession moves the time a payment session expires on, for journeys which need longer to pay
+func HandleExtendPaymentSession(w http.ResponseWriter, req *http.Request) {
+	// get payment resource from context, put there by PaymentAuthenticationInterceptor
+	paymentSession, ok := req.Context().Value(helpers.ContextKeyPaymentSession).(*models.PaymentResourceRest)
+	if !ok {
+		log.ErrorR(req, fmt.Errorf("invalid PaymentResourceRest in request context"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// A payer can only pay the session, how long it can be paid for is up to its creator
+	if _, isPayer := req.Context().Value(helpers.ContextKeyPayer).(*models.CreatedByRest); isPayer {
+		log.ErrorR(req, fmt.Errorf("payment session can't be extended through a payer link"), log.Data{"payment_id": paymentSession.MetaData.ID})
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if req.Body == nil {
+		log.ErrorR(req, fmt.Errorf("request body empty"))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var extendRequest models.ExtendPaymentSessionRequest
+	err := json.NewDecoder(req.Body).Decode(&extendRequest)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("request body invalid: [%v]", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	extendedSession, responseType, err := paymentService.ExtendPaymentSession(req, paymentSession, extendRequest)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error extending payment session: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID, "service_response_type": responseType.String()})
+		switch responseType {
+		case service.InvalidData:
+			w.Header().Set(contentType, applicationJsonResponseType)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: err.Error()})
+		case service.Conflict:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set(contentType, applicationJsonResponseType)
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(extendedSession)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		return
+	}
+
+	log.InfoR(req, "Successful POST request to extend payment session", log.Data{"payment_id": paymentSession.MetaData.ID, "expires_at": extendedSession.ExpiresAt})
+}
+
 // HandleGetPaymentDetails retrieves the payment details from the external provider
 func HandleGetPaymentDetails(externalPaymentSvc *service.ExternalPaymentProvidersService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -178,9 +291,15 @@ func HandleGetPaymentDetails(externalPaymentSvc *service.ExternalPaymentProvider
 		var err error
 		switch paymentSession.PaymentMethod {
 		case "credit-card":
-			statusResponse, responseType, err = externalPaymentSvc.GovPayService.GetPaymentDetails(paymentSession)
+			statusResponse, responseType, err = externalPaymentSvc.GovPayService.GetPaymentDetails(req.Context(), paymentSession)
 		case "PayPal":
-			statusResponse, responseType, err = externalPaymentSvc.PayPalService.GetPaymentDetails(paymentSession)
+			statusResponse, responseType, err = externalPaymentSvc.PayPalService.GetPaymentDetails(req.Context(), paymentSession)
+		case service.PaymentMethodAccount:
+			statusResponse, responseType, err = externalPaymentSvc.AccountService.GetPaymentDetails(req.Context(), paymentSession)
+		case service.PaymentMethodBankTransfer:
+			statusResponse, responseType, err = externalPaymentSvc.BankTransferService.GetPaymentDetails(req.Context(), paymentSession)
+		case service.PaymentMethodNoPaymentRequired, service.PaymentMethodOffline, service.PaymentMethodWaived:
+			statusResponse, responseType = service.PaymentDetailsWithoutProvider(paymentSession), service.Success
 		default:
 			err := fmt.Errorf("payment method [%s] for resource [%s] not recognised", paymentSession.PaymentMethod, paymentSession.Links.Self)
 			log.ErrorR(req, err)
@@ -211,7 +330,7 @@ func HandleGetPaymentDetails(externalPaymentSvc *service.ExternalPaymentProvider
 func HandleCheckPaymentStatus(w http.ResponseWriter, req *http.Request) {
 	log.InfoR(req, "received request to check payment statuses")
 
-	incompletePayments, err := paymentService.GetIncompletePayments(&paymentService.Config)
+	incompletePayments, err := paymentService.GetIncompletePayments(req.Context(), &paymentService.Config)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error getting in-progress payments: %w", err))
 		w.WriteHeader(http.StatusInternalServerError)
@@ -243,7 +362,7 @@ func HandleCheckPaymentStatus(w http.ResponseWriter, req *http.Request) {
 			log.ErrorR(req, fmt.Errorf("error getting payment session for paymentID [%s]: [%w]", pendingPayment.MetaData.ID, err))
 			continue
 		}
-		finished, status, providerID, err := externalPaymentService.GovPayService.GetPaymentStatus(paymentSession)
+		finished, status, providerID, err := externalPaymentService.GovPayService.GetPaymentStatus(req.Context(), paymentSession)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error getting status for paymentID [%s]: [%w]", pendingPayment.MetaData.ID, err))
 			continue
@@ -254,11 +373,24 @@ func HandleCheckPaymentStatus(w http.ResponseWriter, req *http.Request) {
 			continue
 		}
 
-		completedAt := time.Now().Truncate(time.Millisecond)
+		paymentSession.Status = status
+		paymentSession.ProviderID = providerID
+		paymentSession.CompletedAt = helpers.MongoNow()
+
+		// update payment status in DB, unless the payment has been completed by its callback in the meantime
+		completed, _, err := paymentService.CompletePaymentSession(req, pendingPayment.MetaData.ID, "", *paymentSession)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error patching DB for paymentID [%s]: [%w]", pendingPayment.MetaData.ID, err))
+			continue
+		}
+		if !completed {
+			log.InfoR(req, fmt.Sprintf("Payment [%s] already completed, skipping.", pendingPayment.MetaData.ID))
+			continue
+		}
 
 		if status == "paid" {
 			// payment has been successful, continue processing
-			err = handlePaymentMessage(pendingPayment.MetaData.ID)
+			err = handlePaymentMessage(req.Context(), pendingPayment.MetaData.ID)
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error producing payment kafka message for paymentID [%s]: [%w]", pendingPayment.MetaData.ID, err))
 				continue
@@ -266,31 +398,50 @@ func HandleCheckPaymentStatus(w http.ResponseWriter, req *http.Request) {
 			log.InfoR(req, fmt.Sprintf("kafka message successfully published for paymentID [%s]", pendingPayment.MetaData.ID))
 		}
 
-		paymentSession.Status = status
-		paymentSession.CompletedAt = completedAt
 		updatedPayments = append(updatedPayments, *paymentSession)
+	}
 
-		// update payment status in DB
-		paymentUpdate := models.PaymentResourceRest{
-			Status:      status,
-			ProviderID:  providerID,
-			CompletedAt: completedAt,
-		}
+	w.Header().Set(contentType, applicationJsonResponseType)
+
+	err = json.NewEncoder(w).Encode(updatedPayments)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-		_, err = paymentService.PatchPaymentSession(req, pendingPayment.MetaData.ID, paymentUpdate)
+	log.InfoR(req, "finished checking payment statuses")
+}
+
+// HandleProcessPendingMessages sends the payment processed messages which failed to send when their payment sessions
+// were completed, returning the sessions whose messages have now been sent
+func HandleProcessPendingMessages(w http.ResponseWriter, req *http.Request) {
+	log.InfoR(req, "received request to process pending payment messages")
+
+	paymentSessions, err := paymentService.GetPaymentSessionsWithMessagesPending(req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sentPayments := make([]models.PaymentResourceRest, 0)
+	for _, paymentSession := range paymentSessions {
+		err = handlePaymentMessage(req.Context(), paymentSession.MetaData.ID)
 		if err != nil {
-			log.ErrorR(req, fmt.Errorf("error patching DB for paymentID [%s]: [%w]", pendingPayment.MetaData.ID, err))
+			log.ErrorR(req, fmt.Errorf("error producing payment kafka message for paymentID [%s]: [%w]", paymentSession.MetaData.ID, err))
+			continue
 		}
+		sentPayments = append(sentPayments, paymentSession)
 	}
 
 	w.Header().Set(contentType, applicationJsonResponseType)
 
-	err = json.NewEncoder(w).Encode(updatedPayments)
+	err = json.NewEncoder(w).Encode(sentPayments)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf(errorWritingResponse, err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	log.InfoR(req, "finished checking payment statuses")
+	log.InfoR(req, "finished processing pending payment messages", log.Data{"sent": len(sentPayments), "pending": len(paymentSessions)})
 }
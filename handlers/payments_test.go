@@ -48,7 +48,7 @@ func TestUnitHandleCreatePaymentSession(t *testing.T) {
 
 	Convey("Error creating payment resource - no authentication details", t, func() {
 		paymentService = &service.PaymentService{
-			Config: config.Config{DomainAllowList: "http://www.companieshouse.gov.uk"},
+			Config: config.Config{Settings: config.Settings{DomainAllowList: []string{"http://www.companieshouse.gov.uk"}, RedirectAllowList: []string{"http://www.companieshouse.gov.uk"}}},
 		}
 
 		b := []byte(`{"redirect_uri":"http://www.companieshouse.gov.uk", "reference":"invalid", "resource": "http://www.companieshouse.gov.uk", "state": "invalid"}`)
@@ -59,13 +59,31 @@ func TestUnitHandleCreatePaymentSession(t *testing.T) {
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
 	})
 
+	Convey("Error creating payment resource - redirect_uri not allowed", t, func() {
+		paymentService = &service.PaymentService{
+			Config: config.Config{Settings: config.Settings{DomainAllowList: []string{"http://www.companieshouse.gov.uk"}, RedirectAllowList: []string{"http://www.companieshouse.gov.uk"}}},
+		}
+
+		b := []byte(`{"redirect_uri":"https://evil.example.com/callback", "reference":"invalid", "resource": "http://www.companieshouse.gov.uk", "state": "invalid"}`)
+		req := httptest.NewRequest("GET", "/test", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+
+		HandleCreatePaymentSession(w, req)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+
+		var response models.ErrorResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldEqual, "redirect_uri origin [https://evil.example.com] is not allowed")
+	})
+
 	Convey("Create payment resource - success", t, func() {
 		mockDao := dao.NewMockDAO(gomock.NewController(t))
-		mockDao.EXPECT().CreatePaymentResource(gomock.Any()).Return(nil)
+		mockDao.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "https://www.companieshouse.gov.uk", gomock.Any())
+		mockDao.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).Return(nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
-			Config: config.Config{DomainAllowList: "https://www.companieshouse.gov.uk"},
+			Config: config.Config{Settings: config.Settings{DomainAllowList: []string{"https://www.companieshouse.gov.uk"}, RedirectAllowList: []string{"https://www.companieshouse.gov.uk"}}},
 		}
 
 		httpmock.Activate()
@@ -90,25 +108,124 @@ func TestUnitHandleCreatePaymentSession(t *testing.T) {
 		So(w.Code, ShouldEqual, http.StatusCreated)
 	})
 
-}
+	Convey("Create payment resource - nothing to pay", t, func() {
+		noPaymentRequest := func(completeErr, messageErr error) (*httptest.ResponseRecorder, int) {
+			mockDao := dao.NewMockDAO(gomock.NewController(t))
+			allowResourceClaims(mockDao)
+			mockDao.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "https://www.companieshouse.gov.uk", gomock.Any())
+			mockDao.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+			mockDao.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(completeErr == nil, completeErr)
+
+			paymentService = &service.PaymentService{
+				DAO:    mockDao,
+				Config: config.Config{Settings: config.Settings{DomainAllowList: []string{"https://www.companieshouse.gov.uk"}, RedirectAllowList: []string{"https://www.companieshouse.gov.uk"}}},
+			}
+
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			freeCosts := defaultCosts
+			freeCost := defaultCost
+			freeCost.Amount = "0"
+			freeCosts.Costs = []models.CostResourceRest{freeCost}
+			jsonResponse, _ := httpmock.NewJsonResponder(200, freeCosts)
+			httpmock.RegisterResponder("GET", "https://www.companieshouse.gov.uk", jsonResponse)
+
+			messages := 0
+			handlePaymentMessage = func(_ context.Context, _ string) error {
+				messages++
+				return messageErr
+			}
+
+			b := []byte(`{"redirect_uri":"https://www.companieshouse.gov.uk", "reference":"invalid", "resource": "https://www.companieshouse.gov.uk", "state": "invalid"}`)
+			req := httptest.NewRequest("GET", "/test", bytes.NewReader(b))
+			w := httptest.NewRecorder()
+			ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, authentication.AuthUserDetails{ID: "id"})
+
+			HandleCreatePaymentSession(w, req.WithContext(ctx))
+			return w, messages
+		}
 
-func TestUnitHandleGetPaymentSession(t *testing.T) {
+		Convey("Session completed and payment processed message produced", func() {
+			w, messages := noPaymentRequest(nil, nil)
+			So(w.Code, ShouldEqual, http.StatusCreated)
+			So(messages, ShouldEqual, 1)
+
+			var response models.PaymentResourceRest
+			So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+			So(response.Status, ShouldEqual, service.Paid.String())
+			So(response.PaymentMethod, ShouldEqual, service.PaymentMethodNoPaymentRequired)
+			So(w.Header().Get("Location"), ShouldContainSubstring, "/callback/payments/no-payment-required/")
+		})
+
+		Convey("Error producing payment processed message leaves it to be sent again", func() {
+			w, messages := noPaymentRequest(nil, fmt.Errorf("error"))
+			So(w.Code, ShouldEqual, http.StatusCreated)
+			So(messages, ShouldEqual, 1)
+		})
+
+		Convey("Error completing session returns it in progress to be completed by its journey", func() {
+			w, messages := noPaymentRequest(fmt.Errorf("error"), nil)
+			So(w.Code, ShouldEqual, http.StatusCreated)
+			So(messages, ShouldEqual, 0)
+
+			var response models.PaymentResourceRest
+			So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+			So(response.Status, ShouldEqual, service.InProgress.String())
+			So(response.CompletedAt, ShouldBeZeroValue)
+			So(w.Header().Get("Location"), ShouldContainSubstring, "/callback/payments/no-payment-required/")
+		})
+	})
 
-	Convey("Invalid PaymentResourceRest", t, func() {
-		req := httptest.NewRequest("GET", "/test", nil)
+	Convey("Error creating payment resource - resource already has a paid session", t, func() {
+		mockDao := dao.NewMockDAO(gomock.NewController(t))
+		mockDao.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "https://www.companieshouse.gov.uk", gomock.Any()).Return([]models.PaymentResourceDB{
+			{
+				ID: "existing",
+				Data: models.PaymentResourceDataDB{
+					Status: service.Paid.String(),
+					Links: models.PaymentLinksDB{
+						Journey:  "https://payments.companieshouse.gov.uk/payments/existing/pay",
+						Resource: "https://www.companieshouse.gov.uk",
+						Self:     "payments/existing",
+					},
+				},
+			},
+		}, nil)
+
+		paymentService = &service.PaymentService{
+			DAO:    mockDao,
+			Config: config.Config{Settings: config.Settings{DomainAllowList: []string{"https://www.companieshouse.gov.uk"}, RedirectAllowList: []string{"https://www.companieshouse.gov.uk"}}},
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "https://www.companieshouse.gov.uk", jsonResponse)
+
+		b := []byte(`{"redirect_uri":"https://www.companieshouse.gov.uk", "reference":"invalid", "resource": "https://www.companieshouse.gov.uk", "state": "invalid"}`)
+		req := httptest.NewRequest("GET", "/test", bytes.NewReader(b))
 		w := httptest.NewRecorder()
-		HandleGetPaymentSession(w, req)
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, authentication.AuthUserDetails{ID: "id"})
+
+		HandleCreatePaymentSession(w, req.WithContext(ctx))
+		So(w.Code, ShouldEqual, http.StatusConflict)
+
+		var response models.DuplicatePaymentResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldEqual, "cost resource [https://www.companieshouse.gov.uk] already has payment session [payments/existing] with status [paid]")
+		So(response.Links.Self, ShouldEqual, "payments/existing")
+		So(response.Links.Journey, ShouldEqual, "https://payments.companieshouse.gov.uk/payments/existing/pay")
 	})
 
-	Convey("Error checking expiry status", t, func() {
-		req := httptest.NewRequest("GET", "/test", nil)
+}
 
-		paymentResource := models.PaymentResourceRest{}
-		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+func TestUnitHandleGetPaymentSession(t *testing.T) {
 
+	Convey("Invalid PaymentResourceRest", t, func() {
+		req := httptest.NewRequest("GET", "/test", nil)
 		w := httptest.NewRecorder()
-		HandleGetPaymentSession(w, req.WithContext(ctx))
+		HandleGetPaymentSession(w, req)
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
 	})
 
@@ -122,7 +239,7 @@ func TestUnitHandleGetPaymentSession(t *testing.T) {
 		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
 
 		cfg, _ := config.Get()
-		cfg.ExpiryTimeInMinutes = "90"
+		cfg.ExpiryTimeInMinutes = 90
 		paymentService = &service.PaymentService{
 			DAO:    dao.NewMockDAO(gomock.NewController(t)),
 			Config: *cfg,
@@ -137,6 +254,36 @@ func TestUnitHandleGetPaymentSession(t *testing.T) {
 		decoder.Decode(&rest)
 		So(rest.Status, ShouldEqual, service.Expired.String())
 	})
+
+	cfg, _ := config.Get()
+	paymentService = &service.PaymentService{Config: *cfg}
+	statuses := []struct {
+		description string
+		status      string
+		expiresAt   time.Time
+		expected    string
+	}{
+		{"Session awaiting a bank transfer", service.AwaitingTransfer.String(), time.Now().Add(time.Hour), service.AwaitingTransfer.String()},
+		{"Session expired awaiting a bank transfer", service.AwaitingTransfer.String(), time.Now().Add(-time.Hour), service.Expired.String()},
+		{"Session expired before the rest of its bank transfer arrived", service.Underpaid.String(), time.Now().Add(-time.Hour), service.Expired.String()},
+		{"Paid session past its expiry", service.Paid.String(), time.Now().Add(-time.Hour), service.Paid.String()},
+		{"Overpaid session past its expiry", service.Overpaid.String(), time.Now().Add(-time.Hour), service.Overpaid.String()},
+	}
+	for _, tc := range statuses {
+		Convey(tc.description, t, func() {
+			req := httptest.NewRequest("GET", "/test", nil)
+			paymentResource := models.PaymentResourceRest{Status: tc.status, ExpiresAt: tc.expiresAt}
+			ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+
+			w := httptest.NewRecorder()
+			HandleGetPaymentSession(w, req.WithContext(ctx))
+			So(w.Code, ShouldEqual, http.StatusOK)
+
+			var rest models.PaymentResourceRest
+			json.NewDecoder(w.Body).Decode(&rest)
+			So(rest.Status, ShouldEqual, tc.expected)
+		})
+	}
 }
 
 func TestUnitHandlePatchPaymentSession(t *testing.T) {
@@ -150,18 +297,6 @@ func TestUnitHandlePatchPaymentSession(t *testing.T) {
 		So(w.Code, ShouldEqual, http.StatusInternalServerError)
 	})
 
-	Convey("Error checking expiry status - config not set", t, func() {
-		req := httptest.NewRequest("GET", "/test", nil)
-
-		paymentResource := models.PaymentResourceRest{}
-		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
-		paymentService.Config.ExpiryTimeInMinutes = ""
-
-		w := httptest.NewRecorder()
-		HandlePatchPaymentSession(w, req.WithContext(ctx))
-		So(w.Code, ShouldEqual, http.StatusInternalServerError)
-	})
-
 	Convey("Patch Payment Session - Payment session expired", t, func() {
 		req := httptest.NewRequest("GET", "/test", nil)
 		twoHours, _ := time.ParseDuration("2h")
@@ -171,7 +306,7 @@ func TestUnitHandlePatchPaymentSession(t *testing.T) {
 		}
 		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
 
-		paymentService.Config.ExpiryTimeInMinutes = "90"
+		paymentService.Config.ExpiryTimeInMinutes = 90
 
 		w := httptest.NewRecorder()
 		HandlePatchPaymentSession(w, req.WithContext(ctx))
@@ -228,7 +363,7 @@ func TestUnitHandlePatchPaymentSession(t *testing.T) {
 		payment := models.PaymentResourceDB{
 			Data: models.PaymentResourceDataDB{Status: "pending"},
 		}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
 			Config: *cfg,
@@ -261,8 +396,48 @@ func TestUnitHandlePatchPaymentSession(t *testing.T) {
 		httpmock.RegisterResponder("GET", "companieshouse.gov.uk", jsonResponse)
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		paymentService = &service.PaymentService{
+			DAO:    mockDao,
+			Config: *cfg,
+		}
+
+		w := httptest.NewRecorder()
+		HandlePatchPaymentSession(w, req.WithContext(ctx))
+		So(w.Code, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("Patch through a payer link records the payer", t, func() {
+		b := []byte(`{"payment_method": "credit-card", "paid_by": {"id": "someone-else"}}`)
+		req := httptest.NewRequest("PATCH", "/test", bytes.NewReader(b))
+		paymentResource := models.PaymentResourceRest{
+			CreatedAt: time.Now(),
+		}
+		payer := &models.CreatedByRest{ID: "payer", Email: "finance@client.co.uk"}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+		ctx = context.WithValue(ctx, helpers.ContextKeyPayer, payer)
+
+		payment := models.PaymentResourceDB{
+			Data: models.PaymentResourceDataDB{
+				Amount: "10.00",
+				Status: "pending",
+				Links:  models.PaymentLinksDB{Resource: "companieshouse.gov.uk"},
+			},
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "companieshouse.gov.uk", jsonResponse)
+
+		var update *models.PaymentResourceDB
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, paymentUpdate *models.PaymentResourceDB) error {
+			update = paymentUpdate
+			return nil
+		})
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
 			Config: *cfg,
@@ -271,10 +446,239 @@ func TestUnitHandlePatchPaymentSession(t *testing.T) {
 		w := httptest.NewRecorder()
 		HandlePatchPaymentSession(w, req.WithContext(ctx))
 		So(w.Code, ShouldEqual, http.StatusOK)
+		So(update.Data.PaidBy, ShouldResemble, &models.CreatedByDB{ID: "payer", Email: "finance@client.co.uk"})
+	})
+
+	Convey("Patch by the creator takes back a session a payer chose the payment method for", t, func() {
+		b := []byte(`{"payment_method": "credit-card"}`)
+		req := httptest.NewRequest("PATCH", "/test", bytes.NewReader(b))
+		paymentResource := models.PaymentResourceRest{
+			CreatedAt: time.Now(),
+			CreatedBy: models.CreatedByRest{ID: "agent"},
+			PaidBy:    &models.CreatedByRest{ID: "payer"},
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+
+		payment := models.PaymentResourceDB{
+			Data: models.PaymentResourceDataDB{
+				Amount: "10.00",
+				Status: "pending",
+				Links:  models.PaymentLinksDB{Resource: "companieshouse.gov.uk"},
+			},
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "companieshouse.gov.uk", jsonResponse)
+
+		var update *models.PaymentResourceDB
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, paymentUpdate *models.PaymentResourceDB) error {
+			update = paymentUpdate
+			return nil
+		})
+		paymentService = &service.PaymentService{
+			DAO:    mockDao,
+			Config: *cfg,
+		}
+
+		w := httptest.NewRecorder()
+		HandlePatchPaymentSession(w, req.WithContext(ctx))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(update.Data.PaidBy, ShouldResemble, &models.CreatedByDB{ID: "agent"})
+	})
+
+	Convey("Session whose last attempt failed is no longer awaiting a retry", t, func() {
+		b := []byte(`{"payment_method": "PayPal"}`)
+		req := httptest.NewRequest("GET", "/test", bytes.NewReader(b))
+		paymentResource := models.PaymentResourceRest{
+			CreatedAt: time.Now(),
+		}
+		ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+
+		payment := models.PaymentResourceDB{
+			Data: models.PaymentResourceDataDB{
+				Amount: "10.00",
+				Status: service.Failed.String(),
+				Links:  models.PaymentLinksDB{Resource: "companieshouse.gov.uk"},
+			},
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "companieshouse.gov.uk", jsonResponse)
+
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().ReopenPaymentResource(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(false, nil)
+		paymentService = &service.PaymentService{
+			DAO:    mockDao,
+			Config: *cfg,
+		}
+
+		w := httptest.NewRecorder()
+		HandlePatchPaymentSession(w, req.WithContext(ctx))
+		So(w.Code, ShouldEqual, http.StatusConflict)
+	})
+
+	Convey("Patch of a session with nothing to pay", t, func() {
+		freePatch := func(status string, completed bool, completeErr, messageErr error) (*httptest.ResponseRecorder, string) {
+			b := []byte(`{"payment_method": "credit-card"}`)
+			req := httptest.NewRequest("GET", "/test", bytes.NewReader(b))
+			paymentResource := models.PaymentResourceRest{
+				Amount:    "0.00",
+				CreatedAt: time.Now(),
+				Status:    status,
+				Links:     models.PaymentLinksRest{Resource: "companieshouse.gov.uk"},
+				MetaData:  models.PaymentResourceMetaDataRest{ID: "1234"},
+			}
+			ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+
+			mockDao := dao.NewMockDAO(mockCtrl)
+			allowResourceClaims(mockDao)
+			if status == service.Pending.String() {
+				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(nil)
+			}
+			mockDao.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(completed, completeErr)
+			paymentService = &service.PaymentService{
+				DAO:    mockDao,
+				Config: *cfg,
+			}
+
+			var messagePaymentID string
+			handlePaymentMessage = func(_ context.Context, paymentID string) error {
+				messagePaymentID = paymentID
+				return messageErr
+			}
+
+			w := httptest.NewRecorder()
+			HandlePatchPaymentSession(w, req.WithContext(ctx))
+			return w, messagePaymentID
+		}
+
+		Convey("Pending session completed and payment processed message produced", func() {
+			w, messagePaymentID := freePatch(service.Pending.String(), true, nil, nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(messagePaymentID, ShouldEqual, "1234")
+		})
+
+		Convey("Session whose completion failed is completed by a retried patch", func() {
+			w, messagePaymentID := freePatch(service.InProgress.String(), true, nil, nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(messagePaymentID, ShouldEqual, "1234")
+		})
+
+		Convey("Session completed by another patch produces no message", func() {
+			w, messagePaymentID := freePatch(service.InProgress.String(), false, nil, nil)
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(messagePaymentID, ShouldBeEmpty)
+		})
+
+		Convey("Error producing payment processed message leaves it to be sent again", func() {
+			w, messagePaymentID := freePatch(service.Pending.String(), true, nil, fmt.Errorf("error"))
+			So(w.Code, ShouldEqual, http.StatusOK)
+			So(messagePaymentID, ShouldEqual, "1234")
+		})
+
+		Convey("Error completing session", func() {
+			w, messagePaymentID := freePatch(service.Pending.String(), false, fmt.Errorf("error"), nil)
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(messagePaymentID, ShouldBeEmpty)
+		})
 	})
 
 }
 
+func TestUnitHandleExtendPaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	expiryCfg := *cfg
+	expiryCfg.MinExpiryTimeInMinutes = 15
+	expiryCfg.MaxExpiryTimeInMinutes = 1440
+
+	extendRequest := func(body string) *http.Request {
+		paymentSession := &models.PaymentResourceRest{
+			Status:    service.InProgress.String(),
+			CreatedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Hour),
+			MetaData:  models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+		req := httptest.NewRequest("POST", "/test", bytes.NewBufferString(body))
+		return req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, paymentSession))
+	}
+
+	Convey("Payment session not in context", t, func() {
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, httptest.NewRequest("POST", "/test", nil))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payer can't extend the payment session", t, func() {
+		req := extendRequest(`{"expiry_time_in_minutes":120}`)
+		req = req.WithContext(context.WithValue(req.Context(), helpers.ContextKeyPayer, &models.CreatedByRest{ID: "payer"}))
+
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, req)
+		So(w.Code, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("Request body invalid", t, func() {
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, extendRequest("invalid"))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Expiry time outside the bounds", t, func() {
+		paymentService = createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, extendRequest(`{"expiry_time_in_minutes":2000}`))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+
+		var response models.ErrorResponse
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.Error, ShouldEqual, "expiry_time_in_minutes must be between 15 and 1440")
+	})
+
+	Convey("Payment session changed status while it was extended", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, nil)
+		paymentService = createMockPaymentService(mock, &expiryCfg)
+
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, extendRequest(`{"expiry_time_in_minutes":120}`))
+		So(w.Code, ShouldEqual, http.StatusConflict)
+	})
+
+	Convey("Error extending payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, fmt.Errorf("error"))
+		paymentService = createMockPaymentService(mock, &expiryCfg)
+
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, extendRequest(`{"expiry_time_in_minutes":120}`))
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Payment session extended", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(true, nil)
+		paymentService = createMockPaymentService(mock, &expiryCfg)
+
+		w := httptest.NewRecorder()
+		HandleExtendPaymentSession(w, extendRequest(`{"expiry_time_in_minutes":120}`))
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var response models.PaymentResourceRest
+		So(json.NewDecoder(w.Body).Decode(&response), ShouldBeNil)
+		So(response.ExpiresAt, ShouldHappenWithin, time.Second, time.Now().Add(120*time.Minute))
+	})
+}
+
 func TestUnitHandleGetPaymentDetails(t *testing.T) {
 
 	cfg, _ := config.Get()
@@ -329,6 +733,29 @@ func TestUnitHandleGetPaymentDetails(t *testing.T) {
 		So(res.Code, ShouldEqual, http.StatusInternalServerError)
 	})
 
+	Convey("Payment details of a session completed without a payment provider", t, func() {
+		for _, paymentMethod := range []string{service.PaymentMethodNoPaymentRequired, service.PaymentMethodOffline, service.PaymentMethodWaived} {
+			Convey(paymentMethod, func() {
+				handler := HandleGetPaymentDetails(&service.ExternalPaymentProvidersService{})
+
+				res := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/test", nil)
+				paymentResource := models.PaymentResourceRest{
+					PaymentMethod: paymentMethod,
+					CompletedAt:   time.Date(2018, 11, 22, 8, 39, 16, 782000000, time.UTC),
+				}
+				ctx := context.WithValue(req.Context(), helpers.ContextKeyPaymentSession, &paymentResource)
+				handler.ServeHTTP(res, req.WithContext(ctx))
+
+				So(res.Code, ShouldEqual, http.StatusOK)
+				var paymentDetails models.PaymentDetails
+				So(json.NewDecoder(res.Body).Decode(&paymentDetails), ShouldBeNil)
+				So(paymentDetails.PaymentStatus, ShouldEqual, "accepted")
+				So(paymentDetails.TransactionDate, ShouldEqual, "2018-11-22T08:39:16.782Z")
+			})
+		}
+	})
+
 	Convey("Error getting payment details from external provider", t, func() {
 		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
 		mockPayPalSDK := service.NewMockPayPalSDK(mockCtrl)
@@ -470,7 +897,8 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		w := httptest.NewRecorder()
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(nil, fmt.Errorf("err"))
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("err"))
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
 			Config: *cfg,
@@ -485,7 +913,8 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		w := httptest.NewRecorder()
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(nil, nil)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(nil, nil)
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
 			Config: *cfg,
@@ -507,8 +936,9 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		paymentsDB := []models.PaymentResourceDB{{ID: "id"}}
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(paymentsDB, nil)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(nil, fmt.Errorf("err"))
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("err"))
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
 			Config: *cfg,
@@ -537,8 +967,9 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		paymentsDB := []models.PaymentResourceDB{paymentDB}
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(paymentsDB, nil)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentDB, nil)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentDB, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -574,8 +1005,9 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		paymentsDB := []models.PaymentResourceDB{paymentDB}
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(paymentsDB, nil)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentDB, nil)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentDB, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -617,8 +1049,10 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		paymentsDB := []models.PaymentResourceDB{paymentDB}
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(paymentsDB, nil)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentDB, nil).AnyTimes()
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentDB, nil).AnyTimes()
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -665,9 +1099,10 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		paymentsDB := []models.PaymentResourceDB{paymentDB}
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(paymentsDB, nil)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentDB, nil).AnyTimes()
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentDB, nil).AnyTimes()
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(true, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -714,9 +1149,10 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		paymentsDB := []models.PaymentResourceDB{paymentDB}
 
 		mockDao := dao.NewMockDAO(mockCtrl)
-		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(paymentsDB, nil)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentDB, nil).AnyTimes()
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("err"))
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentDB, nil).AnyTimes()
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(false, fmt.Errorf("err"))
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -737,7 +1173,7 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		externalPaymentResponse, _ := httpmock.NewJsonResponder(200, govPayResponse)
 		httpmock.RegisterResponder("GET", "externalPayProvider.gov.uk", externalPaymentResponse)
 
-		handlePaymentMessage = mockProduceKafkaMessage
+		handlePaymentMessage = mockProduceKafkaMessageError
 
 		HandleCheckPaymentStatus(w, req)
 		So(w.Code, ShouldEqual, http.StatusOK)
@@ -745,6 +1181,104 @@ func TestUnitHandleCheckPaymentStatus(t *testing.T) {
 		decoder := json.NewDecoder(w.Body)
 		var rest []models.PaymentResourceRest
 		decoder.Decode(&rest)
+		So(len(rest), ShouldBeZeroValue)
+	})
+
+	Convey("Payment already completed by its callback", t, func() {
+		req := httptest.NewRequest("GET", "/test", nil)
+		w := httptest.NewRecorder()
+
+		paymentDB := models.PaymentResourceDB{
+			ID: "id",
+			Data: models.PaymentResourceDataDB{
+				Amount: "10.00",
+				Links:  models.PaymentLinksDB{Resource: "companieshouse.gov.uk"},
+			},
+			ExternalPaymentStatusURI: "externalPayProvider.gov.uk",
+		}
+		paymentsDB := []models.PaymentResourceDB{paymentDB}
+
+		mockDao := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mockDao)
+		mockDao.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(paymentsDB, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentDB, nil).AnyTimes()
+		mockDao.EXPECT().CompletePaymentResource(gomock.Any(), "id", "", gomock.Any()).Return(false, nil)
+
+		paymentService = &service.PaymentService{
+			DAO:    mockDao,
+			Config: *cfg,
+		}
+
+		govPayResponse := models.IncomingGovPayResponse{
+			State: models.State{
+				Finished: true,
+				Status:   "success",
+			},
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		paymentResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "companieshouse.gov.uk", paymentResponse)
+		externalPaymentResponse, _ := httpmock.NewJsonResponder(200, govPayResponse)
+		httpmock.RegisterResponder("GET", "externalPayProvider.gov.uk", externalPaymentResponse)
+
+		messages := 0
+		handlePaymentMessage = func(_ context.Context, _ string) error {
+			messages++
+			return nil
+		}
+
+		HandleCheckPaymentStatus(w, req)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(messages, ShouldEqual, 0)
+
+		decoder := json.NewDecoder(w.Body)
+		var rest []models.PaymentResourceRest
+		decoder.Decode(&rest)
+		So(len(rest), ShouldBeZeroValue)
+	})
+}
+
+func TestUnitHandleProcessPendingMessages(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error getting payment sessions with messages pending", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPaymentResourcesWithMessagesPending(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
+		paymentService = &service.PaymentService{DAO: mockDao, Config: *cfg}
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		w := httptest.NewRecorder()
+		HandleProcessPendingMessages(w, req)
+		So(w.Code, ShouldEqual, http.StatusInternalServerError)
+	})
+
+	Convey("Only the sessions whose messages were sent are returned", t, func() {
+		mockDao := dao.NewMockDAO(mockCtrl)
+		mockDao.EXPECT().GetPaymentResourcesWithMessagesPending(gomock.Any(), gomock.Any()).Return([]models.PaymentResourceDB{
+			{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00"}, MessagesPending: []string{""}},
+			{ID: "5678", Data: models.PaymentResourceDataDB{Amount: "20.00"}, MessagesPending: []string{""}},
+		}, nil)
+		paymentService = &service.PaymentService{DAO: mockDao, Config: *cfg}
+
+		handlePaymentMessage = func(_ context.Context, paymentID string) error {
+			if paymentID == "1234" {
+				return fmt.Errorf("error")
+			}
+			return nil
+		}
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		w := httptest.NewRecorder()
+		HandleProcessPendingMessages(w, req)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		var rest []models.PaymentResourceRest
+		json.NewDecoder(w.Body).Decode(&rest)
 		So(len(rest), ShouldEqual, 1)
+		So(rest[0].Amount, ShouldEqual, "20.00")
 	})
 }
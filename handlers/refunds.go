@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/mappers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
 	"github.com/gorilla/mux"
@@ -69,6 +70,14 @@ func HandleCreateRefund(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// A refund credited back to an account is complete once made, so isn't picked up when pending refunds are processed
+	if refund.Status == mappers.RefundStatusSuccess {
+		err = handleRefundMessage(req.Context(), id, refund.RefundId)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error producing refund kafka message: [%v]", err))
+		}
+	}
+
 	w.Header().Set(contentType, applicationJsonResponseType)
 	w.WriteHeader(http.StatusCreated)
 
@@ -197,7 +206,7 @@ func processKafkaSendMessage(req *http.Request, payments []models.PaymentResourc
 	for _, i := range payments {
 		x := i
 		refund := x.Refunds[0]
-		err := handleRefundMessage(x.ID, refund.RefundId)
+		err := handleRefundMessage(req.Context(), x.ID, refund.RefundId)
 		if err != nil {
 			log.ErrorR(req, fmt.Errorf("error producing refund kafka message: [%v]", err))
 		}
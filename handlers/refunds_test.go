@@ -89,7 +89,7 @@ func TestUnitGetPaymentRefunds(t *testing.T) {
 
 		req = mux.SetURLVars(req, vars)
 
-		mockDao.EXPECT().GetPaymentRefunds(gomock.Any()).Return(refundDatas, nil)
+		mockDao.EXPECT().GetPaymentRefunds(gomock.Any(), gomock.Any()).Return(refundDatas, nil)
 
 		HandleGetRefunds(w, req)
 		So(w.Code, ShouldEqual, http.StatusOK)
@@ -124,7 +124,7 @@ func TestUnitHandleProcessPendingRefundsWithPaymentRefunds(t *testing.T) {
 	paymentsPaidStatus = append(paymentsPaidStatus, paymentPaidStatus)
 
 	Convey("Successful request - with payment refunds", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return(nil, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return(nil, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -179,7 +179,7 @@ func TestUnitHandleProcessPendingRefundsWithResponseTypeError(t *testing.T) {
 		errorResponse := errors.New("error retrieving payments with pending refunds status")
 		errorList = append(errorList, errorResponse)
 
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return(nil, errorResponse)
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return(nil, errorResponse)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -206,7 +206,7 @@ func TestUnitHandleProcessPendingRefundsWithResponseTypeError(t *testing.T) {
 	})
 
 	Convey("Successful request - with no payment response", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return(nil, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return(nil, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -258,7 +258,7 @@ func TestUnitHandleProcessPendingRefundsWithNoPayment(t *testing.T) {
 	paymentsPaidStatus = append(paymentsPaidStatus, paymentPaidStatus)
 
 	Convey("Successful request - with no payment response", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return(nil, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return(nil, nil)
 
 		paymentService = &service.PaymentService{
 			DAO:    mockDao,
@@ -11,8 +11,12 @@ import (
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/interceptors"
+	"github.com/companieshouse/payments.api.ch.gov.uk/lifecycle"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 	"github.com/gorilla/mux"
 )
 
@@ -43,16 +47,23 @@ func Register(mainRouter *mux.Router, cfg config.Config, paymentsDao dao.DAO) {
 		os.Exit(1)
 	}
 
-	payPalService := &service.PayPalService{Client: payPalClient, PaymentService: *paymentService}
+	payPalService := &service.PayPalService{Client: service.NewInstrumentedPayPalClient(payPalClient), PaymentService: *paymentService}
+
+	accountService := &service.AccountService{PaymentService: *paymentService}
+
+	bankTransferService := &service.BankTransferService{PaymentService: *paymentService}
 
 	externalPaymentService = &service.ExternalPaymentProvidersService{
-		GovPayService: *govPayService,
-		PayPalService: *payPalService,
+		GovPayService:       *govPayService,
+		PayPalService:       *payPalService,
+		AccountService:      *accountService,
+		BankTransferService: *bankTransferService,
 	}
 
 	refundService = &service.RefundService{
 		GovPayService:  govPayService,
 		PayPalService:  payPalService,
+		AccountService: accountService,
 		PaymentService: paymentService,
 		DAO:            paymentsDao,
 		Config:         cfg,
@@ -63,6 +74,7 @@ func Register(mainRouter *mux.Router, cfg config.Config, paymentsDao dao.DAO) {
 	}
 
 	mainRouter.HandleFunc("/healthcheck", healthCheck).Methods("GET").Name("get-healthcheck")
+	mainRouter.Handle("/metrics", metrics.Handler()).Methods("GET").Name("get-metrics")
 
 	// Create subrouters. All routes except /callback need auth middleware, so router needs to be split up. This allows
 	// per-subrouter middleware.
@@ -75,6 +87,11 @@ func Register(mainRouter *mux.Router, cfg config.Config, paymentsDao dao.DAO) {
 	getPaymentRouter := mainRouter.PathPrefix("/payments/{payment_id}").Subrouter()
 	getPaymentRouter.HandleFunc("", HandleGetPaymentSession).Methods("GET").Name("get-payment")
 
+	// payer-link endpoints need payment and user auth, and are only for the creator of the payment
+	payerLinkRouter := mainRouter.PathPrefix("/payments/{payment_id}/payer-link").Subrouter()
+	payerLinkRouter.HandleFunc("", HandleCreatePayerLink).Methods("POST").Name("create-payer-link")
+	payerLinkRouter.HandleFunc("", HandleRevokePayerLink).Methods("DELETE").Name("revoke-payer-link")
+
 	// payment-details endpoint needs it's own interceptor
 	paymentDetailsRouter := mainRouter.PathPrefix("/private/payments/{payment_id}/payment-details").Subrouter()
 	paymentDetailsRouter.Handle("", HandleGetPaymentDetails(externalPaymentService)).Methods("GET").Name("get-payment-details")
@@ -82,6 +99,12 @@ func Register(mainRouter *mux.Router, cfg config.Config, paymentsDao dao.DAO) {
 	paymentStatusRouter := mainRouter.PathPrefix("/private/payments/status-check").Subrouter()
 	paymentStatusRouter.HandleFunc("", HandleCheckPaymentStatus).Methods("POST").Name("check-payment-status")
 
+	paymentMessagesRouter := mainRouter.PathPrefix("/private/payments/process-pending-messages").Subrouter()
+	paymentMessagesRouter.HandleFunc("", HandleProcessPendingMessages).Methods("POST").Name("process-pending-messages")
+
+	accountDebitsRouter := mainRouter.PathPrefix("/private/payments/process-pending-account-debits").Subrouter()
+	accountDebitsRouter.HandleFunc("", HandleProcessPendingAccountDebits).Methods("POST").Name("process-pending-account-debits")
+
 	// create-refund endpoint needs its own interceptor
 	createRefundRouter := mainRouter.PathPrefix("/payments/{paymentId}/refunds").Subrouter()
 	createRefundRouter.HandleFunc("", HandleCreateRefund).Methods("POST").Name("create-refund")
@@ -104,6 +127,9 @@ func Register(mainRouter *mux.Router, cfg config.Config, paymentsDao dao.DAO) {
 	privateJourneyRouter := mainRouter.PathPrefix("/private/payments/{payment_id}/external-journey").Subrouter()
 	privateJourneyRouter.Handle("", HandleCreateExternalPaymentJourney(externalPaymentService)).Methods("POST").Name("create-external-payment-journey")
 
+	privateExtendRouter := mainRouter.PathPrefix("/private/payments/{payment_id}/extend").Subrouter()
+	privateExtendRouter.HandleFunc("", HandleExtendPaymentSession).Methods("POST").Name("extend-payment")
+
 	// Admin router will handle all the routes with an admin prefix
 	// and will be intercepted to check for the admin role
 	adminRouter := mainRouter.PathPrefix("/admin/payments/bulk-refunds").Subrouter()
@@ -112,25 +138,68 @@ func Register(mainRouter *mux.Router, cfg config.Config, paymentsDao dao.DAO) {
 	adminRouter.HandleFunc("/paypal", HandlePayPalBulkRefund).Methods("POST").Name("bulk-refund-paypal")
 	adminRouter.HandleFunc("/process-pending", HandleProcessBulkPendingRefunds).Methods("POST").Name("process-bulk-refund")
 
+	paymentRequestRouter := mainRouter.PathPrefix("/admin/payments/payment-requests").Subrouter()
+	paymentRequestRouter.HandleFunc("", HandleCreatePaymentRequest).Methods("POST").Name("create-payment-request")
+	paymentRequestRouter.HandleFunc("/{payment_request_id}", HandleGetPaymentRequest).Methods("GET").Name("get-payment-request")
+
+	// payment-request-costs endpoint is the resource payment sessions for payment requests are created with, so is
+	// served to users rather than admins
+	paymentRequestCostsRouter := mainRouter.PathPrefix("/payment-requests/{payment_request_id}/costs").Subrouter()
+	paymentRequestCostsRouter.HandleFunc("", HandleGetPaymentRequestCosts).Methods("GET").Name("get-payment-request-costs")
+
+	paymentOverrideRouter := mainRouter.PathPrefix("/admin/payments/{payment_id}/overrides").Subrouter()
+	paymentOverrideRouter.HandleFunc("", HandleOverridePaymentSession).Methods("POST").Name("override-payment")
+	paymentOverrideRouter.HandleFunc("", HandleGetPaymentOverrides).Methods("GET").Name("get-payment-overrides")
+
+	accountRouter := mainRouter.PathPrefix("/admin/payments/accounts").Subrouter()
+	accountRouter.HandleFunc("", HandleCreateAccount).Methods("POST").Name("create-account")
+	accountRouter.HandleFunc("/{account_id}", HandleGetAccount).Methods("GET").Name("get-account")
+	accountRouter.HandleFunc("/{account_id}", HandleUpdateAccountStatus).Methods("PATCH").Name("update-account-status")
+	accountRouter.HandleFunc("/{account_id}/top-ups", HandleTopUpAccount).Methods("POST").Name("top-up-account")
+	accountRouter.HandleFunc("/{account_id}/statement", HandleGetAccountStatement).Methods("GET").Name("get-account-statement")
+
+	bankStatementRouter := mainRouter.PathPrefix("/admin/payments/bank-statements").Subrouter()
+	bankStatementRouter.HandleFunc("", HandleImportBankStatement).Methods("POST").Name("import-bank-statement")
+	bankStatementRouter.HandleFunc("/exceptions", HandleGetBankCreditExceptions).Methods("GET").Name("get-bank-credit-exceptions")
+
 	// callback endpoints should not be intercepted by the paymentauth or userauth interceptors, so needs to be it's own subrouter
 	callbackRouter := mainRouter.PathPrefix("/callback").Subrouter()
 	callbackRouter.Handle("/payments/govpay/{payment_id}", HandleGovPayCallback(govPayService)).Methods("GET").Name("handle-govpay-callback")
 	callbackRouter.Handle("/payments/paypal/orders/{payment_id}", HandlePayPalCallback(payPalService)).Methods("GET").Name("handle-paypal-callback")
+	callbackRouter.HandleFunc("/payments/no-payment-required/{payment_id}", HandleNoPaymentRequiredCallback).Methods("GET").Name("handle-no-payment-required-callback")
+	callbackRouter.HandleFunc("/payments/account/{payment_id}", HandleAccountCallback).Methods("GET").Name("handle-account-callback")
+	callbackRouter.HandleFunc("/payments/bank-transfer/{payment_id}", HandleBankTransferCallback).Methods("GET").Name("handle-bank-transfer-callback")
+
+	// Trace every request and record its latency against its route name
+	mainRouter.Use(tracing.Handler, metrics.InstrumentHandler)
 
 	// Set middleware for subrouters
 	createPaymentRouter.Use(log.Handler, interceptors.Oauth2OrPaymentPrivilegesIntercept, interceptors.UserPaymentAuthenticationIntercept)
 	getPaymentRouter.Use(interceptors.UserPaymentAuthenticationIntercept, pa.PaymentAuthenticationIntercept)
 	paymentDetailsRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, interceptors.InternalOrPaymentPrivilegesIntercept, pa.PaymentAuthenticationIntercept)
 	paymentStatusRouter.Use(log.Handler, interceptors.InternalOrPaymentPrivilegesIntercept)
+	paymentMessagesRouter.Use(log.Handler, interceptors.InternalOrPaymentPrivilegesIntercept)
 	createRefundRouter.Use(log.Handler, authentication.ElevatedPrivilegesInterceptor)
 	updateRefundRouter.Use(log.Handler, authentication.ElevatedPrivilegesInterceptor)
 	refundRouter.Use(log.Handler, interceptors.InternalOrPaymentPrivilegesIntercept)
 	privatePatchRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, pa.PaymentAuthenticationIntercept)
 	privateJourneyRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, pa.PaymentAuthenticationIntercept)
+	privateExtendRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, pa.PaymentAuthenticationIntercept)
+	payerLinkRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, pa.PaymentAuthenticationIntercept)
 	adminRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, interceptors.PaymentAdminAuthenticationIntercept)
+	paymentRequestRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, interceptors.AdminRoleIntercept(helpers.AdminPaymentRequestRole))
+	paymentRequestCostsRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept)
+	paymentOverrideRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, interceptors.AdminRoleIntercept(helpers.AdminPaymentOverrideRole))
+	accountRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, interceptors.AdminRoleIntercept(helpers.AdminAccountRole))
+	bankStatementRouter.Use(log.Handler, interceptors.UserPaymentAuthenticationIntercept, interceptors.AdminRoleIntercept(helpers.AdminBankTransferRole))
 	callbackRouter.Use(log.Handler)
 }
 
+// healthCheck reports the service as unavailable once it has started draining so that no new work is routed to it
 func healthCheck(w http.ResponseWriter, _ *http.Request) {
+	if lifecycle.IsDraining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/lifecycle"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
@@ -27,10 +28,16 @@ func TestUnitRegisterRoutes(t *testing.T) {
 
 		Register(router, *cfg, mockDao)
 		So(router.GetRoute("get-healthcheck"), ShouldNotBeNil)
+		So(router.GetRoute("get-metrics"), ShouldNotBeNil)
 		So(router.GetRoute("create-payment"), ShouldNotBeNil)
 		So(router.GetRoute("get-payment"), ShouldNotBeNil)
+		So(router.GetRoute("create-payer-link"), ShouldNotBeNil)
+		So(router.GetRoute("revoke-payer-link"), ShouldNotBeNil)
+		So(router.GetRoute("extend-payment"), ShouldNotBeNil)
 		So(router.GetRoute("get-payment-details"), ShouldNotBeNil)
 		So(router.GetRoute("check-payment-status"), ShouldNotBeNil)
+		So(router.GetRoute("process-pending-messages"), ShouldNotBeNil)
+		So(router.GetRoute("process-pending-account-debits"), ShouldNotBeNil)
 		So(router.GetRoute("create-refund"), ShouldNotBeNil)
 		So(router.GetRoute("get-refunds"), ShouldNotBeNil)
 		So(router.GetRoute("update-refund"), ShouldNotBeNil)
@@ -38,11 +45,26 @@ func TestUnitRegisterRoutes(t *testing.T) {
 		So(router.GetRoute("create-external-payment-journey"), ShouldNotBeNil)
 		So(router.GetRoute("handle-govpay-callback"), ShouldNotBeNil)
 		So(router.GetRoute("handle-paypal-callback"), ShouldNotBeNil)
+		So(router.GetRoute("handle-no-payment-required-callback"), ShouldNotBeNil)
+		So(router.GetRoute("handle-account-callback"), ShouldNotBeNil)
+		So(router.GetRoute("handle-bank-transfer-callback"), ShouldNotBeNil)
 		So(router.GetRoute("bulk-refund-govpay"), ShouldNotBeNil)
 		So(router.GetRoute("bulk-refund-paypal"), ShouldNotBeNil)
 		So(router.GetRoute("get-refund-statuses"), ShouldNotBeNil)
 		So(router.GetRoute("process-bulk-refund"), ShouldNotBeNil)
 		So(router.GetRoute("process-pending-refunds"), ShouldNotBeNil)
+		So(router.GetRoute("create-payment-request"), ShouldNotBeNil)
+		So(router.GetRoute("get-payment-request"), ShouldNotBeNil)
+		So(router.GetRoute("get-payment-request-costs"), ShouldNotBeNil)
+		So(router.GetRoute("override-payment"), ShouldNotBeNil)
+		So(router.GetRoute("get-payment-overrides"), ShouldNotBeNil)
+		So(router.GetRoute("create-account"), ShouldNotBeNil)
+		So(router.GetRoute("get-account"), ShouldNotBeNil)
+		So(router.GetRoute("update-account-status"), ShouldNotBeNil)
+		So(router.GetRoute("top-up-account"), ShouldNotBeNil)
+		So(router.GetRoute("get-account-statement"), ShouldNotBeNil)
+		So(router.GetRoute("import-bank-statement"), ShouldNotBeNil)
+		So(router.GetRoute("get-bank-credit-exceptions"), ShouldNotBeNil)
 	})
 }
 
@@ -54,4 +76,14 @@ func TestUnitGetHealthCheck(t *testing.T) {
 		healthCheck(w, req)
 		So(w.Code, ShouldEqual, 200)
 	})
+
+	Convey("Get HealthCheck while draining", t, func() {
+		lifecycle.StartDrain()
+		defer lifecycle.ResetDrain()
+		req, err := http.NewRequest("GET", "", nil)
+		So(err, ShouldBeNil)
+		w := httptest.NewRecorder()
+		healthCheck(w, req)
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+	})
 }
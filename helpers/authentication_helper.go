@@ -1,7 +1,39 @@
 package helpers
 
+import (
+	"net/http"
+
+	"github.com/companieshouse/chs.go/authentication"
+)
+
 // AdminPaymentLookupRole defines the path to check whether a user is authorised to look up a payment.
 const AdminPaymentLookupRole = "/admin/payment-lookup"
 
 // AdminPenaltyLookupRole defines the path to check whether a user is authorised to refund bulk payments.
 const AdminBulkRefundRole = "/admin/payments-bulk-refunds"
+
+// AdminPaymentRequestRole defines the path to check whether a user is authorised to raise payment requests.
+const AdminPaymentRequestRole = "/admin/payments-payment-requests"
+
+// AdminPaymentOverrideRole defines the path to check whether a user is authorised to override the outcome of a payment.
+const AdminPaymentOverrideRole = "/admin/payments-overrides"
+
+// AdminAccountRole defines the path to check whether a user is authorised to manage presenter credit accounts.
+const AdminAccountRole = "/admin/payments-accounts"
+
+// AdminBankTransferRole defines the path to check whether a user is authorised to import bank statements and review
+// the bank transfers that couldn't be matched.
+const AdminBankTransferRole = "/admin/payments-bank-transfers"
+
+// ericAuthorisedClientHeader is set by ERIC to the ID of the OAuth client a user token was issued to. As with the
+// other ERIC headers, ERIC replaces any value sent by the caller. chs.go/authentication has no accessor for it.
+const ericAuthorisedClientHeader = "ERIC-Authorised-Client"
+
+// GetClientID returns the ID of the calling service: the API key for API key requests, or the OAuth client for user
+// requests. It is empty when ERIC doesn't identify the client.
+func GetClientID(req *http.Request) string {
+	if authentication.GetAuthorisedIdentityType(req) == authentication.APIKeyIdentityType {
+		return authentication.GetAuthorisedIdentity(req)
+	}
+	return req.Header.Get(ericAuthorisedClientHeader)
+}
@@ -0,0 +1,29 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// CallbackTokenParam is the query parameter that carries the callback token on the URLs payment providers return users
+// to. PayPal adds its own token parameter to the return URL, so a distinct name is used.
+const CallbackTokenParam = "callback_token"
+
+// callbackTokenLength is the number of random bytes in a callback token
+const callbackTokenLength = 32
+
+// GenerateCallbackToken generates a random single use token to be embedded in the URL a payment provider returns the
+// user to, so that the callback can only be made by the user that was sent to the provider
+func GenerateCallbackToken() string {
+	token := make([]byte, callbackTokenLength)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// HashCallbackToken returns the SHA-256 digest of a callback token. Only the digest is stored against the payment
+// session, so that the token can't be recovered from the database.
+func HashCallbackToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
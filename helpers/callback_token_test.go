@@ -0,0 +1,22 @@
+package helpers
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGenerateCallbackToken(t *testing.T) {
+	Convey("generates a random 64 character hex string", t, func() {
+		token := GenerateCallbackToken()
+		So(token, ShouldHaveLength, 64)
+		So(token, ShouldNotEqual, GenerateCallbackToken())
+	})
+}
+
+func TestUnitHashCallbackToken(t *testing.T) {
+	Convey("hashes the token with SHA-256", t, func() {
+		So(HashCallbackToken("token"), ShouldEqual, "3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0")
+		So(HashCallbackToken("token"), ShouldNotEqual, HashCallbackToken("other"))
+	})
+}
@@ -6,5 +6,9 @@ type ContextKey string
 // ContextKeyPaymentSession is a specific key for identifying "payment_session" contexts added to the http request
 var ContextKeyPaymentSession = ContextKey("payment_session")
 
+// ContextKeyPayer is a specific key for identifying "payer" contexts added to the http request, holding the user paying
+// a payment session through a pay-on-behalf link
+var ContextKeyPayer = ContextKey("payer")
+
 // ContextKeyUserID is a specific key for identifying "user_id" contexts added to the http request
 var ContextKeyUserID = ContextKey("user_id")
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// idLength is the length of payment IDs. They must be shorter than 16 characters as they are also sent to E5, our
+// finance system, when paying for late filing penalties.
+const idLength = 15
+
+const idChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz1234567890"
+
+// maxUnbiasedByte is the largest multiple of len(idChars) that fits in a byte. Random bytes at or above it are
+// discarded so that every character is equally likely.
+const maxUnbiasedByte = 256 - 256%len(idChars)
+
+// etagLength is the number of random bytes in an etag, giving the same 56 character hex string as the SHA-512/224
+// digests previously used.
+const etagLength = 28
+
+// GenerateID generates a random payment ID of 15 alphanumeric characters, drawn from crypto/rand. This gives a range of
+// 62**15 IDs, so collisions are highly unlikely but still possible, and creating a payment resource retries with a new
+// ID if one occurs.
+//
+// **If you change the implementation of this function, you must run the utility test
+// `go test -tags uniqueness ./helpers -run 'Util'`**
+func GenerateID() string {
+	id := make([]byte, 0, idLength)
+	buf := make([]byte, idLength*2)
+	for len(id) < idLength {
+		// crypto/rand.Read never returns an error, it crashes the program if no randomness is available
+		rand.Read(buf)
+		for _, b := range buf {
+			if int(b) >= maxUnbiasedByte {
+				continue
+			}
+			id = append(id, idChars[int(b)%len(idChars)])
+			if len(id) == idLength {
+				break
+			}
+		}
+	}
+	return string(id)
+}
+
+// GenerateEtag generates a random etag which is generated on every write action on the payment session
+func GenerateEtag() string {
+	etag := make([]byte, etagLength)
+	rand.Read(etag)
+	return hex.EncodeToString(etag)
+}
@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGenerateID(t *testing.T) {
+	Convey("generates an id of 15 alphanumeric characters", t, func() {
+		for i := 0; i < 1000; i++ {
+			id := GenerateID()
+			So(id, ShouldHaveLength, 15)
+			So(strings.Trim(id, idChars), ShouldBeEmpty)
+		}
+	})
+
+	Convey("uses every character", t, func() {
+		seen := make(map[rune]bool)
+		for i := 0; i < 1000; i++ {
+			for _, c := range GenerateID() {
+				seen[c] = true
+			}
+		}
+		So(seen, ShouldHaveLength, len(idChars))
+	})
+}
+
+// TestUnitGenerateIDForDuplicates this will test the generateID func's capability for generating unique id's
+// if a duplicate is generated, this test will fail.
+func TestUnitGenerateIDForDuplicates(t *testing.T) {
+	// generate 100,000 id's
+	times := 100000 // 100 thousand
+	generated := make([]string, times)
+
+	for i := 0; i < times; i++ {
+		ref := GenerateID()
+		generated[i] = ref
+	}
+
+	// check for dups by creating a map of string->int and counting the the entry values whilst
+	// iterating through the generated map
+	generatedCheck := make(map[string]int)
+	var duplicates []string
+	for _, reference := range generated {
+		_, exists := generatedCheck[reference]
+		if exists {
+			duplicates = append(duplicates, reference)
+		} else {
+			generatedCheck[reference] = 1
+		}
+	}
+
+	if len(duplicates) != 0 {
+		t.Errorf("%d duplicate id's generated", len(duplicates))
+		t.Fail()
+	}
+}
+
+func TestUnitGenerateEtag(t *testing.T) {
+	Convey("generates a 56 character hex etag", t, func() {
+		etag := GenerateEtag()
+		So(etag, ShouldHaveLength, 56)
+		So(strings.Trim(etag, "0123456789abcdef"), ShouldBeEmpty)
+		So(GenerateEtag(), ShouldNotEqual, etag)
+	})
+}
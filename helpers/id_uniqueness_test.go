@@ -0,0 +1,45 @@
+//go:build uniqueness
+
+package helpers
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestUtilGenerateIDUniqueness generates millions of IDs across concurrent goroutines, as sessions are created
+// concurrently, and fails on any duplicate. It takes a while so is only built with the uniqueness tag.
+func TestUtilGenerateIDUniqueness(t *testing.T) {
+	const goroutines = 8
+	const perGoroutine = 500000 // 4 million in total
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	generated := make(map[string]struct{}, goroutines*perGoroutine)
+	duplicates := 0
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]string, perGoroutine)
+			for i := range ids {
+				ids[i] = GenerateID()
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			for _, id := range ids {
+				if _, exists := generated[id]; exists {
+					duplicates++
+				}
+				generated[id] = struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if duplicates != 0 {
+		t.Errorf("%d duplicate id's generated out of %d", duplicates, goroutines*perGoroutine)
+	}
+}
@@ -0,0 +1,9 @@
+package helpers
+
+import "time"
+
+// MongoNow returns the current time truncated to the millisecond precision times are saved to mongo with, e.g.
+// "2018-11-22T08:39:16.782Z", so that a time compares equal once it has been read back
+func MongoNow() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
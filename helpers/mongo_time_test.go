@@ -0,0 +1,16 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitMongoNow(t *testing.T) {
+	Convey("Current time is truncated to milliseconds", t, func() {
+		now := MongoNow()
+		So(now, ShouldEqual, now.Truncate(time.Millisecond))
+		So(now, ShouldHappenWithin, time.Second, time.Now())
+	})
+}
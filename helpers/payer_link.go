@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PayerLinkTokenParam is the query parameter that carries the payer token on a pay-on-behalf link
+const PayerLinkTokenParam = "payer_token"
+
+// PayerLinkTokenHeader is the header a payer's requests to the payments API carry the payer token from the link in
+const PayerLinkTokenHeader = "X-Payer-Token"
+
+var (
+	// ErrInvalidPayerLinkToken is returned when a payer token is malformed, or wasn't signed for the payment session
+	ErrInvalidPayerLinkToken = errors.New("payer token is invalid")
+	// ErrPayerLinkExpired is returned when a payer token is used after the link it was issued with expired
+	ErrPayerLinkExpired = errors.New("payer token has expired")
+)
+
+// GeneratePayerLinkToken signs the ID and expiry of a pay-on-behalf link for a payment session, giving the token to put
+// in the link. The token is bound to the session, so it can't be used to pay any other.
+func GeneratePayerLinkToken(key []byte, paymentID, linkID string, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return strings.Join([]string{linkID, expiry, signPayerLink(key, paymentID, linkID, expiry)}, ".")
+}
+
+// VerifyPayerLinkToken checks the signature and expiry of a payer token for a payment session, returning the ID of the
+// link it was issued with. Whether that link has since been revoked is for the caller to check.
+func VerifyPayerLinkToken(key []byte, paymentID, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidPayerLinkToken
+	}
+	linkID, expiry, sig := parts[0], parts[1], parts[2]
+
+	expected, err := hex.DecodeString(signPayerLink(key, paymentID, linkID, expiry))
+	if err != nil {
+		return "", err
+	}
+	actual, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return "", ErrInvalidPayerLinkToken
+	}
+
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidPayerLinkToken
+	}
+	if time.Now().After(time.Unix(seconds, 0)) {
+		return "", ErrPayerLinkExpired
+	}
+
+	return linkID, nil
+}
+
+// signPayerLink returns the hex encoded HMAC-SHA256 of the payment ID, link ID and expiry. None of them can contain a
+// dot, so no two sets of values produce the same message.
+func signPayerLink(key []byte, paymentID, linkID, expiry string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{paymentID, linkID, expiry}, ".")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitPayerLinkToken(t *testing.T) {
+	key := []byte("payer-link-signing-key-of-32-chars")
+	expiresAt := time.Now().Add(time.Hour)
+
+	Convey("token verifies for the payment session it was signed for", t, func() {
+		token := GeneratePayerLinkToken(key, "payment1", "link1", expiresAt)
+		linkID, err := VerifyPayerLinkToken(key, "payment1", token)
+		So(err, ShouldBeNil)
+		So(linkID, ShouldEqual, "link1")
+	})
+
+	Convey("token doesn't verify for another payment session", t, func() {
+		token := GeneratePayerLinkToken(key, "payment1", "link1", expiresAt)
+		_, err := VerifyPayerLinkToken(key, "payment2", token)
+		So(err, ShouldEqual, ErrInvalidPayerLinkToken)
+	})
+
+	Convey("token doesn't verify with another key", t, func() {
+		token := GeneratePayerLinkToken([]byte("another-signing-key-of-32-chars!!"), "payment1", "link1", expiresAt)
+		_, err := VerifyPayerLinkToken(key, "payment1", token)
+		So(err, ShouldEqual, ErrInvalidPayerLinkToken)
+	})
+
+	Convey("token with its expiry extended doesn't verify", t, func() {
+		parts := strings.Split(GeneratePayerLinkToken(key, "payment1", "link1", expiresAt), ".")
+		parts[1] = strconv.FormatInt(expiresAt.Add(time.Hour).Unix(), 10)
+		_, err := VerifyPayerLinkToken(key, "payment1", strings.Join(parts, "."))
+		So(err, ShouldEqual, ErrInvalidPayerLinkToken)
+	})
+
+	Convey("malformed token", t, func() {
+		_, err := VerifyPayerLinkToken(key, "payment1", "link1")
+		So(err, ShouldEqual, ErrInvalidPayerLinkToken)
+	})
+
+	Convey("expired token", t, func() {
+		token := GeneratePayerLinkToken(key, "payment1", "link1", time.Now().Add(-time.Minute))
+		_, err := VerifyPayerLinkToken(key, "payment1", token)
+		So(err, ShouldEqual, ErrPayerLinkExpired)
+	})
+}
@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"regexp"
+	"strings"
+)
+
+// remittanceReferencePrefix starts every remittance reference, so that they can be picked out of the other text a
+// payer adds to a bank transfer
+const remittanceReferencePrefix = "CH"
+
+// remittanceReferenceChars leaves out the letters and digits most easily confused when a reference is typed into a
+// banking app, I and 1, O and 0
+const remittanceReferenceChars = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// remittanceReferenceLength is the number of random characters after the prefix. The whole reference fits within the
+// 18 characters of a Bacs or Faster Payments reference.
+const remittanceReferenceLength = 10
+
+// remittanceReferencePattern matches a remittance reference in a bank statement narrative once it has been normalised
+var remittanceReferencePattern = regexp.MustCompile(remittanceReferencePrefix + "[" + remittanceReferenceChars + "]{10}")
+
+// GenerateRemittanceReference generates a random reference for a payer to quote on a bank transfer, so that the credit
+// can be matched to their payment session when the bank statement is uploaded
+func GenerateRemittanceReference() string {
+	reference := make([]byte, 0, remittanceReferenceLength)
+	buf := make([]byte, remittanceReferenceLength*2)
+	for len(reference) < remittanceReferenceLength {
+		rand.Read(buf)
+		for _, b := range buf {
+			// 256 is a multiple of len(remittanceReferenceChars), so every character is equally likely
+			reference = append(reference, remittanceReferenceChars[int(b)%len(remittanceReferenceChars)])
+			if len(reference) == remittanceReferenceLength {
+				break
+			}
+		}
+	}
+	return remittanceReferencePrefix + string(reference)
+}
+
+// FindRemittanceReferences returns the remittance references quoted in the narrative of a bank statement credit. Banks
+// and payers often change the case of a reference or break it up with spaces or dashes, so these are ignored.
+func FindRemittanceReferences(narrative string) []string {
+	normalised := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(narrative))
+	return remittanceReferencePattern.FindAllString(normalised, -1)
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGenerateRemittanceReference(t *testing.T) {
+	Convey("generates a 12 character reference starting CH", t, func() {
+		for i := 0; i < 1000; i++ {
+			reference := GenerateRemittanceReference()
+			So(reference, ShouldHaveLength, 12)
+			So(reference, ShouldStartWith, "CH")
+			So(strings.Trim(reference[2:], remittanceReferenceChars), ShouldBeEmpty)
+		}
+	})
+
+	Convey("generated references are found in a narrative", t, func() {
+		reference := GenerateRemittanceReference()
+		So(FindRemittanceReferences("PAYMENT "+reference), ShouldResemble, []string{reference})
+	})
+}
+
+func TestUnitFindRemittanceReferences(t *testing.T) {
+	Convey("reference with a different case, spaces and dashes", t, func() {
+		So(FindRemittanceReferences("ACME LTD ch2a-b3c 4d5e6"), ShouldResemble, []string{"CH2AB3C4D5E6"})
+	})
+
+	Convey("more than one reference", t, func() {
+		So(FindRemittanceReferences("CH2AB3C4D5E6/CH7FG8H9J2K3"), ShouldResemble, []string{"CH2AB3C4D5E6", "CH7FG8H9J2K3"})
+	})
+
+	Convey("no reference", t, func() {
+		So(FindRemittanceReferences("INVOICE 12345"), ShouldBeEmpty)
+		So(FindRemittanceReferences("CH0O1I"), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,31 @@
+package helpers
+
+import "net/http"
+
+// StatusWriter is an http.ResponseWriter which captures the status code written by a handler, for middleware which
+// records it
+type StatusWriter struct {
+	http.ResponseWriter
+	Status      int
+	wroteHeader bool
+}
+
+// NewStatusWriter returns a StatusWriter wrapping the given ResponseWriter. The status is 200 until one is written.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, Status: http.StatusOK}
+}
+
+// WriteHeader records the status code before writing it
+func (sw *StatusWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.Status = code
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the body, after which the status can no longer change
+func (sw *StatusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(b)
+}
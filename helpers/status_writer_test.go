@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitStatusWriter(t *testing.T) {
+	Convey("Status defaults to 200 when a handler only writes a body", t, func() {
+		sw := NewStatusWriter(httptest.NewRecorder())
+		sw.Write([]byte("body"))
+		So(sw.Status, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("First status written is captured", t, func() {
+		w := httptest.NewRecorder()
+		sw := NewStatusWriter(w)
+		sw.WriteHeader(http.StatusConflict)
+		sw.WriteHeader(http.StatusInternalServerError)
+		So(sw.Status, ShouldEqual, http.StatusConflict)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+	})
+
+	Convey("Status can't change once the body is written", t, func() {
+		sw := NewStatusWriter(httptest.NewRecorder())
+		sw.Write([]byte("body"))
+		sw.WriteHeader(http.StatusInternalServerError)
+		So(sw.Status, ShouldEqual, http.StatusOK)
+	})
+}
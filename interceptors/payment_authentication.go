@@ -8,6 +8,7 @@ import (
 	"github.com/companieshouse/chs.go/authentication"
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 	"github.com/companieshouse/payments.api.ch.gov.uk/service"
 	"github.com/gorilla/mux"
 )
@@ -102,6 +103,14 @@ func (paymentAuthenticationInterceptor PaymentAuthenticationInterceptor) Payment
 		isApiKeyRequest := identityType == authentication.APIKeyIdentityType
 		apiKeyHasElevatedPrivileges := authentication.IsKeyElevatedPrivilegesAuthorised(r)
 		apiKeyHasPaymentPrivileges := authentication.CheckAuthorisedKeyHasPrivilege(r, authentication.APIKeyPaymentPrivilege)
+		authUserHasPayerLink := false
+		if payerToken := r.Header.Get(helpers.PayerLinkTokenHeader); payerToken != "" && identityType == authentication.Oauth2IdentityType {
+			err = paymentAuthenticationInterceptor.Service.VerifyPayerLink(paymentSession, payerToken)
+			if err != nil {
+				log.InfoR(r, fmt.Sprintf("PaymentAuthenticationInterceptor payer link not accepted: [%v]", err), log.Data{"payment_id": id})
+			}
+			authUserHasPayerLink = err == nil
+		}
 
 		// Set up debug map for logging at each exit point
 		debugMap := log.Data{
@@ -109,6 +118,7 @@ func (paymentAuthenticationInterceptor PaymentAuthenticationInterceptor) Payment
 			"auth_user_is_payment_creator":      authUserIsPaymentCreator,
 			"auth_user_has_payment_lookup_role": authUserHasPaymentLookupRole,
 			"api_key_has_elevated_privileges":   apiKeyHasElevatedPrivileges,
+			"auth_user_has_payer_link":          authUserHasPayerLink,
 			"request_method":                    r.Method,
 		}
 
@@ -120,20 +130,32 @@ func (paymentAuthenticationInterceptor PaymentAuthenticationInterceptor) Payment
 			log.InfoR(r, "PaymentAuthenticationInterceptor authorised as creator", debugMap)
 			// Call the next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
+		case authUserHasPayerLink:
+			// 2) Authorized user has a pay-on-behalf link for the payment, so can
+			// view and pay it. They are recorded as the payer
+			log.InfoR(r, "PaymentAuthenticationInterceptor authorised with payer link", debugMap)
+			payer := &models.CreatedByRest{
+				ID:       userDetails.ID,
+				Email:    userDetails.Email,
+				Forename: userDetails.Forename,
+				Surname:  userDetails.Surname,
+			}
+			// Call the next handler
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, helpers.ContextKeyPayer, payer)))
 		case authUserHasPaymentLookupRole && isGetRequest:
-			// 2) Authorized user has permission to lookup any payment session and
+			// 3) Authorized user has permission to lookup any payment session and
 			// request is a GET i.e. to see payment data but not modify/delete
 			log.InfoR(r, "PaymentAuthenticationInterceptor authorised as payment lookup role on GET", debugMap)
 			// Call the next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
 		case isApiKeyRequest && apiKeyHasElevatedPrivileges:
-			// 3) Authorized API key with elevated privileges is an internal API key
+			// 4) Authorized API key with elevated privileges is an internal API key
 			// that we trust
 			log.InfoR(r, "PaymentAuthenticationInterceptor authorised as api key elevated user", debugMap)
 			// Call the next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
 		case isApiKeyRequest && apiKeyHasPaymentPrivileges:
-			// 4) Authorised API key with payment privileges
+			// 5) Authorised API key with payment privileges
 			log.InfoR(r, "PaymentAuthenticationInterceptor authorised as api key user with payment privileges", debugMap)
 			// Call the next handler
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -148,51 +170,60 @@ func (paymentAuthenticationInterceptor PaymentAuthenticationInterceptor) Payment
 
 // PaymentAdminAuthenticationIntercept checks that the user is authenticated for payment admin priveleges
 func PaymentAdminAuthenticationIntercept(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return AdminRoleIntercept(helpers.AdminBulkRefundRole)(next)
+}
 
-		// Check identity type from request is Oauth2
-		identityType := authentication.GetAuthorisedIdentityType(r)
-		if identityType != authentication.Oauth2IdentityType {
-			log.Error(fmt.Errorf("authentication interceptor unauthorised: not oauth2 type"))
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+// AdminRoleIntercept returns an interceptor which checks that the user is authenticated with OAuth2 and has the given
+// admin role, and puts their email in the request context as the user ID
+func AdminRoleIntercept(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// Check identity type from request is Oauth2
+			identityType := authentication.GetAuthorisedIdentityType(r)
+			if identityType != authentication.Oauth2IdentityType {
+				log.Error(fmt.Errorf("authentication interceptor unauthorised: not oauth2 type"))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
 
-		authUserHasBulkRefundRole := authentication.IsRoleAuthorised(r, helpers.AdminBulkRefundRole)
+			authUserHasAdminRole := authentication.IsRoleAuthorised(r, role)
 
-		userEmail := ""
+			userEmail := ""
 
-		// Get user details from context, passed in by UserAuthenticationInterceptor
-		userDetails, ok := r.Context().Value(authentication.ContextKeyUserDetails).(authentication.AuthUserDetails)
-		if !ok {
-			log.ErrorR(r, fmt.Errorf("PaymentAuthenticationInterceptor error: invalid AuthUserDetails from UserAuthenticationInterceptor"))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+			// Get user details from context, passed in by UserAuthenticationInterceptor
+			userDetails, ok := r.Context().Value(authentication.ContextKeyUserDetails).(authentication.AuthUserDetails)
+			if !ok {
+				log.ErrorR(r, fmt.Errorf("PaymentAuthenticationInterceptor error: invalid AuthUserDetails from UserAuthenticationInterceptor"))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 
-		// Get user details from request
-		userEmail = userDetails.Email
-		if userEmail == "" {
-			log.Error(fmt.Errorf("PaymentAuthenticationInterceptor unauthorised: no authorised identity"))
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+			// Get user details from request
+			userEmail = userDetails.Email
+			if userEmail == "" {
+				log.Error(fmt.Errorf("PaymentAuthenticationInterceptor unauthorised: no authorised identity"))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
 
-		// Set up debug map for logging
-		debugMap := log.Data{
-			"auth_user_has_bulk_refund_role": authUserHasBulkRefundRole,
-			"request_method":                 r.Method,
-		}
+			// Set up debug map for logging
+			debugMap := log.Data{
+				"admin_role":               role,
+				"auth_user_has_admin_role": authUserHasAdminRole,
+				"request_method":           r.Method,
+			}
 
-		ctx := context.WithValue(r.Context(), helpers.ContextKeyUserID, userEmail)
+			ctx := context.WithValue(r.Context(), helpers.ContextKeyUserID, userEmail)
 
-		// Check that user has bulk refund role
-		if authUserHasBulkRefundRole {
-			log.InfoR(r, "PaymentAdminAuthenticationInterceptor authorised as bulk refund admin role on POST", debugMap)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
-		w.WriteHeader(http.StatusUnauthorized)
-		log.InfoR(r, "PaymentAdminAuthenticationInterceptor unauthorised", debugMap)
-	})
+			// Check that user has the admin role
+			if authUserHasAdminRole {
+				log.InfoR(r, "PaymentAdminAuthenticationInterceptor authorised with admin role", debugMap)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			log.InfoR(r, "PaymentAdminAuthenticationInterceptor unauthorised", debugMap)
+		})
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/companieshouse/chs.go/authentication"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
@@ -69,7 +70,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	cfg, _ := config.Get()
-	cfg.DomainAllowList = resourceURL
+	cfg.DomainAllowList = []string{resourceURL}
 
 	Convey("No payment ID in request", t, func() {
 		path := fmt.Sprintf("/payments/")
@@ -150,7 +151,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(nil, nil)
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, nil)
 
 		w := httptest.NewRecorder()
 		httpmock.Activate()
@@ -182,7 +183,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
 
 		w := httptest.NewRecorder()
 		httpmock.Activate()
@@ -214,7 +215,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -255,7 +256,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -296,7 +297,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -337,7 +338,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -377,7 +378,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -417,7 +418,7 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mockDAO, cfg)
 		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
 
-		mockDAO.EXPECT().GetPaymentResource("1234").Return(
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -441,11 +442,103 @@ func TestUnitUserPaymentInterceptor(t *testing.T) {
 	})
 }
 
+func TestUnitPayerLinkPaymentInterceptor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	payerLinkCfg := *cfg
+	payerLinkCfg.PayerLinkSigningKey = "payer-link-signing-key-of-32-chars"
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	newPayerRequest := func(token string) *http.Request {
+		req := httptest.NewRequest("PATCH", "/private/payments/1234", nil)
+		req = mux.SetURLVars(req, map[string]string{"payment_id": "1234"})
+		req.Header.Set("Eric-Identity", "payer")
+		req.Header.Set("Eric-Identity-Type", "oauth2")
+		req.Header.Set("ERIC-Authorised-User", "finance@client.co.uk;Fin;Ance")
+		req.Header.Set(helpers.PayerLinkTokenHeader, token)
+		authUserDetails := authentication.AuthUserDetails{
+			ID:    "payer",
+			Email: "finance@client.co.uk",
+		}
+		return req.WithContext(context.WithValue(req.Context(), authentication.ContextKeyUserDetails, authUserDetails))
+	}
+
+	newPaymentResource := func(payerLink *models.PayerLinkDB) *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{
+			ID: "1234",
+			Data: models.PaymentResourceDataDB{
+				Amount:    "10.00",
+				CreatedAt: time.Now(),
+				CreatedBy: models.CreatedByDB{ID: "agent"},
+				Links:     models.PaymentLinksDB{Resource: resourceURL},
+			},
+			PayerLink: payerLink,
+		}
+	}
+
+	Convey("Happy path where user has a payer link for the payment", t, func() {
+		mockDAO := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mockDAO, &payerLinkCfg)
+		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(newPaymentResource(&models.PayerLinkDB{ID: "link", ExpiresAt: expiresAt}), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder("GET", resourceURL, jsonResponse)
+
+		var payer *models.CreatedByRest
+		test := paymentAuthenticationInterceptor.PaymentAuthenticationIntercept(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			payer, _ = req.Context().Value(helpers.ContextKeyPayer).(*models.CreatedByRest)
+			w.WriteHeader(http.StatusOK)
+		}))
+		w := httptest.NewRecorder()
+		test.ServeHTTP(w, newPayerRequest(helpers.GeneratePayerLinkToken([]byte(payerLinkCfg.PayerLinkSigningKey), "1234", "link", expiresAt)))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(payer, ShouldResemble, &models.CreatedByRest{ID: "payer", Email: "finance@client.co.uk"})
+	})
+
+	Convey("Unauthorised where the payer link has been revoked", t, func() {
+		mockDAO := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mockDAO, &payerLinkCfg)
+		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(newPaymentResource(&models.PayerLinkDB{ID: "link", ExpiresAt: expiresAt, RevokedAt: time.Now()}), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder("GET", resourceURL, jsonResponse)
+
+		test := paymentAuthenticationInterceptor.PaymentAuthenticationIntercept(GetTestHandler())
+		w := httptest.NewRecorder()
+		test.ServeHTTP(w, newPayerRequest(helpers.GeneratePayerLinkToken([]byte(payerLinkCfg.PayerLinkSigningKey), "1234", "link", expiresAt)))
+		So(w.Code, ShouldEqual, http.StatusUnauthorized)
+	})
+
+	Convey("Unauthorised where the payer token was issued for another payment", t, func() {
+		mockDAO := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mockDAO, &payerLinkCfg)
+		paymentAuthenticationInterceptor := createPaymentAuthenticationInterceptorWithMockService(&mockPaymentService)
+		mockDAO.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(newPaymentResource(&models.PayerLinkDB{ID: "link", ExpiresAt: expiresAt}), nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder("GET", resourceURL, jsonResponse)
+
+		test := paymentAuthenticationInterceptor.PaymentAuthenticationIntercept(GetTestHandler())
+		w := httptest.NewRecorder()
+		test.ServeHTTP(w, newPayerRequest(helpers.GeneratePayerLinkToken([]byte(payerLinkCfg.PayerLinkSigningKey), "5678", "link", expiresAt)))
+		So(w.Code, ShouldEqual, http.StatusUnauthorized)
+	})
+}
+
 func TestUnitAdminUserPaymentInterceptor(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	cfg, _ := config.Get()
-	cfg.DomainAllowList = resourceURL
+	cfg.DomainAllowList = []string{resourceURL}
 
 	Convey("No oauth2 identity type", t, func() {
 		path := "/admin/payments/bulk-refunds"
@@ -576,3 +669,43 @@ func TestUnitAdminUserPaymentInterceptor(t *testing.T) {
 		So(w.Code, ShouldEqual, http.StatusOK)
 	})
 }
+
+func TestUnitAdminRoleInterceptor(t *testing.T) {
+	userDetails := authentication.AuthUserDetails{
+		Email:    "userID",
+		Forename: "forename",
+		Surname:  "surname",
+		ID:       "123",
+	}
+
+	testCases := []struct {
+		description  string
+		role         string
+		userRole     string
+		expectedCode int
+	}{
+		{"User has the bulk refund role but not the payment request role", helpers.AdminPaymentRequestRole, helpers.AdminBulkRefundRole, http.StatusUnauthorized},
+		{"Success - User has the payment request role", helpers.AdminPaymentRequestRole, helpers.AdminPaymentRequestRole, http.StatusOK},
+		{"User has the payment request role but not the override role", helpers.AdminPaymentOverrideRole, helpers.AdminPaymentRequestRole, http.StatusUnauthorized},
+		{"Success - User has the override role", helpers.AdminPaymentOverrideRole, helpers.AdminPaymentOverrideRole, http.StatusOK},
+		{"User has the override role but not the account role", helpers.AdminAccountRole, helpers.AdminPaymentOverrideRole, http.StatusUnauthorized},
+		{"Success - User has the account role", helpers.AdminAccountRole, helpers.AdminAccountRole, http.StatusOK},
+		{"User has the account role but not the bank transfer role", helpers.AdminBankTransferRole, helpers.AdminAccountRole, http.StatusUnauthorized},
+		{"Success - User has the bank transfer role", helpers.AdminBankTransferRole, helpers.AdminBankTransferRole, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		Convey(tc.description, t, func() {
+			req, err := http.NewRequest("POST", "/admin/payments", nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("Eric-Identity-Type", "oauth2")
+			req.Header.Set("ERIC-Authorised-Roles", tc.userRole)
+			req = req.WithContext(context.WithValue(req.Context(), authentication.ContextKeyUserDetails, userDetails))
+
+			w := httptest.NewRecorder()
+			test := AdminRoleIntercept(tc.role)(GetTestHandler())
+			test.ServeHTTP(w, req)
+			So(w.Code, ShouldEqual, tc.expectedCode)
+		})
+	}
+}
@@ -0,0 +1,2 @@
+// Package lifecycle tracks whether the service is draining ahead of shutdown.
+package lifecycle
@@ -0,0 +1,21 @@
+package lifecycle
+
+import "sync/atomic"
+
+var draining atomic.Bool
+
+// StartDrain marks the service as draining so that it reports itself as not ready to receive traffic
+func StartDrain() {
+	draining.Store(true)
+}
+
+// IsDraining returns true once the service has started to shut down
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// ResetDrain marks the service as no longer draining, so that tests which start a drain don't leave it started for
+// the tests after them
+func ResetDrain() {
+	draining.Store(false)
+}
@@ -0,0 +1,16 @@
+package lifecycle
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitDrain(t *testing.T) {
+	Convey("The service reports draining once shutdown starts", t, func() {
+		defer ResetDrain()
+		So(IsDraining(), ShouldBeFalse)
+		StartDrain()
+		So(IsDraining(), ShouldBeTrue)
+	})
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
 	"github.com/companieshouse/payments.api.ch.gov.uk/handlers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/lifecycle"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 	"github.com/gorilla/mux"
 )
 
@@ -21,6 +29,22 @@ func main() {
 		return
 	}
 
+	// Report every configuration problem up front rather than on the first request that trips over one
+	if err := cfg.Validate(); err != nil {
+		logConfigErrors(err)
+		os.Exit(1)
+	}
+	if cfg.CheckConfig {
+		log.Info("configuration is valid")
+		return
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.OtelServiceName, cfg.OtelExporterEndpoint)
+	if err != nil {
+		log.Error(fmt.Errorf("error configuring tracing: %s. Exiting", err), nil)
+		return
+	}
+
 	paymentsDAO := dao.NewDAO(cfg)
 
 	// Create router
@@ -28,11 +52,74 @@ func main() {
 
 	handlers.Register(mainRouter, *cfg, paymentsDAO)
 
+	server := &http.Server{
+		Addr:         cfg.BindAddr,
+		Handler:      mainRouter,
+		ReadTimeout:  time.Duration(cfg.ReadTimeoutInSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeoutInSeconds) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeoutInSeconds) * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
 	log.Info("Starting " + namespace)
-	err = http.ListenAndServe(cfg.BindAddr, mainRouter)
-	if err != nil {
-		log.Error(err)
+	exitCode := 0
+	select {
+	case err = <-serverErr:
+		// The server only stops by itself when it fails, e.g. it can't bind to its address
+		log.Error(fmt.Errorf("error serving requests: %s", err))
+		exitCode = 1
+	case sig := <-stop:
+		log.Info("received " + sig.String() + ", draining " + namespace)
+		drain(cfg, server)
+	}
+
+	closeKafkaProducer()
+
+	graceCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownGracePeriodInSeconds)*time.Second)
+	if err := shutdownTracing(graceCtx); err != nil {
+		log.Error(fmt.Errorf("error shutting down tracing: %s", err))
 	}
+	cancel()
 
 	log.Trace("Exiting " + namespace)
+	os.Exit(exitCode)
+}
+
+// logConfigErrors logs each problem found validating the configuration on its own line.
+func logConfigErrors(err error) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			log.Error(fmt.Errorf("invalid configuration: %s", e))
+		}
+		return
+	}
+	log.Error(fmt.Errorf("invalid configuration: %s", err))
+}
+
+// drain fails the healthcheck so that no new traffic is routed to the service, then stops accepting requests and
+// waits for in-flight requests to finish. Anything still running when the grace period expires is abandoned.
+func drain(cfg *config.Config, server *http.Server) {
+	lifecycle.StartDrain()
+	time.Sleep(time.Duration(cfg.DrainDelayInSeconds) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownGracePeriodInSeconds)*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(fmt.Errorf("error draining in-flight requests: %s", err))
+	}
+}
+
+// closeKafkaProducer closes the kafka producer once no more requests will send messages with it
+func closeKafkaProducer() {
+	if err := handlers.CloseKafkaProducer(); err != nil {
+		log.Error(fmt.Errorf("error closing kafka producer: %s", err))
+	}
 }
@@ -7,6 +7,13 @@ import (
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 )
 
+// Internal statuses of refunds
+const (
+	RefundStatusRequested = "refund-requested"
+	RefundStatusSuccess   = "refund-success"
+	RefundStatusError     = "refund-error"
+)
+
 // MapToRefundRest maps a GOV.UK Pay refund response to a rest resource
 func MapToRefundRest(response models.CreateRefundGovPayResponse, refundReference string) models.RefundResourceRest {
 	return models.RefundResourceRest{
@@ -38,9 +45,9 @@ func MapGovPayToRefundResponse(gpResponse models.CreateRefundGovPayResponse) mod
 func mapGovPayStatusToInternal(status string) string {
 
 	govPayStatusMap := map[string]string{
-		"submitted": "refund-requested",
-		"success":   "refund-success",
-		"error":     "refund-error",
+		"submitted": RefundStatusRequested,
+		"success":   RefundStatusSuccess,
+		"error":     RefundStatusError,
 	}
 
 	if govPayStatusMap[status] != "" {
@@ -0,0 +1,2 @@
+// Package metrics contains the Prometheus collectors exposed by the API on /metrics.
+package metrics
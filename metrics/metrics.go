@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "payments_api"
+
+// Outcome label values shared by the counters below
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Provider label values used for outbound calls
+const (
+	ProviderGovPay  = "govpay"
+	ProviderPayPal  = "paypal"
+	ProviderAccount = "account"
+	ProviderCosts   = "costs"
+)
+
+var (
+	sessionsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sessions_created_total",
+		Help:      "Number of payment sessions created, by class of payment.",
+	}, []string{"class_of_payment"})
+
+	sessionStatusTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_status_transitions_total",
+		Help:      "Number of payment session status changes, by new status, payment method and class of payment.",
+	}, []string{"status", "payment_method", "class_of_payment"})
+
+	refunds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refunds_total",
+		Help:      "Number of refunds requested from a payment provider, by provider and outcome.",
+	}, []string{"provider", "outcome"})
+
+	duplicatePayments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_payments_total",
+		Help:      "Number of external payments found made for a payment session already paid, which must be refunded, by provider.",
+	}, []string{"provider"})
+
+	kafkaPublishes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_publish_total",
+		Help:      "Number of payment-processed messages published to Kafka, by message type and outcome.",
+	}, []string{"message_type", "outcome"})
+
+	outboundDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbound_request_duration_seconds",
+		Help:      "Latency of calls to payment providers and cost resources.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "operation", "outcome"})
+
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests handled by the API, by route name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		sessionsCreated,
+		sessionStatusTransitions,
+		refunds,
+		duplicatePayments,
+		kafkaPublishes,
+		outboundDuration,
+		handlerDuration,
+	)
+}
+
+// Handler returns the handler which serves the registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// SessionCreated records the creation of a payment session
+func SessionCreated(classOfPayment string) {
+	sessionsCreated.WithLabelValues(classOfPayment).Inc()
+}
+
+// SessionStatusChanged records a payment session moving to a new status
+func SessionStatusChanged(status, paymentMethod, classOfPayment string) {
+	sessionStatusTransitions.WithLabelValues(status, paymentMethod, classOfPayment).Inc()
+}
+
+// RefundRequested records the outcome of a refund request sent to a provider
+func RefundRequested(provider string, err error) {
+	refunds.WithLabelValues(provider, outcome(err)).Inc()
+}
+
+// DuplicatePaymentFound records an external payment made for a payment session which had already been paid
+func DuplicatePaymentFound(provider string) {
+	duplicatePayments.WithLabelValues(provider).Inc()
+}
+
+// KafkaPublished records the outcome of publishing a kafka message
+func KafkaPublished(messageType string, err error) {
+	kafkaPublishes.WithLabelValues(messageType, outcome(err)).Inc()
+}
+
+// ObserveOutboundCall records the latency of a call to an external provider which started at the given time
+func ObserveOutboundCall(provider, operation string, start time.Time, err error) {
+	outboundDuration.WithLabelValues(provider, operation, outcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// InstrumentHandler is a middleware which records the latency of each request against the name of the gorilla
+// route which served it
+func InstrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := helpers.NewStatusWriter(w)
+
+		next.ServeHTTP(sw, r)
+
+		handlerDuration.WithLabelValues(routeName(r), r.Method, strconv.Itoa(sw.Status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+func routeName(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil || route.GetName() == "" {
+		return "unnamed"
+	}
+	return route.GetName()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
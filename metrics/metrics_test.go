@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitInstrumentHandler(t *testing.T) {
+	Convey("Request latency is recorded against the route name and status code", t, func() {
+		router := mux.NewRouter()
+		router.HandleFunc("/test", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}).Name("test-route")
+		router.Use(InstrumentHandler)
+
+		// Observe into a histogram of the test's own, as the registered one keeps the series of every earlier run
+		defer func(registered *prometheus.HistogramVec) { handlerDuration = registered }(handlerDuration)
+		handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_duration_seconds"}, []string{"route", "method", "code"})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		So(w.Code, ShouldEqual, http.StatusTeapot)
+		So(testutil.CollectAndCount(handlerDuration), ShouldEqual, 1)
+		So(handlerDuration.DeleteLabelValues("test-route", http.MethodGet, "418"), ShouldBeTrue)
+	})
+}
+
+func TestUnitCounters(t *testing.T) {
+	Convey("Kafka publish outcomes are counted separately", t, func() {
+		successes := testutil.ToFloat64(kafkaPublishes.WithLabelValues("payment", OutcomeSuccess))
+		failures := testutil.ToFloat64(kafkaPublishes.WithLabelValues("payment", OutcomeFailure))
+
+		KafkaPublished("payment", nil)
+		KafkaPublished("payment", errors.New("error"))
+		KafkaPublished("payment", errors.New("error"))
+
+		So(testutil.ToFloat64(kafkaPublishes.WithLabelValues("payment", OutcomeSuccess)), ShouldEqual, successes+1)
+		So(testutil.ToFloat64(kafkaPublishes.WithLabelValues("payment", OutcomeFailure)), ShouldEqual, failures+2)
+	})
+
+	Convey("Duplicate payments are counted by provider", t, func() {
+		before := testutil.ToFloat64(duplicatePayments.WithLabelValues(ProviderGovPay))
+
+		DuplicatePaymentFound(ProviderGovPay)
+
+		So(testutil.ToFloat64(duplicatePayments.WithLabelValues(ProviderGovPay)), ShouldEqual, before+1)
+	})
+
+	Convey("Status transitions are counted by status, method and class", t, func() {
+		before := testutil.ToFloat64(sessionStatusTransitions.WithLabelValues("paid", "credit-card", "data-maintenance"))
+
+		SessionStatusChanged("paid", "credit-card", "data-maintenance")
+
+		So(testutil.ToFloat64(sessionStatusTransitions.WithLabelValues("paid", "credit-card", "data-maintenance")), ShouldEqual, before+1)
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// AccountDB is a Companies House credit account that presenters pay from, as stored in the DB. The balance is held
+// in pence.
+type AccountDB struct {
+	ID        string    `bson:"_id"`
+	Name      string    `bson:"name"`
+	Status    string    `bson:"status"`
+	Balance   int       `bson:"balance"`
+	UserIDs   []string  `bson:"user_ids"`
+	CreatedAt time.Time `bson:"created_at"`
+	CreatedBy string    `bson:"created_by"`
+}
+
+// AccountLedgerEntryDB is a debit or credit to a credit account, as stored in the DB. The amount is in pence, negative
+// for a debit, and the balance is that of the account once the entry was made. A debit for a payment session also holds
+// the total, in pence, refunded from it so far, and is pending until the session has been completed with it or the
+// debit has been reversed.
+type AccountLedgerEntryDB struct {
+	ID        string    `bson:"_id"`
+	AccountID string    `bson:"account_id"`
+	Type      string    `bson:"type"`
+	Amount    int       `bson:"amount"`
+	Balance   int       `bson:"balance"`
+	PaymentID string    `bson:"payment_id,omitempty"`
+	Reference string    `bson:"reference,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+	CreatedBy string    `bson:"created_by,omitempty"`
+	Refunded  int       `bson:"refunded,omitempty"`
+	Pending   bool      `bson:"pending,omitempty"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// IncomingAccount is the data received in the body of a request to open a credit account. The user IDs are those of
+// the presenters who can pay from the account.
+type IncomingAccount struct {
+	Name    string   `json:"name"     validate:"required,max=255"`
+	UserIDs []string `json:"user_ids" validate:"required,min=1,dive,required"`
+}
+
+// IncomingAccountStatus is the data received in the body of a request to change the status of a credit account
+type IncomingAccountStatus struct {
+	Status string `json:"status" validate:"required,oneof=active suspended"`
+}
+
+// IncomingAccountTopUp is the data received in the body of a request to top up a credit account
+type IncomingAccountTopUp struct {
+	Amount    string `json:"amount"    validate:"required"`
+	Reference string `json:"reference" validate:"required,max=255"`
+}
+
+// AccountRest is a Companies House credit account that presenters pay from
+type AccountRest struct {
+	ID        string           `json:"account_id"`
+	Name      string           `json:"name"`
+	Status    string           `json:"status"`
+	Balance   string           `json:"balance"`
+	UserIDs   []string         `json:"user_ids"`
+	CreatedAt time.Time        `json:"created_at"`
+	CreatedBy string           `json:"created_by"`
+	Kind      string           `json:"kind"`
+	Links     AccountLinksRest `json:"links"`
+}
+
+// AccountLinksRest is a set of URLs related to the credit account, including self
+type AccountLinksRest struct {
+	Self      string `json:"self"`
+	Statement string `json:"statement"`
+}
+
+// AccountLedgerEntryRest is a debit or credit to a credit account. The amount is negative for a debit, and the
+// balance is that of the account once the entry was made.
+type AccountLedgerEntryRest struct {
+	ID        string    `json:"entry_id"`
+	Type      string    `json:"type"`
+	Amount    string    `json:"amount"`
+	Balance   string    `json:"balance"`
+	PaymentID string    `json:"payment_id,omitempty"`
+	Reference string    `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// AccountStatementRest is the current balance of a credit account, and the entries made to it over a period, the
+// earliest first
+type AccountStatementRest struct {
+	AccountID string                   `json:"account_id"`
+	Balance   string                   `json:"balance"`
+	Entries   []AccountLedgerEntryRest `json:"entries"`
+	Kind      string                   `json:"kind"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// BankTransferDB is the remittance reference and bank account a payer paying by bank transfer was given, as stored
+// against their payment session. The amount received is the total of the credits matched to the session so far.
+type BankTransferDB struct {
+	Reference      string    `bson:"reference"`
+	AccountName    string    `bson:"account_name"`
+	SortCode       string    `bson:"sort_code"`
+	AccountNumber  string    `bson:"account_number"`
+	IBAN           string    `bson:"iban,omitempty"`
+	BIC            string    `bson:"bic,omitempty"`
+	AmountReceived string    `bson:"amount_received,omitempty"`
+	RequestedAt    time.Time `bson:"requested_at"`
+}
+
+// BankCreditDB is a credit imported from a bank statement, as stored in the DB. The ID is derived from the bank's
+// reference for the transaction, so that a credit is only imported once however many statements it appears on.
+type BankCreditDB struct {
+	ID                  string    `bson:"_id"`
+	StatementID         string    `bson:"statement_id"`
+	BookedAt            time.Time `bson:"booked_at"`
+	Amount              string    `bson:"amount"`
+	Narrative           string    `bson:"narrative"`
+	RemittanceReference string    `bson:"remittance_reference,omitempty"`
+	PaymentID           string    `bson:"payment_id,omitempty"`
+	Outcome             string    `bson:"outcome"`
+	ImportedAt          time.Time `bson:"imported_at"`
+	ImportedBy          string    `bson:"imported_by"`
+}
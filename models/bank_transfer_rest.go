@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// BankTransferRest is the remittance reference a payer must quote when paying a payment session by bank transfer, and
+// the bank account to pay into
+type BankTransferRest struct {
+	Reference      string `json:"reference"`
+	AccountName    string `json:"account_name"`
+	SortCode       string `json:"sort_code"`
+	AccountNumber  string `json:"account_number"`
+	IBAN           string `json:"iban,omitempty"`
+	BIC            string `json:"bic,omitempty"`
+	AmountReceived string `json:"amount_received,omitempty"`
+}
+
+// BankCreditRest is a credit imported from a bank statement, and the outcome of matching it to a payment session
+type BankCreditRest struct {
+	ID                  string    `json:"credit_id"`
+	StatementID         string    `json:"statement_id"`
+	BookedAt            time.Time `json:"booked_at"`
+	Amount              string    `json:"amount"`
+	Narrative           string    `json:"narrative"`
+	RemittanceReference string    `json:"remittance_reference,omitempty"`
+	PaymentID           string    `json:"payment_id,omitempty"`
+	Outcome             string    `json:"outcome"`
+	ImportedAt          time.Time `json:"imported_at"`
+	ImportedBy          string    `json:"imported_by"`
+}
+
+// BankStatementImportRest is the outcome of importing the credits on a bank statement. Credits already imported from an
+// earlier statement are counted as duplicates and aren't matched again.
+type BankStatementImportRest struct {
+	StatementID string           `json:"statement_id"`
+	Format      string           `json:"format"`
+	Paid        int              `json:"paid"`
+	Underpaid   int              `json:"underpaid"`
+	Overpaid    int              `json:"overpaid"`
+	Exceptions  int              `json:"exceptions"`
+	Duplicates  int              `json:"duplicates"`
+	Credits     []BankCreditRest `json:"credits"`
+	Kind        string           `json:"kind"`
+}
+
+// BankCreditExceptionsRest is the credits imported from bank statements that didn't pay a payment session in full, the
+// earliest booked first
+type BankCreditExceptionsRest struct {
+	Items []BankCreditRest `json:"items"`
+	Kind  string           `json:"kind"`
+}
@@ -4,9 +4,13 @@ package models
 type IncomingExternalPaymentJourneyRequest struct {
 	PaymentMethod string `json:"payment_method"`
 	Resource      string `json:"resource"`
+
+	PrefilledCardholderDetails *PrefilledCardholderDetails `json:"prefilled_cardholder_details,omitempty"`
 }
 
-// ExternalPaymentJourney contains the URL required to access external payment provider session
+// ExternalPaymentJourney contains the URL required to access external payment provider session. Journeys paid by bank
+// transfer also contain the details the payer needs to make the transfer.
 type ExternalPaymentJourney struct {
-	NextURL string `json:"NextURL"`
+	NextURL      string            `json:"NextURL"`
+	BankTransfer *BankTransferRest `json:"bank_transfer,omitempty"`
 }
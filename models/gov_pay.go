@@ -8,13 +8,15 @@ type OutgoingGovPayRequest struct {
 	ReturnURL   string   `json:"return_url"`
 	Description string   `json:"description"`
 	Metadata    Metadata `json:"metadata"`
-}
+	Language    string   `json:"language,omitempty"`
 
-type Metadata struct {
-	CompanyNumber      string `json:"company_number"`
-	ProductInformation string `json:"product_information"`
+	PrefilledCardholderDetails *PrefilledCardholderDetails `json:"prefilled_cardholder_details,omitempty"`
 }
 
+// Metadata is the custom metadata sent to GOV.UK Pay with a payment, which is shown against the payment in GOV.UK Pay
+// and included in its reports
+type Metadata map[string]string
+
 // IncomingGovPayResponse is the response expected back from GovPay after a payment session has been successfully initiated
 type IncomingGovPayResponse struct {
 	Amount            int               `json:"amount"`
@@ -4,15 +4,24 @@ import "time"
 
 // PaymentResourceDB contains all payment details to be stored in the DB
 type PaymentResourceDB struct {
-	ID                           string                `bson:"_id"`
-	RedirectURI                  string                `bson:"redirect_uri"`
-	State                        string                `bson:"state"`
-	ExternalPaymentStatusURI     string                `bson:"external_payment_status_url"`
-	ExternalPaymentStatusID      string                `bson:"external_payment_status_id"`
-	ExternalPaymentTransactionID string                `bson:"external_payment_transaction_id"`
-	Data                         PaymentResourceDataDB `bson:"data"`
-	Refunds                      []RefundResourceDB    `bson:"refunds"`
-	BulkRefund                   []BulkRefundDB        `bson:"bulk_refunds,omitempty"`
+	ID                           string                        `bson:"_id"`
+	RedirectURI                  string                        `bson:"redirect_uri"`
+	State                        string                        `bson:"state"`
+	ClientID                     string                        `bson:"client_id,omitempty"`
+	ExternalPaymentStatusURI     string                        `bson:"external_payment_status_url"`
+	ExternalPaymentStatusID      string                        `bson:"external_payment_status_id"`
+	ExternalPaymentTransactionID string                        `bson:"external_payment_transaction_id"`
+	CallbackTokenHash            string                        `bson:"callback_token_hash,omitempty"`
+	PrefilledCardholderDetails   *PrefilledCardholderDetailsDB `bson:"prefilled_cardholder_details,omitempty"`
+	ExternalPaymentAttempts      []ExternalPaymentAttemptDB    `bson:"external_payment_attempts,omitempty"`
+	History                      []PaymentHistoryDB            `bson:"history,omitempty"`
+	BankTransfer                 *BankTransferDB               `bson:"bank_transfer,omitempty"`
+	PayerLink                    *PayerLinkDB                  `bson:"payer_link,omitempty"`
+	MessagesPending              []string                      `bson:"messages_pending,omitempty"`
+	MessagesPendingAt            time.Time                     `bson:"messages_pending_at,omitempty"`
+	Data                         PaymentResourceDataDB         `bson:"data"`
+	Refunds                      []RefundResourceDB            `bson:"refunds"`
+	BulkRefund                   []BulkRefundDB                `bson:"bulk_refunds,omitempty"`
 }
 
 // PaymentResourceDataDB is public facing payment details to be returned in the response
@@ -21,7 +30,9 @@ type PaymentResourceDataDB struct {
 	AvailablePaymentMethods []string       `bson:"available_payment_methods,omitempty"`
 	CompletedAt             time.Time      `bson:"completed_at,omitempty"`
 	CreatedAt               time.Time      `bson:"created_at,omitempty"`
+	ExpiresAt               time.Time      `bson:"expires_at,omitempty"`
 	CreatedBy               CreatedByDB    `bson:"created_by"`
+	PaidBy                  *CreatedByDB   `bson:"paid_by,omitempty"`
 	Description             string         `bson:"description"`
 	Links                   PaymentLinksDB `bson:"links"`
 	PaymentMethod           string         `bson:"payment_method"`
@@ -30,9 +41,58 @@ type PaymentResourceDataDB struct {
 	Status                  string         `bson:"status"`
 	Etag                    string         `bson:"etag"`
 	Kind                    string         `bson:"kind"`
+	Language                string         `bson:"language,omitempty"`
 	ProviderID              string         `bson:"provider_id,omitempty"`
 }
 
+// PaymentHistoryDB is a change made to a payment session outside of its payment journey, e.g. an admin override,
+// recording who made it and why
+type PaymentHistoryDB struct {
+	Action            string    `bson:"action"`
+	PreviousStatus    string    `bson:"previous_status"`
+	Status            string    `bson:"status"`
+	Actor             string    `bson:"actor"`
+	Reason            string    `bson:"reason"`
+	EvidenceReference string    `bson:"evidence_reference"`
+	CreatedAt         time.Time `bson:"created_at"`
+}
+
+// ExternalPaymentAttemptDB is a payment created with an external payment provider for a payment session. A session has
+// an attempt for every external payment journey created for it, the latest last. The outcome of an attempt is recorded
+// once it is known that it can't be paid, or that it was paid after another attempt and must be refunded.
+type ExternalPaymentAttemptDB struct {
+	PaymentMethod            string    `bson:"payment_method"`
+	ExternalPaymentStatusURI string    `bson:"external_payment_status_url"`
+	ExternalPaymentStatusID  string    `bson:"external_payment_status_id"`
+	CreatedAt                time.Time `bson:"created_at"`
+	Outcome                  string    `bson:"outcome,omitempty"`
+}
+
+// PayerLinkDB is a link letting someone other than its creator pay a payment session. Only the latest link issued for a
+// session can be used, until it expires or is revoked.
+type PayerLinkDB struct {
+	ID        string    `bson:"id"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	RevokedAt time.Time `bson:"revoked_at,omitempty"`
+}
+
+// PrefilledCardholderDetailsDB are the cardholder details to prefill on the GOV.UK Pay card details page, which are
+// only stored until the external payment journey is created
+type PrefilledCardholderDetailsDB struct {
+	CardholderName string            `bson:"cardholder_name,omitempty"`
+	BillingAddress *BillingAddressDB `bson:"billing_address,omitempty"`
+}
+
+// BillingAddressDB is the billing address of a cardholder
+type BillingAddressDB struct {
+	Line1    string `bson:"line1,omitempty"`
+	Line2    string `bson:"line2,omitempty"`
+	Postcode string `bson:"postcode,omitempty"`
+	City     string `bson:"city,omitempty"`
+	Country  string `bson:"country,omitempty"`
+}
+
 // CreatedByDB is the user who is creating the payment session
 type CreatedByDB struct {
 	Email    string `bson:"email"`
@@ -43,10 +103,11 @@ type CreatedByDB struct {
 
 // PaymentLinksDB is a set of URLs related to the resource, including self
 type PaymentLinksDB struct {
-	Journey  string `bson:"journey"`
-	Resource string `bson:"resource"`
-	Self     string `bson:"self" validate:"required"`
-	Refunds  string `bson:"refunds,omitempty"`
+	Journey   string   `bson:"journey"`
+	Resource  string   `bson:"resource"`
+	Resources []string `bson:"resources,omitempty"`
+	Self      string   `bson:"self" validate:"required"`
+	Refunds   string   `bson:"refunds,omitempty"`
 }
 
 // CostLinksDB is a set of URLs related to the resource, including self
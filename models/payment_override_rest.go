@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IncomingPaymentOverride is the data received in the body of a request to override the outcome of a payment session
+type IncomingPaymentOverride struct {
+	Override          string `json:"override"           validate:"required,oneof=paid-offline waived failed"`
+	Reason            string `json:"reason"             validate:"required,max=500"`
+	EvidenceReference string `json:"evidence_reference" validate:"required,max=255"`
+}
+
+// PaymentHistoryRest is an override made to the outcome of a payment session, recording who made it and why
+type PaymentHistoryRest struct {
+	Action            string    `json:"action"`
+	PreviousStatus    string    `json:"previous_status"`
+	Status            string    `json:"status"`
+	Actor             string    `json:"actor"`
+	Reason            string    `json:"reason"`
+	EvidenceReference string    `json:"evidence_reference"`
+	CreatedAt         time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PaymentRequestDB is an ad-hoc charge raised by an admin, as stored in the DB
+type PaymentRequestDB struct {
+	ID             string                `bson:"_id"`
+	Amount         string                `bson:"amount"`
+	ClassOfPayment string                `bson:"class_of_payment"`
+	Description    string                `bson:"description"`
+	CompanyNumber  string                `bson:"company_number,omitempty"`
+	CreatedAt      time.Time             `bson:"created_at"`
+	CreatedBy      string                `bson:"created_by"`
+	Links          PaymentRequestLinksDB `bson:"links"`
+}
+
+// PaymentRequestLinksDB is a set of URLs related to the payment request, including self
+type PaymentRequestLinksDB struct {
+	Self     string `bson:"self"`
+	Journey  string `bson:"journey"`
+	Resource string `bson:"resource"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// IncomingPaymentRequest is the data received in the body of a request to raise a payment request
+type IncomingPaymentRequest struct {
+	Amount         string `json:"amount"           validate:"required"`
+	ClassOfPayment string `json:"class_of_payment" validate:"required"`
+	Description    string `json:"description"      validate:"required,max=255"`
+	CompanyNumber  string `json:"company_number"`
+}
+
+// PaymentRequestRest is an ad-hoc charge raised by an admin without a backing service. It is paid through the normal
+// payment journey, by creating a payment session for its resource.
+type PaymentRequestRest struct {
+	Amount         string                  `json:"amount"`
+	ClassOfPayment string                  `json:"class_of_payment"`
+	Description    string                  `json:"description"`
+	CompanyNumber  string                  `json:"company_number,omitempty"`
+	CreatedAt      time.Time               `json:"created_at"`
+	CreatedBy      string                  `json:"created_by"`
+	Kind           string                  `json:"kind"`
+	Links          PaymentRequestLinksRest `json:"links"`
+}
+
+// PaymentRequestLinksRest is a set of URLs related to the payment request. Journey is the link shared with the payer,
+// and Resource is the cost resource payment sessions for the request are created with.
+type PaymentRequestLinksRest struct {
+	Self     string `json:"self"`
+	Journey  string `json:"journey"`
+	Resource string `json:"resource"`
+}
@@ -6,8 +6,39 @@ import "time"
 type IncomingPaymentResourceRequest struct {
 	RedirectURI string `json:"redirect_uri" validate:"required,url"`
 	Reference   string `json:"reference"`
-	Resource    string `json:"resource"     validate:"required,url"`
+	Resource    string `json:"resource"     validate:"required_without=Resources,omitempty,url"`
 	State       string `json:"state"        validate:"required"`
+	Language    string `json:"language"     validate:"omitempty,oneof=en cy"`
+
+	// Resources are the cost resources paid for together by a basket session, given instead of Resource
+	Resources []string `json:"resources,omitempty" validate:"omitempty,max=10,unique,dive,url"`
+
+	// ExpiryTimeInMinutes is how long the session can be paid for, in place of the default for its class of payment
+	ExpiryTimeInMinutes int `json:"expiry_time_in_minutes,omitempty" validate:"omitempty,min=1"`
+
+	PrefilledCardholderDetails *PrefilledCardholderDetails `json:"prefilled_cardholder_details,omitempty"`
+}
+
+// ExtendPaymentSessionRequest is the data received in the body of a request to extend a payment session, which then
+// expires the given number of minutes from now
+type ExtendPaymentSessionRequest struct {
+	ExpiryTimeInMinutes int `json:"expiry_time_in_minutes" validate:"required,min=1"`
+}
+
+// PrefilledCardholderDetails are the cardholder name and billing address that GOV.UK Pay prefills on its card details
+// page, so that users don't have to type in details the calling service already knows
+type PrefilledCardholderDetails struct {
+	CardholderName string          `json:"cardholder_name,omitempty" validate:"max=255"`
+	BillingAddress *BillingAddress `json:"billing_address,omitempty"`
+}
+
+// BillingAddress is the billing address of a cardholder. Country is a two letter ISO 3166-1 country code.
+type BillingAddress struct {
+	Line1    string `json:"line1,omitempty"    validate:"max=255"`
+	Line2    string `json:"line2,omitempty"    validate:"max=255"`
+	Postcode string `json:"postcode,omitempty" validate:"max=25"`
+	City     string `json:"city,omitempty"     validate:"max=255"`
+	Country  string `json:"country,omitempty"  validate:"omitempty,len=2,alpha"`
 }
 
 // PaymentResourceRest is public facing payment details to be returned in the response
@@ -16,7 +47,9 @@ type PaymentResourceRest struct {
 	AvailablePaymentMethods []string                    `json:"available_payment_methods,omitempty"`
 	CompletedAt             time.Time                   `json:"completed_at,omitempty"`
 	CreatedAt               time.Time                   `json:"created_at,omitempty"`
+	ExpiresAt               time.Time                   `json:"expires_at,omitempty"`
 	CreatedBy               CreatedByRest               `json:"created_by"`
+	PaidBy                  *CreatedByRest              `json:"paid_by,omitempty"`
 	Description             string                      `json:"description"`
 	Links                   PaymentLinksRest            `json:"links"`
 	ProviderID              string                      `json:"provider_id,omitempty"`
@@ -27,8 +60,10 @@ type PaymentResourceRest struct {
 	Costs                   []CostResourceRest          `json:"costs"`
 	Etag                    string                      `json:"etag"`
 	Kind                    string                      `json:"kind"`
+	Language                string                      `json:"language,omitempty"`
 	MetaData                PaymentResourceMetaDataRest `json:"-"`
 	Refunds                 []RefundResourceRest        `json:"refunds,omitempty"`
+	BankTransfer            *BankTransferRest           `json:"bank_transfer,omitempty"`
 }
 
 // PaymentResourceMetaDataRest contains all metadata fields that are relevant to the payment resource but not part of the Rest resource
@@ -36,9 +71,42 @@ type PaymentResourceMetaDataRest struct {
 	ID                           string
 	RedirectURI                  string
 	State                        string
+	ClientID                     string
 	ExternalPaymentStatusURI     string
 	ExternalPaymentStatusID      string
 	ExternalPaymentTransactionID string
+	CallbackToken                string // only set while an external payment journey is created, never stored
+	CallbackTokenHash            string // the hash of the callback token of the latest external payment journey, until used
+	CallbackTokenOutstanding     bool   // whether the callback token of the latest external payment journey is unused
+	PrefilledCardholderDetails   *PrefilledCardholderDetails
+	ExternalPaymentAttempts      []ExternalPaymentAttempt
+	PayerLink                    *PayerLink
+}
+
+// PayerLink is the latest link issued to let someone other than its creator pay a payment session
+type PayerLink struct {
+	ID        string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt time.Time
+}
+
+// PayerLinkRest is a link letting someone other than its creator pay a payment session. The link is only returned when
+// it is created.
+type PayerLinkRest struct {
+	Link      string    `json:"link"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Kind      string    `json:"kind"`
+}
+
+// ExternalPaymentAttempt is a payment created with an external payment provider for a payment session
+type ExternalPaymentAttempt struct {
+	PaymentMethod            string
+	ExternalPaymentStatusURI string
+	ExternalPaymentStatusID  string
+	CreatedAt                time.Time
+	Outcome                  string
 }
 
 // CreatedByRest is the user who is creating the payment session
@@ -49,12 +117,14 @@ type CreatedByRest struct {
 	Surname  string `json:"surname"`
 }
 
-// PaymentLinksRest is a set of URLs related to the resource, including self
+// PaymentLinksRest is a set of URLs related to the resource, including self. Resources are only set on basket
+// sessions, whose Resource is the first of them.
 type PaymentLinksRest struct {
-	Journey  string `json:"journey"`
-	Resource string `json:"resource"`
-	Self     string `json:"self" validate:"required"`
-	Refunds  string `json:"refunds"`
+	Journey   string   `json:"journey"`
+	Resource  string   `json:"resource"`
+	Resources []string `json:"resources,omitempty"`
+	Self      string   `json:"self" validate:"required"`
+	Refunds   string   `json:"refunds"`
 }
 
 // CostsRest contains details of all the Cost Resources
@@ -79,6 +149,9 @@ type CostResourceRest struct {
 	DescriptionIdentifier   string            `json:"description_identifier"    validate:"required"`
 	ProductType             string            `json:"product_type"              validate:"required"`
 	DescriptionValues       map[string]string `json:"description_values"`
+
+	// Resource is the cost resource the cost is for, which is only set on the costs of basket sessions
+	Resource string `json:"resource,omitempty"`
 }
 
 // PendingRefundPaymentsResourceRest contains a list of PaymentResourceRest with pending refund status and a total count
@@ -12,4 +12,5 @@ type RefundResourceDB struct {
 	Attempts          int        `bson:"attempts,omitempty"`
 	ExternalRefundUrl string     `bson:"external_refund_url"`
 	RefundReference   string     `bson:"refund_reference"`
+	Resource          string     `bson:"resource,omitempty"`
 }
@@ -6,6 +6,7 @@ import "time"
 type CreateRefundRequest struct {
 	Amount          int    `json:"amount"`
 	RefundReference string `json:"refund_reference,omitempty"`
+	Resource        string `json:"resource,omitempty"`
 }
 
 // RefundResponse is the data contained in a refund response
@@ -14,6 +15,7 @@ type RefundResponse struct {
 	CreatedDateTime string `json:"created_date_time"`
 	Amount          int    `json:"amount"`
 	Status          string `json:"status"`
+	Resource        string `json:"resource,omitempty"`
 }
 
 // RefundResourceRest is the data contained in a refund resource
@@ -25,4 +27,5 @@ type RefundResourceRest struct {
 	Status            string     `json:"status"`
 	ExternalRefundUrl string     `json:"external_refund_url"`
 	RefundReference   string     `json:"refund_reference"`
+	Resource          string     `json:"resource,omitempty"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ResourceClaimDB is the claim a payment session holds on a cost resource while it is being paid, or once it has been,
+// so that no other session can pay the same resource
+type ResourceClaimDB struct {
+	Resource  string    `bson:"_id"`
+	PaymentID string    `bson:"payment_id"`
+	ExpiresAt time.Time `bson:"expires_at,omitempty"`
+}
@@ -5,13 +5,27 @@ type StatusResponse struct {
 	Status string
 }
 
+// ErrorResponse describes why a request was rejected
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// DuplicatePaymentResponse describes why a payment session wasn't created for an already paid cost resource, linking to
+// the existing payment session when there is one
+type DuplicatePaymentResponse struct {
+	Error string            `json:"error"`
+	Links *PaymentLinksRest `json:"links,omitempty"`
+}
+
 type response_service interface {
 	checkProvider()
 }
 
 // RedirectParams contains parameters for redirecting.
 type RedirectParams struct {
-	State  string
-	Ref    string
-	Status string
+	PaymentID string
+	State     string
+	Ref       string
+	Status    string
+	ErrorCode string
 }
@@ -0,0 +1,4 @@
+// Package redirect signs the parameters the payments service appends to a calling service's redirect_uri, and lets
+// the calling service verify them without making a round trip to the payments API. It only depends on the standard
+// library so that it can be imported by any frontend.
+package redirect
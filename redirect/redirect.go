@@ -0,0 +1,126 @@
+package redirect
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters appended to the redirect_uri.
+const (
+	ParamPaymentID = "payment_id"
+	ParamState     = "state"
+	ParamRef       = "ref"
+	ParamStatus    = "status"
+	ParamErrorCode = "error_code"
+	ParamTimestamp = "timestamp"
+	ParamSignature = "sig"
+)
+
+var (
+	// ErrMissingSignature is returned when the redirect carries no signature or timestamp.
+	ErrMissingSignature = errors.New("redirect is not signed")
+	// ErrInvalidSignature is returned when the signature doesn't match the parameters, which have been tampered with or
+	// signed with a different key.
+	ErrInvalidSignature = errors.New("redirect signature is invalid")
+	// ErrExpired is returned when the redirect was signed longer ago than the maximum age allowed.
+	ErrExpired = errors.New("redirect signature has expired")
+)
+
+// Params are the details of a payment session passed back to the calling service.
+type Params struct {
+	PaymentID string
+	State     string
+	Ref       string
+	Status    string
+	// ErrorCode is only set when the payment couldn't be completed, and says why
+	ErrorCode string
+	Timestamp time.Time
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the params using the given key.
+func Sign(key []byte, p Params) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonical(p)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encode returns the params as query parameters, including a signature when a key is given.
+func Encode(key []byte, p Params) url.Values {
+	query := url.Values{}
+	query.Set(ParamState, p.State)
+	query.Set(ParamRef, p.Ref)
+	query.Set(ParamStatus, p.Status)
+	if p.ErrorCode != "" {
+		query.Set(ParamErrorCode, p.ErrorCode)
+	}
+
+	if len(key) == 0 {
+		return query
+	}
+
+	query.Set(ParamPaymentID, p.PaymentID)
+	query.Set(ParamTimestamp, strconv.FormatInt(p.Timestamp.Unix(), 10))
+	query.Set(ParamSignature, Sign(key, p))
+	return query
+}
+
+// Verify checks the signature on the query parameters of a redirect using the given key, and that it was signed no
+// more than maxAge ago. The params are only returned if they can be trusted.
+func Verify(key []byte, query url.Values, maxAge time.Duration) (*Params, error) {
+	sig := query.Get(ParamSignature)
+	timestamp := query.Get(ParamTimestamp)
+	if sig == "" || timestamp == "" {
+		return nil, ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	p := Params{
+		PaymentID: query.Get(ParamPaymentID),
+		State:     query.Get(ParamState),
+		Ref:       query.Get(ParamRef),
+		Status:    query.Get(ParamStatus),
+		ErrorCode: query.Get(ParamErrorCode),
+		Timestamp: time.Unix(seconds, 0),
+	}
+
+	expected, err := hex.DecodeString(Sign(key, p))
+	if err != nil {
+		return nil, err
+	}
+	actual, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return nil, ErrInvalidSignature
+	}
+
+	if age := time.Since(p.Timestamp); age > maxAge || age < -maxAge {
+		return nil, ErrExpired
+	}
+
+	return &p, nil
+}
+
+// canonical joins the escaped params so that no two sets of params produce the same message. The error code is only
+// included when it is set, so that signatures made before it was added still verify.
+func canonical(p Params) string {
+	fields := []string{
+		url.QueryEscape(p.PaymentID),
+		url.QueryEscape(p.State),
+		url.QueryEscape(p.Ref),
+		url.QueryEscape(p.Status),
+		strconv.FormatInt(p.Timestamp.Unix(), 10),
+	}
+	if p.ErrorCode != "" {
+		fields = append(fields, url.QueryEscape(p.ErrorCode))
+	}
+	return strings.Join(fields, "&")
+}
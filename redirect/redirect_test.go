@@ -0,0 +1,123 @@
+package redirect
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+var params = Params{
+	PaymentID: "1234",
+	State:     "state",
+	Ref:       "ref",
+	Status:    "paid",
+	Timestamp: time.Now(),
+}
+
+func TestUnitEncode(t *testing.T) {
+	Convey("Signed params", t, func() {
+		query := Encode(key, params)
+		So(query.Get(ParamPaymentID), ShouldEqual, "1234")
+		So(query.Get(ParamState), ShouldEqual, "state")
+		So(query.Get(ParamRef), ShouldEqual, "ref")
+		So(query.Get(ParamStatus), ShouldEqual, "paid")
+		So(query.Get(ParamSignature), ShouldEqual, Sign(key, params))
+	})
+
+	Convey("Unsigned params without a key", t, func() {
+		query := Encode(nil, params)
+		So(query.Get(ParamStatus), ShouldEqual, "paid")
+		So(query.Get(ParamTimestamp), ShouldBeEmpty)
+		So(query.Get(ParamSignature), ShouldBeEmpty)
+	})
+}
+
+func TestUnitVerify(t *testing.T) {
+	Convey("Valid signature", t, func() {
+		p, err := Verify(key, Encode(key, params), time.Minute)
+		So(err, ShouldBeNil)
+		So(p.PaymentID, ShouldEqual, "1234")
+		So(p.Status, ShouldEqual, "paid")
+	})
+
+	Convey("Missing signature", t, func() {
+		p, err := Verify(key, Encode(nil, params), time.Minute)
+		So(p, ShouldBeNil)
+		So(err, ShouldEqual, ErrMissingSignature)
+	})
+
+	Convey("Tampered status", t, func() {
+		unpaid := params
+		unpaid.Status = "failed"
+		query := Encode(key, unpaid)
+		query.Set(ParamStatus, "paid")
+
+		p, err := Verify(key, query, time.Minute)
+		So(p, ShouldBeNil)
+		So(err, ShouldEqual, ErrInvalidSignature)
+	})
+
+	Convey("Error code", t, func() {
+		expired := params
+		expired.Status = "expired"
+		expired.ErrorCode = "expired"
+		query := Encode(key, expired)
+		So(query.Get(ParamErrorCode), ShouldEqual, "expired")
+
+		p, err := Verify(key, query, time.Minute)
+		So(err, ShouldBeNil)
+		So(p.ErrorCode, ShouldEqual, "expired")
+
+		query.Del(ParamErrorCode)
+		p, err = Verify(key, query, time.Minute)
+		So(p, ShouldBeNil)
+		So(err, ShouldEqual, ErrInvalidSignature)
+	})
+
+	Convey("Parameters can't be shifted between fields", t, func() {
+		query := Encode(key, Params{State: "a&b", Ref: "c", Timestamp: params.Timestamp})
+		query.Set(ParamState, "a")
+		query.Set(ParamRef, "b&c")
+
+		_, err := Verify(key, query, time.Minute)
+		So(err, ShouldEqual, ErrInvalidSignature)
+	})
+
+	Convey("Signed with a different key", t, func() {
+		_, err := Verify([]byte("another key"), Encode(key, params), time.Minute)
+		So(err, ShouldEqual, ErrInvalidSignature)
+	})
+
+	Convey("Expired signature", t, func() {
+		old := params
+		old.Timestamp = time.Now().Add(-time.Hour)
+
+		_, err := Verify(key, Encode(key, old), time.Minute)
+		So(err, ShouldEqual, ErrExpired)
+	})
+
+	Convey("Malformed signature", t, func() {
+		query := Encode(key, params)
+		query.Set(ParamSignature, "not hex")
+
+		_, err := Verify(key, query, time.Minute)
+		So(err, ShouldEqual, ErrInvalidSignature)
+
+		query = Encode(key, params)
+		query.Set(ParamTimestamp, "yesterday")
+
+		_, err = Verify(key, query, time.Minute)
+		So(err, ShouldEqual, ErrInvalidSignature)
+	})
+
+	Convey("Redirect URL round trip", t, func() {
+		u, _ := url.Parse("https://frontend/callback?" + Encode(key, params).Encode())
+
+		_, err := Verify(key, u.Query(), time.Minute)
+		So(err, ShouldBeNil)
+	})
+}
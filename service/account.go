@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/mappers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/plutov/paypal/v4"
+	"github.com/shopspring/decimal"
+)
+
+// PaymentMethodAccount is the payment method of payment sessions paid from a Companies House credit account
+const PaymentMethodAccount = "account"
+
+// Statuses of credit accounts. Only active accounts can be paid from.
+const (
+	AccountStatusActive    = "active"
+	AccountStatusSuspended = "suspended"
+)
+
+// Types of the entries on the ledger of credit accounts
+const (
+	AccountEntryTopUp    = "top-up"
+	AccountEntryPayment  = "payment"
+	AccountEntryRefund   = "refund"
+	AccountEntryReversal = "reversal"
+)
+
+// pendingDebitSettleDelay is how long a pending debit is left to the journey which made it before it is reconciled. It
+// is far longer than a journey takes, so that only debits left by journeys which have stopped are reconciled.
+const pendingDebitSettleDelay = 5 * time.Minute
+
+// AccountService handles paying for payment sessions from the Companies House credit account of the presenter who
+// created them. Payments are debited from the account's ledger and completed as the journey is created, without
+// sending the user to an external payment provider.
+type AccountService struct {
+	PaymentService PaymentService
+}
+
+// CheckPaymentProviderStatus checks whether the payment session has been debited from a credit account
+func (as *AccountService) CheckPaymentProviderStatus(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
+	entry, responseType, err := as.getPaymentEntry(ctx, paymentResource)
+	if err != nil {
+		return nil, "", responseType, err
+	}
+	if entry == nil {
+		return &models.StatusResponse{Status: InProgress.String()}, "", Success, nil
+	}
+	return &models.StatusResponse{Status: Paid.String()}, entry.ID, Success, nil
+}
+
+// CreatePaymentAndGenerateNextURL debits the payment session from the credit account of the presenter paying it and
+// completes the session. The debit is pending until the session has been completed with it, so that a debit left by a
+// journey which stops in between is settled or reversed by ReconcilePendingDebits. The next URL returns the user
+// straight to the calling service.
+func (as *AccountService) CreatePaymentAndGenerateNextURL(req *http.Request, paymentResource *models.PaymentResourceRest) (string, ResponseType, error) {
+	payer := payerOf(paymentResource)
+	account, err := as.PaymentService.DAO.GetAccountByUserIDs(req.Context(), []string{payer.ID})
+	if err != nil {
+		return "", Error, fmt.Errorf("error getting account from DB: [%v]", err)
+	}
+	if account == nil {
+		return "", InvalidData, fmt.Errorf("no account found for user [%s]", payer.ID)
+	}
+	if account.Status != AccountStatusActive {
+		return "", InvalidData, fmt.Errorf("account [%s] is [%s]", account.ID, account.Status)
+	}
+
+	amount, err := convertToPenceFromDecimal(paymentResource.Amount)
+	if err != nil {
+		return "", Error, fmt.Errorf("error converting amount to pence: [%v]", err)
+	}
+	if account.Balance < amount {
+		return "", InvalidData, fmt.Errorf("account [%s] balance is less than the amount [%s]", account.ID, paymentResource.Amount)
+	}
+
+	now := helpers.MongoNow()
+	entry := models.AccountLedgerEntryDB{
+		ID:        helpers.GenerateID(),
+		AccountID: account.ID,
+		Type:      AccountEntryPayment,
+		Amount:    -amount,
+		PaymentID: paymentResource.MetaData.ID,
+		Reference: paymentResource.Reference,
+		CreatedAt: now,
+		CreatedBy: payer.Email,
+		Pending:   true,
+	}
+
+	// The balance is checked again as the account is debited, as it may have changed since it was read
+	debited, err := as.PaymentService.DAO.DebitAccount(req.Context(), &entry, AccountStatusActive)
+	if err != nil {
+		return "", Error, fmt.Errorf("error debiting account: [%v]", err)
+	}
+	if !debited {
+		return "", InvalidData, fmt.Errorf("account [%s] is no longer active, or its balance is less than the amount [%s]", account.ID, paymentResource.Amount)
+	}
+
+	paymentUpdate := *paymentResource
+	paymentUpdate.Status = Paid.String()
+	paymentUpdate.CompletedAt = now
+	paymentUpdate.ProviderID = entry.ID
+	// A session whose last attempt failed is completed from the failed status, as it isn't reopened before it is paid
+	retrying := isRetryableFailure(paymentResource.Status)
+	completed, _, err := as.PaymentService.completePaymentSession(req, paymentResource.MetaData.ID, "", retrying, paymentUpdate)
+	if err == nil && !completed {
+		err = errors.New("payment session is no longer in progress")
+	}
+	if err != nil {
+		// The session wasn't completed by this debit, e.g. because another journey completed it first, so the
+		// account is credited back
+		if as.reverseDebit(req, entry) {
+			as.settleDebit(req, entry)
+		}
+		return "", Error, fmt.Errorf("error completing payment session: [%v]", err)
+	}
+	as.settleDebit(req, entry)
+
+	log.InfoR(req, "payment session paid from account", log.Data{"payment_id": paymentResource.MetaData.ID, "account_id": account.ID, "entry_id": entry.ID})
+
+	*paymentResource = paymentUpdate
+	return accountJourneyURL(as.PaymentService.Config.PaymentsAPIURL, paymentResource.MetaData.ID), Success, nil
+}
+
+// reverseDebit credits back a debit made for a payment session which couldn't be completed, and reports whether it did
+func (as *AccountService) reverseDebit(req *http.Request, debit models.AccountLedgerEntryDB) bool {
+	reversal := models.AccountLedgerEntryDB{
+		ID:        helpers.GenerateID(),
+		AccountID: debit.AccountID,
+		Type:      AccountEntryReversal,
+		Amount:    -debit.Amount,
+		PaymentID: debit.PaymentID,
+		Reference: debit.ID,
+		CreatedAt: helpers.MongoNow(),
+	}
+	credited, err := as.PaymentService.DAO.CreditAccount(req.Context(), &reversal)
+	if err == nil && !credited {
+		err = errors.New("account not found")
+	}
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error reversing debit [%s] from account [%s]: [%v]", debit.ID, debit.AccountID, err))
+		return false
+	}
+	return true
+}
+
+// settleDebit records that a pending debit has been settled. A debit which can't be settled now is settled by
+// ReconcilePendingDebits, which finds the session completed with it or the debit reversed.
+func (as *AccountService) settleDebit(req *http.Request, debit models.AccountLedgerEntryDB) {
+	err := as.PaymentService.DAO.SettleAccountLedgerEntry(req.Context(), debit.ID)
+	if err != nil {
+		log.ErrorR(req, fmt.Errorf("error settling debit [%s] from account [%s], leaving it to be reconciled: [%v]", debit.ID, debit.AccountID, err))
+	}
+}
+
+// ReconcilePendingDebits settles the debits from credit accounts left pending by journeys which stopped between
+// debiting the account and completing the payment session, returning those settled. A debit the session was completed
+// with is settled as it is, and any other is reversed, crediting the account back. Debits made in the last few minutes
+// are left to the journey which made them.
+func (as *AccountService) ReconcilePendingDebits(req *http.Request) ([]models.AccountLedgerEntryRest, error) {
+	debits, err := as.PaymentService.DAO.GetPendingAccountLedgerEntries(req.Context(), time.Now().Add(-pendingDebitSettleDelay))
+	if err != nil {
+		err = fmt.Errorf("error getting pending account debits: [%v]", err)
+		log.ErrorR(req, err)
+		return nil, err
+	}
+
+	settled := make([]models.AccountLedgerEntryRest, 0, len(debits))
+	for _, debit := range debits {
+		logData := log.Data{"entry_id": debit.ID, "account_id": debit.AccountID, "payment_id": debit.PaymentID}
+
+		paymentResource, err := as.PaymentService.DAO.GetPaymentResource(req.Context(), debit.PaymentID)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error getting payment session of pending debit: [%v]", err), logData)
+			continue
+		}
+		if paymentResource == nil || paymentResource.Data.ProviderID != debit.ID {
+			reversed, err := as.isReversed(req.Context(), debit)
+			if err != nil {
+				log.ErrorR(req, err, logData)
+				continue
+			}
+			if !reversed && !as.reverseDebit(req, debit) {
+				continue
+			}
+			log.InfoR(req, "reversed pending debit whose payment session wasn't completed with it", logData)
+		}
+
+		err = as.PaymentService.DAO.SettleAccountLedgerEntry(req.Context(), debit.ID)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error settling pending debit: [%v]", err), logData)
+			continue
+		}
+		settled = append(settled, transformAccountLedgerEntryToRest(debit))
+	}
+
+	return settled, nil
+}
+
+// isReversed reports whether a debit has already been reversed, e.g. by a reconciliation which couldn't then settle it
+func (as *AccountService) isReversed(ctx context.Context, debit models.AccountLedgerEntryDB) (bool, error) {
+	entries, err := as.PaymentService.DAO.GetAccountLedgerEntriesForPayment(ctx, debit.PaymentID)
+	if err != nil {
+		return false, fmt.Errorf("error getting account ledger entries from DB: [%v]", err)
+	}
+	for _, entry := range entries {
+		if entry.Type == AccountEntryReversal && entry.Reference == debit.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetPaymentDetails gets the details of the debit made from a credit account for a payment session
+func (as *AccountService) GetPaymentDetails(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
+	entry, responseType, err := as.getPaymentEntry(ctx, paymentResource)
+	if err != nil {
+		return nil, responseType, err
+	}
+	if entry == nil {
+		return nil, Error, fmt.Errorf("no account debit found for payment session [%s]", paymentResource.MetaData.ID)
+	}
+
+	return &models.PaymentDetails{
+		ExternalPaymentID: entry.ID,
+		TransactionDate:   entry.CreatedAt.Format(time.RFC3339Nano),
+		PaymentStatus:     "accepted",
+		ProviderID:        entry.ID,
+	}, Success, nil
+}
+
+// getPaymentEntry returns the ledger entry of the debit made for a payment session, or nil if it hasn't been debited.
+// The debit is found by the session's ID rather than its provider ID, as a session debited but not yet completed has no
+// provider ID. Debits which have been reversed, e.g. those of a journey beaten to completing the session, are skipped.
+func (as *AccountService) getPaymentEntry(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.AccountLedgerEntryDB, ResponseType, error) {
+	entries, err := as.PaymentService.DAO.GetAccountLedgerEntriesForPayment(ctx, paymentResource.MetaData.ID)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting account ledger entries from DB: [%v]", err)
+	}
+
+	reversed := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Type == AccountEntryReversal {
+			reversed[entry.Reference] = true
+		}
+	}
+
+	var debit *models.AccountLedgerEntryDB
+	for i, entry := range entries {
+		if entry.Type == AccountEntryPayment && !reversed[entry.ID] {
+			debit = &entries[i]
+		}
+	}
+	return debit, Success, nil
+}
+
+// GetRefundSummary gets the amount of a payment session paid from a credit account that is still available to refund
+func (as *AccountService) GetRefundSummary(req *http.Request, id string) (*models.PaymentResourceRest, *models.RefundSummary, ResponseType, error) {
+	paymentSession, responseType, err := as.PaymentService.GetPaymentSession(req, id)
+	if err != nil {
+		return nil, nil, responseType, fmt.Errorf("error getting payment resource: [%v]", err)
+	}
+	if paymentSession == nil {
+		return nil, nil, NotFound, fmt.Errorf("error getting payment resource")
+	}
+
+	amount, err := convertToPenceFromDecimal(paymentSession.Amount)
+	if err != nil {
+		return nil, nil, Error, fmt.Errorf("error converting amount to pence: [%v]", err)
+	}
+	refunded := 0
+	for _, refund := range paymentSession.Refunds {
+		if refund.Status != mappers.RefundStatusError {
+			refunded += refund.Amount
+		}
+	}
+
+	refundSummary := &models.RefundSummary{
+		Status:          RefundAvailable,
+		AmountAvailable: amount - refunded,
+		AmountSubmitted: refunded,
+	}
+	if refundSummary.AmountAvailable <= 0 {
+		refundSummary.Status = RefundFull
+		refundSummary.AmountAvailable = 0
+	}
+
+	return paymentSession, refundSummary, Success, nil
+}
+
+// CreateRefund credits a refund of a payment session back to the credit account it was paid from. The refund is
+// complete once made. The refund is added to the total refunded from the session's debit before the account is
+// credited, and only if the total stays within the amount paid, so that refunds made at once can't refund more than
+// was paid.
+func (as *AccountService) CreateRefund(ctx context.Context, paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+	debit, responseType, err := as.getPaymentEntry(ctx, paymentResource)
+	if err != nil {
+		return nil, responseType, err
+	}
+	if debit == nil {
+		return nil, Error, fmt.Errorf("no account debit found for payment session [%s]", paymentResource.MetaData.ID)
+	}
+
+	added, err := as.PaymentService.DAO.AddAccountLedgerEntryRefund(ctx, debit, refundRequest.Amount)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error adding refund to account debit: [%v]", err)
+	}
+	if !added {
+		return nil, InvalidData, fmt.Errorf("refund amount is higher than the amount left to refund from account debit [%s]", debit.ID)
+	}
+
+	entry := models.AccountLedgerEntryDB{
+		ID:        helpers.GenerateID(),
+		AccountID: debit.AccountID,
+		Type:      AccountEntryRefund,
+		Amount:    refundRequest.Amount,
+		PaymentID: paymentResource.MetaData.ID,
+		Reference: paymentResource.Reference,
+		CreatedAt: helpers.MongoNow(),
+	}
+	credited, err := as.PaymentService.DAO.CreditAccount(ctx, &entry)
+	if err == nil && !credited {
+		err = fmt.Errorf("account [%s] not found", debit.AccountID)
+	}
+	if err != nil {
+		// The refund wasn't made, so it is taken back off the total refunded from the debit
+		_, removeErr := as.PaymentService.DAO.AddAccountLedgerEntryRefund(ctx, debit, -refundRequest.Amount)
+		if removeErr != nil {
+			log.Error(fmt.Errorf("error removing refund from account debit [%s]: [%v]", debit.ID, removeErr))
+		}
+		return nil, Error, fmt.Errorf("error crediting account: [%v]", err)
+	}
+
+	return &models.CreateRefundGovPayResponse{
+		RefundId:    entry.ID,
+		CreatedDate: entry.CreatedAt.Format(time.RFC3339Nano),
+		Amount:      entry.Amount,
+		Status:      RefundsStatusSuccess,
+	}, Success, nil
+}
+
+// GetRefundStatus gets the status of a refund credited back to a credit account, which is complete once made
+func (as *AccountService) GetRefundStatus(ctx context.Context, paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+	entry, err := as.PaymentService.DAO.GetAccountLedgerEntry(ctx, refundId)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting account ledger entry from DB: [%v]", err)
+	}
+	if entry == nil || entry.Type != AccountEntryRefund || entry.PaymentID != paymentResource.MetaData.ID {
+		return nil, NotFound, fmt.Errorf("refund [%s] not found", refundId)
+	}
+
+	return &models.CreateRefundGovPayResponse{
+		RefundId:    entry.ID,
+		CreatedDate: entry.CreatedAt.Format(time.RFC3339Nano),
+		Amount:      entry.Amount,
+		Status:      RefundsStatusSuccess,
+	}, Success, nil
+}
+
+// CapturePayment is a PayPal specific implementation
+// so it does not need to be implemented by the account svc
+func (as *AccountService) CapturePayment(_ context.Context, _ string) (*paypal.CaptureOrderResponse, error) {
+	// not implemented
+	return nil, nil
+}
+
+// GetCapturedPaymentDetails is a PayPal specific implementation
+// so it does not need to be implemented by the account svc
+func (as *AccountService) GetCapturedPaymentDetails(_ context.Context, _ string) (*paypal.CaptureDetailsResponse, error) {
+	// not implemented
+	return nil, nil
+}
+
+// RefundCapture is a PayPal specific implementation
+// so it does not need to be implemented by the account svc
+func (as *AccountService) RefundCapture(_ context.Context, _ string) (*paypal.RefundResponse, error) {
+	// not implemented
+	return nil, nil
+}
+
+// accountJourneyURL returns the link a payment session paid from a credit account sends the user to, which returns
+// them straight to the calling service
+func accountJourneyURL(paymentsAPIURL, id string) string {
+	return fmt.Sprintf("%s/callback/payments/account/%s", paymentsAPIURL, id)
+}
+
+// formatPence returns an amount in pence in the decimal format of payment session amounts, e.g. "12.00"
+func formatPence(amount int) string {
+	return decimal.New(int64(amount), -2).StringFixed(2)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Values returned in the kind field of credit accounts and their statements
+const (
+	AccountKind          = "payment-account#account"
+	AccountStatementKind = "payment-account#statement"
+)
+
+// CreateAccount opens a credit account for presenters to pay from, with a zero balance. A user can only pay from one
+// account.
+func (service *PaymentService) CreateAccount(req *http.Request, incomingAccount models.IncomingAccount, createdBy string) (*models.AccountRest, ResponseType, error) {
+	err := validator.New().Struct(incomingAccount)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid account: [%v]", err)
+	}
+
+	existing, err := service.DAO.GetAccountByUserIDs(req.Context(), incomingAccount.UserIDs)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting account from DB: [%v]", err)
+	}
+	if existing != nil {
+		return nil, Conflict, fmt.Errorf("a user can already pay from account [%s]", existing.ID)
+	}
+
+	account := models.AccountDB{
+		ID:        helpers.GenerateID(),
+		Name:      incomingAccount.Name,
+		Status:    AccountStatusActive,
+		UserIDs:   incomingAccount.UserIDs,
+		CreatedAt: helpers.MongoNow(),
+		CreatedBy: createdBy,
+	}
+
+	err = service.DAO.CreateAccount(req.Context(), &account)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error writing account to DB: [%v]", err)
+	}
+
+	log.InfoR(req, "account created", log.Data{"account_id": account.ID, "created_by": createdBy})
+
+	accountRest := transformAccountToRest(account)
+	return &accountRest, Success, nil
+}
+
+// GetAccount retrieves a credit account
+func (service *PaymentService) GetAccount(req *http.Request, id string) (*models.AccountRest, ResponseType, error) {
+	account, err := service.DAO.GetAccount(req.Context(), id)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting account from DB: [%v]", err)
+	}
+	if account == nil {
+		return nil, NotFound, nil
+	}
+
+	accountRest := transformAccountToRest(*account)
+	return &accountRest, Success, nil
+}
+
+// UpdateAccountStatus changes the status of a credit account, e.g. suspending it so that it can't be paid from
+func (service *PaymentService) UpdateAccountStatus(req *http.Request, id string, incomingAccountStatus models.IncomingAccountStatus, actor string) (*models.AccountRest, ResponseType, error) {
+	err := validator.New().Struct(incomingAccountStatus)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid account status: [%v]", err)
+	}
+
+	updated, err := service.DAO.UpdateAccountStatus(req.Context(), id, incomingAccountStatus.Status)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error updating account status on DB: [%v]", err)
+	}
+	if !updated {
+		return nil, NotFound, nil
+	}
+
+	log.InfoR(req, "account status updated", log.Data{"account_id": id, "status": incomingAccountStatus.Status, "actor": actor})
+
+	return service.GetAccount(req, id)
+}
+
+// TopUpAccount credits funds received from a presenter to their credit account
+func (service *PaymentService) TopUpAccount(req *http.Request, id string, incomingTopUp models.IncomingAccountTopUp, createdBy string) (*models.AccountLedgerEntryRest, ResponseType, error) {
+	err := validator.New().Struct(incomingTopUp)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid top up: [%v]", err)
+	}
+
+	amount, err := getTotalAmount(&[]models.CostResourceRest{{Amount: incomingTopUp.Amount}})
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid top up amount: [%v]", err)
+	}
+	if amount == noPaymentAmount {
+		return nil, InvalidData, errors.New("invalid top up amount: [amount must be greater than zero]")
+	}
+	pence, err := convertToPenceFromDecimal(amount)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid top up amount: [%v]", err)
+	}
+
+	entry := models.AccountLedgerEntryDB{
+		ID:        helpers.GenerateID(),
+		AccountID: id,
+		Type:      AccountEntryTopUp,
+		Amount:    pence,
+		Reference: incomingTopUp.Reference,
+		CreatedAt: helpers.MongoNow(),
+		CreatedBy: createdBy,
+	}
+
+	credited, err := service.DAO.CreditAccount(req.Context(), &entry)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error crediting account: [%v]", err)
+	}
+	if !credited {
+		return nil, NotFound, nil
+	}
+
+	log.InfoR(req, "account topped up", log.Data{"account_id": id, "entry_id": entry.ID, "amount": amount, "created_by": createdBy})
+
+	entryRest := transformAccountLedgerEntryToRest(entry)
+	return &entryRest, Success, nil
+}
+
+// GetAccountStatement retrieves the current balance of a credit account, and the entries made to it from, and before,
+// the given times. A zero time leaves that end of the period open.
+func (service *PaymentService) GetAccountStatement(req *http.Request, id string, from, to time.Time) (*models.AccountStatementRest, ResponseType, error) {
+	account, err := service.DAO.GetAccount(req.Context(), id)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting account from DB: [%v]", err)
+	}
+	if account == nil {
+		return nil, NotFound, nil
+	}
+
+	entries, err := service.DAO.GetAccountLedgerEntries(req.Context(), id, from, to)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting account ledger entries from DB: [%v]", err)
+	}
+
+	statement := models.AccountStatementRest{
+		AccountID: account.ID,
+		Balance:   formatPence(account.Balance),
+		Entries:   make([]models.AccountLedgerEntryRest, 0, len(entries)),
+		Kind:      AccountStatementKind,
+	}
+	for _, entry := range entries {
+		statement.Entries = append(statement.Entries, transformAccountLedgerEntryToRest(entry))
+	}
+
+	return &statement, Success, nil
+}
+
+func transformAccountToRest(account models.AccountDB) models.AccountRest {
+	self := fmt.Sprintf("admin/payments/accounts/%s", account.ID)
+	return models.AccountRest{
+		ID:        account.ID,
+		Name:      account.Name,
+		Status:    account.Status,
+		Balance:   formatPence(account.Balance),
+		UserIDs:   account.UserIDs,
+		CreatedAt: account.CreatedAt,
+		CreatedBy: account.CreatedBy,
+		Kind:      AccountKind,
+		Links: models.AccountLinksRest{
+			Self:      self,
+			Statement: self + "/statement",
+		},
+	}
+}
+
+func transformAccountLedgerEntryToRest(entry models.AccountLedgerEntryDB) models.AccountLedgerEntryRest {
+	return models.AccountLedgerEntryRest{
+		ID:        entry.ID,
+		Type:      entry.Type,
+		Amount:    formatPence(entry.Amount),
+		Balance:   formatPence(entry.Balance),
+		PaymentID: entry.PaymentID,
+		Reference: entry.Reference,
+		CreatedAt: entry.CreatedAt,
+		CreatedBy: entry.CreatedBy,
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCreateAccount(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	incomingAccount := models.IncomingAccount{Name: "Agent Ltd", UserIDs: []string{"user1", "user2"}}
+
+	Convey("Invalid account", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		account, responseType, err := mockPaymentService.CreateAccount(httptest.NewRequest("POST", "/test", nil), models.IncomingAccount{Name: "Agent Ltd"}, "admin")
+		So(account, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "invalid account")
+	})
+
+	Convey("User can already pay from an account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), incomingAccount.UserIDs).Return(&models.AccountDB{ID: "existing"}, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		account, responseType, err := mockPaymentService.CreateAccount(httptest.NewRequest("POST", "/test", nil), incomingAccount, "admin")
+		So(account, ShouldBeNil)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "a user can already pay from account [existing]")
+	})
+
+	Convey("Error writing account to DB", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), incomingAccount.UserIDs).Return(nil, nil)
+		mock.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		account, responseType, err := mockPaymentService.CreateAccount(httptest.NewRequest("POST", "/test", nil), incomingAccount, "admin")
+		So(account, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error writing account to DB: [error]")
+	})
+
+	Convey("Account created", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), incomingAccount.UserIDs).Return(nil, nil)
+		mock.EXPECT().CreateAccount(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		account, responseType, err := mockPaymentService.CreateAccount(httptest.NewRequest("POST", "/test", nil), incomingAccount, "admin")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(account.ID, ShouldNotBeEmpty)
+		So(account.Status, ShouldEqual, AccountStatusActive)
+		So(account.Balance, ShouldEqual, "0.00")
+		So(account.CreatedBy, ShouldEqual, "admin")
+		So(account.Kind, ShouldEqual, AccountKind)
+		So(account.Links.Self, ShouldEqual, "admin/payments/accounts/"+account.ID)
+		So(account.Links.Statement, ShouldEqual, "admin/payments/accounts/"+account.ID+"/statement")
+	})
+}
+
+func TestUnitUpdateAccountStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Invalid status", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		account, responseType, err := mockPaymentService.UpdateAccountStatus(httptest.NewRequest("PATCH", "/test", nil), "acc", models.IncomingAccountStatus{Status: "closed"}, "admin")
+		So(account, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "invalid account status")
+	})
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().UpdateAccountStatus(gomock.Any(), "acc", AccountStatusSuspended).Return(false, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		account, responseType, err := mockPaymentService.UpdateAccountStatus(httptest.NewRequest("PATCH", "/test", nil), "acc", models.IncomingAccountStatus{Status: AccountStatusSuspended}, "admin")
+		So(account, ShouldBeNil)
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Account suspended", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().UpdateAccountStatus(gomock.Any(), "acc", AccountStatusSuspended).Return(true, nil)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(&models.AccountDB{ID: "acc", Status: AccountStatusSuspended, Balance: 1250}, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		account, responseType, err := mockPaymentService.UpdateAccountStatus(httptest.NewRequest("PATCH", "/test", nil), "acc", models.IncomingAccountStatus{Status: AccountStatusSuspended}, "admin")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(account.Status, ShouldEqual, AccountStatusSuspended)
+		So(account.Balance, ShouldEqual, "12.50")
+	})
+}
+
+func TestUnitTopUpAccount(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Invalid top ups", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		testCases := []struct {
+			description string
+			topUp       models.IncomingAccountTopUp
+		}{
+			{"missing reference", models.IncomingAccountTopUp{Amount: "10.00"}},
+			{"amount not a number", models.IncomingAccountTopUp{Amount: "ten", Reference: "BACS-1"}},
+			{"zero amount", models.IncomingAccountTopUp{Amount: "0.00", Reference: "BACS-1"}},
+		}
+
+		for _, tc := range testCases {
+			Convey(tc.description, func() {
+				entry, responseType, err := mockPaymentService.TopUpAccount(req, "acc", tc.topUp, "admin")
+				So(entry, ShouldBeNil)
+				So(responseType, ShouldEqual, InvalidData)
+				So(err.Error(), ShouldStartWith, "invalid top up")
+			})
+		}
+	})
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		entry, responseType, err := mockPaymentService.TopUpAccount(httptest.NewRequest("POST", "/test", nil), "acc", models.IncomingAccountTopUp{Amount: "10.00", Reference: "BACS-1"}, "admin")
+		So(entry, ShouldBeNil)
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Account topped up", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entry *models.AccountLedgerEntryDB) (bool, error) {
+			entry.Balance = 3500
+			return true, nil
+		})
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		entry, responseType, err := mockPaymentService.TopUpAccount(httptest.NewRequest("POST", "/test", nil), "acc", models.IncomingAccountTopUp{Amount: "25.00", Reference: "BACS-1"}, "admin")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(entry.Type, ShouldEqual, AccountEntryTopUp)
+		So(entry.Amount, ShouldEqual, "25.00")
+		So(entry.Balance, ShouldEqual, "35.00")
+		So(entry.Reference, ShouldEqual, "BACS-1")
+		So(entry.CreatedBy, ShouldEqual, "admin")
+	})
+}
+
+func TestUnitGetAccountStatement(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	Convey("Account not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(nil, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statement, responseType, err := mockPaymentService.GetAccountStatement(httptest.NewRequest("GET", "/test", nil), "acc", from, to)
+		So(statement, ShouldBeNil)
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Error getting ledger entries", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(&models.AccountDB{ID: "acc"}, nil)
+		mock.EXPECT().GetAccountLedgerEntries(gomock.Any(), "acc", from, to).Return(nil, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statement, responseType, err := mockPaymentService.GetAccountStatement(httptest.NewRequest("GET", "/test", nil), "acc", from, to)
+		So(statement, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting account ledger entries from DB: [error]")
+	})
+
+	Convey("Statement of the account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccount(gomock.Any(), "acc").Return(&models.AccountDB{ID: "acc", Balance: 1500}, nil)
+		mock.EXPECT().GetAccountLedgerEntries(gomock.Any(), "acc", from, to).Return([]models.AccountLedgerEntryDB{
+			{ID: "1", Type: AccountEntryTopUp, Amount: 2500, Balance: 2500},
+			{ID: "2", Type: AccountEntryPayment, Amount: -1000, Balance: 1500, PaymentID: "1234"},
+		}, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statement, responseType, err := mockPaymentService.GetAccountStatement(httptest.NewRequest("GET", "/test", nil), "acc", from, to)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(statement.Balance, ShouldEqual, "15.00")
+		So(statement.Kind, ShouldEqual, AccountStatementKind)
+		So(statement.Entries, ShouldHaveLength, 2)
+		So(statement.Entries[1].Amount, ShouldEqual, "-10.00")
+		So(statement.Entries[1].PaymentID, ShouldEqual, "1234")
+	})
+}
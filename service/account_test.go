@@ -0,0 +1,623 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitAccountCreatePaymentAndGenerateNextURL(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	paymentResource := func() *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Amount:        "10.00",
+			PaymentMethod: PaymentMethodAccount,
+			Status:        InProgress.String(),
+			Reference:     "ref",
+			CreatedBy:     models.CreatedByRest{ID: "user", Email: "user@companieshouse.gov.uk"},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+	}
+
+	activeAccount := func() *models.AccountDB {
+		return &models.AccountDB{ID: "acc", Status: AccountStatusActive, Balance: 2500, UserIDs: []string{"user"}}
+	}
+
+	Convey("Error getting account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(nil, errors.New("error"))
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting account from DB: [error]")
+	})
+
+	Convey("User has no account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(nil, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "no account found for user [user]")
+	})
+
+	Convey("Account of the payer looked up when the session is paid on behalf of its creator", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"payer"}).Return(nil, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		session := paymentResource()
+		session.PaidBy = &models.CreatedByRest{ID: "payer"}
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), session)
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "no account found for user [payer]")
+	})
+
+	Convey("Account suspended", t, func() {
+		account := activeAccount()
+		account.Status = AccountStatusSuspended
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(account, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "account [acc] is [suspended]")
+	})
+
+	Convey("Balance less than the amount", t, func() {
+		account := activeAccount()
+		account.Balance = 999
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(account, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "account [acc] balance is less than the amount [10.00]")
+	})
+
+	Convey("Account not debited as its balance changed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(activeAccount(), nil)
+		mock.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), AccountStatusActive).Return(false, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "account [acc] is no longer active")
+	})
+
+	Convey("Debit reversed when the payment session is no longer in progress", t, func() {
+		var debit, reversal models.AccountLedgerEntryDB
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(activeAccount(), nil)
+		mock.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), AccountStatusActive).DoAndReturn(func(_ context.Context, entry *models.AccountLedgerEntryDB, _ string) (bool, error) {
+			debit = *entry
+			return true, nil
+		})
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entry *models.AccountLedgerEntryDB) (bool, error) {
+			reversal = *entry
+			return true, nil
+		})
+		settled := mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error completing payment session: [payment session is no longer in progress]")
+		So(debit.Amount, ShouldEqual, -1000)
+		So(reversal.Type, ShouldEqual, AccountEntryReversal)
+		So(reversal.AccountID, ShouldEqual, "acc")
+		So(reversal.Amount, ShouldEqual, 1000)
+		So(reversal.Reference, ShouldEqual, debit.ID)
+		So(debit.Pending, ShouldBeTrue)
+		settled.Times(1)
+	})
+
+	Convey("Debit left pending when it can't be reversed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(activeAccount(), nil)
+		mock.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), AccountStatusActive).Return(true, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(false, errors.New("error"))
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).Times(0)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		_, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error completing payment session: [payment session is no longer in progress]")
+	})
+
+	Convey("Payment session paid from account", t, func() {
+		var debit models.AccountLedgerEntryDB
+		var completion *models.PaymentResourceDB
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(activeAccount(), nil)
+		mock.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), AccountStatusActive).DoAndReturn(func(_ context.Context, entry *models.AccountLedgerEntryDB, _ string) (bool, error) {
+			debit = *entry
+			return true, nil
+		})
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, update *models.PaymentResourceDB) (bool, error) {
+			completion = update
+			return true, nil
+		})
+		var settledID string
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id string) error {
+			settledID = id
+			return nil
+		})
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		resource := paymentResource()
+		url, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), resource)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(url, ShouldEqual, cfg.PaymentsAPIURL+"/callback/payments/account/1234")
+
+		So(debit.AccountID, ShouldEqual, "acc")
+		So(debit.Type, ShouldEqual, AccountEntryPayment)
+		So(debit.Amount, ShouldEqual, -1000)
+		So(debit.PaymentID, ShouldEqual, "1234")
+		So(debit.CreatedBy, ShouldEqual, "user@companieshouse.gov.uk")
+
+		So(completion.Data.Status, ShouldEqual, Paid.String())
+		So(completion.Data.ProviderID, ShouldEqual, debit.ID)
+		So(resource.Status, ShouldEqual, Paid.String())
+		So(resource.ProviderID, ShouldEqual, debit.ID)
+		So(debit.Pending, ShouldBeTrue)
+		So(settledID, ShouldEqual, debit.ID)
+	})
+
+	Convey("Payment session paid from account with its debit left to be reconciled", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(activeAccount(), nil)
+		mock.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), AccountStatusActive).Return(true, nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		resource := paymentResource()
+		_, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), resource)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(resource.Status, ShouldEqual, Paid.String())
+	})
+
+	Convey("Payment session whose last attempt failed is paid from its failed status", t, func() {
+		var completion *models.PaymentResourceDB
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().GetAccountByUserIDs(gomock.Any(), []string{"user"}).Return(activeAccount(), nil)
+		mock.EXPECT().DebitAccount(gomock.Any(), gomock.Any(), AccountStatusActive).Return(true, nil)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ []string, update *models.PaymentResourceDB) (bool, error) {
+			completion = update
+			return true, nil
+		})
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), gomock.Any()).Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		resource := paymentResource()
+		resource.Status = Failed.String()
+		_, responseType, err := accountService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), resource)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(completion.Data.Status, ShouldEqual, Paid.String())
+		So(completion.Data.CompletedAt.IsZero(), ShouldBeFalse)
+		So(resource.Status, ShouldEqual, Paid.String())
+	})
+}
+
+func TestUnitAccountReconcilePendingDebits(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	debit := func(id string) models.AccountLedgerEntryDB {
+		return models.AccountLedgerEntryDB{ID: id, AccountID: "acc", Type: AccountEntryPayment, Amount: -1000, PaymentID: "1234", Pending: true}
+	}
+	paidWith := func(id string) *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Status: Paid.String(), ProviderID: id}}
+	}
+
+	Convey("Error getting pending debits", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return(nil, errors.New("error"))
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(settled, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "error getting pending account debits: [error]")
+	})
+
+	Convey("Debits made in the last few minutes left to their journey", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		var createdBefore time.Time
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, before time.Time) ([]models.AccountLedgerEntryDB, error) {
+			createdBefore = before
+			return nil, nil
+		})
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(err, ShouldBeNil)
+		So(settled, ShouldBeEmpty)
+		So(createdBefore, ShouldHappenWithin, time.Second, time.Now().Add(-pendingDebitSettleDelay))
+	})
+
+	Convey("Debit the payment session was completed with settled", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return([]models.AccountLedgerEntryDB{debit("entry")}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paidWith("entry"), nil)
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "entry").Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(err, ShouldBeNil)
+		So(settled, ShouldHaveLength, 1)
+		So(settled[0].ID, ShouldEqual, "entry")
+		So(settled[0].Amount, ShouldEqual, "-10.00")
+	})
+
+	Convey("Debit the payment session wasn't completed with reversed and settled", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		var reversal models.AccountLedgerEntryDB
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return([]models.AccountLedgerEntryDB{debit("entry")}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Status: InProgress.String()}}, nil)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{debit("entry")}, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entry *models.AccountLedgerEntryDB) (bool, error) {
+			reversal = *entry
+			return true, nil
+		})
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "entry").Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(err, ShouldBeNil)
+		So(settled, ShouldHaveLength, 1)
+		So(reversal.Type, ShouldEqual, AccountEntryReversal)
+		So(reversal.Amount, ShouldEqual, 1000)
+		So(reversal.AccountID, ShouldEqual, "acc")
+		So(reversal.Reference, ShouldEqual, "entry")
+	})
+
+	Convey("Debit of a payment session since paid another way reversed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return([]models.AccountLedgerEntryDB{debit("entry")}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paidWith("other"), nil)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return(nil, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(true, nil)
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "entry").Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(err, ShouldBeNil)
+		So(settled, ShouldHaveLength, 1)
+	})
+
+	Convey("Debit already reversed settled without crediting the account again", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return([]models.AccountLedgerEntryDB{debit("entry")}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, nil)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{
+			debit("entry"),
+			{ID: "reversal", Type: AccountEntryReversal, PaymentID: "1234", Amount: 1000, Reference: "entry"},
+		}, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Times(0)
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "entry").Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(err, ShouldBeNil)
+		So(settled, ShouldHaveLength, 1)
+	})
+
+	Convey("Debits which can't be reconciled left pending", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPendingAccountLedgerEntries(gomock.Any(), gomock.Any()).Return([]models.AccountLedgerEntryDB{
+			{ID: "lookup", PaymentID: "lookup", Pending: true},
+			{ID: "entries", PaymentID: "entries", Pending: true},
+			{ID: "reversal", PaymentID: "reversal", Pending: true},
+			{ID: "settle", PaymentID: "settle", Pending: true},
+			{ID: "entry", PaymentID: "1234", Pending: true},
+		}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "lookup").Return(nil, errors.New("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "entries").Return(nil, nil)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "entries").Return(nil, errors.New("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "reversal").Return(nil, nil)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "reversal").Return(nil, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(false, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "settle").Return(paidWith("settle"), nil)
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "settle").Return(errors.New("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paidWith("entry"), nil)
+		mock.EXPECT().SettleAccountLedgerEntry(gomock.Any(), "entry").Return(nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		settled, err := accountService.ReconcilePendingDebits(httptest.NewRequest("POST", "/test", nil))
+		So(err, ShouldBeNil)
+		So(settled, ShouldHaveLength, 1)
+		So(settled[0].ID, ShouldEqual, "entry")
+	})
+}
+
+func TestUnitAccountPaymentDetails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	createdAt := time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC)
+	paymentResource := &models.PaymentResourceRest{
+		ProviderID: "entry",
+		MetaData:   models.PaymentResourceMetaDataRest{ID: "1234"},
+	}
+
+	Convey("Payment details of a debit", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{
+			{ID: "entry", Type: AccountEntryPayment, PaymentID: "1234", Amount: -1000, CreatedAt: createdAt},
+		}, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		paymentDetails, responseType, err := accountService.GetPaymentDetails(context.Background(), paymentResource)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(paymentDetails.ExternalPaymentID, ShouldEqual, "entry")
+		So(paymentDetails.ProviderID, ShouldEqual, "entry")
+		So(paymentDetails.PaymentStatus, ShouldEqual, "accepted")
+		So(paymentDetails.TransactionDate, ShouldEqual, "2026-10-01T09:30:00Z")
+	})
+
+	Convey("Debit has been reversed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{
+			{ID: "entry", Type: AccountEntryPayment, PaymentID: "1234", Amount: -1000},
+			{ID: "reversal", Type: AccountEntryReversal, PaymentID: "1234", Amount: 1000, Reference: "entry"},
+		}, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		paymentDetails, responseType, err := accountService.GetPaymentDetails(context.Background(), paymentResource)
+		So(paymentDetails, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "no account debit found for payment session [1234]")
+	})
+
+	Convey("Error getting the debit", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return(nil, errors.New("error"))
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		paymentDetails, responseType, err := accountService.GetPaymentDetails(context.Background(), paymentResource)
+		So(paymentDetails, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting account ledger entries from DB: [error]")
+	})
+
+	Convey("Status of a payment session debited from an account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{
+			{ID: "reversed", Type: AccountEntryPayment, PaymentID: "1234"},
+			{ID: "reversal", Type: AccountEntryReversal, PaymentID: "1234", Reference: "reversed"},
+			{ID: "entry", Type: AccountEntryPayment, PaymentID: "1234"},
+		}, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		statusResponse, providerID, responseType, err := accountService.CheckPaymentProviderStatus(context.Background(), paymentResource)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(statusResponse.Status, ShouldEqual, Paid.String())
+		So(providerID, ShouldEqual, "entry")
+	})
+
+	Convey("Status of a payment session debited but not yet completed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{
+			{ID: "entry", Type: AccountEntryPayment, PaymentID: "1234"},
+		}, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		statusResponse, providerID, responseType, err := accountService.CheckPaymentProviderStatus(context.Background(), &models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{ID: "1234"},
+		})
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(statusResponse.Status, ShouldEqual, Paid.String())
+		So(providerID, ShouldEqual, "entry")
+	})
+
+	Convey("Status of a payment session not debited from an account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return([]models.AccountLedgerEntryDB{}, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		statusResponse, providerID, responseType, err := accountService.CheckPaymentProviderStatus(context.Background(), &models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{ID: "1234"},
+		})
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(statusResponse.Status, ShouldEqual, InProgress.String())
+		So(providerID, ShouldBeEmpty)
+	})
+}
+
+func TestUnitAccountRefunds(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	paymentResource := &models.PaymentResourceRest{
+		ProviderID: "entry",
+		Reference:  "ref",
+		MetaData:   models.PaymentResourceMetaDataRest{ID: "1234"},
+	}
+
+	Convey("Refund summary", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		paymentSession := func(refunds ...models.RefundResourceDB) *models.PaymentResourceDB {
+			return &models.PaymentResourceDB{
+				ID:      "1234",
+				Refunds: refunds,
+				Data:    models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}},
+			}
+		}
+
+		Convey("Amount partly refunded", func() {
+			mock := dao.NewMockDAO(mockCtrl)
+			mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paymentSession(
+				models.RefundResourceDB{Amount: 400, Status: "refund-success"},
+				models.RefundResourceDB{Amount: 600, Status: "refund-error"},
+			), nil)
+			accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+			_, refundSummary, responseType, err := accountService.GetRefundSummary(httptest.NewRequest("POST", "/test", nil), "1234")
+			So(err, ShouldBeNil)
+			So(responseType, ShouldEqual, Success)
+			So(refundSummary.Status, ShouldEqual, RefundAvailable)
+			So(refundSummary.AmountAvailable, ShouldEqual, 600)
+			So(refundSummary.AmountSubmitted, ShouldEqual, 400)
+		})
+
+		Convey("Amount fully refunded", func() {
+			mock := dao.NewMockDAO(mockCtrl)
+			mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paymentSession(
+				models.RefundResourceDB{Amount: 1000, Status: "refund-success"},
+			), nil)
+			accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+			_, refundSummary, responseType, err := accountService.GetRefundSummary(httptest.NewRequest("POST", "/test", nil), "1234")
+			So(err, ShouldBeNil)
+			So(responseType, ShouldEqual, Success)
+			So(refundSummary.Status, ShouldEqual, RefundFull)
+			So(refundSummary.AmountAvailable, ShouldEqual, 0)
+		})
+	})
+
+	debits := []models.AccountLedgerEntryDB{
+		{ID: "entry", AccountID: "acc", Type: AccountEntryPayment, PaymentID: "1234", Amount: -1000},
+	}
+
+	Convey("Refund credited back to the account", t, func() {
+		var credit models.AccountLedgerEntryDB
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return(debits, nil)
+		mock.EXPECT().AddAccountLedgerEntryRefund(gomock.Any(), gomock.Any(), 400).Return(true, nil)
+		mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entry *models.AccountLedgerEntryDB) (bool, error) {
+			credit = *entry
+			return true, nil
+		})
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		refund, responseType, err := accountService.CreateRefund(context.Background(), paymentResource, &models.CreateRefundGovPayRequest{Amount: 400})
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(refund.RefundId, ShouldEqual, credit.ID)
+		So(refund.Amount, ShouldEqual, 400)
+		So(refund.Status, ShouldEqual, RefundsStatusSuccess)
+		So(credit.AccountID, ShouldEqual, "acc")
+		So(credit.Type, ShouldEqual, AccountEntryRefund)
+		So(credit.PaymentID, ShouldEqual, "1234")
+	})
+
+	Convey("Refund taking the total refunded over the amount paid", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return(debits, nil)
+		mock.EXPECT().AddAccountLedgerEntryRefund(gomock.Any(), gomock.Any(), 400).Return(false, nil)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		refund, responseType, err := accountService.CreateRefund(context.Background(), paymentResource, &models.CreateRefundGovPayRequest{Amount: 400})
+		So(refund, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "refund amount is higher than the amount left to refund from account debit [entry]")
+	})
+
+	Convey("Error adding refund to the debit", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return(debits, nil)
+		mock.EXPECT().AddAccountLedgerEntryRefund(gomock.Any(), gomock.Any(), 400).Return(false, errors.New("error"))
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		refund, responseType, err := accountService.CreateRefund(context.Background(), paymentResource, &models.CreateRefundGovPayRequest{Amount: 400})
+		So(refund, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error adding refund to account debit: [error]")
+	})
+
+	Convey("Error crediting refund takes it back off the debit", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetAccountLedgerEntriesForPayment(gomock.Any(), "1234").Return(debits, nil)
+		gomock.InOrder(
+			mock.EXPECT().AddAccountLedgerEntryRefund(gomock.Any(), gomock.Any(), 400).Return(true, nil),
+			mock.EXPECT().CreditAccount(gomock.Any(), gomock.Any()).Return(false, errors.New("error")),
+			mock.EXPECT().AddAccountLedgerEntryRefund(gomock.Any(), gomock.Any(), -400).Return(true, nil),
+		)
+		accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+		refund, responseType, err := accountService.CreateRefund(context.Background(), paymentResource, &models.CreateRefundGovPayRequest{Amount: 400})
+		So(refund, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error crediting account: [error]")
+	})
+
+	Convey("Refund status", t, func() {
+		Convey("Refund found", func() {
+			mock := dao.NewMockDAO(mockCtrl)
+			mock.EXPECT().GetAccountLedgerEntry(gomock.Any(), "refund").Return(&models.AccountLedgerEntryDB{
+				ID: "refund", Type: AccountEntryRefund, PaymentID: "1234", Amount: 400,
+			}, nil)
+			accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+			refund, responseType, err := accountService.GetRefundStatus(context.Background(), paymentResource, "refund")
+			So(err, ShouldBeNil)
+			So(responseType, ShouldEqual, Success)
+			So(refund.Status, ShouldEqual, RefundsStatusSuccess)
+		})
+
+		Convey("Entry isn't a refund of the payment session", func() {
+			mock := dao.NewMockDAO(mockCtrl)
+			mock.EXPECT().GetAccountLedgerEntry(gomock.Any(), "refund").Return(&models.AccountLedgerEntryDB{
+				ID: "refund", Type: AccountEntryTopUp, Amount: 400,
+			}, nil)
+			accountService := AccountService{PaymentService: createMockPaymentService(mock, cfg)}
+
+			refund, responseType, err := accountService.GetRefundStatus(context.Background(), paymentResource, "refund")
+			So(refund, ShouldBeNil)
+			So(responseType, ShouldEqual, NotFound)
+			So(err.Error(), ShouldEqual, "refund [refund] not found")
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/shopspring/decimal"
+)
+
+// Formats of the bank statements credits can be imported from
+const (
+	BankStatementFormatCSV     = "csv"
+	BankStatementFormatCamt053 = "camt.053"
+)
+
+// csvStatementDateFormats are the formats of the dates on CSV bank statements
+var csvStatementDateFormats = []string{"2006-01-02", "02/01/2006"}
+
+// statementCredit is a credit read from a bank statement, before it is matched to a payment session
+type statementCredit struct {
+	ID          string
+	StatementID string
+	BookedAt    time.Time
+	Amount      decimal.Decimal
+	Narrative   string
+}
+
+// parseBankStatement reads the credits from a bank statement in the given format, and returns them with the ID of the
+// statement. Debits are left out, as they can't pay a payment session.
+func parseBankStatement(format string, statement io.Reader) (string, []statementCredit, error) {
+	switch format {
+	case BankStatementFormatCSV:
+		return parseCSVStatement(statement)
+	case BankStatementFormatCamt053:
+		return parseCamt053Statement(statement)
+	default:
+		return "", nil, fmt.Errorf("bank statement format [%s] not recognised", format)
+	}
+}
+
+// parseCSVStatement reads the credits from a CSV bank statement. The first row names the columns, which must include
+// date, amount and reference, and may include transaction_id. A CSV statement has no ID of its own, so one is
+// generated.
+func parseCSVStatement(statement io.Reader) (string, []statementCredit, error) {
+	reader := csv.NewReader(statement)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading header: [%v]", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"date", "amount", "reference"} {
+		if _, ok := columns[required]; !ok {
+			return "", nil, fmt.Errorf("column [%s] missing", required)
+		}
+	}
+	transactionIDColumn, hasTransactionID := columns["transaction_id"]
+
+	statementID := helpers.GenerateID()
+	var credits []statementCredit
+	occurrences := map[string]int{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("error reading line %d: [%v]", line, err)
+		}
+
+		bookedAt, err := parseCSVStatementDate(row[columns["date"]])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid date on line %d: [%v]", line, err)
+		}
+		amount, err := decimal.NewFromString(strings.TrimSpace(row[columns["amount"]]))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid amount on line %d: [%v]", line, err)
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+
+		credit := statementCredit{
+			StatementID: statementID,
+			BookedAt:    bookedAt,
+			Amount:      amount,
+			Narrative:   strings.TrimSpace(row[columns["reference"]]),
+		}
+		if hasTransactionID {
+			credit.ID = strings.TrimSpace(row[transactionIDColumn])
+		}
+		if credit.ID == "" {
+			credit.ID = deriveCreditID(credit, occurrences)
+		}
+		credits = append(credits, credit)
+	}
+
+	return statementID, credits, nil
+}
+
+func parseCSVStatementDate(value string) (time.Time, error) {
+	var err error
+	for _, format := range csvStatementDateFormats {
+		var date time.Time
+		date, err = time.Parse(format, strings.TrimSpace(value))
+		if err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// camt053Document is the part of an ISO 20022 camt.053 bank to customer statement that credits are read from
+type camt053Document struct {
+	Statements []struct {
+		ID      string `xml:"Id"`
+		Entries []struct {
+			Amount                   string   `xml:"Amt"`
+			CreditDebitIndicator     string   `xml:"CdtDbtInd"`
+			BookingDate              string   `xml:"BookgDt>Dt"`
+			BookingDateTime          string   `xml:"BookgDt>DtTm"`
+			AccountServicerReference string   `xml:"AcctSvcrRef"`
+			Unstructured             []string `xml:"NtryDtls>TxDtls>RmtInf>Ustrd"`
+			Structured               []string `xml:"NtryDtls>TxDtls>RmtInf>Strd>CdtrRefInf>Ref"`
+			AdditionalInformation    string   `xml:"AddtlNtryInf"`
+		} `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// parseCamt053Statement reads the credits from a camt.053 bank statement. The remittance information and additional
+// information of each entry make up the narrative a remittance reference is looked for in.
+func parseCamt053Statement(statement io.Reader) (string, []statementCredit, error) {
+	var document camt053Document
+	err := xml.NewDecoder(statement).Decode(&document)
+	if err != nil {
+		return "", nil, fmt.Errorf("error decoding statement: [%v]", err)
+	}
+	if len(document.Statements) == 0 {
+		return "", nil, fmt.Errorf("no statements found")
+	}
+
+	var statementIDs []string
+	var credits []statementCredit
+	occurrences := map[string]int{}
+	for _, stmt := range document.Statements {
+		statementIDs = append(statementIDs, stmt.ID)
+		for i, entry := range stmt.Entries {
+			if entry.CreditDebitIndicator != "CRDT" {
+				continue
+			}
+
+			amount, err := decimal.NewFromString(strings.TrimSpace(entry.Amount))
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid amount on entry %d of statement [%s]: [%v]", i+1, stmt.ID, err)
+			}
+			var bookedAt time.Time
+			if entry.BookingDateTime != "" {
+				bookedAt, err = time.Parse(time.RFC3339, entry.BookingDateTime)
+			} else {
+				bookedAt, err = time.Parse("2006-01-02", entry.BookingDate)
+			}
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid booking date on entry %d of statement [%s]: [%v]", i+1, stmt.ID, err)
+			}
+
+			narrative := slices.Concat(entry.Unstructured, entry.Structured, []string{entry.AdditionalInformation})
+			credit := statementCredit{
+				ID:          entry.AccountServicerReference,
+				StatementID: stmt.ID,
+				BookedAt:    bookedAt,
+				Amount:      amount,
+				Narrative:   strings.TrimSpace(strings.Join(narrative, " ")),
+			}
+			if credit.ID == "" {
+				credit.ID = deriveCreditID(credit, occurrences)
+			}
+			credits = append(credits, credit)
+		}
+	}
+
+	return strings.Join(statementIDs, ","), credits, nil
+}
+
+// deriveCreditID returns an ID for a credit the bank gave no reference for, derived from its details so that it is the
+// same on every statement the credit appears on. Identical credits on the same statement are told apart by the order
+// they appear in.
+func deriveCreditID(credit statementCredit, occurrences map[string]int) string {
+	details := fmt.Sprintf("%s|%s|%s", credit.BookedAt.Format("2006-01-02"), credit.Amount.StringFixed(2), credit.Narrative)
+	occurrences[details]++
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", details, occurrences[details])))
+	return hex.EncodeToString(hash[:])
+}
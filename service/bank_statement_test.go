@@ -0,0 +1,107 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testCamt053Statement = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Id>STMT-2026-10-12</Id>
+      <Ntry>
+        <Amt Ccy="GBP">500.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><Dt>2026-10-12</Dt></BookgDt>
+        <AcctSvcrRef>BANKREF1</AcctSvcrRef>
+        <NtryDtls><TxDtls><RmtInf><Ustrd>PENALTY CHAB-CDEF-GHJK</Ustrd></RmtInf></TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">20.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2026-10-12</Dt></BookgDt>
+        <AcctSvcrRef>BANKREF2</AcctSvcrRef>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="GBP">75.50</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <BookgDt><DtTm>2026-10-12T14:30:00Z</DtTm></BookgDt>
+        <NtryDtls><TxDtls><RmtInf><Strd><CdtrRefInf><Ref>CHMNPQRSTUVW</Ref></CdtrRefInf></Strd></RmtInf></TxDtls></NtryDtls>
+        <AddtlNtryInf>FASTER PAYMENT</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+func TestUnitParseBankStatement(t *testing.T) {
+	Convey("Format not recognised", t, func() {
+		_, _, err := parseBankStatement("pdf", strings.NewReader(""))
+		So(err.Error(), ShouldEqual, "bank statement format [pdf] not recognised")
+	})
+
+	Convey("CSV statement missing a column", t, func() {
+		_, _, err := parseBankStatement(BankStatementFormatCSV, strings.NewReader("date,amount\n2026-10-12,500.00\n"))
+		So(err.Error(), ShouldEqual, "column [reference] missing")
+	})
+
+	Convey("CSV statement with an invalid amount", t, func() {
+		_, _, err := parseBankStatement(BankStatementFormatCSV, strings.NewReader("date,amount,reference\n2026-10-12,five,CHABCDEFGHJK\n"))
+		So(err.Error(), ShouldStartWith, "invalid amount on line 2")
+	})
+
+	Convey("CSV statement with an invalid date", t, func() {
+		_, _, err := parseBankStatement(BankStatementFormatCSV, strings.NewReader("date,amount,reference\n12 Oct,500.00,CHABCDEFGHJK\n"))
+		So(err.Error(), ShouldStartWith, "invalid date on line 2")
+	})
+
+	Convey("CSV statement", t, func() {
+		statement := "Date,Amount,Reference,Transaction_ID\n" +
+			"12/10/2026,500.00,CHABCDEFGHJK,TX1\n" +
+			"12/10/2026,-20.00,DIRECT DEBIT,TX2\n" +
+			"2026-10-13,75.5,CHMNPQRSTUVW,\n" +
+			"2026-10-13,75.5,CHMNPQRSTUVW,\n"
+
+		statementID, credits, err := parseBankStatement(BankStatementFormatCSV, strings.NewReader(statement))
+		So(err, ShouldBeNil)
+		So(statementID, ShouldNotBeEmpty)
+		So(credits, ShouldHaveLength, 3)
+		So(credits[0].ID, ShouldEqual, "TX1")
+		So(credits[0].StatementID, ShouldEqual, statementID)
+		So(credits[0].BookedAt, ShouldEqual, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC))
+		So(credits[0].Amount.StringFixed(2), ShouldEqual, "500.00")
+		So(credits[0].Narrative, ShouldEqual, "CHABCDEFGHJK")
+		So(credits[1].Amount.StringFixed(2), ShouldEqual, "75.50")
+
+		// Credits without a transaction ID are given one derived from their details, so identical credits are told
+		// apart, and each gets the same ID whenever the statement is imported
+		So(credits[1].ID, ShouldNotBeEmpty)
+		So(credits[2].ID, ShouldNotEqual, credits[1].ID)
+		_, again, _ := parseBankStatement(BankStatementFormatCSV, strings.NewReader(statement))
+		So(again[1].ID, ShouldEqual, credits[1].ID)
+		So(again[2].ID, ShouldEqual, credits[2].ID)
+	})
+
+	Convey("camt.053 statement that isn't XML", t, func() {
+		_, _, err := parseBankStatement(BankStatementFormatCamt053, strings.NewReader("date,amount,reference"))
+		So(err.Error(), ShouldStartWith, "error decoding statement")
+	})
+
+	Convey("camt.053 statement", t, func() {
+		statementID, credits, err := parseBankStatement(BankStatementFormatCamt053, strings.NewReader(testCamt053Statement))
+		So(err, ShouldBeNil)
+		So(statementID, ShouldEqual, "STMT-2026-10-12")
+		So(credits, ShouldHaveLength, 2)
+		So(credits[0].ID, ShouldEqual, "BANKREF1")
+		So(credits[0].StatementID, ShouldEqual, "STMT-2026-10-12")
+		So(credits[0].Amount.StringFixed(2), ShouldEqual, "500.00")
+		So(credits[0].BookedAt, ShouldEqual, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC))
+		So(credits[0].Narrative, ShouldEqual, "PENALTY CHAB-CDEF-GHJK")
+		So(credits[1].ID, ShouldNotBeEmpty)
+		So(credits[1].BookedAt, ShouldEqual, time.Date(2026, 10, 12, 14, 30, 0, 0, time.UTC))
+		So(credits[1].Narrative, ShouldEqual, "CHMNPQRSTUVW FASTER PAYMENT")
+	})
+}
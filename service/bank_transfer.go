@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/transformers"
+)
+
+// PaymentMethodBankTransfer is the payment method of payment sessions paid by bank transfer, e.g. BACS
+const PaymentMethodBankTransfer = "bank-transfer"
+
+// BankTransferService handles paying for payment sessions by bank transfer. The payer is given a remittance reference
+// and the bank account to pay into as the journey is created, and the session is paid once a credit quoting the
+// reference is imported from a bank statement.
+type BankTransferService struct {
+	PaymentService PaymentService
+}
+
+// CreatePaymentAndGenerateNextURL gives the payment session a remittance reference and the bank account to pay into,
+// and leaves it awaiting the transfer. A transfer can take days to arrive, so the session's expiry is moved on to give
+// the payer time to make it. The next URL returns the user straight to the calling service.
+func (bt *BankTransferService) CreatePaymentAndGenerateNextURL(req *http.Request, paymentResource *models.PaymentResourceRest) (string, ResponseType, error) {
+	account := bt.PaymentService.Config.BankTransferAccount()
+	if account == nil {
+		return "", InvalidData, fmt.Errorf("payment by bank transfer is not enabled")
+	}
+
+	bankTransfer := models.BankTransferDB{
+		Reference:     helpers.GenerateRemittanceReference(),
+		AccountName:   account.AccountName,
+		SortCode:      account.SortCode,
+		AccountNumber: account.AccountNumber,
+		IBAN:          account.IBAN,
+		BIC:           account.BIC,
+		RequestedAt:   helpers.MongoNow(),
+	}
+
+	paymentUpdate := *paymentResource
+	paymentUpdate.Status = AwaitingTransfer.String()
+	paymentUpdate.ExpiresAt = bankTransfer.RequestedAt.Add(time.Minute * time.Duration(bt.PaymentService.Config.BankTransferExpiryTimeInMinutes))
+	paymentUpdate.BankTransfer = &models.BankTransferRest{
+		Reference:     bankTransfer.Reference,
+		AccountName:   bankTransfer.AccountName,
+		SortCode:      bankTransfer.SortCode,
+		AccountNumber: bankTransfer.AccountNumber,
+		IBAN:          bankTransfer.IBAN,
+		BIC:           bankTransfer.BIC,
+	}
+
+	paymentResourceUpdate := transformers.PaymentTransformer{}.TransformToDB(paymentUpdate)
+	paymentResourceUpdate.Data.Etag = helpers.GenerateEtag()
+	paymentResourceUpdate.BankTransfer = &bankTransfer
+
+	// The session is only left awaiting the transfer if it is still in progress, so a session completed in the meantime
+	// isn't paid twice. A session whose last attempt failed is reopened by the same update.
+	if isRetryableFailure(paymentResource.Status) {
+		responseType, err := bt.PaymentService.updateFailedPaymentSession(req.Context(), paymentResource.MetaData.ID, &paymentResourceUpdate)
+		if err != nil {
+			return "", responseType, err
+		}
+	} else {
+		awaiting, err := bt.PaymentService.DAO.CompletePaymentResource(req.Context(), paymentResource.MetaData.ID, "", &paymentResourceUpdate)
+		if err != nil {
+			return "", Error, fmt.Errorf("error updating payment session on database: [%v]", err)
+		}
+		if !awaiting {
+			return "", InvalidData, fmt.Errorf("payment session is no longer in progress")
+		}
+	}
+
+	metrics.SessionStatusChanged(AwaitingTransfer.String(), PaymentMethodBankTransfer, getClassOfPayment(paymentResource.Costs))
+	log.InfoR(req, "payment session awaiting bank transfer", log.Data{"payment_id": paymentResource.MetaData.ID, "remittance_reference": bankTransfer.Reference, "expires_at": paymentUpdate.ExpiresAt})
+
+	*paymentResource = paymentUpdate
+	return bankTransferJourneyURL(bt.PaymentService.Config.PaymentsAPIURL, paymentResource.MetaData.ID), Success, nil
+}
+
+// GetPaymentDetails gets the details of the bank transfer a payment session was paid by
+func (bt *BankTransferService) GetPaymentDetails(_ context.Context, paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
+	if paymentResource.BankTransfer == nil {
+		return nil, Error, fmt.Errorf("no bank transfer found for payment session [%s]", paymentResource.MetaData.ID)
+	}
+
+	paymentDetails := &models.PaymentDetails{
+		ExternalPaymentID: paymentResource.BankTransfer.Reference,
+		PaymentStatus:     "accepted",
+	}
+	if paymentResource.Status == AwaitingTransfer.String() || paymentResource.Status == Underpaid.String() {
+		paymentDetails.PaymentStatus = "pending"
+	} else {
+		paymentDetails.TransactionDate = paymentResource.CompletedAt.Format(time.RFC3339Nano)
+	}
+
+	return paymentDetails, Success, nil
+}
+
+// bankTransferJourneyURL returns the journey link of a payment session paid by bank transfer, which returns the user
+// straight to the calling service
+func bankTransferJourneyURL(paymentsAPIURL, id string) string {
+	return fmt.Sprintf("%s/callback/payments/bank-transfer/%s", paymentsAPIURL, id)
+}
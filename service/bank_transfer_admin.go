@@ -0,0 +1,268 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/shopspring/decimal"
+)
+
+// Outcomes of matching a credit imported from a bank statement to a payment session
+const (
+	BankCreditOutcomePaid                = "paid"
+	BankCreditOutcomeUnderpaid           = "underpaid"
+	BankCreditOutcomeOverpaid            = "overpaid"
+	BankCreditOutcomeUnmatched           = "unmatched"
+	BankCreditOutcomeNotAwaitingTransfer = "not-awaiting-transfer"
+)
+
+// bankCreditExceptionOutcomes are the outcomes of credits which need looking at by hand, because they didn't pay a
+// payment session exactly
+var bankCreditExceptionOutcomes = []string{
+	BankCreditOutcomeUnderpaid,
+	BankCreditOutcomeOverpaid,
+	BankCreditOutcomeUnmatched,
+	BankCreditOutcomeNotAwaitingTransfer,
+}
+
+// BankStatementImportKind is the kind of the outcome of importing a bank statement
+const BankStatementImportKind = "bank-transfer#statement-import"
+
+// BankCreditExceptionsKind is the kind of the credits imported from bank statements that need looking at by hand
+const BankCreditExceptionsKind = "bank-transfer#exceptions"
+
+// BankTransferHistoryAction is the action recorded in the history of a payment session when a credit is matched to it
+const BankTransferHistoryAction = "bank-transfer"
+
+// maxReconcileAttempts is the number of times matching a credit to a payment session is attempted when the session is
+// changed by something else in the meantime
+const maxReconcileAttempts = 3
+
+// awaitingTransferStatuses are the statuses of payment sessions that credits can be matched to
+var awaitingTransferStatuses = []string{
+	AwaitingTransfer.String(),
+	Underpaid.String(),
+}
+
+// ImportBankStatement imports the credits on a bank statement, and matches each quoting a remittance reference to the
+// payment session it was given to. A session is paid once the credits matched to it cover its amount. Credits already
+// imported from an earlier statement are counted as duplicates, and aren't matched again.
+func (service *PaymentService) ImportBankStatement(req *http.Request, format string, statement io.Reader, importedBy string) (*models.BankStatementImportRest, ResponseType, error) {
+	statementID, statementCredits, err := parseBankStatement(format, statement)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid bank statement: [%v]", err)
+	}
+
+	statementImport := &models.BankStatementImportRest{
+		StatementID: statementID,
+		Format:      format,
+		Credits:     []models.BankCreditRest{},
+		Kind:        BankStatementImportKind,
+	}
+	now := helpers.MongoNow()
+	for _, statementCredit := range statementCredits {
+		credit := models.BankCreditDB{
+			ID:          statementCredit.ID,
+			StatementID: statementCredit.StatementID,
+			BookedAt:    statementCredit.BookedAt,
+			Amount:      statementCredit.Amount.StringFixed(2),
+			Narrative:   statementCredit.Narrative,
+			Outcome:     BankCreditOutcomeUnmatched,
+			ImportedAt:  now,
+			ImportedBy:  importedBy,
+		}
+
+		// The credit is written before it is matched, so that a credit on overlapping statements is only matched once
+		created, err := service.DAO.CreateBankCredit(req.Context(), &credit)
+		if err != nil {
+			return nil, Error, fmt.Errorf("error writing bank credit to DB: [%v]", err)
+		}
+		if !created {
+			statementImport.Duplicates++
+			continue
+		}
+
+		err = service.matchBankCredit(req, &credit, statementCredit.Amount)
+		if err != nil {
+			return nil, Error, fmt.Errorf("error matching bank credit [%s]: [%v]", credit.ID, err)
+		}
+
+		switch credit.Outcome {
+		case BankCreditOutcomePaid:
+			statementImport.Paid++
+		case BankCreditOutcomeUnderpaid:
+			statementImport.Underpaid++
+		case BankCreditOutcomeOverpaid:
+			statementImport.Overpaid++
+		default:
+			statementImport.Exceptions++
+		}
+		statementImport.Credits = append(statementImport.Credits, models.BankCreditRest(credit))
+	}
+
+	log.InfoR(req, "bank statement imported", log.Data{
+		"statement_id": statementID,
+		"paid":         statementImport.Paid,
+		"underpaid":    statementImport.Underpaid,
+		"overpaid":     statementImport.Overpaid,
+		"exceptions":   statementImport.Exceptions,
+		"duplicates":   statementImport.Duplicates,
+		"imported_by":  importedBy,
+	})
+
+	return statementImport, Success, nil
+}
+
+// matchBankCredit matches a credit to the payment session given the remittance reference it quotes, adding it to the
+// amount received for the session, and records the outcome on the credit
+func (service *PaymentService) matchBankCredit(req *http.Request, credit *models.BankCreditDB, amount decimal.Decimal) error {
+	references := helpers.FindRemittanceReferences(credit.Narrative)
+	if len(references) > 0 {
+		credit.RemittanceReference = references[0]
+	}
+
+	for _, reference := range references {
+		for attempt := 1; ; attempt++ {
+			paymentResource, err := service.DAO.GetPaymentResourceByRemittanceReference(req.Context(), reference)
+			if err != nil {
+				return fmt.Errorf("error getting payment resource from db: [%v]", err)
+			}
+			if paymentResource == nil {
+				break
+			}
+
+			credit.RemittanceReference = reference
+			credit.PaymentID = paymentResource.ID
+			// A credit booked after the session expired is left to be looked at by hand, as the session's cost
+			// resources may since have been paid by another session
+			if !slices.Contains(awaitingTransferStatuses, paymentResource.Data.Status) ||
+				!credit.BookedAt.Before(expiresAt(paymentResource.Data.CreatedAt, paymentResource.Data.ExpiresAt, &service.Config)) {
+				credit.Outcome = BankCreditOutcomeNotAwaitingTransfer
+				return service.updateBankCredit(req, credit)
+			}
+
+			reconciled, err := service.reconcileBankTransfer(req, paymentResource, credit, amount)
+			if err != nil {
+				return err
+			}
+			if reconciled {
+				return service.updateBankCredit(req, credit)
+			}
+			if attempt == maxReconcileAttempts {
+				return fmt.Errorf("payment session [%s] kept changing while the credit was matched to it", paymentResource.ID)
+			}
+		}
+	}
+
+	// No payment session was found for any reference the credit quotes, so it is left unmatched
+	return service.updateBankCredit(req, credit)
+}
+
+// reconcileBankTransfer adds the credit to the amount received for the payment session, and marks the session paid,
+// underpaid or overpaid. It reports false if the session changed since it was read.
+func (service *PaymentService) reconcileBankTransfer(req *http.Request, paymentResource *models.PaymentResourceDB, credit *models.BankCreditDB, amount decimal.Decimal) (bool, error) {
+	if paymentResource.BankTransfer == nil {
+		return false, fmt.Errorf("payment session [%s] has no bank transfer", paymentResource.ID)
+	}
+	due, err := decimal.NewFromString(paymentResource.Data.Amount)
+	if err != nil {
+		return false, fmt.Errorf("error parsing amount of payment session: [%v]", err)
+	}
+	received := amount
+	if paymentResource.BankTransfer.AmountReceived != "" {
+		previouslyReceived, err := decimal.NewFromString(paymentResource.BankTransfer.AmountReceived)
+		if err != nil {
+			return false, fmt.Errorf("error parsing amount received for payment session: [%v]", err)
+		}
+		received = received.Add(previouslyReceived)
+	}
+
+	now := helpers.MongoNow()
+	bankTransfer := *paymentResource.BankTransfer
+	bankTransfer.AmountReceived = received.StringFixed(2)
+	paymentUpdate := models.PaymentResourceDB{
+		Data:         models.PaymentResourceDataDB{Etag: helpers.GenerateEtag()},
+		BankTransfer: &bankTransfer,
+	}
+	// The session's payment processed message is produced once the whole statement is imported, and is left pending
+	// until then so that it is still sent if the import fails part way through
+	setMessagesPending(&paymentUpdate, models.PaymentLinksRest(paymentResource.Data.Links))
+	switch received.Cmp(due) {
+	case -1:
+		paymentUpdate.Data.Status = Underpaid.String()
+		credit.Outcome = BankCreditOutcomeUnderpaid
+	case 0:
+		paymentUpdate.Data.Status = Paid.String()
+		paymentUpdate.Data.CompletedAt = now
+		credit.Outcome = BankCreditOutcomePaid
+	default:
+		paymentUpdate.Data.Status = Overpaid.String()
+		paymentUpdate.Data.CompletedAt = now
+		credit.Outcome = BankCreditOutcomeOverpaid
+	}
+	paymentUpdate.History = []models.PaymentHistoryDB{
+		{
+			Action:            BankTransferHistoryAction,
+			PreviousStatus:    paymentResource.Data.Status,
+			Status:            paymentUpdate.Data.Status,
+			Actor:             credit.ImportedBy,
+			Reason:            fmt.Sprintf("credit of %s received, %s of %s received in total", credit.Amount, bankTransfer.AmountReceived, paymentResource.Data.Amount),
+			EvidenceReference: credit.ID,
+			CreatedAt:         now,
+		},
+	}
+
+	reconciled, err := service.DAO.ReconcileBankTransfer(req.Context(), paymentResource.ID, paymentResource.Data.Etag, &paymentUpdate)
+	if err != nil {
+		return false, fmt.Errorf("error reconciling bank transfer on database: [%v]", err)
+	}
+	if !reconciled {
+		log.InfoR(req, "payment session changed while a bank credit was matched to it, retrying", log.Data{"payment_id": paymentResource.ID, "credit_id": credit.ID})
+		return false, nil
+	}
+
+	log.InfoR(req, "bank credit matched to payment session", log.Data{
+		"payment_id":      paymentResource.ID,
+		"credit_id":       credit.ID,
+		"status":          paymentUpdate.Data.Status,
+		"amount_received": bankTransfer.AmountReceived,
+	})
+	metrics.SessionStatusChanged(paymentUpdate.Data.Status, PaymentMethodBankTransfer, "")
+	service.settleResourceClaims(req.Context(), paymentResource.ID, paymentUpdate.Data.Status, SessionResources(models.PaymentLinksRest(paymentResource.Data.Links)))
+
+	return true, nil
+}
+
+func (service *PaymentService) updateBankCredit(req *http.Request, credit *models.BankCreditDB) error {
+	err := service.DAO.UpdateBankCredit(req.Context(), credit)
+	if err != nil {
+		return fmt.Errorf("error updating bank credit on database: [%v]", err)
+	}
+	return nil
+}
+
+// GetBankCreditExceptions gets the credits imported from bank statements that didn't pay a payment session exactly,
+// booked from, and before, the given times. A zero time leaves that end of the period open.
+func (service *PaymentService) GetBankCreditExceptions(req *http.Request, from, to time.Time) (*models.BankCreditExceptionsRest, ResponseType, error) {
+	credits, err := service.DAO.GetBankCredits(req.Context(), bankCreditExceptionOutcomes, from, to)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting bank credits from DB: [%v]", err)
+	}
+
+	exceptions := &models.BankCreditExceptionsRest{
+		Items: []models.BankCreditRest{},
+		Kind:  BankCreditExceptionsKind,
+	}
+	for _, credit := range credits {
+		exceptions.Items = append(exceptions.Items, models.BankCreditRest(credit))
+	}
+
+	return exceptions, Success, nil
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitImportBankStatement(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	statement := func(rows ...string) *strings.Reader {
+		return strings.NewReader("date,amount,reference,transaction_id\n" + strings.Join(rows, "\n") + "\n")
+	}
+
+	awaitingSession := func(status, amountReceived string) *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{
+			ID:           "1234",
+			BankTransfer: &models.BankTransferDB{Reference: "CHABCDEFGHJK", AmountReceived: amountReceived},
+			Data: models.PaymentResourceDataDB{
+				Amount:    "500.00",
+				Status:    status,
+				Etag:      "etag",
+				ExpiresAt: time.Now().Add(time.Hour),
+				Links:     models.PaymentLinksDB{Resource: "http://dummy-url"},
+			},
+		}
+	}
+
+	Convey("Invalid statement", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		statementImport, responseType, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, strings.NewReader("date,amount\n"), "admin")
+		So(statementImport, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "invalid bank statement: [column [reference] missing]")
+	})
+
+	Convey("Error writing credit", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(false, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, responseType, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1"), "admin")
+		So(statementImport, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error writing bank credit to DB: [error]")
+	})
+
+	Convey("Credit already imported isn't matched again", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(false, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, responseType, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1"), "admin")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(statementImport.Duplicates, ShouldEqual, 1)
+		So(statementImport.Credits, ShouldBeEmpty)
+	})
+
+	Convey("Credit without a reference to a payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil).Times(2)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(nil, nil)
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, responseType, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1", "2026-10-12,20.00,REFUND,TX2"), "admin")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(statementImport.Exceptions, ShouldEqual, 2)
+		So(statementImport.Credits[0].Outcome, ShouldEqual, BankCreditOutcomeUnmatched)
+		So(statementImport.Credits[0].RemittanceReference, ShouldEqual, "CHABCDEFGHJK")
+		So(statementImport.Credits[0].PaymentID, ShouldBeEmpty)
+		So(statementImport.Credits[1].Outcome, ShouldEqual, BankCreditOutcomeUnmatched)
+		So(statementImport.Credits[1].RemittanceReference, ShouldBeEmpty)
+	})
+
+	Convey("Credit for a payment session that isn't awaiting a transfer", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(awaitingSession(Paid.String(), "500.00"), nil)
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, _, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1"), "admin")
+		So(err, ShouldBeNil)
+		So(statementImport.Exceptions, ShouldEqual, 1)
+		So(statementImport.Credits[0].Outcome, ShouldEqual, BankCreditOutcomeNotAwaitingTransfer)
+		So(statementImport.Credits[0].PaymentID, ShouldEqual, "1234")
+	})
+
+	testCases := []struct {
+		description    string
+		status         string
+		amountReceived string
+		amount         string
+		outcome        string
+		received       string
+	}{
+		{"Credit pays the payment session", AwaitingTransfer.String(), "", "500.00", BankCreditOutcomePaid, "500.00"},
+		{"Credit part pays the payment session", AwaitingTransfer.String(), "", "200.00", BankCreditOutcomeUnderpaid, "200.00"},
+		{"Credit pays the rest of an underpaid session", Underpaid.String(), "200.00", "300.00", BankCreditOutcomePaid, "500.00"},
+		{"Credit pays more than the payment session", Underpaid.String(), "200.00", "350.00", BankCreditOutcomeOverpaid, "550.00"},
+	}
+	for _, tc := range testCases {
+		Convey(tc.description, t, func() {
+			var update *models.PaymentResourceDB
+			var claimed []time.Time
+			mock := dao.NewMockDAO(mockCtrl)
+			mock.EXPECT().ClaimResource(gomock.Any(), "http://dummy-url", "1234", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, expiresAt time.Time) (bool, error) {
+				claimed = append(claimed, expiresAt)
+				return true, nil
+			}).AnyTimes()
+			mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+			mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(awaitingSession(tc.status, tc.amountReceived), nil)
+			mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+				update = paymentUpdate
+				return true, nil
+			})
+			mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil)
+			mockPaymentService := createMockPaymentService(mock, cfg)
+
+			statementImport, responseType, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,"+tc.amount+",ref chab cdef ghjk,TX1"), "admin")
+			So(err, ShouldBeNil)
+			So(responseType, ShouldEqual, Success)
+			So(statementImport.Credits[0].Outcome, ShouldEqual, tc.outcome)
+			So(statementImport.Credits[0].PaymentID, ShouldEqual, "1234")
+			So(update.Data.Status, ShouldEqual, tc.outcome)
+			So(update.Data.Etag, ShouldNotEqual, "etag")
+			So(update.Data.CompletedAt.IsZero(), ShouldEqual, tc.outcome == BankCreditOutcomeUnderpaid)
+			So(update.MessagesPending, ShouldResemble, []string{""})
+			So(update.MessagesPendingAt, ShouldNotBeZeroValue)
+			So(update.BankTransfer.AmountReceived, ShouldEqual, tc.received)
+			So(update.BankTransfer.Reference, ShouldEqual, "CHABCDEFGHJK")
+			So(update.History, ShouldHaveLength, 1)
+			So(update.History[0].Action, ShouldEqual, BankTransferHistoryAction)
+			So(update.History[0].PreviousStatus, ShouldEqual, tc.status)
+			So(update.History[0].Actor, ShouldEqual, "admin")
+			So(update.History[0].EvidenceReference, ShouldEqual, "TX1")
+			if tc.outcome == BankCreditOutcomeUnderpaid {
+				So(claimed, ShouldBeEmpty)
+			} else {
+				// A paid session keeps its claim for good, rather than until it would have expired
+				So(claimed, ShouldResemble, []time.Time{{}})
+			}
+		})
+	}
+
+	Convey("Credit booked after the payment session expired is left to be looked at by hand", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		expired := awaitingSession(AwaitingTransfer.String(), "")
+		expired.Data.ExpiresAt = time.Date(2026, 10, 11, 12, 0, 0, 0, time.UTC)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(expired, nil)
+		mock.EXPECT().ReconcileBankTransfer(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, _, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1"), "admin")
+		So(err, ShouldBeNil)
+		So(statementImport.Exceptions, ShouldEqual, 1)
+		So(statementImport.Credits[0].Outcome, ShouldEqual, BankCreditOutcomeNotAwaitingTransfer)
+		So(statementImport.Credits[0].PaymentID, ShouldEqual, "1234")
+	})
+
+	Convey("Credit booked before the payment session expired pays it", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		expired := awaitingSession(AwaitingTransfer.String(), "")
+		expired.Data.ExpiresAt = time.Date(2026, 10, 12, 12, 0, 0, 0, time.UTC)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(expired, nil)
+		mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).Return(true, nil)
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, _, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1"), "admin")
+		So(err, ShouldBeNil)
+		So(statementImport.Paid, ShouldEqual, 1)
+	})
+
+	Convey("Payment session changed while the credit was matched is read again", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+		gomock.InOrder(
+			mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(awaitingSession(AwaitingTransfer.String(), ""), nil),
+			mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).Return(false, nil),
+			mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(awaitingSession(Underpaid.String(), "250.00"), nil),
+			mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).Return(true, nil),
+		)
+		mock.EXPECT().UpdateBankCredit(gomock.Any(), gomock.Any()).Return(nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, _, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,250.00,CHABCDEFGHJK,TX1"), "admin")
+		So(err, ShouldBeNil)
+		So(statementImport.Paid, ShouldEqual, 1)
+	})
+
+	Convey("Error reconciling bank transfer", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CreateBankCredit(gomock.Any(), gomock.Any()).Return(true, nil)
+		mock.EXPECT().GetPaymentResourceByRemittanceReference(gomock.Any(), "CHABCDEFGHJK").Return(awaitingSession(AwaitingTransfer.String(), ""), nil)
+		mock.EXPECT().ReconcileBankTransfer(gomock.Any(), "1234", "etag", gomock.Any()).Return(false, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		statementImport, responseType, err := mockPaymentService.ImportBankStatement(httptest.NewRequest("POST", "/test", nil), BankStatementFormatCSV, statement("2026-10-12,500.00,CHABCDEFGHJK,TX1"), "admin")
+		So(statementImport, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error matching bank credit [TX1]: [error reconciling bank transfer on database: [error]]")
+	})
+}
+
+func TestUnitGetBankCreditExceptions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	Convey("Error getting credits", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetBankCredits(gomock.Any(), gomock.Any(), from, to).Return(nil, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		exceptions, responseType, err := mockPaymentService.GetBankCreditExceptions(httptest.NewRequest("GET", "/test", nil), from, to)
+		So(exceptions, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting bank credits from DB: [error]")
+	})
+
+	Convey("Credits that didn't pay a session exactly", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetBankCredits(gomock.Any(), []string{"underpaid", "overpaid", "unmatched", "not-awaiting-transfer"}, from, to).Return([]models.BankCreditDB{
+			{ID: "TX1", Amount: "20.00", Outcome: BankCreditOutcomeUnmatched},
+		}, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		exceptions, responseType, err := mockPaymentService.GetBankCreditExceptions(httptest.NewRequest("GET", "/test", nil), from, to)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(exceptions.Kind, ShouldEqual, BankCreditExceptionsKind)
+		So(exceptions.Items, ShouldHaveLength, 1)
+		So(exceptions.Items[0].ID, ShouldEqual, "TX1")
+	})
+}
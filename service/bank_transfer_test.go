@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testBankTransferAccount = `{"account_name":"Companies House","sort_code":"12-34-56","account_number":"12345678"}`
+
+func TestUnitBankTransferCreatePaymentAndGenerateNextURL(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	bankTransferCfg := *cfg
+	bankTransferCfg.BankTransferAccountJSON = testBankTransferAccount
+	bankTransferCfg.PaymentsAPIURL = "https://api.companieshouse.gov.uk"
+	bankTransferCfg.Parse()
+
+	paymentResource := func() *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Amount:        "500.00",
+			PaymentMethod: PaymentMethodBankTransfer,
+			Status:        InProgress.String(),
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+	}
+
+	Convey("Bank transfers not enabled", t, func() {
+		noAccountCfg := *cfg
+		noAccountCfg.BankTransferAccountJSON = ""
+		bankTransferService := BankTransferService{PaymentService: createMockPaymentService(dao.NewMockDAO(mockCtrl), &noAccountCfg)}
+
+		url, responseType, err := bankTransferService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "payment by bank transfer is not enabled")
+	})
+
+	Convey("Error updating payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, errors.New("error"))
+		bankTransferService := BankTransferService{PaymentService: createMockPaymentService(mock, &bankTransferCfg)}
+
+		url, responseType, err := bankTransferService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error updating payment session on database: [error]")
+	})
+
+	Convey("Payment session no longer in progress", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, nil)
+		bankTransferService := BankTransferService{PaymentService: createMockPaymentService(mock, &bankTransferCfg)}
+
+		url, responseType, err := bankTransferService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), paymentResource())
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "payment session is no longer in progress")
+	})
+
+	Convey("Payment session left awaiting the transfer", t, func() {
+		var update *models.PaymentResourceDB
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+			update = paymentUpdate
+			return true, nil
+		})
+		bankTransferService := BankTransferService{PaymentService: createMockPaymentService(mock, &bankTransferCfg)}
+
+		session := paymentResource()
+		url, responseType, err := bankTransferService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), session)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(url, ShouldEqual, "https://api.companieshouse.gov.uk/callback/payments/bank-transfer/1234")
+		So(update.Data.Status, ShouldEqual, AwaitingTransfer.String())
+		So(update.Data.CompletedAt.IsZero(), ShouldBeTrue)
+		So(update.BankTransfer.Reference, ShouldStartWith, "CH")
+		So(update.BankTransfer.SortCode, ShouldEqual, "12-34-56")
+		So(update.BankTransfer.RequestedAt.IsZero(), ShouldBeFalse)
+		So(update.Data.ExpiresAt, ShouldEqual, update.BankTransfer.RequestedAt.Add(time.Minute*time.Duration(bankTransferCfg.BankTransferExpiryTimeInMinutes)))
+		So(session.Status, ShouldEqual, AwaitingTransfer.String())
+		So(session.ExpiresAt, ShouldEqual, update.Data.ExpiresAt)
+		So(session.BankTransfer.Reference, ShouldEqual, update.BankTransfer.Reference)
+		So(session.BankTransfer.AccountNumber, ShouldEqual, "12345678")
+	})
+
+	Convey("Payment session whose last attempt failed is reopened awaiting the transfer", t, func() {
+		var update *models.PaymentResourceDB
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ []string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+			update = paymentUpdate
+			return true, nil
+		})
+		bankTransferService := BankTransferService{PaymentService: createMockPaymentService(mock, &bankTransferCfg)}
+
+		session := paymentResource()
+		session.Status = NoFunds.String()
+		_, responseType, err := bankTransferService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), session)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(update.Data.Status, ShouldEqual, AwaitingTransfer.String())
+		So(session.Status, ShouldEqual, AwaitingTransfer.String())
+	})
+
+	Convey("Payment session whose last attempt failed is no longer awaiting a retry", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).Return(false, nil)
+		bankTransferService := BankTransferService{PaymentService: createMockPaymentService(mock, &bankTransferCfg)}
+
+		session := paymentResource()
+		session.Status = NoFunds.String()
+		url, responseType, err := bankTransferService.CreatePaymentAndGenerateNextURL(httptest.NewRequest("POST", "/test", nil), session)
+		So(url, ShouldBeEmpty)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session is no longer awaiting a retry")
+		So(session.Status, ShouldEqual, NoFunds.String())
+	})
+}
+
+func TestUnitBankTransferGetPaymentDetails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	bankTransferService := BankTransferService{PaymentService: createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)}
+
+	Convey("No bank transfer requested", t, func() {
+		details, responseType, err := bankTransferService.GetPaymentDetails(context.Background(), &models.PaymentResourceRest{MetaData: models.PaymentResourceMetaDataRest{ID: "1234"}})
+		So(details, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "no bank transfer found for payment session [1234]")
+	})
+
+	Convey("Transfer not yet received in full", t, func() {
+		details, responseType, err := bankTransferService.GetPaymentDetails(context.Background(), &models.PaymentResourceRest{
+			Status:       Underpaid.String(),
+			BankTransfer: &models.BankTransferRest{Reference: "CHABCDEFGHJK"},
+		})
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(details.ExternalPaymentID, ShouldEqual, "CHABCDEFGHJK")
+		So(details.PaymentStatus, ShouldEqual, "pending")
+		So(details.TransactionDate, ShouldBeEmpty)
+	})
+
+	Convey("Transfer received", t, func() {
+		completedAt := time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)
+		details, responseType, err := bankTransferService.GetPaymentDetails(context.Background(), &models.PaymentResourceRest{
+			Status:       Paid.String(),
+			CompletedAt:  completedAt,
+			BankTransfer: &models.BankTransferRest{Reference: "CHABCDEFGHJK"},
+		})
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(details.PaymentStatus, ShouldEqual, "accepted")
+		So(details.TransactionDate, ShouldEqual, completedAt.Format(time.RFC3339Nano))
+	})
+}
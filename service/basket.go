@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/shopspring/decimal"
+)
+
+// SessionResources returns the cost resources a payment session pays for, which are those of its basket if it has
+// one, or else its single resource
+func SessionResources(links models.PaymentLinksRest) []string {
+	if len(links.Resources) > 0 {
+		return links.Resources
+	}
+	return []string{links.Resource}
+}
+
+// incomingResources returns the cost resources a payment session is being created for
+func incomingResources(createResource models.IncomingPaymentResourceRequest) []string {
+	if len(createResource.Resources) > 0 {
+		return createResource.Resources
+	}
+	return []string{createResource.Resource}
+}
+
+// getBasketCosts returns the costs of each of the cost resources a payment session pays for, in the same order
+func (service *PaymentService) getBasketCosts(ctx context.Context, resources []string) ([]*models.CostsRest, ResponseType, error) {
+	basketCosts := make([]*models.CostsRest, 0, len(resources))
+	for _, resource := range resources {
+		costs, responseType, err := service.getResourceCosts(ctx, resource)
+		if err != nil {
+			if len(resources) > 1 {
+				err = fmt.Errorf("cost resource [%s]: [%v]", resource, err)
+			}
+			return nil, responseType, err
+		}
+		basketCosts = append(basketCosts, costs)
+	}
+	return basketCosts, Success, nil
+}
+
+// combineCosts combines the costs of the cost resources a payment session pays for into those of the session. The costs
+// of a basket session are tagged with the resource they are for, so that a refund can be made against one resource,
+// and the session only has a company number if every resource is for the same company.
+func combineCosts(resources []string, basketCosts []*models.CostsRest) *models.CostsRest {
+	if len(basketCosts) == 1 {
+		return basketCosts[0]
+	}
+
+	combined := &models.CostsRest{CompanyNumber: basketCosts[0].CompanyNumber}
+	var descriptions []string
+	for i, costs := range basketCosts {
+		for _, cost := range costs.Costs {
+			cost.Resource = resources[i]
+			combined.Costs = append(combined.Costs, cost)
+		}
+		descriptions = append(descriptions, costs.Description)
+		if costs.CompanyNumber != combined.CompanyNumber {
+			combined.CompanyNumber = ""
+		}
+	}
+	combined.Description = strings.Join(descriptions, ", ")
+	return combined
+}
+
+// MessageResources returns the cost resources to notify of a payment session's outcome, or of one of its refunds. A
+// basket session's resources are each notified in a message of their own, as is the resource a refund was made against.
+// The empty resource is returned when a single message which doesn't name a resource is to be sent, as it is for a
+// session paying for a single resource. When some of a session's messages are still pending, only those are returned,
+// so that the messages already sent aren't sent again.
+func (service *PaymentService) MessageResources(ctx context.Context, id, refundID string) ([]string, error) {
+	paymentResource, err := service.DAO.GetPaymentResource(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment resource from db: [%v]", err)
+	}
+	if paymentResource == nil {
+		return nil, fmt.Errorf("payment session [%s] not found", id)
+	}
+
+	if refundID != "" {
+		for _, refund := range paymentResource.Refunds {
+			if refund.RefundId == refundID && refund.Resource != "" {
+				return []string{refund.Resource}, nil
+			}
+		}
+		return []string{""}, nil
+	}
+
+	if len(paymentResource.MessagesPending) != 0 {
+		return paymentResource.MessagesPending, nil
+	}
+	return paymentMessageResources(models.PaymentLinksRest(paymentResource.Data.Links)), nil
+}
+
+// paymentMessageResources returns the cost resources to notify of a payment session's outcome, the empty resource
+// standing for the single message sent for a session paying for a single resource
+func paymentMessageResources(links models.PaymentLinksRest) []string {
+	if len(links.Resources) == 0 {
+		return []string{""}
+	}
+	return links.Resources
+}
+
+// resourceRefundAvailable returns the amount, in pence, which can still be refunded against one of the cost resources
+// a payment session pays for. This is the total of the resource's costs, less the refunds already made against it.
+func resourceRefundAvailable(paymentSession *models.PaymentResourceRest, resource string) (int, error) {
+	resources := SessionResources(paymentSession.Links)
+	if !slices.Contains(resources, resource) {
+		return 0, fmt.Errorf("cost resource [%s] is not paid for by payment session", resource)
+	}
+
+	var total decimal.Decimal
+	for _, cost := range paymentSession.Costs {
+		// The costs of a session paying for a single resource aren't tagged with it
+		if len(resources) > 1 && cost.Resource != resource {
+			continue
+		}
+		amount, err := decimal.NewFromString(cost.Amount)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing cost amount: [%v]", err)
+		}
+		total = total.Add(amount)
+	}
+
+	available := int(total.Shift(2).IntPart())
+	for _, refund := range paymentSession.Refunds {
+		if refund.Resource == resource && refund.Status != RefundsStatusError {
+			available -= refund.Amount
+		}
+	}
+	return available, nil
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/companieshouse/chs.go/authentication"
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var basketResources = []string{"http://dummy-url/filing", "http://dummy-url/certified-copies"}
+
+func basketCosts(description, amount, classOfPayment, companyNumber string) models.CostsRest {
+	cost := defaultCost
+	cost.Amount = amount
+	cost.ClassOfPayment = []string{classOfPayment}
+	return models.CostsRest{Description: description, Costs: []models.CostResourceRest{cost}, CompanyNumber: companyNumber}
+}
+
+func TestUnitCreateBasketPaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+	cfg.RedirectAllowList = []string{"http://www.companieshouse.gov.uk"}
+
+	basketRequest := func(mock *dao.MockDAO, filingCosts, copiesCosts models.CostsRest) (*models.PaymentResourceRest, ResponseType, error) {
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		filingResponse, _ := httpmock.NewJsonResponder(200, filingCosts)
+		httpmock.RegisterResponder("GET", basketResources[0], filingResponse)
+		copiesResponse, _ := httpmock.NewJsonResponder(200, copiesCosts)
+		httpmock.RegisterResponder("GET", basketResources[1], copiesResponse)
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		return mockPaymentService.CreatePaymentSession(req.WithContext(ctx), models.IncomingPaymentResourceRequest{
+			Resources:   basketResources,
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		})
+	}
+
+	Convey("Error getting the costs of a resource in the basket", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", basketResources[0], jsonResponse)
+		httpmock.RegisterResponder("GET", basketResources[1], httpmock.NewStringResponder(500, ""))
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		paymentResourceRest, status, err := mockPaymentService.CreatePaymentSession(req.WithContext(ctx), models.IncomingPaymentResourceRequest{
+			Resources:   basketResources,
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		})
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "error getting payment resource: [cost resource [http://dummy-url/certified-copies]: [error getting Cost Resource - status code: [500]]]")
+	})
+
+	Convey("Resources in the basket with different classes of payment", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+
+		paymentResourceRest, status, err := basketRequest(mock,
+			basketCosts("filing", "13.00", "data-maintenance", "12345678"),
+			basketCosts("copies", "15.00", "orderable-item", "12345678"))
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "invalid class of payment: [Two or more class of payments are different on the same transaction")
+	})
+
+	Convey("Resource in the basket that has already been paid", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), basketResources[0], gomock.Any())
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), basketResources[1], gomock.Any())
+		copiesCosts := basketCosts("copies", "15.00", "data-maintenance", "12345678")
+		copiesCosts.Status = Paid.String()
+
+		paymentResourceRest, status, err := basketRequest(mock, basketCosts("filing", "13.00", "data-maintenance", "12345678"), copiesCosts)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url/certified-copies] has already been paid")
+	})
+
+	Convey("Basket session paying for every resource", t, func() {
+		var created *models.PaymentResourceDB
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), basketResources[0], gomock.Any())
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), basketResources[1], gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, paymentResource *models.PaymentResourceDB) error {
+			created = paymentResource
+			return nil
+		})
+
+		paymentResourceRest, status, err := basketRequest(mock,
+			basketCosts("filing", "13.00", "data-maintenance", "12345678"),
+			basketCosts("copies", "15.00", "data-maintenance", "12345678"))
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Amount, ShouldEqual, "28.00")
+		So(paymentResourceRest.Description, ShouldEqual, "filing, copies")
+		So(paymentResourceRest.CompanyNumber, ShouldEqual, "12345678")
+		So(paymentResourceRest.Links.Resource, ShouldEqual, basketResources[0])
+		So(paymentResourceRest.Links.Resources, ShouldResemble, basketResources)
+		So(paymentResourceRest.Costs, ShouldHaveLength, 2)
+		So(paymentResourceRest.Costs[0].Resource, ShouldEqual, basketResources[0])
+		So(paymentResourceRest.Costs[1].Resource, ShouldEqual, basketResources[1])
+		So(created.Data.Links.Resources, ShouldResemble, basketResources)
+	})
+}
+
+func TestUnitGetBasketPaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Basket session is priced from every resource", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{
+			ID: "1234",
+			Data: models.PaymentResourceDataDB{
+				Amount: "28.00",
+				Links:  models.PaymentLinksDB{Resource: basketResources[0], Resources: basketResources},
+			},
+		}, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		filingResponse, _ := httpmock.NewJsonResponder(200, basketCosts("filing", "13.00", "data-maintenance", "12345678"))
+		httpmock.RegisterResponder("GET", basketResources[0], filingResponse)
+		copiesResponse, _ := httpmock.NewJsonResponder(200, basketCosts("copies", "15.00", "data-maintenance", "87654321"))
+		httpmock.RegisterResponder("GET", basketResources[1], copiesResponse)
+
+		paymentResourceRest, status, err := mockPaymentService.GetPaymentSession(httptest.NewRequest("GET", "/test", nil), "1234")
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Description, ShouldEqual, "filing, copies")
+		So(paymentResourceRest.Costs, ShouldHaveLength, 2)
+		So(paymentResourceRest.Costs[1].Resource, ShouldEqual, basketResources[1])
+	})
+
+	Convey("Company number is only kept when shared by every resource", t, func() {
+		costs := combineCosts(basketResources, []*models.CostsRest{
+			{Description: "filing", CompanyNumber: "12345678"},
+			{Description: "copies", CompanyNumber: "87654321"},
+		})
+		So(costs.CompanyNumber, ShouldBeEmpty)
+	})
+}
+
+func TestUnitMessageResources(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error getting payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		resources, err := mockPaymentService.MessageResources(context.Background(), "1234", "")
+		So(resources, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "error getting payment resource from db: [error]")
+	})
+
+	Convey("Single resource session is sent a single message", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{
+			Data: models.PaymentResourceDataDB{Links: models.PaymentLinksDB{Resource: "http://dummy-url"}},
+		}, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		resources, err := mockPaymentService.MessageResources(context.Background(), "1234", "")
+		So(err, ShouldBeNil)
+		So(resources, ShouldResemble, []string{""})
+	})
+
+	basketSession := &models.PaymentResourceDB{
+		Data:    models.PaymentResourceDataDB{Links: models.PaymentLinksDB{Resource: basketResources[0], Resources: basketResources}},
+		Refunds: []models.RefundResourceDB{{RefundId: "whole"}, {RefundId: "copies", Resource: basketResources[1]}},
+	}
+
+	Convey("Basket session's resources are each sent a message", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(basketSession, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		resources, err := mockPaymentService.MessageResources(context.Background(), "1234", "")
+		So(err, ShouldBeNil)
+		So(resources, ShouldResemble, basketResources)
+	})
+
+	Convey("Only the basket session's resources still pending a message are sent one", t, func() {
+		pendingSession := *basketSession
+		pendingSession.MessagesPending = basketResources[1:]
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&pendingSession, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		resources, err := mockPaymentService.MessageResources(context.Background(), "1234", "")
+		So(err, ShouldBeNil)
+		So(resources, ShouldResemble, basketResources[1:])
+	})
+
+	Convey("Refund against a resource is sent a message for it", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(basketSession, nil).Times(2)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		resources, err := mockPaymentService.MessageResources(context.Background(), "1234", "copies")
+		So(err, ShouldBeNil)
+		So(resources, ShouldResemble, []string{basketResources[1]})
+
+		resources, err = mockPaymentService.MessageResources(context.Background(), "1234", "whole")
+		So(err, ShouldBeNil)
+		So(resources, ShouldResemble, []string{""})
+	})
+}
+
+func TestUnitValidateIncomingBasket(t *testing.T) {
+	cfg, _ := config.Get()
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+	cfg.RedirectAllowList = []string{"http://www.companieshouse.gov.uk"}
+
+	request := func(resource string, resources ...string) models.IncomingPaymentResourceRequest {
+		return models.IncomingPaymentResourceRequest{
+			Resource:    resource,
+			Resources:   resources,
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		}
+	}
+
+	Convey("Resource and resources both given", t, func() {
+		err := validateIncomingPayment(request("http://dummy-url/filing", basketResources...), cfg, "")
+		So(err.Error(), ShouldEqual, "resource and resources can't both be given")
+	})
+
+	Convey("Resource in the basket given twice", t, func() {
+		err := validateIncomingPayment(request("", basketResources[0], basketResources[0]), cfg, "")
+		So(err.Error(), ShouldContainSubstring, "failed on the 'unique' tag")
+	})
+
+	Convey("Resource in the basket outside the allow list", t, func() {
+		err := validateIncomingPayment(request("", basketResources[0], "http://other-url/copies"), cfg, "")
+		So(err.Error(), ShouldEqual, "invalid resource domain: http://other-url")
+	})
+
+	Convey("Valid basket", t, func() {
+		So(validateIncomingPayment(request("", basketResources...), cfg, ""), ShouldBeNil)
+	})
+}
@@ -5,18 +5,23 @@ import (
 	"net/http"
 
 	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"gopkg.in/go-playground/validator.v9"
 )
 
 // ExternalPaymentProvidersService contains the different external services which can be used to make a payment
 type ExternalPaymentProvidersService struct {
-	GovPayService GovPayService
-	PayPalService PayPalService
+	GovPayService       GovPayService
+	PayPalService       PayPalService
+	AccountService      AccountService
+	BankTransferService BankTransferService
 }
 
 // CreateExternalPaymentJourney creates an external payment session with a Payment Provider that is given, e.g: GovPay
 func (service *PaymentService) CreateExternalPaymentJourney(req *http.Request, paymentSession *models.PaymentResourceRest, providersService ExternalPaymentProvidersService) (*models.ExternalPaymentJourney, ResponseType, error) {
-	if paymentSession.Status != InProgress.String() {
+	retrying := isRetryableFailure(paymentSession.Status)
+	if paymentSession.Status != InProgress.String() && !retrying {
 		err := fmt.Errorf("payment session is not in progress")
 		log.ErrorR(req, err)
 		return nil, InvalidData, err
@@ -29,8 +34,52 @@ func (service *PaymentService) CreateExternalPaymentJourney(req *http.Request, p
 		return nil, InvalidData, err
 	}
 
+	if paymentSession.MetaData.PrefilledCardholderDetails != nil {
+		err = validator.New().Struct(paymentSession.MetaData.PrefilledCardholderDetails)
+		if err != nil {
+			err = fmt.Errorf("invalid prefilled cardholder details: [%v]", err)
+			log.ErrorR(req, err)
+			return nil, InvalidData, err
+		}
+	}
+
+	// A failed attempt can be retried while the session hasn't expired. The session is put back in progress by the same
+	// update that records the new attempt, once the attempt has been made, so that a session is only reopened once there
+	// is an attempt whose outcome can complete it.
+	if retrying && IsExpired(*paymentSession, &service.Config) {
+		err = fmt.Errorf("payment session has expired")
+		log.ErrorR(req, err)
+		return nil, InvalidData, err
+	}
+
+	// The session's cost resources are claimed for as long as the journey can be completed, so that no other session can
+	// pay them at the same time. The claim is given up if the journey isn't created.
+	resources := SessionResources(paymentSession.Links)
+	responseType, err := service.claimResources(req.Context(), paymentSession.MetaData.ID, resources, journeyClaimExpiry(*paymentSession, &service.Config))
+	if err != nil {
+		log.ErrorR(req, err)
+		service.releaseResources(req.Context(), paymentSession.MetaData.ID, resources)
+		return nil, responseType, err
+	}
+	journeyCreated := false
+	defer func() {
+		if !journeyCreated {
+			service.releaseResources(req.Context(), paymentSession.MetaData.ID, resources)
+		}
+	}()
+
+	// Send the user back to the latest attempt while it can still be used, rather than creating another payment with the
+	// provider and leaving the earlier one orphaned
+	if nextURL := service.reusableNextURL(req, paymentSession, providersService); nextURL != "" {
+		log.InfoR(req, "reusing the latest external payment attempt", log.Data{"payment_id": paymentSession.MetaData.ID})
+		journeyCreated = true
+		return &models.ExternalPaymentJourney{NextURL: nextURL}, Success, nil
+	}
+
+	// A new callback token is issued for each journey, so only the return from the latest journey is accepted
+	paymentSession.MetaData.CallbackToken = helpers.GenerateCallbackToken()
+
 	paymentJourney := &models.ExternalPaymentJourney{}
-	var responseType ResponseType
 	var nextURL string
 
 	switch paymentSession.PaymentMethod {
@@ -39,7 +88,7 @@ func (service *PaymentService) CreateExternalPaymentJourney(req *http.Request, p
 		if err != nil {
 			err = fmt.Errorf("error communicating with GovPay: [%s]", err)
 			log.ErrorR(req, err)
-			return nil, Error, err
+			return nil, providerErrorResponseType(responseType), err
 		}
 		if nextURL == "" {
 			err = fmt.Errorf("no NextURL returned from GovPay")
@@ -52,13 +101,36 @@ func (service *PaymentService) CreateExternalPaymentJourney(req *http.Request, p
 		if err != nil {
 			err = fmt.Errorf("error communicating with PayPal API: [%v]", err)
 			log.ErrorR(req, err)
-			return nil, Error, err
+			return nil, providerErrorResponseType(responseType), err
 		}
 		if nextURL == "" {
 			err = fmt.Errorf("approve link not returned in paypal order response")
 			log.ErrorR(req, err)
 			return nil, Error, err
 		}
+
+	case PaymentMethodAccount:
+		// The payment is made from the account as the journey is created, so the user is returned straight to the
+		// calling service
+		nextURL, responseType, err = providersService.AccountService.CreatePaymentAndGenerateNextURL(req, paymentSession)
+		if err != nil {
+			err = fmt.Errorf("error paying from account: [%v]", err)
+			log.ErrorR(req, err)
+			return nil, responseType, err
+		}
+	case PaymentMethodBankTransfer:
+		// The payer is given the bank details to make the transfer with, and is returned straight to the calling service
+		nextURL, responseType, err = providersService.BankTransferService.CreatePaymentAndGenerateNextURL(req, paymentSession)
+		if err != nil {
+			err = fmt.Errorf("error requesting bank transfer: [%v]", err)
+			log.ErrorR(req, err)
+			return nil, responseType, err
+		}
+		paymentJourney.BankTransfer = paymentSession.BankTransfer
+		// The session stays claimed until the transfer arrives, or the session expires without it
+		if _, err = service.claimResources(req.Context(), paymentSession.MetaData.ID, resources, ExpiresAt(*paymentSession, &service.Config)); err != nil {
+			log.ErrorR(req, fmt.Errorf("error keeping the claim of a payment session awaiting a bank transfer: [%v]", err))
+		}
 	default:
 		err := fmt.Errorf("payment method [%s] for resource [%s] not recognised", paymentSession.PaymentMethod, paymentSession.Links.Self)
 		log.ErrorR(req, err)
@@ -66,11 +138,60 @@ func (service *PaymentService) CreateExternalPaymentJourney(req *http.Request, p
 		return nil, Error, err
 	}
 
+	// The cardholder details have been passed on to the payment provider, so are no longer needed
+	if paymentSession.MetaData.PrefilledCardholderDetails != nil {
+		err = service.DAO.RemovePrefilledCardholderDetails(req.Context(), paymentSession.MetaData.ID)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error removing prefilled cardholder details from payment session: [%v]", err))
+		}
+	}
+
 	paymentJourney.NextURL = nextURL
+	journeyCreated = true
 
 	return paymentJourney, responseType, nil
 }
 
+// reusableNextURL returns the next URL of the payment session's latest external payment attempt, if the attempt was made
+// with the session's payment method and the provider says it can still be used, or an empty string otherwise. The
+// provider returns the user with the callback token issued for the attempt, so it can't be reused once that is spent,
+// nor once the attempt has failed.
+func (service *PaymentService) reusableNextURL(req *http.Request, paymentSession *models.PaymentResourceRest, providersService ExternalPaymentProvidersService) string {
+	attempts := paymentSession.MetaData.ExternalPaymentAttempts
+	if len(attempts) == 0 || !paymentSession.MetaData.CallbackTokenOutstanding || isRetryableFailure(paymentSession.Status) {
+		return ""
+	}
+	latest := attempts[len(attempts)-1]
+	if latest.PaymentMethod != paymentSession.PaymentMethod {
+		return ""
+	}
+
+	var nextURL string
+	var err error
+	switch latest.PaymentMethod {
+	case PaymentMethodCreditCard:
+		nextURL, err = providersService.GovPayService.GetUsableNextURL(req.Context(), paymentSession, latest)
+	case PaymentMethodPayPal:
+		nextURL, err = providersService.PayPalService.GetUsableNextURL(req.Context(), paymentSession, latest)
+	}
+	if err != nil {
+		// A new attempt can still be made, so the journey isn't failed because the latest couldn't be checked
+		log.ErrorR(req, fmt.Errorf("error checking whether the latest external payment attempt can be reused: [%v]", err))
+		return ""
+	}
+	return nextURL
+}
+
+// providerErrorResponseType returns the response type of a failure to create a journey with an external payment
+// provider. A session which stopped awaiting a retry while the journey was created is a conflict, and any other failure
+// is an error.
+func providerErrorResponseType(responseType ResponseType) ResponseType {
+	if responseType == Conflict {
+		return Conflict
+	}
+	return Error
+}
+
 func validateClassOfPayment(costs *[]models.CostResourceRest) error {
 
 	for i, cost := range *costs {
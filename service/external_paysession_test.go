@@ -1,13 +1,18 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jarcoal/httpmock"
+	"github.com/plutov/paypal/v4"
 
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
@@ -30,6 +35,7 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 	cfg.GovPayURL = "http://dummy-govpay-url"
 
 	mockDao := dao.NewMockDAO(mockCtrl)
+	allowResourceClaims(mockDao)
 	mockPaymentService := createMockPaymentService(mockDao, cfg)
 	mockPayPalSDK := NewMockPayPalSDK(mockCtrl)
 
@@ -138,7 +144,7 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 
 	Convey("No NextURL received from GOV.UK Pay", t, func() {
 
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		req := httptest.NewRequest("", "/test", nil)
 
@@ -181,7 +187,7 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 
 		for _, tc := range testCases {
 			Convey(tc.classOfPayment, func() {
-				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 				req := httptest.NewRequest("", "/test", nil)
 
@@ -211,11 +217,89 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(responseType.String(), ShouldEqual, Success.String())
 				So(externalPaymentJourney.NextURL, ShouldEqual, "response_url")
+				So(paymentSession.MetaData.CallbackToken, ShouldHaveLength, 64)
 			})
 		}
 
 	})
 
+	prefilledCardholderDetails := &models.PrefilledCardholderDetails{
+		CardholderName: "J Bloggs",
+		BillingAddress: &models.BillingAddress{
+			Line1:    "Crown Way",
+			Postcode: "CF14 3UZ",
+			City:     "Cardiff",
+			Country:  "GB",
+		},
+	}
+
+	Convey("Invalid prefilled cardholder details", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "credit-card",
+			Amount:        "4",
+			Status:        InProgress.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+			MetaData: models.PaymentResourceMetaDataRest{
+				PrefilledCardholderDetails: &models.PrefilledCardholderDetails{BillingAddress: &models.BillingAddress{Country: "Wales"}},
+			},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(externalPaymentJourney, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, InvalidData.String())
+		So(err.Error(), ShouldStartWith, "invalid prefilled cardholder details")
+	})
+
+	Convey("Prefilled cardholder details passed to GOV.UK Pay and removed from the session", t, func() {
+		testCases := []struct {
+			description string
+			removeErr   error
+		}{
+			{description: "removed", removeErr: nil},
+			{description: "error removing", removeErr: errors.New("error")},
+		}
+
+		for _, tc := range testCases {
+			Convey(tc.description, func() {
+				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				mockDao.EXPECT().RemovePrefilledCardholderDetails(gomock.Any(), "1234").Return(tc.removeErr)
+
+				req := httptest.NewRequest("", "/test", nil)
+
+				httpmock.Activate()
+				defer httpmock.DeactivateAndReset()
+				var govPayRequest models.OutgoingGovPayRequest
+				httpmock.RegisterResponder("POST", cfg.GovPayURL, func(req *http.Request) (*http.Response, error) {
+					if err := json.NewDecoder(req.Body).Decode(&govPayRequest); err != nil {
+						return nil, err
+					}
+					return httpmock.NewJsonResponse(http.StatusCreated, &models.IncomingGovPayResponse{
+						GovPayLinks: models.GovPayLinks{NextURL: models.NextURL{HREF: "response_url"}},
+					})
+				})
+
+				paymentSession := models.PaymentResourceRest{
+					PaymentMethod: "credit-card",
+					Amount:        "4",
+					Status:        InProgress.String(),
+					Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+					MetaData: models.PaymentResourceMetaDataRest{
+						ID:                         "1234",
+						PrefilledCardholderDetails: prefilledCardholderDetails,
+					},
+				}
+
+				externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+				So(err, ShouldBeNil)
+				So(responseType.String(), ShouldEqual, Success.String())
+				So(externalPaymentJourney.NextURL, ShouldEqual, "response_url")
+				So(govPayRequest.PrefilledCardholderDetails, ShouldResemble, prefilledCardholderDetails)
+			})
+		}
+	})
+
 	Convey("Error communicating with Paypal", t, func() {
 
 		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
@@ -247,7 +331,7 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 
 		paypalResponse := CreatePayPalOrderResponse("")
 		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&paypalResponse, nil)
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		req := httptest.NewRequest("", "/test", nil)
 
@@ -288,7 +372,7 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 			Convey(tc.classOfPayment, func() {
 				paypalResponse := CreatePayPalOrderResponse("response_url")
 				mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&paypalResponse, nil)
-				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 				req := httptest.NewRequest("", "/test", nil)
 
@@ -315,6 +399,224 @@ func TestUnitCreateExternalPayment(t *testing.T) {
 
 	})
 
+	govPayAttempt := models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "http://dummy-govpay-url/latest", ExternalPaymentStatusID: "latest"}
+
+	Convey("Latest GovPay attempt reused while it is still usable", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, &models.IncomingGovPayResponse{
+			State:       models.State{Status: "created"},
+			GovPayLinks: models.GovPayLinks{NextURL: models.NextURL{HREF: "existing_url"}},
+		})
+		httpmock.RegisterResponder("GET", "http://dummy-govpay-url/latest", jsonResponse)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "credit-card",
+			Amount:        "4",
+			Status:        InProgress.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+			MetaData: models.PaymentResourceMetaDataRest{
+				CallbackTokenOutstanding: true,
+				ExternalPaymentAttempts:  []models.ExternalPaymentAttempt{govPayAttempt},
+			},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(err, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Success.String())
+		So(externalPaymentJourney.NextURL, ShouldEqual, "existing_url")
+		So(paymentSession.MetaData.CallbackToken, ShouldBeEmpty)
+		So(httpmock.GetCallCountInfo()["POST "+cfg.GovPayURL], ShouldEqual, 0)
+	})
+
+	Convey("New GovPay attempt made when the latest can't be reused", t, func() {
+		testCases := []struct {
+			name                     string
+			callbackTokenOutstanding bool
+			paymentMethod            string
+			state                    models.State
+		}{
+			{name: "latest attempt started", callbackTokenOutstanding: true, paymentMethod: "credit-card", state: models.State{Status: "started"}},
+			{name: "callback token spent", callbackTokenOutstanding: false, paymentMethod: "credit-card", state: models.State{Status: "created"}},
+			{name: "payment method changed", callbackTokenOutstanding: true, paymentMethod: "PayPal", state: models.State{Status: "created"}},
+		}
+
+		for _, tc := range testCases {
+			Convey(tc.name, func() {
+				mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+				req := httptest.NewRequest("", "/test", nil)
+
+				httpmock.Activate()
+				defer httpmock.DeactivateAndReset()
+				existing, _ := httpmock.NewJsonResponder(http.StatusOK, &models.IncomingGovPayResponse{
+					State:       tc.state,
+					GovPayLinks: models.GovPayLinks{NextURL: models.NextURL{HREF: "existing_url"}},
+				})
+				httpmock.RegisterResponder("GET", "http://dummy-govpay-url/latest", existing)
+				created, _ := httpmock.NewJsonResponder(http.StatusCreated, &models.IncomingGovPayResponse{
+					GovPayLinks: models.GovPayLinks{NextURL: models.NextURL{HREF: "new_url"}},
+				})
+				httpmock.RegisterResponder("POST", cfg.GovPayURL, created)
+
+				attempt := govPayAttempt
+				attempt.PaymentMethod = tc.paymentMethod
+				paymentSession := models.PaymentResourceRest{
+					PaymentMethod: "credit-card",
+					Amount:        "4",
+					Status:        InProgress.String(),
+					Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+					MetaData: models.PaymentResourceMetaDataRest{
+						CallbackTokenOutstanding: tc.callbackTokenOutstanding,
+						ExternalPaymentAttempts:  []models.ExternalPaymentAttempt{attempt},
+					},
+				}
+
+				externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+				So(err, ShouldBeNil)
+				So(responseType.String(), ShouldEqual, Success.String())
+				So(externalPaymentJourney.NextURL, ShouldEqual, "new_url")
+				So(paymentSession.MetaData.CallbackToken, ShouldHaveLength, 64)
+			})
+		}
+	})
+
+	Convey("Latest PayPal attempt reused while its order is waiting to be approved", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+		mockPayPalSDK.EXPECT().GetOrder(gomock.Any(), "order_id").Return(&paypal.Order{
+			Status: paypal.OrderStatusCreated,
+			Links:  []paypal.Link{{Href: "existing_approve_url", Rel: "approve"}},
+		}, nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "PayPal",
+			Status:        InProgress.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+			MetaData: models.PaymentResourceMetaDataRest{
+				CallbackTokenOutstanding: true,
+				ExternalPaymentAttempts: []models.ExternalPaymentAttempt{
+					govPayAttempt,
+					{PaymentMethod: "PayPal", ExternalPaymentStatusID: "order_id"},
+				},
+			},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(err, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Success.String())
+		So(externalPaymentJourney.NextURL, ShouldEqual, "existing_approve_url")
+	})
+
+	Convey("Session whose last attempt failed is reopened by recording the new attempt", t, func() {
+		mockDao.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, _ []string, update *models.PaymentResourceDB) (bool, error) {
+				So(update.Data.Status, ShouldEqual, InProgress.String())
+				So(update.ExternalPaymentAttempts, ShouldHaveLength, 1)
+				So(update.CallbackTokenHash, ShouldNotBeEmpty)
+				return true, nil
+			})
+		req := httptest.NewRequest("", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusCreated, &models.IncomingGovPayResponse{
+			GovPayLinks: models.GovPayLinks{NextURL: models.NextURL{HREF: "new_url"}},
+		})
+		httpmock.RegisterResponder("POST", cfg.GovPayURL, jsonResponse)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "credit-card",
+			Amount:        "4",
+			CreatedAt:     time.Now(),
+			Status:        "failed_payment-cancelled-by-user",
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+			MetaData: models.PaymentResourceMetaDataRest{
+				ID:                      "1234",
+				ExternalPaymentAttempts: []models.ExternalPaymentAttempt{govPayAttempt},
+			},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(err, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Success.String())
+		So(externalPaymentJourney.NextURL, ShouldEqual, "new_url")
+		So(paymentSession.Status, ShouldEqual, InProgress.String())
+	})
+
+	Convey("Session whose last attempt failed can't be retried once it has expired", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "credit-card",
+			CreatedAt:     time.Now().Add(-2 * time.Hour),
+			Status:        Failed.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(externalPaymentJourney, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, InvalidData.String())
+		So(err.Error(), ShouldEqual, "payment session has expired")
+	})
+
+	Convey("Session whose last attempt failed is no longer awaiting a retry", t, func() {
+		paypalResponse := CreatePayPalOrderResponse("approve_url")
+		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&paypalResponse, nil)
+		mockDao.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).Return(false, nil)
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "PayPal",
+			Amount:        "3",
+			CreatedAt:     time.Now(),
+			Status:        NoFunds.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"orderable-item"}}},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(externalPaymentJourney, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Conflict.String())
+		So(err.Error(), ShouldEqual, "error communicating with PayPal API: [error storing PayPal external payment details for payment session: [payment session is no longer awaiting a retry]]")
+		So(paymentSession.Status, ShouldEqual, NoFunds.String())
+	})
+
+	Convey("Session whose last attempt failed is left failed when the new attempt can't be made", t, func() {
+		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error"))
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "PayPal",
+			Amount:        "3",
+			CreatedAt:     time.Now(),
+			Status:        NoFunds.String(),
+			Costs:         []models.CostResourceRest{{ClassOfPayment: []string{"orderable-item"}}},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(externalPaymentJourney, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Error.String())
+		So(err.Error(), ShouldEqual, "error communicating with PayPal API: [error creating order: [error]]")
+		So(paymentSession.Status, ShouldEqual, NoFunds.String())
+	})
+
+	Convey("Session cancelled by the service can't be retried", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "credit-card",
+			CreatedAt:     time.Now(),
+			Status:        "failed_payment-cancelled-by-service",
+		}
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, mockExternalPaymentProvidersService)
+		So(externalPaymentJourney, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, InvalidData.String())
+		So(err.Error(), ShouldEqual, "payment session is not in progress")
+	})
+
 	Convey("Invalid Payment Method", t, func() {
 
 		req := httptest.NewRequest("", "/test", nil)
@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,9 +10,14 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 	"github.com/plutov/paypal/v4"
 )
 
@@ -19,22 +25,40 @@ var govPayRequestError = "error generating request for GovPay: [%s]"
 var govPayHeaderError = "error adding GovPay headers: [%s]"
 var govPayStatusError = "error status [%v] back from GovPay: [%s]"
 
+// httpClient is used for all outbound calls to GovPay and cost resources so that they carry the trace context
+var httpClient = &http.Client{Transport: tracing.NewTransport(nil)}
+
 // GovPayService handles the specific functionality of integrating GovPay provider into Payment Sessions
 type GovPayService struct {
 	PaymentService PaymentService
 }
 
 // CheckPaymentProviderStatus checks the status of the payment with GovPay
-func (gp *GovPayService) CheckPaymentProviderStatus(paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
-	govPayResponse, err := callGovPay(gp, paymentResource)
+func (gp *GovPayService) CheckPaymentProviderStatus(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
+	govPayResponse, err := callGovPay(ctx, gp, paymentResource)
 	if err != nil {
 		return nil, "", Error, err
 	}
 	state := govPayResponse.State
+	latestPaid := state.Finished && state.Status == "success"
 
-	if state.Finished && state.Status == "success" {
+	// An earlier attempt may have been paid too, e.g. in another browser tab
+	paidResponse, _, err := gp.checkEarlierAttempts(ctx, paymentResource, latestPaid)
+	if err != nil && !latestPaid {
+		return nil, "", Error, err
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("error checking earlier GovPay attempts of a paid payment session: [%v]", err), log.Data{"payment_id": paymentResource.MetaData.ID})
+	}
+
+	if latestPaid {
 		return &models.StatusResponse{Status: "paid"}, govPayResponse.ProviderID, Success, nil
-	} else if state.Finished && state.Code == "P0030" {
+	}
+	if paidResponse != nil {
+		return &models.StatusResponse{Status: "paid"}, paidResponse.ProviderID, Success, nil
+	}
+
+	if state.Finished && state.Code == "P0030" {
 		return &models.StatusResponse{Status: "cancelled"}, "", Success, nil
 	} else if !state.Finished && state.Status == "created" {
 		/*
@@ -62,34 +86,38 @@ func (gp *GovPayService) CreatePaymentAndGenerateNextURL(req *http.Request, paym
 	}
 
 	govPayRequest.Amount = amountToPay
-	if paymentResource.CreatedBy.Email != "" {
-		govPayRequest.Email = paymentResource.CreatedBy.Email
+	if payer := payerOf(paymentResource); payer.Email != "" {
+		govPayRequest.Email = payer.Email
+	}
+	classOfPayment := getClassOfPayment(paymentResource.Costs)
+	account, err := gp.PaymentService.Config.GovPayAccountForClass(classOfPayment)
+	if err != nil {
+		return "", InvalidData, fmt.Errorf("error getting GovPay account: [%s]", err)
+	}
+	govPayRequest.Description, err = govPayDescription(paymentResource, classOfPayment, account, &gp.PaymentService.Config)
+	if err != nil {
+		return "", Error, err
 	}
-	govPayRequest.Description = "Companies House Payment" // Hard-coded value for payment screens
 	govPayRequest.Reference = paymentResource.MetaData.ID
-	govPayRequest.ReturnURL = fmt.Sprintf("%s/callback/payments/govpay/%s", gp.PaymentService.Config.PaymentsAPIURL, paymentResource.MetaData.ID)
+	govPayRequest.Language = paymentResource.Language
+	govPayRequest.PrefilledCardholderDetails = paymentResource.MetaData.PrefilledCardholderDetails
+	govPayRequest.ReturnURL = fmt.Sprintf("%s/callback/payments/govpay/%s?%s=%s", gp.PaymentService.Config.PaymentsAPIURL,
+		paymentResource.MetaData.ID, helpers.CallbackTokenParam, paymentResource.MetaData.CallbackToken)
 
 	// Add metadata fields to send to Gov.UK Pay
 	// https://docs.payments.service.gov.uk/custom_metadata/#add-metadata-to-a-payment
-	govPayRequest.Metadata.CompanyNumber = paymentResource.CompanyNumber
+	govPayRequest.Metadata = govPayMetadata(paymentResource)
 
-	// Product Information is a comma separated string, truncated to 100 characters
-	var productTypes []string
-	for _, cost := range paymentResource.Costs {
-		productTypes = append(productTypes, cost.ProductType)
-	}
-	productInformation := strings.Join(productTypes, ",")
-	productInformation = fmt.Sprintf("%.100s", productInformation)
-	govPayRequest.Metadata.ProductInformation = productInformation
-
-	log.TraceR(req, "performing gov pay request", log.Data{"gov_pay_request_data": govPayRequest})
+	loggedRequest := govPayRequest
+	loggedRequest.PrefilledCardholderDetails = nil
+	log.TraceR(req, "performing gov pay request", log.Data{"gov_pay_request_data": loggedRequest})
 
 	requestBody, err := json.Marshal(govPayRequest)
 	if err != nil {
 		return "", Error, fmt.Errorf("error reading GovPayRequest: [%s]", err)
 	}
 
-	request, err := http.NewRequest("POST", gp.PaymentService.Config.GovPayURL, bytes.NewBuffer(requestBody))
+	request, err := http.NewRequestWithContext(req.Context(), "POST", gp.PaymentService.Config.GovPayURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return "", Error, fmt.Errorf(govPayRequestError, err)
 	}
@@ -99,7 +127,9 @@ func (gp *GovPayService) CreatePaymentAndGenerateNextURL(req *http.Request, paym
 		return "", InvalidData, fmt.Errorf(govPayHeaderError, err)
 	}
 
-	resp, err := http.DefaultClient.Do(request)
+	start := time.Now()
+	resp, err := httpClient.Do(request)
+	metrics.ObserveOutboundCall(metrics.ProviderGovPay, "create-payment", start, err)
 	if err != nil {
 		return "", Error, fmt.Errorf("error sending request to GovPay to start payment session: [%s]", err)
 	}
@@ -119,18 +149,18 @@ func (gp *GovPayService) CreatePaymentAndGenerateNextURL(req *http.Request, paym
 		return "", Error, fmt.Errorf(govPayStatusError, resp.StatusCode, govPayResponse.Description)
 	}
 
-	err = gp.PaymentService.StoreExternalPaymentStatusDetails(paymentResource.MetaData.ID, govPayResponse.GovPayLinks.Self.HREF, govPayResponse.PaymentID)
+	responseType, err := gp.PaymentService.StoreExternalPaymentStatusDetails(req.Context(), paymentResource, PaymentMethodCreditCard, govPayResponse.GovPayLinks.Self.HREF, govPayResponse.PaymentID)
 	if err != nil {
-		return "", Error, fmt.Errorf("error storing GovPay external payment details for payment session: [%s]", err)
+		return "", responseType, fmt.Errorf("error storing GovPay external payment details for payment session: [%s]", err)
 	}
 
 	return govPayResponse.GovPayLinks.NextURL.HREF, Success, nil
 }
 
 // GetPaymentDetails gets the details of a GovPay payment
-func (gp *GovPayService) GetPaymentDetails(paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
+func (gp *GovPayService) GetPaymentDetails(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
 
-	govPayResponse, err := callGovPay(gp, paymentResource)
+	govPayResponse, err := callGovPay(ctx, gp, paymentResource)
 	if err != nil {
 		return nil, Error, err
 	}
@@ -151,11 +181,49 @@ func (gp *GovPayService) GetPaymentDetails(paymentResource *models.PaymentResour
 	return paymentDetails, Success, nil
 }
 
-// GetPaymentStatus gets the status of a GovPay payment
+// GetPaymentStatus gets the status of the GovPay payments made for a payment session. The session is paid if any of its
+// GovPay attempts has been paid, and is otherwise only finished once every attempt has finished, with the status of the
+// latest attempt. Sessions whose latest attempt was made with another provider are never finished by GovPay.
 // https://docs.payments.service.gov.uk/api_reference/#payment-status-lifecycle
-func (gp *GovPayService) GetPaymentStatus(paymentResource *models.PaymentResourceRest) (finished bool, status string, providerID string, err error) {
+func (gp *GovPayService) GetPaymentStatus(ctx context.Context, paymentResource *models.PaymentResourceRest) (finished bool, status string, providerID string, err error) {
+	attempts := paymentResource.MetaData.ExternalPaymentAttempts
+	latestIsGovPay := len(attempts) == 0 || attempts[len(attempts)-1].PaymentMethod == PaymentMethodCreditCard
+
+	if latestIsGovPay {
+		finished, status, providerID, err = gp.getAttemptStatus(ctx, paymentResource, paymentResource.MetaData.ExternalPaymentStatusURI)
+		if err != nil {
+			return false, "", "", err
+		}
+	}
+	latestPaid := status == "paid"
 
-	govPayResponse, err := callGovPay(gp, paymentResource)
+	paidResponse, unfinishedStatus, err := gp.checkEarlierAttempts(ctx, paymentResource, latestPaid)
+	if err != nil && !latestPaid {
+		return false, "", "", err
+	}
+	if err != nil {
+		log.Error(fmt.Errorf("error checking earlier GovPay attempts of a paid payment session: [%v]", err), log.Data{"payment_id": paymentResource.MetaData.ID})
+	}
+
+	switch {
+	case latestPaid:
+		return finished, status, providerID, nil
+	case paidResponse != nil:
+		return true, "paid", paidResponse.ProviderID, nil
+	case !latestIsGovPay:
+		return false, InProgress.String(), "", nil
+	case !finished:
+		return false, status, "", nil
+	case unfinishedStatus != "":
+		return false, unfinishedStatus, "", nil
+	}
+	return finished, status, providerID, nil
+}
+
+// getAttemptStatus gets the status of the GovPay payment at the given URI
+func (gp *GovPayService) getAttemptStatus(ctx context.Context, paymentResource *models.PaymentResourceRest, uri string) (finished bool, status string, providerID string, err error) {
+
+	govPayResponse, err := callGovPayURI(ctx, gp, paymentResource, uri)
 	if err != nil {
 		return false, "", "", err
 	}
@@ -182,6 +250,93 @@ func (gp *GovPayService) GetPaymentStatus(paymentResource *models.PaymentResourc
 	return govPayResponse.State.Finished, govPayResponse.State.Status, "", nil
 }
 
+// GetUsableNextURL returns the next_url of a GovPay attempt while the user can still be sent to it, which is until they
+// first follow it, or an empty string if a new payment must be created
+func (gp *GovPayService) GetUsableNextURL(ctx context.Context, paymentResource *models.PaymentResourceRest, attempt models.ExternalPaymentAttempt) (string, error) {
+	govPayResponse, err := callGovPayURI(ctx, gp, paymentResource, attempt.ExternalPaymentStatusURI)
+	if err != nil {
+		return "", err
+	}
+	if govPayResponse.State.Finished || govPayResponse.State.Status != "created" {
+		return "", nil
+	}
+	return govPayResponse.GovPayLinks.NextURL.HREF, nil
+}
+
+// checkEarlierAttempts gets the GovPay payments of a payment session's GovPay attempts other than the latest, newest
+// first, skipping those whose outcome is already known. Unless the latest attempt has been paid, the first found paid
+// is made the session's external payment and its payment returned. Any other found paid means the payer has paid
+// twice, so it is marked for refund, which is recorded once the session is completed by its paid attempt. Attempts
+// found to have finished unpaid are recorded as such straight away, so GovPay isn't asked about them again. The status
+// of the newest attempt found unfinished is also returned.
+func (gp *GovPayService) checkEarlierAttempts(ctx context.Context, paymentResource *models.PaymentResourceRest, latestPaid bool) (*models.IncomingGovPayResponse, string, error) {
+	var paidResponse *models.IncomingGovPayResponse
+	var unfinishedStatus string
+	latestURI := paymentResource.MetaData.ExternalPaymentStatusURI
+	attempts := govPayAttempts(paymentResource)
+	for i := len(attempts) - 1; i >= 0; i-- {
+		attempt := attempts[i]
+		if attempt.ExternalPaymentStatusURI == latestURI || attempt.Outcome != "" {
+			continue
+		}
+		govPayResponse, err := callGovPayURI(ctx, gp, paymentResource, attempt.ExternalPaymentStatusURI)
+		if err != nil {
+			return nil, "", err
+		}
+		state := govPayResponse.State
+		switch {
+		case !state.Finished:
+			if unfinishedStatus == "" {
+				unfinishedStatus = state.Status
+			}
+		case state.Status != "success":
+			gp.PaymentService.recordAttemptOutcome(ctx, paymentResource.MetaData.ID, attempt, attemptFinished)
+		case latestPaid || paidResponse != nil:
+			setAttemptOutcome(paymentResource, attempt, attemptRefundRequired)
+		default:
+			useAttempt(paymentResource, attempt)
+			paidResponse = govPayResponse
+		}
+	}
+	return paidResponse, unfinishedStatus, nil
+}
+
+// govPayAttempts returns the payment session's GovPay attempts. Sessions whose journeys were created before attempts
+// were recorded have only the one, stored in the metadata.
+func govPayAttempts(paymentResource *models.PaymentResourceRest) []models.ExternalPaymentAttempt {
+	if len(paymentResource.MetaData.ExternalPaymentAttempts) == 0 {
+		return []models.ExternalPaymentAttempt{{
+			PaymentMethod:            PaymentMethodCreditCard,
+			ExternalPaymentStatusURI: paymentResource.MetaData.ExternalPaymentStatusURI,
+			ExternalPaymentStatusID:  paymentResource.MetaData.ExternalPaymentStatusID,
+		}}
+	}
+
+	var attempts []models.ExternalPaymentAttempt
+	for _, attempt := range paymentResource.MetaData.ExternalPaymentAttempts {
+		if attempt.PaymentMethod == PaymentMethodCreditCard {
+			attempts = append(attempts, attempt)
+		}
+	}
+	return attempts
+}
+
+// setAttemptOutcome sets the outcome of the payment session's attempt with the same external payment as that given
+func setAttemptOutcome(paymentResource *models.PaymentResourceRest, attempt models.ExternalPaymentAttempt, outcome string) {
+	for i := range paymentResource.MetaData.ExternalPaymentAttempts {
+		if paymentResource.MetaData.ExternalPaymentAttempts[i].ExternalPaymentStatusURI == attempt.ExternalPaymentStatusURI {
+			paymentResource.MetaData.ExternalPaymentAttempts[i].Outcome = outcome
+		}
+	}
+}
+
+// useAttempt makes the attempt the payment session's external payment, so that it is the payment refunded and
+// reported on once the session is completed
+func useAttempt(paymentResource *models.PaymentResourceRest, attempt models.ExternalPaymentAttempt) {
+	paymentResource.MetaData.ExternalPaymentStatusURI = attempt.ExternalPaymentStatusURI
+	paymentResource.MetaData.ExternalPaymentStatusID = attempt.ExternalPaymentStatusID
+}
+
 // GetRefundSummary gets refund summary of a GovPay payment
 func (gp *GovPayService) GetRefundSummary(req *http.Request, id string) (*models.PaymentResourceRest, *models.RefundSummary, ResponseType, error) {
 	// Get PaymentSession for the GovPay call
@@ -199,7 +354,7 @@ func (gp *GovPayService) GetRefundSummary(req *http.Request, id string) (*models
 		return nil, nil, NotFound, err
 	}
 
-	govPayResponse, err := callGovPay(gp, paymentSession)
+	govPayResponse, err := callGovPay(req.Context(), gp, paymentSession)
 	if err != nil {
 		err = fmt.Errorf("error getting payment information from gov pay: [%v]", err)
 		log.ErrorR(req, err)
@@ -226,13 +381,13 @@ func (gp *GovPayService) GetRefundSummary(req *http.Request, id string) (*models
 }
 
 // CreateRefund creates a refund in GovPay
-func (gp *GovPayService) CreateRefund(paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+func (gp *GovPayService) CreateRefund(ctx context.Context, paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
 	requestBody, err := json.Marshal(refundRequest)
 	if err != nil {
 		return nil, Error, fmt.Errorf("error reading refund GovPayRequest: [%s]", err)
 	}
 
-	request, err := http.NewRequest("POST", paymentResource.MetaData.ExternalPaymentStatusURI+"/refunds", bytes.NewBuffer(requestBody))
+	request, err := http.NewRequestWithContext(ctx, "POST", paymentResource.MetaData.ExternalPaymentStatusURI+"/refunds", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, Error, fmt.Errorf(govPayRequestError, err)
 	}
@@ -242,7 +397,9 @@ func (gp *GovPayService) CreateRefund(paymentResource *models.PaymentResourceRes
 		return nil, Error, fmt.Errorf(govPayHeaderError, err)
 	}
 
-	resp, err := http.DefaultClient.Do(request)
+	start := time.Now()
+	resp, err := httpClient.Do(request)
+	metrics.ObserveOutboundCall(metrics.ProviderGovPay, "create-refund", start, err)
 	if err != nil {
 		return nil, Error, fmt.Errorf("error sending request to GovPay to create a refund: [%s]", err)
 	}
@@ -266,8 +423,8 @@ func (gp *GovPayService) CreateRefund(paymentResource *models.PaymentResourceRes
 }
 
 // GetRefundStatus gets refund status from GovPay
-func (gp *GovPayService) GetRefundStatus(paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
-	request, err := http.NewRequest("GET", paymentResource.MetaData.ExternalPaymentStatusURI+"/refunds/"+refundId, nil)
+func (gp *GovPayService) GetRefundStatus(ctx context.Context, paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", paymentResource.MetaData.ExternalPaymentStatusURI+"/refunds/"+refundId, nil)
 	if err != nil {
 		return nil, Error, fmt.Errorf(govPayRequestError, err)
 	}
@@ -277,7 +434,9 @@ func (gp *GovPayService) GetRefundStatus(paymentResource *models.PaymentResource
 		return nil, Error, fmt.Errorf(govPayHeaderError, err)
 	}
 
-	resp, err := http.DefaultClient.Do(request)
+	start := time.Now()
+	resp, err := httpClient.Do(request)
+	metrics.ObserveOutboundCall(metrics.ProviderGovPay, "get-refund", start, err)
 	if err != nil {
 		return nil, Error, fmt.Errorf("error sending request to GovPay to get status of a refund: [%s]", err)
 	}
@@ -301,19 +460,79 @@ func (gp *GovPayService) GetRefundStatus(paymentResource *models.PaymentResource
 	return govPayResponse, Success, nil
 }
 
+// maxGovPayDescriptionLength is the longest payment description GOV.UK Pay accepts
+const maxGovPayDescriptionLength = 255
+
+// govPayDescription builds the description shown on the GOV.UK Pay payment screens from the template for the class of
+// payment and the language of the journey, or uses the description of the GOV.UK Pay account if the class has no template
+func govPayDescription(paymentResource *models.PaymentResourceRest, classOfPayment string, account *config.GovPayAccount, cfg *config.Config) (string, error) {
+	tmpl := cfg.GovPayDescriptionTemplate(classOfPayment, paymentResource.Language)
+	if tmpl == nil {
+		return account.Description, nil
+	}
+
+	var description strings.Builder
+	if err := tmpl.Execute(&description, paymentResource); err != nil {
+		return "", fmt.Errorf("error building GovPay description for class of payment [%s]: [%s]", classOfPayment, err)
+	}
+	return truncate(strings.TrimSpace(description.String()), maxGovPayDescriptionLength), nil
+}
+
+// Limits on the custom metadata GOV.UK Pay accepts with a payment
+const (
+	maxGovPayMetadataKeys        = 10
+	maxGovPayMetadataValueLength = 100
+)
+
+// govPayMetadata returns the custom metadata sent to GOV.UK Pay with a payment. Alongside the company number and the
+// comma separated product types of all of the costs, the product type of each cost is given its own key, for as many
+// costs as GOV.UK Pay's limit on the number of keys allows.
+func govPayMetadata(paymentResource *models.PaymentResourceRest) models.Metadata {
+	productTypes := make([]string, 0, len(paymentResource.Costs))
+	for _, cost := range paymentResource.Costs {
+		productTypes = append(productTypes, cost.ProductType)
+	}
+
+	metadata := models.Metadata{
+		"company_number":      truncate(paymentResource.CompanyNumber, maxGovPayMetadataValueLength),
+		"product_information": truncate(strings.Join(productTypes, ","), maxGovPayMetadataValueLength),
+	}
+	for i, productType := range productTypes {
+		if len(metadata) == maxGovPayMetadataKeys {
+			break
+		}
+		metadata[fmt.Sprintf("product_type_%d", i+1)] = truncate(productType, maxGovPayMetadataValueLength)
+	}
+	return metadata
+}
+
+// truncate shortens a string to at most the given number of characters
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
+
 // decimalPayment will always be in the form XX.XX (e.g: 12.00) due to getTotalAmount converting to decimal with 2 fixed places right of decimal point.
 func convertToPenceFromDecimal(decimalPayment string) (int, error) {
 	pencePayment := strings.Replace(decimalPayment, ".", "", 1)
 	return strconv.Atoi(pencePayment)
 }
 
-func callGovPay(gp *GovPayService, paymentResource *models.PaymentResourceRest) (*models.IncomingGovPayResponse, error) {
+func callGovPay(ctx context.Context, gp *GovPayService, paymentResource *models.PaymentResourceRest) (*models.IncomingGovPayResponse, error) {
+	return callGovPayURI(ctx, gp, paymentResource, paymentResource.MetaData.ExternalPaymentStatusURI)
+}
+
+// callGovPayURI gets the GovPay payment at the given URI, which is one of the payment session's attempts
+func callGovPayURI(ctx context.Context, gp *GovPayService, paymentResource *models.PaymentResourceRest, uri string) (*models.IncomingGovPayResponse, error) {
 
-	if paymentResource.MetaData.ExternalPaymentStatusURI == "" {
+	if uri == "" {
 		return nil, fmt.Errorf("gov pay URL not defined")
 	}
 
-	request, err := http.NewRequest("GET", paymentResource.MetaData.ExternalPaymentStatusURI, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
 	if err != nil {
 		return nil, fmt.Errorf(govPayRequestError, err)
 	}
@@ -324,7 +543,9 @@ func callGovPay(gp *GovPayService, paymentResource *models.PaymentResourceRest)
 	}
 
 	// Make call to GovPay
-	resp, err := http.DefaultClient.Do(request)
+	start := time.Now()
+	resp, err := httpClient.Do(request)
+	metrics.ObserveOutboundCall(metrics.ProviderGovPay, "get-payment", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to GovPay: [%s]", err)
 	}
@@ -344,26 +565,12 @@ func callGovPay(gp *GovPayService, paymentResource *models.PaymentResourceRest)
 }
 
 func addGovPayHeaders(request *http.Request, paymentResource *models.PaymentResourceRest, gp *GovPayService) error {
-	BearerToken := "Bearer "
-	treasuryBearer := BearerToken + gp.PaymentService.Config.GovPayBearerTokenTreasury
-	chBearer := BearerToken + gp.PaymentService.Config.GovPayBearerTokenChAccount
-	sanctionsBearer := BearerToken + gp.PaymentService.Config.GovPayBearerTokenSanctionsAccount
-	legacyBearer := BearerToken + gp.PaymentService.Config.GovPayBearerTokenLegacy
-
-	govPayTokens := map[string]string{
-		"data-maintenance":  chBearer,
-		"orderable-item":    chBearer,
-		"legacy":            legacyBearer,
-		"penalty-lfp":       treasuryBearer,
-		"penalty-sanctions": sanctionsBearer,
-	}
-
-	token := govPayTokens[paymentResource.Costs[0].ClassOfPayment[0]]
-	if token == "" {
-		return fmt.Errorf("payment class [%s] not recognised", paymentResource.Costs[0].ClassOfPayment[0])
+	account, err := gp.PaymentService.Config.GovPayAccountForClass(paymentResource.Costs[0].ClassOfPayment[0])
+	if err != nil {
+		return err
 	}
 
-	request.Header.Add("authorization", token)
+	request.Header.Add("authorization", "Bearer "+account.BearerToken)
 	request.Header.Add("accept", "application/json")
 	request.Header.Add("content-type", "application/json")
 
@@ -372,21 +579,21 @@ func addGovPayHeaders(request *http.Request, paymentResource *models.PaymentReso
 
 // CapturePayment is a paypal specific implementation
 // so it does not need to be implemented by the govpay svc
-func (gp GovPayService) CapturePayment(_ string) (*paypal.CaptureOrderResponse, error) {
+func (gp GovPayService) CapturePayment(_ context.Context, _ string) (*paypal.CaptureOrderResponse, error) {
 	// not implemented
 	return nil, nil
 }
 
 // GetCapturedPaymentDetails is a PayPal specific implementation
 // so it does not need to be implemented by the GOV.UK Pay svc
-func (gp GovPayService) GetCapturedPaymentDetails(id string) (*paypal.CaptureDetailsResponse, error) {
+func (gp GovPayService) GetCapturedPaymentDetails(_ context.Context, id string) (*paypal.CaptureDetailsResponse, error) {
 	// not implemented
 	return nil, nil
 }
 
 // RefundCapture is a PayPal specific implementation
 // so it does not need to be implemented by the GOV.UK Pay svc
-func (gp GovPayService) RefundCapture(captureID string) (*paypal.RefundResponse, error) {
+func (gp GovPayService) RefundCapture(_ context.Context, captureID string) (*paypal.RefundResponse, error) {
 	// not implemented
 	return nil, nil
 }
@@ -1,10 +1,13 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
@@ -47,7 +50,7 @@ func TestUnitCheckProvider(t *testing.T) {
 			Costs: []models.CostResourceRest{costResource},
 		}
 
-		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(&paymentResourceRest)
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(providerID, ShouldBeEmpty)
 		So(statusResponse, ShouldBeNil)
@@ -74,13 +77,73 @@ func TestUnitCheckProvider(t *testing.T) {
 			Costs: []models.CostResourceRest{costResource},
 		}
 
-		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(&paymentResourceRest)
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
 		So(responseType.String(), ShouldEqual, Success.String())
 		So(providerID, ShouldEqual, "abc123")
 		So(statusResponse.Status, ShouldEqual, "paid")
 		So(err, ShouldBeNil)
 	})
 
+	Convey("Status - earlier attempt paid", t, func() {
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		cancelled, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: models.State{Status: "failed", Finished: true, Code: "P0030"}})
+		httpmock.RegisterResponder("GET", "latest_uri", cancelled)
+		paid, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: models.State{Status: "success", Finished: true}, ProviderID: "abc123"})
+		httpmock.RegisterResponder("GET", "earlier_uri", paid)
+
+		paymentResourceRest := models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{
+				ExternalPaymentStatusURI: "latest_uri",
+				ExternalPaymentStatusID:  "latest",
+				ExternalPaymentAttempts: []models.ExternalPaymentAttempt{
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri", ExternalPaymentStatusID: "earlier"},
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri", ExternalPaymentStatusID: "latest"},
+				},
+			},
+			Costs: []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+		}
+
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
+		So(err, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Success.String())
+		So(providerID, ShouldEqual, "abc123")
+		So(statusResponse.Status, ShouldEqual, "paid")
+		So(paymentResourceRest.MetaData.ExternalPaymentStatusURI, ShouldEqual, "earlier_uri")
+		So(paymentResourceRest.MetaData.ExternalPaymentStatusID, ShouldEqual, "earlier")
+	})
+
+	Convey("Status - latest and earlier attempts paid", t, func() {
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		latest, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: models.State{Status: "success", Finished: true}, ProviderID: "latest123"})
+		httpmock.RegisterResponder("GET", "latest_uri", latest)
+		earlier, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: models.State{Status: "success", Finished: true}, ProviderID: "earlier123"})
+		httpmock.RegisterResponder("GET", "earlier_uri", earlier)
+
+		paymentResourceRest := models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{
+				ExternalPaymentStatusURI: "latest_uri",
+				ExternalPaymentStatusID:  "latest",
+				ExternalPaymentAttempts: []models.ExternalPaymentAttempt{
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri", ExternalPaymentStatusID: "earlier"},
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri", ExternalPaymentStatusID: "latest"},
+				},
+			},
+			Costs: []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+		}
+
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
+		So(err, ShouldBeNil)
+		So(responseType.String(), ShouldEqual, Success.String())
+		So(providerID, ShouldEqual, "latest123")
+		So(statusResponse.Status, ShouldEqual, "paid")
+		So(paymentResourceRest.MetaData.ExternalPaymentStatusURI, ShouldEqual, "latest_uri")
+		So(paymentResourceRest.MetaData.ExternalPaymentAttempts[0].Outcome, ShouldEqual, "refund-required")
+	})
+
 	Convey("Status - failure", t, func() {
 
 		httpmock.Activate()
@@ -101,7 +164,7 @@ func TestUnitCheckProvider(t *testing.T) {
 			Costs: []models.CostResourceRest{costResource},
 		}
 
-		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(&paymentResourceRest)
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(providerID, ShouldBeEmpty)
 		So(statusResponse.Status, ShouldEqual, "failed")
@@ -128,7 +191,7 @@ func TestUnitCheckProvider(t *testing.T) {
 			Costs: []models.CostResourceRest{costResource},
 		}
 
-		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(&paymentResourceRest)
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
 		So(responseType.String(), ShouldEqual, Success.String())
 		So(providerID, ShouldBeEmpty)
 		So(statusResponse.Status, ShouldEqual, "cancelled")
@@ -155,7 +218,7 @@ func TestUnitCheckProvider(t *testing.T) {
 			Costs: []models.CostResourceRest{costResource},
 		}
 
-		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(&paymentResourceRest)
+		statusResponse, providerID, responseType, err := mockGovPayService.CheckPaymentProviderStatus(context.Background(), &paymentResourceRest)
 		So(responseType.String(), ShouldEqual, Created.String())
 		So(providerID, ShouldEqual, "abc123")
 		So(statusResponse.Status, ShouldEqual, "paid")
@@ -226,7 +289,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 		So(govPayResponse, ShouldEqual, "")
 		So(responseType.String(), ShouldEqual, InvalidData.String())
-		So(err.Error(), ShouldEqual, "error adding GovPay headers: [payment class [invalid] not recognised]")
+		So(err.Error(), ShouldEqual, "error getting GovPay account: [payment class [invalid] not recognised]")
 	})
 
 	Convey("Error sending request to GovPay", t, func() {
@@ -305,7 +368,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Error storing ExternalPaymentStatusURI", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("error"))
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -336,7 +399,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Valid request to GovPay and returned NextURL for penalty", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -369,7 +432,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Valid request to GovPay and returned NextURL for late filing penalty", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -402,7 +465,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Valid request to GovPay and returned NextURL for orderable-item", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -435,7 +498,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Valid request to GovPay and returned NextURL for data maintenance", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -468,7 +531,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Valid request to GovPay and returned NextURL for sanctions penalty", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -501,7 +564,7 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 
 	Convey("Valid request to GovPay and returned NextURL for legacy service", t, func() {
 
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -532,6 +595,125 @@ func TestUnitGenerateNextURLGovPay(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 
+	Convey("Description built from the template for the class of payment", t, func() {
+		templateCfg := *cfg
+		templateCfg.GovPayDescriptionTemplatesJSON = `{"penalty-lfp":"Late filing penalty {{.Reference}} for company {{.CompanyNumber}}"}`
+		So(templateCfg.Parse(), ShouldBeNil)
+		templatePaymentService := createMockPaymentService(mock, &templateCfg)
+		templateGovPayService := CreateMockGovPayService(&templatePaymentService)
+
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		var govPayRequest models.OutgoingGovPayRequest
+		httpmock.RegisterResponder("POST", cfg.GovPayURL, func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&govPayRequest); err != nil {
+				return nil, err
+			}
+			return httpmock.NewJsonResponse(http.StatusCreated, models.IncomingGovPayResponse{})
+		})
+
+		paymentResource := models.PaymentResourceRest{
+			Amount:        "250",
+			Reference:     "A0000001",
+			CompanyNumber: "00006400",
+			Costs: []models.CostResourceRest{
+				{ClassOfPayment: []string{"penalty-lfp"}, ProductType: "late-filing-penalty"},
+				{ClassOfPayment: []string{"penalty-lfp"}, ProductType: "late-filing-penalty-interest"},
+			},
+		}
+
+		req := httptest.NewRequest("", "/test", nil)
+		_, responseType, err := templateGovPayService.CreatePaymentAndGenerateNextURL(req, &paymentResource)
+
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(govPayRequest.Description, ShouldEqual, "Late filing penalty A0000001 for company 00006400")
+		So(govPayRequest.Metadata, ShouldResemble, models.Metadata{
+			"company_number":      "00006400",
+			"product_information": "late-filing-penalty,late-filing-penalty-interest",
+			"product_type_1":      "late-filing-penalty",
+			"product_type_2":      "late-filing-penalty-interest",
+		})
+	})
+
+	Convey("Welsh journeys are taken in Welsh with the Welsh description", t, func() {
+		templateCfg := *cfg
+		templateCfg.GovPayDescriptionTemplatesJSON = `{"penalty-lfp":"Late filing penalty {{.Reference}}","penalty-lfp.cy":"Cosb am ffeilio'n hwyr {{.Reference}}"}`
+		So(templateCfg.Parse(), ShouldBeNil)
+		templatePaymentService := createMockPaymentService(mock, &templateCfg)
+		templateGovPayService := CreateMockGovPayService(&templatePaymentService)
+
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		var govPayRequest models.OutgoingGovPayRequest
+		httpmock.RegisterResponder("POST", cfg.GovPayURL, func(req *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(req.Body).Decode(&govPayRequest); err != nil {
+				return nil, err
+			}
+			return httpmock.NewJsonResponse(http.StatusCreated, models.IncomingGovPayResponse{})
+		})
+
+		paymentResource := models.PaymentResourceRest{
+			Amount:    "250",
+			Reference: "A0000001",
+			Language:  "cy",
+			Costs:     []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+		}
+
+		req := httptest.NewRequest("", "/test", nil)
+		_, responseType, err := templateGovPayService.CreatePaymentAndGenerateNextURL(req, &paymentResource)
+
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(govPayRequest.Language, ShouldEqual, "cy")
+		So(govPayRequest.Description, ShouldEqual, "Cosb am ffeilio'n hwyr A0000001")
+	})
+
+	Convey("Error building description from template", t, func() {
+		templateCfg := *cfg
+		templateCfg.GovPayDescriptionTemplatesJSON = `{"penalty-lfp":"{{.Reference.Missing}}"}`
+		So(templateCfg.Parse(), ShouldBeNil)
+		templatePaymentService := createMockPaymentService(mock, &templateCfg)
+		templateGovPayService := CreateMockGovPayService(&templatePaymentService)
+
+		paymentResource := models.PaymentResourceRest{
+			Amount: "250",
+			Costs:  []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+		}
+
+		req := httptest.NewRequest("", "/test", nil)
+		_, responseType, err := templateGovPayService.CreatePaymentAndGenerateNextURL(req, &paymentResource)
+
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldStartWith, "error building GovPay description for class of payment [penalty-lfp]")
+	})
+}
+
+func TestUnitGovPayMetadata(t *testing.T) {
+	Convey("Product types are given their own keys within GOV.UK Pay's limits", t, func() {
+		var costs []models.CostResourceRest
+		for i := 0; i < 12; i++ {
+			costs = append(costs, models.CostResourceRest{ProductType: strings.Repeat("p", 60)})
+		}
+
+		metadata := govPayMetadata(&models.PaymentResourceRest{CompanyNumber: "00006400", Costs: costs})
+
+		So(metadata, ShouldHaveLength, maxGovPayMetadataKeys)
+		So(metadata["company_number"], ShouldEqual, "00006400")
+		So(metadata["product_information"], ShouldHaveLength, maxGovPayMetadataValueLength)
+		So(metadata, ShouldContainKey, "product_type_8")
+		So(metadata, ShouldNotContainKey, "product_type_9")
+	})
+
+	Convey("Long values are truncated", t, func() {
+		metadata := govPayMetadata(&models.PaymentResourceRest{Costs: []models.CostResourceRest{{ProductType: strings.Repeat("é", 150)}}})
+
+		So([]rune(metadata["product_type_1"]), ShouldHaveLength, maxGovPayMetadataValueLength)
+	})
 }
 
 func TestUnitGetGovPayPaymentDetails(t *testing.T) {
@@ -559,7 +741,7 @@ func TestUnitGetGovPayPaymentDetails(t *testing.T) {
 			},
 			Costs: []models.CostResourceRest{costResource},
 		}
-		govPayResponse, responseType, err := mockGovPayService.GetPaymentDetails(&paymentResourceRest)
+		govPayResponse, responseType, err := mockGovPayService.GetPaymentDetails(context.Background(), &paymentResourceRest)
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(govPayResponse, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "error sending request to GovPay: [Get \"external_uri\": error]")
@@ -585,7 +767,7 @@ func TestUnitGetGovPayPaymentDetails(t *testing.T) {
 			},
 			Costs: []models.CostResourceRest{costResource},
 		}
-		govPayResponse, responseType, err := mockGovPayService.GetPaymentDetails(&paymentResource)
+		govPayResponse, responseType, err := mockGovPayService.GetPaymentDetails(context.Background(), &paymentResource)
 
 		So(responseType.String(), ShouldEqual, Success.String())
 		So(govPayResponse, ShouldResemble, &govPayPaymentDetails)
@@ -609,7 +791,7 @@ func TestUnitGetPaymentStatus(t *testing.T) {
 			},
 		}
 
-		_, _, _, err := mockGovPayService.GetPaymentStatus(&payment)
+		_, _, _, err := mockGovPayService.GetPaymentStatus(context.Background(), &payment)
 		So(err.Error(), ShouldEqual, "gov pay URL not defined")
 	})
 
@@ -637,7 +819,7 @@ func TestUnitGetPaymentStatus(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, incomingGovPayResponse)
 		httpmock.RegisterResponder("GET", "external_uri", jsonResponse)
 
-		finished, status, id, err := mockGovPayService.GetPaymentStatus(&payment)
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), &payment)
 		So(finished, ShouldBeFalse)
 		So(status, ShouldEqual, "in-progress")
 		So(id, ShouldBeEmpty)
@@ -669,7 +851,7 @@ func TestUnitGetPaymentStatus(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, incomingGovPayResponse)
 		httpmock.RegisterResponder("GET", "external_uri", jsonResponse)
 
-		finished, status, id, err := mockGovPayService.GetPaymentStatus(&payment)
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), &payment)
 		So(finished, ShouldBeTrue)
 		So(status, ShouldEqual, "failed_payment-expired")
 		So(id, ShouldBeEmpty)
@@ -701,7 +883,7 @@ func TestUnitGetPaymentStatus(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, incomingGovPayResponse)
 		httpmock.RegisterResponder("GET", "external_uri", jsonResponse)
 
-		finished, status, id, err := mockGovPayService.GetPaymentStatus(&payment)
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), &payment)
 		So(finished, ShouldBeTrue)
 		So(status, ShouldEqual, "paid")
 		So(id, ShouldEqual, "id123")
@@ -732,12 +914,225 @@ func TestUnitGetPaymentStatus(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, incomingGovPayResponse)
 		httpmock.RegisterResponder("GET", "external_uri", jsonResponse)
 
-		finished, status, id, err := mockGovPayService.GetPaymentStatus(&payment)
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), &payment)
 		So(finished, ShouldBeTrue)
 		So(status, ShouldEqual, "other")
 		So(id, ShouldBeEmpty)
 		So(err, ShouldBeNil)
 	})
+
+	attemptsPayment := func(attempts ...models.ExternalPaymentAttempt) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{
+				ExternalPaymentStatusURI: attempts[len(attempts)-1].ExternalPaymentStatusURI,
+				ExternalPaymentAttempts:  attempts,
+			},
+			Costs: []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}},
+		}
+	}
+	registerState := func(uri string, state models.State) {
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: state, ProviderID: uri + "_provider_id"})
+		httpmock.RegisterResponder("GET", uri, jsonResponse)
+	}
+
+	Convey("Earlier attempt paid", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("earlier_uri", models.State{Finished: true, Status: "success"})
+		registerState("latest_uri", models.State{Finished: false, Status: "started"})
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeTrue)
+		So(status, ShouldEqual, "paid")
+		So(id, ShouldEqual, "earlier_uri_provider_id")
+		So(payment.MetaData.ExternalPaymentStatusURI, ShouldEqual, "earlier_uri")
+	})
+
+	Convey("Earlier attempt not finished", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("earlier_uri", models.State{Finished: false, Status: "submitted"})
+		registerState("latest_uri", models.State{Finished: true, Status: "failed", Code: "P0030"})
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, _, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeFalse)
+		So(status, ShouldEqual, "submitted")
+	})
+
+	Convey("Every attempt finished", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("earlier_uri", models.State{Finished: true, Status: "failed", Code: "P0020"})
+		registerState("latest_uri", models.State{Finished: true, Status: "failed", Code: "P0030"})
+		mock.EXPECT().SetExternalPaymentAttemptOutcome(gomock.Any(), "", "earlier_uri", "finished").Return(true, nil)
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, _, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeTrue)
+		So(status, ShouldEqual, "failed_payment-cancelled-by-user")
+	})
+
+	Convey("Latest attempt made with PayPal", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("earlier_uri", models.State{Finished: true, Status: "failed", Code: "P0030"})
+		mock.EXPECT().SetExternalPaymentAttemptOutcome(gomock.Any(), "", "earlier_uri", "finished").Return(true, nil)
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "PayPal", ExternalPaymentStatusURI: "paypal_uri"},
+		)
+
+		finished, status, _, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeFalse)
+		So(status, ShouldEqual, "in-progress")
+	})
+
+	Convey("Earlier attempt already known to have finished isn't checked again", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("latest_uri", models.State{Finished: true, Status: "failed", Code: "P0030"})
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri", Outcome: "finished"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, _, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeTrue)
+		So(status, ShouldEqual, "failed_payment-cancelled-by-user")
+		So(httpmock.GetCallCountInfo()["GET earlier_uri"], ShouldEqual, 0)
+	})
+
+	Convey("Several attempts paid", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("first_uri", models.State{Finished: true, Status: "success"})
+		registerState("second_uri", models.State{Finished: true, Status: "success"})
+		registerState("latest_uri", models.State{Finished: false, Status: "started"})
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "first_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "second_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeTrue)
+		So(status, ShouldEqual, "paid")
+		So(id, ShouldEqual, "second_uri_provider_id")
+		So(payment.MetaData.ExternalPaymentStatusURI, ShouldEqual, "second_uri")
+		So(payment.MetaData.ExternalPaymentAttempts[0].Outcome, ShouldEqual, "refund-required")
+		So(payment.MetaData.ExternalPaymentAttempts[1].Outcome, ShouldBeEmpty)
+	})
+
+	Convey("Latest and earlier attempts paid", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerState("earlier_uri", models.State{Finished: true, Status: "success"})
+		registerState("latest_uri", models.State{Finished: true, Status: "success"})
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeTrue)
+		So(status, ShouldEqual, "paid")
+		So(id, ShouldEqual, "latest_uri_provider_id")
+		So(payment.MetaData.ExternalPaymentStatusURI, ShouldEqual, "latest_uri")
+		So(payment.MetaData.ExternalPaymentAttempts[0].Outcome, ShouldEqual, "refund-required")
+	})
+
+	Convey("Error checking earlier attempts of a paid session", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		httpmock.RegisterResponder("GET", "earlier_uri", httpmock.NewErrorResponder(errors.New("error")))
+		registerState("latest_uri", models.State{Finished: true, Status: "success"})
+
+		payment := attemptsPayment(
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "earlier_uri"},
+			models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "latest_uri"},
+		)
+
+		finished, status, id, err := mockGovPayService.GetPaymentStatus(context.Background(), payment)
+		So(err, ShouldBeNil)
+		So(finished, ShouldBeTrue)
+		So(status, ShouldEqual, "paid")
+		So(id, ShouldEqual, "latest_uri_provider_id")
+	})
+}
+
+func TestUnitGetUsableNextURLGovPay(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	mock := dao.NewMockDAO(mockCtrl)
+	mockPaymentService := createMockPaymentService(mock, cfg)
+	mockGovPayService := CreateMockGovPayService(&mockPaymentService)
+
+	payment := &models.PaymentResourceRest{Costs: []models.CostResourceRest{{ClassOfPayment: []string{"penalty-lfp"}}}}
+	attempt := models.ExternalPaymentAttempt{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "external_uri"}
+
+	registerResponse := func(state models.State) {
+		jsonResponse, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{
+			State:       state,
+			GovPayLinks: models.GovPayLinks{NextURL: models.NextURL{HREF: "https://card.payments.service.gov.uk/secure/abc"}},
+		})
+		httpmock.RegisterResponder("GET", "external_uri", jsonResponse)
+	}
+
+	Convey("Payment not yet started", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerResponse(models.State{Status: "created"})
+
+		nextURL, err := mockGovPayService.GetUsableNextURL(context.Background(), payment, attempt)
+		So(err, ShouldBeNil)
+		So(nextURL, ShouldEqual, "https://card.payments.service.gov.uk/secure/abc")
+	})
+
+	Convey("Payment started", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		registerResponse(models.State{Status: "started"})
+
+		nextURL, err := mockGovPayService.GetUsableNextURL(context.Background(), payment, attempt)
+		So(err, ShouldBeNil)
+		So(nextURL, ShouldBeEmpty)
+	})
+
+	Convey("Error calling GovPay", t, func() {
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		httpmock.RegisterResponder("GET", "external_uri", httpmock.NewErrorResponder(errors.New("error")))
+
+		nextURL, err := mockGovPayService.GetUsableNextURL(context.Background(), payment, attempt)
+		So(err, ShouldNotBeNil)
+		So(nextURL, ShouldBeEmpty)
+	})
 }
 
 func TestUnitGetGovPayRefundSummary(t *testing.T) {
@@ -752,7 +1147,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(id).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), id).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
 
 		paymentResource, refundSummary, responseType, err := mockGovPayService.GetRefundSummary(req, id)
 
@@ -766,7 +1161,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(id).Return(nil, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), id).Return(nil, nil)
 
 		paymentResource, refundSummary, responseType, err := mockGovPayService.GetRefundSummary(req, id)
 
@@ -780,7 +1175,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -803,7 +1198,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -833,7 +1228,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -863,7 +1258,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -893,7 +1288,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -925,7 +1320,7 @@ func TestUnitGetGovPayRefundSummary(t *testing.T) {
 		req := httptest.NewRequest("", "/test", nil)
 		id := "123"
 
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -981,7 +1376,7 @@ func TestUnitGovPayCreateRefund(t *testing.T) {
 
 		httpmock.RegisterResponder("POST", "http://external_uri/refunds", httpmock.NewErrorResponder(fmt.Errorf("error")))
 
-		govPayRefundResponse, responseType, err := mockGovPayService.CreateRefund(paymentResource, refundRequest)
+		govPayRefundResponse, responseType, err := mockGovPayService.CreateRefund(context.Background(), paymentResource, refundRequest)
 
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(paymentResource, ShouldNotBeNil)
@@ -1009,7 +1404,7 @@ func TestUnitGovPayCreateRefund(t *testing.T) {
 
 		httpmock.RegisterResponder("POST", "http://external_uri/refunds", httpmock.NewErrorResponder(fmt.Errorf("error")))
 
-		govPayRefundResponse, responseType, err := mockGovPayService.CreateRefund(paymentResource, refundRequest)
+		govPayRefundResponse, responseType, err := mockGovPayService.CreateRefund(context.Background(), paymentResource, refundRequest)
 
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(paymentResource, ShouldNotBeNil)
@@ -1039,7 +1434,7 @@ func TestUnitGovPayCreateRefund(t *testing.T) {
 
 		httpmock.RegisterResponder("POST", "http://external_uri/refunds", jsonResponse)
 
-		govPayRefundResponse, responseType, err := mockGovPayService.CreateRefund(paymentResource, refundRequest)
+		govPayRefundResponse, responseType, err := mockGovPayService.CreateRefund(context.Background(), paymentResource, refundRequest)
 
 		So(responseType.String(), ShouldEqual, Success.String())
 		So(govPayRefundResponse.Status, ShouldEqual, gpResponse.Status)
@@ -1076,7 +1471,7 @@ func TestUnitGetGovPayRefundStatus(t *testing.T) {
 
 		httpmock.RegisterResponder("GET", "http://external_uri/refunds/321", httpmock.NewErrorResponder(fmt.Errorf("error")))
 
-		govPayStatusResponse, responseType, err := mockGovPayService.GetRefundStatus(paymentResource, refundId)
+		govPayStatusResponse, responseType, err := mockGovPayService.GetRefundStatus(context.Background(), paymentResource, refundId)
 
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(paymentResource, ShouldNotBeNil)
@@ -1103,7 +1498,7 @@ func TestUnitGetGovPayRefundStatus(t *testing.T) {
 
 		httpmock.RegisterResponder("GET", "http://external_uri/refunds/321", httpmock.NewErrorResponder(fmt.Errorf("error")))
 
-		govPayStatusResponse, responseType, err := mockGovPayService.GetRefundStatus(paymentResource, refundId)
+		govPayStatusResponse, responseType, err := mockGovPayService.GetRefundStatus(context.Background(), paymentResource, refundId)
 
 		So(responseType.String(), ShouldEqual, Error.String())
 		So(paymentResource, ShouldNotBeNil)
@@ -1132,7 +1527,7 @@ func TestUnitGetGovPayRefundStatus(t *testing.T) {
 
 		httpmock.RegisterResponder("GET", "http://external_uri/refunds/321", jsonResponse)
 
-		govPayStatusResponse, responseType, err := mockGovPayService.GetRefundStatus(paymentResource, refundID)
+		govPayStatusResponse, responseType, err := mockGovPayService.GetRefundStatus(context.Background(), paymentResource, refundID)
 
 		So(responseType.String(), ShouldEqual, Success.String())
 		So(govPayStatusResponse.Status, ShouldEqual, gpResponse.Status)
@@ -1160,7 +1555,7 @@ func TestUnitCallToGovPay(t *testing.T) {
 				ExternalPaymentStatusURI: "",
 			},
 		}
-		response, err := callGovPay(nil, resource)
+		response, err := callGovPay(context.Background(), nil, resource)
 		So(response, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "gov pay URL not defined")
 	})
@@ -1171,7 +1566,7 @@ func TestUnitCallToGovPay(t *testing.T) {
 				ExternalPaymentStatusURI: "\n",
 			},
 		}
-		response, err := callGovPay(nil, resource)
+		response, err := callGovPay(context.Background(), nil, resource)
 		So(response, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "error generating request for GovPay: [parse "+`"\n"`+": net/url: invalid control character in URL]")
 	})
@@ -1190,7 +1585,7 @@ func TestUnitCallToGovPay(t *testing.T) {
 		mockPaymentService := createMockPaymentService(mock, cfg)
 		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
 
-		response, err := callGovPay(&mockGovPayService, resource)
+		response, err := callGovPay(context.Background(), &mockGovPayService, resource)
 		So(response, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "error adding GovPay headers: [payment class [invalid] not recognised]")
 	})
@@ -1217,7 +1612,7 @@ func TestUnitCallToGovPay(t *testing.T) {
 		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
 		mockGovPayService.PaymentService.Config.GovPayBearerTokenChAccount = "api_test_chs"
 
-		response, err := callGovPay(&mockGovPayService, resource)
+		response, err := callGovPay(context.Background(), &mockGovPayService, resource)
 		So(response.PaymentID, ShouldEqual, "1234")
 		So(err, ShouldBeNil)
 	})
@@ -1244,7 +1639,7 @@ func TestUnitCallToGovPay(t *testing.T) {
 		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
 		mockGovPayService.PaymentService.Config.GovPayBearerTokenLegacy = "api_test_legacy"
 
-		response, err := callGovPay(&mockGovPayService, resource)
+		response, err := callGovPay(context.Background(), &mockGovPayService, resource)
 		So(response.PaymentID, ShouldEqual, "1234")
 		So(err, ShouldBeNil)
 	})
@@ -1271,7 +1666,7 @@ func TestUnitCallToGovPay(t *testing.T) {
 		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
 		mockGovPayService.PaymentService.Config.GovPayBearerTokenTreasury = "api_test_treasury"
 
-		response, err := callGovPay(&mockGovPayService, resource)
+		response, err := callGovPay(context.Background(), &mockGovPayService, resource)
 		So(response.PaymentID, ShouldEqual, "1234")
 		So(err, ShouldBeNil)
 	})
@@ -1298,9 +1693,41 @@ func TestUnitCallToGovPay(t *testing.T) {
 		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
 		mockGovPayService.PaymentService.Config.GovPayBearerTokenSanctionsAccount = "api_test_sanctions"
 
-		response, err := callGovPay(&mockGovPayService, resource)
+		response, err := callGovPay(context.Background(), &mockGovPayService, resource)
+		So(response.PaymentID, ShouldEqual, "1234")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Successful call to GOV.UK Pay account configured by GOV_PAY_ACCOUNTS", t, func() {
+		resource := &models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{
+				ExternalPaymentStatusURI: "external_uri",
+			},
+			Costs: []models.CostResourceRest{
+				{ClassOfPayment: []string{"penalty-new"}},
+			},
+		}
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		IncomingGovPayResponse := models.IncomingGovPayResponse{CardBrand: "Visa", PaymentID: "1234"}
+
+		var authorization string
+		httpmock.RegisterResponder("GET", "external_uri", func(req *http.Request) (*http.Response, error) {
+			authorization = req.Header.Get("authorization")
+			return httpmock.NewJsonResponse(http.StatusOK, IncomingGovPayResponse)
+		})
+
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
+		mockGovPayService.PaymentService.Config.GovPayAccountsJSON = `[{"name":"new-penalty","bearer_token":"api_test_new","classes_of_payment":["penalty-new"]}]`
+		So(mockGovPayService.PaymentService.Config.Parse(), ShouldBeNil)
+
+		response, err := callGovPay(context.Background(), &mockGovPayService, resource)
 		So(response.PaymentID, ShouldEqual, "1234")
 		So(err, ShouldBeNil)
+		So(authorization, ShouldEqual, "Bearer api_test_new")
 	})
 }
 
@@ -1315,19 +1742,19 @@ func TestUnitCapturePayments(t *testing.T) {
 		mockGovPayService := CreateMockGovPayService(&mockPaymentService)
 
 		Convey("CapturePayment returns nil", func() {
-			resp, err := mockGovPayService.CapturePayment("id")
+			resp, err := mockGovPayService.CapturePayment(context.Background(), "id")
 			So(resp, ShouldBeNil)
 			So(err, ShouldBeNil)
 		})
 
 		Convey("GetCapturedPaymentDetails returns nil", func() {
-			resp, err := mockGovPayService.GetCapturedPaymentDetails("id")
+			resp, err := mockGovPayService.GetCapturedPaymentDetails(context.Background(), "id")
 			So(resp, ShouldBeNil)
 			So(err, ShouldBeNil)
 		})
 
 		Convey("RefundCapture returns nil", func() {
-			resp, err := mockGovPayService.RefundCapture("id")
+			resp, err := mockGovPayService.RefundCapture(context.Background(), "id")
 			So(resp, ShouldBeNil)
 			So(err, ShouldBeNil)
 		})
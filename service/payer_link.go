@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+)
+
+// PayerLinkKind is the kind of a link letting someone other than its creator pay a payment session
+const PayerLinkKind = "payment-session#payer-link"
+
+// CreatePayerLink issues a link letting someone other than its creator pay a payment session, e.g. an agent's client.
+// The link expires with the session, and replaces any link issued for the session before it.
+func (service *PaymentService) CreatePayerLink(req *http.Request, paymentSession *models.PaymentResourceRest) (*models.PayerLinkRest, ResponseType, error) {
+	if service.Config.PayerLinkSigningKey == "" {
+		return nil, InvalidData, fmt.Errorf("pay-on-behalf links are not enabled")
+	}
+	if IsExpired(*paymentSession, &service.Config) {
+		return nil, InvalidData, fmt.Errorf("payment session has expired")
+	}
+	if paymentSession.Status != Pending.String() && paymentSession.Status != InProgress.String() && !isRetryableFailure(paymentSession.Status) {
+		return nil, InvalidData, fmt.Errorf("payment session with status [%s] can't be paid", paymentSession.Status)
+	}
+
+	// The expiry is signed in whole seconds.
+	payerLink := models.PayerLinkDB{
+		ID:        helpers.GenerateID(),
+		CreatedAt: helpers.MongoNow(),
+		ExpiresAt: ExpiresAt(*paymentSession, &service.Config).Truncate(time.Second),
+	}
+
+	err := service.DAO.SetPayerLink(req.Context(), paymentSession.MetaData.ID, &payerLink)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error saving payer link on database: [%v]", err)
+	}
+
+	token := helpers.GeneratePayerLinkToken([]byte(service.Config.PayerLinkSigningKey), paymentSession.MetaData.ID, payerLink.ID, payerLink.ExpiresAt)
+	query := url.Values{}
+	query.Set(helpers.PayerLinkTokenParam, token)
+
+	log.InfoR(req, "payer link issued for payment session", log.Data{"payment_id": paymentSession.MetaData.ID, "expires_at": payerLink.ExpiresAt})
+
+	return &models.PayerLinkRest{
+		Link:      fmt.Sprintf("%s/payments/%s/pay?%s", service.Config.PaymentsWebURL, paymentSession.MetaData.ID, query.Encode()),
+		CreatedAt: payerLink.CreatedAt,
+		ExpiresAt: payerLink.ExpiresAt,
+		Kind:      PayerLinkKind,
+	}, Success, nil
+}
+
+// RevokePayerLink revokes the link issued to let someone other than its creator pay a payment session, so that it can
+// no longer be used
+func (service *PaymentService) RevokePayerLink(req *http.Request, paymentSession *models.PaymentResourceRest) (ResponseType, error) {
+	payerLink := paymentSession.MetaData.PayerLink
+	if payerLink == nil || !payerLink.RevokedAt.IsZero() {
+		return NotFound, fmt.Errorf("no payer link to revoke for payment session [%s]", paymentSession.MetaData.ID)
+	}
+
+	revoked, err := service.DAO.RevokePayerLink(req.Context(), paymentSession.MetaData.ID, payerLink.ID, helpers.MongoNow())
+	if err != nil {
+		return Error, fmt.Errorf("error revoking payer link on database: [%v]", err)
+	}
+	if !revoked {
+		return NotFound, fmt.Errorf("payer link for payment session [%s] was replaced or revoked", paymentSession.MetaData.ID)
+	}
+
+	log.InfoR(req, "payer link revoked for payment session", log.Data{"payment_id": paymentSession.MetaData.ID})
+
+	return Success, nil
+}
+
+// payerOf returns the user paying the payment session, who is the payer that chose the payment method through a
+// pay-on-behalf link if there is one, or else the creator of the session
+func payerOf(paymentSession *models.PaymentResourceRest) models.CreatedByRest {
+	if paymentSession.PaidBy != nil {
+		return *paymentSession.PaidBy
+	}
+	return paymentSession.CreatedBy
+}
+
+// VerifyPayerLink checks that a payer token was issued with the latest link for the payment session, and that the link
+// hasn't expired or been revoked
+func (service *PaymentService) VerifyPayerLink(paymentSession *models.PaymentResourceRest, token string) error {
+	if service.Config.PayerLinkSigningKey == "" {
+		return fmt.Errorf("pay-on-behalf links are not enabled")
+	}
+
+	linkID, err := helpers.VerifyPayerLinkToken([]byte(service.Config.PayerLinkSigningKey), paymentSession.MetaData.ID, token)
+	if err != nil {
+		return err
+	}
+
+	payerLink := paymentSession.MetaData.PayerLink
+	if payerLink == nil || payerLink.ID != linkID {
+		return fmt.Errorf("payer link has been replaced")
+	}
+	if !payerLink.RevokedAt.IsZero() {
+		return fmt.Errorf("payer link has been revoked")
+	}
+
+	return nil
+}
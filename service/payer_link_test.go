@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testPayerLinkSigningKey = "payer-link-signing-key-of-32-chars"
+
+func TestUnitCreatePayerLink(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	payerLinkCfg := *cfg
+	payerLinkCfg.PayerLinkSigningKey = testPayerLinkSigningKey
+	payerLinkCfg.PaymentsWebURL = "https://payments.companieshouse.gov.uk"
+
+	paymentSession := func(status string) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Status:    status,
+			CreatedAt: time.Now(),
+			MetaData:  models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+	}
+
+	Convey("Pay-on-behalf links not enabled", t, func() {
+		noKeyCfg := *cfg
+		noKeyCfg.PayerLinkSigningKey = ""
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &noKeyCfg)
+
+		payerLink, responseType, err := mockPaymentService.CreatePayerLink(httptest.NewRequest("POST", "/test", nil), paymentSession(InProgress.String()))
+		So(payerLink, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "pay-on-behalf links are not enabled")
+	})
+
+	Convey("Payment session expired", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &payerLinkCfg)
+		session := paymentSession(InProgress.String())
+		session.CreatedAt = time.Now().Add(-24 * time.Hour)
+
+		payerLink, responseType, err := mockPaymentService.CreatePayerLink(httptest.NewRequest("POST", "/test", nil), session)
+		So(payerLink, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "payment session has expired")
+	})
+
+	Convey("Payment session already paid", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &payerLinkCfg)
+
+		payerLink, responseType, err := mockPaymentService.CreatePayerLink(httptest.NewRequest("POST", "/test", nil), paymentSession(Paid.String()))
+		So(payerLink, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "payment session with status [paid] can't be paid")
+	})
+
+	Convey("Error saving payer link", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().SetPayerLink(gomock.Any(), "1234", gomock.Any()).Return(errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, &payerLinkCfg)
+
+		payerLink, responseType, err := mockPaymentService.CreatePayerLink(httptest.NewRequest("POST", "/test", nil), paymentSession(Pending.String()))
+		So(payerLink, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error saving payer link on database: [error]")
+	})
+
+	Convey("Payer link issued, expiring with the session", t, func() {
+		var saved *models.PayerLinkDB
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().SetPayerLink(gomock.Any(), "1234", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, payerLink *models.PayerLinkDB) error {
+			saved = payerLink
+			return nil
+		})
+		mockPaymentService := createMockPaymentService(mock, &payerLinkCfg)
+
+		session := paymentSession(Failed.String())
+		payerLink, responseType, err := mockPaymentService.CreatePayerLink(httptest.NewRequest("POST", "/test", nil), session)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(payerLink.Kind, ShouldEqual, PayerLinkKind)
+		So(payerLink.ExpiresAt, ShouldEqual, ExpiresAt(*session, &payerLinkCfg).Truncate(time.Second))
+		So(saved.ExpiresAt, ShouldEqual, payerLink.ExpiresAt)
+		So(saved.ID, ShouldNotBeEmpty)
+
+		link, err := url.Parse(payerLink.Link)
+		So(err, ShouldBeNil)
+		So(link.Host, ShouldEqual, "payments.companieshouse.gov.uk")
+		So(link.Path, ShouldEqual, "/payments/1234/pay")
+
+		// The token in the link verifies once the link is saved against the session
+		session.MetaData.PayerLink = &models.PayerLink{ID: saved.ID, ExpiresAt: saved.ExpiresAt}
+		So(mockPaymentService.VerifyPayerLink(session, link.Query().Get(helpers.PayerLinkTokenParam)), ShouldBeNil)
+	})
+}
+
+func TestUnitRevokePayerLink(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	paymentSession := func(payerLink *models.PayerLink) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{MetaData: models.PaymentResourceMetaDataRest{ID: "1234", PayerLink: payerLink}}
+	}
+
+	Convey("No payer link issued", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		responseType, err := mockPaymentService.RevokePayerLink(httptest.NewRequest("DELETE", "/test", nil), paymentSession(nil))
+		So(responseType, ShouldEqual, NotFound)
+		So(err.Error(), ShouldEqual, "no payer link to revoke for payment session [1234]")
+	})
+
+	Convey("Payer link already revoked", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
+
+		responseType, err := mockPaymentService.RevokePayerLink(httptest.NewRequest("DELETE", "/test", nil), paymentSession(&models.PayerLink{ID: "link", RevokedAt: time.Now()}))
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Error revoking payer link", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().RevokePayerLink(gomock.Any(), "1234", "link", gomock.Any()).Return(false, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		responseType, err := mockPaymentService.RevokePayerLink(httptest.NewRequest("DELETE", "/test", nil), paymentSession(&models.PayerLink{ID: "link"}))
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error revoking payer link on database: [error]")
+	})
+
+	Convey("Payer link replaced while it was revoked", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().RevokePayerLink(gomock.Any(), "1234", "link", gomock.Any()).Return(false, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		responseType, err := mockPaymentService.RevokePayerLink(httptest.NewRequest("DELETE", "/test", nil), paymentSession(&models.PayerLink{ID: "link"}))
+		So(responseType, ShouldEqual, NotFound)
+		So(err.Error(), ShouldEqual, "payer link for payment session [1234] was replaced or revoked")
+	})
+
+	Convey("Payer link revoked", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().RevokePayerLink(gomock.Any(), "1234", "link", gomock.Any()).Return(true, nil)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		responseType, err := mockPaymentService.RevokePayerLink(httptest.NewRequest("DELETE", "/test", nil), paymentSession(&models.PayerLink{ID: "link"}))
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+	})
+}
+
+func TestUnitVerifyPayerLink(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	payerLinkCfg := *cfg
+	payerLinkCfg.PayerLinkSigningKey = testPayerLinkSigningKey
+	mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &payerLinkCfg)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := helpers.GeneratePayerLinkToken([]byte(testPayerLinkSigningKey), "1234", "link", expiresAt)
+	paymentSession := func(payerLink *models.PayerLink) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{MetaData: models.PaymentResourceMetaDataRest{ID: "1234", PayerLink: payerLink}}
+	}
+
+	Convey("Payer link replaced by a later one", t, func() {
+		err := mockPaymentService.VerifyPayerLink(paymentSession(&models.PayerLink{ID: "later", ExpiresAt: expiresAt}), token)
+		So(err.Error(), ShouldEqual, "payer link has been replaced")
+	})
+
+	Convey("Payer link revoked", t, func() {
+		err := mockPaymentService.VerifyPayerLink(paymentSession(&models.PayerLink{ID: "link", ExpiresAt: expiresAt, RevokedAt: time.Now()}), token)
+		So(err.Error(), ShouldEqual, "payer link has been revoked")
+	})
+
+	Convey("Payer token tampered with", t, func() {
+		err := mockPaymentService.VerifyPayerLink(paymentSession(&models.PayerLink{ID: "link", ExpiresAt: expiresAt}), token+"0")
+		So(err, ShouldEqual, helpers.ErrInvalidPayerLinkToken)
+	})
+
+	Convey("Payer link valid", t, func() {
+		So(mockPaymentService.VerifyPayerLink(paymentSession(&models.PayerLink{ID: "link", ExpiresAt: expiresAt}), token), ShouldBeNil)
+	})
+}
@@ -1,17 +1,16 @@
 package service
 
 import (
-	"crypto/sha512"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,9 +18,13 @@ import (
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 	"github.com/companieshouse/payments.api.ch.gov.uk/transformers"
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -39,6 +42,10 @@ type PaymentStatus int
 // PaymentSessionKind is the value stored in the payment resource kind field
 const PaymentSessionKind = "payment-session#payment-session"
 
+// languageWelsh is the language of payment sessions whose journeys are taken in Welsh. Sessions without a language
+// are taken in English.
+const languageWelsh = "cy"
+
 // Enumeration containing all possible payment statuses
 const (
 	Pending PaymentStatus = 1 + iota
@@ -49,6 +56,9 @@ const (
 	Expired
 	PendingRefund
 	RefundRequested
+	AwaitingTransfer
+	Underpaid
+	Overpaid
 )
 
 // String representation of payment statuses
@@ -61,6 +71,9 @@ var paymentStatuses = [...]string{
 	"expired",
 	"refund-pending",
 	"refund-requested",
+	"awaiting-transfer",
+	"underpaid",
+	"overpaid",
 }
 
 func (paymentStatus PaymentStatus) String() string {
@@ -69,13 +82,23 @@ func (paymentStatus PaymentStatus) String() string {
 
 // CreatePaymentSession creates a payment session and returns a journey URL for the calling app to redirect to
 func (service *PaymentService) CreatePaymentSession(req *http.Request, createResource models.IncomingPaymentResourceRequest) (*models.PaymentResourceRest, ResponseType, error) {
-	log.TraceR(req, "create payment session", log.Data{"create_resource": createResource})
-	err := validateIncomingPayment(createResource, &service.Config)
+	req, span := tracing.StartRequestSpan(req, "PaymentService.CreatePaymentSession")
+	defer span.End()
+
+	// Cardholder details are personal data, so are kept out of the logs
+	loggedResource := createResource
+	loggedResource.PrefilledCardholderDetails = nil
+	log.TraceR(req, "create payment session", log.Data{"create_resource": loggedResource})
+	clientID := helpers.GetClientID(req)
+	err := validateIncomingPayment(createResource, &service.Config, clientID)
 	if err != nil {
-		err = fmt.Errorf("invalid incoming payment: [%v]", err)
+		err = fmt.Errorf("invalid incoming payment: [%w]", err)
 		log.ErrorR(req, err)
 		return nil, InvalidData, err
 	}
+	if isUnconfiguredClient(&service.Config, clientID) {
+		log.InfoR(req, "payment session created by a calling service missing from CLIENTS, so its redirect won't be signed", log.Data{"client_id": clientID})
+	}
 
 	// Get user details from context, put there by UserAuthenticationInterceptor
 	userDetails, ok := req.Context().Value(authentication.ContextKeyUserDetails).(authentication.AuthUserDetails)
@@ -85,12 +108,14 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 		return nil, Error, err
 	}
 
-	costs, costsResponseType, err := getCosts(createResource.Resource, &service.Config, service.SecureCostsRegex)
+	resources := incomingResources(createResource)
+	basketCosts, costsResponseType, err := service.getBasketCosts(req.Context(), resources)
 	if err != nil {
 		err = fmt.Errorf("error getting payment resource: [%v]", err)
 		log.ErrorR(req, err)
 		return nil, costsResponseType, err
 	}
+	costs := combineCosts(resources, basketCosts)
 
 	totalAmount, err := getTotalAmount(&costs.Costs)
 	if err != nil {
@@ -99,6 +124,39 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 		return nil, Error, err
 	}
 
+	err = validateGovPayAccounts(&costs.Costs, &service.Config)
+	if err != nil {
+		err = fmt.Errorf("invalid class of payment: [%v]", err)
+		log.ErrorR(req, err)
+		return nil, InvalidData, err
+	}
+
+	// The costs of a single resource are checked to share a class of payment when its journey is created, while those
+	// of a basket must share one to be paid together at all
+	if len(resources) > 1 {
+		err = validateClassOfPayment(&costs.Costs)
+		if err != nil {
+			err = fmt.Errorf("invalid class of payment: [%v]", err)
+			log.ErrorR(req, err)
+			return nil, InvalidData, err
+		}
+	}
+
+	expiryTimeInMinutes, err := service.sessionExpiryTime(createResource, costs)
+	if err != nil {
+		err = fmt.Errorf("invalid expiry time: [%v]", err)
+		log.ErrorR(req, err)
+		return nil, InvalidData, err
+	}
+
+	for i, resource := range resources {
+		responseType, err := service.checkForDuplicatePayment(req.Context(), resource, basketCosts[i])
+		if err != nil {
+			log.ErrorR(req, err)
+			return nil, responseType, err
+		}
+	}
+
 	//  Create payment session REST data from writable input fields and decorating with read only fields
 	paymentResourceRest := models.PaymentResourceRest{}
 	paymentResourceRest.CreatedBy = models.CreatedByRest{
@@ -111,8 +169,8 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 	paymentResourceRest.Description = costs.Description
 	paymentResourceRest.CompanyNumber = costs.CompanyNumber
 	paymentResourceRest.Amount = totalAmount
-	// To match the format time is saved to mongo, e.g. "2018-11-22T08:39:16.782Z", truncate the time
-	paymentResourceRest.CreatedAt = time.Now().Truncate(time.Millisecond)
+	paymentResourceRest.CreatedAt = helpers.MongoNow()
+	paymentResourceRest.ExpiresAt = paymentResourceRest.CreatedAt.Add(time.Minute * time.Duration(expiryTimeInMinutes))
 
 	paymentMethods := make(map[string]bool)
 	for _, c := range costs.Costs {
@@ -125,10 +183,13 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 	}
 
 	paymentResourceRest.Reference = createResource.Reference
+	paymentResourceRest.Language = createResource.Language
+	// Stored only until the external payment journey is created, as that is when they are passed on to GOV.UK Pay
+	paymentResourceRest.MetaData.PrefilledCardholderDetails = createResource.PrefilledCardholderDetails
 	paymentResourceRest.Status = Pending.String()
 	paymentResourceRest.Kind = PaymentSessionKind
-	paymentResourceRest.Etag = generateEtag()
-	paymentResourceID := generateID()
+	paymentResourceRest.Etag = helpers.GenerateEtag()
+	paymentResourceID := helpers.GenerateID()
 
 	journeyURL := service.Config.PaymentsWebURL + "/payments/" + paymentResourceID + "/pay"
 
@@ -137,11 +198,23 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 		journeyURL += "/api-key"
 	}
 
+	// Nothing is owed on a session whose total is zero, e.g. a fee exempt filing, so it is completed without going to a
+	// payment provider once it is created, and its journey returns the user straight to the calling service
+	noPaymentRequired := totalAmount == noPaymentAmount
+	if noPaymentRequired {
+		paymentResourceRest.Status = InProgress.String()
+		paymentResourceRest.PaymentMethod = PaymentMethodNoPaymentRequired
+		journeyURL = noPaymentRequiredJourneyURL(&service.Config, paymentResourceID)
+	}
+
 	paymentResourceRest.Links = models.PaymentLinksRest{
 		Journey:  journeyURL,
-		Resource: createResource.Resource,
+		Resource: resources[0],
 		Self:     fmt.Sprintf("payments/%s", paymentResourceID),
 	}
+	if len(resources) > 1 {
+		paymentResourceRest.Links.Resources = resources
+	}
 
 	// transform the complete REST model to a DB model before writing to the DB
 	paymentResourceEntity := transformers.PaymentTransformer{}.TransformToDB(paymentResourceRest)
@@ -150,8 +223,9 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 	paymentResourceEntity.ID = paymentResourceID
 	paymentResourceEntity.State = createResource.State
 	paymentResourceEntity.RedirectURI = createResource.RedirectURI
+	paymentResourceEntity.ClientID = clientID
 
-	err = service.DAO.CreatePaymentResource(&paymentResourceEntity)
+	err = service.DAO.CreatePaymentResource(req.Context(), &paymentResourceEntity)
 
 	if err != nil {
 		err = fmt.Errorf("error writing to DB: %v", err)
@@ -159,13 +233,108 @@ func (service *PaymentService) CreatePaymentSession(req *http.Request, createRes
 		return nil, Error, err
 	}
 
+	// The links contain the ID, which is regenerated if the first one was already taken
+	paymentResourceRest.Links = models.PaymentLinksRest(paymentResourceEntity.Data.Links)
+	paymentResourceRest.MetaData.ID = paymentResourceEntity.ID
+
+	metrics.SessionCreated(getClassOfPayment(paymentResourceRest.Costs))
+	// The session has been created, so should it not be completed now it is returned in progress, to be completed by its
+	// journey or a PATCH
+	if noPaymentRequired {
+		completingSession := paymentResourceRest
+		completed, _, err := service.CompleteNoPaymentRequiredSession(req, &completingSession)
+		if err != nil {
+			log.ErrorR(req, fmt.Errorf("error completing payment session with nothing to pay, leaving it in progress: [%v]", err), log.Data{"payment_id": paymentResourceRest.MetaData.ID})
+		} else if completed {
+			paymentResourceRest = completingSession
+		}
+	}
+
 	return &paymentResourceRest, Success, nil
 }
 
+// DuplicatePaymentError is returned when a payment session is created for a cost resource which has already been paid,
+// or which has another session part way through an external payment journey. Links are those of the existing session,
+// when there is one, so that the caller can resume it rather than paying twice.
+type DuplicatePaymentError struct {
+	Resource string
+	Status   string
+	Links    *models.PaymentLinksRest
+}
+
+func (e *DuplicatePaymentError) Error() string {
+	if e.Links == nil {
+		return fmt.Sprintf("cost resource [%s] has already been paid", e.Resource)
+	}
+	return fmt.Sprintf("cost resource [%s] already has payment session [%s] with status [%s]", e.Resource, e.Links.Self, e.Status)
+}
+
+// checkForDuplicatePayment returns a DuplicatePaymentError if the cost resource reports that it has been paid, or if
+// another session for it is paid or has a live external payment journey
+func (service *PaymentService) checkForDuplicatePayment(ctx context.Context, resource string, costs *models.CostsRest) (ResponseType, error) {
+	sessions, err := service.DAO.GetPaymentResourcesByResource(ctx, resource, []string{
+		Paid.String(), InProgress.String(), AwaitingTransfer.String(), Underpaid.String(), Overpaid.String(),
+	})
+	if err != nil {
+		return Error, fmt.Errorf("error getting existing payment sessions for resource: [%v]", err)
+	}
+
+	now := time.Now()
+	var paidSession, liveSession *models.PaymentResourceDB
+	for i, session := range sessions {
+		if IsPaidStatus(session.Data.Status) && paidSession == nil {
+			paidSession = &sessions[i]
+		}
+		if session.Data.Status == InProgress.String() && liveSession == nil && hasLiveExternalJourney(session, &service.Config) {
+			liveSession = &sessions[i]
+		}
+		// A session awaiting a bank transfer stays live until the transfer arrives, or the session expires without it
+		if slices.Contains(awaitingTransferStatuses, session.Data.Status) && liveSession == nil && now.Before(expiresAt(session.Data.CreatedAt, session.Data.ExpiresAt, &service.Config)) {
+			liveSession = &sessions[i]
+		}
+	}
+
+	switch {
+	case paidSession != nil:
+		return Conflict, newDuplicatePaymentError(resource, paidSession)
+	case costs.Status == Paid.String():
+		return Conflict, &DuplicatePaymentError{Resource: resource, Status: Paid.String()}
+	case liveSession != nil:
+		return Conflict, newDuplicatePaymentError(resource, liveSession)
+	}
+	return Success, nil
+}
+
+func newDuplicatePaymentError(resource string, session *models.PaymentResourceDB) *DuplicatePaymentError {
+	links := models.PaymentLinksRest(session.Data.Links)
+	return &DuplicatePaymentError{Resource: resource, Status: session.Data.Status, Links: &links}
+}
+
+// hasLiveExternalJourney reports whether the session has an external payment journey which can still be completed,
+// which is until either the session or the GOV.UK Pay journey of its latest attempt expires
+func hasLiveExternalJourney(session models.PaymentResourceDB, cfg *config.Config) bool {
+	if session.ExternalPaymentStatusURI == "" {
+		return false
+	}
+	// Journeys created before attempts were recorded can only be dated by the session
+	journeyCreatedAt := session.Data.CreatedAt
+	if len(session.ExternalPaymentAttempts) != 0 {
+		journeyCreatedAt = session.ExternalPaymentAttempts[len(session.ExternalPaymentAttempts)-1].CreatedAt
+	}
+	now := time.Now()
+	return now.Before(expiresAt(session.Data.CreatedAt, session.Data.ExpiresAt, cfg)) &&
+		now.Before(journeyCreatedAt.Add(time.Minute*time.Duration(cfg.GovPayExpiryTime)))
+}
+
 // PatchPaymentSession updates an existing payment session with the data provided from the Rest model
 func (service *PaymentService) PatchPaymentSession(req *http.Request, id string, paymentResourceUpdateRest models.PaymentResourceRest) (ResponseType, error) {
+	req, span := tracing.StartRequestSpan(req, "PaymentService.PatchPaymentSession", attribute.String("payment.id", id))
+	defer span.End()
+
 	PaymentResourceUpdate := transformers.PaymentTransformer{}.TransformToDB(paymentResourceUpdateRest)
-	PaymentResourceUpdate.Data.Etag = generateEtag()
+	PaymentResourceUpdate.Data.Etag = helpers.GenerateEtag()
+	// The expiry is only moved by extending the session, so the one read with the session isn't written back over it
+	PaymentResourceUpdate.Data.ExpiresAt = time.Time{}
 
 	paymentSession, response, err := service.GetPaymentSession(req, id)
 	if err != nil {
@@ -177,32 +346,230 @@ func (service *PaymentService) PatchPaymentSession(req *http.Request, id string,
 		PaymentResourceUpdate.Data.Status = InProgress.String()
 	}
 
-	err = service.DAO.PatchPaymentResource(id, &PaymentResourceUpdate)
+	// A session whose last attempt failed in a way the user can recover from can be updated, e.g. with another payment
+	// method to try again with, while it is still awaiting a retry. It stays failed until the new attempt is made. An
+	// update expiring the session is made as is.
+	if isRetryableFailure(paymentSession.Status) && PaymentResourceUpdate.Data.Status != Expired.String() {
+		responseType, err := service.updateFailedPaymentSession(req.Context(), id, &PaymentResourceUpdate)
+		if err != nil {
+			return responseType, err
+		}
+	} else {
+		err = service.DAO.PatchPaymentResource(req.Context(), id, &PaymentResourceUpdate)
+		if err != nil {
+			err = fmt.Errorf("error patching payment session on database: [%v]", err)
+			log.Error(err)
+			return Error, err
+		}
+	}
+
+	if PaymentResourceUpdate.Data.Status != "" && PaymentResourceUpdate.Data.Status != paymentSession.Status {
+		paymentMethod := PaymentResourceUpdate.Data.PaymentMethod
+		if paymentMethod == "" {
+			paymentMethod = paymentSession.PaymentMethod
+		}
+		metrics.SessionStatusChanged(PaymentResourceUpdate.Data.Status, paymentMethod, getClassOfPayment(paymentSession.Costs))
+	}
+
+	return Success, nil
+}
+
+// updateFailedPaymentSession updates a payment session whose last attempt failed, e.g. with a new attempt and the status
+// it leaves the session in. The session is only reopened by the update that records the new attempt, once the attempt
+// has been made. The update is only made if the session is still awaiting a retry, so that a late outcome for the failed
+// attempt, e.g. a payment made in another browser tab, isn't overwritten.
+func (service *PaymentService) updateFailedPaymentSession(ctx context.Context, id string, paymentResourceUpdate *models.PaymentResourceDB) (ResponseType, error) {
+	reopened, err := service.DAO.ReopenPaymentResource(ctx, id, retryableStatuses, paymentResourceUpdate)
 	if err != nil {
-		err = fmt.Errorf("error patching payment session on database: [%v]", err)
-		log.Error(err)
-		return Error, err
+		return Error, fmt.Errorf("error reopening payment session on database: [%v]", err)
+	}
+	if !reopened {
+		return Conflict, fmt.Errorf("payment session is no longer awaiting a retry")
+	}
+
+	if paymentResourceUpdate.Data.Status != "" {
+		log.Info("reopened payment session after a failed attempt", log.Data{"payment_id": id, "status": paymentResourceUpdate.Data.Status})
 	}
 	return Success, nil
 }
 
-// StoreExternalPaymentStatusDetails stores the URI and the ID of the external payment session in the metadata
-func (service *PaymentService) StoreExternalPaymentStatusDetails(id, externalPaymentStatusURI, externalPaymentStatusID string) error {
+// CompletePaymentSession updates an in-progress payment session with the outcome of the payment. The update is only
+// made if the session is still in progress, so that when a callback and a status check complete the same payment at
+// once exactly one of them does so. It returns whether this caller made the update, and only that caller should go
+// on to act on the outcome, e.g. by producing the payment processed message. When completed by a callback, the callback
+// token the user was returned with is given, the session must still hold that token, and it is consumed as the session
+// is completed.
+func (service *PaymentService) CompletePaymentSession(req *http.Request, id, callbackToken string, paymentResourceUpdateRest models.PaymentResourceRest) (bool, ResponseType, error) {
+	return service.completePaymentSession(req, id, callbackToken, false, paymentResourceUpdateRest)
+}
+
+// completePaymentSession completes a payment session as CompletePaymentSession does. When retrying, the session is
+// instead completed from the failed status its last attempt left it in, for an attempt that completes the session as it
+// is made, e.g. a payment from a credit account.
+func (service *PaymentService) completePaymentSession(req *http.Request, id, callbackToken string, retrying bool, paymentResourceUpdateRest models.PaymentResourceRest) (bool, ResponseType, error) {
+	req, span := tracing.StartRequestSpan(req, "PaymentService.CompletePaymentSession", attribute.String("payment.id", id))
+	defer span.End()
+
+	PaymentResourceUpdate := transformers.PaymentTransformer{}.TransformToDB(paymentResourceUpdateRest)
+	PaymentResourceUpdate.Data.Etag = helpers.GenerateEtag()
+	PaymentResourceUpdate.Data.ExpiresAt = time.Time{}
+	// The external payment is that of the attempt which was paid, which needn't be the latest
+	PaymentResourceUpdate.ExternalPaymentStatusURI = paymentResourceUpdateRest.MetaData.ExternalPaymentStatusURI
+	PaymentResourceUpdate.ExternalPaymentStatusID = paymentResourceUpdateRest.MetaData.ExternalPaymentStatusID
+
+	// The payment processed messages of a paid session are recorded as pending by the update which completes it, so
+	// that those which can't be sent once it is completed are sent again
+	if PaymentResourceUpdate.Data.Status == Paid.String() {
+		setMessagesPending(&PaymentResourceUpdate, paymentResourceUpdateRest.Links)
+	}
+
+	tokenHash := ""
+	if callbackToken != "" {
+		tokenHash = helpers.HashCallbackToken(callbackToken)
+	}
+
+	var completed bool
+	var err error
+	if retrying {
+		completed, err = service.DAO.ReopenPaymentResource(req.Context(), id, retryableStatuses, &PaymentResourceUpdate)
+	} else {
+		completed, err = service.DAO.CompletePaymentResource(req.Context(), id, tokenHash, &PaymentResourceUpdate)
+	}
+	if err != nil {
+		err = fmt.Errorf("error completing payment session on database: [%v]", err)
+		log.ErrorR(req, err)
+		return false, Error, err
+	}
+	if !completed {
+		log.InfoR(req, "payment session is no longer in progress or its callback token has been used, it has already been completed", log.Data{"payment_id": id})
+		return false, Success, nil
+	}
+
+	if PaymentResourceUpdate.Data.Status != "" && PaymentResourceUpdate.Data.Status != InProgress.String() {
+		metrics.SessionStatusChanged(PaymentResourceUpdate.Data.Status, paymentResourceUpdateRest.PaymentMethod, getClassOfPayment(paymentResourceUpdateRest.Costs))
+	}
+
+	service.settleResourceClaims(req.Context(), id, PaymentResourceUpdate.Data.Status, SessionResources(paymentResourceUpdateRest.Links))
+
+	if PaymentResourceUpdate.Data.Status == Paid.String() {
+		service.raiseDuplicatePayments(req.Context(), id, paymentResourceUpdateRest)
+	}
+
+	return true, Success, nil
+}
+
+// Outcomes recorded against external payment attempts once they are known
+const (
+	// attemptFinished is an attempt which finished without being paid, so can't be paid
+	attemptFinished = "finished"
+	// attemptRefundRequired is an attempt paid as well as the one which paid the session, which must be refunded
+	attemptRefundRequired = "refund-required"
+)
+
+// recordAttemptOutcome records the outcome of a payment session's external payment attempt, reporting whether it was
+// recorded by this caller. An outcome which can't be recorded is only logged, as the attempt can be checked again.
+func (service *PaymentService) recordAttemptOutcome(ctx context.Context, id string, attempt models.ExternalPaymentAttempt, outcome string) bool {
+	recorded, err := service.DAO.SetExternalPaymentAttemptOutcome(ctx, id, attempt.ExternalPaymentStatusURI, outcome)
+	if err != nil {
+		log.Error(fmt.Errorf("error recording the outcome of an external payment attempt: [%v]", err), log.Data{"payment_id": id, "attempt": attempt.ExternalPaymentStatusURI, "outcome": outcome})
+		return false
+	}
+	return recorded
+}
+
+// raiseDuplicatePayments records the GovPay attempts found paid as well as the one which paid a payment session as
+// needing a refund. It is only called by the caller which completed the session, so that the attempts raised are
+// always other than the session's external payment. Each is raised once, however many times it is found.
+func (service *PaymentService) raiseDuplicatePayments(ctx context.Context, id string, paymentSession models.PaymentResourceRest) {
+	for _, attempt := range paymentSession.MetaData.ExternalPaymentAttempts {
+		if attempt.Outcome != attemptRefundRequired || attempt.ExternalPaymentStatusURI == paymentSession.MetaData.ExternalPaymentStatusURI {
+			continue
+		}
+		if service.recordAttemptOutcome(ctx, id, attempt, attemptRefundRequired) {
+			log.Error(fmt.Errorf("payment session has been paid more than once, its duplicate payment must be refunded"),
+				log.Data{"payment_id": id, "external_payment_status_id": attempt.ExternalPaymentStatusID})
+			metrics.DuplicatePaymentFound(metrics.ProviderGovPay)
+		}
+	}
+}
+
+// StoreExternalPaymentStatusDetails stores the URI and the ID of the external payment session in the metadata, along
+// with a hash of the callback token the payment provider will return the user with. The external payment session is
+// also added to the payment session's attempts, so that it can still be reconciled once a later attempt is made. A
+// payment session whose last attempt failed is put back in progress by the same update.
+func (service *PaymentService) StoreExternalPaymentStatusDetails(ctx context.Context, paymentResource *models.PaymentResourceRest, paymentMethod, externalPaymentStatusURI, externalPaymentStatusID string) (ResponseType, error) {
+	id := paymentResource.MetaData.ID
+	ctx, span := tracing.StartSpan(ctx, "PaymentService.StoreExternalPaymentStatusDetails", attribute.String("payment.id", id))
+	defer span.End()
+
 	PaymentResourceUpdate := models.PaymentResourceDB{
 		ExternalPaymentStatusURI: externalPaymentStatusURI,
 		ExternalPaymentStatusID:  externalPaymentStatusID,
+		CallbackTokenHash:        helpers.HashCallbackToken(paymentResource.MetaData.CallbackToken),
+		ExternalPaymentAttempts: []models.ExternalPaymentAttemptDB{
+			{
+				PaymentMethod:            paymentMethod,
+				ExternalPaymentStatusURI: externalPaymentStatusURI,
+				ExternalPaymentStatusID:  externalPaymentStatusID,
+				CreatedAt:                helpers.MongoNow(),
+			},
+		},
+	}
+
+	if isRetryableFailure(paymentResource.Status) {
+		PaymentResourceUpdate.Data.Status = InProgress.String()
+		responseType, err := service.updateFailedPaymentSession(ctx, id, &PaymentResourceUpdate)
+		if err != nil {
+			return responseType, err
+		}
+		metrics.SessionStatusChanged(InProgress.String(), paymentResource.PaymentMethod, getClassOfPayment(paymentResource.Costs))
+		paymentResource.Status = InProgress.String()
+		return Success, nil
 	}
-	err := service.DAO.PatchPaymentResource(id, &PaymentResourceUpdate)
+
+	err := service.DAO.PatchPaymentResource(ctx, id, &PaymentResourceUpdate)
 	if err != nil {
 		err = fmt.Errorf("error storing the External Payment Status Details against the payment session: [%v]", err)
-		return err
+		return Error, err
 	}
-	return nil
+	return Success, nil
+}
+
+// CallbackTokenMatches reports whether a callback token is the one issued when the payment session's latest external
+// journey was created, and hasn't been used yet. The token is only consumed by the callback that acts on it.
+func CallbackTokenMatches(paymentSession models.PaymentResourceRest, callbackToken string) bool {
+	if callbackToken == "" || paymentSession.MetaData.CallbackTokenHash == "" {
+		return false
+	}
+	return helpers.HashCallbackToken(callbackToken) == paymentSession.MetaData.CallbackTokenHash
+}
+
+// ConsumeCallbackToken uses up the callback token of an in-progress payment session before a callback acts on the
+// payment with its provider, and reports whether this caller consumed it. Only the caller that consumed the token should
+// go on to act on the payment, so that a callback replayed at once by several requests is acted on exactly once.
+func (service *PaymentService) ConsumeCallbackToken(req *http.Request, id, callbackToken string) (bool, ResponseType, error) {
+	req, span := tracing.StartRequestSpan(req, "PaymentService.ConsumeCallbackToken", attribute.String("payment.id", id))
+	defer span.End()
+
+	consumed, err := service.DAO.ConsumeCallbackToken(req.Context(), id, helpers.HashCallbackToken(callbackToken))
+	if err != nil {
+		err = fmt.Errorf("error consuming callback token on database: [%v]", err)
+		log.ErrorR(req, err)
+		return false, Error, err
+	}
+	if !consumed {
+		log.InfoR(req, "payment session is no longer in progress or its callback token has been used", log.Data{"payment_id": id})
+	}
+
+	return consumed, Success, nil
 }
 
 // GetPaymentSession retrieves the payment session with the given ID from the database
 func (service *PaymentService) GetPaymentSession(req *http.Request, id string) (*models.PaymentResourceRest, ResponseType, error) {
-	paymentResource, err := service.DAO.GetPaymentResource(id)
+	req, span := tracing.StartRequestSpan(req, "PaymentService.GetPaymentSession", attribute.String("payment.id", id))
+	defer span.End()
+
+	paymentResource, err := service.DAO.GetPaymentResource(req.Context(), id)
 
 	if err != nil {
 		err = fmt.Errorf("error getting payment resource from db: [%v]", err)
@@ -215,12 +582,14 @@ func (service *PaymentService) GetPaymentSession(req *http.Request, id string) (
 		return nil, NotFound, nil
 	}
 
-	costs, costsResponseType, err := getCosts(paymentResource.Data.Links.Resource, &service.Config, service.SecureCostsRegex)
+	resources := SessionResources(models.PaymentLinksRest(paymentResource.Data.Links))
+	basketCosts, costsResponseType, err := service.getBasketCosts(req.Context(), resources)
 	if err != nil {
 		err = fmt.Errorf("error getting payment resource: [%v]", err)
 		log.ErrorR(req, err)
 		return nil, costsResponseType, err
 	}
+	costs := combineCosts(resources, basketCosts)
 
 	totalAmount, err := getTotalAmount(&costs.Costs)
 	if err != nil {
@@ -243,10 +612,12 @@ func (service *PaymentService) GetPaymentSession(req *http.Request, id string) (
 }
 
 // GetIncompletePayments returns an array of incomplete GovPay payments
-func (service *PaymentService) GetIncompletePayments(cfg *config.Config) (*[]models.PaymentResourceRest, error) {
+func (service *PaymentService) GetIncompletePayments(ctx context.Context, cfg *config.Config) (*[]models.PaymentResourceRest, error) {
+	ctx, span := tracing.StartSpan(ctx, "PaymentService.GetIncompletePayments")
+	defer span.End()
 
 	// Retrieve pending GovPay payments from DB.
-	pendingPayments, err := service.DAO.GetIncompleteGovPayPayments(cfg)
+	pendingPayments, err := service.DAO.GetIncompleteGovPayPayments(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -274,17 +645,27 @@ func getTotalAmount(costs *[]models.CostResourceRest) (string, error) {
 	return totalAmount.StringFixed(2), nil
 }
 
-func getCosts(resource string, cfg *config.Config, secAppCostsRegex *regexp.Regexp) (*models.CostsRest, ResponseType, error) {
+// getClassOfPayment returns the class of payment of the first cost, which validateClassOfPayment ensures is shared
+// by every cost on the session
+func getClassOfPayment(costs []models.CostResourceRest) string {
+	if len(costs) == 0 || len(costs[0].ClassOfPayment) == 0 {
+		return ""
+	}
+	return costs[0].ClassOfPayment[0]
+}
+
+func getCosts(ctx context.Context, resource string, cfg *config.Config, secAppCostsRegex *regexp.Regexp) (*models.CostsRest, ResponseType, error) {
 
-	resourceReq, err := http.NewRequest("GET", resource, nil)
+	resourceReq, err := http.NewRequestWithContext(ctx, "GET", resource, nil)
 	if err != nil {
 		return nil, Error, fmt.Errorf("failed to create Resource Request: [%v]", err)
 	}
 
 	resourceReq.SetBasicAuth(cfg.ChsAPIKey, "")
 
-	var client http.Client
-	resp, err := client.Do(resourceReq)
+	start := time.Now()
+	resp, err := httpClient.Do(resourceReq)
+	metrics.ObserveOutboundCall(metrics.ProviderCosts, "get-costs", start, err)
 	if err != nil {
 		return nil, Error, fmt.Errorf("error getting Cost Resource: [%v]", err)
 	}
@@ -327,62 +708,114 @@ func getCosts(resource string, cfg *config.Config, secAppCostsRegex *regexp.Rege
 	return costs, Success, nil
 }
 
-// Generates a string of 15 alpha numeric characters. this needs to be less than 16 characters as these id's are also
-// being sent to E5 (our finance system) when paying for late filing penalties. Although this restriction is currently
-// being imposed on us by an external system, there is enough entropy here that makes collisions highly unlikely, with
-// a total range being 15**62.
-//
-// **If you change the implementation of this test, you must run the utility test `go test ./... -run 'Util'**
-func generateID() string {
-	idLength := 15
-	rand.Seed(time.Now().UTC().UnixNano())
-	chars := []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz1234567890")
-	id := make([]rune, idLength)
-	for i := 0; i < idLength; i++ {
-		id[i] = chars[rand.Intn(len(chars))]
-	}
-	return string(id)
-}
-
-// generateEtag generates a random etag which is generated on every write action on the payment session
-func generateEtag() string {
-	// Get a random number and the time in seconds and milliseconds
-	rand.Seed(time.Now().UTC().UnixNano())
-	randomNumber := fmt.Sprintf("%07d", rand.Intn(9999999))
-	timeInMillis := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
-	timeInSeconds := strconv.FormatInt(time.Now().UnixNano()/int64(time.Second), 10)
-	// Calculate a SHA-512 truncated digest
-	shaDigest := sha512.New512_224()
-	shaDigest.Write([]byte(randomNumber + timeInMillis + timeInSeconds))
-	sha1_hash := hex.EncodeToString(shaDigest.Sum(nil))
-	return sha1_hash
-}
-
-func validateIncomingPayment(incomingPaymentResourceRequest models.IncomingPaymentResourceRequest, cfg *config.Config) error {
+func validateIncomingPayment(incomingPaymentResourceRequest models.IncomingPaymentResourceRequest, cfg *config.Config, clientID string) error {
 	validate := validator.New()
 	err := validate.Struct(incomingPaymentResourceRequest)
 	if err != nil {
 		return err
 	}
 
-	parsedURL, err := url.Parse(incomingPaymentResourceRequest.Resource)
+	if incomingPaymentResourceRequest.Resource != "" && len(incomingPaymentResourceRequest.Resources) > 0 {
+		return fmt.Errorf("resource and resources can't both be given")
+	}
+
+	for _, resource := range incomingResources(incomingPaymentResourceRequest) {
+		err = validateResourceDomain(resource, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return validateRedirectURI(incomingPaymentResourceRequest.RedirectURI, cfg.RedirectAllowListForClient(clientID))
+}
+
+// isUnconfiguredClient reports whether CLIENTS is in use but the calling service isn't in it, e.g. because ERIC didn't
+// identify the OAuth client, in which case the redirect back to it can't be signed
+func isUnconfiguredClient(cfg *config.Config, clientID string) bool {
+	if cfg.ClientsJSON == "" {
+		return false
+	}
+	return cfg.Client(clientID) == nil
+}
+
+// validateResourceDomain checks that a cost resource is served from a domain in the allow list
+func validateResourceDomain(resource string, cfg *config.Config) error {
+	parsedURL, err := url.Parse(resource)
 	if err != nil {
 		return err
 	}
 	resourceDomain := strings.Join([]string{parsedURL.Scheme, parsedURL.Host}, "://")
 
-	allowList := strings.Split(cfg.DomainAllowList, ",")
-	matched := false
-	for _, domain := range allowList {
+	// The costs of payment requests are served by this service, so don't need their domain allowing
+	_, matched := paymentRequestID(resource, cfg)
+	for _, domain := range cfg.DomainAllowList {
 		if resourceDomain == domain {
 			matched = true
 			break
 		}
 	}
 	if !matched {
-		err = fmt.Errorf("invalid resource domain: %s", resourceDomain)
+		return fmt.Errorf("invalid resource domain: %s", resourceDomain)
 	}
-	return err
+	return nil
+}
+
+// validateRedirectURI checks that the redirect_uri starts with one of the origins and path prefixes in the allow list,
+// so that a payment session can't be used to redirect the user to an arbitrary site once they have paid
+func validateRedirectURI(redirectURI string, allowList []string) error {
+	parsedURL, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+	origin := parsedURL.Scheme + "://" + parsedURL.Host
+
+	if parsedURL.User == nil {
+		for _, entry := range allowList {
+			allowed, err := url.Parse(entry)
+			if err != nil {
+				continue
+			}
+			if parsedURL.Scheme == allowed.Scheme && strings.EqualFold(parsedURL.Host, allowed.Host) && hasPathPrefix(parsedURL.Path, allowed.Path) {
+				return nil
+			}
+		}
+	}
+
+	return &RedirectURINotAllowedError{Origin: origin}
+}
+
+// RedirectURINotAllowedError is returned when a payment session is created with a redirect_uri that isn't in the
+// calling service's allow list
+type RedirectURINotAllowedError struct {
+	Origin string
+}
+
+func (e *RedirectURINotAllowedError) Error() string {
+	return fmt.Sprintf("redirect_uri origin [%s] is not allowed", e.Origin)
+}
+
+// hasPathPrefix reports whether path is prefix or falls beneath it, matching whole path segments only. Dot segments
+// are resolved first, as the browser would, so that a path can't climb out of the prefix.
+func hasPathPrefix(urlPath, prefix string) bool {
+	urlPath = path.Clean("/" + urlPath)
+	prefix = strings.TrimSuffix(prefix, "/")
+	return prefix == "" || urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")
+}
+
+// validateGovPayAccounts checks that every cost which can be paid by card has a class of payment that maps to a
+// GOV.UK Pay account, so that a session can't be created which would fail once the user chose to pay by card
+func validateGovPayAccounts(costs *[]models.CostResourceRest, cfg *config.Config) error {
+	for _, cost := range *costs {
+		if !slices.Contains(cost.AvailablePaymentMethods, PaymentMethodCreditCard) {
+			continue
+		}
+		for _, classOfPayment := range cost.ClassOfPayment {
+			if _, err := cfg.GovPayAccountForClass(classOfPayment); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func validateCosts(costs *[]models.CostResourceRest) error {
@@ -396,10 +829,110 @@ func validateCosts(costs *[]models.CostResourceRest) error {
 	return nil
 }
 
-func IsExpired(paymentSession models.PaymentResourceRest, cfg *config.Config) (bool, error) {
-	expiryTimeInMinutes, err := strconv.Atoi(cfg.ExpiryTimeInMinutes)
+// PaymentMethodNoPaymentRequired is the payment method of payment sessions completed without a payment provider, as
+// there was nothing to pay
+const PaymentMethodNoPaymentRequired = "no-payment-required"
+
+// noPaymentAmount is the total of a payment session with nothing to pay
+const noPaymentAmount = "0.00"
+
+// NoPaymentRequired reports whether a payment session with nothing to pay is yet to be completed, in which case its
+// PATCH completes it without going to a payment provider. This is a session created before its costs were waived, or
+// one whose completion failed as it was created.
+func NoPaymentRequired(paymentSession *models.PaymentResourceRest) bool {
+	return paymentSession.Amount == noPaymentAmount &&
+		(paymentSession.Status == Pending.String() || paymentSession.Status == InProgress.String())
+}
+
+// CompleteNoPaymentRequiredSession completes a payment session with nothing to pay without going to a payment provider,
+// and reports whether this caller completed it. A pending session is put in progress first, so that it is completed by
+// the same conditional update as any other payment, which records its payment processed messages as pending.
+func (service *PaymentService) CompleteNoPaymentRequiredSession(req *http.Request, paymentSession *models.PaymentResourceRest) (bool, ResponseType, error) {
+	id := paymentSession.MetaData.ID
+	if paymentSession.Status == Pending.String() {
+		inProgress := models.PaymentResourceDB{Data: models.PaymentResourceDataDB{
+			Status:        InProgress.String(),
+			PaymentMethod: PaymentMethodNoPaymentRequired,
+		}}
+		err := service.DAO.PatchPaymentResource(req.Context(), id, &inProgress)
+		if err != nil {
+			err = fmt.Errorf("error patching payment session on database: [%v]", err)
+			log.ErrorR(req, err)
+			return false, Error, err
+		}
+	}
+
+	paymentSession.Status = Paid.String()
+	paymentSession.PaymentMethod = PaymentMethodNoPaymentRequired
+	paymentSession.CompletedAt = helpers.MongoNow()
+	completed, responseType, err := service.CompletePaymentSession(req, id, "", *paymentSession)
 	if err != nil {
-		return false, err
+		return false, responseType, err
+	}
+	if completed {
+		log.InfoR(req, "payment session completed as no payment is required", log.Data{"payment_id": id})
+	}
+	return completed, Success, nil
+}
+
+// PaymentDetailsWithoutProvider returns the payment details of a payment session completed without a payment provider,
+// as there was nothing to pay or an admin override marked it paid
+func PaymentDetailsWithoutProvider(paymentSession *models.PaymentResourceRest) *models.PaymentDetails {
+	return &models.PaymentDetails{
+		TransactionDate: paymentSession.CompletedAt.Format(time.RFC3339Nano),
+		PaymentStatus:   "accepted",
+	}
+}
+
+// noPaymentRequiredJourneyURL returns the journey link of a payment session with nothing to pay, which returns the user
+// straight to the calling service
+func noPaymentRequiredJourneyURL(cfg *config.Config, id string) string {
+	return fmt.Sprintf("%s/callback/payments/no-payment-required/%s", cfg.PaymentsAPIURL, id)
+}
+
+// retryableStatuses are the statuses a payment session is left in when its last attempt failed in a way the user can
+// recover from, e.g. by using another card or payment method. A payment cancelled by the service isn't retried.
+var retryableStatuses = []string{
+	Failed.String(),
+	NoFunds.String(),
+	"cancelled",
+	"failed_payment-method-rejected",
+	"failed_payment-expired",
+	"failed_payment-cancelled-by-user",
+	"failed_payment-provider-error",
+}
+
+// isRetryableFailure reports whether the payment session status is that of a failed attempt which can be retried
+func isRetryableFailure(status string) bool {
+	for _, retryableStatus := range retryableStatuses {
+		if status == retryableStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPaidStatus reports whether the status is one of a payment session which has been paid, which no longer expires
+func IsPaidStatus(status string) bool {
+	return status == Paid.String() || status == Overpaid.String()
+}
+
+// IsExpired reports whether the time the payment session expires has passed
+func IsExpired(paymentSession models.PaymentResourceRest, cfg *config.Config) bool {
+	return ExpiresAt(paymentSession, cfg).Before(time.Now())
+}
+
+// ExpiresAt returns the time the payment session expires, which is stored on the session when it is created and moved
+// on when it is extended
+func ExpiresAt(paymentSession models.PaymentResourceRest, cfg *config.Config) time.Time {
+	return expiresAt(paymentSession.CreatedAt, paymentSession.ExpiresAt, cfg)
+}
+
+// expiresAt returns the time a payment session expires from the time stored on it. Sessions created before the time
+// was stored expire the configured session expiry time after they were created.
+func expiresAt(createdAt, storedExpiresAt time.Time, cfg *config.Config) time.Time {
+	if !storedExpiresAt.IsZero() {
+		return storedExpiresAt
 	}
-	return paymentSession.CreatedAt.Add(time.Minute * time.Duration(expiryTimeInMinutes)).Before(time.Now()), nil
+	return createdAt.Add(time.Minute * time.Duration(cfg.ExpiryTimeInMinutes))
 }
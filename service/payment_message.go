@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/transformers"
+)
+
+// messageRetryDelay is how long the payment processed messages owed by a payment session are left to the caller which
+// updated it, before they are taken to have failed and are sent again
+const messageRetryDelay = time.Minute * 5
+
+// setMessagesPending records on an update to a payment session the payment processed messages its outcome is to be
+// sent to its cost resources in, so that they are sent again if the caller making the update fails to send them
+func setMessagesPending(paymentUpdate *models.PaymentResourceDB, links models.PaymentLinksRest) {
+	paymentUpdate.MessagesPending = paymentMessageResources(links)
+	paymentUpdate.MessagesPendingAt = helpers.MongoNow()
+}
+
+// GetPaymentSessionsWithMessagesPending returns the payment sessions whose payment processed messages weren't all sent
+// when they were updated, so that they can be sent again. Messages pending for the last few minutes are left to the
+// caller which updated the session.
+func (service *PaymentService) GetPaymentSessionsWithMessagesPending(req *http.Request) ([]models.PaymentResourceRest, error) {
+	paymentResources, err := service.DAO.GetPaymentResourcesWithMessagesPending(req.Context(), time.Now().Add(-messageRetryDelay))
+	if err != nil {
+		err = fmt.Errorf("error getting payment sessions with messages pending: [%v]", err)
+		log.ErrorR(req, err)
+		return nil, err
+	}
+
+	paymentSessions := make([]models.PaymentResourceRest, 0, len(paymentResources))
+	for _, paymentResource := range paymentResources {
+		paymentSessions = append(paymentSessions, transformers.PaymentTransformer{}.TransformToRest(paymentResource))
+	}
+	return paymentSessions, nil
+}
+
+// PaymentMessagesSent records the payment processed messages of a payment session sent for the given cost resources,
+// so that they aren't sent again
+func (service *PaymentService) PaymentMessagesSent(ctx context.Context, id string, resources []string) error {
+	err := service.DAO.RemoveMessagesPending(ctx, id, resources)
+	if err != nil {
+		return fmt.Errorf("error recording payment processed messages as sent: [%v]", err)
+	}
+	return nil
+}
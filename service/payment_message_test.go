@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitGetPaymentSessionsWithMessagesPending(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	req := httptest.NewRequest("POST", "/test", nil)
+
+	Convey("Error getting payment sessions", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResourcesWithMessagesPending(gomock.Any(), gomock.Any()).Return(nil, errors.New("error"))
+
+		paymentSessions, err := mockPaymentService.GetPaymentSessionsWithMessagesPending(req)
+		So(paymentSessions, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "error getting payment sessions with messages pending: [error]")
+	})
+
+	Convey("Messages pending for the last few minutes are left to the caller which updated the session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResourcesWithMessagesPending(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, pendingBefore time.Time) ([]models.PaymentResourceDB, error) {
+				So(pendingBefore, ShouldHappenBefore, time.Now().Add(-messageRetryDelay+time.Second))
+				return []models.PaymentResourceDB{}, nil
+			})
+
+		paymentSessions, err := mockPaymentService.GetPaymentSessionsWithMessagesPending(req)
+		So(err, ShouldBeNil)
+		So(paymentSessions, ShouldBeEmpty)
+	})
+
+	Convey("Payment sessions returned", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResourcesWithMessagesPending(gomock.Any(), gomock.Any()).Return([]models.PaymentResourceDB{
+			{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00", Status: Paid.String()}, MessagesPending: []string{"resource"}},
+		}, nil)
+
+		paymentSessions, err := mockPaymentService.GetPaymentSessionsWithMessagesPending(req)
+		So(err, ShouldBeNil)
+		So(len(paymentSessions), ShouldEqual, 1)
+		So(paymentSessions[0].MetaData.ID, ShouldEqual, "1234")
+		So(paymentSessions[0].Status, ShouldEqual, Paid.String())
+	})
+}
+
+func TestUnitPaymentMessagesSent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error recording messages as sent", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().RemoveMessagesPending(gomock.Any(), "1234", []string{"resource"}).Return(errors.New("error"))
+
+		err := mockPaymentService.PaymentMessagesSent(context.Background(), "1234", []string{"resource"})
+		So(err.Error(), ShouldEqual, "error recording payment processed messages as sent: [error]")
+	})
+
+	Convey("Messages recorded as sent", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().RemoveMessagesPending(gomock.Any(), "1234", []string{"resource"}).Return(nil)
+
+		err := mockPaymentService.PaymentMessagesSent(context.Background(), "1234", []string{"resource"})
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/transformers"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Overrides an admin can apply to the outcome of a payment session
+const (
+	OverridePaidOffline = "paid-offline"
+	OverrideWaived      = "waived"
+	OverrideFailed      = "failed"
+)
+
+// Payment methods of payment sessions paid outside of the service, or whose fee was waived, by an admin override
+const (
+	PaymentMethodOffline = "offline"
+	PaymentMethodWaived  = "waived"
+)
+
+// overridableStatuses are the statuses of payment sessions whose outcome can be overridden. A session that has been
+// paid, or refunded, can't be, and nor can one whose external payment journey can still be completed.
+var overridableStatuses = append([]string{
+	Pending.String(),
+	InProgress.String(),
+	Expired.String(),
+	"failed_payment-cancelled-by-service",
+}, retryableStatuses...)
+
+// OverridePaymentSession applies an admin override to the outcome of a payment session, e.g. marking it paid after an
+// offline payment, and records who made it and why in the session's history. The override is only applied if the
+// session's status hasn't changed since it was read, so that it can't overwrite a payment completed in the meantime,
+// and is refused while the session's external payment journey is live, as the user could still pay it. The session's
+// claims on its cost resources are then settled, and its duplicate payments raised, as they are when a session is
+// completed by its journey.
+func (service *PaymentService) OverridePaymentSession(req *http.Request, id string, override models.IncomingPaymentOverride, actor string) (*models.PaymentResourceRest, ResponseType, error) {
+	err := validator.New().Struct(override)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid payment override: [%v]", err)
+	}
+
+	paymentResource, err := service.DAO.GetPaymentResource(req.Context(), id)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting payment resource from db: [%v]", err)
+	}
+	if paymentResource == nil {
+		return nil, NotFound, nil
+	}
+
+	previousStatus := paymentResource.Data.Status
+	if !slices.Contains(overridableStatuses, previousStatus) {
+		return nil, Conflict, fmt.Errorf("payment session with status [%s] can't be overridden", previousStatus)
+	}
+	if previousStatus == InProgress.String() && hasLiveExternalJourney(*paymentResource, &service.Config) {
+		return nil, Conflict, fmt.Errorf("payment session has a live external payment journey, it can't be overridden until the journey expires")
+	}
+
+	now := helpers.MongoNow()
+	paymentUpdate := models.PaymentResourceDB{
+		Data: models.PaymentResourceDataDB{
+			CompletedAt: now,
+			Etag:        helpers.GenerateEtag(),
+		},
+	}
+	setMessagesPending(&paymentUpdate, models.PaymentLinksRest(paymentResource.Data.Links))
+	switch override.Override {
+	case OverridePaidOffline:
+		paymentUpdate.Data.Status = Paid.String()
+		paymentUpdate.Data.PaymentMethod = PaymentMethodOffline
+	case OverrideWaived:
+		paymentUpdate.Data.Status = Paid.String()
+		paymentUpdate.Data.PaymentMethod = PaymentMethodWaived
+	case OverrideFailed:
+		paymentUpdate.Data.Status = Failed.String()
+	}
+	paymentUpdate.History = []models.PaymentHistoryDB{
+		{
+			Action:            override.Override,
+			PreviousStatus:    previousStatus,
+			Status:            paymentUpdate.Data.Status,
+			Actor:             actor,
+			Reason:            override.Reason,
+			EvidenceReference: override.EvidenceReference,
+			CreatedAt:         now,
+		},
+	}
+
+	overridden, err := service.DAO.OverridePaymentResource(req.Context(), id, []string{previousStatus}, &paymentUpdate)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error overriding payment session on database: [%v]", err)
+	}
+	if !overridden {
+		return nil, Conflict, fmt.Errorf("payment session is no longer [%s], it has been updated since it was read", previousStatus)
+	}
+
+	log.InfoR(req, "payment session overridden", log.Data{
+		"payment_id":         id,
+		"override":           override.Override,
+		"previous_status":    previousStatus,
+		"actor":              actor,
+		"evidence_reference": override.EvidenceReference,
+	})
+
+	paymentResource.Data.Status = paymentUpdate.Data.Status
+	paymentResource.Data.CompletedAt = paymentUpdate.Data.CompletedAt
+	paymentResource.Data.Etag = paymentUpdate.Data.Etag
+	if paymentUpdate.Data.PaymentMethod != "" {
+		paymentResource.Data.PaymentMethod = paymentUpdate.Data.PaymentMethod
+	}
+	paymentResource.History = append(paymentResource.History, paymentUpdate.History...)
+	paymentResourceRest := transformers.PaymentTransformer{}.TransformToRest(*paymentResource)
+
+	metrics.SessionStatusChanged(paymentResourceRest.Status, paymentResourceRest.PaymentMethod, getClassOfPayment(paymentResourceRest.Costs))
+
+	service.settleResourceClaims(req.Context(), id, paymentResourceRest.Status, SessionResources(paymentResourceRest.Links))
+	if paymentResourceRest.Status == Paid.String() {
+		service.raiseOverriddenDuplicates(req.Context(), paymentResourceRest)
+	}
+
+	return &paymentResourceRest, Success, nil
+}
+
+// raiseOverriddenDuplicates checks the GovPay attempts of a payment session overridden to paid. None of them paid the
+// session, so any found paid, e.g. once its journey had expired, are raised as needing a refund.
+func (service *PaymentService) raiseOverriddenDuplicates(ctx context.Context, paymentSession models.PaymentResourceRest) {
+	if paymentSession.MetaData.ExternalPaymentStatusURI == "" && len(paymentSession.MetaData.ExternalPaymentAttempts) == 0 {
+		return
+	}
+	paymentSession.MetaData.ExternalPaymentAttempts = govPayAttempts(&paymentSession)
+	paymentSession.MetaData.ExternalPaymentStatusURI = ""
+
+	// The GovPay account the attempts were made with is given by the class of payment of the session's costs
+	resources := SessionResources(paymentSession.Links)
+	basketCosts, _, err := service.getBasketCosts(ctx, resources)
+	if err != nil {
+		log.Error(fmt.Errorf("error getting costs of an overridden payment session: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID})
+		return
+	}
+	paymentSession.Costs = combineCosts(resources, basketCosts).Costs
+
+	gp := GovPayService{PaymentService: *service}
+	_, _, err = gp.checkEarlierAttempts(ctx, &paymentSession, true)
+	if err != nil {
+		log.Error(fmt.Errorf("error checking GovPay attempts of an overridden payment session: [%v]", err), log.Data{"payment_id": paymentSession.MetaData.ID})
+	}
+	service.raiseDuplicatePayments(ctx, paymentSession.MetaData.ID, paymentSession)
+}
+
+// GetPaymentOverrides returns the overrides made to the outcome of a payment session, the earliest first
+func (service *PaymentService) GetPaymentOverrides(req *http.Request, id string) ([]models.PaymentHistoryRest, ResponseType, error) {
+	paymentResource, err := service.DAO.GetPaymentResource(req.Context(), id)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting payment resource from db: [%v]", err)
+	}
+	if paymentResource == nil {
+		return nil, NotFound, nil
+	}
+
+	overrides := make([]models.PaymentHistoryRest, 0, len(paymentResource.History))
+	for _, history := range paymentResource.History {
+		overrides = append(overrides, transformPaymentHistoryToRest(history))
+	}
+	return overrides, Success, nil
+}
+
+func transformPaymentHistoryToRest(history models.PaymentHistoryDB) models.PaymentHistoryRest {
+	return models.PaymentHistoryRest{
+		Action:            history.Action,
+		PreviousStatus:    history.PreviousStatus,
+		Status:            history.Status,
+		Actor:             history.Actor,
+		Reason:            history.Reason,
+		EvidenceReference: history.EvidenceReference,
+		CreatedAt:         history.CreatedAt,
+	}
+}
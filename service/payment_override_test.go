@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitOverridePaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	validOverride := models.IncomingPaymentOverride{
+		Override:          OverridePaidOffline,
+		Reason:            "Paid by cheque at the front desk",
+		EvidenceReference: "CHQ-0001",
+	}
+
+	paymentSession := func(status string) *models.PaymentResourceDB {
+		return &models.PaymentResourceDB{
+			ID: "1234",
+			Data: models.PaymentResourceDataDB{
+				Amount:        "10.00",
+				PaymentMethod: PaymentMethodCreditCard,
+				Status:        status,
+				Links:         models.PaymentLinksDB{Resource: "http://dummy-resource"},
+			},
+		}
+	}
+
+	Convey("Invalid overrides", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		testCases := []struct {
+			description string
+			update      func(*models.IncomingPaymentOverride)
+		}{
+			{"unknown override", func(o *models.IncomingPaymentOverride) { o.Override = "refunded" }},
+			{"missing reason", func(o *models.IncomingPaymentOverride) { o.Reason = "" }},
+			{"missing evidence reference", func(o *models.IncomingPaymentOverride) { o.EvidenceReference = "" }},
+		}
+
+		for _, tc := range testCases {
+			Convey(tc.description, func() {
+				override := validOverride
+				tc.update(&override)
+
+				paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", override, "admin@companieshouse.gov.uk")
+				So(paymentResource, ShouldBeNil)
+				So(responseType, ShouldEqual, InvalidData)
+				So(err.Error(), ShouldStartWith, "invalid payment override")
+			})
+		}
+	})
+
+	Convey("Error getting payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, errors.New("error"))
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(paymentResource, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting payment resource from db: [error]")
+	})
+
+	Convey("Payment session not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, nil)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(paymentResource, ShouldBeNil)
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payment session that has been paid can't be overridden", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paymentSession(Paid.String()), nil)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(paymentResource, ShouldBeNil)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session with status [paid] can't be overridden")
+	})
+
+	Convey("Payment session with a live external payment journey can't be overridden", t, func() {
+		journeyCfg := *cfg
+		journeyCfg.GovPayExpiryTime = 90
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, &journeyCfg)
+		session := paymentSession(InProgress.String())
+		session.Data.CreatedAt = time.Now().Add(-time.Minute * 10)
+		session.ExternalPaymentStatusURI = "latest_uri"
+		session.ExternalPaymentAttempts = []models.ExternalPaymentAttemptDB{
+			{ExternalPaymentStatusURI: "latest_uri", CreatedAt: time.Now().Add(-time.Minute)},
+		}
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(session, nil)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(paymentResource, ShouldBeNil)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session has a live external payment journey, it can't be overridden until the journey expires")
+	})
+
+	Convey("Payment session whose external payment journey has expired can be overridden", t, func() {
+		journeyCfg := *cfg
+		journeyCfg.GovPayExpiryTime = 5
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, &journeyCfg)
+		session := paymentSession(InProgress.String())
+		session.Data.CreatedAt = time.Now().Add(-time.Minute * 10)
+		session.ExternalPaymentStatusURI = "latest_uri"
+		session.ExternalPaymentAttempts = []models.ExternalPaymentAttemptDB{
+			{PaymentMethod: PaymentMethodCreditCard, ExternalPaymentStatusURI: "latest_uri", CreatedAt: time.Now().Add(-time.Minute * 10)},
+		}
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(session, nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", []string{InProgress.String()}, gomock.Any()).Return(true, nil)
+		mock.EXPECT().ClaimResource(gomock.Any(), "http://dummy-resource", "1234", time.Time{}).Return(true, nil)
+		mock.EXPECT().SetExternalPaymentAttemptOutcome(gomock.Any(), "1234", "latest_uri", "finished").Return(true, nil)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		costs, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", costs)
+		expired, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: models.State{Status: "failed", Finished: true, Code: "P0020"}})
+		httpmock.RegisterResponder("GET", "latest_uri", expired)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(paymentResource.Status, ShouldEqual, Paid.String())
+	})
+
+	Convey("Payment session overridden to paid whose expired journey was paid raises it for a refund", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		session := paymentSession(Expired.String())
+		session.ExternalPaymentStatusURI = "latest_uri"
+		session.ExternalPaymentAttempts = []models.ExternalPaymentAttemptDB{
+			{PaymentMethod: PaymentMethodCreditCard, ExternalPaymentStatusURI: "earlier_uri", Outcome: "finished"},
+			{PaymentMethod: PaymentMethodCreditCard, ExternalPaymentStatusURI: "latest_uri"},
+		}
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(session, nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", []string{Expired.String()}, gomock.Any()).Return(true, nil)
+		mock.EXPECT().ClaimResource(gomock.Any(), "http://dummy-resource", "1234", time.Time{}).Return(true, nil)
+		mock.EXPECT().SetExternalPaymentAttemptOutcome(gomock.Any(), "1234", "latest_uri", "refund-required").Return(true, nil)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		costs, _ := httpmock.NewJsonResponder(http.StatusOK, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", costs)
+		paid, _ := httpmock.NewJsonResponder(http.StatusOK, models.IncomingGovPayResponse{State: models.State{Status: "success", Finished: true}})
+		httpmock.RegisterResponder("GET", "latest_uri", paid)
+
+		override := validOverride
+		override.Override = OverrideWaived
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", override, "admin@companieshouse.gov.uk")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(paymentResource.Status, ShouldEqual, Paid.String())
+		So(httpmock.GetCallCountInfo()["GET earlier_uri"], ShouldEqual, 0)
+	})
+
+	Convey("Payment session updated since it was read", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paymentSession(InProgress.String()), nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", []string{InProgress.String()}, gomock.Any()).Return(false, nil)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(paymentResource, ShouldBeNil)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session is no longer [in-progress], it has been updated since it was read")
+	})
+
+	Convey("Error overriding payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paymentSession(InProgress.String()), nil)
+		mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, errors.New("error"))
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", validOverride, "admin@companieshouse.gov.uk")
+		So(paymentResource, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error overriding payment session on database: [error]")
+	})
+
+	Convey("Override applied and recorded in the history", t, func() {
+		testCases := []struct {
+			override              string
+			previousStatus        string
+			expectedStatus        string
+			expectedPaymentMethod string
+			expectedClaim         bool
+		}{
+			{OverridePaidOffline, InProgress.String(), Paid.String(), PaymentMethodOffline, true},
+			{OverrideWaived, Pending.String(), Paid.String(), PaymentMethodWaived, true},
+			{OverrideFailed, Expired.String(), Failed.String(), PaymentMethodCreditCard, false},
+		}
+
+		for _, tc := range testCases {
+			Convey(tc.override, func() {
+				mock := dao.NewMockDAO(mockCtrl)
+				mockPaymentService := createMockPaymentService(mock, cfg)
+				mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(paymentSession(tc.previousStatus), nil)
+				mock.EXPECT().OverridePaymentResource(gomock.Any(), "1234", []string{tc.previousStatus}, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ string, _ []string, update *models.PaymentResourceDB) (bool, error) {
+						So(update.Data.Status, ShouldEqual, tc.expectedStatus)
+						So(update.Data.CompletedAt, ShouldNotBeZeroValue)
+						So(update.History, ShouldHaveLength, 1)
+						So(update.History[0].Action, ShouldEqual, tc.override)
+						So(update.History[0].PreviousStatus, ShouldEqual, tc.previousStatus)
+						So(update.History[0].Status, ShouldEqual, tc.expectedStatus)
+						So(update.History[0].Actor, ShouldEqual, "admin@companieshouse.gov.uk")
+						So(update.History[0].Reason, ShouldEqual, "Paid by cheque at the front desk")
+						So(update.History[0].EvidenceReference, ShouldEqual, "CHQ-0001")
+						So(update.MessagesPending, ShouldResemble, []string{""})
+						So(update.MessagesPendingAt, ShouldNotBeZeroValue)
+						return true, nil
+					})
+				if tc.expectedClaim {
+					mock.EXPECT().ClaimResource(gomock.Any(), "http://dummy-resource", "1234", time.Time{}).Return(true, nil)
+				} else {
+					mock.EXPECT().ReleaseResource(gomock.Any(), "http://dummy-resource", "1234").Return(nil)
+				}
+				req := httptest.NewRequest("POST", "/test", nil)
+
+				override := validOverride
+				override.Override = tc.override
+				paymentResource, responseType, err := mockPaymentService.OverridePaymentSession(req, "1234", override, "admin@companieshouse.gov.uk")
+				So(err, ShouldBeNil)
+				So(responseType, ShouldEqual, Success)
+				So(paymentResource.Status, ShouldEqual, tc.expectedStatus)
+				So(paymentResource.PaymentMethod, ShouldEqual, tc.expectedPaymentMethod)
+				So(paymentResource.CompletedAt, ShouldNotBeZeroValue)
+			})
+		}
+	})
+}
+
+func TestUnitGetPaymentOverrides(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	req := httptest.NewRequest("GET", "/test", nil)
+
+	Convey("Error getting payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, errors.New("error"))
+
+		overrides, responseType, err := mockPaymentService.GetPaymentOverrides(req, "1234")
+		So(overrides, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting payment resource from db: [error]")
+	})
+
+	Convey("Payment session not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(nil, nil)
+
+		overrides, responseType, err := mockPaymentService.GetPaymentOverrides(req, "1234")
+		So(overrides, ShouldBeNil)
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payment session never overridden", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{ID: "1234"}, nil)
+
+		overrides, responseType, err := mockPaymentService.GetPaymentOverrides(req, "1234")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(overrides, ShouldBeEmpty)
+	})
+
+	Convey("Overrides returned", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		createdAt := time.Now()
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{
+			ID: "1234",
+			History: []models.PaymentHistoryDB{
+				{
+					Action:            OverridePaidOffline,
+					PreviousStatus:    InProgress.String(),
+					Status:            Paid.String(),
+					Actor:             "admin@companieshouse.gov.uk",
+					Reason:            "Paid by cheque at the front desk",
+					EvidenceReference: "CHQ-0001",
+					CreatedAt:         createdAt,
+				},
+			},
+		}, nil)
+
+		overrides, responseType, err := mockPaymentService.GetPaymentOverrides(req, "1234")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(overrides, ShouldResemble, []models.PaymentHistoryRest{
+			{
+				Action:            OverridePaidOffline,
+				PreviousStatus:    InProgress.String(),
+				Status:            Paid.String(),
+				Actor:             "admin@companieshouse.gov.uk",
+				Reason:            "Paid by cheque at the front desk",
+				EvidenceReference: "CHQ-0001",
+				CreatedAt:         createdAt,
+			},
+		})
+	})
+}
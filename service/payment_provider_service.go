@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
@@ -9,13 +10,13 @@ import (
 
 // PaymentProviderService is an Interface for all the requests to external payment providers
 type PaymentProviderService interface {
-	CheckPaymentProviderStatus(paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error)
+	CheckPaymentProviderStatus(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error)
 	CreatePaymentAndGenerateNextURL(req *http.Request, paymentResource *models.PaymentResourceRest) (string, ResponseType, error)
-	GetPaymentDetails(paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error)
-	CapturePayment(id string) (*paypal.CaptureOrderResponse, error)
-	GetCapturedPaymentDetails(id string) (*paypal.CaptureDetailsResponse, error)
-	RefundCapture(captureID string) (*paypal.RefundResponse, error)
+	GetPaymentDetails(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error)
+	CapturePayment(ctx context.Context, id string) (*paypal.CaptureOrderResponse, error)
+	GetCapturedPaymentDetails(ctx context.Context, id string) (*paypal.CaptureDetailsResponse, error)
+	RefundCapture(ctx context.Context, captureID string) (*paypal.RefundResponse, error)
 	GetRefundSummary(req *http.Request, id string) (*models.PaymentResourceRest, *models.RefundSummary, ResponseType, error)
-	GetRefundStatus(paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error)
-	CreateRefund(paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error)
+	GetRefundStatus(ctx context.Context, paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error)
+	CreateRefund(ctx context.Context, paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error)
 }
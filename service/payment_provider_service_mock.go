@@ -5,6 +5,7 @@
 package service
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 
@@ -37,24 +38,24 @@ func (m *MockPaymentProviderService) EXPECT() *MockPaymentProviderServiceMockRec
 }
 
 // CapturePayment mocks base method.
-func (m *MockPaymentProviderService) CapturePayment(id string) (*v4.CaptureOrderResponse, error) {
+func (m *MockPaymentProviderService) CapturePayment(ctx context.Context, id string) (*v4.CaptureOrderResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CapturePayment", id)
+	ret := m.ctrl.Call(m, "CapturePayment", ctx, id)
 	ret0, _ := ret[0].(*v4.CaptureOrderResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CapturePayment indicates an expected call of CapturePayment.
-func (mr *MockPaymentProviderServiceMockRecorder) CapturePayment(id interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) CapturePayment(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CapturePayment", reflect.TypeOf((*MockPaymentProviderService)(nil).CapturePayment), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CapturePayment", reflect.TypeOf((*MockPaymentProviderService)(nil).CapturePayment), ctx, id)
 }
 
 // CheckPaymentProviderStatus mocks base method.
-func (m *MockPaymentProviderService) CheckPaymentProviderStatus(paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
+func (m *MockPaymentProviderService) CheckPaymentProviderStatus(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CheckPaymentProviderStatus", paymentResource)
+	ret := m.ctrl.Call(m, "CheckPaymentProviderStatus", ctx, paymentResource)
 	ret0, _ := ret[0].(*models.StatusResponse)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(ResponseType)
@@ -63,9 +64,9 @@ func (m *MockPaymentProviderService) CheckPaymentProviderStatus(paymentResource
 }
 
 // CheckPaymentProviderStatus indicates an expected call of CheckPaymentProviderStatus.
-func (mr *MockPaymentProviderServiceMockRecorder) CheckPaymentProviderStatus(paymentResource interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) CheckPaymentProviderStatus(ctx, paymentResource interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckPaymentProviderStatus", reflect.TypeOf((*MockPaymentProviderService)(nil).CheckPaymentProviderStatus), paymentResource)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckPaymentProviderStatus", reflect.TypeOf((*MockPaymentProviderService)(nil).CheckPaymentProviderStatus), ctx, paymentResource)
 }
 
 // CreatePaymentAndGenerateNextURL mocks base method.
@@ -85,9 +86,9 @@ func (mr *MockPaymentProviderServiceMockRecorder) CreatePaymentAndGenerateNextUR
 }
 
 // CreateRefund mocks base method.
-func (m *MockPaymentProviderService) CreateRefund(paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+func (m *MockPaymentProviderService) CreateRefund(ctx context.Context, paymentResource *models.PaymentResourceRest, refundRequest *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateRefund", paymentResource, refundRequest)
+	ret := m.ctrl.Call(m, "CreateRefund", ctx, paymentResource, refundRequest)
 	ret0, _ := ret[0].(*models.CreateRefundGovPayResponse)
 	ret1, _ := ret[1].(ResponseType)
 	ret2, _ := ret[2].(error)
@@ -95,30 +96,30 @@ func (m *MockPaymentProviderService) CreateRefund(paymentResource *models.Paymen
 }
 
 // CreateRefund indicates an expected call of CreateRefund.
-func (mr *MockPaymentProviderServiceMockRecorder) CreateRefund(paymentResource, refundRequest interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) CreateRefund(ctx, paymentResource, refundRequest interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefund", reflect.TypeOf((*MockPaymentProviderService)(nil).CreateRefund), paymentResource, refundRequest)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRefund", reflect.TypeOf((*MockPaymentProviderService)(nil).CreateRefund), ctx, paymentResource, refundRequest)
 }
 
 // GetCapturedPaymentDetails mocks base method.
-func (m *MockPaymentProviderService) GetCapturedPaymentDetails(id string) (*v4.CaptureDetailsResponse, error) {
+func (m *MockPaymentProviderService) GetCapturedPaymentDetails(ctx context.Context, id string) (*v4.CaptureDetailsResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCapturedPaymentDetails", id)
+	ret := m.ctrl.Call(m, "GetCapturedPaymentDetails", ctx, id)
 	ret0, _ := ret[0].(*v4.CaptureDetailsResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCapturedPaymentDetails indicates an expected call of GetCapturedPaymentDetails.
-func (mr *MockPaymentProviderServiceMockRecorder) GetCapturedPaymentDetails(id interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) GetCapturedPaymentDetails(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCapturedPaymentDetails", reflect.TypeOf((*MockPaymentProviderService)(nil).GetCapturedPaymentDetails), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCapturedPaymentDetails", reflect.TypeOf((*MockPaymentProviderService)(nil).GetCapturedPaymentDetails), ctx, id)
 }
 
 // GetPaymentDetails mocks base method.
-func (m *MockPaymentProviderService) GetPaymentDetails(paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
+func (m *MockPaymentProviderService) GetPaymentDetails(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPaymentDetails", paymentResource)
+	ret := m.ctrl.Call(m, "GetPaymentDetails", ctx, paymentResource)
 	ret0, _ := ret[0].(*models.PaymentDetails)
 	ret1, _ := ret[1].(ResponseType)
 	ret2, _ := ret[2].(error)
@@ -126,15 +127,15 @@ func (m *MockPaymentProviderService) GetPaymentDetails(paymentResource *models.P
 }
 
 // GetPaymentDetails indicates an expected call of GetPaymentDetails.
-func (mr *MockPaymentProviderServiceMockRecorder) GetPaymentDetails(paymentResource interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) GetPaymentDetails(ctx, paymentResource interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentDetails", reflect.TypeOf((*MockPaymentProviderService)(nil).GetPaymentDetails), paymentResource)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPaymentDetails", reflect.TypeOf((*MockPaymentProviderService)(nil).GetPaymentDetails), ctx, paymentResource)
 }
 
 // GetRefundStatus mocks base method.
-func (m *MockPaymentProviderService) GetRefundStatus(paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+func (m *MockPaymentProviderService) GetRefundStatus(ctx context.Context, paymentResource *models.PaymentResourceRest, refundId string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetRefundStatus", paymentResource, refundId)
+	ret := m.ctrl.Call(m, "GetRefundStatus", ctx, paymentResource, refundId)
 	ret0, _ := ret[0].(*models.CreateRefundGovPayResponse)
 	ret1, _ := ret[1].(ResponseType)
 	ret2, _ := ret[2].(error)
@@ -142,9 +143,9 @@ func (m *MockPaymentProviderService) GetRefundStatus(paymentResource *models.Pay
 }
 
 // GetRefundStatus indicates an expected call of GetRefundStatus.
-func (mr *MockPaymentProviderServiceMockRecorder) GetRefundStatus(paymentResource, refundId interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) GetRefundStatus(ctx, paymentResource, refundId interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefundStatus", reflect.TypeOf((*MockPaymentProviderService)(nil).GetRefundStatus), paymentResource, refundId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefundStatus", reflect.TypeOf((*MockPaymentProviderService)(nil).GetRefundStatus), ctx, paymentResource, refundId)
 }
 
 // GetRefundSummary mocks base method.
@@ -165,16 +166,16 @@ func (mr *MockPaymentProviderServiceMockRecorder) GetRefundSummary(req, id inter
 }
 
 // RefundCapture mocks base method.
-func (m *MockPaymentProviderService) RefundCapture(captureID string) (*v4.RefundResponse, error) {
+func (m *MockPaymentProviderService) RefundCapture(ctx context.Context, captureID string) (*v4.RefundResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RefundCapture", captureID)
+	ret := m.ctrl.Call(m, "RefundCapture", ctx, captureID)
 	ret0, _ := ret[0].(*v4.RefundResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // RefundCapture indicates an expected call of RefundCapture.
-func (mr *MockPaymentProviderServiceMockRecorder) RefundCapture(captureID interface{}) *gomock.Call {
+func (mr *MockPaymentProviderServiceMockRecorder) RefundCapture(ctx, captureID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundCapture", reflect.TypeOf((*MockPaymentProviderService)(nil).RefundCapture), captureID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundCapture", reflect.TypeOf((*MockPaymentProviderService)(nil).RefundCapture), ctx, captureID)
 }
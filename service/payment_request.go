@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// PaymentRequestKind is the value returned in the payment request kind field
+const PaymentRequestKind = "payment-request#payment-request"
+
+// paymentRequestProductType is the product type and description identifier of the cost of every payment request
+const paymentRequestProductType = "payment-request"
+
+// CreatePaymentRequest raises a payment request for an ad-hoc charge. The payer is sent the request's journey link,
+// which creates a payment session for the request's resource and takes them through the normal payment journey.
+func (service *PaymentService) CreatePaymentRequest(req *http.Request, incomingPaymentRequest models.IncomingPaymentRequest, createdBy string) (*models.PaymentRequestRest, ResponseType, error) {
+	err := validator.New().Struct(incomingPaymentRequest)
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid payment request: [%v]", err)
+	}
+
+	amount, err := getTotalAmount(&[]models.CostResourceRest{{Amount: incomingPaymentRequest.Amount}})
+	if err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid payment request amount: [%v]", err)
+	}
+	if amount == "0.00" {
+		return nil, InvalidData, errors.New("invalid payment request amount: [amount must be greater than zero]")
+	}
+
+	if _, err := service.Config.GovPayAccountForClass(incomingPaymentRequest.ClassOfPayment); err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid class of payment: [%v]", err)
+	}
+
+	id := helpers.GenerateID()
+	paymentRequest := models.PaymentRequestDB{
+		ID:             id,
+		Amount:         amount,
+		ClassOfPayment: incomingPaymentRequest.ClassOfPayment,
+		Description:    incomingPaymentRequest.Description,
+		CompanyNumber:  incomingPaymentRequest.CompanyNumber,
+		CreatedAt:      helpers.MongoNow(),
+		CreatedBy:      createdBy,
+		Links: models.PaymentRequestLinksDB{
+			Self:     fmt.Sprintf("admin/payments/payment-requests/%s", id),
+			Journey:  fmt.Sprintf("%s/payment-requests/%s", service.Config.PaymentsWebURL, id),
+			Resource: paymentRequestResource(&service.Config, id),
+		},
+	}
+
+	err = service.DAO.CreatePaymentRequest(req.Context(), &paymentRequest)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error writing payment request to DB: [%v]", err)
+	}
+
+	log.InfoR(req, "payment request created", log.Data{"payment_request_id": id, "created_by": createdBy})
+
+	paymentRequestRest := transformPaymentRequestToRest(paymentRequest)
+	return &paymentRequestRest, Success, nil
+}
+
+// GetPaymentRequest retrieves a payment request
+func (service *PaymentService) GetPaymentRequest(req *http.Request, id string) (*models.PaymentRequestRest, ResponseType, error) {
+	paymentRequest, err := service.DAO.GetPaymentRequest(req.Context(), id)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting payment request from DB: [%v]", err)
+	}
+	if paymentRequest == nil {
+		return nil, NotFound, nil
+	}
+
+	paymentRequestRest := transformPaymentRequestToRest(*paymentRequest)
+	return &paymentRequestRest, Success, nil
+}
+
+// GetPaymentRequestCosts returns the costs of a payment request, as served from its resource
+func (service *PaymentService) GetPaymentRequestCosts(req *http.Request, id string) (*models.CostsRest, ResponseType, error) {
+	return service.getPaymentRequestCosts(req.Context(), paymentRequestResource(&service.Config, id), id)
+}
+
+// getResourceCosts returns the costs of a payment session's resource. The costs of payment requests are built from
+// the stored request, and all other costs are fetched from the resource.
+func (service *PaymentService) getResourceCosts(ctx context.Context, resource string) (*models.CostsRest, ResponseType, error) {
+	if id, ok := paymentRequestID(resource, &service.Config); ok {
+		return service.getPaymentRequestCosts(ctx, resource, id)
+	}
+	return getCosts(ctx, resource, &service.Config, service.SecureCostsRegex)
+}
+
+// getPaymentRequestCosts returns the costs of a payment request, in the form a cost resource would return them
+func (service *PaymentService) getPaymentRequestCosts(ctx context.Context, resource, id string) (*models.CostsRest, ResponseType, error) {
+	paymentRequest, err := service.DAO.GetPaymentRequest(ctx, id)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error getting payment request: [%v]", err)
+	}
+	if paymentRequest == nil {
+		return nil, CostsNotFound, fmt.Errorf("error getting Cost Resource - payment request [%s] not found", id)
+	}
+
+	return &models.CostsRest{
+		Description: paymentRequest.Description,
+		Costs: []models.CostResourceRest{
+			{
+				Amount:                  paymentRequest.Amount,
+				AvailablePaymentMethods: []string{PaymentMethodCreditCard},
+				ClassOfPayment:          []string{paymentRequest.ClassOfPayment},
+				Description:             paymentRequest.Description,
+				DescriptionIdentifier:   paymentRequestProductType,
+				ProductType:             paymentRequestProductType,
+			},
+		},
+		Links:         models.PaymentLinksRest{Resource: resource, Self: resource},
+		CompanyNumber: paymentRequest.CompanyNumber,
+	}, Success, nil
+}
+
+// paymentRequestResource returns the resource payment sessions for a payment request are created with
+func paymentRequestResource(cfg *config.Config, id string) string {
+	return fmt.Sprintf("%s/payment-requests/%s/costs", cfg.PaymentsAPIURL, id)
+}
+
+// paymentRequestID returns the ID of the payment request a resource is for, or false if it isn't a payment request's
+// resource
+func paymentRequestID(resource string, cfg *config.Config) (string, bool) {
+	if cfg.PaymentsAPIURL == "" {
+		return "", false
+	}
+	id, ok := strings.CutPrefix(resource, cfg.PaymentsAPIURL+"/payment-requests/")
+	if !ok {
+		return "", false
+	}
+	id, ok = strings.CutSuffix(id, "/costs")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+func transformPaymentRequestToRest(paymentRequest models.PaymentRequestDB) models.PaymentRequestRest {
+	return models.PaymentRequestRest{
+		Amount:         paymentRequest.Amount,
+		ClassOfPayment: paymentRequest.ClassOfPayment,
+		Description:    paymentRequest.Description,
+		CompanyNumber:  paymentRequest.CompanyNumber,
+		CreatedAt:      paymentRequest.CreatedAt,
+		CreatedBy:      paymentRequest.CreatedBy,
+		Kind:           PaymentRequestKind,
+		Links:          models.PaymentRequestLinksRest(paymentRequest.Links),
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCreatePaymentRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	cfg.PaymentsWebURL = "https://payments.companieshouse.gov.uk"
+	cfg.PaymentsAPIURL = "https://api.companieshouse.gov.uk"
+
+	validPaymentRequest := models.IncomingPaymentRequest{
+		Amount:         "25",
+		ClassOfPayment: "data-maintenance",
+		Description:    "Dishonoured cheque fee",
+		CompanyNumber:  "00006400",
+	}
+
+	Convey("Invalid payment requests", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		testCases := []struct {
+			description string
+			update      func(*models.IncomingPaymentRequest)
+			expectedErr string
+		}{
+			{"missing description", func(r *models.IncomingPaymentRequest) { r.Description = "" }, "invalid payment request"},
+			{"badly formatted amount", func(r *models.IncomingPaymentRequest) { r.Amount = "25.5" }, "invalid payment request amount: [amount [25.5] format incorrect]"},
+			{"zero amount", func(r *models.IncomingPaymentRequest) { r.Amount = "0.00" }, "invalid payment request amount: [amount must be greater than zero]"},
+			{"unknown class of payment", func(r *models.IncomingPaymentRequest) { r.ClassOfPayment = "unknown" }, "invalid class of payment: [payment class [unknown] not recognised]"},
+		}
+
+		for _, tc := range testCases {
+			Convey(tc.description, func() {
+				paymentRequest := validPaymentRequest
+				tc.update(&paymentRequest)
+
+				paymentRequestRest, responseType, err := mockPaymentService.CreatePaymentRequest(req, paymentRequest, "admin@companieshouse.gov.uk")
+				So(paymentRequestRest, ShouldBeNil)
+				So(responseType, ShouldEqual, InvalidData)
+				So(err.Error(), ShouldStartWith, tc.expectedErr)
+			})
+		}
+	})
+
+	Convey("Error writing payment request to DB", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CreatePaymentRequest(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentRequestRest, responseType, err := mockPaymentService.CreatePaymentRequest(req, validPaymentRequest, "admin@companieshouse.gov.uk")
+		So(paymentRequestRest, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error writing payment request to DB: [error]")
+	})
+
+	Convey("Payment request created", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		var paymentRequestDB *models.PaymentRequestDB
+		mock.EXPECT().CreatePaymentRequest(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, paymentRequest *models.PaymentRequestDB) error {
+			paymentRequestDB = paymentRequest
+			return nil
+		})
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		paymentRequestRest, responseType, err := mockPaymentService.CreatePaymentRequest(req, validPaymentRequest, "admin@companieshouse.gov.uk")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+
+		id := paymentRequestDB.ID
+		So(id, ShouldNotBeEmpty)
+		So(paymentRequestDB.Amount, ShouldEqual, "25.00")
+		So(paymentRequestDB.CreatedBy, ShouldEqual, "admin@companieshouse.gov.uk")
+		So(paymentRequestRest.Amount, ShouldEqual, "25.00")
+		So(paymentRequestRest.Kind, ShouldEqual, PaymentRequestKind)
+		So(paymentRequestRest.Links, ShouldResemble, models.PaymentRequestLinksRest{
+			Self:     "admin/payments/payment-requests/" + id,
+			Journey:  "https://payments.companieshouse.gov.uk/payment-requests/" + id,
+			Resource: "https://api.companieshouse.gov.uk/payment-requests/" + id + "/costs",
+		})
+	})
+}
+
+func TestUnitGetPaymentRequest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error getting payment request from DB", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, errors.New("error"))
+
+		paymentRequest, responseType, err := mockPaymentService.GetPaymentRequest(httptest.NewRequest("GET", "/test", nil), "1234")
+		So(paymentRequest, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting payment request from DB: [error]")
+	})
+
+	Convey("Payment request not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, nil)
+
+		paymentRequest, responseType, err := mockPaymentService.GetPaymentRequest(httptest.NewRequest("GET", "/test", nil), "1234")
+		So(paymentRequest, ShouldBeNil)
+		So(responseType, ShouldEqual, NotFound)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payment request found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(&models.PaymentRequestDB{ID: "1234", Amount: "25.00"}, nil)
+
+		paymentRequest, responseType, err := mockPaymentService.GetPaymentRequest(httptest.NewRequest("GET", "/test", nil), "1234")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(paymentRequest.Amount, ShouldEqual, "25.00")
+	})
+}
+
+func TestUnitGetPaymentRequestCosts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	c := *cfg
+	c.PaymentsAPIURL = "https://api.companieshouse.gov.uk"
+
+	Convey("Costs are served for the payment request's resource", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, &c)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(&models.PaymentRequestDB{ID: "1234", Amount: "25.00"}, nil)
+
+		costs, responseType, err := mockPaymentService.GetPaymentRequestCosts(httptest.NewRequest("GET", "/test", nil), "1234")
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(costs.Links.Self, ShouldEqual, "https://api.companieshouse.gov.uk/payment-requests/1234/costs")
+		So(costs.Costs[0].Amount, ShouldEqual, "25.00")
+	})
+}
+
+func TestUnitGetResourceCosts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	cfg.PaymentsAPIURL = "https://api.companieshouse.gov.uk"
+	resource := "https://api.companieshouse.gov.uk/payment-requests/1234/costs"
+
+	Convey("Error getting payment request", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, errors.New("error"))
+
+		costs, responseType, err := mockPaymentService.getResourceCosts(context.Background(), resource)
+		So(costs, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting payment request: [error]")
+	})
+
+	Convey("Payment request not found", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(nil, nil)
+
+		costs, responseType, err := mockPaymentService.getResourceCosts(context.Background(), resource)
+		So(costs, ShouldBeNil)
+		So(responseType, ShouldEqual, CostsNotFound)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Costs built from the payment request", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentRequest(gomock.Any(), "1234").Return(&models.PaymentRequestDB{
+			ID:             "1234",
+			Amount:         "25.00",
+			ClassOfPayment: "data-maintenance",
+			Description:    "Dishonoured cheque fee",
+			CompanyNumber:  "00006400",
+		}, nil)
+
+		costs, responseType, err := mockPaymentService.getResourceCosts(context.Background(), resource)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(costs.CompanyNumber, ShouldEqual, "00006400")
+		So(costs.Links.Resource, ShouldEqual, resource)
+		So(costs.Costs, ShouldHaveLength, 1)
+		So(validateCosts(&costs.Costs), ShouldBeNil)
+		So(costs.Costs[0].Amount, ShouldEqual, "25.00")
+		So(costs.Costs[0].ClassOfPayment, ShouldResemble, []string{"data-maintenance"})
+		So(costs.Costs[0].AvailablePaymentMethods, ShouldResemble, []string{PaymentMethodCreditCard})
+	})
+}
+
+func TestUnitPaymentRequestID(t *testing.T) {
+	cfg := &config.Config{Settings: config.Settings{PaymentsAPIURL: "https://api.companieshouse.gov.uk"}}
+
+	Convey("Payment request resources are recognised", t, func() {
+		testCases := []struct {
+			resource   string
+			expectedID string
+			expectedOK bool
+		}{
+			{"https://api.companieshouse.gov.uk/payment-requests/1234/costs", "1234", true},
+			{"https://api.companieshouse.gov.uk/payment-requests/1234", "", false},
+			{"https://api.companieshouse.gov.uk/payment-requests//costs", "", false},
+			{"https://api.companieshouse.gov.uk/payment-requests/1234/other/costs", "", false},
+			{"https://other.gov.uk/payment-requests/1234/costs", "", false},
+		}
+
+		for _, tc := range testCases {
+			id, ok := paymentRequestID(tc.resource, cfg)
+			So(id, ShouldEqual, tc.expectedID)
+			So(ok, ShouldEqual, tc.expectedOK)
+		}
+	})
+
+	Convey("Payment request resources don't need their domain allowing", t, func() {
+		allowListCfg := *cfg
+		allowListCfg.DomainAllowList = []string{"http://dummy-resource"}
+		allowListCfg.RedirectAllowList = []string{"http://dummy-resource"}
+
+		request := models.IncomingPaymentResourceRequest{
+			Resource:    "https://api.companieshouse.gov.uk/payment-requests/1234/costs",
+			RedirectURI: "http://dummy-resource",
+			State:       "state",
+		}
+		So(validateIncomingPayment(request, &allowListCfg, ""), ShouldBeNil)
+	})
+}
@@ -2,15 +2,18 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/companieshouse/chs.go/authentication"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
 	"github.com/golang/mock/gomock"
 	"github.com/jarcoal/httpmock"
@@ -46,6 +49,13 @@ func createMockPaymentService(mockDAO *dao.MockDAO, cfg *config.Config) PaymentS
 	}
 }
 
+// allowResourceClaims lets the claims payment sessions hold on their cost resources be taken and given up, for tests
+// which aren't about the claims
+func allowResourceClaims(mockDAO *dao.MockDAO) {
+	mockDAO.EXPECT().ClaimResource(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+	mockDAO.EXPECT().ReleaseResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+}
+
 func TestUnitPaymentStatus(t *testing.T) {
 	Convey("Payment Status", t, func() {
 		status := Pending.String()
@@ -57,8 +67,9 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	cfg, _ := config.Get()
-	cfg.DomainAllowList = "http://dummy-url"
-	cfg.ExpiryTimeInMinutes = "90"
+	cfg.DomainAllowList = []string{"http://dummy-url"}
+	cfg.RedirectAllowList = []string{"http://www.companieshouse.gov.uk"}
+	cfg.ExpiryTimeInMinutes = 90
 
 	Convey("Empty Request Body", t, func() {
 		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), cfg)
@@ -67,7 +78,7 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		paymentResourceRest, status, err := mockPaymentService.CreatePaymentSession(req, models.IncomingPaymentResourceRequest{})
 		So(paymentResourceRest, ShouldBeNil)
 		So(status, ShouldEqual, InvalidData)
-		So(err.Error(), ShouldEqual, "invalid incoming payment: [Key: 'IncomingPaymentResourceRequest.RedirectURI' Error:Field validation for 'RedirectURI' failed on the 'required' tag\nKey: 'IncomingPaymentResourceRequest.Resource' Error:Field validation for 'Resource' failed on the 'required' tag\nKey: 'IncomingPaymentResourceRequest.State' Error:Field validation for 'State' failed on the 'required' tag]")
+		So(err.Error(), ShouldEqual, "invalid incoming payment: [Key: 'IncomingPaymentResourceRequest.RedirectURI' Error:Field validation for 'RedirectURI' failed on the 'required' tag\nKey: 'IncomingPaymentResourceRequest.Resource' Error:Field validation for 'Resource' failed on the 'required_without' tag\nKey: 'IncomingPaymentResourceRequest.State' Error:Field validation for 'State' failed on the 'required' tag]")
 	})
 
 	Convey("Empty Request Body", t, func() {
@@ -142,10 +153,42 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		So(err.Error(), ShouldEqual, "error getting amount from costs: [amount [invalid_amount] format incorrect]")
 	})
 
+	Convey("Class of payment without a GovPay account", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		costResource := defaultCost
+		costResource.ClassOfPayment = []string{"penalty-unknown"}
+		costs := models.CostsRest{
+			Costs: []models.CostResourceRest{costResource},
+		}
+		jsonResponse, _ := httpmock.NewJsonResponder(200, costs)
+		httpmock.RegisterResponder("GET", "http://dummy-url", jsonResponse)
+
+		authUserDetails := authentication.AuthUserDetails{
+			ID: "identity",
+		}
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, authUserDetails)
+
+		resource := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-url",
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		}
+		paymentResourceRest, status, err := mockPaymentService.CreatePaymentSession(req.WithContext(ctx), resource)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "invalid class of payment: [payment class [penalty-unknown] not recognised]")
+	})
+
 	Convey("Error Creating DB Resource", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().CreatePaymentResource(gomock.Any()).Return(fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
 
 		req := httptest.NewRequest("Get", "/test", nil)
 
@@ -175,7 +218,8 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 	Convey("Valid request - single cost", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().CreatePaymentResource(gomock.Any())
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
 
 		req := httptest.NewRequest("Get", "/test", nil)
 
@@ -220,7 +264,7 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		So(paymentResourceRest.Status, ShouldEqual, "pending")
 		So(paymentResourceRest.Costs, ShouldResemble, defaultCosts.Costs)
 		So(paymentResourceRest.MetaData, ShouldResemble, models.PaymentResourceMetaDataRest{
-			ID:                       "",
+			ID:                       strings.TrimPrefix(paymentResourceRest.Links.Self, "payments/"),
 			RedirectURI:              "",
 			State:                    "",
 			ExternalPaymentStatusURI: "",
@@ -233,7 +277,8 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 	Convey("Valid request - multiple costs", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().CreatePaymentResource(gomock.Any())
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
 		req := httptest.NewRequest("Get", "/test", nil)
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -278,7 +323,7 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		So(paymentResourceRest.Status, ShouldEqual, "pending")
 		So(paymentResourceRest.Costs, ShouldResemble, []models.CostResourceRest{defaultCost, defaultCost})
 		So(paymentResourceRest.MetaData, ShouldResemble, models.PaymentResourceMetaDataRest{
-			ID:                       "",
+			ID:                       strings.TrimPrefix(paymentResourceRest.Links.Self, "payments/"),
 			RedirectURI:              "",
 			State:                    "",
 			ExternalPaymentStatusURI: "",
@@ -288,10 +333,53 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 
+	Convey("Valid request - Welsh journey with prefilled cardholder details", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		var paymentResourceDB *models.PaymentResourceDB
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, resource *models.PaymentResourceDB) error {
+			paymentResourceDB = resource
+			return nil
+		})
+
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-url", jsonResponse)
+
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		resource := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-url",
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+			Language:    "cy",
+			PrefilledCardholderDetails: &models.PrefilledCardholderDetails{
+				CardholderName: "J Bloggs",
+				BillingAddress: &models.BillingAddress{Postcode: "CF14 3UZ"},
+			},
+		}
+
+		paymentResourceRest, status, err := mockPaymentService.CreatePaymentSession(req.WithContext(ctx), resource)
+
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Language, ShouldEqual, "cy")
+		So(paymentResourceDB.Data.Language, ShouldEqual, "cy")
+		So(paymentResourceDB.PrefilledCardholderDetails, ShouldResemble, &models.PrefilledCardholderDetailsDB{
+			CardholderName: "J Bloggs",
+			BillingAddress: &models.BillingAddressDB{Postcode: "CF14 3UZ"},
+		})
+	})
+
 	Convey("Valid request - API Key", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().CreatePaymentResource(gomock.Any())
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
 		req := httptest.NewRequest("Get", "/test", nil)
 		req.Header.Set("ERIC-Identity-Type", authentication.APIKeyIdentityType) // Set API Key auth for this test
 		httpmock.Activate()
@@ -338,7 +426,7 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		So(paymentResourceRest.Status, ShouldEqual, "pending")
 		So(paymentResourceRest.Costs, ShouldResemble, []models.CostResourceRest{defaultCost, defaultCost})
 		So(paymentResourceRest.MetaData, ShouldResemble, models.PaymentResourceMetaDataRest{
-			ID:                       "",
+			ID:                       strings.TrimPrefix(paymentResourceRest.Links.Self, "payments/"),
 			RedirectURI:              "",
 			State:                    "",
 			ExternalPaymentStatusURI: "",
@@ -347,6 +435,286 @@ func TestUnitCreatePaymentSession(t *testing.T) {
 		So(status, ShouldEqual, Success)
 		So(err, ShouldBeNil)
 	})
+
+	Convey("Valid request - nothing to pay", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mockPaymentService.Config.PaymentsAPIURL = "https://api.companieshouse.gov.uk"
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		gomock.InOrder(
+			mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, paymentResource *models.PaymentResourceDB) error {
+					So(paymentResource.Data.Status, ShouldEqual, InProgress.String())
+					So(paymentResource.Data.PaymentMethod, ShouldEqual, PaymentMethodNoPaymentRequired)
+					return nil
+				}),
+			mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _ string, update *models.PaymentResourceDB) (bool, error) {
+					So(update.Data.Status, ShouldEqual, Paid.String())
+					So(update.Data.CompletedAt, ShouldNotBeZeroValue)
+					So(update.MessagesPending, ShouldResemble, []string{""})
+					return true, nil
+				}),
+		)
+		req := httptest.NewRequest("Get", "/test", nil)
+		req.Header.Set("ERIC-Identity-Type", authentication.APIKeyIdentityType)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		costs := defaultCosts
+		freeCost := defaultCost
+		freeCost.Amount = "0"
+		costs.Costs = []models.CostResourceRest{freeCost, freeCost}
+		jsonResponse, _ := httpmock.NewJsonResponder(200, costs)
+		httpmock.RegisterResponder("GET", "http://dummy-url", jsonResponse)
+
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		resource := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-url",
+			Reference:   "ref",
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		}
+
+		paymentResourceRest, status, err := mockPaymentService.CreatePaymentSession(req.WithContext(ctx), resource)
+
+		So(status, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(paymentResourceRest.Amount, ShouldEqual, "0.00")
+		So(paymentResourceRest.Status, ShouldEqual, Paid.String())
+		So(paymentResourceRest.PaymentMethod, ShouldEqual, PaymentMethodNoPaymentRequired)
+		So(paymentResourceRest.CompletedAt, ShouldNotBeZeroValue)
+		So(paymentResourceRest.Links.Journey, ShouldEqual, "https://api.companieshouse.gov.uk/callback/payments/no-payment-required/"+paymentResourceRest.MetaData.ID)
+	})
+
+	Convey("Valid request - nothing to pay, but the session can't be completed yet", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), gomock.Any(), "", gomock.Any()).Return(false, fmt.Errorf("error"))
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		costs := defaultCosts
+		freeCost := defaultCost
+		freeCost.Amount = "0"
+		costs.Costs = []models.CostResourceRest{freeCost}
+		jsonResponse, _ := httpmock.NewJsonResponder(200, costs)
+		httpmock.RegisterResponder("GET", "http://dummy-url", jsonResponse)
+
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		resource := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-url",
+			Reference:   "ref",
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		}
+
+		paymentResourceRest, status, err := mockPaymentService.CreatePaymentSession(req.WithContext(ctx), resource)
+
+		So(status, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(paymentResourceRest.Status, ShouldEqual, InProgress.String())
+		So(paymentResourceRest.PaymentMethod, ShouldEqual, PaymentMethodNoPaymentRequired)
+		So(paymentResourceRest.CompletedAt, ShouldBeZeroValue)
+	})
+
+	cfg.GovPayExpiryTime = 90
+
+	duplicateRequest := func(mock *dao.MockDAO, costs models.CostsRest) (*models.PaymentResourceRest, ResponseType, error) {
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, costs)
+		httpmock.RegisterResponder("GET", "http://dummy-url", jsonResponse)
+
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		resource := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-url",
+			RedirectURI: "http://www.companieshouse.gov.uk",
+			State:       "state",
+		}
+		return mockPaymentService.CreatePaymentSession(req.WithContext(ctx), resource)
+	}
+
+	existingSession := func(id, status, externalPaymentStatusURI string, createdAt time.Time) models.PaymentResourceDB {
+		return models.PaymentResourceDB{
+			ID:                       id,
+			ExternalPaymentStatusURI: externalPaymentStatusURI,
+			Data: models.PaymentResourceDataDB{
+				Status:    status,
+				CreatedAt: createdAt,
+				Links: models.PaymentLinksDB{
+					Journey:  "https://payments.companieshouse.gov.uk/payments/" + id + "/pay",
+					Resource: "http://dummy-url",
+					Self:     "payments/" + id,
+				},
+			},
+		}
+	}
+
+	Convey("Error getting existing payment sessions for the resource", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", []string{"paid", "in-progress", "awaiting-transfer", "underpaid", "overpaid"}).Return(nil, fmt.Errorf("error"))
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error getting existing payment sessions for resource: [error]")
+	})
+
+	Convey("Cost resource reports that it has been paid", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		costs := defaultCosts
+		costs.Status = "paid"
+
+		paymentResourceRest, status, err := duplicateRequest(mock, costs)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url] has already been paid")
+		var duplicateErr *DuplicatePaymentError
+		So(errors.As(err, &duplicateErr), ShouldBeTrue)
+		So(duplicateErr.Links, ShouldBeNil)
+	})
+
+	Convey("Existing paid session is linked in preference to a live one", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{
+			existingSession("live", "in-progress", "https://publicapi.payments.service.gov.uk/v1/payments/live", time.Now()),
+			existingSession("paid", "paid", "https://publicapi.payments.service.gov.uk/v1/payments/paid", time.Now().Add(-time.Hour*24)),
+		}, nil)
+		costs := defaultCosts
+		costs.Status = "paid"
+
+		paymentResourceRest, status, err := duplicateRequest(mock, costs)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url] already has payment session [payments/paid] with status [paid]")
+		var duplicateErr *DuplicatePaymentError
+		So(errors.As(err, &duplicateErr), ShouldBeTrue)
+		So(duplicateErr.Links.Journey, ShouldEqual, "https://payments.companieshouse.gov.uk/payments/paid/pay")
+	})
+
+	Convey("Existing session with a live external journey", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{
+			existingSession("live", "in-progress", "https://publicapi.payments.service.gov.uk/v1/payments/live", time.Now().Add(-time.Minute*10)),
+		}, nil)
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url] already has payment session [payments/live] with status [in-progress]")
+		var duplicateErr *DuplicatePaymentError
+		So(errors.As(err, &duplicateErr), ShouldBeTrue)
+		So(duplicateErr.Links.Self, ShouldEqual, "payments/live")
+	})
+
+	Convey("Existing session whose latest external journey is live", t, func() {
+		extended := existingSession("extended", "in-progress", "https://publicapi.payments.service.gov.uk/v1/payments/latest", time.Now().Add(-time.Hour*3))
+		extended.Data.ExpiresAt = time.Now().Add(time.Hour)
+		extended.ExternalPaymentAttempts = []models.ExternalPaymentAttemptDB{
+			{ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/first", CreatedAt: time.Now().Add(-time.Hour * 3)},
+			{ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/latest", CreatedAt: time.Now().Add(-time.Minute * 10)},
+		}
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{extended}, nil)
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url] already has payment session [payments/extended] with status [in-progress]")
+	})
+
+	Convey("Existing session whose latest external journey has expired", t, func() {
+		extended := existingSession("extended", "in-progress", "https://publicapi.payments.service.gov.uk/v1/payments/latest", time.Now().Add(-time.Hour*3))
+		extended.Data.ExpiresAt = time.Now().Add(time.Hour)
+		extended.ExternalPaymentAttempts = []models.ExternalPaymentAttemptDB{
+			{ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/latest", CreatedAt: time.Now().Add(-time.Hour * 2)},
+		}
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{extended}, nil)
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Status, ShouldEqual, "pending")
+	})
+
+	Convey("In progress sessions without a live external journey don't stop a new session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{
+			existingSession("not-started", "in-progress", "", time.Now()),
+			existingSession("expired", "in-progress", "https://publicapi.payments.service.gov.uk/v1/payments/expired", time.Now().Add(-time.Hour*2)),
+		}, nil)
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Status, ShouldEqual, "pending")
+	})
+
+	Convey("Sessions past the expiry stored on them don't stop a new session", t, func() {
+		expired := existingSession("expired", "in-progress", "https://publicapi.payments.service.gov.uk/v1/payments/expired", time.Now().Add(-time.Minute*20))
+		expired.Data.ExpiresAt = time.Now().Add(-time.Minute * 5)
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{expired}, nil)
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Status, ShouldEqual, "pending")
+	})
+
+	Convey("Existing session awaiting a bank transfer", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		transfer := existingSession("transfer", "awaiting-transfer", "", time.Now().Add(-time.Hour*24*3))
+		transfer.Data.ExpiresAt = time.Now().Add(time.Hour * 24)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{transfer}, nil)
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url] already has payment session [payments/transfer] with status [awaiting-transfer]")
+	})
+
+	Convey("Existing session which expired awaiting a bank transfer doesn't stop a new session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		transfer := existingSession("transfer", "awaiting-transfer", "", time.Now().Add(-time.Hour*24*15))
+		transfer.Data.ExpiresAt = time.Now().Add(-time.Hour * 24)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{transfer}, nil)
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.Status, ShouldEqual, "pending")
+	})
+
+	Convey("Existing overpaid session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any()).Return([]models.PaymentResourceDB{
+			existingSession("overpaid", "overpaid", "", time.Now().Add(-time.Hour*24)),
+		}, nil)
+
+		paymentResourceRest, status, err := duplicateRequest(mock, defaultCosts)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-url] already has payment session [payments/overpaid] with status [overpaid]")
+	})
 }
 
 func TestUnitPatchPaymentSession(t *testing.T) {
@@ -358,7 +726,7 @@ func TestUnitPatchPaymentSession(t *testing.T) {
 	Convey("Error Finding Payment Resource From GET Request", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
 		req := httptest.NewRequest("Get", "/test", nil)
 
 		httpmock.Activate()
@@ -373,13 +741,13 @@ func TestUnitPatchPaymentSession(t *testing.T) {
 		So(err.Error(), ShouldStartWith, "error getting payment resource to patch:")
 	})
 
-	cfg.DomainAllowList = "http://dummy-resource"
+	cfg.DomainAllowList = []string{"http://dummy-resource"}
 
 	Convey("Error Patching Payment Resource", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 		req := httptest.NewRequest("Get", "/test", nil)
 
 		httpmock.Activate()
@@ -396,8 +764,8 @@ func TestUnitPatchPaymentSession(t *testing.T) {
 	Convey("Successful Patch Payment Resource", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().PatchPaymentResource("1234", gomock.Any()).Return(nil)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00", Status: Pending.String(), Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00", Status: Pending.String(), Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 		req := httptest.NewRequest("Get", "/test", nil)
 
 		httpmock.Activate()
@@ -414,6 +782,429 @@ func TestUnitPatchPaymentSession(t *testing.T) {
 		So(err, ShouldBeNil)
 
 	})
+
+	failedSession := &models.PaymentResourceDB{ID: "1234", Data: models.PaymentResourceDataDB{Amount: "10.00", Status: "failed_payment-cancelled-by-user", PaymentMethod: "credit-card", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}
+
+	Convey("Session whose last attempt failed is updated with the new payment method and left failed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(failedSession, nil)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, _ []string, update *models.PaymentResourceDB) (bool, error) {
+				So(update.Data.Status, ShouldBeEmpty)
+				So(update.Data.PaymentMethod, ShouldEqual, "PayPal")
+				return true, nil
+			})
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		responseType, err := mockPaymentService.PatchPaymentSession(req, "1234", models.PaymentResourceRest{PaymentMethod: "PayPal"})
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Session whose last attempt failed is no longer awaiting a retry", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(failedSession, nil)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).Return(false, nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		responseType, err := mockPaymentService.PatchPaymentSession(req, "1234", models.PaymentResourceRest{PaymentMethod: "PayPal"})
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session is no longer awaiting a retry")
+	})
+
+	Convey("Error reopening session whose last attempt failed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(failedSession, nil)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).Return(false, fmt.Errorf("error"))
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		responseType, err := mockPaymentService.PatchPaymentSession(req, "1234", models.PaymentResourceRest{PaymentMethod: "PayPal"})
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error reopening payment session on database: [error]")
+	})
+
+	Convey("Session whose last attempt failed is expired rather than reopened", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(failedSession, nil)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		responseType, err := mockPaymentService.PatchPaymentSession(req, "1234", models.PaymentResourceRest{Status: Expired.String()})
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestUnitNoPaymentRequired(t *testing.T) {
+	Convey("Only a pending session with nothing to pay requires no payment", t, func() {
+		So(NoPaymentRequired(&models.PaymentResourceRest{Amount: "0.00", Status: Pending.String()}), ShouldBeTrue)
+		So(NoPaymentRequired(&models.PaymentResourceRest{Amount: "0.00", Status: Paid.String()}), ShouldBeFalse)
+		So(NoPaymentRequired(&models.PaymentResourceRest{Amount: "10.00", Status: Pending.String()}), ShouldBeFalse)
+	})
+
+	Convey("Payment details of a session completed without a payment provider", t, func() {
+		completedAt := time.Date(2018, 11, 22, 8, 39, 16, 782000000, time.UTC)
+		paymentDetails := PaymentDetailsWithoutProvider(&models.PaymentResourceRest{CompletedAt: completedAt})
+		So(paymentDetails, ShouldResemble, &models.PaymentDetails{
+			TransactionDate: "2018-11-22T08:39:16.782Z",
+			PaymentStatus:   "accepted",
+		})
+	})
+}
+
+func TestUnitCompleteNoPaymentRequiredSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	req := httptest.NewRequest("PATCH", "/test", nil)
+
+	freeSession := func(status string) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Amount: "0.00",
+			Status: status,
+			Links:  models.PaymentLinksRest{Resource: "first", Resources: []string{"first", "second"}},
+			MetaData: models.PaymentResourceMetaDataRest{
+				ID: "1234",
+			},
+		}
+	}
+
+	Convey("Pending session is put in progress and completed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		gomock.InOrder(
+			mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).DoAndReturn(
+				func(_ context.Context, _ string, update *models.PaymentResourceDB) error {
+					So(update.Data.Status, ShouldEqual, InProgress.String())
+					So(update.Data.PaymentMethod, ShouldEqual, PaymentMethodNoPaymentRequired)
+					return nil
+				}),
+			mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).DoAndReturn(
+				func(_ context.Context, _, _ string, update *models.PaymentResourceDB) (bool, error) {
+					So(update.Data.Status, ShouldEqual, Paid.String())
+					So(update.Data.PaymentMethod, ShouldEqual, PaymentMethodNoPaymentRequired)
+					So(update.Data.CompletedAt, ShouldNotBeZeroValue)
+					So(update.MessagesPending, ShouldResemble, []string{"first", "second"})
+					return true, nil
+				}),
+		)
+
+		paymentSession := freeSession(Pending.String())
+		completed, responseType, err := mockPaymentService.CompleteNoPaymentRequiredSession(req, paymentSession)
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(paymentSession.Status, ShouldEqual, Paid.String())
+	})
+
+	Convey("Session whose completion failed is completed again", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+
+		completed, responseType, err := mockPaymentService.CompleteNoPaymentRequiredSession(req, freeSession(InProgress.String()))
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Session completed by another caller", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, nil)
+
+		completed, responseType, err := mockPaymentService.CompleteNoPaymentRequiredSession(req, freeSession(InProgress.String()))
+		So(completed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Error putting pending session in progress", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(fmt.Errorf("error"))
+
+		completed, responseType, err := mockPaymentService.CompleteNoPaymentRequiredSession(req, freeSession(Pending.String()))
+		So(completed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error patching payment session on database: [error]")
+	})
+
+	Convey("Error completing session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, fmt.Errorf("error"))
+
+		completed, responseType, err := mockPaymentService.CompleteNoPaymentRequiredSession(req, freeSession(InProgress.String()))
+		So(completed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error completing payment session on database: [error]")
+	})
+
+	Convey("Sessions with nothing to pay still to be completed", t, func() {
+		So(NoPaymentRequired(freeSession(Pending.String())), ShouldBeTrue)
+		So(NoPaymentRequired(freeSession(InProgress.String())), ShouldBeTrue)
+		So(NoPaymentRequired(freeSession(Paid.String())), ShouldBeFalse)
+		So(NoPaymentRequired(&models.PaymentResourceRest{Amount: "10.00", Status: Pending.String()}), ShouldBeFalse)
+	})
+}
+
+func TestUnitCompletePaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error completing payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, fmt.Errorf("error"))
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "", models.PaymentResourceRest{Status: Paid.String()})
+		So(completed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error completing payment session on database: [error]")
+	})
+
+	Convey("Duplicate payments raised for refund once the session is completed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+		mock.EXPECT().SetExternalPaymentAttemptOutcome(gomock.Any(), "1234", "duplicate", "refund-required").Return(true, nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "", models.PaymentResourceRest{
+			Status: Paid.String(),
+			MetaData: models.PaymentResourceMetaDataRest{
+				ExternalPaymentStatusURI: "paid",
+				ExternalPaymentAttempts: []models.ExternalPaymentAttempt{
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "duplicate", Outcome: "refund-required"},
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "failed", Outcome: "finished"},
+					{PaymentMethod: "credit-card", ExternalPaymentStatusURI: "paid"},
+				},
+			},
+		})
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payment session already completed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(false, nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "", models.PaymentResourceRest{Status: Paid.String()})
+		So(completed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payment session completed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, update *models.PaymentResourceDB) (bool, error) {
+				So(update.Data.Status, ShouldEqual, Paid.String())
+				So(update.Data.Etag, ShouldNotBeEmpty)
+				So(update.ExternalPaymentStatusURI, ShouldEqual, "http://dummy-url/earlier")
+				So(update.ExternalPaymentStatusID, ShouldEqual, "earlier")
+				// The expiry read with the session isn't written back over one it has been extended to since
+				So(update.Data.ExpiresAt.IsZero(), ShouldBeTrue)
+				return true, nil
+			})
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "", models.PaymentResourceRest{
+			Status:    Paid.String(),
+			ExpiresAt: time.Now().Add(time.Hour),
+			MetaData: models.PaymentResourceMetaDataRest{
+				ExternalPaymentStatusURI: "http://dummy-url/earlier",
+				ExternalPaymentStatusID:  "earlier",
+			},
+		})
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Payment session completed by its callback consumes the callback token", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		allowResourceClaims(mock)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", helpers.HashCallbackToken("token"), gomock.Any()).Return(true, nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "token", models.PaymentResourceRest{Status: Paid.String()})
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestUnitStoreExternalPaymentStatusDetails(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	paymentSession := func(status string) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Status:   status,
+			MetaData: models.PaymentResourceMetaDataRest{ID: "1234", CallbackToken: "token"},
+		}
+	}
+
+	Convey("External payment details stored and added to the attempts", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		var update *models.PaymentResourceDB
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, paymentUpdate *models.PaymentResourceDB) error {
+			update = paymentUpdate
+			return nil
+		})
+
+		responseType, err := mockPaymentService.StoreExternalPaymentStatusDetails(context.Background(), paymentSession(InProgress.String()), "credit-card", "external_uri", "external_id")
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(update.ExternalPaymentStatusURI, ShouldEqual, "external_uri")
+		So(update.ExternalPaymentStatusID, ShouldEqual, "external_id")
+		So(update.CallbackTokenHash, ShouldEqual, helpers.HashCallbackToken("token"))
+		So(update.ExternalPaymentAttempts, ShouldHaveLength, 1)
+		So(update.ExternalPaymentAttempts[0].PaymentMethod, ShouldEqual, "credit-card")
+		So(update.ExternalPaymentAttempts[0].ExternalPaymentStatusURI, ShouldEqual, "external_uri")
+		So(update.ExternalPaymentAttempts[0].ExternalPaymentStatusID, ShouldEqual, "external_id")
+		So(update.ExternalPaymentAttempts[0].CreatedAt, ShouldHappenWithin, time.Second, time.Now())
+	})
+
+	Convey("Error storing external payment details", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().PatchPaymentResource(gomock.Any(), "1234", gomock.Any()).Return(fmt.Errorf("error"))
+
+		responseType, err := mockPaymentService.StoreExternalPaymentStatusDetails(context.Background(), paymentSession(InProgress.String()), "PayPal", "external_uri", "external_id")
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error storing the External Payment Status Details against the payment session: [error]")
+	})
+
+	Convey("Session whose last attempt failed is reopened by storing the new attempt", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		var update *models.PaymentResourceDB
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ []string, paymentUpdate *models.PaymentResourceDB) (bool, error) {
+			update = paymentUpdate
+			return true, nil
+		})
+
+		session := paymentSession(Failed.String())
+		responseType, err := mockPaymentService.StoreExternalPaymentStatusDetails(context.Background(), session, "credit-card", "external_uri", "external_id")
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(update.Data.Status, ShouldEqual, InProgress.String())
+		So(update.CallbackTokenHash, ShouldEqual, helpers.HashCallbackToken("token"))
+		So(update.ExternalPaymentAttempts, ShouldHaveLength, 1)
+		So(session.Status, ShouldEqual, InProgress.String())
+	})
+
+	Convey("Session whose last attempt failed is no longer awaiting a retry when the new attempt is stored", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ReopenPaymentResource(gomock.Any(), "1234", retryableStatuses, gomock.Any()).Return(false, nil)
+
+		session := paymentSession(Failed.String())
+		responseType, err := mockPaymentService.StoreExternalPaymentStatusDetails(context.Background(), session, "credit-card", "external_uri", "external_id")
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session is no longer awaiting a retry")
+		So(session.Status, ShouldEqual, Failed.String())
+	})
+}
+
+func TestUnitConsumeCallbackToken(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("Error consuming callback token", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), "1234", helpers.HashCallbackToken("token")).Return(false, fmt.Errorf("error"))
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		consumed, responseType, err := mockPaymentService.ConsumeCallbackToken(req, "1234", "token")
+		So(consumed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error consuming callback token on database: [error]")
+	})
+
+	Convey("Callback token already consumed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), "1234", helpers.HashCallbackToken("token")).Return(false, nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		consumed, responseType, err := mockPaymentService.ConsumeCallbackToken(req, "1234", "token")
+		So(consumed, ShouldBeFalse)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Callback token consumed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ConsumeCallbackToken(gomock.Any(), "1234", helpers.HashCallbackToken("token")).Return(true, nil)
+		req := httptest.NewRequest("Get", "/test", nil)
+
+		consumed, responseType, err := mockPaymentService.ConsumeCallbackToken(req, "1234", "token")
+		So(consumed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestUnitCallbackTokenMatches(t *testing.T) {
+	Convey("Callback token is checked against the hash stored for the latest external journey", t, func() {
+		paymentSession := models.PaymentResourceRest{
+			MetaData: models.PaymentResourceMetaDataRest{CallbackTokenHash: helpers.HashCallbackToken("token")},
+		}
+
+		So(CallbackTokenMatches(paymentSession, "token"), ShouldBeTrue)
+		So(CallbackTokenMatches(paymentSession, "forged"), ShouldBeFalse)
+		So(CallbackTokenMatches(paymentSession, ""), ShouldBeFalse)
+	})
+
+	Convey("Callback token that has been used doesn't match", t, func() {
+		So(CallbackTokenMatches(models.PaymentResourceRest{}, "token"), ShouldBeFalse)
+	})
 }
 
 func TestUnitGetPayment(t *testing.T) {
@@ -424,7 +1215,7 @@ func TestUnitGetPayment(t *testing.T) {
 	Convey("Error getting payment from DB", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
 
 		req := httptest.NewRequest("Get", "/test", nil)
 
@@ -437,7 +1228,7 @@ func TestUnitGetPayment(t *testing.T) {
 	Convey("Payment ID not found", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource("invalid").Return(nil, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "invalid").Return(nil, nil)
 
 		req := httptest.NewRequest("Get", "/test", nil)
 
@@ -450,7 +1241,7 @@ func TestUnitGetPayment(t *testing.T) {
 	Convey("Error getting payment resource", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource("1234").Return(&models.PaymentResourceDB{}, nil)
+		mock.EXPECT().GetPaymentResource(gomock.Any(), "1234").Return(&models.PaymentResourceDB{}, nil)
 
 		req := httptest.NewRequest("Get", "/test", nil)
 
@@ -464,12 +1255,12 @@ func TestUnitGetPayment(t *testing.T) {
 		So(err.Error(), ShouldEqual, "error getting payment resource: [error getting Cost Resource: [Get \"\": no responder found]]")
 	})
 
-	cfg.DomainAllowList = "http://dummy-resource"
+	cfg.DomainAllowList = []string{"http://dummy-resource"}
 
 	Convey("Invalid cost", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -500,7 +1291,7 @@ func TestUnitGetPayment(t *testing.T) {
 	Convey("Amount mismatch", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -531,7 +1322,7 @@ func TestUnitGetPayment(t *testing.T) {
 	Convey("Get Payment session - success - Single cost", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -577,7 +1368,7 @@ func TestUnitGetPayment(t *testing.T) {
 	Convey("Get Payment session - success - Multiple costs", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetPaymentResource(gomock.Any()).Return(
+		mock.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(
 			&models.PaymentResourceDB{
 				ID: "1234",
 				Data: models.PaymentResourceDataDB{
@@ -638,9 +1429,9 @@ func TestUnitGetIncompletePayments(t *testing.T) {
 	Convey("Error getting incomplete payments from DB", t, func() {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
-		mock.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return(nil, fmt.Errorf("err"))
+		mock.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("err"))
 
-		payments, err := mockPaymentService.GetIncompletePayments(cfg)
+		payments, err := mockPaymentService.GetIncompletePayments(context.Background(), cfg)
 		So(payments, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "err")
 	})
@@ -649,9 +1440,9 @@ func TestUnitGetIncompletePayments(t *testing.T) {
 		mock := dao.NewMockDAO(mockCtrl)
 		mockPaymentService := createMockPaymentService(mock, cfg)
 
-		mock.EXPECT().GetIncompleteGovPayPayments(gomock.Any()).Return([]models.PaymentResourceDB{{ID: "id"}}, nil)
+		mock.EXPECT().GetIncompleteGovPayPayments(gomock.Any(), gomock.Any()).Return([]models.PaymentResourceDB{{ID: "id"}}, nil)
 
-		payments, err := mockPaymentService.GetIncompletePayments(cfg)
+		payments, err := mockPaymentService.GetIncompletePayments(context.Background(), cfg)
 		So(len(*payments), ShouldEqual, 1)
 		So(err, ShouldBeNil)
 	})
@@ -676,7 +1467,7 @@ func TestUnitGetTotalAmount(t *testing.T) {
 
 func TestUnitGetCosts(t *testing.T) {
 	cfg, _ := config.Get()
-	cfg.DomainAllowList = "http://dummy-resource"
+	cfg.DomainAllowList = []string{"http://dummy-resource"}
 	cfg.SecureAppCostsRegex = "\\/secure-app-regex-test\\/"
 	r := regexp.MustCompile(cfg.SecureAppCostsRegex)
 	defer resetConfig()
@@ -686,7 +1477,7 @@ func TestUnitGetCosts(t *testing.T) {
 		defer httpmock.DeactivateAndReset()
 		httpmock.RegisterResponder("GET", "http://dummy-resource", nil)
 
-		costResourceRest, status, err := getCosts("http://dummy-resource", cfg, r)
+		costResourceRest, status, err := getCosts(context.Background(), "http://dummy-resource", cfg, r)
 		So(costResourceRest, ShouldBeNil)
 		So(status, ShouldEqual, Error)
 		So(err.Error(), ShouldEqual, "error getting Cost Resource: [Get \"http://dummy-resource\": no responder found]")
@@ -698,7 +1489,7 @@ func TestUnitGetCosts(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(400, nil)
 		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
 
-		costResourceRest, status, err := getCosts("http://dummy-resource", cfg, r)
+		costResourceRest, status, err := getCosts(context.Background(), "http://dummy-resource", cfg, r)
 		So(costResourceRest, ShouldBeNil)
 		So(status, ShouldEqual, InvalidData)
 		So(err.Error(), ShouldEqual, "error getting Cost Resource - status code: [400]")
@@ -715,7 +1506,7 @@ func TestUnitGetCosts(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(200, costs)
 		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
 
-		costResourceRest, status, err := getCosts("http://dummy-resource", cfg, r)
+		costResourceRest, status, err := getCosts(context.Background(), "http://dummy-resource", cfg, r)
 		So(costResourceRest, ShouldBeNil)
 		So(status, ShouldEqual, InvalidData)
 		So(err.Error(), ShouldEqual, "Key: 'CostResourceRest.Amount' Error:Field validation for 'Amount' failed on the 'required' tag")
@@ -727,7 +1518,7 @@ func TestUnitGetCosts(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(404, nil)
 		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
 
-		costResourceRest, status, err := getCosts("http://dummy-resource", cfg, r)
+		costResourceRest, status, err := getCosts(context.Background(), "http://dummy-resource", cfg, r)
 		So(costResourceRest, ShouldBeNil)
 		So(status, ShouldEqual, CostsNotFound)
 		So(err.Error(), ShouldEqual, "error getting Cost Resource - Not Found: [404]")
@@ -739,57 +1530,20 @@ func TestUnitGetCosts(t *testing.T) {
 		jsonResponse, _ := httpmock.NewJsonResponder(404, nil)
 		httpmock.RegisterResponder("GET", "http://dummy-resource/secure-app-regex-test/123456789abc/payment", jsonResponse)
 
-		costResourceRest, status, err := getCosts("http://dummy-resource/secure-app-regex-test/123456789abc/payment", cfg, r)
+		costResourceRest, status, err := getCosts(context.Background(), "http://dummy-resource/secure-app-regex-test/123456789abc/payment", cfg, r)
 		So(costResourceRest, ShouldBeNil)
 		So(status, ShouldEqual, CostsGone)
 		So(err.Error(), ShouldEqual, "error getting Cost Resource - Gone: [410]")
 	})
 }
 
-// TestUnitGenerateIDForDuplicates this will test the generateID func's capability for generating unique id's
-// if a duplicate is generated, this test will fail.
-func TestUnitGenerateIDForDuplicates(t *testing.T) {
-	// generate 100,000 id's
-	times := 100000 // 100 thousand
-	generated := make([]string, times)
-
-	for i := 0; i < times; i++ {
-		ref := generateID()
-		generated[i] = ref
-	}
-
-	// check for dups by creating a map of string->int and counting the the entry values whilst
-	// iterating through the generated map
-	generatedCheck := make(map[string]int)
-	var duplicates []string
-	for _, reference := range generated {
-		_, exists := generatedCheck[reference]
-		if exists {
-			duplicates = append(duplicates, reference)
-		} else {
-			generatedCheck[reference] = 1
-		}
-	}
-
-	if len(duplicates) != 0 {
-		t.Errorf("%d duplicate id's generated", len(duplicates))
-		t.Fail()
-	}
-}
-
-func TestUnitGenerateID(t *testing.T) {
-	Convey("generates a id with a length of 15", t, func() {
-		So(generateID(), ShouldHaveLength, 15)
-	})
-}
-
 func TestUnitValidateIncomingPayment(t *testing.T) {
 	cfg, _ := config.Get()
 	defer resetConfig()
 
 	Convey("Invalid request", t, func() {
-		err := validateIncomingPayment(models.IncomingPaymentResourceRequest{}, cfg)
-		So(err.Error(), ShouldEqual, "Key: 'IncomingPaymentResourceRequest.RedirectURI' Error:Field validation for 'RedirectURI' failed on the 'required' tag\nKey: 'IncomingPaymentResourceRequest.Resource' Error:Field validation for 'Resource' failed on the 'required' tag\nKey: 'IncomingPaymentResourceRequest.State' Error:Field validation for 'State' failed on the 'required' tag")
+		err := validateIncomingPayment(models.IncomingPaymentResourceRequest{}, cfg, "")
+		So(err.Error(), ShouldEqual, "Key: 'IncomingPaymentResourceRequest.RedirectURI' Error:Field validation for 'RedirectURI' failed on the 'required' tag\nKey: 'IncomingPaymentResourceRequest.Resource' Error:Field validation for 'Resource' failed on the 'required_without' tag\nKey: 'IncomingPaymentResourceRequest.State' Error:Field validation for 'State' failed on the 'required' tag")
 	})
 
 	Convey("Invalid Resource Domain", t, func() {
@@ -798,11 +1552,12 @@ func TestUnitValidateIncomingPayment(t *testing.T) {
 			RedirectURI: "http://www.companieshouse.gov.uk",
 			State:       "state",
 		}
-		err := validateIncomingPayment(request, cfg)
+		err := validateIncomingPayment(request, cfg, "")
 		So(err.Error(), ShouldEqual, "invalid resource domain: http://dummy-resource")
 	})
 
-	cfg.DomainAllowList = "http://dummy-resource"
+	cfg.DomainAllowList = []string{"http://dummy-resource"}
+	cfg.RedirectAllowList = []string{"http://dummy-resource"}
 
 	Convey("Valid Resource Domain", t, func() {
 		request := models.IncomingPaymentResourceRequest{
@@ -810,9 +1565,95 @@ func TestUnitValidateIncomingPayment(t *testing.T) {
 			RedirectURI: "http://dummy-resource",
 			State:       "state",
 		}
-		err := validateIncomingPayment(request, cfg)
+		err := validateIncomingPayment(request, cfg, "")
 		So(err, ShouldBeNil)
 	})
+
+	Convey("Language", t, func() {
+		request := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-resource",
+			RedirectURI: "http://dummy-resource",
+			State:       "state",
+			Language:    "cy",
+		}
+		So(validateIncomingPayment(request, cfg, ""), ShouldBeNil)
+
+		request.Language = "fr"
+		So(validateIncomingPayment(request, cfg, ""), ShouldNotBeNil)
+	})
+
+	Convey("Prefilled cardholder details", t, func() {
+		request := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-resource",
+			RedirectURI: "http://dummy-resource",
+			State:       "state",
+			PrefilledCardholderDetails: &models.PrefilledCardholderDetails{
+				CardholderName: "J Bloggs",
+				BillingAddress: &models.BillingAddress{Postcode: "CF14 3UZ", Country: "GB"},
+			},
+		}
+		So(validateIncomingPayment(request, cfg, ""), ShouldBeNil)
+
+		request.PrefilledCardholderDetails.BillingAddress.Country = "GBR"
+		So(validateIncomingPayment(request, cfg, ""), ShouldNotBeNil)
+	})
+
+	Convey("Redirect URI not in allow list", t, func() {
+		request := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-resource",
+			RedirectURI: "https://evil.example.com/callback",
+			State:       "state",
+		}
+		err := validateIncomingPayment(request, cfg, "")
+		So(err.Error(), ShouldEqual, "redirect_uri origin [https://evil.example.com] is not allowed")
+	})
+
+	cfg.ClientsJSON = `[{"id":"frontend","redirect_signing_key":"0123456789abcdef0123456789abcdef","redirect_allow_list":["https://frontend.companieshouse.gov.uk/pay"]}]`
+
+	Convey("Redirect URI in client allow list", t, func() {
+		So(cfg.Parse(), ShouldBeNil)
+		request := models.IncomingPaymentResourceRequest{
+			Resource:    "http://dummy-resource",
+			RedirectURI: "https://frontend.companieshouse.gov.uk/pay/complete?x=y",
+			State:       "state",
+		}
+		So(validateIncomingPayment(request, cfg, "frontend"), ShouldBeNil)
+		So(validateIncomingPayment(request, cfg, "other").Error(), ShouldEqual, "redirect_uri origin [https://frontend.companieshouse.gov.uk] is not allowed")
+	})
+}
+
+func TestUnitValidateRedirectURI(t *testing.T) {
+	allowList := []string{"https://www.companieshouse.gov.uk/pay/", "http://localhost:8080"}
+
+	Convey("Allowed redirect URIs", t, func() {
+		So(validateRedirectURI("https://www.companieshouse.gov.uk/pay", allowList), ShouldBeNil)
+		So(validateRedirectURI("https://WWW.companieshouse.gov.uk/pay/complete", allowList), ShouldBeNil)
+		So(validateRedirectURI("http://localhost:8080/anything", allowList), ShouldBeNil)
+		So(validateRedirectURI("https://www.companieshouse.gov.uk/pay/other/../complete", allowList), ShouldBeNil)
+	})
+
+	Convey("Disallowed redirect URIs", t, func() {
+		So(validateRedirectURI("https://www.companieshouse.gov.uk/payment", allowList).Error(), ShouldEqual, "redirect_uri origin [https://www.companieshouse.gov.uk] is not allowed")
+		So(validateRedirectURI("http://www.companieshouse.gov.uk/pay", allowList).Error(), ShouldEqual, "redirect_uri origin [http://www.companieshouse.gov.uk] is not allowed")
+		So(validateRedirectURI("http://localhost:8081/", allowList).Error(), ShouldEqual, "redirect_uri origin [http://localhost:8081] is not allowed")
+		So(validateRedirectURI("https://www.companieshouse.gov.uk.evil.com/pay", allowList), ShouldNotBeNil)
+		So(validateRedirectURI("https://user@www.companieshouse.gov.uk/pay", allowList), ShouldNotBeNil)
+		So(validateRedirectURI("https://www.companieshouse.gov.uk/pay/../other", allowList), ShouldNotBeNil)
+		So(validateRedirectURI("https://www.companieshouse.gov.uk/pay/%2e%2e/other", allowList), ShouldNotBeNil)
+		So(validateRedirectURI("https://www.companieshouse.gov.uk/pay/./..", allowList), ShouldNotBeNil)
+	})
+}
+
+func TestUnitIsUnconfiguredClient(t *testing.T) {
+	cfg := config.Config{Settings: config.Settings{ClientsJSON: `[{"id":"frontend","redirect_signing_key":"0123456789abcdef0123456789abcdef"}]`}}
+
+	Convey("Calling services are only unconfigured when CLIENTS is in use", t, func() {
+		So(cfg.Parse(), ShouldBeNil)
+		So(isUnconfiguredClient(&config.Config{}, ""), ShouldBeFalse)
+		So(isUnconfiguredClient(&cfg, "frontend"), ShouldBeFalse)
+		So(isUnconfiguredClient(&cfg, "other"), ShouldBeTrue)
+		So(isUnconfiguredClient(&cfg, ""), ShouldBeTrue)
+	})
 }
 
 func TestUnitValidateCosts(t *testing.T) {
@@ -860,25 +1701,32 @@ func TestUnitValidateCosts(t *testing.T) {
 
 func TestUnitIsExpired(t *testing.T) {
 	cfg, _ := config.Get()
-	cfg.ExpiryTimeInMinutes = "90"
+	cfg.ExpiryTimeInMinutes = 90
 	defer resetConfig()
 
 	Convey("Expired Session", t, func() {
 		paymentResourceRest := models.PaymentResourceRest{CreatedAt: time.Now().Add(time.Hour * -2)}
-		expired, err := IsExpired(paymentResourceRest, cfg)
-		So(expired, ShouldEqual, true)
-		So(err, ShouldEqual, nil)
+		So(IsExpired(paymentResourceRest, cfg), ShouldEqual, true)
 	})
 
 	Convey("Unexpired Session", t, func() {
 		paymentResourceRest := models.PaymentResourceRest{CreatedAt: time.Now()}
-		expired, err := IsExpired(paymentResourceRest, cfg)
-		So(expired, ShouldEqual, false)
-		So(err, ShouldEqual, nil)
+		So(IsExpired(paymentResourceRest, cfg), ShouldEqual, false)
+	})
+
+	Convey("Session expires at the time stored on it", t, func() {
+		paymentResourceRest := models.PaymentResourceRest{CreatedAt: time.Now().Add(time.Hour * -2), ExpiresAt: time.Now().Add(time.Hour)}
+		So(IsExpired(paymentResourceRest, cfg), ShouldEqual, false)
+
+		paymentResourceRest = models.PaymentResourceRest{CreatedAt: time.Now(), ExpiresAt: time.Now().Add(-time.Minute)}
+		So(IsExpired(paymentResourceRest, cfg), ShouldEqual, true)
 	})
 }
 
 func resetConfig() {
 	cfg, _ := config.Get()
-	cfg.DomainAllowList = ""
+	cfg.DomainAllowList = nil
+	cfg.RedirectAllowList = nil
+	cfg.ClientsJSON = ""
+	cfg.Parse()
 }
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/companieshouse/chs.go/log"
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 	"github.com/plutov/paypal/v4"
 )
 
@@ -43,6 +47,7 @@ func GetPayPalClient(cfg config.Config) (*paypal.Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating paypal client: [%v]", err)
 	}
+	c.Client.Transport = tracing.NewTransport(c.Client.Transport)
 	_, err = c.GetAccessToken(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("error getting access token: [%v]", err)
@@ -61,6 +66,71 @@ type PayPalSDK interface {
 	RefundCapture(ctx context.Context, captureID string, refundCaptureRequest paypal.RefundCaptureRequest) (*paypal.RefundResponse, error)
 }
 
+// instrumentedPayPalSDK records the latency of, and starts a span for, every call made through the wrapped PayPal client
+type instrumentedPayPalSDK struct {
+	client PayPalSDK
+}
+
+// NewInstrumentedPayPalClient wraps the given PayPal client so that each call is recorded in the outbound request
+// metrics and traced
+func NewInstrumentedPayPalClient(c PayPalSDK) PayPalSDK {
+	return &instrumentedPayPalSDK{client: c}
+}
+
+func (i *instrumentedPayPalSDK) GetAccessToken(ctx context.Context) (*paypal.TokenResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "paypal.get-access-token")
+	start := time.Now()
+	res, err := i.client.GetAccessToken(ctx)
+	metrics.ObserveOutboundCall(metrics.ProviderPayPal, "get-access-token", start, err)
+	tracing.EndSpan(span, err)
+	return res, err
+}
+
+func (i *instrumentedPayPalSDK) CreateOrder(ctx context.Context, intent string, purchaseUnits []paypal.PurchaseUnitRequest, payer *paypal.CreateOrderPayer, appContext *paypal.ApplicationContext) (*paypal.Order, error) {
+	ctx, span := tracing.StartSpan(ctx, "paypal.create-order")
+	start := time.Now()
+	res, err := i.client.CreateOrder(ctx, intent, purchaseUnits, payer, appContext)
+	metrics.ObserveOutboundCall(metrics.ProviderPayPal, "create-order", start, err)
+	tracing.EndSpan(span, err)
+	return res, err
+}
+
+func (i *instrumentedPayPalSDK) GetOrder(ctx context.Context, orderID string) (*paypal.Order, error) {
+	ctx, span := tracing.StartSpan(ctx, "paypal.get-order")
+	start := time.Now()
+	res, err := i.client.GetOrder(ctx, orderID)
+	metrics.ObserveOutboundCall(metrics.ProviderPayPal, "get-order", start, err)
+	tracing.EndSpan(span, err)
+	return res, err
+}
+
+func (i *instrumentedPayPalSDK) CaptureOrder(ctx context.Context, orderID string, captureOrderRequest paypal.CaptureOrderRequest) (*paypal.CaptureOrderResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "paypal.capture-order")
+	start := time.Now()
+	res, err := i.client.CaptureOrder(ctx, orderID, captureOrderRequest)
+	metrics.ObserveOutboundCall(metrics.ProviderPayPal, "capture-order", start, err)
+	tracing.EndSpan(span, err)
+	return res, err
+}
+
+func (i *instrumentedPayPalSDK) CapturedDetail(ctx context.Context, captureID string) (*paypal.CaptureDetailsResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "paypal.get-capture")
+	start := time.Now()
+	res, err := i.client.CapturedDetail(ctx, captureID)
+	metrics.ObserveOutboundCall(metrics.ProviderPayPal, "get-capture", start, err)
+	tracing.EndSpan(span, err)
+	return res, err
+}
+
+func (i *instrumentedPayPalSDK) RefundCapture(ctx context.Context, captureID string, refundCaptureRequest paypal.RefundCaptureRequest) (*paypal.RefundResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "paypal.refund-capture")
+	start := time.Now()
+	res, err := i.client.RefundCapture(ctx, captureID, refundCaptureRequest)
+	metrics.ObserveOutboundCall(metrics.ProviderPayPal, "refund-capture", start, err)
+	tracing.EndSpan(span, err)
+	return res, err
+}
+
 // PayPalService handles the specific functionality of integrating PayPal into Payment Sessions
 type PayPalService struct {
 	Client         PayPalSDK
@@ -69,10 +139,10 @@ type PayPalService struct {
 
 // CheckPaymentProviderStatus checks the status of the payment with PayPal.
 // Provider ID return value not yet implemented for PayPal.
-func (pp *PayPalService) CheckPaymentProviderStatus(paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
+func (pp *PayPalService) CheckPaymentProviderStatus(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.StatusResponse, string, ResponseType, error) {
 
 	res, err := pp.Client.GetOrder(
-		context.Background(),
+		ctx,
 		paymentResource.MetaData.ExternalPaymentStatusID,
 	)
 	if err != nil {
@@ -82,6 +152,36 @@ func (pp *PayPalService) CheckPaymentProviderStatus(paymentResource *models.Paym
 	return &models.StatusResponse{Status: res.Status}, "", Success, nil
 }
 
+// maxPayPalFieldLength is the longest value PayPal accepts for the names, descriptions and IDs on an order
+const maxPayPalFieldLength = 127
+
+// payPalItems returns a PayPal line item for each of the costs being paid for, so that the PayPal payment screens and
+// receipts itemise the payment. The items' amounts add up to the total amount of the payment session.
+func payPalItems(costs []models.CostResourceRest) []paypal.Item {
+	items := make([]paypal.Item, 0, len(costs))
+	for _, cost := range costs {
+		items = append(items, paypal.Item{
+			Name:     truncate(cost.Description, maxPayPalFieldLength),
+			SKU:      truncate(cost.ProductType, maxPayPalFieldLength), // SKU = Stock Keeping Unit
+			Quantity: "1",
+			UnitAmount: &paypal.Money{
+				Currency: gbp,
+				Value:    cost.Amount,
+			},
+		})
+	}
+	return items
+}
+
+// payPalLocale returns the locale the PayPal payment screens are shown in for the language of a payment journey, or
+// an empty string to let PayPal choose for journeys taken in English
+func payPalLocale(language string) string {
+	if language == languageWelsh {
+		return "cy-GB"
+	}
+	return ""
+}
+
 // CreatePaymentAndGenerateNextURL creates a PayPal session linked to the given payment session
 func (pp *PayPalService) CreatePaymentAndGenerateNextURL(req *http.Request, paymentResource *models.PaymentResourceRest) (string, ResponseType, error) {
 
@@ -89,39 +189,33 @@ func (pp *PayPalService) CreatePaymentAndGenerateNextURL(req *http.Request, paym
 
 	id := paymentResource.MetaData.ID
 
-	redirectURL := fmt.Sprintf("%s/callback/payments/paypal/orders/%s",
-		pp.PaymentService.Config.PaymentsAPIURL, paymentResource.MetaData.ID)
-
-	money := &paypal.Money{
-		Currency: gbp,
-		Value:    paymentResource.Amount,
-	}
+	redirectURL := fmt.Sprintf("%s/callback/payments/paypal/orders/%s?%s=%s",
+		pp.PaymentService.Config.PaymentsAPIURL, paymentResource.MetaData.ID, helpers.CallbackTokenParam, paymentResource.MetaData.CallbackToken)
 
 	order, err := pp.Client.CreateOrder(
-		context.Background(),
+		req.Context(),
 		paypal.OrderIntentCapture,
 		[]paypal.PurchaseUnitRequest{
 			{
-				InvoiceID: id,
+				InvoiceID:   id,
+				CustomID:    truncate(paymentResource.CompanyNumber, maxPayPalFieldLength),
+				Description: truncate(paymentResource.Reference, maxPayPalFieldLength),
 				Amount: &paypal.PurchaseUnitAmount{
 					Value:    paymentResource.Amount,
 					Currency: gbp,
 					Breakdown: &paypal.PurchaseUnitAmountBreakdown{
-						ItemTotal: money,
-					},
-				},
-				Items: []paypal.Item{
-					{
-						Name:       paymentResource.Reference,
-						SKU:        paymentResource.CompanyNumber, // SKU = Stock Keeping Unit
-						Quantity:   "1",
-						UnitAmount: money,
+						ItemTotal: &paypal.Money{
+							Currency: gbp,
+							Value:    paymentResource.Amount,
+						},
 					},
 				},
+				Items: payPalItems(paymentResource.Costs),
 			},
 		},
 		nil,
 		&paypal.ApplicationContext{
+			Locale:    payPalLocale(paymentResource.Language),
 			ReturnURL: redirectURL,
 			CancelURL: redirectURL,
 		},
@@ -147,23 +241,41 @@ func (pp *PayPalService) CreatePaymentAndGenerateNextURL(req *http.Request, paym
 		}
 	}
 
-	err = pp.PaymentService.StoreExternalPaymentStatusDetails(paymentResource.MetaData.ID, externalStatusURI, order.ID)
+	responseType, err := pp.PaymentService.StoreExternalPaymentStatusDetails(req.Context(), paymentResource, PaymentMethodPayPal, externalStatusURI, order.ID)
 	if err != nil {
-		return "", Error, fmt.Errorf("error storing PayPal external payment details for payment session: [%s]", err)
+		return "", responseType, fmt.Errorf("error storing PayPal external payment details for payment session: [%s]", err)
 	}
 
 	return nextURL, Success, nil
 }
 
+// GetUsableNextURL returns the approve link of a PayPal attempt while its order is still waiting to be approved, or an
+// empty string if a new order must be created
+func (pp *PayPalService) GetUsableNextURL(ctx context.Context, _ *models.PaymentResourceRest, attempt models.ExternalPaymentAttempt) (string, error) {
+	order, err := pp.Client.GetOrder(ctx, attempt.ExternalPaymentStatusID)
+	if err != nil {
+		return "", fmt.Errorf("error getting order from PayPal: [%v]", err)
+	}
+	if order.Status != paypal.OrderStatusCreated {
+		return "", nil
+	}
+	for _, link := range order.Links {
+		if link.Rel == "approve" {
+			return link.Href, nil
+		}
+	}
+	return "", nil
+}
+
 // GetPaymentDetails gets the details of a PayPal payment
-func (pp *PayPalService) GetPaymentDetails(paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
+func (pp *PayPalService) GetPaymentDetails(ctx context.Context, paymentResource *models.PaymentResourceRest) (*models.PaymentDetails, ResponseType, error) {
 
 	if paymentResource.MetaData.ExternalPaymentStatusID == "" {
 		return nil, Error, fmt.Errorf("external payment status ID not defined")
 	}
 
 	order, err := pp.Client.GetOrder(
-		context.Background(),
+		ctx,
 		paymentResource.MetaData.ExternalPaymentStatusID,
 	)
 	if err != nil {
@@ -189,7 +301,7 @@ func (pp *PayPalService) GetRefundSummary(_ *http.Request, _ string) (*models.Pa
 }
 
 // CreateRefund creates a refund in PayPal
-func (pp *PayPalService) CreateRefund(_ *models.PaymentResourceRest, _ *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+func (pp *PayPalService) CreateRefund(_ context.Context, _ *models.PaymentResourceRest, _ *models.CreateRefundGovPayRequest) (*models.CreateRefundGovPayResponse, ResponseType, error) {
 
 	// not implemented
 
@@ -197,7 +309,7 @@ func (pp *PayPalService) CreateRefund(_ *models.PaymentResourceRest, _ *models.C
 }
 
 // GetRefundStatus gets refund status from PayPal
-func (pp *PayPalService) GetRefundStatus(_ *models.PaymentResourceRest, _ string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
+func (pp *PayPalService) GetRefundStatus(_ context.Context, _ *models.PaymentResourceRest, _ string) (*models.CreateRefundGovPayResponse, ResponseType, error) {
 
 	// not implemented
 
@@ -205,9 +317,9 @@ func (pp *PayPalService) GetRefundStatus(_ *models.PaymentResourceRest, _ string
 }
 
 // CapturePayment captures the payment in PayPal
-func (pp *PayPalService) CapturePayment(orderId string) (*paypal.CaptureOrderResponse, error) {
+func (pp *PayPalService) CapturePayment(ctx context.Context, orderId string) (*paypal.CaptureOrderResponse, error) {
 	res, err := pp.Client.CaptureOrder(
-		context.Background(),
+		ctx,
 		orderId,
 		paypal.CaptureOrderRequest{},
 	)
@@ -215,21 +327,21 @@ func (pp *PayPalService) CapturePayment(orderId string) (*paypal.CaptureOrderRes
 }
 
 // GetCapturedPaymentDetails gets the details of a captured payment in PayPal
-func (pp *PayPalService) GetCapturedPaymentDetails(captureID string) (*paypal.CaptureDetailsResponse, error) {
+func (pp *PayPalService) GetCapturedPaymentDetails(ctx context.Context, captureID string) (*paypal.CaptureDetailsResponse, error) {
 	res, err := pp.Client.CapturedDetail(
-		context.Background(),
+		ctx,
 		captureID,
 	)
 	return res, err
 }
 
 // RefundCapture refunds a captured PayPal payment
-func (pp *PayPalService) RefundCapture(captureID string) (*paypal.RefundResponse, error) {
+func (pp *PayPalService) RefundCapture(ctx context.Context, captureID string) (*paypal.RefundResponse, error) {
 	// For a full refund, include an empty payload in the request body
 	// https://developer.paypal.com/docs/api/payments/v2/#captures_refund
 	request := paypal.RefundCaptureRequest{}
 	res, err := pp.Client.RefundCapture(
-		context.Background(),
+		ctx,
 		captureID,
 		request,
 	)
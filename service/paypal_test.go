@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"net/http/httptest"
 	"testing"
@@ -96,7 +97,7 @@ func TestUnitCheckPaymentProviderStatus(t *testing.T) {
 
 		mockPayPalSDK.EXPECT().GetOrder(gomock.Any(), "123456").Return(nil, fmt.Errorf("error"))
 
-		status, _, resType, err := mockPayPalService.CheckPaymentProviderStatus(&paymentSession)
+		status, _, resType, err := mockPayPalService.CheckPaymentProviderStatus(context.Background(), &paymentSession)
 
 		So(status, ShouldBeNil)
 		So(resType, ShouldEqual, Error)
@@ -116,7 +117,7 @@ func TestUnitCheckPaymentProviderStatus(t *testing.T) {
 
 		mockPayPalSDK.EXPECT().GetOrder(gomock.Any(), "123456").Return(&paypalStatus, nil)
 
-		status, _, resType, err := mockPayPalService.CheckPaymentProviderStatus(&paymentSession)
+		status, _, resType, err := mockPayPalService.CheckPaymentProviderStatus(context.Background(), &paymentSession)
 
 		So(status.Status, ShouldContainSubstring, "COMPLETED")
 		So(resType, ShouldEqual, Success)
@@ -124,6 +125,46 @@ func TestUnitCheckPaymentProviderStatus(t *testing.T) {
 	})
 }
 
+func TestUnitGetUsableNextURLPayPal(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	mockDao := dao.NewMockDAO(mockCtrl)
+	mockPaymentService := createMockPaymentService(mockDao, cfg)
+	mockPayPalSDK := NewMockPayPalSDK(mockCtrl)
+	mockPayPalService := CreateMockPayPalService(mockPayPalSDK, mockPaymentService)
+
+	attempt := models.ExternalPaymentAttempt{PaymentMethod: "PayPal", ExternalPaymentStatusID: "123456"}
+	links := []paypal.Link{
+		{Href: "https://www.sandbox.paypal.com/checkoutnow?token=123456", Rel: "approve"},
+		{Href: "https://api.sandbox.paypal.com/v2/checkout/orders/123456", Rel: "self"},
+	}
+
+	Convey("Order waiting to be approved", t, func() {
+		mockPayPalSDK.EXPECT().GetOrder(gomock.Any(), "123456").Return(&paypal.Order{Status: paypal.OrderStatusCreated, Links: links}, nil)
+
+		nextURL, err := mockPayPalService.GetUsableNextURL(context.Background(), &models.PaymentResourceRest{}, attempt)
+		So(err, ShouldBeNil)
+		So(nextURL, ShouldEqual, "https://www.sandbox.paypal.com/checkoutnow?token=123456")
+	})
+
+	Convey("Order already approved", t, func() {
+		mockPayPalSDK.EXPECT().GetOrder(gomock.Any(), "123456").Return(&paypal.Order{Status: paypal.OrderStatusApproved, Links: links}, nil)
+
+		nextURL, err := mockPayPalService.GetUsableNextURL(context.Background(), &models.PaymentResourceRest{}, attempt)
+		So(err, ShouldBeNil)
+		So(nextURL, ShouldBeEmpty)
+	})
+
+	Convey("Error getting the order", t, func() {
+		mockPayPalSDK.EXPECT().GetOrder(gomock.Any(), "123456").Return(nil, fmt.Errorf("error"))
+
+		nextURL, err := mockPayPalService.GetUsableNextURL(context.Background(), &models.PaymentResourceRest{}, attempt)
+		So(err.Error(), ShouldEqual, "error getting order from PayPal: [error]")
+		So(nextURL, ShouldBeEmpty)
+	})
+}
+
 func TestUnitCreatePaymentAndGenerateNextURL(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -233,7 +274,7 @@ func TestUnitCreatePaymentAndGenerateNextURL(t *testing.T) {
 			UpdateTime: nil,
 		}
 
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
 		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&order, nil)
 
 		url, resType, err := mockPayPalService.CreatePaymentAndGenerateNextURL(req, &paymentSession)
@@ -286,7 +327,7 @@ func TestUnitCreatePaymentAndGenerateNextURL(t *testing.T) {
 			UpdateTime: nil,
 		}
 
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&order, nil)
 
 		url, resType, err := mockPayPalService.CreatePaymentAndGenerateNextURL(req, &paymentSession)
@@ -295,6 +336,76 @@ func TestUnitCreatePaymentAndGenerateNextURL(t *testing.T) {
 		So(resType, ShouldEqual, Success)
 		So(err, ShouldBeNil)
 	})
+
+	Convey("Order itemises each of the costs being paid for", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "PayPal",
+			Amount:        "15.00",
+			Reference:     "A0000001",
+			CompanyNumber: "00006400",
+			Status:        InProgress.String(),
+			Costs: []models.CostResourceRest{
+				{Amount: "10.00", Description: "Late filing penalty", ProductType: "late-filing-penalty"},
+				{Amount: "5.00", Description: "Interest", ProductType: "late-filing-penalty-interest"},
+			},
+		}
+
+		order := CreatePayPalOrderResponse("return_url")
+
+		var purchaseUnits []paypal.PurchaseUnitRequest
+		var appContext *paypal.ApplicationContext
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, units []paypal.PurchaseUnitRequest, _ *paypal.CreateOrderPayer, ac *paypal.ApplicationContext) (*paypal.Order, error) {
+				purchaseUnits = units
+				appContext = ac
+				return &order, nil
+			})
+
+		_, resType, err := mockPayPalService.CreatePaymentAndGenerateNextURL(req, &paymentSession)
+
+		So(resType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(purchaseUnits, ShouldHaveLength, 1)
+		So(purchaseUnits[0].CustomID, ShouldEqual, "00006400")
+		So(purchaseUnits[0].Description, ShouldEqual, "A0000001")
+		So(purchaseUnits[0].Amount.Breakdown.ItemTotal.Value, ShouldEqual, "15.00")
+		So(appContext.Locale, ShouldBeEmpty)
+		So(purchaseUnits[0].Items, ShouldResemble, []paypal.Item{
+			{Name: "Late filing penalty", SKU: "late-filing-penalty", Quantity: "1", UnitAmount: &paypal.Money{Currency: "GBP", Value: "10.00"}},
+			{Name: "Interest", SKU: "late-filing-penalty-interest", Quantity: "1", UnitAmount: &paypal.Money{Currency: "GBP", Value: "5.00"}},
+		})
+	})
+
+	Convey("Welsh journeys are shown in Welsh", t, func() {
+		req := httptest.NewRequest("", "/test", nil)
+
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "PayPal",
+			Amount:        "3",
+			Status:        InProgress.String(),
+			Language:      "cy",
+			Costs:         []models.CostResourceRest{{Amount: "3"}},
+		}
+
+		order := CreatePayPalOrderResponse("return_url")
+
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		var appContext *paypal.ApplicationContext
+		mockPayPalSDK.EXPECT().CreateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, _ []paypal.PurchaseUnitRequest, _ *paypal.CreateOrderPayer, ac *paypal.ApplicationContext) (*paypal.Order, error) {
+				appContext = ac
+				return &order, nil
+			})
+
+		_, resType, err := mockPayPalService.CreatePaymentAndGenerateNextURL(req, &paymentSession)
+
+		So(resType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+		So(appContext.Locale, ShouldEqual, "cy-GB")
+	})
 }
 
 func TestUnitGetPaymentDetails(t *testing.T) {
@@ -314,7 +425,7 @@ func TestUnitGetPaymentDetails(t *testing.T) {
 			},
 		}
 
-		paymentDetails, responseType, err := mockPayPalService.GetPaymentDetails(&resource)
+		paymentDetails, responseType, err := mockPayPalService.GetPaymentDetails(context.Background(), &resource)
 
 		So(paymentDetails, ShouldBeNil)
 		So(responseType, ShouldEqual, Error)
@@ -331,7 +442,7 @@ func TestUnitGetPaymentDetails(t *testing.T) {
 			},
 		}
 
-		paymentDetails, responseType, err := mockPayPalService.GetPaymentDetails(&resource)
+		paymentDetails, responseType, err := mockPayPalService.GetPaymentDetails(context.Background(), &resource)
 
 		So(paymentDetails, ShouldBeNil)
 		So(responseType, ShouldEqual, Error)
@@ -366,7 +477,7 @@ func TestUnitGetPaymentDetails(t *testing.T) {
 			},
 		}
 
-		paymentDetails, responseType, err := mockPayPalService.GetPaymentDetails(&resource)
+		paymentDetails, responseType, err := mockPayPalService.GetPaymentDetails(context.Background(), &resource)
 
 		So(paymentDetails.CardType, ShouldBeEmpty)
 		So(paymentDetails.ExternalPaymentID, ShouldEqual, "1122")
@@ -394,14 +505,14 @@ func TestUnitUnimplementedFunctions(t *testing.T) {
 	})
 
 	Convey("Create Refund (not implemented)", t, func() {
-		response, responseType, err := mockPayPalService.CreateRefund(nil, nil)
+		response, responseType, err := mockPayPalService.CreateRefund(context.Background(), nil, nil)
 		So(response, ShouldBeNil)
 		So(responseType, ShouldEqual, Success)
 		So(err, ShouldBeNil)
 	})
 
 	Convey("Get Refund Status (not implemented)", t, func() {
-		response, responseType, err := mockPayPalService.GetRefundStatus(nil, "")
+		response, responseType, err := mockPayPalService.GetRefundStatus(context.Background(), nil, "")
 		So(response, ShouldBeNil)
 		So(responseType, ShouldEqual, Success)
 		So(err, ShouldBeNil)
@@ -425,7 +536,7 @@ func TestUnitPayPalCaptures(t *testing.T) {
 
 		mockPayPalSDK.EXPECT().CaptureOrder(gomock.Any(), gomock.Any(), gomock.Any()).Return(&captureOrder, fmt.Errorf("error"))
 
-		res, err := mockPayPalService.CapturePayment("123")
+		res, err := mockPayPalService.CapturePayment(context.Background(), "123")
 
 		So(res, ShouldEqual, &captureOrder)
 		So(err.Error(), ShouldEqual, "error")
@@ -439,7 +550,7 @@ func TestUnitPayPalCaptures(t *testing.T) {
 
 		mockPayPalSDK.EXPECT().CapturedDetail(gomock.Any(), gomock.Any()).Return(&captureOrder, fmt.Errorf("error"))
 
-		res, err := mockPayPalService.GetCapturedPaymentDetails("123")
+		res, err := mockPayPalService.GetCapturedPaymentDetails(context.Background(), "123")
 
 		So(res, ShouldEqual, &captureOrder)
 		So(err.Error(), ShouldEqual, "error")
@@ -453,7 +564,7 @@ func TestUnitPayPalCaptures(t *testing.T) {
 
 		mockPayPalSDK.EXPECT().RefundCapture(gomock.Any(), gomock.Any(), gomock.Any()).Return(&captureOrder, fmt.Errorf("error"))
 
-		res, err := mockPayPalService.RefundCapture("123")
+		res, err := mockPayPalService.RefundCapture(context.Background(), "123")
 
 		So(res, ShouldEqual, &captureOrder)
 		So(err.Error(), ShouldEqual, "error")
@@ -14,8 +14,11 @@ import (
 	"github.com/companieshouse/payments.api.ch.gov.uk/config"
 	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
 	"github.com/companieshouse/payments.api.ch.gov.uk/mappers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/metrics"
 	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/companieshouse/payments.api.ch.gov.uk/tracing"
 	"github.com/companieshouse/payments.api.ch.gov.uk/transformers"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -55,18 +58,36 @@ func (bulkRefundStatus BulkRefundStatus) String() string {
 type RefundService struct {
 	GovPayService  PaymentProviderService
 	PayPalService  PaymentProviderService
+	AccountService PaymentProviderService
 	PaymentService *PaymentService
 	DAO            dao.DAO
 	Config         config.Config
 }
 
-// CreateRefund creates refund in GovPay and saves refund information to payment object in database
+// refundProvider returns the provider refunds of payments made with the payment method are created with, and its
+// name, or false if such payments can't be refunded
+func (service *RefundService) refundProvider(paymentMethod string) (PaymentProviderService, string, bool) {
+	switch paymentMethod {
+	case PaymentMethodCreditCard:
+		return service.GovPayService, metrics.ProviderGovPay, true
+	case PaymentMethodAccount:
+		return service.AccountService, metrics.ProviderAccount, true
+	default:
+		return nil, "", false
+	}
+}
+
+// CreateRefund creates refund in GovPay, or credits it back to the account the payment was made from, and saves refund
+// information to payment object in database
 func (service *RefundService) CreateRefund(req *http.Request, paymentID string, createRefundResource models.CreateRefundRequest) (*models.PaymentResourceRest, *models.RefundResponse, ResponseType, error) {
+	req, span := tracing.StartRequestSpan(req, "RefundService.CreateRefund", attribute.String("payment.id", paymentID))
+	defer span.End()
 
 	paymentSession, _, _ := service.PaymentService.GetPaymentSession(req, paymentID)
 
-	// Currently, refunds are only enabled for Gov Pay
-	if paymentSession.PaymentMethod != PaymentMethodCreditCard {
+	// Currently, refunds are only enabled for Gov Pay and accounts
+	provider, providerName, ok := service.refundProvider(paymentSession.PaymentMethod)
+	if !ok {
 		err := fmt.Errorf("unexpected payment method: %s", paymentSession.PaymentMethod)
 		return nil, nil, Forbidden, err
 	}
@@ -83,10 +104,10 @@ func (service *RefundService) CreateRefund(req *http.Request, paymentID string,
 		}
 	}
 
-	// Get RefundSummary from GovPay to check the available amount
-	paymentSession, refundSummary, response, err := service.GovPayService.GetRefundSummary(req, paymentID)
+	// Get RefundSummary from the provider to check the available amount
+	paymentSession, refundSummary, response, err := provider.GetRefundSummary(req, paymentID)
 	if err != nil {
-		err = fmt.Errorf("error getting refund summary from govpay: [%v]", err)
+		err = fmt.Errorf("error getting refund summary from %s: [%v]", providerName, err)
 		log.ErrorR(req, err)
 		return nil, nil, response, err
 	}
@@ -96,15 +117,28 @@ func (service *RefundService) CreateRefund(req *http.Request, paymentID string,
 		return nil, nil, InvalidData, err
 	}
 
+	// A refund made against one of the resources a session pays for is limited to what is left of that resource's costs
+	if createRefundResource.Resource != "" {
+		resourceAvailable, err := resourceRefundAvailable(paymentSession, createRefundResource.Resource)
+		if err != nil {
+			return nil, nil, InvalidData, err
+		}
+		if resourceAvailable < createRefundResource.Amount {
+			err = errors.New("refund amount is higher than available amount for resource")
+			return nil, nil, InvalidData, err
+		}
+	}
+
 	refundRequest := &models.CreateRefundGovPayRequest{
 		Amount:                createRefundResource.Amount,
 		RefundAmountAvailable: refundSummary.AmountAvailable,
 	}
 
-	// Call GovPay to initiate a Refund
-	refund, response, err := service.GovPayService.CreateRefund(paymentSession, refundRequest)
+	// Call the provider to initiate a Refund
+	refund, response, err := provider.CreateRefund(req.Context(), paymentSession, refundRequest)
+	metrics.RefundRequested(providerName, err)
 	if err != nil {
-		err = fmt.Errorf("error creating refund in govpay: [%v]", err)
+		err = fmt.Errorf("error creating refund in %s: [%v]", providerName, err)
 		log.ErrorR(req, err)
 		return nil, nil, response, err
 	}
@@ -112,33 +146,39 @@ func (service *RefundService) CreateRefund(req *http.Request, paymentID string,
 	// GOV.UK Pay returns different refund statuses in Sandbox and Live.
 	// Hard-coding the initial status here enables testing in Sandbox.
 	// https://docs.payments.service.gov.uk/refunding_payments/
-	if service.Config.GovPaySandbox {
+	if account, err := service.Config.GovPayAccountForClass(getClassOfPayment(paymentSession.Costs)); err == nil && account.Sandbox && paymentSession.PaymentMethod == PaymentMethodCreditCard {
 		log.Info("GOV.UK Pay sandbox enabled for test environment: hard-coding initial refund status to `submitted`")
 		refund.Status = "submitted"
 	}
 
 	refundResource := mappers.MapGovPayToRefundResponse(*refund)
+	refundResource.Resource = createRefundResource.Resource
 
 	// Add refund information to payment session
-	paymentSession.Refunds = append(paymentSession.Refunds, mappers.MapToRefundRest(*refund, createRefundResource.RefundReference))
+	refundRest := mappers.MapToRefundRest(*refund, createRefundResource.RefundReference)
+	refundRest.Resource = createRefundResource.Resource
+	paymentSession.Refunds = append(paymentSession.Refunds, refundRest)
 	paymentSession.Links.Refunds = fmt.Sprintf("%s/payments/%s/refunds", service.Config.PaymentsAPIURL, paymentID)
 	paymentResourceUpdate := transformers.PaymentTransformer{}.TransformToDB(*paymentSession)
 
 	// Save refund information to database
-	err = service.DAO.PatchPaymentResource(paymentID, &paymentResourceUpdate)
+	err = service.DAO.PatchPaymentResource(req.Context(), paymentID, &paymentResourceUpdate)
 	if err != nil {
 		err = fmt.Errorf("error patching payment session on database: [%v]", err)
 		log.Error(err)
 		return nil, nil, Error, err
 	}
+	service.PaymentService.releaseRefundedResources(req.Context(), *paymentSession)
 
 	return paymentSession, &refundResource, Success, nil
 }
 
 // GetPaymentRefunds processes all refunds in the DB by paymentId
 func (service *RefundService) GetPaymentRefunds(req *http.Request, paymentId string) ([]models.RefundResourceDB, error) {
+	req, span := tracing.StartRequestSpan(req, "RefundService.GetPaymentRefunds", attribute.String("payment.id", paymentId))
+	defer span.End()
 
-	refunds, err := service.DAO.GetPaymentRefunds(paymentId)
+	refunds, err := service.DAO.GetPaymentRefunds(req.Context(), paymentId)
 
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error retrieving the payment refunds with : %w", err))
@@ -155,6 +195,9 @@ func (service *RefundService) GetPaymentRefunds(req *http.Request, paymentId str
 
 // UpdateRefund checks refund status in GovPay and if status is successful saves it to payment object in database
 func (service *RefundService) UpdateRefund(req *http.Request, paymentId string, refundId string) (*models.RefundResourceRest, ResponseType, error) {
+	req, span := tracing.StartRequestSpan(req, "RefundService.UpdateRefund", attribute.String("payment.id", paymentId))
+	defer span.End()
+
 	paymentSession, response, err := service.PaymentService.GetPaymentSession(req, paymentId)
 	if err != nil {
 		err = fmt.Errorf("error getting payment resource: [%v]", err)
@@ -175,24 +218,30 @@ func (service *RefundService) UpdateRefund(req *http.Request, paymentId string,
 		log.ErrorR(req, err)
 		return nil, NotFound, err
 	}
-	// Get RefundStatus from GovPay to check the status of the refund
-	govPayStatusResponse, response, err := service.GovPayService.GetRefundStatus(paymentSession, refundId)
+	// Get RefundStatus from the provider to check the status of the refund. Refunds were only made by GovPay before
+	// any other provider could make them, so it is asked about refunds of any other payment method.
+	provider, providerName, ok := service.refundProvider(paymentSession.PaymentMethod)
+	if !ok {
+		provider, providerName = service.GovPayService, metrics.ProviderGovPay
+	}
+	refundStatusResponse, response, err := provider.GetRefundStatus(req.Context(), paymentSession, refundId)
 	if err != nil {
-		err = fmt.Errorf("error getting refund status from govpay: [%v]", err)
+		err = fmt.Errorf("error getting refund status from %s: [%v]", providerName, err)
 		log.ErrorR(req, err)
 		return nil, response, err
 	}
 
-	paymentSession.Refunds[index].Status = govPayStatusResponse.Status
+	paymentSession.Refunds[index].Status = refundStatusResponse.Status
 
 	paymentResourceUpdate := transformers.PaymentTransformer{}.TransformToDB(*paymentSession)
 
-	err = service.DAO.PatchPaymentResource(paymentId, &paymentResourceUpdate)
+	err = service.DAO.PatchPaymentResource(req.Context(), paymentId, &paymentResourceUpdate)
 	if err != nil {
 		err = fmt.Errorf("error patching payment session to database: [%v]", err)
 		log.Error(err)
 		return nil, Error, err
 	}
+	service.PaymentService.releaseRefundedResources(req.Context(), *paymentSession)
 
 	return &paymentSession.Refunds[index], Success, nil
 }
@@ -209,6 +258,9 @@ func getRefundIndex(refunds []models.RefundResourceRest, refundId string) (int,
 // ValidateBatchRefund retrieves all the payments in the batch refund
 // and validates it before processing it
 func (service *RefundService) ValidateBatchRefund(ctx context.Context, batchRefund models.RefundBatch) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, "RefundService.ValidateBatchRefund")
+	defer span.End()
+
 	var validationErrors []string
 	var mu = sync.Mutex{}
 	errs, _ := errgroup.WithContext(ctx)
@@ -222,14 +274,14 @@ func (service *RefundService) ValidateBatchRefund(ctx context.Context, batchRefu
 
 			switch batchRefund.PaymentProvider {
 			case "govpay":
-				paymentSession, err = service.DAO.GetPaymentResourceByProviderID(r.OrderCode)
+				paymentSession, err = service.DAO.GetPaymentResourceByProviderID(ctx, r.OrderCode)
 				if err != nil {
 					log.Error(fmt.Errorf("error retrieving payment session from DB: %w", err))
 					return err
 				}
 				validationError = validateGovPayRefund(paymentSession, r)
 			case "paypal":
-				paymentSession, err := service.DAO.GetPaymentResourceByExternalPaymentTransactionID(r.OrderCode)
+				paymentSession, err := service.DAO.GetPaymentResourceByExternalPaymentTransactionID(ctx, r.OrderCode)
 				if err != nil {
 					log.Error(fmt.Errorf("error retrieving payment session from DB: %w", err))
 					return err
@@ -299,6 +351,8 @@ func validatePayPalRefund(paymentSession *models.PaymentResourceDB, refund model
 // UpdateBatchRefund updates each paymentSession in the DB corresponding
 // to the refunds in the batch refund file with the necessary refund information
 func (service *RefundService) UpdateBatchRefund(ctx context.Context, batchRefund models.RefundBatch, filename string, user string) error {
+	ctx, span := tracing.StartSpan(ctx, "RefundService.UpdateBatchRefund")
+	defer span.End()
 
 	bulkRefunds := make(map[string]models.BulkRefundDB)
 
@@ -320,9 +374,9 @@ func (service *RefundService) UpdateBatchRefund(ctx context.Context, batchRefund
 	var err error
 	switch batchRefund.PaymentProvider {
 	case "govpay":
-		err = service.DAO.CreateBulkRefundByProviderID(bulkRefunds)
+		err = service.DAO.CreateBulkRefundByProviderID(ctx, bulkRefunds)
 	case "paypal":
-		err = service.DAO.CreateBulkRefundByExternalPaymentTransactionID(bulkRefunds)
+		err = service.DAO.CreateBulkRefundByExternalPaymentTransactionID(ctx, bulkRefunds)
 	default:
 		err = fmt.Errorf("invalid payment provider: [%s]", batchRefund.PaymentProvider)
 	}
@@ -337,8 +391,11 @@ func (service *RefundService) UpdateBatchRefund(ctx context.Context, batchRefund
 
 // GetPaymentsWithPendingRefundStatus gets all payment sessions in the DB that
 // have the pending refund status
-func (service *RefundService) GetPaymentsWithPendingRefundStatus() (*models.PendingRefundPaymentsResourceRest, error) {
-	paymentSessions, err := service.DAO.GetPaymentsWithRefundStatus()
+func (service *RefundService) GetPaymentsWithPendingRefundStatus(ctx context.Context) (*models.PendingRefundPaymentsResourceRest, error) {
+	ctx, span := tracing.StartSpan(ctx, "RefundService.GetPaymentsWithPendingRefundStatus")
+	defer span.End()
+
+	paymentSessions, err := service.DAO.GetPaymentsWithRefundStatus(ctx)
 	if err != nil {
 		err = fmt.Errorf("error getting payment resources with pending refund status: [%v]", err)
 		log.Error(err)
@@ -357,8 +414,11 @@ func (service *RefundService) GetPaymentsWithPendingRefundStatus() (*models.Pend
 
 // ProcessBatchRefund processes all refunds in the DB with a refund-pending status
 func (service *RefundService) ProcessBatchRefund(req *http.Request) []error {
+	req, span := tracing.StartRequestSpan(req, "RefundService.ProcessBatchRefund")
+	defer span.End()
+
 	var errorList []error
-	payments, err := service.DAO.GetPaymentsWithRefundStatus()
+	payments, err := service.DAO.GetPaymentsWithRefundStatus(req.Context())
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error retrieving payments with refund-pending status: %w", err))
 		errorList = append(errorList, errors.New("error retrieving payments with refund-pending status"))
@@ -393,8 +453,11 @@ func (service *RefundService) ProcessBatchRefund(req *http.Request) []error {
 
 // ProcessPendingRefunds processes all refunds in the DB with a pending status
 func (service *RefundService) ProcessPendingRefunds(req *http.Request) ([]models.PaymentResourceDB, ResponseType, []error) {
+	req, span := tracing.StartRequestSpan(req, "RefundService.ProcessPendingRefunds")
+	defer span.End()
+
 	var errorList []error
-	payments, err := service.DAO.GetPaymentsWithRefundPendingStatus()
+	payments, err := service.DAO.GetPaymentsWithRefundPendingStatus(req.Context())
 
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error retrieving payments with : %w", err))
@@ -439,7 +502,8 @@ func (service *RefundService) processGovPayBatchRefund(req *http.Request, paymen
 		RefundAmountAvailable: refundSummary.AmountAvailable,
 	}
 	// Call GovPay to initiate a Refund
-	refund, _, err := service.GovPayService.CreateRefund(paymentSession, refundRequest)
+	refund, _, err := service.GovPayService.CreateRefund(req.Context(), paymentSession, refundRequest)
+	metrics.RefundRequested(metrics.ProviderGovPay, err)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error creating refund in govpay: [%w]", err))
 		return fmt.Errorf("error creating refund in govpay for payment with id [%s]", payment.ID)
@@ -452,7 +516,7 @@ func (service *RefundService) processGovPayBatchRefund(req *http.Request, paymen
 	recentRefund.Status = RefundRequested.String()
 	recentRefund.ExternalRefundURL = payment.ExternalPaymentStatusURI + "/refund"
 	payment.BulkRefund[len(payment.BulkRefund)-1] = recentRefund
-	err = service.DAO.PatchPaymentResource(payment.ID, &payment)
+	err = service.DAO.PatchPaymentResource(req.Context(), payment.ID, &payment)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error patching payment [%w]", err))
 		return fmt.Errorf("error patching payment with id [%s]", payment.ID)
@@ -466,7 +530,7 @@ func (service *RefundService) processPayPalBatchRefund(req *http.Request, paymen
 	captureID := payment.ExternalPaymentTransactionID
 
 	// Get Captured Details Response from PayPal to check the status and  available amount
-	captureDetailsResponse, err := service.PayPalService.GetCapturedPaymentDetails(captureID)
+	captureDetailsResponse, err := service.PayPalService.GetCapturedPaymentDetails(req.Context(), captureID)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error getting capture details from paypal: [%w]", err))
 		return fmt.Errorf("error getting capture details from paypal for payment ID [%s]", payment.ID)
@@ -485,7 +549,8 @@ func (service *RefundService) processPayPalBatchRefund(req *http.Request, paymen
 	}
 
 	// Send Refund Capture request to PayPal
-	refundResponse, err := service.PayPalService.RefundCapture(captureID)
+	refundResponse, err := service.PayPalService.RefundCapture(req.Context(), captureID)
+	metrics.RefundRequested(metrics.ProviderPayPal, err)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error creating refund in PayPal: [%w]", err))
 		return fmt.Errorf("error creating refund in PayPal for payment with id [%s]", payment.ID)
@@ -503,12 +568,15 @@ func (service *RefundService) processPayPalBatchRefund(req *http.Request, paymen
 	recentRefund.ExternalRefundURL = payment.ExternalPaymentStatusURI + "/refund"
 
 	payment.BulkRefund[len(payment.BulkRefund)-1] = recentRefund
-	err = service.DAO.PatchPaymentResource(payment.ID, &payment)
+	err = service.DAO.PatchPaymentResource(req.Context(), payment.ID, &payment)
 	if err != nil {
 		log.ErrorR(req, fmt.Errorf("error patching payment [%w]", err))
 		return fmt.Errorf("error patching payment with id [%s]", payment.ID)
 	}
 
+	// The whole amount captured has been refunded, so the session gives up its claim on its cost resources
+	service.PaymentService.releaseResources(req.Context(), payment.ID, SessionResources(models.PaymentLinksRest(payment.Data.Links)))
+
 	return nil
 }
 
@@ -522,7 +590,7 @@ func (service *RefundService) checkGovPayAndUpdateRefundStatus(req *http.Request
 
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error getting payment resource ID [%s]: [%w]", x.ID, err))
-				err := service.DAO.IncrementRefundAttempts(x.ID, &x)
+				err := service.DAO.IncrementRefundAttempts(req.Context(), x.ID, &x)
 				if err != nil {
 					log.ErrorR(req, fmt.Errorf(ErrorIncrementingAttempts, err))
 				}
@@ -531,18 +599,18 @@ func (service *RefundService) checkGovPayAndUpdateRefundStatus(req *http.Request
 
 			if response == NotFound {
 				log.ErrorR(req, fmt.Errorf("not found error from payment service session with payment ID:[%s]", x.ID))
-				err := service.DAO.IncrementRefundAttempts(x.ID, &x)
+				err := service.DAO.IncrementRefundAttempts(req.Context(), x.ID, &x)
 				if err != nil {
 					log.ErrorR(req, fmt.Errorf(ErrorIncrementingAttempts, err))
 				}
 				continue
 			}
 
-			govPayStatusResponse, response, err := service.GovPayService.GetRefundStatus(paymentSession, refund.RefundId)
+			govPayStatusResponse, response, err := service.GovPayService.GetRefundStatus(req.Context(), paymentSession, refund.RefundId)
 
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error getting refund status for ID [%s] [%w]", refund.RefundId, err))
-				err := service.DAO.IncrementRefundAttempts(x.ID, &x)
+				err := service.DAO.IncrementRefundAttempts(req.Context(), x.ID, &x)
 				if err != nil {
 					log.ErrorR(req, fmt.Errorf(ErrorIncrementingAttempts, err))
 				}
@@ -551,13 +619,14 @@ func (service *RefundService) checkGovPayAndUpdateRefundStatus(req *http.Request
 
 			isRefunded := govPayStatusResponse != nil && govPayStatusResponse.Status == RefundsStatusSuccess
 
-			payment, err := service.DAO.PatchRefundSuccessStatus(x.ID, isRefunded, &x)
+			payment, err := service.DAO.PatchRefundSuccessStatus(req.Context(), x.ID, isRefunded, &x)
 			if err != nil {
 				log.ErrorR(req, fmt.Errorf("error patching payment ID [%s] [%w]", x.ID, err))
 				// No need to error out here, can continue to reconciliation
 			}
 
 			if payment.Refunds[0].Status == "refund-success" {
+				service.PaymentService.releaseRefundedResources(req.Context(), transformers.PaymentTransformer{}.TransformToRest(payment))
 				updatedPayments = append(updatedPayments, payment)
 			}
 		} else {
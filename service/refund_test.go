@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"net/http"
@@ -25,10 +26,12 @@ func TestUnitCreateRefund(t *testing.T) {
 
 	mockDao := dao.NewMockDAO(mockCtrl)
 	mockGovPayService := NewMockPaymentProviderService(mockCtrl)
+	mockAccountService := NewMockPaymentProviderService(mockCtrl)
 	mockPaymentService := createMockPaymentService(mockDao, cfg)
 
 	service := RefundService{
 		GovPayService:  mockGovPayService,
+		AccountService: mockAccountService,
 		PaymentService: &mockPaymentService,
 		DAO:            mockDao,
 		Config:         *cfg,
@@ -42,7 +45,7 @@ func TestUnitCreateRefund(t *testing.T) {
 
 		payment := generatePaymentSession("invalid-method")
 		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -75,7 +78,7 @@ func TestUnitCreateRefund(t *testing.T) {
 			},
 		}
 		payment.Refunds = refunds
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -98,7 +101,7 @@ func TestUnitCreateRefund(t *testing.T) {
 		payment := generatePaymentSessionGovPay()
 		fmt.Println(payment.Data.PaymentMethod)
 		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -107,7 +110,7 @@ func TestUnitCreateRefund(t *testing.T) {
 		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
 
 		mockGovPayService.EXPECT().
-			GetRefundSummary(req, id).
+			GetRefundSummary(gomock.Any(), id).
 			Return(nil, nil, Error, err)
 
 		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
@@ -124,7 +127,7 @@ func TestUnitCreateRefund(t *testing.T) {
 
 		payment := generatePaymentSessionGovPay()
 		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -133,7 +136,7 @@ func TestUnitCreateRefund(t *testing.T) {
 		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
 
 		mockGovPayService.EXPECT().
-			GetRefundSummary(req, id).
+			GetRefundSummary(gomock.Any(), id).
 			Return(nil, refundSummary, Success, nil)
 
 		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
@@ -152,7 +155,7 @@ func TestUnitCreateRefund(t *testing.T) {
 
 		payment := generatePaymentSessionGovPay()
 		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -163,11 +166,11 @@ func TestUnitCreateRefund(t *testing.T) {
 		err := fmt.Errorf("error reading refund GovPayRequest")
 
 		mockGovPayService.EXPECT().
-			GetRefundSummary(req, id).
+			GetRefundSummary(gomock.Any(), id).
 			Return(paymentResource, refundSummary, Success, nil)
 
 		mockGovPayService.EXPECT().
-			CreateRefund(paymentResource, refundRequest).
+			CreateRefund(gomock.Any(), paymentResource, refundRequest).
 			Return(nil, Error, err)
 
 		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
@@ -187,7 +190,7 @@ func TestUnitCreateRefund(t *testing.T) {
 
 		payment := generatePaymentSessionGovPay()
 		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -198,15 +201,15 @@ func TestUnitCreateRefund(t *testing.T) {
 		err := fmt.Errorf("error reading refund GovPayRequest")
 
 		mockGovPayService.EXPECT().
-			GetRefundSummary(req, id).
+			GetRefundSummary(gomock.Any(), id).
 			Return(paymentResource, refundSummary, Success, nil)
 
 		mockGovPayService.EXPECT().
-			CreateRefund(paymentResource, refundRequest).
+			CreateRefund(gomock.Any(), paymentResource, refundRequest).
 			Return(response, Success, nil)
 
 		mockDao.EXPECT().
-			PatchPaymentResource(id, gomock.Any()).
+			PatchPaymentResource(gomock.Any(), id, gomock.Any()).
 			Return(fmt.Errorf("err"))
 
 		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
@@ -226,7 +229,7 @@ func TestUnitCreateRefund(t *testing.T) {
 
 		payment := generatePaymentSessionGovPay()
 		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&payment, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -237,15 +240,15 @@ func TestUnitCreateRefund(t *testing.T) {
 		err := fmt.Errorf("error reading refund GovPayRequest")
 
 		mockGovPayService.EXPECT().
-			GetRefundSummary(req, id).
+			GetRefundSummary(gomock.Any(), id).
 			Return(paymentResource, refundSummary, Success, nil)
 
 		mockGovPayService.EXPECT().
-			CreateRefund(paymentResource, refundRequest).
+			CreateRefund(gomock.Any(), paymentResource, refundRequest).
 			Return(response, Success, nil)
 
 		mockDao.EXPECT().
-			PatchPaymentResource(id, gomock.Any()).
+			PatchPaymentResource(gomock.Any(), id, gomock.Any()).
 			Return(nil)
 
 		service.Config.GovPaySandbox = true
@@ -256,6 +259,154 @@ func TestUnitCreateRefund(t *testing.T) {
 		So(status, ShouldEqual, Success)
 		So(err, ShouldBeNil)
 	})
+
+	Convey("Refund of a payment session paid from an account is credited back to it", t, func() {
+		body := fixtures.GetRefundRequest(8)
+		refundSummary := fixtures.GetRefundSummary(8)
+		paymentResource := &models.PaymentResourceRest{}
+		refundRequest := fixtures.GetCreateRefundGovPayRequest(body.Amount, refundSummary.AmountAvailable)
+		response := &models.CreateRefundGovPayResponse{RefundId: "entry", Amount: body.Amount, Status: RefundsStatusSuccess}
+
+		payment := generatePaymentSession(PaymentMethodAccount)
+		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		mockAccountService.EXPECT().
+			GetRefundSummary(gomock.Any(), id).
+			Return(paymentResource, refundSummary, Success, nil)
+
+		mockAccountService.EXPECT().
+			CreateRefund(gomock.Any(), paymentResource, refundRequest).
+			Return(response, Success, nil)
+
+		mockDao.EXPECT().
+			PatchPaymentResource(gomock.Any(), id, gomock.Any()).
+			Return(nil)
+
+		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
+
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentSession.Refunds, ShouldHaveLength, 1)
+		So(refund.Status, ShouldEqual, "refund-success")
+	})
+
+	basketSession := func() *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Links: models.PaymentLinksRest{
+				Resource:  "http://dummy-resource",
+				Resources: []string{"http://dummy-resource", "http://other-resource"},
+			},
+			Costs: []models.CostResourceRest{
+				{Amount: "10.00", Resource: "http://dummy-resource"},
+				{Amount: "0.05", Resource: "http://other-resource"},
+			},
+			Refunds: []models.RefundResourceRest{
+				{RefundId: "earlier", Amount: 3, Status: RefundsStatusSuccess, Resource: "http://other-resource"},
+				{RefundId: "failed", Amount: 5, Status: RefundsStatusError, Resource: "http://other-resource"},
+			},
+		}
+	}
+
+	Convey("Refund against a resource the session doesn't pay for", t, func() {
+		body := fixtures.GetRefundRequest(2)
+		body.Resource = "http://unknown-resource"
+
+		payment := generatePaymentSessionGovPay()
+		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		mockGovPayService.EXPECT().
+			GetRefundSummary(gomock.Any(), id).
+			Return(basketSession(), fixtures.GetRefundSummary(1000), Success, nil)
+
+		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
+
+		So(paymentSession, ShouldBeNil)
+		So(refund, ShouldBeNil)
+		So(status, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "cost resource [http://unknown-resource] is not paid for by payment session")
+	})
+
+	Convey("Refund against a basket resource is limited to what is left of its costs", t, func() {
+		body := fixtures.GetRefundRequest(3)
+		body.Resource = "http://other-resource"
+
+		payment := generatePaymentSessionGovPay()
+		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		mockGovPayService.EXPECT().
+			GetRefundSummary(gomock.Any(), id).
+			Return(basketSession(), fixtures.GetRefundSummary(1000), Success, nil)
+
+		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
+
+		So(paymentSession, ShouldBeNil)
+		So(refund, ShouldBeNil)
+		So(status, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "refund amount is higher than available amount for resource")
+	})
+
+	Convey("Refund against a basket resource is recorded against it", t, func() {
+		body := fixtures.GetRefundRequest(2)
+		body.Resource = "http://other-resource"
+		refundSummary := fixtures.GetRefundSummary(1000)
+		paymentResource := basketSession()
+		refundRequest := fixtures.GetCreateRefundGovPayRequest(body.Amount, refundSummary.AmountAvailable)
+
+		payment := generatePaymentSessionGovPay()
+		payment.Data.Links = models.PaymentLinksDB{Resource: "http://dummy-resource"}
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&payment, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		mockGovPayService.EXPECT().
+			GetRefundSummary(gomock.Any(), id).
+			Return(paymentResource, refundSummary, Success, nil)
+
+		mockGovPayService.EXPECT().
+			CreateRefund(gomock.Any(), paymentResource, refundRequest).
+			Return(fixtures.GetCreateRefundGovPayResponse(), Success, nil)
+
+		var patched *models.PaymentResourceDB
+		mockDao.EXPECT().
+			PatchPaymentResource(gomock.Any(), id, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, paymentUpdate *models.PaymentResourceDB) error {
+				patched = paymentUpdate
+				return nil
+			})
+
+		paymentSession, refund, status, err := service.CreateRefund(req, id, body)
+
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(refund.Resource, ShouldEqual, "http://other-resource")
+		So(paymentSession.Refunds, ShouldHaveLength, 3)
+		So(patched.Refunds[2].Resource, ShouldEqual, "http://other-resource")
+	})
 }
 
 func TestUnitUpdateRefund(t *testing.T) {
@@ -279,7 +430,7 @@ func TestUnitUpdateRefund(t *testing.T) {
 	refundId := "321"
 
 	Convey("Error when getting payment session", t, func() {
-		mockDao.EXPECT().GetPaymentResource(paymentId).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), paymentId).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
 
 		refund, status, err := service.UpdateRefund(req, paymentId, refundId)
 
@@ -289,7 +440,7 @@ func TestUnitUpdateRefund(t *testing.T) {
 	})
 
 	Convey("Error getting payment resource from db", t, func() {
-		mockDao.EXPECT().GetPaymentResource(paymentId).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), paymentId).Return(&models.PaymentResourceDB{}, fmt.Errorf("error"))
 
 		refund, status, err := service.UpdateRefund(req, paymentId, refundId)
 
@@ -299,7 +450,7 @@ func TestUnitUpdateRefund(t *testing.T) {
 	})
 
 	Convey("Payment resource not found in db", t, func() {
-		mockDao.EXPECT().GetPaymentResource(paymentId).Return(nil, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), paymentId).Return(nil, nil)
 
 		refund, status, err := service.UpdateRefund(req, paymentId, refundId)
 
@@ -309,7 +460,7 @@ func TestUnitUpdateRefund(t *testing.T) {
 	})
 
 	Convey("Refund id not present in payment session", t, func() {
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
 
 		httpmock.Activate()
 		defer httpmock.DeactivateAndReset()
@@ -336,8 +487,8 @@ func TestUnitUpdateRefund(t *testing.T) {
 
 	Convey("Error getting response from GovPay ", t, func() {
 		now := time.Now()
-		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), refundId).Return(nil, Error, fmt.Errorf("error generating request for GovPay"))
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
+		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), gomock.Any(), refundId).Return(nil, Error, fmt.Errorf("error generating request for GovPay"))
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
 			{
 				RefundId:          refundId,
 				CreatedAt:         now.String(),
@@ -372,9 +523,9 @@ func TestUnitUpdateRefund(t *testing.T) {
 
 	Convey("Error patching payment session", t, func() {
 		now := time.Now()
-		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), refundId).Return(&models.CreateRefundGovPayResponse{Status: RefundsStatusSuccess}, Success, nil)
-		mockDao.EXPECT().PatchPaymentResource(paymentId, gomock.Any()).Return(fmt.Errorf("err"))
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
+		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), gomock.Any(), refundId).Return(&models.CreateRefundGovPayResponse{Status: RefundsStatusSuccess}, Success, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), paymentId, gomock.Any()).Return(fmt.Errorf("err"))
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
 			{
 				RefundId:          refundId,
 				CreatedAt:         now.String(),
@@ -410,11 +561,11 @@ func TestUnitUpdateRefund(t *testing.T) {
 	Convey("Patches resource", t, func() {
 		now := time.Now()
 		var capturedSession *models.PaymentResourceDB
-		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), refundId).Return(&models.CreateRefundGovPayResponse{Status: RefundsStatusSuccess}, Success, nil)
-		mockDao.EXPECT().PatchPaymentResource(paymentId, gomock.Any()).Do(func(paymentId string, session *models.PaymentResourceDB) {
+		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), gomock.Any(), refundId).Return(&models.CreateRefundGovPayResponse{Status: RefundsStatusSuccess}, Success, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), paymentId, gomock.Any()).Do(func(_ context.Context, paymentId string, session *models.PaymentResourceDB) {
 			capturedSession = session
 		})
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
 			{
 				RefundId:          refundId,
 				CreatedAt:         now.String(),
@@ -447,6 +598,34 @@ func TestUnitUpdateRefund(t *testing.T) {
 		So(refund.Status, ShouldEqual, RefundsStatusSuccess)
 		So(err, ShouldBeNil)
 	})
+
+	Convey("Patches resource and releases the claims of a fully refunded session", t, func() {
+		now := time.Now()
+		mockGovPayService.EXPECT().GetRefundStatus(gomock.Any(), gomock.Any(), refundId).Return(&models.CreateRefundGovPayResponse{Status: RefundsStatusSuccess}, Success, nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), paymentId, gomock.Any()).Return(nil)
+		mockDao.EXPECT().ReleaseResource(gomock.Any(), "http://dummy-resource", "1234").Return(nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{ID: "1234", ExternalPaymentStatusURI: "http://external_uri", Refunds: []models.RefundResourceDB{
+			{
+				RefundId:          refundId,
+				CreatedAt:         now.String(),
+				Amount:            1000,
+				Status:            "submitted",
+				ExternalRefundUrl: "external",
+			},
+		}, Data: models.PaymentResourceDataDB{Amount: "10.00", Links: models.PaymentLinksDB{Resource: "http://dummy-resource"}}}, nil)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-resource", jsonResponse)
+
+		refund, status, err := service.UpdateRefund(req, paymentId, refundId)
+
+		So(status, ShouldEqual, Success)
+		So(refund.Status, ShouldEqual, RefundsStatusSuccess)
+		So(err, ShouldBeNil)
+	})
 }
 
 func TestUnitValidateBatchRefund(t *testing.T) {
@@ -459,7 +638,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundGovPay()
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(nil, fmt.Errorf("error")).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error")).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 0)
@@ -473,7 +652,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundPayPal()
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any()).Return(nil, fmt.Errorf("error")).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("error")).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 0)
@@ -487,7 +666,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundGovPay()
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(nil, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -501,7 +680,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundPayPal()
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any()).Return(nil, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -515,7 +694,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefund("invalid")
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(nil, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 0)
@@ -530,7 +709,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		batchRefund := generateXMLBatchRefundGovPay()
 		paymentSession := generatePaymentSessionPayPal()
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -545,7 +724,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		batchRefund := generateXMLBatchRefundPayPal()
 		paymentSession := generatePaymentSessionGovPay()
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -561,7 +740,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		paymentSession := generatePaymentSessionGovPay()
 		paymentSession.Data.Amount = "1.00"
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -577,7 +756,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		paymentSession := generatePaymentSessionPayPal()
 		paymentSession.Data.Amount = "1.00"
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -593,7 +772,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		paymentSession := generatePaymentSessionGovPay()
 		paymentSession.Data.Status = Pending.String()
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -609,7 +788,7 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		paymentSession := generatePaymentSessionPayPal()
 		paymentSession.Data.Status = Pending.String()
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any()).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(&paymentSession, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 2)
@@ -626,8 +805,8 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		paymentSession2 := generatePaymentSessionGovPay()
 		paymentSession2.ExternalPaymentStatusID = "1212"
 
-		mockDao.EXPECT().GetPaymentResourceByProviderID(batchRefund.RefundDetails[0].OrderCode).Return(&paymentSession, nil).AnyTimes()
-		mockDao.EXPECT().GetPaymentResourceByProviderID(batchRefund.RefundDetails[1].OrderCode).Return(&paymentSession2, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), batchRefund.RefundDetails[0].OrderCode).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByProviderID(gomock.Any(), batchRefund.RefundDetails[1].OrderCode).Return(&paymentSession2, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 0)
@@ -644,8 +823,8 @@ func TestUnitValidateBatchRefund(t *testing.T) {
 		paymentSession2 := generatePaymentSessionPayPal()
 		paymentSession2.ExternalPaymentStatusID = "1212"
 
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(batchRefund.RefundDetails[0].OrderCode).Return(&paymentSession, nil).AnyTimes()
-		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(batchRefund.RefundDetails[1].OrderCode).Return(&paymentSession2, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), batchRefund.RefundDetails[0].OrderCode).Return(&paymentSession, nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResourceByExternalPaymentTransactionID(gomock.Any(), batchRefund.RefundDetails[1].OrderCode).Return(&paymentSession2, nil).AnyTimes()
 		validationErrors, err := service.ValidateBatchRefund(req.Context(), batchRefund)
 
 		So(len(validationErrors), ShouldEqual, 0)
@@ -663,7 +842,7 @@ func TestUnitUpdateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundGovPay()
 
-		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any()).Return(fmt.Errorf("error")).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error")).AnyTimes()
 		err := service.UpdateBatchRefund(req.Context(), batchRefund, "filename", "userID")
 
 		So(err, ShouldNotBeNil)
@@ -676,7 +855,7 @@ func TestUnitUpdateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefund("invalid")
 
-		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any()).Return(nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		err := service.UpdateBatchRefund(req.Context(), batchRefund, "filename", "userID")
 
 		So(err.Error(), ShouldEqual, "invalid payment provider: [invalid]")
@@ -689,7 +868,7 @@ func TestUnitUpdateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundGovPay()
 
-		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any()).Return(nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByProviderID(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		err := service.UpdateBatchRefund(req.Context(), batchRefund, "filename", "userID")
 
 		So(err, ShouldBeNil)
@@ -702,7 +881,7 @@ func TestUnitUpdateBatchRefund(t *testing.T) {
 
 		batchRefund := generateXMLBatchRefundPayPal()
 
-		mockDao.EXPECT().CreateBulkRefundByExternalPaymentTransactionID(gomock.Any()).Return(nil).AnyTimes()
+		mockDao.EXPECT().CreateBulkRefundByExternalPaymentTransactionID(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		err := service.UpdateBatchRefund(req.Context(), batchRefund, "filename", "userID")
 
 		So(err, ShouldBeNil)
@@ -722,9 +901,9 @@ func TestUnitGetRefundPendingPayments(t *testing.T) {
 	}
 
 	Convey("Error when getting payment session", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return([]models.PaymentResourceDB{}, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return([]models.PaymentResourceDB{}, fmt.Errorf("error"))
 
-		pendingRefundPayments, err := service.GetPaymentsWithPendingRefundStatus()
+		pendingRefundPayments, err := service.GetPaymentsWithPendingRefundStatus(context.Background())
 
 		So(pendingRefundPayments, ShouldBeNil)
 		So(err.Error(), ShouldEqual, "error getting payment resources with pending refund status: [error]")
@@ -734,10 +913,10 @@ func TestUnitGetRefundPendingPayments(t *testing.T) {
 		pendingRefunds := fixtures.GetPendingRefundPayments()
 
 		mockDao.EXPECT().
-			GetPaymentsWithRefundStatus().
+			GetPaymentsWithRefundStatus(gomock.Any()).
 			Return(pendingRefunds, nil)
 
-		paymentResources, err := service.GetPaymentsWithPendingRefundStatus()
+		paymentResources, err := service.GetPaymentsWithPendingRefundStatus(context.Background())
 
 		So(paymentResources, ShouldNotBeNil)
 		So(err, ShouldBeNil)
@@ -757,7 +936,7 @@ func TestUnitProcessBatchRefund(t *testing.T) {
 	}
 
 	Convey("Error retrieving payments from DB", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(nil, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(nil, fmt.Errorf("error"))
 
 		errs := service.ProcessBatchRefund(req)
 
@@ -766,7 +945,7 @@ func TestUnitProcessBatchRefund(t *testing.T) {
 	})
 
 	Convey("No payments with refund-pending status found in DB", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return([]models.PaymentResourceDB{}, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return([]models.PaymentResourceDB{}, nil)
 
 		errs := service.ProcessBatchRefund(req)
 
@@ -781,7 +960,7 @@ func TestUnitProcessBatchRefund(t *testing.T) {
 		}
 		paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 		pList := []models.PaymentResourceDB{paymentSession}
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 
 		errs := service.ProcessBatchRefund(req)
 		So(len(errs), ShouldEqual, 1)
@@ -792,9 +971,9 @@ func TestUnitProcessBatchRefund(t *testing.T) {
 		bulkRefund := models.BulkRefundDB{Amount: "invalid"}
 		paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 		pList := []models.PaymentResourceDB{paymentSession}
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(nil, fmt.Errorf("err"))
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("err"))
 
 		errs := service.ProcessBatchRefund(req)
 		So(len(errs), ShouldEqual, 1)
@@ -805,7 +984,7 @@ func TestUnitProcessBatchRefund(t *testing.T) {
 		bulkRefund := models.BulkRefundDB{Amount: "invalid"}
 		paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 		pList := []models.PaymentResourceDB{paymentSession}
-		mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 
 		errs := service.ProcessBatchRefund(req)
 		So(len(errs), ShouldEqual, 1)
@@ -826,7 +1005,7 @@ func TestUnitGetPaymentRefunds(t *testing.T) {
 	}
 
 	Convey("Error when getting payment's refunds session", t, func() {
-		mockDao.EXPECT().GetPaymentRefunds("123").Return([]models.RefundResourceDB{}, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentRefunds(gomock.Any(), "123").Return([]models.RefundResourceDB{}, fmt.Errorf("error"))
 
 		pendingRefundPayments, err := service.GetPaymentRefunds(req, "123")
 
@@ -837,7 +1016,7 @@ func TestUnitGetPaymentRefunds(t *testing.T) {
 	Convey("Error is nil witn no refunds", t, func() {
 		paymentRefunds := []models.RefundResourceDB{}
 
-		mockDao.EXPECT().GetPaymentRefunds("123").Return(paymentRefunds, nil)
+		mockDao.EXPECT().GetPaymentRefunds(gomock.Any(), "123").Return(paymentRefunds, nil)
 
 		_, err := service.GetPaymentRefunds(req, "123")
 
@@ -854,7 +1033,7 @@ func TestUnitGetPaymentRefunds(t *testing.T) {
 		}
 		paymentRefunds := []models.RefundResourceDB{refundData}
 
-		mockDao.EXPECT().GetPaymentRefunds("123").Return(paymentRefunds, nil)
+		mockDao.EXPECT().GetPaymentRefunds(gomock.Any(), "123").Return(paymentRefunds, nil)
 
 		refunds, _ := service.GetPaymentRefunds(req, "123")
 
@@ -881,7 +1060,7 @@ func TestUnitProcessPendingRefunds(t *testing.T) {
 	}
 
 	Convey("Error retrieving payments with paid status from DB", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return(nil, fmt.Errorf("error"))
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return(nil, fmt.Errorf("error"))
 
 		_, Error, errs := service.ProcessPendingRefunds(req)
 
@@ -891,8 +1070,8 @@ func TestUnitProcessPendingRefunds(t *testing.T) {
 	})
 
 	Convey("No payments with paid status found in DB", t, func() {
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return([]models.PaymentResourceDB{}, nil)
-		mockDao.EXPECT().IncrementRefundAttempts(gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return([]models.PaymentResourceDB{}, nil)
+		mockDao.EXPECT().IncrementRefundAttempts(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 		_, Success, errs := service.ProcessPendingRefunds(req)
 
@@ -926,9 +1105,9 @@ func TestUnitProcessPendingRefunds(t *testing.T) {
 		paymentsPaidStatus := []models.PaymentResourceDB{}
 		paymentsPaidStatus = append(paymentsPaidStatus, paymentsPaidData)
 
-		mockDao.EXPECT().GetPaymentResource("xVzfvN3TlKWAAPp").Return(&models.PaymentResourceDB{}, nil)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), "xVzfvN3TlKWAAPp").Return(&models.PaymentResourceDB{}, nil)
 
-		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus().Return(paymentsPaidStatus, nil)
+		mockDao.EXPECT().GetPaymentsWithRefundPendingStatus(gomock.Any()).Return(paymentsPaidStatus, nil)
 
 		payments, ResponseType, errs := service.ProcessPendingRefunds(req)
 
@@ -968,7 +1147,7 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			}
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 
 			res := service.ProcessBatchRefund(req)
 
@@ -988,7 +1167,7 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			paymentSession1 := generatePaymentSessionGovPay()
 			paymentSession1.BulkRefund = append(paymentSession1.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession, paymentSession1}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1008,8 +1187,8 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			}
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
-			mockGovPayService.EXPECT().GetRefundSummary(req, gomock.Any()).Return(nil, nil, Error, fmt.Errorf("error"))
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
+			mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(nil, nil, Error, fmt.Errorf("error"))
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1030,8 +1209,8 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			}
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
-			mockGovPayService.EXPECT().GetRefundSummary(req, gomock.Any()).Return(paymentResource, refundSummary, Success, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
+			mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, Success, nil)
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1054,9 +1233,9 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			}
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 			mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, Success, nil)
-			mockGovPayService.EXPECT().CreateRefund(paymentResource, refundRequest).Return(nil, Error, fmt.Errorf("error"))
+			mockGovPayService.EXPECT().CreateRefund(gomock.Any(), paymentResource, refundRequest).Return(nil, Error, fmt.Errorf("error"))
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1080,10 +1259,10 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			}
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 			mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, Success, nil)
-			mockGovPayService.EXPECT().CreateRefund(paymentResource, refundRequest).Return(response, Success, nil)
-			mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
+			mockGovPayService.EXPECT().CreateRefund(gomock.Any(), paymentResource, refundRequest).Return(response, Success, nil)
+			mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("error"))
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1108,10 +1287,10 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			}
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 			mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, Success, nil)
-			mockGovPayService.EXPECT().CreateRefund(paymentResource, refundRequest).Return(response, Success, nil)
-			mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+			mockGovPayService.EXPECT().CreateRefund(gomock.Any(), paymentResource, refundRequest).Return(response, Success, nil)
+			mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1136,10 +1315,10 @@ func TestUnitProcessGovPayBatchRefund(t *testing.T) {
 			paymentSession.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			paymentSession1.BulkRefund = append(paymentSession.BulkRefund, bulkRefund)
 			pList := []models.PaymentResourceDB{paymentSession, paymentSession1}
-			mockDao.EXPECT().GetPaymentsWithRefundStatus().Return(pList, nil)
+			mockDao.EXPECT().GetPaymentsWithRefundStatus(gomock.Any()).Return(pList, nil)
 			mockGovPayService.EXPECT().GetRefundSummary(gomock.Any(), gomock.Any()).Return(paymentResource, refundSummary, Success, nil).Times(2)
-			mockGovPayService.EXPECT().CreateRefund(paymentResource, refundRequest).Return(response, Success, nil).Times(2)
-			mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+			mockGovPayService.EXPECT().CreateRefund(gomock.Any(), paymentResource, refundRequest).Return(response, Success, nil).Times(2)
+			mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
 
 			res := service.ProcessBatchRefund(req)
 
@@ -1156,14 +1335,17 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 
 	mockDao := dao.NewMockDAO(mockCtrl)
 	mockPayPalService := NewMockPaymentProviderService(mockCtrl)
+	cfg, _ := config.Get()
+	mockPaymentService := createMockPaymentService(mockDao, cfg)
 
 	refundService := RefundService{
-		PayPalService: mockPayPalService,
-		DAO:           mockDao,
+		PayPalService:  mockPayPalService,
+		PaymentService: &mockPaymentService,
+		DAO:            mockDao,
 	}
 
 	Convey("Error getting payment details from PayPal", t, func() {
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(nil, fmt.Errorf("err"))
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("err"))
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
 			BulkRefund: []models.BulkRefundDB{{}},
@@ -1176,7 +1358,7 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 		captureDetails := paypal.CaptureDetailsResponse{
 			Status: "FAILED",
 		}
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(&captureDetails, nil)
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(&captureDetails, nil)
 
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
@@ -1194,7 +1376,7 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 				Value: "10.00",
 			},
 		}
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(&captureDetails, nil)
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(&captureDetails, nil)
 
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
@@ -1215,9 +1397,9 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 				Value: "10.00",
 			},
 		}
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(&captureDetails, nil)
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(&captureDetails, nil)
 
-		mockPayPalService.EXPECT().RefundCapture(gomock.Any()).Return(nil, fmt.Errorf("err"))
+		mockPayPalService.EXPECT().RefundCapture(gomock.Any(), gomock.Any()).Return(nil, fmt.Errorf("err"))
 
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
@@ -1238,12 +1420,12 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 				Value: "10.00",
 			},
 		}
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(&captureDetails, nil)
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(&captureDetails, nil)
 
 		refundResponse := paypal.RefundResponse{
 			Status: "CANCELLED",
 		}
-		mockPayPalService.EXPECT().RefundCapture(gomock.Any()).Return(&refundResponse, nil)
+		mockPayPalService.EXPECT().RefundCapture(gomock.Any(), gomock.Any()).Return(&refundResponse, nil)
 
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
@@ -1264,12 +1446,12 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 				Value: "10.00",
 			},
 		}
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(&captureDetails, nil)
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(&captureDetails, nil)
 
 		refundResponse := paypal.RefundResponse{
 			Status: "COMPLETED",
 		}
-		mockPayPalService.EXPECT().RefundCapture(gomock.Any()).Return(&refundResponse, nil)
+		mockPayPalService.EXPECT().RefundCapture(gomock.Any(), gomock.Any()).Return(&refundResponse, nil)
 
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
@@ -1279,7 +1461,7 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 			},
 		}
 
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(fmt.Errorf("err"))
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("err"))
 
 		err := refundService.processPayPalBatchRefund(req, paymentResource)
 		So(err.Error(), ShouldEqual, "error patching payment with id [123]")
@@ -1292,22 +1474,24 @@ func TestUnitProcessPayPalBatchRefund(t *testing.T) {
 				Value: "10.00",
 			},
 		}
-		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any()).Return(&captureDetails, nil)
+		mockPayPalService.EXPECT().GetCapturedPaymentDetails(gomock.Any(), gomock.Any()).Return(&captureDetails, nil)
 
 		refundResponse := paypal.RefundResponse{
 			Status: "COMPLETED",
 		}
-		mockPayPalService.EXPECT().RefundCapture(gomock.Any()).Return(&refundResponse, nil)
+		mockPayPalService.EXPECT().RefundCapture(gomock.Any(), gomock.Any()).Return(&refundResponse, nil)
 
 		paymentResource := models.PaymentResourceDB{
 			ID:         "123",
 			BulkRefund: []models.BulkRefundDB{{}},
 			Data: models.PaymentResourceDataDB{
 				Amount: "10.00",
+				Links:  models.PaymentLinksDB{Resource: "http://dummy-resource"},
 			},
 		}
 
-		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().PatchPaymentResource(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		mockDao.EXPECT().ReleaseResource(gomock.Any(), "http://dummy-resource", "123").Return(nil)
 
 		err := refundService.processPayPalBatchRefund(req, paymentResource)
 		So(err, ShouldBeNil)
@@ -1363,8 +1547,8 @@ func TestUnitCheckGovPayAndUpdateRefundStatus(t *testing.T) {
 
 	Convey("Process pending refunds payments status with payments", t, func() {
 		paymentsPaidDatas = append(paymentsPaidDatas, paymentsPaidData)
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&paymentsPaidData, nil)
-		mockDao.EXPECT().IncrementRefundAttempts(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&paymentsPaidData, nil)
+		mockDao.EXPECT().IncrementRefundAttempts(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 		updatedPayments := service.checkGovPayAndUpdateRefundStatus(req, paymentsPaidDatas)
 		So(len(updatedPayments), ShouldBeZeroValue)
@@ -1383,7 +1567,7 @@ func TestUnitCheckGovPayAndUpdateRefundStatus(t *testing.T) {
 			BulkRefund:                   nil,
 		}
 		paymentsPaidDatas := []models.PaymentResourceDB{paymentsPaidData, newPaymentsPaidData}
-		mockDao.EXPECT().GetPaymentResource(gomock.Any()).Return(&models.PaymentResourceDB{}, nil).MinTimes(1)
+		mockDao.EXPECT().GetPaymentResource(gomock.Any(), gomock.Any()).Return(&models.PaymentResourceDB{}, nil).MinTimes(1)
 
 		updatedPayments := service.checkGovPayAndUpdateRefundStatus(req, paymentsPaidDatas)
 		So(len(updatedPayments), ShouldBeZeroValue)
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/shopspring/decimal"
+)
+
+// claimResources claims cost resources for a payment session until the given time, or indefinitely if it is zero. It
+// returns a Conflict if another session holds a claim on any of them, as only one session can pay a resource at once.
+// The check made as a session is created is only a read, so it's the claim that stops two sessions paying a resource.
+func (service *PaymentService) claimResources(ctx context.Context, id string, resources []string, expiresAt time.Time) (ResponseType, error) {
+	for _, resource := range resources {
+		claimed, err := service.DAO.ClaimResource(ctx, resource, id, expiresAt)
+		if err != nil {
+			return Error, fmt.Errorf("error claiming cost resource [%s]: [%v]", resource, err)
+		}
+		if !claimed {
+			return Conflict, fmt.Errorf("cost resource [%s] is being paid by another payment session", resource)
+		}
+	}
+	return Success, nil
+}
+
+// releaseResources gives up the claims a payment session holds on cost resources, so that another session can pay them.
+// A claim which can't be released is left to expire.
+func (service *PaymentService) releaseResources(ctx context.Context, id string, resources []string) {
+	for _, resource := range resources {
+		err := service.DAO.ReleaseResource(ctx, resource, id)
+		if err != nil {
+			log.Error(fmt.Errorf("error releasing claim on cost resource [%s]: [%v]", resource, err), log.Data{"payment_id": id})
+		}
+	}
+}
+
+// settleResourceClaims updates the claims a payment session holds on its cost resources once it has been given a new
+// status. A paid session keeps its claim for good, while one that can no longer be paid gives it up so that another
+// session can pay them. A session which can still be paid keeps the claim it has.
+func (service *PaymentService) settleResourceClaims(ctx context.Context, id, status string, resources []string) {
+	switch status {
+	case Paid.String(), Overpaid.String():
+		if _, err := service.claimResources(ctx, id, resources, time.Time{}); err != nil {
+			log.Error(fmt.Errorf("paid payment session couldn't keep its claim on its cost resources, which may have been paid twice: [%v]", err), log.Data{"payment_id": id})
+		}
+	case "", InProgress.String(), AwaitingTransfer.String(), Underpaid.String():
+	default:
+		service.releaseResources(ctx, id, resources)
+	}
+}
+
+// succeededRefundStatuses are the statuses of refunds which have been made, as given by the provider or recorded by
+// the pending refunds check
+var succeededRefundStatuses = []string{RefundsStatusSuccess, "refund-success"}
+
+// releaseRefundedResources gives up a paid payment session's claim on its cost resources once the refunds of it that
+// have succeeded add up to the amount paid, so that the resources can be paid again
+func (service *PaymentService) releaseRefundedResources(ctx context.Context, paymentSession models.PaymentResourceRest) {
+	amount, err := decimal.NewFromString(paymentSession.Amount)
+	if err != nil || amount.IsZero() {
+		return
+	}
+	var refunded int64
+	for _, refund := range paymentSession.Refunds {
+		if slices.Contains(succeededRefundStatuses, refund.Status) {
+			refunded += int64(refund.Amount)
+		}
+	}
+	if refunded >= amount.Shift(2).IntPart() {
+		log.Info("payment session fully refunded, releasing its claim on its cost resources", log.Data{"payment_id": paymentSession.MetaData.ID})
+		service.releaseResources(ctx, paymentSession.MetaData.ID, SessionResources(paymentSession.Links))
+	}
+}
+
+// journeyClaimExpiry returns when the claim a payment session takes on its cost resources as an external payment
+// journey is created expires, which is once either the session or the GOV.UK Pay journey has expired
+func journeyClaimExpiry(paymentSession models.PaymentResourceRest, cfg *config.Config) time.Time {
+	journeyExpiresAt := helpers.MongoNow().Add(time.Minute * time.Duration(cfg.GovPayExpiryTime))
+	if sessionExpiresAt := ExpiresAt(paymentSession, cfg); sessionExpiresAt.Before(journeyExpiresAt) {
+		return sessionExpiresAt
+	}
+	return journeyExpiresAt
+}
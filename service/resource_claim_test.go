@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitClaimResources(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	req := httptest.NewRequest("GET", "/test", nil)
+	expiresAt := time.Now().Add(time.Hour)
+
+	Convey("Error claiming a resource", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ClaimResource(gomock.Any(), "first", "1234", expiresAt).Return(false, fmt.Errorf("error"))
+
+		responseType, err := mockPaymentService.claimResources(req.Context(), "1234", []string{"first", "second"}, expiresAt)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error claiming cost resource [first]: [error]")
+	})
+
+	Convey("Resource claimed by another session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ClaimResource(gomock.Any(), "first", "1234", expiresAt).Return(true, nil)
+		mock.EXPECT().ClaimResource(gomock.Any(), "second", "1234", expiresAt).Return(false, nil)
+
+		responseType, err := mockPaymentService.claimResources(req.Context(), "1234", []string{"first", "second"}, expiresAt)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [second] is being paid by another payment session")
+	})
+
+	Convey("Resources claimed", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ClaimResource(gomock.Any(), "first", "1234", expiresAt).Return(true, nil)
+		mock.EXPECT().ClaimResource(gomock.Any(), "second", "1234", expiresAt).Return(true, nil)
+
+		responseType, err := mockPaymentService.claimResources(req.Context(), "1234", []string{"first", "second"}, expiresAt)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Claims released whether or not an earlier release fails", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ReleaseResource(gomock.Any(), "first", "1234").Return(fmt.Errorf("error"))
+		mock.EXPECT().ReleaseResource(gomock.Any(), "second", "1234").Return(nil)
+
+		mockPaymentService.releaseResources(req.Context(), "1234", []string{"first", "second"})
+	})
+}
+
+func TestUnitReleaseRefundedResources(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	req := httptest.NewRequest("GET", "/test", nil)
+
+	paymentSession := func(amount string, refunds ...models.RefundResourceRest) models.PaymentResourceRest {
+		return models.PaymentResourceRest{
+			Amount:   amount,
+			Links:    models.PaymentLinksRest{Resource: "http://dummy-resource"},
+			MetaData: models.PaymentResourceMetaDataRest{ID: "1234"},
+			Refunds:  refunds,
+		}
+	}
+
+	Convey("Claims kept while the refunds made are less than the amount paid", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		mockPaymentService.releaseRefundedResources(req.Context(), paymentSession("10.00",
+			models.RefundResourceRest{Amount: 400, Status: RefundsStatusSuccess},
+			models.RefundResourceRest{Amount: 600, Status: RefundsStatusSubmitted},
+		))
+	})
+
+	Convey("Claims kept for a session with nothing to pay", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		mockPaymentService.releaseRefundedResources(req.Context(), paymentSession("0.00"))
+	})
+
+	Convey("Claims released once the refunds made add up to the amount paid", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().ReleaseResource(gomock.Any(), "http://dummy-resource", "1234").Return(nil)
+
+		mockPaymentService.releaseRefundedResources(req.Context(), paymentSession("10.00",
+			models.RefundResourceRest{Amount: 400, Status: RefundsStatusSuccess},
+			models.RefundResourceRest{Amount: 600, Status: "refund-success"},
+			models.RefundResourceRest{Amount: 600, Status: RefundsStatusError},
+		))
+	})
+}
+
+func TestUnitJourneyClaimExpiry(t *testing.T) {
+	cfg, _ := config.Get()
+	c := *cfg
+	c.GovPayExpiryTime = 90
+
+	Convey("Claim expires with the GOV.UK Pay journey", t, func() {
+		paymentSession := models.PaymentResourceRest{CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour * 3)}
+
+		claimExpiry := journeyClaimExpiry(paymentSession, &c)
+		So(claimExpiry, ShouldHappenWithin, time.Minute, time.Now().Add(time.Minute*90))
+	})
+
+	Convey("Claim expires with the session", t, func() {
+		sessionExpiresAt := time.Now().Add(time.Minute * 30).Truncate(time.Millisecond)
+		paymentSession := models.PaymentResourceRest{CreatedAt: time.Now(), ExpiresAt: sessionExpiresAt}
+
+		claimExpiry := journeyClaimExpiry(paymentSession, &c)
+		So(claimExpiry, ShouldEqual, sessionExpiresAt)
+	})
+}
+
+func TestUnitResourceClaimsAcrossJourney(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+
+	Convey("External payment journey not created for a resource another session is paying", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		paymentSession := models.PaymentResourceRest{
+			PaymentMethod: "credit-card",
+			Status:        InProgress.String(),
+			Costs:         []models.CostResourceRest{defaultCost},
+			CreatedAt:     time.Now(),
+			Links:         models.PaymentLinksRest{Resource: "http://dummy-resource"},
+			MetaData:      models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+		gomock.InOrder(
+			mock.EXPECT().ClaimResource(gomock.Any(), "http://dummy-resource", "1234", gomock.Any()).Return(false, nil),
+			mock.EXPECT().ReleaseResource(gomock.Any(), "http://dummy-resource", "1234").Return(nil),
+		)
+		req := httptest.NewRequest("POST", "/test", nil)
+
+		externalPaymentJourney, responseType, err := mockPaymentService.CreateExternalPaymentJourney(req, &paymentSession, CreateMockExternalPaymentProvidersService(PayPalService{PaymentService: mockPaymentService}, GovPayService{PaymentService: mockPaymentService}))
+		So(externalPaymentJourney, ShouldBeNil)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "cost resource [http://dummy-resource] is being paid by another payment session")
+	})
+
+	Convey("Paid session keeps its claims indefinitely", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+		mock.EXPECT().ClaimResource(gomock.Any(), "http://dummy-resource", "1234", time.Time{}).Return(true, nil)
+		req := httptest.NewRequest("PATCH", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "", models.PaymentResourceRest{
+			Status: Paid.String(),
+			Links:  models.PaymentLinksRest{Resource: "http://dummy-resource"},
+		})
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Failed session gives up its claims", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mockPaymentService := createMockPaymentService(mock, cfg)
+		mock.EXPECT().CompletePaymentResource(gomock.Any(), "1234", "", gomock.Any()).Return(true, nil)
+		mock.EXPECT().ReleaseResource(gomock.Any(), "http://dummy-resource", "1234").Return(nil)
+		req := httptest.NewRequest("PATCH", "/test", nil)
+
+		completed, responseType, err := mockPaymentService.CompletePaymentSession(req, "1234", "", models.PaymentResourceRest{
+			Status: Failed.String(),
+			Links:  models.PaymentLinksRest{Resource: "http://dummy-resource"},
+		})
+		So(completed, ShouldBeTrue)
+		So(responseType, ShouldEqual, Success)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/companieshouse/chs.go/log"
+	"github.com/companieshouse/payments.api.ch.gov.uk/helpers"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// extendableStatuses are the statuses of a payment session which can still be paid, and so extended
+var extendableStatuses = append([]string{Pending.String(), InProgress.String()}, retryableStatuses...)
+
+// sessionExpiryTime returns the number of minutes a payment session being created expires after, which is the time
+// asked for by the calling service, or else the default for the session's class of payment
+func (service *PaymentService) sessionExpiryTime(createResource models.IncomingPaymentResourceRequest, costs *models.CostsRest) (int, error) {
+	if createResource.ExpiryTimeInMinutes == 0 {
+		return service.Config.ExpiryTimeForClass(getClassOfPayment(costs.Costs)), nil
+	}
+	if !service.Config.WithinExpiryBounds(createResource.ExpiryTimeInMinutes) {
+		return 0, fmt.Errorf("expiry_time_in_minutes must be between %d and %d", service.Config.MinExpiryTimeInMinutes, service.Config.MaxExpiryTimeInMinutes)
+	}
+	return createResource.ExpiryTimeInMinutes, nil
+}
+
+// ExtendPaymentSession moves the time a payment session expires on, so that it expires the given number of minutes from
+// now. Only a session which hasn't expired and can still be paid can be extended, and its expiry can't be brought
+// forward, nor moved past the maximum lifetime of a session from when it was created. Payer links already issued for the session keep the expiry they were signed with.
+func (service *PaymentService) ExtendPaymentSession(req *http.Request, paymentSession *models.PaymentResourceRest, extendRequest models.ExtendPaymentSessionRequest) (*models.PaymentResourceRest, ResponseType, error) {
+	if err := validator.New().Struct(extendRequest); err != nil {
+		return nil, InvalidData, fmt.Errorf("invalid extend request: [%v]", err)
+	}
+	if !service.Config.WithinExpiryBounds(extendRequest.ExpiryTimeInMinutes) {
+		return nil, InvalidData, fmt.Errorf("expiry_time_in_minutes must be between %d and %d", service.Config.MinExpiryTimeInMinutes, service.Config.MaxExpiryTimeInMinutes)
+	}
+	if IsExpired(*paymentSession, &service.Config) {
+		return nil, InvalidData, fmt.Errorf("payment session has expired")
+	}
+	if paymentSession.Status != Pending.String() && paymentSession.Status != InProgress.String() && !isRetryableFailure(paymentSession.Status) {
+		return nil, InvalidData, fmt.Errorf("payment session with status [%s] can't be extended", paymentSession.Status)
+	}
+
+	expiresAt := helpers.MongoNow().Add(time.Minute * time.Duration(extendRequest.ExpiryTimeInMinutes))
+	if !expiresAt.After(ExpiresAt(*paymentSession, &service.Config)) {
+		return nil, InvalidData, fmt.Errorf("payment session already expires after [%s]", expiresAt.Format(time.RFC3339))
+	}
+	if latestExpiry := service.Config.LatestExpiry(paymentSession.CreatedAt); expiresAt.After(latestExpiry) {
+		return nil, InvalidData, fmt.Errorf("payment session can't be extended past [%s]", latestExpiry.Format(time.RFC3339))
+	}
+
+	extended, err := service.DAO.ExtendPaymentResource(req.Context(), paymentSession.MetaData.ID, extendableStatuses, expiresAt)
+	if err != nil {
+		return nil, Error, fmt.Errorf("error extending payment session on database: [%v]", err)
+	}
+	if !extended {
+		return nil, Conflict, fmt.Errorf("payment session [%s] changed status while it was extended", paymentSession.MetaData.ID)
+	}
+
+	log.InfoR(req, "payment session extended", log.Data{"payment_id": paymentSession.MetaData.ID, "expires_at": expiresAt})
+
+	paymentSession.ExpiresAt = expiresAt
+	return paymentSession, Success, nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/companieshouse/chs.go/authentication"
+	"github.com/companieshouse/payments.api.ch.gov.uk/config"
+	"github.com/companieshouse/payments.api.ch.gov.uk/dao"
+	"github.com/companieshouse/payments.api.ch.gov.uk/models"
+	"github.com/golang/mock/gomock"
+	"github.com/jarcoal/httpmock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitCreatePaymentSessionExpiry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	expiryCfg := *cfg
+	expiryCfg.DomainAllowList = []string{"http://dummy-url"}
+	expiryCfg.RedirectAllowList = []string{"http://www.companieshouse.gov.uk"}
+	expiryCfg.ExpiryTimeInMinutes = 90
+	expiryCfg.MinExpiryTimeInMinutes = 15
+	expiryCfg.MaxExpiryTimeInMinutes = 1440
+
+	createRequest := func(mock *dao.MockDAO, cfg *config.Config, expiryTimeInMinutes int) (*models.PaymentResourceRest, ResponseType, error) {
+		mockPaymentService := createMockPaymentService(mock, cfg)
+
+		httpmock.Activate()
+		defer httpmock.DeactivateAndReset()
+		jsonResponse, _ := httpmock.NewJsonResponder(200, defaultCosts)
+		httpmock.RegisterResponder("GET", "http://dummy-url", jsonResponse)
+
+		req := httptest.NewRequest("POST", "/test", nil)
+		ctx := context.WithValue(req.Context(), authentication.ContextKeyUserDetails, defaultUserDetails)
+
+		return mockPaymentService.CreatePaymentSession(req.WithContext(ctx), models.IncomingPaymentResourceRequest{
+			Resource:            "http://dummy-url",
+			RedirectURI:         "http://www.companieshouse.gov.uk",
+			State:               "state",
+			ExpiryTimeInMinutes: expiryTimeInMinutes,
+		})
+	}
+
+	Convey("Session expires after the default expiry time", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
+
+		paymentResourceRest, status, err := createRequest(mock, &expiryCfg, 0)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.ExpiresAt, ShouldEqual, paymentResourceRest.CreatedAt.Add(90*time.Minute))
+	})
+
+	Convey("Session expires after the expiry time for its class of payment", t, func() {
+		classCfg := expiryCfg
+		classCfg.ExpiryTimeByClassJSON = `{"data-maintenance":600}`
+		So(classCfg.Parse(), ShouldBeNil)
+		var saved *models.PaymentResourceDB
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, paymentResource *models.PaymentResourceDB) error {
+			saved = paymentResource
+			return nil
+		})
+
+		paymentResourceRest, status, err := createRequest(mock, &classCfg, 0)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.ExpiresAt, ShouldEqual, paymentResourceRest.CreatedAt.Add(600*time.Minute))
+		So(saved.Data.ExpiresAt, ShouldEqual, paymentResourceRest.ExpiresAt)
+	})
+
+	Convey("Session expires after the expiry time asked for", t, func() {
+		classCfg := expiryCfg
+		classCfg.ExpiryTimeByClassJSON = `{"data-maintenance":600}`
+		So(classCfg.Parse(), ShouldBeNil)
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().GetPaymentResourcesByResource(gomock.Any(), "http://dummy-url", gomock.Any())
+		mock.EXPECT().CreatePaymentResource(gomock.Any(), gomock.Any())
+
+		paymentResourceRest, status, err := createRequest(mock, &classCfg, 30)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, Success)
+		So(paymentResourceRest.ExpiresAt, ShouldEqual, paymentResourceRest.CreatedAt.Add(30*time.Minute))
+	})
+
+	Convey("Expiry time asked for outside the bounds", t, func() {
+		paymentResourceRest, status, err := createRequest(dao.NewMockDAO(mockCtrl), &expiryCfg, 1441)
+		So(paymentResourceRest, ShouldBeNil)
+		So(status, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "invalid expiry time: [expiry_time_in_minutes must be between 15 and 1440]")
+	})
+}
+
+func TestUnitExtendPaymentSession(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cfg, _ := config.Get()
+	expiryCfg := *cfg
+	expiryCfg.MinExpiryTimeInMinutes = 15
+	expiryCfg.MaxExpiryTimeInMinutes = 1440
+	expiryCfg.MaxSessionLifetimeInMinutes = 2880
+
+	paymentSession := func(status string, expiresAt time.Time) *models.PaymentResourceRest {
+		return &models.PaymentResourceRest{
+			Status:    status,
+			CreatedAt: time.Now().Add(-time.Hour),
+			ExpiresAt: expiresAt,
+			MetaData:  models.PaymentResourceMetaDataRest{ID: "1234"},
+		}
+	}
+	extend := func(mockPaymentService PaymentService, session *models.PaymentResourceRest, minutes int) (*models.PaymentResourceRest, ResponseType, error) {
+		return mockPaymentService.ExtendPaymentSession(httptest.NewRequest("POST", "/test", nil), session, models.ExtendPaymentSessionRequest{ExpiryTimeInMinutes: minutes})
+	}
+
+	Convey("Expiry time missing", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(InProgress.String(), time.Now().Add(time.Hour)), 0)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "invalid extend request")
+	})
+
+	Convey("Expiry time outside the bounds", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(InProgress.String(), time.Now().Add(time.Hour)), 10)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "expiry_time_in_minutes must be between 15 and 1440")
+	})
+
+	Convey("Payment session expired", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(InProgress.String(), time.Now().Add(-time.Minute)), 120)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "payment session has expired")
+	})
+
+	Convey("Payment session already paid", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(Paid.String(), time.Now().Add(time.Hour)), 120)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldEqual, "payment session with status [paid] can't be extended")
+	})
+
+	Convey("Expiry can't be brought forward", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(InProgress.String(), time.Now().Add(time.Hour)), 30)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "payment session already expires after")
+	})
+
+	Convey("Payment session can't be extended past its maximum lifetime", t, func() {
+		mockPaymentService := createMockPaymentService(dao.NewMockDAO(mockCtrl), &expiryCfg)
+		session := paymentSession(InProgress.String(), time.Now().Add(time.Hour))
+		session.CreatedAt = time.Now().Add(-time.Hour * 40)
+
+		extended, responseType, err := extend(mockPaymentService, session, 600)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, InvalidData)
+		So(err.Error(), ShouldStartWith, "payment session can't be extended past")
+	})
+
+	Convey("Payment session extended up to its maximum lifetime", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(true, nil)
+		mockPaymentService := createMockPaymentService(mock, &expiryCfg)
+		session := paymentSession(InProgress.String(), time.Now().Add(time.Hour))
+		session.CreatedAt = time.Now().Add(-time.Hour * 40)
+
+		extended, responseType, err := extend(mockPaymentService, session, 420)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(extended.ExpiresAt, ShouldHappenBefore, expiryCfg.LatestExpiry(session.CreatedAt))
+	})
+
+	Convey("Error extending payment session", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, errors.New("error"))
+		mockPaymentService := createMockPaymentService(mock, &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(InProgress.String(), time.Now().Add(time.Hour)), 120)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, Error)
+		So(err.Error(), ShouldEqual, "error extending payment session on database: [error]")
+	})
+
+	Convey("Payment session changed status while it was extended", t, func() {
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).Return(false, nil)
+		mockPaymentService := createMockPaymentService(mock, &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(InProgress.String(), time.Now().Add(time.Hour)), 120)
+		So(extended, ShouldBeNil)
+		So(responseType, ShouldEqual, Conflict)
+		So(err.Error(), ShouldEqual, "payment session [1234] changed status while it was extended")
+	})
+
+	Convey("Payment session extended", t, func() {
+		var statuses []string
+		var expiresAt time.Time
+		mock := dao.NewMockDAO(mockCtrl)
+		mock.EXPECT().ExtendPaymentResource(gomock.Any(), "1234", gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, s []string, e time.Time) (bool, error) {
+			statuses, expiresAt = s, e
+			return true, nil
+		})
+		mockPaymentService := createMockPaymentService(mock, &expiryCfg)
+
+		extended, responseType, err := extend(mockPaymentService, paymentSession(Failed.String(), time.Now().Add(time.Hour)), 120)
+		So(err, ShouldBeNil)
+		So(responseType, ShouldEqual, Success)
+		So(extended.ExpiresAt, ShouldEqual, expiresAt)
+		So(expiresAt, ShouldHappenWithin, time.Second, time.Now().Add(120*time.Minute))
+		So(statuses, ShouldContain, Pending.String())
+		So(statuses, ShouldContain, InProgress.String())
+		So(statuses, ShouldContain, Failed.String())
+		So(statuses, ShouldNotContain, Paid.String())
+	})
+}
@@ -0,0 +1,2 @@
+// Package tracing configures OpenTelemetry and contains helpers for starting spans and propagating trace context.
+package tracing
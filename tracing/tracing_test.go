@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const incomingTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// setupRecorder configures propagation and a tracer provider which records every ended span
+func setupRecorder() *tracetest.SpanRecorder {
+	_, _ = Init(context.Background(), "test", "")
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestUnitInit(t *testing.T) {
+	Convey("Tracing is a no-op when no endpoint is configured", t, func() {
+		shutdown, err := Init(context.Background(), "test", "")
+		So(err, ShouldBeNil)
+		So(shutdown(context.Background()), ShouldBeNil)
+	})
+}
+
+func TestUnitHandler(t *testing.T) {
+	Convey("A server span named after the route continues the incoming trace", t, func() {
+		recorder := setupRecorder()
+
+		router := mux.NewRouter()
+		router.HandleFunc("/test", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}).Name("test-route")
+		router.Use(Handler)
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("traceparent", incomingTraceParent)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		So(spans, ShouldHaveLength, 1)
+		So(spans[0].Name(), ShouldEqual, "test-route")
+		So(spans[0].SpanContext().TraceID().String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		So(spans[0].Status().Code, ShouldEqual, codes.Error)
+	})
+}
+
+func TestUnitTransport(t *testing.T) {
+	Convey("Outbound requests carry the trace context of the caller", t, func() {
+		recorder := setupRecorder()
+
+		var received string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Get("traceparent")
+		}))
+		defer server.Close()
+
+		ctx, parent := StartSpan(context.Background(), "parent")
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		parent.End()
+
+		So(received, ShouldContainSubstring, parent.SpanContext().TraceID().String())
+		So(req.Header.Get("traceparent"), ShouldBeEmpty)
+		So(recorder.Ended(), ShouldHaveLength, 2)
+	})
+}
+
+func TestUnitStartProducerSpan(t *testing.T) {
+	Convey("Kafka headers carry the trace context and errors are recorded on the span", t, func() {
+		recorder := setupRecorder()
+
+		_, span, headers := StartProducerSpan(context.Background(), "kafka.publish", "topic")
+		EndSpan(span, errors.New("error"))
+
+		So(headers["traceparent"], ShouldContainSubstring, span.SpanContext().TraceID().String())
+		So(recorder.Ended(), ShouldHaveLength, 1)
+		So(recorder.Ended()[0].Status().Code, ShouldEqual, codes.Error)
+	})
+}
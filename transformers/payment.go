@@ -20,6 +20,7 @@ func (pt PaymentTransformer) TransformToDB(rest models.PaymentResourceRest) mode
 		Amount:        rest.Amount,
 		CompletedAt:   rest.CompletedAt,
 		CreatedAt:     rest.CreatedAt,
+		ExpiresAt:     rest.ExpiresAt,
 		Description:   rest.Description,
 		PaymentMethod: rest.PaymentMethod,
 		Reference:     rest.Reference,
@@ -27,14 +28,20 @@ func (pt PaymentTransformer) TransformToDB(rest models.PaymentResourceRest) mode
 		Status:        rest.Status,
 		Etag:          rest.Etag,
 		Kind:          rest.Kind,
+		Language:      rest.Language,
 		ProviderID:    rest.ProviderID,
 	}
 
 	paymentResourceData.CreatedBy = models.CreatedByDB(rest.CreatedBy)
+	if rest.PaidBy != nil {
+		paidBy := models.CreatedByDB(*rest.PaidBy)
+		paymentResourceData.PaidBy = &paidBy
+	}
 	paymentResourceData.Links = models.PaymentLinksDB(rest.Links)
 
 	paymentResource := models.PaymentResourceDB{
 		ExternalPaymentTransactionID: rest.MetaData.ExternalPaymentTransactionID,
+		PrefilledCardholderDetails:   getPrefilledCardholderDetailsDB(rest.MetaData.PrefilledCardholderDetails),
 		Data:                         paymentResourceData,
 		Refunds:                      getRefundsDB(rest.Refunds),
 	}
@@ -48,6 +55,7 @@ func (pt PaymentTransformer) TransformToRest(dbResource models.PaymentResourceDB
 		Amount:        dbResource.Data.Amount,
 		CompletedAt:   dbResource.Data.CompletedAt,
 		CreatedAt:     dbResource.Data.CreatedAt,
+		ExpiresAt:     dbResource.Data.ExpiresAt,
 		CreatedBy:     models.CreatedByRest(dbResource.Data.CreatedBy),
 		Description:   dbResource.Data.Description,
 		PaymentMethod: dbResource.Data.PaymentMethod,
@@ -57,22 +65,93 @@ func (pt PaymentTransformer) TransformToRest(dbResource models.PaymentResourceDB
 		Links:         models.PaymentLinksRest(dbResource.Data.Links),
 		Etag:          dbResource.Data.Etag,
 		Kind:          dbResource.Data.Kind,
+		Language:      dbResource.Data.Language,
 		Refunds:       getRefundsRest(dbResource.Refunds),
 		ProviderID:    dbResource.Data.ProviderID,
+		BankTransfer:  getBankTransferRest(dbResource.BankTransfer),
+	}
+	if dbResource.Data.PaidBy != nil {
+		paidBy := models.CreatedByRest(*dbResource.Data.PaidBy)
+		paymentResource.PaidBy = &paidBy
 	}
 
 	// One-way transformation of DB metadata: related to, but not part of the payment rest data json spec
 	paymentResource.MetaData = models.PaymentResourceMetaDataRest{
-		ID:                       dbResource.ID,
-		RedirectURI:              dbResource.RedirectURI,
-		State:                    dbResource.State,
-		ExternalPaymentStatusURI: dbResource.ExternalPaymentStatusURI,
-		ExternalPaymentStatusID:  dbResource.ExternalPaymentStatusID,
+		ID:                         dbResource.ID,
+		RedirectURI:                dbResource.RedirectURI,
+		State:                      dbResource.State,
+		ClientID:                   dbResource.ClientID,
+		ExternalPaymentStatusURI:   dbResource.ExternalPaymentStatusURI,
+		ExternalPaymentStatusID:    dbResource.ExternalPaymentStatusID,
+		CallbackTokenHash:          dbResource.CallbackTokenHash,
+		CallbackTokenOutstanding:   dbResource.CallbackTokenHash != "",
+		PrefilledCardholderDetails: getPrefilledCardholderDetailsRest(dbResource.PrefilledCardholderDetails),
+		ExternalPaymentAttempts:    getExternalPaymentAttemptsRest(dbResource.ExternalPaymentAttempts),
+		PayerLink:                  getPayerLinkRest(dbResource.PayerLink),
 	}
 
 	return paymentResource
 }
 
+func getPrefilledCardholderDetailsDB(details *models.PrefilledCardholderDetails) *models.PrefilledCardholderDetailsDB {
+	if details == nil {
+		return nil
+	}
+
+	detailsDB := &models.PrefilledCardholderDetailsDB{CardholderName: details.CardholderName}
+	if details.BillingAddress != nil {
+		billingAddress := models.BillingAddressDB(*details.BillingAddress)
+		detailsDB.BillingAddress = &billingAddress
+	}
+	return detailsDB
+}
+
+func getPrefilledCardholderDetailsRest(details *models.PrefilledCardholderDetailsDB) *models.PrefilledCardholderDetails {
+	if details == nil {
+		return nil
+	}
+
+	detailsRest := &models.PrefilledCardholderDetails{CardholderName: details.CardholderName}
+	if details.BillingAddress != nil {
+		billingAddress := models.BillingAddress(*details.BillingAddress)
+		detailsRest.BillingAddress = &billingAddress
+	}
+	return detailsRest
+}
+
+func getBankTransferRest(bankTransfer *models.BankTransferDB) *models.BankTransferRest {
+	if bankTransfer == nil {
+		return nil
+	}
+
+	return &models.BankTransferRest{
+		Reference:      bankTransfer.Reference,
+		AccountName:    bankTransfer.AccountName,
+		SortCode:       bankTransfer.SortCode,
+		AccountNumber:  bankTransfer.AccountNumber,
+		IBAN:           bankTransfer.IBAN,
+		BIC:            bankTransfer.BIC,
+		AmountReceived: bankTransfer.AmountReceived,
+	}
+}
+
+func getPayerLinkRest(payerLink *models.PayerLinkDB) *models.PayerLink {
+	if payerLink == nil {
+		return nil
+	}
+
+	link := models.PayerLink(*payerLink)
+	return &link
+}
+
+func getExternalPaymentAttemptsRest(attempts []models.ExternalPaymentAttemptDB) []models.ExternalPaymentAttempt {
+	var attemptsRest []models.ExternalPaymentAttempt
+	for _, attempt := range attempts {
+		attemptsRest = append(attemptsRest, models.ExternalPaymentAttempt(attempt))
+	}
+	return attemptsRest
+}
+
 func getRefundsDB(refunds []models.RefundResourceRest) []models.RefundResourceDB {
 	var refundsDB []models.RefundResourceDB
 
@@ -92,6 +171,7 @@ func getRefundDB(refund models.RefundResourceRest) models.RefundResourceDB {
 		Status:            refund.Status,
 		ExternalRefundUrl: refund.ExternalRefundUrl,
 		RefundReference:   refund.RefundReference,
+		Resource:          refund.Resource,
 	}
 }
 
@@ -114,5 +194,6 @@ func getRefundRest(refund models.RefundResourceDB) models.RefundResourceRest {
 		Status:            refund.Status,
 		ExternalRefundUrl: refund.ExternalRefundUrl,
 		RefundReference:   refund.RefundReference,
+		Resource:          refund.Resource,
 	}
 }
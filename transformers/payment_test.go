@@ -22,6 +22,7 @@ func TestUnitTransformToDB(t *testing.T) {
 				ID:       "abc",
 				Surname:  "user_surname",
 			},
+			PaidBy:      &models.CreatedByRest{Email: "finance@client.co.uk", ID: "def"},
 			Description: "payment_description",
 			Links: models.PaymentLinksRest{
 				Journey:  "links_journey",
@@ -60,6 +61,10 @@ func TestUnitTransformToDB(t *testing.T) {
 				},
 			},
 			ProviderID: "abc123",
+			Language:   "cy",
+			MetaData: models.PaymentResourceMetaDataRest{
+				PrefilledCardholderDetails: &models.PrefilledCardholderDetails{CardholderName: "J Bloggs"},
+			},
 		}
 
 		expectedPaymentResourceDB := models.PaymentResourceDB{
@@ -73,6 +78,7 @@ func TestUnitTransformToDB(t *testing.T) {
 					ID:       "abc",
 					Surname:  "user_surname",
 				},
+				PaidBy:      &models.CreatedByDB{Email: "finance@client.co.uk", ID: "def"},
 				Description: "payment_description",
 				Links: models.PaymentLinksDB{
 					Journey:  "links_journey",
@@ -84,6 +90,7 @@ func TestUnitTransformToDB(t *testing.T) {
 				CompanyNumber: "companyNumber",
 				Status:        "pending",
 				ProviderID:    "abc123",
+				Language:      "cy",
 			},
 			Refunds: []models.RefundResourceDB{
 				{
@@ -94,6 +101,7 @@ func TestUnitTransformToDB(t *testing.T) {
 					ExternalRefundUrl: "external",
 				},
 			},
+			PrefilledCardholderDetails: &models.PrefilledCardholderDetailsDB{CardholderName: "J Bloggs"},
 		}
 		paymentResourceDB := PaymentTransformer{}.TransformToDB(paymentResourceRest)
 		So(paymentResourceDB, ShouldResemble, expectedPaymentResourceDB)
@@ -114,6 +122,7 @@ func TestUnitTransformToRest(t *testing.T) {
 					ID:       "abc",
 					Surname:  "user_surname",
 				},
+				PaidBy:      &models.CreatedByDB{Email: "finance@client.co.uk", ID: "def"},
 				Description: "payment_description",
 				Links: models.PaymentLinksDB{
 					Journey:  "links_journey",
@@ -125,6 +134,7 @@ func TestUnitTransformToRest(t *testing.T) {
 				CompanyNumber: "companyNumber",
 				Status:        "pending",
 				ProviderID:    "abc123",
+				Language:      "cy",
 			},
 			Refunds: []models.RefundResourceDB{
 				{
@@ -135,6 +145,27 @@ func TestUnitTransformToRest(t *testing.T) {
 					ExternalRefundUrl: "external",
 				},
 			},
+			PrefilledCardholderDetails: &models.PrefilledCardholderDetailsDB{
+				CardholderName: "J Bloggs",
+				BillingAddress: &models.BillingAddressDB{Line1: "Crown Way", Country: "GB"},
+			},
+			CallbackTokenHash: "hash",
+			ExternalPaymentAttempts: []models.ExternalPaymentAttemptDB{
+				{
+					PaymentMethod:            "credit-card",
+					ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/abc",
+					ExternalPaymentStatusID:  "abc",
+					CreatedAt:                now,
+				},
+			},
+			BankTransfer: &models.BankTransferDB{
+				Reference:     "CH2AB3C4D5E6",
+				AccountName:   "Companies House",
+				SortCode:      "60-70-80",
+				AccountNumber: "10014411",
+				RequestedAt:   now,
+			},
+			PayerLink: &models.PayerLinkDB{ID: "link", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
 		}
 		expectedPaymentResourceRest := models.PaymentResourceRest{
 			Amount:      "123",
@@ -146,6 +177,7 @@ func TestUnitTransformToRest(t *testing.T) {
 				ID:       "abc",
 				Surname:  "user_surname",
 			},
+			PaidBy:      &models.CreatedByRest{Email: "finance@client.co.uk", ID: "def"},
 			Description: "payment_description",
 			Links: models.PaymentLinksRest{
 				Journey:  "links_journey",
@@ -166,6 +198,30 @@ func TestUnitTransformToRest(t *testing.T) {
 				},
 			},
 			ProviderID: "abc123",
+			Language:   "cy",
+			BankTransfer: &models.BankTransferRest{
+				Reference:     "CH2AB3C4D5E6",
+				AccountName:   "Companies House",
+				SortCode:      "60-70-80",
+				AccountNumber: "10014411",
+			},
+			MetaData: models.PaymentResourceMetaDataRest{
+				PrefilledCardholderDetails: &models.PrefilledCardholderDetails{
+					CardholderName: "J Bloggs",
+					BillingAddress: &models.BillingAddress{Line1: "Crown Way", Country: "GB"},
+				},
+				CallbackTokenHash:        "hash",
+				CallbackTokenOutstanding: true,
+				ExternalPaymentAttempts: []models.ExternalPaymentAttempt{
+					{
+						PaymentMethod:            "credit-card",
+						ExternalPaymentStatusURI: "https://publicapi.payments.service.gov.uk/v1/payments/abc",
+						ExternalPaymentStatusID:  "abc",
+						CreatedAt:                now,
+					},
+				},
+				PayerLink: &models.PayerLink{ID: "link", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			},
 		}
 
 		paymentResourceRest := PaymentTransformer{}.TransformToRest(paymentResourceDB)